@@ -30,6 +30,7 @@ require (
 	github.com/go-xorm/xorm v0.7.1
 	github.com/gobwas/glob v0.2.3
 	github.com/google/go-cmp v0.2.0 // indirect
+	github.com/google/go-jsonnet v0.15.0
 	github.com/gorilla/websocket v1.4.0
 	github.com/gosimple/slug v1.4.2
 	github.com/grafana/grafana-plugin-model v0.0.0-20190930120109-1fc953a61fb4
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/setting"
 )
@@ -35,6 +36,18 @@ func AdminGetSettings(c *m.ReqContext) {
 		}
 	}
 
+	// the capabilities of the registered providers are shown with their settings
+	for _, info := range social.GetOAuthProviderInfos() {
+		jsonSec, ok := settings["auth."+info.Name].(map[string]interface{})
+		if !ok || info.Capabilities == nil {
+			continue
+		}
+
+		for key, value := range info.Capabilities.Settings() {
+			jsonSec[key] = value
+		}
+	}
+
 	c.JSON(200, settings)
 }
 
@@ -49,3 +62,8 @@ func AdminGetStats(c *m.ReqContext) {
 
 	c.JSON(200, statsQuery.Result)
 }
+
+// GET /api/admin/oauth/providers
+func AdminGetOAuthProviders(c *m.ReqContext) Response {
+	return JSON(200, social.GetOAuthProviderInfos())
+}
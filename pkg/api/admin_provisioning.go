@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+
 	"github.com/grafana/grafana/pkg/models"
+	provisioningdashboards "github.com/grafana/grafana/pkg/services/provisioning/dashboards"
 )
 
 func (server *HTTPServer) AdminProvisioningReloadDasboards(c *models.ReqContext) Response {
@@ -13,6 +15,18 @@ func (server *HTTPServer) AdminProvisioningReloadDasboards(c *models.ReqContext)
 	return Success("Dashboards config reloaded")
 }
 
+// AdminProvisioningReportDashboards compares the provisioned dashboards with their files without saving them.
+// diffs=true adds the diff of each changed dashboard.
+func (server *HTTPServer) AdminProvisioningReportDashboards(c *models.ReqContext) Response {
+	opts := provisioningdashboards.ReportOptions{IncludeDiffs: c.QueryBool("diffs")}
+
+	reports, err := server.ProvisioningService.ReportDashboards(opts)
+	if err != nil {
+		return Error(500, "Failed to report provisioned dashboards", err)
+	}
+	return JSON(200, reports)
+}
+
 func (server *HTTPServer) AdminProvisioningReloadDatasources(c *models.ReqContext) Response {
 	err := server.ProvisioningService.ProvisionDatasources()
 	if err != nil {
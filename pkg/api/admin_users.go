@@ -4,6 +4,7 @@ import (
 	"github.com/grafana/grafana/pkg/api/dtos"
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/login/social"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/util"
 )
@@ -152,6 +153,17 @@ func AdminEnableUser(c *models.ReqContext) Response {
 	return Success("User enabled")
 }
 
+// POST /api/admin/users/:id/invalidate-group-cache
+func AdminInvalidateUserGroupCache(c *models.ReqContext) Response {
+	userID := c.ParamsInt64(":id")
+
+	if err := social.InvalidateUserGroupCache(userID); err != nil {
+		return Error(500, "Failed to invalidate group cache", err)
+	}
+
+	return Success("Group cache invalidated")
+}
+
 // POST /api/admin/users/:id/logout
 func (server *HTTPServer) AdminLogoutUser(c *models.ReqContext) Response {
 	userID := c.ParamsInt64(":id")
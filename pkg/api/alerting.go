@@ -141,6 +141,9 @@ func AlertTest(c *models.ReqContext, dto dtos.AlertTestCommand) Response {
 		if validationErr, ok := err.(alerting.ValidationError); ok {
 			return Error(422, validationErr.Error(), nil)
 		}
+		if accessErr, ok := err.(alerting.DatasourceAccessDeniedError); ok {
+			return Error(403, accessErr.Error(), err)
+		}
 		if err == models.ErrDataSourceAccessDenied {
 			return Error(403, "Access denied to datasource", err)
 		}
@@ -74,6 +74,7 @@ func (hs *HTTPServer) registerRoutes() {
 	r.Get("/d-solo/:uid", reqSignedIn, hs.Index)
 	r.Get("/dashboard-solo/db/:slug", reqSignedIn, redirectFromLegacyDashboardSoloURL, hs.Index)
 	r.Get("/dashboard-solo/script/*", reqSignedIn, hs.Index)
+	r.Get("/dashboard-archive/:uid", reqSignedIn, Wrap(ArchiveDashboardFromReport))
 	r.Get("/import/dashboard", reqSignedIn, hs.Index)
 	r.Get("/dashboards/", reqSignedIn, hs.Index)
 	r.Get("/dashboards/*", reqSignedIn, hs.Index)
@@ -216,8 +217,21 @@ func (hs *HTTPServer) registerRoutes() {
 			orgsRoute.Delete("/users/:userId", Wrap(RemoveOrgUser))
 			orgsRoute.Get("/quotas", Wrap(GetOrgQuotas))
 			orgsRoute.Put("/quotas/:target", bind(models.UpdateOrgQuotaCmd{}), Wrap(UpdateOrgQuota))
+			orgsRoute.Get("/oauth", Wrap(GetOrgOAuthConfigs))
+			orgsRoute.Put("/oauth/:provider", bind(models.SaveOrgOAuthConfigCommand{}), Wrap(UpdateOrgOAuthConfig))
+			orgsRoute.Delete("/oauth/:provider", Wrap(DeleteOrgOAuthConfig))
+			orgsRoute.Post("/git/migrate-layout", bind(dtos.MigrateRepoLayoutForm{}), Wrap(MigrateRepoLayout))
+			orgsRoute.Post("/git/import", bind(dtos.ImportGitOnlyDashboardsForm{}), Wrap(ImportGitOnlyDashboards))
+			orgsRoute.Get("/git/sync-budget", Wrap(GetGitSyncBudget))
+			orgsRoute.Post("/git/promote-mirror", bind(dtos.PromoteRepoMirrorForm{}), Wrap(PromoteRepoMirror))
+			orgsRoute.Get("/dashboards/bundle", Wrap(hs.ExportOrgDashboardBundle))
+			orgsRoute.Post("/dashboards/bundle", Wrap(hs.ImportOrgDashboardBundle))
+			orgsRoute.Post("/dashboards/repair-orphans", bind(dtos.RepairOrphanedDashboardsForm{}), Wrap(RepairOrphanedDashboards))
 		}, reqGrafanaAdmin)
 
+		// git sync health of an org, for its admins
+		apiRoute.Get("/orgs/:orgId/git-sync/overview", reqOrgAdmin, Wrap(GetGitSyncOverview))
+
 		// orgs (admin routes)
 		apiRoute.Group("/orgs/name/:name", func(orgsRoute routing.RouteRegister) {
 			orgsRoute.Get("/", Wrap(GetOrgByName))
@@ -271,6 +285,8 @@ func (hs *HTTPServer) registerRoutes() {
 				folderUidRoute.Get("/", Wrap(GetFolderByUID))
 				folderUidRoute.Put("/", bind(models.UpdateFolderCommand{}), Wrap(UpdateFolder))
 				folderUidRoute.Delete("/", Wrap(DeleteFolder))
+				folderUidRoute.Get("/template", Wrap(GetFolderTemplate))
+				folderUidRoute.Put("/template", bind(dtos.UpdateFolderTemplateForm{}), Wrap(UpdateFolderTemplate))
 
 				folderUidRoute.Group("/permissions", func(folderPermissionRoute routing.RouteRegister) {
 					folderPermissionRoute.Get("/", Wrap(GetFolderPermissionList))
@@ -283,6 +299,9 @@ func (hs *HTTPServer) registerRoutes() {
 		apiRoute.Group("/dashboards", func(dashboardRoute routing.RouteRegister) {
 			dashboardRoute.Get("/uid/:uid", Wrap(hs.GetDashboard))
 			dashboardRoute.Delete("/uid/:uid", Wrap(DeleteDashboardByUID))
+			dashboardRoute.Post("/uid/:uid/delete-confirmation", Wrap(PrepareDeleteDashboardByUID))
+			dashboardRoute.Post("/uid/:uid/archive", Wrap(ArchiveDashboardByUID))
+			dashboardRoute.Get("/uid/:uid/at/:ref", Wrap(GetDashboardAtCommit))
 
 			dashboardRoute.Get("/db/:slug", Wrap(hs.GetDashboard))
 			dashboardRoute.Delete("/db/:slug", Wrap(DeleteDashboardBySlug))
@@ -292,7 +311,9 @@ func (hs *HTTPServer) registerRoutes() {
 			dashboardRoute.Post("/db", bind(models.SaveDashboardCommand{}), Wrap(hs.PostDashboard))
 			dashboardRoute.Get("/home", Wrap(GetHomeDashboard))
 			dashboardRoute.Get("/tags", GetDashboardTags)
+			dashboardRoute.Get("/stale", reqOrgAdmin, Wrap(GetStaleDashboards))
 			dashboardRoute.Post("/import", bind(dtos.ImportDashboardCommand{}), Wrap(ImportDashboard))
+			dashboardRoute.Post("/import/git", bind(dtos.ImportDashboardFromGitUrlCommand{}), Wrap(ImportDashboardFromGitUrl))
 
 			dashboardRoute.Group("/id/:dashboardId", func(dashIdRoute routing.RouteRegister) {
 				dashIdRoute.Get("/versions", Wrap(GetDashboardVersions))
@@ -306,6 +327,14 @@ func (hs *HTTPServer) registerRoutes() {
 			})
 		})
 
+		apiRoute.Get("/git-sync/lookup", Wrap(LookupDashboardsByRepoPath))
+
+		// Dashboard jobs
+		apiRoute.Group("/dashboard-jobs/:id", func(jobRoute routing.RouteRegister) {
+			jobRoute.Get("/", Wrap(GetDashboardJob))
+			jobRoute.Post("/cancel", Wrap(CancelDashboardJob))
+		}, reqGrafanaAdmin)
+
 		// Dashboard snapshots
 		apiRoute.Group("/dashboard/snapshots", func(dashboardRoute routing.RouteRegister) {
 			dashboardRoute.Get("/", Wrap(SearchDashboardSnapshots))
@@ -386,13 +415,23 @@ func (hs *HTTPServer) registerRoutes() {
 		adminRoute.Get("/users/:id/quotas", Wrap(GetUserQuotas))
 		adminRoute.Put("/users/:id/quotas/:target", bind(models.UpdateUserQuotaCmd{}), Wrap(UpdateUserQuota))
 		adminRoute.Get("/stats", AdminGetStats)
+		adminRoute.Get("/oauth/providers", Wrap(AdminGetOAuthProviders))
 		adminRoute.Post("/pause-all-alerts", bind(dtos.PauseAllAlertsCommand{}), Wrap(PauseAllAlerts))
 
 		adminRoute.Post("/users/:id/logout", Wrap(hs.AdminLogoutUser))
+		adminRoute.Post("/users/:id/invalidate-group-cache", Wrap(AdminInvalidateUserGroupCache))
+		adminRoute.Get("/git/sync", Wrap(GetGitSyncStatus))
+		adminRoute.Put("/git/sync", bind(dtos.SetGitSyncPausedForm{}), Wrap(SetGitSyncPaused))
+		adminRoute.Get("/git/sync/queue", Wrap(GetQueuedGitSyncCommits))
+		adminRoute.Post("/git/sync/queue/requeue", bind(dtos.QueuedSyncCommitsForm{}), Wrap(RequeueGitSyncCommits))
+		adminRoute.Post("/git/sync/queue/purge", bind(dtos.QueuedSyncCommitsForm{}), Wrap(PurgeGitSyncCommits))
+		adminRoute.Get("/dashboards/maintenance", Wrap(GetDashboardMaintenance))
+		adminRoute.Put("/dashboards/maintenance", bind(dtos.SetDashboardMaintenanceForm{}), Wrap(SetDashboardMaintenance))
 		adminRoute.Get("/users/:id/auth-tokens", Wrap(hs.AdminGetUserAuthTokens))
 		adminRoute.Post("/users/:id/revoke-auth-token", bind(models.RevokeAuthTokenCmd{}), Wrap(hs.AdminRevokeUserAuthToken))
 
 		adminRoute.Post("/provisioning/dashboards/reload", Wrap(hs.AdminProvisioningReloadDasboards))
+		adminRoute.Get("/provisioning/dashboards/report", Wrap(hs.AdminProvisioningReportDashboards))
 		adminRoute.Post("/provisioning/datasources/reload", Wrap(hs.AdminProvisioningReloadDatasources))
 		adminRoute.Post("/provisioning/notifications/reload", Wrap(hs.AdminProvisioningReloadNotifications))
 		adminRoute.Post("/ldap/reload", Wrap(hs.ReloadLDAPCfg))
@@ -3,9 +3,12 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/grafana/grafana/pkg/services/alerting"
 	"github.com/grafana/grafana/pkg/services/dashboards"
@@ -23,6 +26,7 @@ import (
 	"github.com/grafana/grafana/pkg/util"
 
 	"github.com/grafana/grafana/pkg/login/social"
+	"golang.org/x/xerrors"
 )
 
 const (
@@ -61,6 +65,10 @@ func (hs *HTTPServer) GetDashboard(c *m.ReqContext) Response {
 		return dashboardGuardianResponse(err)
 	}
 
+	if !dash.IsFolder {
+		dashboards.RecordDashboardView(c.OrgId, dash.Id)
+	}
+
 	canEdit, _ := guardian.CanEdit()
 	canSave, _ := guardian.CanSave()
 	canAdmin, _ := guardian.CanAdmin()
@@ -97,6 +105,7 @@ func (hs *HTTPServer) GetDashboard(c *m.ReqContext) Response {
 		FolderId:    dash.FolderId,
 		Url:         dash.GetUrl(),
 		FolderTitle: "General",
+		Source:      string(dash.Source),
 	}
 
 	// lookup folder title
@@ -109,10 +118,11 @@ func (hs *HTTPServer) GetDashboard(c *m.ReqContext) Response {
 		meta.FolderUrl = query.Result.GetUrl()
 	}
 
-	provisioningData, err := dashboards.NewProvisioningService().GetProvisionedDashboardDataByDashboardId(dash.Id)
-	if err != nil {
+	provisioningQuery := &m.GetProvisionedDashboardDataByIdQuery{DashboardId: dash.Id}
+	if err := bus.Dispatch(provisioningQuery); err != nil {
 		return Error(500, "Error while checking if dashboard is provisioned", err)
 	}
+	provisioningData := provisioningQuery.Result
 
 	if provisioningData != nil {
 		meta.Provisioned = true
@@ -127,6 +137,16 @@ func (hs *HTTPServer) GetDashboard(c *m.ReqContext) Response {
 		}
 	}
 
+	gitSync, err := dashboards.NewService().GetGitSyncMeta(dash.Id, c.OrgId)
+	if err != nil {
+		return Error(500, "Error while checking if dashboard is synced", err)
+	}
+
+	if gitSync != nil {
+		meta.IsExternallySynced = true
+		meta.GitSync = gitSync
+	}
+
 	// make sure db version is in sync with json model version
 	dash.Data.Set("version", dash.Version)
 
@@ -139,6 +159,45 @@ func (hs *HTTPServer) GetDashboard(c *m.ReqContext) Response {
 	return JSON(200, dto)
 }
 
+// GET /api/dashboards/uid/:uid/at/:ref
+func GetDashboardAtCommit(c *m.ReqContext) Response {
+	preview, err := dashboards.NewService().RenderDashboardAtCommit(c.OrgId, c.Params(":uid"), c.Params(":ref"), c.SignedInUser)
+	switch {
+	case err == m.ErrDashboardNotFound:
+		return Error(404, "Dashboard not found", err)
+	case err == m.ErrDashboardViewAccessDenied:
+		return dashboardGuardianResponse(nil)
+	case err == social.ErrGitRefNotFound || err == social.ErrGitFileNotFound:
+		return Error(404, err.Error(), nil)
+	case err == dashboards.ErrGitRefInvalid ||
+		err == dashboards.ErrGitPreviewNotSupported ||
+		err == dashboards.ErrDashboardNotSynced ||
+		err == dashboards.ErrDashboardPreviewSource ||
+		err == dashboards.ErrDashboardPreviewInvalidJson:
+		return Error(400, err.Error(), nil)
+	case err == dashboards.ErrDashboardPreviewTooLarge:
+		return Error(413, err.Error(), nil)
+	case err != nil:
+		return Error(500, "Failed to read the dashboard from the repository", err)
+	}
+
+	// the preview is only read, clients show it like a snapshot
+	dash := preview.Dashboard
+	meta := dtos.DashboardMeta{
+		IsSnapshot: true,
+		Slug:       dash.Slug,
+		Type:       m.DashTypeDB,
+		Url:        dash.GetUrl(),
+		Created:    dash.Created,
+		Updated:    dash.Updated,
+		Version:    dash.Version,
+		FolderId:   dash.FolderId,
+		GitRef:     preview.Ref,
+	}
+
+	return JSON(200, dtos.DashboardFullWithMeta{Dashboard: preview.Data, Meta: meta})
+}
+
 func getUserLogin(userID int64) string {
 	query := m.GetUserByIdQuery{Id: userID}
 	err := bus.Dispatch(&query)
@@ -182,19 +241,42 @@ func DeleteDashboardByUID(c *m.ReqContext) Response {
 	return deleteDashboard(c)
 }
 
-func getDashboardFolder(dashboard *m.Dashboard) string {
+// PrepareDeleteDashboardByUID returns the token confirming the delete of the dashboard, e.g. when deletes
+// require a confirmation, and what the delete removes
+func PrepareDeleteDashboardByUID(c *m.ReqContext) Response {
+	dash, rsp := getDashboardHelper(c.OrgId, "", 0, c.Params(":uid"))
+	if rsp != nil {
+		return rsp
+	}
+
+	confirmation, err := dashboards.NewService().PrepareDeleteDashboard(dash.Id, c.OrgId, c.SignedInUser)
+	if err == m.ErrDashboardCannotDeleteProvisionedDashboard {
+		return Error(400, "Dashboard cannot be deleted because it was provisioned", err)
+	} else if err == m.ErrDashboardUpdateAccessDenied || err == m.ErrDashboardProtected {
+		return Error(403, err.Error(), err)
+	} else if err != nil {
+		return Error(500, "Failed to prepare the delete of the dashboard", err)
+	}
+
+	return JSON(200, confirmation)
+}
+
+func getDashboardFolder(dashboard *m.Dashboard) (string, error) {
 	if dashboard.FolderId == 0 {
-		return "General"
+		return "General", nil
 	}
 
 	folderQuery := m.GetDashboardQuery{Id: dashboard.FolderId}
 	err := bus.Dispatch(&folderQuery)
 	if err != nil {
-		return "unknown"
+		if err == m.ErrDashboardNotFound {
+			return "", m.DashboardFolderNotFoundError{FolderId: dashboard.FolderId}
+		}
+		return "", err
 	}
 	folderName := folderQuery.Result.Title
 
-	return folderName
+	return folderName, nil
 }
 
 func deleteDashboard(c *m.ReqContext) Response {
@@ -208,9 +290,40 @@ func deleteDashboard(c *m.ReqContext) Response {
 		return dashboardGuardianResponse(err)
 	}
 
-	err := dashboards.NewService().DeleteDashboard(dash.Id, c.OrgId)
-	if err == m.ErrDashboardCannotDeleteProvisionedDashboard {
+	// the folder is looked up before the delete, the path of the synced file is built from it
+	folder, err := getDashboardFolder(dash)
+	if err != nil {
+		if folderErr, ok := err.(m.DashboardFolderNotFoundError); ok {
+			return JSON(400, util.DynMap{"status": "folder-not-found", "message": folderErr.Error(), "folderId": folderErr.FolderId})
+		}
+		return Error(500, "Failed to get the folder of the dashboard", err)
+	}
+
+	var result *dashboards.DeleteDashboardResult
+	if token := c.Query("confirmToken"); token != "" {
+		result, err = dashboards.NewService().DeleteDashboardWithToken(dash.Id, c.OrgId, token, c.SignedInUser)
+	} else if setting.DashboardDeleteConfirmation {
+		return JSON(428, util.DynMap{"status": "confirmation-required", "message": m.ErrDashboardDeleteConfirmationRequired.Error()})
+	} else if version := c.Query("version"); version != "" {
+		expectedVersion, parseErr := strconv.ParseInt(version, 10, 64)
+		if parseErr != nil {
+			return Error(400, "Invalid version", parseErr)
+		}
+		result, err = dashboards.NewService().DeleteDashboardIfVersion(dash.Id, c.OrgId, expectedVersion, c.SignedInUser)
+	} else {
+		result, err = dashboards.NewService().DeleteDashboard(dash.Id, c.OrgId)
+	}
+
+	if readOnlyErr, ok := err.(m.DashboardsReadOnlyError); ok {
+		return dashboardsReadOnlyErrorToApiResponse(readOnlyErr)
+	} else if err == m.ErrDashboardCannotDeleteProvisionedDashboard {
 		return Error(400, "Dashboard cannot be deleted because it was provisioned", err)
+	} else if err == m.ErrDashboardDeleteTokenInvalid || err == m.ErrDashboardDeleteTokenExpired {
+		return Error(400, err.Error(), nil)
+	} else if err == m.ErrDashboardVersionMismatch {
+		return JSON(412, util.DynMap{"status": "version-mismatch", "message": err.Error()})
+	} else if err == m.ErrDashboardUpdateAccessDenied || err == m.ErrDashboardProtected {
+		return Error(403, err.Error(), err)
 	} else if err != nil {
 		return Error(500, "Failed to delete dashboard", err)
 	}
@@ -225,7 +338,11 @@ func deleteDashboard(c *m.ReqContext) Response {
 		Action:    social.DeleteDashboard,
 		Title:     dash.Title,
 		Name:      dash.Slug,
-		Folder:    getDashboardFolder(dash),
+		Uid:       dash.Uid,
+		Folder:    folder,
+		UserId:    c.UserId,
+		UserLogin: c.Login,
+		Repo:      dash.GitRepo(),
 	}
 
 	err = connect.UpdateDashboard(&updateOptions, c.Token)
@@ -234,11 +351,93 @@ func deleteDashboard(c *m.ReqContext) Response {
 	}
 
 	return JSON(200, util.DynMap{
-		"title":   dash.Title,
-		"message": fmt.Sprintf("Dashboard %s deleted", dash.Title),
+		"title":         dash.Title,
+		"message":       fmt.Sprintf("Dashboard %s deleted", dash.Title),
+		"prunedFolders": result.PrunedFolders,
 	})
 }
 
+// getDashboardSource tells apart saves made from the UI, which carry a session token,
+// from saves made with API keys or basic auth.
+func getDashboardSource(c *m.ReqContext, cmd m.SaveDashboardCommand) m.DashboardSource {
+	if cmd.RestoredFrom > 0 {
+		return m.DashboardSourceRestore
+	}
+
+	if c.UserToken == nil || c.ApiKeyId > 0 {
+		return m.DashboardSourceAPI
+	}
+
+	return m.DashboardSourceUI
+}
+
+// getRequestMeta describes the request for the audit of dashboard saves. Like for auth tokens, the client ip
+// is read from the X-Real-IP or X-Forwarded-For headers of the proxy when set.
+func getRequestMeta(c *m.ReqContext) *m.RequestMeta {
+	clientIp, err := util.ParseIPAddress(c.RemoteAddr())
+	if err != nil {
+		clientIp = ""
+	}
+
+	return &m.RequestMeta{
+		ClientIp:  clientIp,
+		UserAgent: c.Req.UserAgent(),
+		RequestId: c.Req.Header.Get("X-Request-Id"),
+	}
+}
+
+// dashboardSaveRuleErrorToApiResponse returns the response to a save rejected by a rule, naming the rule so
+// clients can tell a missing permission on the target folder from one on the dashboard
+func dashboardSaveRuleErrorToApiResponse(ruleErr m.DashboardSaveRuleError) Response {
+	status := 500
+	switch err := ruleErr.Err; {
+	case err == m.ErrDashboardUpdateAccessDenied:
+		status = 403
+	case err == m.ErrDashboardCannotSaveProvisionedDashboard:
+		status = 400
+	case err == alerting.ErrAlertExtractionTimeout:
+		status = 503
+	case xerrors.Is(err, m.ErrDataSourceAccessDenied):
+		status = 403
+	default:
+		if _, ok := err.(alerting.ValidationError); ok {
+			status = 422
+		}
+	}
+
+	if deniedErr, ok := ruleErr.Err.(m.AlertNotificationsDeniedError); ok {
+		return JSON(403, util.DynMap{"status": "rule-rejected", "message": ruleErr.Error(), "rule": ruleErr.Rule, "violations": deniedErr.Violations})
+	}
+
+	if status == 500 {
+		return Error(500, "Failed to save dashboard", ruleErr.Err)
+	}
+
+	return JSON(status, util.DynMap{"status": "rule-rejected", "message": ruleErr.Error(), "rule": ruleErr.Rule})
+}
+
+// dashboardSaveRateLimitErrorToApiResponse tells the client when it may save again, in seconds
+func dashboardSaveRateLimitErrorToApiResponse(limitErr m.DashboardSaveRateLimitError) Response {
+	retryAfter := strconv.FormatInt(int64(limitErr.RetryAfter.Seconds()), 10)
+	return JSON(429, util.DynMap{"status": "too-many-saves", "message": limitErr.Error(), "limit": limitErr.Limit}).Header("Retry-After", retryAfter)
+}
+
+// dashboardsReadOnlyErrorToApiResponse tells the client dashboards are read-only for maintenance, with the message of
+// the operator and, when known, the estimated end of the maintenance and the seconds until then
+func dashboardsReadOnlyErrorToApiResponse(readOnlyErr m.DashboardsReadOnlyError) Response {
+	body := util.DynMap{"status": "read-only", "message": readOnlyErr.Error(), "maintenanceMessage": readOnlyErr.Message}
+	if readOnlyErr.Until.IsZero() {
+		return JSON(503, body)
+	}
+
+	body["until"] = readOnlyErr.Until
+	rsp := JSON(503, body)
+	if remaining := time.Until(readOnlyErr.Until); remaining > 0 {
+		rsp.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(remaining.Seconds())), 10))
+	}
+	return rsp
+}
+
 func (hs *HTTPServer) PostDashboard(c *m.ReqContext, cmd m.SaveDashboardCommand) Response {
 	cmd.OrgId = c.OrgId
 	cmd.UserId = c.UserId
@@ -257,22 +456,48 @@ func (hs *HTTPServer) PostDashboard(c *m.ReqContext, cmd m.SaveDashboardCommand)
 	}
 
 	dashItem := &dashboards.SaveDashboardDTO{
-		Dashboard: dash,
-		Message:   cmd.Message,
-		OrgId:     c.OrgId,
-		User:      c.SignedInUser,
-		Overwrite: cmd.Overwrite,
+		Dashboard:   dash,
+		Message:     cmd.Message,
+		OrgId:       c.OrgId,
+		User:        c.SignedInUser,
+		Overwrite:   cmd.Overwrite,
+		Source:      getDashboardSource(c, cmd),
+		GitOverride: cmd.GitOverride,
+		Coauthors:   cmd.Coauthors,
+		RequestMeta: getRequestMeta(c),
+
+		AllowUidChange: cmd.AllowUidChange,
 	}
+	dashItem.ApplyFolderTemplate = dashItem.Source == m.DashboardSourceUI && !cmd.SkipFolderTemplate
 
-	dashboard, err := dashboards.NewService().SaveDashboard(dashItem)
+	result, err := dashboards.NewService().SaveDashboardWithWarnings(dashItem)
+
+	if ruleErr, ok := err.(m.DashboardSaveRuleError); ok {
+		return dashboardSaveRuleErrorToApiResponse(ruleErr)
+	}
+
+	if limitErr, ok := err.(m.DashboardSaveRateLimitError); ok {
+		return dashboardSaveRateLimitErrorToApiResponse(limitErr)
+	}
+
+	if readOnlyErr, ok := err.(m.DashboardsReadOnlyError); ok {
+		return dashboardsReadOnlyErrorToApiResponse(readOnlyErr)
+	}
 
 	if err == m.ErrDashboardTitleEmpty ||
+		err == m.ErrDashboardTitleWhitespace ||
 		err == m.ErrDashboardWithSameNameAsFolder ||
 		err == m.ErrDashboardFolderWithSameNameAsDashboard ||
 		err == m.ErrDashboardTypeMismatch ||
 		err == m.ErrDashboardInvalidUid ||
 		err == m.ErrDashboardUidToLong ||
+		err == m.ErrDashboardUidReserved ||
+		err == m.ErrDashboardGitRepoNotFound ||
+		err == m.ErrDashboardGitBranchNotAllowed ||
 		err == m.ErrDashboardWithSameUIDExists ||
+		err == m.ErrDashboardUidUsedByFolder ||
+		err == m.ErrFolderUidUsedByDashboard ||
+		err == m.ErrDashboardUidChanged ||
 		err == m.ErrFolderNotFound ||
 		err == m.ErrDashboardFolderCannotHaveParent ||
 		err == m.ErrDashboardFolderNameExists ||
@@ -280,7 +505,7 @@ func (hs *HTTPServer) PostDashboard(c *m.ReqContext, cmd m.SaveDashboardCommand)
 		return Error(400, err.Error(), nil)
 	}
 
-	if err == m.ErrDashboardUpdateAccessDenied {
+	if err == m.ErrDashboardUpdateAccessDenied || err == m.ErrDashboardGitOverrideAccessDenied || err == m.ErrDashboardProtected {
 		return Error(403, err.Error(), err)
 	}
 
@@ -288,10 +513,59 @@ func (hs *HTTPServer) PostDashboard(c *m.ReqContext, cmd m.SaveDashboardCommand)
 		return Error(422, validationErr.Error(), nil)
 	}
 
+	if folderErr, ok := err.(m.DashboardFolderNotFoundError); ok {
+		return JSON(400, util.DynMap{"status": "folder-not-found", "message": folderErr.Error(), "folderId": folderErr.FolderId})
+	}
+
+	if timeErr, ok := err.(m.DashboardTimeSettingsError); ok {
+		return Error(400, timeErr.Error(), nil)
+	}
+
+	if depthErr, ok := err.(m.DashboardNestingDepthError); ok {
+		return Error(400, depthErr.Error(), nil)
+	}
+
+	if limitsErr, ok := err.(m.DashboardLimitsError); ok {
+		return JSON(400, util.DynMap{"status": "limits-exceeded", "message": limitsErr.Error(), "violations": limitsErr.Violations})
+	}
+
+	if largeValueErr, ok := err.(m.DashboardLargeValueError); ok {
+		return Error(400, largeValueErr.Error(), nil)
+	}
+
+	if templatingErr, ok := err.(m.DashboardInvalidTemplatingError); ok {
+		return JSON(400, util.DynMap{"status": "invalid-templating", "message": templatingErr.Error(), "issues": templatingErr.Issues})
+	}
+
+	if validationErr, ok := err.(m.DashboardValidationError); ok {
+		return JSON(400, util.DynMap{"status": "validation-failed", "message": validationErr.Error(), "validator": validationErr.Validator})
+	}
+
+	if transformErr, ok := err.(m.DashboardTransformError); ok {
+		return JSON(400, util.DynMap{"status": "transform-failed", "message": transformErr.Error(), "transformer": transformErr.Transformer})
+	}
+
+	if err == alerting.ErrAlertExtractionTimeout {
+		return Error(503, err.Error(), err)
+	}
+
 	if err != nil {
 		if err == m.ErrDashboardWithSameNameInFolderExists {
 			return JSON(412, util.DynMap{"status": "name-exists", "message": err.Error()})
 		}
+		if conflictErr, ok := err.(m.DashboardVersionConflictError); ok {
+			return JSON(412, util.DynMap{
+				"status":  "version-mismatch",
+				"message": conflictErr.Error(),
+				"current": util.DynMap{
+					"version":   conflictErr.CurrentVersion,
+					"updatedBy": getUserLogin(conflictErr.UpdatedBy),
+					"updated":   conflictErr.UpdatedAt,
+				},
+				"changes":          conflictErr.Changes,
+				"changesTruncated": conflictErr.ChangesTruncated,
+			})
+		}
 		if err == m.ErrDashboardVersionMismatch {
 			return JSON(412, util.DynMap{"status": "version-mismatch", "message": err.Error()})
 		}
@@ -309,10 +583,15 @@ func (hs *HTTPServer) PostDashboard(c *m.ReqContext, cmd m.SaveDashboardCommand)
 		if err == m.ErrDashboardGitlabSync || err == m.ErrDashboardGitlabToken {
 			return Error(500, err.Error(), err)
 		}
+		if err == m.ErrDashboardGitConflict {
+			return JSON(409, util.DynMap{"status": "git-conflict", "message": err.Error()})
+		}
 
 		return Error(500, "Failed to save dashboard", err)
 	}
 
+	dashboard := result.Dashboard
+
 	if hs.Cfg.EditorsCanAdmin && newDashboard {
 		inFolder := cmd.FolderId > 0
 		err := dashboards.MakeUserAdmin(hs.Bus, cmd.OrgId, cmd.UserId, dashboard.Id, !inFolder)
@@ -323,12 +602,15 @@ func (hs *HTTPServer) PostDashboard(c *m.ReqContext, cmd m.SaveDashboardCommand)
 
 	c.TimeRequest(metrics.MApiDashboardSave)
 	return JSON(200, util.DynMap{
-		"status":  "success",
-		"slug":    dashboard.Slug,
-		"version": dashboard.Version,
-		"id":      dashboard.Id,
-		"uid":     dashboard.Uid,
-		"url":     dashboard.GetUrl(),
+		"status":        "success",
+		"slug":          dashboard.Slug,
+		"version":       dashboard.Version,
+		"id":            dashboard.Id,
+		"uid":           dashboard.Uid,
+		"url":           dashboard.GetUrl(),
+		"warnings":      result.Warnings,
+		"prunedFolders": result.PrunedFolders,
+		"transformers":  result.Transformers,
 	})
 }
 
@@ -556,3 +838,20 @@ func GetDashboardTags(c *m.ReqContext) {
 
 	c.JSON(200, query.Result)
 }
+
+// POST /api/orgs/:orgId/dashboards/repair-orphans
+func RepairOrphanedDashboards(c *m.ReqContext, form dtos.RepairOrphanedDashboardsForm) Response {
+	orgId := c.ParamsInt64(":orgId")
+
+	// the repair runs in the organization of the route, as an admin of it
+	user := *c.SignedInUser
+	user.OrgId = orgId
+	user.OrgRole = m.ROLE_ADMIN
+
+	report, err := dashboards.NewService().RepairOrphanedDashboards(orgId, &user, dashboards.OrphanRepairOptions{DryRun: form.DryRun})
+	if err != nil {
+		return Error(500, "Failed to repair orphaned dashboards", err)
+	}
+
+	return JSON(200, report)
+}
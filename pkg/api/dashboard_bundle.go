@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+)
+
+// GET /api/orgs/:orgId/dashboards/bundle?sign=true
+func (hs *HTTPServer) ExportOrgDashboardBundle(c *m.ReqContext) Response {
+	orgId := c.ParamsInt64(":orgId")
+	opts := dashboards.ExportBundleOptions{
+		Sign:            c.QueryBool("sign"),
+		ProvisionerPath: hs.ProvisioningService.GetDashboardProvisionerResolvedPath,
+	}
+
+	var bundle bytes.Buffer
+	if err := dashboards.NewService().ExportOrgDashboards(orgId, opts, &bundle); err != nil {
+		if err == dashboards.ErrBundleSigningKeyMissing {
+			return Error(400, err.Error(), nil)
+		}
+		return Error(500, "Failed to export dashboards", err)
+	}
+
+	return Respond(200, bundle.Bytes()).
+		Header("Content-Type", "application/gzip").
+		Header("Content-Disposition", fmt.Sprintf(`attachment; filename="dashboards-org-%d.tar.gz"`, orgId))
+}
+
+// POST /api/orgs/:orgId/dashboards/bundle?onConflict=skip|overwrite|rename&allowUnsigned=true
+func (hs *HTTPServer) ImportOrgDashboardBundle(c *m.ReqContext) Response {
+	orgId := c.ParamsInt64(":orgId")
+
+	// the import runs in the organization of the route, as an admin of it
+	user := *c.SignedInUser
+	user.OrgId = orgId
+	user.OrgRole = m.ROLE_ADMIN
+
+	opts := dashboards.ImportBundleOptions{
+		OnConflict:      dashboards.BundleConflictMode(c.Query("onConflict")),
+		AllowUnsigned:   c.QueryBool("allowUnsigned"),
+		ProvisionerPath: hs.ProvisioningService.GetDashboardProvisionerResolvedPath,
+	}
+
+	report, err := dashboards.NewService().ImportOrgDashboards(orgId, &user, c.Req.Request.Body, opts)
+	if err != nil {
+		if _, ok := err.(dashboards.BundleInvalidError); ok {
+			return Error(400, err.Error(), nil)
+		}
+		switch err {
+		case dashboards.ErrBundleSigningKeyMissing, dashboards.ErrBundleUnsigned,
+			dashboards.ErrBundleSignatureInvalid, dashboards.ErrBundleConflictMode:
+			return Error(400, err.Error(), nil)
+		}
+		return Error(500, "Failed to import dashboards", err)
+	}
+
+	return JSON(200, report)
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+)
+
+// GET /api/dashboard-jobs/:id
+func GetDashboardJob(c *m.ReqContext) Response {
+	job, err := dashboards.NewService().GetJob(c.ParamsInt64(":id"))
+	if err != nil {
+		if err == m.ErrDashboardJobNotFound {
+			return Error(404, err.Error(), nil)
+		}
+		return Error(500, "Failed to get dashboard job", err)
+	}
+
+	return JSON(200, job)
+}
+
+// POST /api/dashboard-jobs/:id/cancel
+func CancelDashboardJob(c *m.ReqContext) Response {
+	job, err := dashboards.NewService().CancelJob(c.ParamsInt64(":id"))
+	if err != nil {
+		switch err {
+		case m.ErrDashboardJobNotFound:
+			return Error(404, err.Error(), nil)
+		case dashboards.ErrJobFinished:
+			return Error(409, err.Error(), nil)
+		}
+		return Error(500, "Failed to cancel dashboard job", err)
+	}
+
+	return JSON(200, job)
+}
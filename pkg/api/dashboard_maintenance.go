@@ -0,0 +1,37 @@
+package api
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/api/dtos"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+)
+
+// GET /api/admin/dashboards/maintenance
+func GetDashboardMaintenance(c *m.ReqContext) Response {
+	status, err := dashboards.NewService().GetMaintenance()
+	if err != nil {
+		return Error(500, "Failed to get the maintenance of dashboards", err)
+	}
+
+	return JSON(200, status)
+}
+
+// PUT /api/admin/dashboards/maintenance
+func SetDashboardMaintenance(c *m.ReqContext, form dtos.SetDashboardMaintenanceForm) Response {
+	opts := dashboards.MaintenanceOptions{ReadOnly: form.ReadOnly, Message: form.Message}
+	if form.ReadOnly && form.Until != nil {
+		if !form.Until.After(time.Now()) {
+			return Error(400, "The end of the maintenance must be in the future", nil)
+		}
+		opts.Until = *form.Until
+	}
+
+	status, err := dashboards.NewService().SetMaintenance(opts, c.SignedInUser)
+	if err != nil {
+		return Error(500, "Failed to set the maintenance of dashboards", err)
+	}
+
+	return JSON(200, status)
+}
@@ -185,6 +185,11 @@ func callUpdateDashboardPermissions(sc *scenarioContext) {
 		return nil
 	})
 
+	bus.AddHandler("test", func(query *m.GetDashboardAclInfoListQuery) error {
+		query.Result = []*m.DashboardAclInfoDTO{}
+		return nil
+	})
+
 	sc.fakeReqWithParams("POST", sc.url, map[string]string{}).exec()
 }
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/api/dtos"
 	"github.com/grafana/grafana/pkg/bus"
@@ -691,6 +692,9 @@ func TestDashboardApiEndpoint(t *testing.T) {
 					Slug:    "dash",
 					Version: 2,
 				},
+				SaveDashboardWarnings: []dashboards.Warning{
+					{Code: dashboards.WarningTimeSettings, Message: "refresh interval 1s is below the minimum of 10s"},
+				},
 			}
 
 			postDashboardScenario("When calling POST on", "/api/dashboards", "/api/dashboards", mock, cmd, func(sc *scenarioContext) {
@@ -704,6 +708,7 @@ func TestDashboardApiEndpoint(t *testing.T) {
 					So(dto.Dashboard.Title, ShouldEqual, "Dash")
 					So(dto.Overwrite, ShouldBeTrue)
 					So(dto.Message, ShouldEqual, "msg")
+					So(dto.Source, ShouldEqual, m.DashboardSourceAPI)
 				})
 
 				Convey("It should return correct response data", func() {
@@ -714,6 +719,41 @@ func TestDashboardApiEndpoint(t *testing.T) {
 					So(result.Get("slug").MustString(), ShouldEqual, "dash")
 					So(result.Get("url").MustString(), ShouldEqual, "/d/uid/dash")
 				})
+
+				Convey("It should describe the request for the audit of the save", func() {
+					So(mock.SavedDashboards[0].RequestMeta, ShouldNotBeNil)
+				})
+
+				Convey("It should return the warnings of the save", func() {
+					warning := sc.ToJSON().Get("warnings").GetIndex(0)
+					So(warning.Get("code").MustString(), ShouldEqual, "time-settings")
+					So(warning.Get("message").MustString(), ShouldEqual, "refresh interval 1s is below the minimum of 10s")
+				})
+			})
+		})
+
+		Convey("Given a request for saving a dashboard through a proxy", func() {
+			cmd := m.SaveDashboardCommand{
+				OrgId:     1,
+				UserId:    5,
+				Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Dash"}),
+			}
+
+			mock := &dashboards.FakeDashboardService{}
+
+			postDashboardScenario("When calling POST on", "/api/dashboards", "/api/dashboards", mock, cmd, func(sc *scenarioContext) {
+				sc.fakeReqWithParams("POST", sc.url, map[string]string{})
+				sc.req.Header.Set("X-Forwarded-For", "192.168.1.10")
+				sc.req.Header.Set("User-Agent", "curl/7.64.1")
+				sc.req.Header.Set("X-Request-Id", "f3a9c2")
+				sc.exec()
+
+				So(sc.resp.Code, ShouldEqual, 200)
+				So(mock.SavedDashboards[0].RequestMeta, ShouldResemble, &m.RequestMeta{
+					ClientIp:  "192.168.1.10",
+					UserAgent: "curl/7.64.1",
+					RequestId: "f3a9c2",
+				})
 			})
 		})
 
@@ -727,9 +767,12 @@ func TestDashboardApiEndpoint(t *testing.T) {
 				{SaveError: m.ErrDashboardNotFound, ExpectedStatusCode: 404},
 				{SaveError: m.ErrFolderNotFound, ExpectedStatusCode: 400},
 				{SaveError: m.ErrDashboardWithSameUIDExists, ExpectedStatusCode: 400},
+				{SaveError: m.ErrDashboardUidChanged, ExpectedStatusCode: 400},
+				{SaveError: m.ErrDashboardUidUsedByFolder, ExpectedStatusCode: 400},
 				{SaveError: m.ErrDashboardWithSameNameInFolderExists, ExpectedStatusCode: 412},
 				{SaveError: m.ErrDashboardVersionMismatch, ExpectedStatusCode: 412},
 				{SaveError: m.ErrDashboardTitleEmpty, ExpectedStatusCode: 400},
+				{SaveError: m.ErrDashboardTitleWhitespace, ExpectedStatusCode: 400},
 				{SaveError: m.ErrDashboardFolderCannotHaveParent, ExpectedStatusCode: 400},
 				{SaveError: alerting.ValidationError{Reason: "Mu"}, ExpectedStatusCode: 422},
 				{SaveError: m.ErrDashboardFailedGenerateUniqueUid, ExpectedStatusCode: 500},
@@ -738,10 +781,13 @@ func TestDashboardApiEndpoint(t *testing.T) {
 				{SaveError: m.ErrDashboardWithSameNameAsFolder, ExpectedStatusCode: 400},
 				{SaveError: m.ErrDashboardFolderNameExists, ExpectedStatusCode: 400},
 				{SaveError: m.ErrDashboardUpdateAccessDenied, ExpectedStatusCode: 403},
+				{SaveError: m.ErrDashboardProtected, ExpectedStatusCode: 403},
+				{SaveError: m.ErrDashboardGitConflict, ExpectedStatusCode: 409},
 				{SaveError: m.ErrDashboardInvalidUid, ExpectedStatusCode: 400},
 				{SaveError: m.ErrDashboardUidToLong, ExpectedStatusCode: 400},
 				{SaveError: m.ErrDashboardCannotSaveProvisionedDashboard, ExpectedStatusCode: 400},
 				{SaveError: m.UpdatePluginDashboardError{PluginId: "plug"}, ExpectedStatusCode: 412},
+				{SaveError: m.DashboardValidationError{Validator: "naming", Message: "bad name"}, ExpectedStatusCode: 400},
 			}
 
 			cmd := m.SaveDashboardCommand{
@@ -762,6 +808,94 @@ func TestDashboardApiEndpoint(t *testing.T) {
 				})
 			}
 		})
+
+		Convey("Given saves rejected by a rule", func() {
+			testCases := []struct {
+				SaveError          error
+				ExpectedStatusCode int
+			}{
+				{SaveError: m.DashboardSaveRuleError{Rule: m.DashboardSaveRuleFolderMovePermission, Err: m.ErrDashboardUpdateAccessDenied}, ExpectedStatusCode: 403},
+				{SaveError: m.DashboardSaveRuleError{Rule: m.DashboardSaveRuleSavePermission, Err: m.ErrDashboardUpdateAccessDenied}, ExpectedStatusCode: 403},
+				{SaveError: m.DashboardSaveRuleError{Rule: m.DashboardSaveRuleProvisionedConflict, Err: m.ErrDashboardCannotSaveProvisionedDashboard}, ExpectedStatusCode: 400},
+				{SaveError: m.DashboardSaveRuleError{Rule: m.DashboardSaveRuleAlertValidation, Err: alerting.ValidationError{Reason: "Mu"}}, ExpectedStatusCode: 422},
+				{SaveError: m.DashboardSaveRuleError{Rule: m.DashboardSaveRuleAlertValidation, Err: alerting.ErrAlertExtractionTimeout}, ExpectedStatusCode: 503},
+				{SaveError: m.DashboardSaveRuleError{Rule: m.DashboardSaveRuleAlertValidation, Err: alerting.DatasourceAccessDeniedError{AlertName: "Mu", PanelID: 1, Datasource: "Prometheus"}}, ExpectedStatusCode: 403},
+				{SaveError: m.DashboardSaveRuleError{Rule: m.DashboardSaveRuleFolderMoveNotifications, Err: m.AlertNotificationsDeniedError{
+					Folder:     "Team B",
+					Violations: []*m.AlertNotificationViolation{{AlertName: "High latency", PanelId: 1, NotificationUid: "team-a", NotificationName: "Team A pager"}},
+				}}, ExpectedStatusCode: 403},
+			}
+
+			cmd := m.SaveDashboardCommand{
+				OrgId: 1,
+				Dashboard: simplejson.NewFromAny(map[string]interface{}{
+					"title": "Dash",
+				}),
+			}
+
+			for _, tc := range testCases {
+				ruleErr := tc.SaveError.(m.DashboardSaveRuleError)
+				mock := &dashboards.FakeDashboardService{
+					SaveDashboardError: tc.SaveError,
+				}
+
+				postDashboardScenario(fmt.Sprintf("Expect rule %s for %q when calling POST on", ruleErr.Rule, ruleErr.Err.Error()), "/api/dashboards", "/api/dashboards", mock, cmd, func(sc *scenarioContext) {
+					CallPostDashboard(sc)
+					So(sc.resp.Code, ShouldEqual, tc.ExpectedStatusCode)
+
+					result := sc.ToJSON()
+					So(result.Get("status").MustString(), ShouldEqual, "rule-rejected")
+					So(result.Get("rule").MustString(), ShouldEqual, string(ruleErr.Rule))
+					So(result.Get("message").MustString(), ShouldEqual, ruleErr.Err.Error())
+
+					if deniedErr, ok := ruleErr.Err.(m.AlertNotificationsDeniedError); ok {
+						So(len(result.Get("violations").MustArray()), ShouldEqual, len(deniedErr.Violations))
+						So(result.Get("violations").GetIndex(0).Get("notificationUid").MustString(), ShouldEqual, "team-a")
+					}
+				})
+			}
+		})
+
+		Convey("Given a save conflicting with a concurrent save", func() {
+			cmd := m.SaveDashboardCommand{
+				OrgId: 1,
+				Dashboard: simplejson.NewFromAny(map[string]interface{}{
+					"id":      1,
+					"title":   "Dash",
+					"version": 3,
+				}),
+			}
+
+			mock := &dashboards.FakeDashboardService{
+				SaveDashboardError: m.DashboardVersionConflictError{
+					CurrentVersion: 4,
+					UpdatedBy:      2,
+					UpdatedAt:      time.Date(2019, 8, 20, 14, 0, 0, 0, time.UTC),
+					Changes:        []string{"panels changed", "title changed"},
+				},
+			}
+
+			postDashboardScenario("When calling POST on", "/api/dashboards", "/api/dashboards", mock, cmd, func(sc *scenarioContext) {
+				bus.AddHandler("test", func(query *m.GetUserByIdQuery) error {
+					query.Result = &m.User{Id: query.Id, Login: "other"}
+					return nil
+				})
+
+				CallPostDashboard(sc)
+
+				Convey("It should return the stored version and the changes", func() {
+					So(sc.resp.Code, ShouldEqual, 412)
+
+					result := sc.ToJSON()
+					So(result.Get("status").MustString(), ShouldEqual, "version-mismatch")
+					So(result.GetPath("current", "version").MustInt(), ShouldEqual, 4)
+					So(result.GetPath("current", "updatedBy").MustString(), ShouldEqual, "other")
+					So(result.GetPath("current", "updated").MustString(), ShouldEqual, "2019-08-20T14:00:00Z")
+					So(result.Get("changes").MustStringArray(), ShouldResemble, []string{"panels changed", "title changed"})
+					So(result.Get("changesTruncated").MustBool(), ShouldBeFalse)
+				})
+			})
+		})
 	})
 
 	Convey("Given two dashboards being compared", t, func() {
@@ -857,6 +991,7 @@ func TestDashboardApiEndpoint(t *testing.T) {
 			So(dto.Dashboard.FolderId, ShouldEqual, 1)
 			So(dto.Dashboard.Title, ShouldEqual, "Child dash")
 			So(dto.Message, ShouldEqual, "Restored from version 1")
+			So(dto.Source, ShouldEqual, m.DashboardSourceRestore)
 		})
 	})
 
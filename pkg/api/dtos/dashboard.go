@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/grafana/grafana/pkg/components/simplejson"
+	m "github.com/grafana/grafana/pkg/models"
 )
 
 type DashboardMeta struct {
@@ -30,6 +31,12 @@ type DashboardMeta struct {
 	FolderUrl             string    `json:"folderUrl"`
 	Provisioned           bool      `json:"provisioned"`
 	ProvisionedExternalId string    `json:"provisionedExternalId"`
+	Source                string    `json:"source,omitempty"`
+	IsExternallySynced    bool      `json:"isExternallySynced,omitempty"`
+
+	GitSync *m.DashboardGitSyncMeta `json:"gitSync,omitempty"`
+	// GitRef is the ref of the repository a read-only preview of the dashboard was read at
+	GitRef string `json:"gitRef,omitempty"`
 }
 
 type DashboardFullWithMeta struct {
@@ -56,3 +63,37 @@ type CalculateDiffTarget struct {
 type RestoreDashboardVersionCommand struct {
 	Version int `json:"version" binding:"Required"`
 }
+
+type MigrateRepoLayoutForm struct {
+	DryRun bool `json:"dryRun"`
+}
+
+type ImportGitOnlyDashboardsForm struct {
+	DryRun bool `json:"dryRun"`
+}
+
+type RepairOrphanedDashboardsForm struct {
+	DryRun bool `json:"dryRun"`
+}
+
+type SetGitSyncPausedForm struct {
+	Paused bool `json:"paused"`
+}
+
+// QueuedSyncCommitsForm selects queued dashboard commits by id, no ids selects all the failed ones
+type QueuedSyncCommitsForm struct {
+	Ids []int64 `json:"ids"`
+}
+
+// SetDashboardMaintenanceForm turns the read-only maintenance of dashboards on or off. Until is the estimated end
+// of the maintenance, optional.
+type SetDashboardMaintenanceForm struct {
+	ReadOnly bool       `json:"readOnly"`
+	Message  string     `json:"message"`
+	Until    *time.Time `json:"until"`
+}
+
+// PromoteRepoMirrorForm selects the mirror to promote by its name or id
+type PromoteRepoMirrorForm struct {
+	Mirror string `json:"mirror" binding:"Required"`
+}
@@ -23,3 +23,14 @@ type FolderSearchHit struct {
 	Uid   string `json:"uid"`
 	Title string `json:"title"`
 }
+
+// FolderTemplate is the template dashboard of a folder, with an empty uid when the folder has none
+type FolderTemplate struct {
+	DashboardUid string `json:"dashboardUid"`
+	Title        string `json:"title"`
+	Url          string `json:"url"`
+}
+
+type UpdateFolderTemplateForm struct {
+	DashboardUid string `json:"dashboardUid"`
+}
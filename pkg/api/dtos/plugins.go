@@ -59,4 +59,16 @@ type ImportDashboardCommand struct {
 	Dashboard *simplejson.Json               `json:"dashboard"`
 	Inputs    []plugins.ImportDashboardInput `json:"inputs"`
 	FolderId  int64                          `json:"folderId"`
+
+	TemplatizeMissingDatasources bool `json:"templatizeMissingDatasources"`
+}
+
+type ImportDashboardFromGitUrlCommand struct {
+	Url       string                         `json:"url" binding:"Required"`
+	Token     string                         `json:"token"`
+	Overwrite bool                           `json:"overwrite"`
+	Inputs    []plugins.ImportDashboardInput `json:"inputs"`
+	FolderId  int64                          `json:"folderId"`
+
+	TemplatizeMissingDatasources bool `json:"templatizeMissingDatasources"`
 }
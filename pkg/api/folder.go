@@ -95,6 +95,36 @@ func DeleteFolder(c *m.ReqContext) Response {
 	})
 }
 
+func GetFolderTemplate(c *m.ReqContext) Response {
+	s := dashboards.NewFolderService(c.OrgId, c.SignedInUser)
+	template, err := s.GetFolderTemplate(c.Params(":uid"))
+	if err != nil {
+		return toFolderError(err)
+	}
+
+	if template == nil {
+		return JSON(200, dtos.FolderTemplate{})
+	}
+
+	return JSON(200, dtos.FolderTemplate{
+		DashboardUid: template.Uid,
+		Title:        template.Title,
+		Url:          template.GetUrl(),
+	})
+}
+
+func UpdateFolderTemplate(c *m.ReqContext, form dtos.UpdateFolderTemplateForm) Response {
+	s := dashboards.NewFolderService(c.OrgId, c.SignedInUser)
+	if err := s.SetFolderTemplate(c.Params(":uid"), form.DashboardUid); err != nil {
+		return toFolderError(err)
+	}
+
+	if form.DashboardUid == "" {
+		return Success("Folder template removed")
+	}
+	return Success("Folder template updated")
+}
+
 func toFolderDto(g guardian.DashboardGuardian, folder *m.Folder) dtos.Folder {
 	canEdit, _ := g.CanEdit()
 	canSave, _ := g.CanSave()
@@ -127,19 +157,35 @@ func toFolderDto(g guardian.DashboardGuardian, folder *m.Folder) dtos.Folder {
 }
 
 func toFolderError(err error) Response {
+	if readOnlyErr, ok := err.(m.DashboardsReadOnlyError); ok {
+		return dashboardsReadOnlyErrorToApiResponse(readOnlyErr)
+	}
+
 	if err == m.ErrFolderTitleEmpty ||
+		err == m.ErrFolderTitleWhitespace ||
 		err == m.ErrFolderSameNameExists ||
 		err == m.ErrFolderWithSameUIDExists ||
+		err == m.ErrFolderUidUsedByDashboard ||
 		err == m.ErrDashboardTypeMismatch ||
 		err == m.ErrDashboardInvalidUid ||
-		err == m.ErrDashboardUidToLong {
+		err == m.ErrDashboardUidToLong ||
+		err == m.ErrDashboardUidReserved ||
+		err == m.ErrFolderTemplateIsFolder {
 		return Error(400, err.Error(), nil)
 	}
 
-	if err == m.ErrFolderAccessDenied {
+	if err == m.ErrDashboardNotFound {
+		return Error(404, "Template dashboard not found", err)
+	}
+
+	if err == m.ErrFolderAccessDenied || err == m.ErrDashboardUpdateAccessDenied {
 		return Error(403, "Access denied", err)
 	}
 
+	if err == m.ErrDashboardProtected {
+		return Error(403, err.Error(), err)
+	}
+
 	if err == m.ErrFolderNotFound {
 		return JSON(404, util.DynMap{"status": "not-found", "message": m.ErrFolderNotFound.Error()})
 	}
@@ -217,6 +217,11 @@ func callUpdateFolderPermissions(sc *scenarioContext) {
 		return nil
 	})
 
+	bus.AddHandler("test", func(query *m.GetDashboardAclInfoListQuery) error {
+		query.Result = []*m.DashboardAclInfoDTO{}
+		return nil
+	})
+
 	sc.fakeReqWithParams("POST", sc.url, map[string]string{}).exec()
 }
 
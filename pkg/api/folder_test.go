@@ -46,11 +46,14 @@ func TestFoldersApiEndpoint(t *testing.T) {
 				ExpectedStatusCode int
 			}{
 				{Error: m.ErrFolderWithSameUIDExists, ExpectedStatusCode: 400},
+				{Error: m.ErrFolderUidUsedByDashboard, ExpectedStatusCode: 400},
 				{Error: m.ErrFolderTitleEmpty, ExpectedStatusCode: 400},
+				{Error: m.ErrFolderTitleWhitespace, ExpectedStatusCode: 400},
 				{Error: m.ErrFolderSameNameExists, ExpectedStatusCode: 400},
 				{Error: m.ErrDashboardInvalidUid, ExpectedStatusCode: 400},
 				{Error: m.ErrDashboardUidToLong, ExpectedStatusCode: 400},
 				{Error: m.ErrFolderAccessDenied, ExpectedStatusCode: 403},
+				{Error: m.ErrDashboardProtected, ExpectedStatusCode: 403},
 				{Error: m.ErrFolderNotFound, ExpectedStatusCode: 404},
 				{Error: m.ErrFolderVersionMismatch, ExpectedStatusCode: 412},
 				{Error: m.ErrFolderFailedGenerateUniqueUid, ExpectedStatusCode: 500},
@@ -104,11 +107,14 @@ func TestFoldersApiEndpoint(t *testing.T) {
 				ExpectedStatusCode int
 			}{
 				{Error: m.ErrFolderWithSameUIDExists, ExpectedStatusCode: 400},
+				{Error: m.ErrFolderUidUsedByDashboard, ExpectedStatusCode: 400},
 				{Error: m.ErrFolderTitleEmpty, ExpectedStatusCode: 400},
+				{Error: m.ErrFolderTitleWhitespace, ExpectedStatusCode: 400},
 				{Error: m.ErrFolderSameNameExists, ExpectedStatusCode: 400},
 				{Error: m.ErrDashboardInvalidUid, ExpectedStatusCode: 400},
 				{Error: m.ErrDashboardUidToLong, ExpectedStatusCode: 400},
 				{Error: m.ErrFolderAccessDenied, ExpectedStatusCode: 403},
+				{Error: m.ErrDashboardProtected, ExpectedStatusCode: 403},
 				{Error: m.ErrFolderNotFound, ExpectedStatusCode: 404},
 				{Error: m.ErrFolderVersionMismatch, ExpectedStatusCode: 412},
 				{Error: m.ErrFolderFailedGenerateUniqueUid, ExpectedStatusCode: 500},
@@ -211,6 +217,9 @@ type fakeFolderService struct {
 	DeleteFolderResult   *m.Folder
 	DeleteFolderError    error
 	DeletedFolderUids    []string
+	FolderTemplate       *m.Dashboard
+	SetTemplateError     error
+	TemplateUids         []string
 }
 
 func (s *fakeFolderService) GetFolders(limit int64) ([]*m.Folder, error) {
@@ -240,6 +249,15 @@ func (s *fakeFolderService) DeleteFolder(uid string) (*m.Folder, error) {
 	return s.DeleteFolderResult, s.DeleteFolderError
 }
 
+func (s *fakeFolderService) SetFolderTemplate(uid string, dashboardUid string) error {
+	s.TemplateUids = append(s.TemplateUids, dashboardUid)
+	return s.SetTemplateError
+}
+
+func (s *fakeFolderService) GetFolderTemplate(uid string) (*m.Dashboard, error) {
+	return s.FolderTemplate, nil
+}
+
 func mockFolderService(mock *fakeFolderService) {
 	dashboards.NewFolderService = func(orgId int64, user *m.SignedInUser) dashboards.FolderService {
 		return mock
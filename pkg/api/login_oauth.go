@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"golang.org/x/oauth2"
 
@@ -27,6 +28,7 @@ import (
 var (
 	oauthLogger          = log.New("oauth")
 	OauthStateCookieName = "oauth_state"
+	OauthOrgCookieName   = "oauth_org_id"
 )
 
 func GenStateString() (string, error) {
@@ -44,9 +46,9 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 		return
 	}
 
-	name := ctx.Params(":name")
-	connect, ok := social.SocialMap[name]
-	if !ok {
+	// users logging in with the former name of a provider are linked with its current name
+	name := social.ProviderName(ctx.Params(":name"))
+	if _, ok := social.SocialMap[name]; !ok {
 		ctx.Handle(404, fmt.Sprintf("No OAuth with name %s configured", name), nil)
 		return
 	}
@@ -61,6 +63,14 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 
 	code := ctx.Query("code")
 	if code == "" {
+		// organizations with their own OAuth app are logged in to with ?orgId=
+		orgId := ctx.QueryInt64("orgId")
+		connect, info, err := social.GetOrgConnector(name, orgId)
+		if err != nil {
+			ctx.Handle(500, "login.OAuthLogin(get org OAuth config)", err)
+			return
+		}
+
 		state, err := GenStateString()
 		if err != nil {
 			ctx.Logger.Error("Generating state string failed", "err", err)
@@ -68,47 +78,70 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 			return
 		}
 
-		hashedState := hashStatecode(state, setting.OAuthService.OAuthInfos[name].ClientSecret)
+		// providers with return_url_in_state return to the page the user logged in from even when the
+		// redirect_to cookie does not survive the round trip to the provider
+		returnUrl := ctx.Query("redirect_to")
+		if returnUrl == "" {
+			returnUrl, _ = url.QueryUnescape(ctx.GetCookie("redirect_to"))
+		}
+		state = connect.EncodeState(state, returnUrl)
+
+		hashedState := hashStatecode(state, info.ClientSecret)
 		hs.writeCookie(ctx.Resp, OauthStateCookieName, hashedState, 60, hs.Cfg.CookieSameSite)
-		if setting.OAuthService.OAuthInfos[name].HostedDomain == "" {
+		hs.writeCookie(ctx.Resp, OauthOrgCookieName, strconv.FormatInt(orgId, 10), 60, hs.Cfg.CookieSameSite)
+		if info.HostedDomain == "" {
 			ctx.Redirect(connect.AuthCodeURL(state, oauth2.AccessTypeOnline))
 		} else {
-			ctx.Redirect(connect.AuthCodeURL(state, oauth2.SetAuthURLParam("hd", setting.OAuthService.OAuthInfos[name].HostedDomain), oauth2.AccessTypeOnline))
+			ctx.Redirect(connect.AuthCodeURL(state, oauth2.SetAuthURLParam("hd", info.HostedDomain), oauth2.AccessTypeOnline))
 		}
 		return
 	}
 
 	cookieState := ctx.GetCookie(OauthStateCookieName)
+	orgId, _ := strconv.ParseInt(ctx.GetCookie(OauthOrgCookieName), 10, 64)
 
 	// delete cookie
 	ctx.Resp.Header().Del("Set-Cookie")
 	hs.deleteCookie(ctx.Resp, OauthStateCookieName, hs.Cfg.CookieSameSite)
+	hs.deleteCookie(ctx.Resp, OauthOrgCookieName, hs.Cfg.CookieSameSite)
 
 	if cookieState == "" {
 		ctx.Handle(500, "login.OAuthLogin(missing saved state)", nil)
 		return
 	}
 
-	queryState := hashStatecode(ctx.Query("state"), setting.OAuthService.OAuthInfos[name].ClientSecret)
+	connect, info, err := social.GetOrgConnector(name, orgId)
+	if err != nil {
+		ctx.Handle(500, "login.OAuthLogin(get org OAuth config)", err)
+		return
+	}
+
+	queryState := hashStatecode(ctx.Query("state"), info.ClientSecret)
 	oauthLogger.Info("state check", "queryState", queryState, "cookieState", cookieState)
 	if cookieState != queryState {
 		ctx.Handle(500, "login.OAuthLogin(state mismatch)", nil)
 		return
 	}
 
+	returnUrl, err := connect.DecodeState(ctx.Query("state"))
+	if err != nil {
+		ctx.Handle(500, "login.OAuthLogin(invalid state)", err)
+		return
+	}
+
 	// handle call back
 	tr := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: setting.OAuthService.OAuthInfos[name].TlsSkipVerify,
+			InsecureSkipVerify: info.TlsSkipVerify,
 		},
 	}
 	oauthClient := &http.Client{
 		Transport: tr,
 	}
 
-	if setting.OAuthService.OAuthInfos[name].TlsClientCert != "" || setting.OAuthService.OAuthInfos[name].TlsClientKey != "" {
-		cert, err := tls.LoadX509KeyPair(setting.OAuthService.OAuthInfos[name].TlsClientCert, setting.OAuthService.OAuthInfos[name].TlsClientKey)
+	if info.TlsClientCert != "" || info.TlsClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(info.TlsClientCert, info.TlsClientKey)
 		if err != nil {
 			ctx.Logger.Error("Failed to setup TlsClientCert", "oauth", name, "error", err)
 			ctx.Handle(500, "login.OAuthLogin(Failed to setup TlsClientCert)", nil)
@@ -118,8 +151,8 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 		tr.TLSClientConfig.Certificates = append(tr.TLSClientConfig.Certificates, cert)
 	}
 
-	if setting.OAuthService.OAuthInfos[name].TlsClientCa != "" {
-		caCert, err := ioutil.ReadFile(setting.OAuthService.OAuthInfos[name].TlsClientCa)
+	if info.TlsClientCa != "" {
+		caCert, err := ioutil.ReadFile(info.TlsClientCa)
 		if err != nil {
 			ctx.Logger.Error("Failed to setup TlsClientCa", "oauth", name, "error", err)
 			ctx.Handle(500, "login.OAuthLogin(Failed to setup TlsClientCa)", nil)
@@ -148,7 +181,12 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 	client := connect.Client(oauthCtx, token)
 
 	// get user info
-	userInfo, err := connect.UserInfo(client, token)
+	var userInfo *social.BasicUserInfo
+	if reader, ok := connect.(social.ContextUserInfoReader); ok {
+		userInfo, err = reader.UserInfoContext(ctx.Req.Context(), client, token)
+	} else {
+		userInfo, err = connect.UserInfo(client, token)
+	}
 	if err != nil {
 		if sErr, ok := err.(*social.Error); ok {
 			hs.redirectWithError(ctx, sErr)
@@ -172,6 +210,11 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 		return
 	}
 
+	// Team Sync maps the groups of the user to teams, fetch them if the provider skipped them at login
+	if setting.IsEnterprise {
+		userInfo.LoadGroups()
+	}
+
 	extUser := &m.ExternalUserInfo{
 		AuthModule: "oauth_" + name,
 		OAuthToken: token,
@@ -183,8 +226,12 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 		Groups:     userInfo.Groups,
 	}
 
-	if userInfo.Role != "" {
-		extUser.OrgRoles[1] = m.RoleType(userInfo.Role)
+	if role := social.ResolveOrgRole(userInfo, info); role != "" {
+		roleOrgId := int64(1)
+		if orgId > 0 {
+			roleOrgId = orgId
+		}
+		extUser.OrgRoles[roleOrgId] = m.RoleType(role)
 	}
 
 	// add/update user in grafana
@@ -216,6 +263,12 @@ func (hs *HTTPServer) OAuthLogin(ctx *m.ReqContext) {
 
 	metrics.MApiLoginOAuth.Inc()
 
+	if returnUrl != "" {
+		ctx.SetCookie("redirect_to", "", -1, setting.AppSubUrl+"/")
+		ctx.Redirect(returnUrl)
+		return
+	}
+
 	if redirectTo, _ := url.QueryUnescape(ctx.GetCookie("redirect_to")); len(redirectTo) > 0 {
 		ctx.SetCookie("redirect_to", "", -1, setting.AppSubUrl+"/")
 		ctx.Redirect(redirectTo)
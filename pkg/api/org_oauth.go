@@ -0,0 +1,63 @@
+package api
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+// GET /api/orgs/:orgId/oauth
+func GetOrgOAuthConfigs(c *m.ReqContext) Response {
+	query := m.GetOrgOAuthConfigsQuery{OrgId: c.ParamsInt64(":orgId")}
+	if err := bus.Dispatch(&query); err != nil {
+		return Error(500, "Failed to get OAuth configs", err)
+	}
+
+	result := make([]*m.OrgOAuthConfigDTO, 0, len(query.Result))
+	for _, config := range query.Result {
+		result = append(result, toOrgOAuthConfigDTO(config))
+	}
+
+	return JSON(200, result)
+}
+
+// PUT /api/orgs/:orgId/oauth/:provider
+func UpdateOrgOAuthConfig(c *m.ReqContext, cmd m.SaveOrgOAuthConfigCommand) Response {
+	cmd.OrgId = c.ParamsInt64(":orgId")
+	cmd.Provider = c.Params(":provider")
+
+	if _, ok := social.SocialMap[cmd.Provider]; !ok {
+		return Error(404, "OAuth provider not enabled", nil)
+	}
+
+	if err := bus.Dispatch(&cmd); err != nil {
+		return Error(500, "Failed to save OAuth config", err)
+	}
+
+	return JSON(200, toOrgOAuthConfigDTO(cmd.Result))
+}
+
+// DELETE /api/orgs/:orgId/oauth/:provider
+func DeleteOrgOAuthConfig(c *m.ReqContext) Response {
+	cmd := m.DeleteOrgOAuthConfigCommand{OrgId: c.ParamsInt64(":orgId"), Provider: c.Params(":provider")}
+	if err := bus.Dispatch(&cmd); err != nil {
+		if err == m.ErrOrgOAuthConfigNotFound {
+			return Error(404, "OAuth config not found", err)
+		}
+		return Error(500, "Failed to delete OAuth config", err)
+	}
+
+	return Success("OAuth config deleted")
+}
+
+func toOrgOAuthConfigDTO(config *m.OrgOAuthConfig) *m.OrgOAuthConfigDTO {
+	return &m.OrgOAuthConfigDTO{
+		OrgId:    config.OrgId,
+		Provider: config.Provider,
+		ClientId: config.ClientId,
+		AuthUrl:  config.AuthUrl,
+		TokenUrl: config.TokenUrl,
+		ApiUrl:   config.ApiUrl,
+		Updated:  config.Updated,
+	}
+}
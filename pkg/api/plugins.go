@@ -8,6 +8,7 @@ import (
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/plugins"
 	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
 )
 
 func (hs *HTTPServer) GetPluginList(c *m.ReqContext) Response {
@@ -189,11 +190,70 @@ func ImportDashboard(c *m.ReqContext, apiCmd dtos.ImportDashboardCommand) Respon
 		Overwrite: apiCmd.Overwrite,
 		FolderId:  apiCmd.FolderId,
 		Dashboard: apiCmd.Dashboard,
+
+		TemplatizeMissingDatasources: apiCmd.TemplatizeMissingDatasources,
 	}
 
 	if err := bus.Dispatch(&cmd); err != nil {
-		return Error(500, "Failed to import dashboard", err)
+		return importDashboardError(err)
 	}
 
 	return JSON(200, cmd.Result)
 }
+
+// POST /api/dashboards/import/git
+func ImportDashboardFromGitUrl(c *m.ReqContext, apiCmd dtos.ImportDashboardFromGitUrlCommand) Response {
+	opts := plugins.ImportFromGitURLOptions{
+		Token:     apiCmd.Token,
+		Inputs:    apiCmd.Inputs,
+		Overwrite: apiCmd.Overwrite,
+		FolderId:  apiCmd.FolderId,
+
+		TemplatizeMissingDatasources: apiCmd.TemplatizeMissingDatasources,
+	}
+
+	dash, err := plugins.ImportDashboardFromGitURL(apiCmd.Url, c.OrgId, c.SignedInUser, opts)
+	if err != nil {
+		switch err.(type) {
+		case plugins.GitUrlFetchError:
+			return Error(502, err.Error(), nil)
+		case plugins.GitUrlDashboardInvalidError:
+			return Error(400, err.Error(), nil)
+		}
+		switch err {
+		case plugins.ErrGitUrlImportDisabled, plugins.ErrGitUrlHostNotAllowed, plugins.ErrGitUrlHostForbidden:
+			return Error(403, err.Error(), nil)
+		case plugins.ErrGitUrlInvalid, plugins.ErrGitUrlDashboardTooBig:
+			return Error(400, err.Error(), nil)
+		}
+		return importDashboardError(err)
+	}
+
+	return JSON(200, util.DynMap{
+		"id":       dash.Id,
+		"uid":      dash.Uid,
+		"title":    dash.Title,
+		"url":      dash.GetUrl(),
+		"folderId": dash.FolderId,
+		"version":  dash.Version,
+	})
+}
+
+func importDashboardError(err error) Response {
+	if depthErr, ok := err.(m.DashboardNestingDepthError); ok {
+		return Error(400, depthErr.Error(), nil)
+	}
+	if limitErr, ok := err.(m.DashboardSaveRateLimitError); ok {
+		return dashboardSaveRateLimitErrorToApiResponse(limitErr)
+	}
+	if readOnlyErr, ok := err.(m.DashboardsReadOnlyError); ok {
+		return dashboardsReadOnlyErrorToApiResponse(readOnlyErr)
+	}
+	if inputsErr, ok := err.(plugins.DashboardInputsRequiredError); ok {
+		return JSON(400, util.DynMap{"status": "inputs-required", "message": inputsErr.Error(), "inputs": inputsErr.Inputs})
+	}
+	if err == m.ErrDashboardInvalidUid || err == m.ErrDashboardUidToLong || err == m.ErrDashboardUidReserved {
+		return Error(400, err.Error(), nil)
+	}
+	return Error(500, "Failed to import dashboard", err)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/login/social"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// POST /api/orgs/:orgId/git/migrate-layout
+func MigrateRepoLayout(c *m.ReqContext, form dtos.MigrateRepoLayoutForm) Response {
+	params := dashboards.RepoLayoutMigrationParams{DryRun: form.DryRun}
+	jobId, err := dashboards.NewService().StartJob(dashboards.JobKindRepoLayoutMigration, c.ParamsInt64(":orgId"), params, c.SignedInUser)
+	if err != nil {
+		if err == dashboards.ErrRepoLayoutNotSupported {
+			return Error(400, err.Error(), nil)
+		}
+		return Error(500, "Failed to start repository layout migration", err)
+	}
+
+	return JSON(202, util.DynMap{
+		"message": "Repository layout migration started",
+		"id":      jobId,
+		"url":     fmt.Sprintf("%s/api/dashboard-jobs/%d", setting.AppSubUrl, jobId),
+	})
+}
+
+// POST /api/orgs/:orgId/git/import
+func ImportGitOnlyDashboards(c *m.ReqContext, form dtos.ImportGitOnlyDashboardsForm) Response {
+	orgId := c.ParamsInt64(":orgId")
+
+	// the import runs in the organization of the route, as an admin of it
+	user := *c.SignedInUser
+	user.OrgId = orgId
+	user.OrgRole = m.ROLE_ADMIN
+
+	opts := dashboards.ImportGitOnlyOptions{DryRun: form.DryRun}
+	report, err := dashboards.NewService().ImportGitOnlyDashboards(orgId, &user, opts)
+	if err != nil {
+		if err == dashboards.ErrGitImportNotSupported {
+			return Error(400, err.Error(), nil)
+		}
+		return Error(500, "Failed to import dashboards from repository", err)
+	}
+
+	return JSON(200, report)
+}
+
+// GET /api/git-sync/lookup?path=&repoId=
+func LookupDashboardsByRepoPath(c *m.ReqContext) Response {
+	filePath := c.Query("path")
+	if filePath == "" {
+		return Error(400, "path is required", nil)
+	}
+
+	matches, err := dashboards.NewService().FindDashboardsByRepoPath(c.OrgId, c.QueryInt("repoId"), filePath)
+	if err != nil {
+		return Error(500, "Failed to look up dashboards by repository path", err)
+	}
+
+	visible := make([]*dashboards.RepoPathDashboard, 0, len(matches))
+	for _, match := range matches {
+		guard := guardian.New(match.Id, c.OrgId, c.SignedInUser)
+		if canView, err := guard.CanView(); err != nil || !canView {
+			continue
+		}
+		visible = append(visible, match)
+	}
+
+	return JSON(200, visible)
+}
+
+// GET /api/orgs/:orgId/git/sync-budget
+func GetGitSyncBudget(c *m.ReqContext) Response {
+	return JSON(200, dashboards.NewService().GetSyncBudget(c.ParamsInt64(":orgId")))
+}
+
+// GET /api/orgs/:orgId/git-sync/overview
+func GetGitSyncOverview(c *m.ReqContext) Response {
+	orgId := c.ParamsInt64(":orgId")
+	if orgId != c.OrgId && !c.IsGrafanaAdmin {
+		return Error(403, "Access denied to the git sync of the organization", nil)
+	}
+
+	overview, err := dashboards.NewService().GetSyncOverview(orgId)
+	if err != nil {
+		return Error(500, "Failed to get git sync overview", err)
+	}
+
+	return JSON(200, overview)
+}
+
+// POST /api/orgs/:orgId/git/promote-mirror
+func PromoteRepoMirror(c *m.ReqContext, form dtos.PromoteRepoMirrorForm) Response {
+	repo, err := dashboards.NewService().PromoteRepoMirror(c.ParamsInt64(":orgId"), form.Mirror)
+	if err != nil {
+		switch err {
+		case dashboards.ErrRepoMirrorNotSupported, social.ErrRepoNotMirror:
+			return Error(400, err.Error(), nil)
+		case m.ErrDashboardGitRepoNotFound:
+			return Error(404, err.Error(), nil)
+		}
+		return Error(500, "Failed to promote repository mirror", err)
+	}
+
+	return JSON(200, util.DynMap{
+		"message": "Repository mirror promoted",
+		"repo":    repo,
+	})
+}
+
+// GET /api/admin/git/sync
+func GetGitSyncStatus(c *m.ReqContext) Response {
+	return JSON(200, dashboards.NewService().GetSyncStatus())
+}
+
+// PUT /api/admin/git/sync
+func SetGitSyncPaused(c *m.ReqContext, form dtos.SetGitSyncPausedForm) Response {
+	status, err := dashboards.NewService().SetSyncPaused(form.Paused)
+	if err != nil {
+		return JSON(500, util.DynMap{"message": "Failed to make the queued dashboard commits: " + err.Error(), "status": status})
+	}
+
+	return JSON(200, status)
+}
+
+// GET /api/admin/git/sync/queue
+func GetQueuedGitSyncCommits(c *m.ReqContext) Response {
+	statuses := make([]m.DashboardSyncOutboxStatus, 0)
+	for _, status := range c.QueryStrings("status") {
+		statuses = append(statuses, m.DashboardSyncOutboxStatus(status))
+	}
+	if len(statuses) == 0 {
+		statuses = []m.DashboardSyncOutboxStatus{m.DashboardSyncOutboxPending, m.DashboardSyncOutboxInflight, m.DashboardSyncOutboxFailed}
+	}
+
+	commits, err := dashboards.NewService().GetQueuedSyncCommits(c.QueryInt64("orgId"), statuses)
+	if err != nil {
+		return Error(500, "Failed to get queued dashboard commits", err)
+	}
+
+	return JSON(200, commits)
+}
+
+// POST /api/admin/git/sync/queue/requeue
+func RequeueGitSyncCommits(c *m.ReqContext, form dtos.QueuedSyncCommitsForm) Response {
+	requeued, err := dashboards.NewService().RequeueSyncCommits(form.Ids)
+	if err != nil {
+		return Error(500, "Failed to requeue dashboard commits", err)
+	}
+
+	return JSON(200, util.DynMap{"message": "Dashboard commits requeued", "requeued": requeued})
+}
+
+// POST /api/admin/git/sync/queue/purge
+func PurgeGitSyncCommits(c *m.ReqContext, form dtos.QueuedSyncCommitsForm) Response {
+	purged, err := dashboards.NewService().PurgeSyncCommits(form.Ids)
+	if err != nil {
+		return Error(500, "Failed to purge dashboard commits", err)
+	}
+
+	return JSON(200, util.DynMap{"message": "Dashboard commits purged", "purged": purged})
+}
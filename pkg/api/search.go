@@ -54,6 +54,7 @@ func Search(c *m.ReqContext) Response {
 		Type:         dashboardType,
 		FolderIds:    folderIDs,
 		Permission:   permission,
+		Source:       c.Query("source"),
 	}
 
 	err := bus.Dispatch(&searchQuery)
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"time"
+
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// GET /api/dashboards/stale
+func GetStaleDashboards(c *m.ReqContext) Response {
+	olderThan := setting.DashboardStaleAfter
+	if value := c.Query("olderThan"); value != "" {
+		var err error
+		if olderThan, err = time.ParseDuration(value); err != nil || olderThan <= 0 {
+			return Error(400, "Invalid olderThan, expected a positive duration like 4320h", err)
+		}
+	}
+
+	excludeTags := setting.DashboardStaleExcludeTags
+	if tags := c.QueryStrings("excludeTag"); len(tags) > 0 {
+		excludeTags = tags
+	}
+
+	stale, err := dashboards.NewService().GetStaleDashboards(c.OrgId, olderThan, excludeTags)
+	if err != nil {
+		return Error(500, "Failed to get stale dashboards", err)
+	}
+
+	return JSON(200, stale)
+}
+
+// POST /api/dashboards/uid/:uid/archive
+func ArchiveDashboardByUID(c *m.ReqContext) Response {
+	dash, rsp := getDashboardHelper(c.OrgId, "", 0, c.Params(":uid"))
+	if rsp != nil {
+		return rsp
+	}
+
+	archived, err := dashboards.NewService().ArchiveDashboard(dash.Id, c.OrgId, c.SignedInUser)
+	if err != nil {
+		return archiveDashboardErrorToApiResponse(err)
+	}
+
+	return JSON(200, util.DynMap{
+		"status":   "success",
+		"id":       archived.Id,
+		"uid":      archived.Uid,
+		"folderId": archived.FolderId,
+		"version":  archived.Version,
+		"url":      archived.GetUrl(),
+	})
+}
+
+// GET /dashboard-archive/:uid, the archive links of the stale dashboards report
+func ArchiveDashboardFromReport(c *m.ReqContext) Response {
+	dash, rsp := getDashboardHelper(c.OrgId, "", 0, c.Params(":uid"))
+	if rsp != nil {
+		return rsp
+	}
+
+	archived, err := dashboards.NewService().ArchiveDashboardWithToken(dash.Id, c.OrgId, c.Query("token"), c.SignedInUser)
+	if err != nil {
+		return archiveDashboardErrorToApiResponse(err)
+	}
+
+	return Redirect(archived.GetUrl())
+}
+
+func archiveDashboardErrorToApiResponse(err error) Response {
+	if ruleErr, ok := err.(m.DashboardSaveRuleError); ok {
+		return dashboardSaveRuleErrorToApiResponse(ruleErr)
+	}
+
+	if limitErr, ok := err.(m.DashboardSaveRateLimitError); ok {
+		return dashboardSaveRateLimitErrorToApiResponse(limitErr)
+	}
+
+	if readOnlyErr, ok := err.(m.DashboardsReadOnlyError); ok {
+		return dashboardsReadOnlyErrorToApiResponse(readOnlyErr)
+	}
+
+	switch err {
+	case m.ErrDashboardArchiveTokenInvalid, m.ErrDashboardArchiveTokenExpired, m.ErrDashboardCannotArchiveFolder:
+		return Error(400, err.Error(), nil)
+	case m.ErrDashboardVersionMismatch:
+		return JSON(412, util.DynMap{"status": "version-mismatch", "message": "The dashboard has been changed since the report, it is not archived"})
+	case m.ErrDashboardUpdateAccessDenied, m.ErrFolderAccessDenied:
+		return Error(403, err.Error(), err)
+	case m.ErrDashboardGitlabSync, m.ErrDashboardGitlabToken:
+		return Error(500, err.Error(), err)
+	case m.ErrDashboardGitConflict:
+		return JSON(409, util.DynMap{"status": "git-conflict", "message": err.Error()})
+	}
+
+	return Error(500, "Failed to archive dashboard", err)
+}
@@ -118,6 +118,26 @@ var adminCommands = []cli.Command{
 		Usage:  "reset-admin-password <new password>",
 		Action: runDbCommand(resetPasswordCommand),
 	},
+	{
+		Name:   "verify-repo-consistency",
+		Usage:  "verify-repo-consistency <org id>, exits with an error when synced dashboards differ from the repository",
+		Action: runDbCommand(verifyRepoCommand),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "folder",
+				Usage: "only verify the dashboards of the folder",
+			},
+			cli.StringFlag{
+				Name:  "read-interval",
+				Usage: "minimum time between two reads of repository files",
+				Value: "100ms",
+			},
+			cli.BoolFlag{
+				Name:  "create-path",
+				Usage: "commit a .gitkeep file to the dashboards path when it does not exist yet",
+			},
+		},
+	},
 	{
 		Name:  "data-migration",
 		Usage: "Runs a script that migrates or cleanups data in your db",
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/utils"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// verifyRepoCommand prints the consistency report of the synced dashboards of an organization as json,
+// and fails when any of them differs from the repository
+func verifyRepoCommand(c utils.CommandLine, sqlStore *sqlstore.SqlStore) error {
+	orgId, err := strconv.ParseInt(c.Args().First(), 10, 64)
+	if err != nil || orgId <= 0 {
+		return fmt.Errorf("Invalid organization id %q", c.Args().First())
+	}
+
+	opts := dashboards.VerifyRepoOptions{Folder: c.String("folder"), CreatePath: c.Bool("create-path")}
+	if interval := c.String("read-interval"); interval != "" {
+		if opts.ReadInterval, err = time.ParseDuration(interval); err != nil {
+			return fmt.Errorf("Invalid read interval %q", interval)
+		}
+	}
+
+	social.NewOAuthService()
+
+	report, err := dashboards.NewService().VerifyRepoConsistency(orgId, opts)
+	if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	logger.Info(string(output) + "\n")
+
+	if report.Drifted {
+		return fmt.Errorf("Dashboards differ from the repository")
+	}
+
+	return nil
+}
@@ -78,9 +78,12 @@ func CalculateDiff(options *Options) (*Result, error) {
 		return nil, err
 	}
 
-	baseData := baseVersionQuery.Result.Data
-	newData := newVersionQuery.Result.Data
+	return CalculateJSONDiff(baseVersionQuery.Result.Data, newVersionQuery.Result.Data, options.DiffType)
+}
 
+// CalculateJSONDiff computes the diff of two dashboard models that are not necessarily saved versions,
+// returning ErrNilDiff when they are identical.
+func CalculateJSONDiff(baseData, newData *simplejson.Json, diffType DiffType) (*Result, error) {
 	left, jsonDiff, err := getDiff(baseData, newData)
 	if err != nil {
 		return nil, err
@@ -88,7 +91,7 @@ func CalculateDiff(options *Options) (*Result, error) {
 
 	result := &Result{}
 
-	switch options.DiffType {
+	switch diffType {
 	case DiffDelta:
 
 		deltaOutput, err := deltaFormatter.NewDeltaFormatter().Format(jsonDiff)
@@ -0,0 +1,51 @@
+// Package jsoncompare compares json objects by value, regardless of formatting and key order
+package jsoncompare
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/yudai/gojsondiff"
+)
+
+// Result is the outcome of comparing a json object to a base object
+type Result struct {
+	Equal bool
+	// Changes summarizes the differences by top-level property, e.g. "panels changed" or "tags added"
+	Changes []string
+}
+
+// Compare compares the object to the base object. The ignored top-level properties, e.g. identifiers
+// that differ between copies of the same object, are removed from both before comparing.
+func Compare(base []byte, object []byte, ignored ...string) (*Result, error) {
+	var left, right map[string]interface{}
+	if err := json.Unmarshal(base, &left); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(object, &right); err != nil {
+		return nil, err
+	}
+
+	for _, name := range ignored {
+		delete(left, name)
+		delete(right, name)
+	}
+
+	diff := gojsondiff.New().CompareObjects(left, right)
+	result := &Result{Equal: !diff.Modified(), Changes: make([]string, 0)}
+
+	for _, delta := range diff.Deltas() {
+		switch d := delta.(type) {
+		case *gojsondiff.Added:
+			result.Changes = append(result.Changes, fmt.Sprintf("%s added", d.PostPosition()))
+		case *gojsondiff.Deleted:
+			result.Changes = append(result.Changes, fmt.Sprintf("%s removed", d.PrePosition()))
+		case gojsondiff.PostDelta:
+			result.Changes = append(result.Changes, fmt.Sprintf("%s changed", d.PostPosition()))
+		}
+	}
+
+	sort.Strings(result.Changes)
+	return result, nil
+}
@@ -0,0 +1,44 @@
+package jsoncompare
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompare(t *testing.T) {
+	Convey("When comparing json objects", t, func() {
+		base := []byte(`{"id": 1, "title": "Dash", "tags": ["a"], "panels": [{"id": 1, "type": "graph"}], "refresh": "5s"}`)
+
+		Convey("Should ignore formatting and key order", func() {
+			result, err := Compare(base, []byte(`{
+  "refresh": "5s",
+  "panels": [{"type": "graph", "id": 1}],
+  "tags": ["a"],
+  "title": "Dash",
+  "id": 1
+}`))
+			So(err, ShouldBeNil)
+			So(result.Equal, ShouldBeTrue)
+			So(result.Changes, ShouldBeEmpty)
+		})
+
+		Convey("Should summarize the changes by top-level property", func() {
+			result, err := Compare(base, []byte(`{"id": 1, "title": "Dash", "panels": [{"id": 1, "type": "table"}], "refresh": "5s", "time": {"from": "now-1h"}}`))
+			So(err, ShouldBeNil)
+			So(result.Equal, ShouldBeFalse)
+			So(result.Changes, ShouldResemble, []string{"panels changed", "tags removed", "time added"})
+		})
+
+		Convey("Should ignore the given properties", func() {
+			result, err := Compare(base, []byte(`{"id": 7, "title": "Dash", "tags": ["a"], "panels": [{"id": 1, "type": "graph"}], "refresh": "5s"}`), "id")
+			So(err, ShouldBeNil)
+			So(result.Equal, ShouldBeTrue)
+		})
+
+		Convey("Should fail on invalid json", func() {
+			_, err := Compare(base, []byte(`{"title": `))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -89,3 +89,97 @@ type UserUpdated struct {
 	Login     string    `json:"login"`
 	Email     string    `json:"email"`
 }
+
+type DataSourceCreated struct {
+	Timestamp time.Time `json:"timestamp"`
+	Id        int64     `json:"id"`
+	OrgId     int64     `json:"org_id"`
+	Name      string    `json:"name"`
+}
+
+type DataSourceUpdated struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Id           int64     `json:"id"`
+	OrgId        int64     `json:"org_id"`
+	Name         string    `json:"name"`
+	PreviousName string    `json:"previous_name"`
+}
+
+type DataSourceDeleted struct {
+	Timestamp time.Time `json:"timestamp"`
+	Id        int64     `json:"id"`
+	OrgId     int64     `json:"org_id"`
+	Name      string    `json:"name"`
+}
+
+type AlertNotificationCreated struct {
+	Timestamp time.Time `json:"timestamp"`
+	Id        int64     `json:"id"`
+	Uid       string    `json:"uid"`
+	OrgId     int64     `json:"org_id"`
+	Name      string    `json:"name"`
+}
+
+type AlertNotificationUpdated struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Id           int64     `json:"id"`
+	Uid          string    `json:"uid"`
+	OrgId        int64     `json:"org_id"`
+	Name         string    `json:"name"`
+	PreviousName string    `json:"previous_name"`
+}
+
+type AlertNotificationDeleted struct {
+	Timestamp time.Time `json:"timestamp"`
+	Id        int64     `json:"id"`
+	Uid       string    `json:"uid"`
+	OrgId     int64     `json:"org_id"`
+	Name      string    `json:"name"`
+}
+
+type DashboardDeleted struct {
+	Timestamp time.Time `json:"timestamp"`
+	Id        int64     `json:"id"`
+	Uid       string    `json:"uid"`
+	OrgId     int64     `json:"org_id"`
+	Title     string    `json:"title"`
+	IsFolder  bool      `json:"is_folder"`
+}
+
+type DashboardAclUpdated struct {
+	Timestamp   time.Time `json:"timestamp"`
+	OrgId       int64     `json:"org_id"`
+	DashboardId int64     `json:"dashboard_id"`
+	UpdatedBy   string    `json:"updated_by"`
+	Changes     []string  `json:"changes"`
+}
+
+// DashboardSyncFailed is published when a dashboard change could not be committed to git. Repo is the
+// repository the dashboard selects, empty for the repository of the organization.
+type DashboardSyncFailed struct {
+	Timestamp   time.Time `json:"timestamp"`
+	OrgId       int64     `json:"org_id"`
+	Repo        string    `json:"repo"`
+	DashboardId int64     `json:"dashboard_id"`
+	Title       string    `json:"title"`
+	Error       string    `json:"error"`
+}
+
+// DashboardSyncBudgetExceeded is published when an organization exceeds its daily budget of dashboard commits.
+// Dashboard changes are not committed until ResetAt.
+type DashboardSyncBudgetExceeded struct {
+	Timestamp   time.Time `json:"timestamp"`
+	OrgId       int64     `json:"org_id"`
+	Commits     int       `json:"commits"`
+	Bytes       int64     `json:"bytes"`
+	DashboardId int64     `json:"dashboard_id"`
+	ResetAt     time.Time `json:"reset_at"`
+}
+
+// DashboardSynced is published when a dashboard change was committed to git
+type DashboardSynced struct {
+	Timestamp   time.Time `json:"timestamp"`
+	OrgId       int64     `json:"org_id"`
+	Repo        string    `json:"repo"`
+	DashboardId int64     `json:"dashboard_id"`
+}
@@ -146,6 +146,15 @@ var (
 	// StatsTotalActiveAdmins is a metric total amount of active admins
 	StatsTotalActiveAdmins prometheus.Gauge
 
+	// MDashboardSyncBudgetRemaining is a metric remaining daily budget of dashboard commits by organization
+	MDashboardSyncBudgetRemaining *prometheus.GaugeVec
+
+	// MDashboardSaveStageDuration is a metric summary for the duration of the stages of dashboard saves
+	MDashboardSaveStageDuration *prometheus.SummaryVec
+
+	// MDashboardSaveThrottled is a metric counter for dashboard saves rejected by the save rate limits
+	MDashboardSaveThrottled *prometheus.CounterVec
+
 	// grafanaBuildVersion is a metric with a constant '1' value labeled by version, revision, branch, and goversion from which Grafana was built
 	grafanaBuildVersion *prometheus.GaugeVec
 )
@@ -417,6 +426,24 @@ func init() {
 		Namespace: exporterName,
 	})
 
+	MDashboardSyncBudgetRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "dashboard_sync_budget_remaining",
+		Help:      "remaining daily budget of dashboard commits by organization, in commits and in bytes",
+		Namespace: exporterName,
+	}, []string{"org_id", "budget"})
+
+	MDashboardSaveStageDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:      "dashboard_save_stage_duration_milliseconds",
+		Help:      "summary for the duration of the stages of dashboard saves by save path",
+		Namespace: exporterName,
+	}, []string{"pipeline", "stage"})
+
+	MDashboardSaveThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "dashboard_save_throttled_total",
+		Help:      "counter for dashboard saves rejected by the save rate limit of the user or the organization",
+		Namespace: exporterName,
+	}, []string{"limit"})
+
 	grafanaBuildVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:      "build_info",
 		Help:      "A metric with a constant '1' value labeled by version, revision, branch, and goversion from which Grafana was built",
@@ -479,6 +506,9 @@ func initMetricVars() {
 		StatsTotalActiveViewers,
 		StatsTotalActiveEditors,
 		StatsTotalActiveAdmins,
+		MDashboardSyncBudgetRemaining,
+		MDashboardSaveStageDuration,
+		MDashboardSaveThrottled,
 		grafanaBuildVersion,
 	)
 
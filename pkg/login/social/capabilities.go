@@ -0,0 +1,35 @@
+package social
+
+// Capabilities tell which features a connector supports with its configuration, so the settings page can show
+// admins why a feature is not available
+type Capabilities struct {
+	// DashboardSync is set when repositories are configured to commit dashboards to, not only when the provider
+	// can host them
+	DashboardSync bool `json:"dashboardSync"`
+	// GroupFetching is set when the groups of users are read from the provider, e.g. for the group role mapping
+	GroupFetching bool `json:"groupFetching"`
+	// RoleMapping is set when the org roles of users are mapped from their groups or email domain
+	RoleMapping bool `json:"roleMapping"`
+	// PKCE is set when the authorization code flow is protected with a code verifier
+	PKCE bool `json:"pkce"`
+	// TokenRevocation is set when the tokens of users are revoked at the provider on logout
+	TokenRevocation bool `json:"tokenRevocation"`
+}
+
+// Settings returns the capabilities as the keys of the provider section of the admin settings
+func (c Capabilities) Settings() map[string]string {
+	return map[string]string{
+		"capability_dashboard_sync":   boolSetting(c.DashboardSync),
+		"capability_group_fetching":   boolSetting(c.GroupFetching),
+		"capability_role_mapping":     boolSetting(c.RoleMapping),
+		"capability_pkce":             boolSetting(c.PKCE),
+		"capability_token_revocation": boolSetting(c.TokenRevocation),
+	}
+}
+
+func boolSetting(value bool) string {
+	if value {
+		return "true"
+	}
+	return "false"
+}
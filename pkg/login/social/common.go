@@ -1,12 +1,16 @@
 package social
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
 )
 
 type HttpGetResponse struct {
@@ -28,8 +32,96 @@ func isEmailAllowed(email string, allowedDomains []string) bool {
 	return valid
 }
 
+// parseRoleMapping parses a "key:Role" list, e.g. "company.com:Editor, contractor.com:Viewer".
+// Entries with an unknown role are ignored.
+func parseRoleMapping(str string) map[string]string {
+	mapping := make(map[string]string)
+
+	for _, entry := range util.SplitString(str) {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		role := models.RoleType(strings.TrimSpace(parts[1]))
+		if key == "" || !role.IsValid() {
+			continue
+		}
+
+		mapping[key] = string(role)
+	}
+
+	return mapping
+}
+
+// ResolveOrgRole returns the org role for an OAuth user. The precedence is an explicit role
+// returned by the provider, then group mapping, then email domain mapping. An empty string
+// means that no mapping applies and the default role should be used. Without all the groups of the user no
+// mapping applies either, so existing users keep their roles rather than losing the role of a missing group.
+func ResolveOrgRole(userInfo *BasicUserInfo, info *setting.OAuthInfo) string {
+	if userInfo.Role != "" {
+		return userInfo.Role
+	}
+
+	if info == nil {
+		return ""
+	}
+
+	if len(info.GroupRoleMapping) > 0 {
+		userInfo.LoadGroups()
+	}
+
+	if userInfo.GroupsPartial {
+		return ""
+	}
+
+	if role := groupRole(userInfo.Groups, info.GroupRoleMapping); role != "" {
+		return role
+	}
+
+	return domainRole(userInfo.Email, info.DomainRoleMapping)
+}
+
+// groupRole returns the most privileged role mapped to any of the groups.
+func groupRole(groups []string, mapping map[string]string) string {
+	var result models.RoleType
+
+	for _, group := range groups {
+		role, ok := mapping[strings.ToLower(group)]
+		if !ok {
+			continue
+		}
+
+		if result == "" || !result.Includes(models.RoleType(role)) {
+			result = models.RoleType(role)
+		}
+	}
+
+	return string(result)
+}
+
+func domainRole(email string, mapping map[string]string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+
+	return mapping[strings.ToLower(email[at+1:])]
+}
+
 func HttpGet(client *http.Client, url string) (response HttpGetResponse, err error) {
-	r, err := client.Get(url)
+	return httpGetContext(context.Background(), client, url)
+}
+
+// httpGetContext is HttpGet with a request canceled with the context
+func httpGetContext(ctx context.Context, client *http.Client, url string) (response HttpGetResponse, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return
+	}
+
+	r, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		return
 	}
@@ -0,0 +1,57 @@
+package social
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolveOrgRole(t *testing.T) {
+	Convey("Given an OAuth provider with group and domain role mappings", t, func() {
+		info := &setting.OAuthInfo{
+			GroupRoleMapping:  parseRoleMapping("admins:Admin, developers:Editor, everyone:Viewer"),
+			DomainRoleMapping: parseRoleMapping("company.com:Editor contractor.com:Viewer"),
+		}
+
+		Convey("Should prefer the role returned by the provider", func() {
+			userInfo := &BasicUserInfo{Role: "Viewer", Email: "john@company.com", Groups: []string{"admins"}}
+			So(ResolveOrgRole(userInfo, info), ShouldEqual, "Viewer")
+		})
+
+		Convey("Should prefer group mapping over domain mapping", func() {
+			userInfo := &BasicUserInfo{Email: "john@contractor.com", Groups: []string{"developers"}}
+			So(ResolveOrgRole(userInfo, info), ShouldEqual, "Editor")
+		})
+
+		Convey("Should use the most privileged mapped group", func() {
+			userInfo := &BasicUserInfo{Email: "john@company.com", Groups: []string{"everyone", "admins", "developers"}}
+			So(ResolveOrgRole(userInfo, info), ShouldEqual, "Admin")
+		})
+
+		Convey("Should fall back to domain mapping when no group matches", func() {
+			userInfo := &BasicUserInfo{Email: "john@Company.com", Groups: []string{"unknown"}}
+			So(ResolveOrgRole(userInfo, info), ShouldEqual, "Editor")
+
+			userInfo = &BasicUserInfo{Email: "jane@contractor.com"}
+			So(ResolveOrgRole(userInfo, info), ShouldEqual, "Viewer")
+		})
+
+		Convey("Should not map a role from partial groups", func() {
+			userInfo := &BasicUserInfo{Email: "john@company.com", Groups: []string{"everyone"}, GroupsPartial: true}
+			So(ResolveOrgRole(userInfo, info), ShouldEqual, "")
+		})
+
+		Convey("Should return empty role when nothing matches", func() {
+			userInfo := &BasicUserInfo{Email: "john@elsewhere.com"}
+			So(ResolveOrgRole(userInfo, info), ShouldEqual, "")
+			So(ResolveOrgRole(userInfo, nil), ShouldEqual, "")
+		})
+	})
+
+	Convey("When parsing role mappings", t, func() {
+		mapping := parseRoleMapping("company.com:Editor, broken, other.com:Superuser, :Admin")
+
+		So(mapping, ShouldResemble, map[string]string{"company.com": "Editor"})
+	})
+}
@@ -0,0 +1,192 @@
+package social
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ExportSettings tells which org-level resources are exported to the repository of an organization
+type ExportSettings struct {
+	Datasources bool
+	Notifiers   bool
+	// Permissions exports the permissions of folders and dashboards next to the synced dashboards
+	Permissions bool
+	// PermissionEmails adds the emails of the users granted permissions to the exported permissions
+	PermissionEmails bool
+	// DashboardsPath is the directory of the synced dashboards in the repository
+	DashboardsPath string
+}
+
+// GitProvider writes files to the repository of an organization. Unlike dashboard sync, which commits
+// with the token of the signed in user, it authenticates with the access token configured for the repository.
+type GitProvider interface {
+	ExportSettings(orgId int64) *ExportSettings
+	// WriteFile creates the file at filePath or updates it if it already exists
+	WriteFile(orgId int64, filePath string, content string, message string) error
+	// DeleteFile deletes the file at filePath, doing nothing if it does not exist
+	DeleteFile(orgId int64, filePath string, message string) error
+}
+
+// FileMove moves a file in the repository, the new file gets Content
+type FileMove struct {
+	From    string
+	To      string
+	Content string
+}
+
+// DashboardFileMover is implemented by git providers that can move synced dashboards when the
+// layout of the repository changes
+type DashboardFileMover interface {
+	// DashboardFilePath returns the path dashboards are synced to with the current configuration
+	DashboardFilePath(orgId int64, folder string, name string) string
+	// MoveFiles commits all moves at once and returns the sha of the commit
+	MoveFiles(orgId int64, moves []FileMove, message string) (string, error)
+}
+
+// DashboardFilePath returns the path a dashboard is synced to: a json file named after the dashboard in the
+// directory of its folder, under the dashboards path of the repository
+func DashboardFilePath(dashboardsPath string, folder string, name string) string {
+	return path.Join(dashboardsPath, folder, fmt.Sprintf("%s.json", name))
+}
+
+// DashboardFolderFromPath returns the folder of a dashboard file, the inverse of DashboardFilePath. The
+// dashboards path is stripped from the directory of the file, and files directly under it belong to the
+// General folder. Both paths may start with / or ./ and the dashboards path may end with /.
+func DashboardFolderFromPath(dashboardsPath string, filePath string) string {
+	root := strings.Trim(path.Clean("/"+dashboardsPath), "/")
+	dir := strings.Trim(path.Dir(path.Clean("/"+filePath)), "/")
+
+	if root != "" {
+		if dir == root {
+			return models.RootFolderName
+		}
+		dir = strings.TrimPrefix(dir, root+"/")
+	}
+
+	if dir == "" {
+		return models.RootFolderName
+	}
+	return dir
+}
+
+// DashboardFile is a dashboard json file of the repository and the folder its directory stands for
+type DashboardFile struct {
+	Path   string
+	Folder string
+}
+
+// DashboardFileReader is implemented by git providers that can read the dashboards of the repository,
+// including the ones that were added directly to git
+type DashboardFileReader interface {
+	// ListDashboardFiles returns the json files under the dashboards path of the repository
+	ListDashboardFiles(orgId int64) ([]DashboardFile, error)
+	// ReadFile returns the content of the file on the branch of the repository
+	ReadFile(orgId int64, filePath string) (string, error)
+}
+
+var (
+	// ErrGitRefNotFound is returned for refs that are neither a commit nor a branch or tag of the repository
+	ErrGitRefNotFound = errors.New("Ref not found in the repository")
+	// ErrGitFileNotFound is returned for files that do not exist at the ref
+	ErrGitFileNotFound = errors.New("File not found in the repository at the ref")
+)
+
+// RevisionReader is implemented by git providers that can read the files of the repository at any ref, not only
+// on the branch dashboards are synced to
+type RevisionReader interface {
+	// ReadFileAtRef returns the content of the file at the ref, a commit sha or a branch or tag name. It fails with
+	// ErrGitRefNotFound for unknown refs and ErrGitFileNotFound for files missing at the ref.
+	ReadFileAtRef(orgId int64, filePath string, ref string) (string, error)
+}
+
+// JsonnetSettings tell how the jsonnet dashboard files of a repository are rendered to json when imported
+type JsonnetSettings struct {
+	// ImportPaths are the directories of the repository imports are looked up in when they are not found next
+	// to the importing file
+	ImportPaths []string
+	// Timeout bounds the evaluation of a file
+	Timeout time.Duration
+	// MaxStack bounds the depth of the evaluation, and so the memory used by deep recursion
+	MaxStack int
+	// MaxOutput bounds the size in bytes of the rendered json, 0 is no limit
+	MaxOutput int
+}
+
+// JsonnetSourceReader is implemented by git providers whose repositories may hold dashboards as jsonnet files.
+// Their ListDashboardFiles returns the .jsonnet files as well when rendering is enabled.
+type JsonnetSourceReader interface {
+	// JsonnetSettings returns nil when the jsonnet files of the repository are not rendered
+	JsonnetSettings(orgId int64) *JsonnetSettings
+}
+
+// DashboardsPathCreator is implemented by git providers that can tell whether the dashboards path of the repository
+// exists, and create it, e.g. in a new repository nothing was committed to yet
+type DashboardsPathCreator interface {
+	// DashboardsPathExists tells whether the dashboards path exists on the branch of the repository. A missing
+	// repository or branch is an error.
+	DashboardsPathExists(orgId int64) (bool, error)
+	// CreateDashboardsPath commits a seed file to the dashboards path and returns the sha of the commit
+	CreateDashboardsPath(orgId int64, message string) (string, error)
+}
+
+// ExternalIdentity is a user of the git provider, e.g. the author of a commit. Id is the user id on the
+// provider, it is empty when only the name and email of the user are known.
+type ExternalIdentity struct {
+	Id       string
+	Username string
+	Name     string
+	Email    string
+}
+
+// String returns the identity the way git shows commit authors
+func (i ExternalIdentity) String() string {
+	name := i.Name
+	if name == "" {
+		name = i.Username
+	}
+	if i.Email == "" {
+		return name
+	}
+	return fmt.Sprintf("%s <%s>", name, i.Email)
+}
+
+// FileAuthorReader is implemented by git providers that can tell who last changed a file of the repository
+type FileAuthorReader interface {
+	// FileAuthor returns the author of the last commit changing the file on the branch of the repository
+	FileAuthor(orgId int64, filePath string) (*ExternalIdentity, error)
+}
+
+// UserLookup is implemented by git providers that can map their users to Grafana users
+type UserLookup interface {
+	// LookupGrafanaUser returns the member of the organization linked to the identity. It returns
+	// models.ErrUserNotFound for unknown users and ErrAmbiguousExternalIdentity when the email of
+	// the identity matches several users.
+	LookupGrafanaUser(ctx context.Context, orgId int64, identity ExternalIdentity) (*models.SignedInUser, error)
+}
+
+// ErrRepoNotMirror is returned when promoting a repository that is not a mirror of the repository of the organization
+var ErrRepoNotMirror = errors.New("The repository is not a mirror of the repository of the organization")
+
+// MirrorSyncResult is the commit of a dashboard change to a mirror of the repository
+type MirrorSyncResult struct {
+	RepoId    int
+	Name      string
+	FilePath  string
+	CommitSha string
+	// Err is set when the commit to the mirror failed, the change is still committed to the repository
+	Err error
+}
+
+// RepoMirrorPromoter is implemented by git providers that mirror the dashboard commits of a repository to other
+// repositories, e.g. while the dashboards move to another repository
+type RepoMirrorPromoter interface {
+	// PromoteMirror makes the mirror, selected by name or id, the repository of the organization, and the repository
+	// a mirror of it. It fails with ErrRepoNotMirror for repositories that are not a mirror of the repository.
+	PromoteMirror(orgId int64, mirror string) (*SyncRepo, error)
+}
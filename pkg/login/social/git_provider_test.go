@@ -0,0 +1,40 @@
+package social
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardFolderFromPath(t *testing.T) {
+	Convey("Mapping dashboard files to folders", t, func() {
+		Convey("Should use the directory below the dashboards path", func() {
+			So(DashboardFolderFromPath("dashboards", "dashboards/Team A/board.json"), ShouldEqual, "Team A")
+			So(DashboardFolderFromPath("grafana/dashboards", "grafana/dashboards/Team A/board.json"), ShouldEqual, "Team A")
+		})
+
+		Convey("Should put files directly under the dashboards path in General", func() {
+			So(DashboardFolderFromPath("dashboards", "dashboards/board.json"), ShouldEqual, "General")
+			So(DashboardFolderFromPath("", "board.json"), ShouldEqual, "General")
+		})
+
+		Convey("Should ignore leading and trailing slashes", func() {
+			So(DashboardFolderFromPath("/dashboards/", "dashboards/Team A/board.json"), ShouldEqual, "Team A")
+			So(DashboardFolderFromPath("./dashboards", "/dashboards/Team A/board.json"), ShouldEqual, "Team A")
+			So(DashboardFolderFromPath("/", "Team A/board.json"), ShouldEqual, "Team A")
+		})
+
+		Convey("Should only strip the dashboards path at a directory boundary", func() {
+			So(DashboardFolderFromPath("dashboards", "dashboards-old/Team A/board.json"), ShouldEqual, "dashboards-old/Team A")
+		})
+
+		Convey("Should round-trip the paths dashboards are synced to", func() {
+			for _, folder := range []string{"General", "Team A", "Ops/Databases"} {
+				for _, dashboardsPath := range []string{"", "dashboards", "/grafana/dashboards/"} {
+					filePath := DashboardFilePath(dashboardsPath, folder, "board")
+					So(DashboardFolderFromPath(dashboardsPath, filePath), ShouldEqual, folder)
+				}
+			}
+		})
+	})
+}
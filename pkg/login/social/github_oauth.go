@@ -1,11 +1,13 @@
 package social
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
+	"net/url"
+	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 
@@ -19,6 +21,14 @@ type SocialGithub struct {
 	apiUrl               string
 	allowSignup          bool
 	teamIds              []int
+	repos                []*GrafanaGithubRepo
+
+	// fetchConcurrency is how many pages of teams and organizations are fetched at once
+	fetchConcurrency int
+	// fetchMaxPages bounds the pages of teams and organizations read at login, the others are left out, 0 is no limit
+	fetchMaxPages int
+	// fetchTimeout bounds the time reading the user, teams and organizations takes at login, 0 is no limit
+	fetchTimeout time.Duration
 }
 
 type GithubTeam struct {
@@ -47,16 +57,20 @@ func (s *SocialGithub) IsSignupAllowed() bool {
 	return s.allowSignup
 }
 
-func (s *SocialGithub) IsTeamMember(client *http.Client) bool {
+// Capabilities adds the groups of users, which are their teams, and the dashboard sync when repositories are
+// configured
+func (s *SocialGithub) Capabilities() Capabilities {
+	capabilities := s.SocialBase.Capabilities()
+	capabilities.DashboardSync = len(s.repos) > 0
+	capabilities.GroupFetching = true
+	return capabilities
+}
+
+func (s *SocialGithub) IsTeamMember(teamMemberships []GithubTeam) bool {
 	if len(s.teamIds) == 0 {
 		return true
 	}
 
-	teamMemberships, err := s.FetchTeamMemberships(client)
-	if err != nil {
-		return false
-	}
-
 	for _, teamId := range s.teamIds {
 		for _, membership := range teamMemberships {
 			if teamId == membership.Id {
@@ -68,16 +82,11 @@ func (s *SocialGithub) IsTeamMember(client *http.Client) bool {
 	return false
 }
 
-func (s *SocialGithub) IsOrganizationMember(client *http.Client, organizationsUrl string) bool {
+func (s *SocialGithub) IsOrganizationMember(organizations []string) bool {
 	if len(s.allowedOrganizations) == 0 {
 		return true
 	}
 
-	organizations, err := s.FetchOrganizations(client, organizationsUrl)
-	if err != nil {
-		return false
-	}
-
 	for _, allowedOrganization := range s.allowedOrganizations {
 		for _, organization := range organizations {
 			if organization == allowedOrganization {
@@ -89,25 +98,39 @@ func (s *SocialGithub) IsOrganizationMember(client *http.Client, organizationsUr
 	return false
 }
 
-func (s *SocialGithub) FetchPrivateEmail(client *http.Client) (string, error) {
-	type Record struct {
-		Email    string `json:"email"`
-		Primary  bool   `json:"primary"`
-		Verified bool   `json:"verified"`
-	}
+type GithubEmail struct {
+	Email      string `json:"email"`
+	Primary    bool   `json:"primary"`
+	Verified   bool   `json:"verified"`
+	Visibility string `json:"visibility"`
+}
 
+func (s *SocialGithub) FetchEmails(client *http.Client) ([]GithubEmail, error) {
 	response, err := HttpGet(client, fmt.Sprintf(s.apiUrl+"/emails"))
 	if err != nil {
-		return "", fmt.Errorf("Error getting email address: %s", err)
+		return nil, fmt.Errorf("Error getting email address: %s", err)
 	}
 
-	var records []Record
+	var records []GithubEmail
 
 	err = json.Unmarshal(response.Body, &records)
 	if err != nil {
-		return "", fmt.Errorf("Error getting email address: %s", err)
+		return nil, fmt.Errorf("Error getting email address: %s", err)
+	}
+
+	return records, nil
+}
+
+func (s *SocialGithub) FetchPrivateEmail(client *http.Client) (string, error) {
+	records, err := s.FetchEmails(client)
+	if err != nil {
+		return "", err
 	}
 
+	return primaryEmail(records), nil
+}
+
+func primaryEmail(records []GithubEmail) string {
 	var email = ""
 	for _, record := range records {
 		if record.Primary {
@@ -115,76 +138,86 @@ func (s *SocialGithub) FetchPrivateEmail(client *http.Client) (string, error) {
 		}
 	}
 
-	return email, nil
+	return email
 }
 
-func (s *SocialGithub) FetchTeamMemberships(client *http.Client) ([]GithubTeam, error) {
-	url := fmt.Sprintf(s.apiUrl + "/teams?per_page=100")
-	hasMore := true
-	teams := make([]GithubTeam, 0)
-
-	for hasMore {
-
-		response, err := HttpGet(client, url)
-		if err != nil {
-			return nil, fmt.Errorf("Error getting team memberships: %s", err)
+// verifiedEmail returns the address to attribute commits to. GitHub rejects pushes exposing a private
+// address and does not link commits to unverified ones, so only public verified addresses are used,
+// the primary one first. Otherwise the noreply address of the account is returned.
+func (s *SocialGithub) verifiedEmail(records []GithubEmail, id int, login string) string {
+	var email = ""
+	for _, record := range records {
+		if !record.Verified || record.Visibility != "public" {
+			continue
 		}
 
-		var records []GithubTeam
-
-		err = json.Unmarshal(response.Body, &records)
-		if err != nil {
-			return nil, fmt.Errorf("Error getting team memberships: %s", err)
+		if record.Primary {
+			return record.Email
 		}
 
-		teams = append(teams, records...)
+		if email == "" {
+			email = record.Email
+		}
+	}
 
-		url, hasMore = s.HasMoreRecords(response.Headers)
+	if email != "" {
+		return email
 	}
 
-	return teams, nil
+	return s.noreplyEmail(id, login)
 }
 
-func (s *SocialGithub) HasMoreRecords(headers http.Header) (string, bool) {
+func (s *SocialGithub) noreplyEmail(id int, login string) string {
+	domain := "users.noreply.github.com"
 
-	value, exists := headers["Link"]
-	if !exists {
-		return "", false
+	// GitHub Enterprise uses the hostname of the instance
+	if apiUrl, err := url.Parse(s.apiUrl); err == nil && apiUrl.Hostname() != "" && apiUrl.Hostname() != "api.github.com" {
+		domain = "noreply." + apiUrl.Hostname()
 	}
 
-	pattern := regexp.MustCompile(`<([^>]+)>; rel="next"`)
-	matches := pattern.FindStringSubmatch(value[0])
+	return fmt.Sprintf("%d+%s@%s", id, login, domain)
+}
 
-	if matches == nil {
-		return "", false
+// FetchTeamMemberships returns the teams of the user, in the order of the pages of the GitHub API
+func (s *SocialGithub) FetchTeamMemberships(ctx context.Context, client *http.Client) ([]GithubTeam, error) {
+	pages, err := s.fetchPages(ctx, client, s.apiUrl+"/teams?per_page=100")
+	if err != nil {
+		return nil, fmt.Errorf("Error getting team memberships: %s", err)
 	}
 
-	url := matches[1]
-
-	return url, true
+	teams := make([]GithubTeam, 0)
+	for _, page := range pages {
+		var records []GithubTeam
+		if err := json.Unmarshal(page, &records); err != nil {
+			return nil, fmt.Errorf("Error getting team memberships: %s", err)
+		}
+		teams = append(teams, records...)
+	}
 
+	return teams, nil
 }
 
-func (s *SocialGithub) FetchOrganizations(client *http.Client, organizationsUrl string) ([]string, error) {
+// FetchOrganizations returns the logins of the organizations of the user, in the order of the pages of the
+// GitHub API
+func (s *SocialGithub) FetchOrganizations(ctx context.Context, client *http.Client) ([]string, error) {
 	type Record struct {
 		Login string `json:"login"`
 	}
 
-	response, err := HttpGet(client, organizationsUrl)
-	if err != nil {
-		return nil, fmt.Errorf("Error getting organizations: %s", err)
-	}
-
-	var records []Record
-
-	err = json.Unmarshal(response.Body, &records)
+	pages, err := s.fetchPages(ctx, client, s.apiUrl+"/orgs?per_page=100")
 	if err != nil {
 		return nil, fmt.Errorf("Error getting organizations: %s", err)
 	}
 
-	var logins = make([]string, len(records))
-	for i, record := range records {
-		logins[i] = record.Login
+	logins := make([]string, 0)
+	for _, page := range pages {
+		var records []Record
+		if err := json.Unmarshal(page, &records); err != nil {
+			return nil, fmt.Errorf("Error getting organizations: %s", err)
+		}
+		for _, record := range records {
+			logins = append(logins, record.Login)
+		}
 	}
 
 	return logins, nil
@@ -208,7 +241,16 @@ func (s *SocialGithub) UserInfo(client *http.Client, token *oauth2.Token) (*Basi
 		return nil, fmt.Errorf("Error getting user info: %s", err)
 	}
 
-	teamMemberships, err := s.FetchTeamMemberships(client)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.fetchTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), s.fetchTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	teamMemberships, err := s.FetchTeamMemberships(ctx, client)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting user teams: %s", err)
 	}
@@ -223,23 +265,36 @@ func (s *SocialGithub) UserInfo(client *http.Client, token *oauth2.Token) (*Basi
 		Groups: teams,
 	}
 
-	organizationsUrl := fmt.Sprintf(s.apiUrl + "/orgs")
-
-	if !s.IsTeamMember(client) {
+	if !s.IsTeamMember(teamMemberships) {
 		return nil, ErrMissingTeamMembership
 	}
 
-	if !s.IsOrganizationMember(client, organizationsUrl) {
-		return nil, ErrMissingOrganizationMembership
+	if len(s.allowedOrganizations) > 0 {
+		organizations, err := s.FetchOrganizations(ctx, client)
+		if err != nil {
+			s.log.Warn("Failed to get organizations", "login", data.Login, "error", err)
+			return nil, ErrMissingOrganizationMembership
+		}
+
+		if !s.IsOrganizationMember(organizations) {
+			return nil, ErrMissingOrganizationMembership
+		}
 	}
 
-	if userInfo.Email == "" {
-		userInfo.Email, err = s.FetchPrivateEmail(client)
-		if err != nil {
+	emails, err := s.FetchEmails(client)
+	if err != nil {
+		if userInfo.Email == "" {
 			return nil, err
 		}
+		s.log.Warn("Failed to get email addresses", "login", data.Login, "error", err)
 	}
 
+	if userInfo.Email == "" {
+		userInfo.Email = primaryEmail(emails)
+	}
+
+	userInfo.VerifiedEmail = s.verifiedEmail(emails, data.Id, data.Login)
+
 	return userInfo, nil
 }
 
@@ -0,0 +1,285 @@
+package social
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGithubUserInfo(t *testing.T) {
+	Convey("Given a GitHub user", t, func() {
+		user := `{"id": 1234, "login": "octocat", "email": ""}`
+		emails := `[]`
+		emailsStatus := http.StatusOK
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/user":
+				w.Write([]byte(user))
+			case "/user/teams":
+				w.Write([]byte(`[]`))
+			case "/user/emails":
+				w.WriteHeader(emailsStatus)
+				w.Write([]byte(emails))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		provider := &SocialGithub{
+			SocialBase: &SocialBase{log: log.New("oauth.github")},
+			apiUrl:     server.URL + "/user",
+		}
+
+		Convey("Should use the public primary verified email for commits", func() {
+			emails = `[
+				{"email": "octocat@example.com", "primary": false, "verified": true, "visibility": null},
+				{"email": "octocat@github.com", "primary": true, "verified": true, "visibility": "public"}
+			]`
+
+			userInfo, err := provider.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Email, ShouldEqual, "octocat@github.com")
+			So(userInfo.VerifiedEmail, ShouldEqual, "octocat@github.com")
+		})
+
+		Convey("Should not use unverified emails for commits", func() {
+			emails = `[{"email": "octocat@github.com", "primary": true, "verified": false, "visibility": "public"}]`
+
+			userInfo, err := provider.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Email, ShouldEqual, "octocat@github.com")
+			So(userInfo.VerifiedEmail, ShouldEqual, "1234+octocat@noreply."+serverHostname(server))
+		})
+
+		Convey("Should use the noreply address when the emails are private", func() {
+			provider.apiUrl = "https://api.github.com/user"
+			records := []GithubEmail{{Email: "octocat@github.com", Primary: true, Verified: true, Visibility: "private"}}
+
+			So(provider.verifiedEmail(records, 1234, "octocat"), ShouldEqual, "1234+octocat@users.noreply.github.com")
+		})
+
+		Convey("Should keep the public profile email when the emails cannot be read", func() {
+			user = `{"id": 1234, "login": "octocat", "email": "octocat@github.com"}`
+			emailsStatus = http.StatusForbidden
+
+			userInfo, err := provider.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Email, ShouldEqual, "octocat@github.com")
+			So(userInfo.VerifiedEmail, ShouldEqual, "1234+octocat@noreply."+serverHostname(server))
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+// githubPagesServer serves the teams and organizations of a user in pages of one record, with the Link headers of
+// the GitHub API. Pages listed in failures answer with that status.
+type githubPagesServer struct {
+	*httptest.Server
+	pages    int
+	delay    time.Duration
+	failures map[string]int
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newGithubPagesServer(pages int) *githubPagesServer {
+	s := &githubPagesServer{pages: pages, failures: map[string]int{}, requests: map[string]int{}}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+
+		s.mu.Lock()
+		s.requests[r.URL.Path+"?"+page]++
+		status := s.failures[page]
+		s.mu.Unlock()
+
+		time.Sleep(s.delay)
+
+		if status != 0 {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+			return
+		}
+
+		number, _ := strconv.Atoi(page)
+		link := func(rel string, page int) string {
+			return fmt.Sprintf(`<%s%s?per_page=100&page=%d>; rel="%s"`, s.URL, r.URL.Path, page, rel)
+		}
+		if number < s.pages {
+			w.Header().Set("Link", link("next", number+1)+", "+link("last", s.pages))
+		}
+
+		switch r.URL.Path {
+		case "/user/teams":
+			fmt.Fprintf(w, `[{"id": %d, "slug": "team-%d", "html_url": "https://github.com/orgs/org/teams/team-%d", "organization": {"login": "org"}}]`, number, number, number)
+		case "/user/orgs":
+			fmt.Fprintf(w, `[{"login": "org-%d"}]`, number)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return s
+}
+
+func (s *githubPagesServer) requested(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for page := 1; page <= s.pages; page++ {
+		count += s.requests[path+"?"+strconv.Itoa(page)]
+	}
+	return count
+}
+
+func TestGithubPages(t *testing.T) {
+	Convey("Given a user in many teams and organizations", t, func() {
+		server := newGithubPagesServer(6)
+
+		provider := &SocialGithub{
+			SocialBase:       &SocialBase{log: log.New("oauth.github")},
+			apiUrl:           server.URL + "/user",
+			fetchConcurrency: 3,
+		}
+
+		Convey("Should return the teams of all pages in page order", func() {
+			teams, err := provider.FetchTeamMemberships(context.Background(), server.Client())
+			So(err, ShouldBeNil)
+			So(teams, ShouldHaveLength, 6)
+			for i, team := range teams {
+				So(team.Id, ShouldEqual, i+1)
+			}
+			So(server.requested("/user/teams"), ShouldEqual, 6)
+		})
+
+		Convey("Should return the organizations of all pages in page order", func() {
+			organizations, err := provider.FetchOrganizations(context.Background(), server.Client())
+			So(err, ShouldBeNil)
+			So(organizations, ShouldResemble, []string{"org-1", "org-2", "org-3", "org-4", "org-5", "org-6"})
+		})
+
+		Convey("Should fail when a page fails", func() {
+			server.failures["4"] = http.StatusInternalServerError
+
+			_, err := provider.FetchTeamMemberships(context.Background(), server.Client())
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should stop fetching pages after an auth error", func() {
+			provider.fetchConcurrency = 1
+			server.failures["2"] = http.StatusUnauthorized
+
+			_, err := provider.FetchTeamMemberships(context.Background(), server.Client())
+			So(err, ShouldNotBeNil)
+			So(server.requested("/user/teams"), ShouldEqual, 2)
+		})
+
+		Convey("Should fail once the deadline of the login passes", func() {
+			server.delay = 50 * time.Millisecond
+
+			ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+			defer cancel()
+
+			_, err := provider.FetchTeamMemberships(ctx, server.Client())
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should follow the next links when there is no last link", func() {
+			pages := map[string]string{"/teams": "/teams2", "/teams2": ""}
+			linked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if next := pages[r.URL.Path]; next != "" {
+					w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next))
+				}
+				fmt.Fprintf(w, `[{"id": %d}]`, len(r.URL.Path))
+			}))
+			defer linked.Close()
+
+			provider.apiUrl = linked.URL
+			teams, err := provider.FetchTeamMemberships(context.Background(), linked.Client())
+			So(err, ShouldBeNil)
+			So(teams, ShouldHaveLength, 2)
+		})
+
+		Convey("Should truncate lists longer than the max pages", func() {
+			provider.fetchMaxPages = 4
+
+			teams, err := provider.FetchTeamMemberships(context.Background(), server.Client())
+			So(err, ShouldBeNil)
+			So(teams, ShouldHaveLength, 4)
+			So(server.requested("/user/teams"), ShouldEqual, 4)
+		})
+
+		Convey("Should only build the urls of the pages up to the max pages", func() {
+			urls, pages, err := githubPageUrls("https://api.github.com/user/teams?per_page=100&page=2000000000", 3)
+			So(err, ShouldBeNil)
+			So(pages, ShouldEqual, 2000000000)
+			So(urls, ShouldResemble, []string{
+				"https://api.github.com/user/teams?page=2&per_page=100",
+				"https://api.github.com/user/teams?page=3&per_page=100",
+			})
+		})
+
+		Convey("Should stop following the next links at the max pages", func() {
+			pages := map[string]string{"/teams": "/teams2", "/teams2": "/teams3", "/teams3": ""}
+			linked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if next := pages[r.URL.Path]; next != "" {
+					w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next))
+				}
+				fmt.Fprintf(w, `[{"id": %d}]`, len(r.URL.Path))
+			}))
+			defer linked.Close()
+
+			provider.apiUrl = linked.URL
+			provider.fetchMaxPages = 2
+			teams, err := provider.FetchTeamMemberships(context.Background(), linked.Client())
+			So(err, ShouldBeNil)
+			So(teams, ShouldHaveLength, 2)
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+// BenchmarkGithubTeamPages compares fetching the pages of a user in 10 pages of teams one after the other and
+// concurrently, with a latency of 10ms per page
+func BenchmarkGithubTeamPages(b *testing.B) {
+	server := newGithubPagesServer(10)
+	server.delay = 10 * time.Millisecond
+	defer server.Close()
+
+	for _, workers := range []int{1, 4} {
+		provider := &SocialGithub{apiUrl: server.URL + "/user", fetchConcurrency: workers}
+
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := provider.FetchTeamMemberships(context.Background(), server.Client()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func serverHostname(server *httptest.Server) string {
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	return req.URL.Hostname()
+}
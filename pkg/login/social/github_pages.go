@@ -0,0 +1,198 @@
+package social
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+var githubLinkPattern = regexp.MustCompile(`<([^>]+)>; rel="(next|last)"`)
+
+// githubPageError is a request, e.g. for a page of a list, the GitHub API answered with an error status
+type githubPageError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *githubPageError) Error() string {
+	return fmt.Sprintf("GitHub API returned %d: %s", e.StatusCode, e.Body)
+}
+
+// fetchPages returns the bodies of the pages of a GitHub list, in page order. GitHub numbers the pages, so once
+// the first page tells the last one in its Link header, the other pages are fetched concurrently by up to
+// fetchConcurrency workers. The first error, e.g. a revoked token, cancels the pages not fetched yet. Lists longer
+// than fetchMaxPages are truncated to their first pages.
+func (s *SocialGithub) fetchPages(ctx context.Context, client *http.Client, firstUrl string) ([][]byte, error) {
+	body, headers, err := githubGet(ctx, client, firstUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := [][]byte{body}
+	links := githubLinks(headers)
+
+	if links["last"] == "" {
+		// without a last page, follow the next links
+		for next := links["next"]; next != ""; next = githubLinks(headers)["next"] {
+			if s.fetchMaxPages > 0 && len(bodies) == s.fetchMaxPages {
+				s.log.Warn("GitHub list truncated", "url", firstUrl, "maxPages", s.fetchMaxPages)
+				break
+			}
+
+			if body, headers, err = githubGet(ctx, client, next); err != nil {
+				return nil, err
+			}
+			bodies = append(bodies, body)
+		}
+		return bodies, nil
+	}
+
+	urls, pages, err := githubPageUrls(links["last"], s.fetchMaxPages)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(urls) < pages-1 {
+		s.log.Warn("GitHub list truncated", "url", firstUrl, "pages", pages, "maxPages", s.fetchMaxPages)
+	}
+	if len(urls) == 0 {
+		return bodies, nil
+	}
+
+	rest, err := s.fetchPagesConcurrently(ctx, client, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(bodies, rest...), nil
+}
+
+func (s *SocialGithub) fetchPagesConcurrently(ctx context.Context, client *http.Client, urls []string) ([][]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := s.fetchConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(urls) {
+		workers = len(urls)
+	}
+
+	bodies := make([][]byte, len(urls))
+	jobs := make(chan int)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				body, _, err := githubGet(ctx, client, urls[page])
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				bodies[page] = body
+			}
+		}()
+	}
+
+feed:
+	for page := range urls {
+		select {
+		case jobs <- page:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// the deadline of the login may pass before a worker picks the next page
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return bodies, nil
+}
+
+func githubGet(ctx context.Context, client *http.Client, url string) ([]byte, http.Header, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, nil, &githubPageError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return body, resp.Header, nil
+}
+
+// githubLinks returns the next and last links of the Link header of a page
+func githubLinks(headers http.Header) map[string]string {
+	links := make(map[string]string)
+	for _, match := range githubLinkPattern.FindAllStringSubmatch(headers.Get("Link"), -1) {
+		links[match[2]] = match[1]
+	}
+	return links
+}
+
+// githubPageUrls returns the urls of the pages from the second one to the last one, along with the number of pages
+// of the list. When maxPages is set, the urls stop at that page, whatever the last page GitHub links to.
+func githubPageUrls(last string, maxPages int) ([]string, int, error) {
+	lastUrl, err := url.Parse(last)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := lastUrl.Query()
+	lastPage, err := strconv.Atoi(query.Get("page"))
+	if err != nil || lastPage < 2 {
+		return nil, 0, fmt.Errorf("Invalid last page link from GitHub API: %s", last)
+	}
+
+	fetched := lastPage
+	if maxPages > 0 && fetched > maxPages {
+		fetched = maxPages
+	}
+
+	urls := make([]string, 0, fetched-1)
+	for page := 2; page <= fetched; page++ {
+		query.Set("page", strconv.Itoa(page))
+		pageUrl := *lastUrl
+		pageUrl.RawQuery = query.Encode()
+		urls = append(urls, pageUrl.String())
+	}
+
+	return urls, lastPage, nil
+}
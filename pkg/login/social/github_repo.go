@@ -0,0 +1,209 @@
+package social
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// defaultGithubRepoUrl is the API of github.com, GitHub Enterprise repositories set the url of their API, e.g.
+// https://github.example.com/api/v3
+const defaultGithubRepoUrl = "https://api.github.com"
+
+// githubRepoClient sends the requests to the contents API of repositories, tests replace it
+var githubRepoClient = &http.Client{Timeout: 30 * time.Second}
+
+// GrafanaGithubRepo is a GitHub repository dashboards of an organization are committed to
+type GrafanaGithubRepo struct {
+	// Name is the name of the settings section, dashboards can select the repository by it
+	Name           string
+	OrgId          int64
+	RepoId         int
+	Branch         string
+	DashboardsPath string
+	// Url is the API the repository is reached through, defaultGithubRepoUrl when not set
+	Url    string
+	WebUrl string
+}
+
+// githubFileCommit is the body of the requests creating, updating and deleting a file with the contents API
+type githubFileCommit struct {
+	Message string `json:"message"`
+	Content string `json:"content,omitempty"`
+	Sha     string `json:"sha,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+}
+
+func (repo *GrafanaGithubRepo) dashboardFilePath(folder string, name string) string {
+	return DashboardFilePath(repo.DashboardsPath, folder, name)
+}
+
+// contentsUrl returns the url of a file of the repository in the contents API
+func (repo *GrafanaGithubRepo) contentsUrl(filePath string) string {
+	segments := strings.Split(strings.Trim(filePath, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	apiUrl := repo.Url
+	if apiUrl == "" {
+		apiUrl = defaultGithubRepoUrl
+	}
+	return fmt.Sprintf("%s/repositories/%d/contents/%s", strings.TrimSuffix(apiUrl, "/"), repo.RepoId, strings.Join(segments, "/"))
+}
+
+// getDashboardRepo returns the repository a dashboard selects by name or id, or the repository of the organization.
+// Dashboards can only select repositories configured for their organization.
+func (s *SocialGithub) getDashboardRepo(orgId int64, name string) (*GrafanaGithubRepo, error) {
+	for _, repo := range s.repos {
+		if repo.OrgId != orgId {
+			continue
+		}
+		if name == "" || repo.Name == name || strconv.Itoa(repo.RepoId) == name {
+			return repo, nil
+		}
+	}
+
+	if name != "" {
+		return nil, models.ErrDashboardGitRepoNotFound
+	}
+	return nil, nil
+}
+
+// UpdateDashboard commits the dashboard change to the repository the dashboard selects with the contents API,
+// which changes a single file per commit: creates and updates put the file, deletes delete it. The file is read
+// first, as GitHub needs its blob sha to change it, so like the fallbacks of GitLab commits a create of an
+// existing file updates it, an update of a missing file creates it and a delete of a missing file is skipped.
+func (s *SocialGithub) UpdateDashboard(options *UpdateDashboardOptions, token string) error {
+	repo, err := s.getDashboardRepo(options.OrgId, options.Repo)
+	if err != nil || repo == nil {
+		return err
+	}
+
+	// the repositories do not allow branch overrides
+	if options.Branch != "" {
+		return models.ErrDashboardGitBranchNotAllowed
+	}
+
+	message := createCommitMessage(options, nil)
+	filePath := repo.dashboardFilePath(options.Folder, options.Name)
+	contentsUrl := repo.contentsUrl(filePath)
+
+	sha, err := githubFileSha(contentsUrl, repo.Branch, token)
+	if err != nil {
+		s.log.Error("Failed to check dashboard file in repository", "path", filePath, "error", err)
+		return models.ErrDashboardGitlabSync
+	}
+
+	result := &DashboardSyncResult{FilePath: filePath, CommitMode: models.GitCommitModeUser, RepoId: repo.RepoId}
+	commit := &githubFileCommit{Message: message, Sha: sha, Branch: repo.Branch}
+	method := "PUT"
+
+	switch {
+	case options.Action == DeleteDashboard && sha == "":
+		s.log.Warn("Dashboard file already deleted from repository", "path", filePath)
+		result.FallbackAction = models.GitFallbackSkipDelete
+		options.Result = result
+		return nil
+	case options.Action == DeleteDashboard:
+		method = "DELETE"
+	case options.Action == CreateDashboard && sha != "":
+		result.FallbackAction = models.GitFallbackUpdate
+	case options.Action == UpdateDashboard && sha == "":
+		result.FallbackAction = models.GitFallbackCreate
+	}
+
+	var content string
+	if method == "PUT" {
+		content = formatDashboardJson(options.Dashboard, "", false)
+		commit.Content = base64.StdEncoding.EncodeToString([]byte(content))
+		result.ContentHash = contentHash(content)
+	}
+
+	var response struct {
+		Commit struct {
+			Sha string `json:"sha"`
+		} `json:"commit"`
+	}
+	if err := githubRepoRequest(method, contentsUrl, token, commit, &response); err != nil {
+		s.log.Error("Failed to commit dashboard", "path", filePath, "action", options.Action, "error", err)
+		return models.ErrDashboardGitlabSync
+	}
+
+	result.CommitSha = response.Commit.Sha
+	options.Result = result
+	return nil
+}
+
+// githubFileSha returns the blob sha of a file on the branch, empty when the file does not exist
+func githubFileSha(contentsUrl string, branch string, token string) (string, error) {
+	if branch != "" {
+		contentsUrl += "?ref=" + url.QueryEscape(branch)
+	}
+
+	var file struct {
+		Sha string `json:"sha"`
+	}
+	err := githubRepoRequest("GET", contentsUrl, token, nil, &file)
+	if pageErr, ok := err.(*githubPageError); ok && pageErr.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	return file.Sha, err
+}
+
+// githubRepoRequest sends a request authenticated with the token of the user to the API of a repository and
+// decodes the json response into result
+func githubRepoRequest(method string, requestUrl string, token string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, requestUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Authorization", "token "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := githubRepoClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return &githubPageError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return json.Unmarshal(respBody, result)
+}
+
+func (s *SocialGithub) SyncRepo(orgId int64) *SyncRepo {
+	repo, _ := s.getDashboardRepo(orgId, "")
+	if repo == nil {
+		return nil
+	}
+
+	return &SyncRepo{Provider: "github", Name: repo.Name, WebUrl: repo.WebUrl, RepoId: repo.RepoId}
+}
@@ -0,0 +1,254 @@
+package social
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	ini "gopkg.in/ini.v1"
+)
+
+func TestGithubUpdateDashboard(t *testing.T) {
+	Convey("Given a GitHub repository", t, func() {
+		// files are the blob shas of the files on the branch
+		files := map[string]string{}
+		var requests []string
+		var authorizations []string
+		var commits []githubFileCommit
+		failCommits := false
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			filePath := strings.TrimPrefix(r.URL.Path, "/api/v3/repositories/42/contents/")
+			if filePath == r.URL.Path {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			requests = append(requests, r.Method+" "+filePath)
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+
+			if r.Method == "GET" {
+				sha, ok := files[filePath]
+				if !ok || r.URL.Query().Get("ref") != "main" {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message": "Not Found"}`))
+					return
+				}
+				w.Write([]byte(`{"type": "file", "path": "` + filePath + `", "sha": "` + sha + `"}`))
+				return
+			}
+
+			var commit githubFileCommit
+			if err := json.NewDecoder(r.Body).Decode(&commit); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if failCommits {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"message": "main is at 3a0f86f but expected 9b2e1c4"}`))
+				return
+			}
+			commits = append(commits, commit)
+
+			switch r.Method {
+			case "PUT":
+				files[filePath] = "7d3e2a1"
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"content": {"path": "` + filePath + `", "sha": "7d3e2a1"}, "commit": {"sha": "e83c5163316f89bfbde7d9ab23ca2e25604af290"}}`))
+			case "DELETE":
+				delete(files, filePath)
+				w.Write([]byte(`{"content": null, "commit": {"sha": "b5a9a7e24ec6dcb0cb14d49c2d2f2cc0d7b46e52"}}`))
+			}
+		}))
+
+		repo := &GrafanaGithubRepo{
+			Name:           "ops",
+			OrgId:          1,
+			RepoId:         42,
+			Branch:         "main",
+			DashboardsPath: "dashboards",
+			Url:            server.URL + "/api/v3",
+		}
+
+		connector := &SocialGithub{
+			SocialBase: &SocialBase{log: log.New("oauth.github")},
+			repos:      []*GrafanaGithubRepo{repo},
+		}
+
+		updateDashboard := func(action DashboardAction) (*UpdateDashboardOptions, error) {
+			options := &UpdateDashboardOptions{
+				Action:    action,
+				Message:   "Add the latency panel",
+				Title:     "Service",
+				Name:      "service",
+				Uid:       "service",
+				Dashboard: `{"title":"Service","panels":[]}`,
+				Folder:    "Team",
+				OrgId:     1,
+			}
+			return options, connector.UpdateDashboard(options, "gho_token")
+		}
+
+		Convey("Should put a new dashboard file", func() {
+			options, err := updateDashboard(CreateDashboard)
+			So(err, ShouldBeNil)
+
+			So(requests, ShouldResemble, []string{"GET dashboards/Team/service.json", "PUT dashboards/Team/service.json"})
+			So(authorizations, ShouldResemble, []string{"token gho_token", "token gho_token"})
+			So(commits, ShouldHaveLength, 1)
+			So(commits[0].Message, ShouldEqual, "Create Service dashboard")
+			So(commits[0].Branch, ShouldEqual, "main")
+			So(commits[0].Sha, ShouldBeEmpty)
+
+			content, err := base64.StdEncoding.DecodeString(commits[0].Content)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "{\n  \"title\": \"Service\",\n  \"panels\": []\n}")
+
+			So(options.Result, ShouldResemble, &DashboardSyncResult{
+				CommitSha:   "e83c5163316f89bfbde7d9ab23ca2e25604af290",
+				FilePath:    "dashboards/Team/service.json",
+				CommitMode:  models.GitCommitModeUser,
+				RepoId:      42,
+				ContentHash: contentHash(string(content)),
+			})
+		})
+
+		Convey("Should update an existing dashboard file with its sha", func() {
+			files["dashboards/Team/service.json"] = "1f2e3d4"
+
+			options, err := updateDashboard(UpdateDashboard)
+			So(err, ShouldBeNil)
+			So(commits, ShouldHaveLength, 1)
+			So(commits[0].Message, ShouldEqual, "Update Service dashboard\n\nAdd the latency panel")
+			So(commits[0].Sha, ShouldEqual, "1f2e3d4")
+			So(options.Result.FallbackAction, ShouldBeEmpty)
+		})
+
+		Convey("Should update the file a create finds in the repository", func() {
+			files["dashboards/Team/service.json"] = "1f2e3d4"
+
+			options, err := updateDashboard(CreateDashboard)
+			So(err, ShouldBeNil)
+			So(commits[0].Sha, ShouldEqual, "1f2e3d4")
+			So(options.Result.FallbackAction, ShouldEqual, models.GitFallbackUpdate)
+		})
+
+		Convey("Should create the file an update does not find in the repository", func() {
+			options, err := updateDashboard(UpdateDashboard)
+			So(err, ShouldBeNil)
+			So(commits[0].Sha, ShouldBeEmpty)
+			So(options.Result.FallbackAction, ShouldEqual, models.GitFallbackCreate)
+			So(files, ShouldContainKey, "dashboards/Team/service.json")
+		})
+
+		Convey("Should delete the dashboard file", func() {
+			files["dashboards/Team/service.json"] = "1f2e3d4"
+
+			options, err := updateDashboard(DeleteDashboard)
+			So(err, ShouldBeNil)
+			So(requests, ShouldResemble, []string{"GET dashboards/Team/service.json", "DELETE dashboards/Team/service.json"})
+			So(commits[0], ShouldResemble, githubFileCommit{Message: "Delete Service dashboard", Sha: "1f2e3d4", Branch: "main"})
+			So(options.Result.CommitSha, ShouldEqual, "b5a9a7e24ec6dcb0cb14d49c2d2f2cc0d7b46e52")
+			So(files, ShouldBeEmpty)
+		})
+
+		Convey("Should skip the delete of a file already deleted from the repository", func() {
+			options, err := updateDashboard(DeleteDashboard)
+			So(err, ShouldBeNil)
+			So(requests, ShouldResemble, []string{"GET dashboards/Team/service.json"})
+			So(options.Result.CommitSha, ShouldBeEmpty)
+			So(options.Result.FallbackAction, ShouldEqual, models.GitFallbackSkipDelete)
+		})
+
+		Convey("Should fail the sync when GitHub rejects the commit", func() {
+			failCommits = true
+
+			options, err := updateDashboard(UpdateDashboard)
+			So(err, ShouldEqual, models.ErrDashboardGitlabSync)
+			So(options.Result, ShouldBeNil)
+		})
+
+		Convey("Should escape the path of the file", func() {
+			options := &UpdateDashboardOptions{Action: CreateDashboard, Title: "Q&A", Name: "q-a", Folder: "R&D #1", OrgId: 1, Dashboard: `{}`}
+			So(connector.UpdateDashboard(options, "gho_token"), ShouldBeNil)
+			So(options.Result.FilePath, ShouldEqual, "dashboards/R&D #1/q-a.json")
+			So(files, ShouldContainKey, "dashboards/R&D #1/q-a.json")
+		})
+
+		Convey("Should select the repository of the dashboard by name or id", func() {
+			options := &UpdateDashboardOptions{Action: CreateDashboard, Title: "Service", Name: "service", OrgId: 1, Repo: "42", Dashboard: `{}`}
+			So(connector.UpdateDashboard(options, "gho_token"), ShouldBeNil)
+			So(options.Result.RepoId, ShouldEqual, 42)
+
+			options.Repo = "infra"
+			So(connector.UpdateDashboard(options, "gho_token"), ShouldEqual, models.ErrDashboardGitRepoNotFound)
+		})
+
+		Convey("Should not allow branch overrides", func() {
+			options := &UpdateDashboardOptions{Action: UpdateDashboard, Title: "Service", Name: "service", OrgId: 1, Branch: "preview/login"}
+			So(connector.UpdateDashboard(options, "gho_token"), ShouldEqual, models.ErrDashboardGitBranchNotAllowed)
+			So(requests, ShouldBeEmpty)
+		})
+
+		Convey("Should not commit the dashboards of organizations without repository", func() {
+			options := &UpdateDashboardOptions{Action: CreateDashboard, Title: "Service", Name: "service", OrgId: 2}
+			So(connector.UpdateDashboard(options, "gho_token"), ShouldBeNil)
+			So(options.Result, ShouldBeNil)
+			So(requests, ShouldBeEmpty)
+
+			So(connector.SyncRepo(2), ShouldBeNil)
+			So(connector.SyncRepo(1), ShouldResemble, &SyncRepo{Provider: "github", Name: "ops", RepoId: 42})
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestGithubRepoSettings(t *testing.T) {
+	Convey("Given GitHub repositories in the settings", t, func() {
+		origRaw := setting.Raw
+		setting.Raw = ini.Empty()
+
+		sec := setting.Raw.Section("auth.github")
+		ops := setting.Raw.Section("auth.github.repo.ops")
+		ops.Key("org_id").SetValue("1")
+		ops.Key("repo_id").SetValue("42")
+		ops.Key("branch").SetValue("main")
+		ops.Key("dashboards_path").SetValue("dashboards")
+		ops.Key("web_url").SetValue("https://github.com/example/dashboards")
+
+		insecure := setting.Raw.Section("auth.github.repo.insecure")
+		insecure.Key("org_id").SetValue("2")
+		insecure.Key("repo_id").SetValue("43")
+		insecure.Key("url").SetValue("http://github.example.com/api/v3")
+
+		connector := newConnector("github", &setting.OAuthInfo{}, sec).(*SocialGithub)
+
+		Convey("Should configure the valid repositories", func() {
+			So(connector.repos, ShouldResemble, []*GrafanaGithubRepo{{
+				Name:           "ops",
+				OrgId:          1,
+				RepoId:         42,
+				Branch:         "main",
+				DashboardsPath: "dashboards",
+				WebUrl:         "https://github.com/example/dashboards",
+			}})
+			So(connector.Capabilities().DashboardSync, ShouldBeTrue)
+			So(connector.repos[0].contentsUrl("dashboards/General/home.json"), ShouldEqual,
+				"https://api.github.com/repositories/42/contents/dashboards/General/home.json")
+		})
+
+		Reset(func() {
+			setting.Raw = origRaw
+		})
+	})
+}
@@ -0,0 +1,207 @@
+package social
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/xanzy/go-gitlab"
+)
+
+// UpdateDashboards commits the dashboard changes to the repository in a single commit, then each change to the
+// mirrors of the repository. The file actions always follow the files on the branch, deleting a missing file is
+// skipped, and a change to a file changed in the repository since its last sync skips or fails the whole commit
+// depending on the conflict policy of the repository.
+func (s *SocialGitlab) UpdateDashboards(options []*UpdateDashboardOptions, token string) error {
+	if len(options) == 0 {
+		return nil
+	}
+
+	first := options[0]
+	for _, option := range options[1:] {
+		if option.OrgId != first.OrgId || option.Repo != first.Repo || option.Branch != first.Branch {
+			return fmt.Errorf("Dashboards of a batch must be committed to the same repository and branch")
+		}
+	}
+
+	repo, mirrors, err := s.getDashboardRepoAndMirrors(first.OrgId, first.Repo)
+	if err != nil {
+		return err
+	}
+
+	if err := s.commitDashboards(repo, options, token); err != nil {
+		return err
+	}
+
+	// commits to an overridden branch and skipped commits are not mirrored
+	if first.Branch != "" {
+		return nil
+	}
+
+	for _, option := range options {
+		if option.Result == nil || option.Result.CommitSha == "" {
+			continue
+		}
+		for _, mirror := range mirrors {
+			option.Result.Mirrors = append(option.Result.Mirrors, s.mirrorDashboard(mirror, option, token))
+		}
+	}
+
+	return nil
+}
+
+func (s *SocialGitlab) commitDashboards(repo *GrafanaGitlabRepo, options []*UpdateDashboardOptions, token string) error {
+	var err error
+	first := options[0]
+	if first.Branch != "" {
+		if repo, err = repo.withBranchOverride(first.Branch); err != nil {
+			return err
+		}
+	}
+
+	git := newDashboardCommitClient(repo, token)
+	deletes := make([]*gitlab.CommitAction, 0)
+	writes := make([]*gitlab.CommitAction, 0)
+	snapshots := make([]*gitlab.CommitAction, 0)
+	committed := make([]*UpdateDashboardOptions, 0, len(options))
+	contents := make(map[*UpdateDashboardOptions]string)
+
+	for _, option := range options {
+		filePath := repo.dashboardFilePath(option.Folder, option.Name)
+		content := repo.formatDashboard(option.Dashboard)
+
+		existing, err := resolveFileAction(git, repo, filePath, gitlab.FileUpdate)
+		if err != nil {
+			s.log.Error("Failed to check dashboard file in repository", "path", filePath, "error", err)
+			return models.ErrDashboardGitlabSync
+		}
+
+		action := s.getGitlabAction(option.Action)
+		if action == gitlab.FileDelete && existing == gitlab.FileCreate {
+			s.log.Warn("Dashboard file already deleted from repository", "path", filePath)
+			option.Result = &DashboardSyncResult{
+				FilePath:       filePath,
+				RepoId:         repo.RepoId,
+				Branch:         option.Branch,
+				FallbackAction: models.GitFallbackSkipDelete,
+			}
+			continue
+		}
+		if action != gitlab.FileDelete {
+			action = existing
+		}
+
+		if action == gitlab.FileUpdate && repo.detectsConflicts() {
+			foreign, err := foreignCommit(git, repo, filePath, option)
+			if err != nil {
+				s.log.Error("Failed to check dashboard file for changes in repository", "path", filePath, "error", err)
+				return models.ErrDashboardGitlabSync
+			}
+
+			if foreign != "" {
+				s.log.Warn("Dashboard file changed in repository since last sync", "path", filePath, "commit", foreign, "policy", repo.ConflictPolicy)
+				if repo.ConflictPolicy == models.GitConflictFail {
+					return models.ErrDashboardGitConflict
+				}
+
+				option.Result = &DashboardSyncResult{
+					FilePath:          filePath,
+					RepoId:            repo.RepoId,
+					Branch:            option.Branch,
+					ConflictCommitSha: foreign,
+				}
+				continue
+			}
+		}
+
+		// deletes come first, so a dashboard can move to the previous path of another one
+		commitAction := &gitlab.CommitAction{Action: action, Content: content, FilePath: filePath}
+		if action == gitlab.FileDelete {
+			deletes = append(deletes, commitAction)
+		} else {
+			writes = append(writes, commitAction)
+		}
+
+		if repo.AuditBranch != "" {
+			snapshots = append(snapshots, &gitlab.CommitAction{Action: gitlab.FileCreate, Content: content, FilePath: repo.auditFilePath(option)})
+		}
+
+		committed = append(committed, option)
+		contents[option] = content
+	}
+
+	if len(committed) == 0 {
+		return nil
+	}
+
+	summary := batchCommitOptions(repo, committed)
+	message := createCommitMessage(summary, repo.CommitFooter)
+	commit := &gitlab.CreateCommitOptions{
+		Branch:        &repo.Branch,
+		CommitMessage: &message,
+		Actions:       append(deletes, writes...),
+	}
+
+	// snapshots are always created, so an existing snapshot fails the commit rather than being overwritten
+	if repo.AuditBranch == repo.Branch {
+		commit.Actions = append(commit.Actions, snapshots...)
+		snapshots = nil
+	}
+
+	result, mode, err := s.createDashboardCommit(git, repo, commit, summary)
+	if err != nil {
+		s.log.Error("Failed to commit dashboards", "count", len(committed), "mode", mode, "error", err)
+		return models.ErrDashboardGitlabSync
+	}
+
+	// the dashboards are already committed, failing snapshots do not fail the save
+	if len(snapshots) > 0 {
+		auditCommit := &gitlab.CreateCommitOptions{
+			Branch:        &repo.AuditBranch,
+			CommitMessage: &message,
+			Actions:       snapshots,
+		}
+		if _, mode, err := s.createDashboardCommit(git, repo, auditCommit, summary); err != nil {
+			s.log.Error("Failed to commit dashboard snapshots", "branch", repo.AuditBranch, "mode", mode, "error", err)
+		}
+	}
+
+	for _, option := range committed {
+		option.Result = &DashboardSyncResult{
+			CommitSha:   result.ID,
+			FilePath:    repo.dashboardFilePath(option.Folder, option.Name),
+			CommitMode:  mode,
+			RepoId:      repo.RepoId,
+			Branch:      option.Branch,
+			ContentHash: contentHash(contents[option]),
+		}
+	}
+
+	return nil
+}
+
+// batchCommitOptions describes the commit of several dashboards, for the commit message and the identity the
+// commit is made with. The footer has no dashboard uid, and the co-authors of all changes are credited.
+func batchCommitOptions(repo *GrafanaGitlabRepo, options []*UpdateDashboardOptions) *UpdateDashboardOptions {
+	first := options[0]
+	summary := &UpdateDashboardOptions{
+		Source:           first.Source,
+		OrgId:            first.OrgId,
+		UserId:           first.UserId,
+		Repo:             first.Repo,
+		Branch:           first.Branch,
+		Author:           first.Author,
+		UserLogin:        first.UserLogin,
+		ExternalIdentity: first.ExternalIdentity,
+		batch:            options,
+	}
+
+	if repo.RequestIdTrailer {
+		summary.RequestId = first.RequestId
+	}
+
+	for _, option := range options {
+		summary.Coauthors = append(summary.Coauthors, option.Coauthors...)
+	}
+
+	return summary
+}
@@ -0,0 +1,162 @@
+package social
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGitlabBatchUpdate(t *testing.T) {
+	Convey("Given a GitLab repository mirrored to another repository", t, func() {
+		existingFiles := map[string]map[string]bool{"1": {}, "2": {}}
+		type commit struct {
+			project string
+			message string
+			actions []string
+		}
+		var commits []commit
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.Split(r.URL.Path, "/")
+			if len(parts) < 5 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			project := parts[4]
+
+			switch {
+			case r.Method == "HEAD" && strings.Contains(r.URL.Path, "/repository/files/"):
+				filePath := r.URL.Path[strings.Index(r.URL.Path, "/repository/files/")+len("/repository/files/"):]
+				if !existingFiles[project][filePath] {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("X-Gitlab-Last-Commit-Id", "foreign")
+				w.WriteHeader(http.StatusOK)
+
+			case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/repository/commits"):
+				var body struct {
+					CommitMessage string `json:"commit_message"`
+					Actions       []struct {
+						Action   string `json:"action"`
+						FilePath string `json:"file_path"`
+					} `json:"actions"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				c := commit{project: project, message: body.CommitMessage}
+				for _, action := range body.Actions {
+					c.actions = append(c.actions, action.Action+" "+action.FilePath)
+				}
+				commits = append(commits, c)
+
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id": "sha-` + project + `"}`))
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		current := &GrafanaGitlabRepo{Name: "current", OrgId: 1, RepoId: 1, Branch: "master", DashboardsPath: "dashboards", Url: server.URL, Mirrors: []string{"next"}, CommitFooter: []string{FooterDashboardUid, FooterOrgId}}
+		next := &GrafanaGitlabRepo{Name: "next", OrgId: 1, RepoId: 2, Branch: "main", DashboardsPath: "dashboards", Url: server.URL}
+		repos := []*GrafanaGitlabRepo{current, next}
+
+		logger := log.New("oauth.gitlab")
+		connector := &SocialGitlab{
+			SocialBase: &SocialBase{log: logger},
+			repos:      repos,
+			mirrors:    resolveRepoMirrors(repos, logger),
+		}
+
+		change := func(action DashboardAction, title string, folder string) *UpdateDashboardOptions {
+			return &UpdateDashboardOptions{
+				Action:    action,
+				Title:     title,
+				Name:      strings.ToLower(title),
+				Uid:       strings.ToLower(title),
+				Folder:    folder,
+				Dashboard: "{}",
+				OrgId:     1,
+				Message:   "Reorganize dashboards",
+			}
+		}
+
+		Convey("Should commit all changes at once, deletes first, then each change to the mirrors", func() {
+			existingFiles["1"]["dashboards/General/cpu.json"] = true
+			existingFiles["1"]["dashboards/Ops/memory.json"] = true
+
+			options := []*UpdateDashboardOptions{
+				change(UpdateDashboard, "CPU", "General"),
+				change(CreateDashboard, "Memory", "Infra"),
+				change(DeleteDashboard, "Memory", "Ops"),
+			}
+			So(connector.UpdateDashboards(options, "token"), ShouldBeNil)
+
+			So(commits, ShouldHaveLength, 3)
+			So(commits[0].project, ShouldEqual, "1")
+			So(commits[0].actions, ShouldResemble, []string{
+				"delete dashboards/Ops/memory.json",
+				"update dashboards/General/cpu.json",
+				"create dashboards/Infra/memory.json",
+			})
+			So(commits[0].message, ShouldEqual, "Save 3 dashboards\n\n"+
+				"Update CPU dashboard\nCreate Memory dashboard\nDelete Memory dashboard\n\n"+
+				"Reorganize dashboards\n\norg-id=1")
+
+			for _, option := range options {
+				So(option.Result.CommitSha, ShouldEqual, "sha-1")
+				So(option.Result.RepoId, ShouldEqual, 1)
+				So(option.Result.Mirrors, ShouldHaveLength, 1)
+			}
+			So(options[1].Result.FilePath, ShouldEqual, "dashboards/Infra/memory.json")
+			So(options[1].Result.ContentHash, ShouldNotBeEmpty)
+
+			// the mirror gets the changes one by one, the delete of a file it does not have is skipped
+			So(commits[1].project, ShouldEqual, "2")
+			So(commits[2].project, ShouldEqual, "2")
+		})
+
+		Convey("Should skip the delete of a missing file", func() {
+			options := []*UpdateDashboardOptions{
+				change(CreateDashboard, "CPU", "General"),
+				change(DeleteDashboard, "Memory", "Ops"),
+			}
+			So(connector.UpdateDashboards(options, "token"), ShouldBeNil)
+
+			So(commits[0].actions, ShouldResemble, []string{"create dashboards/General/cpu.json"})
+			So(options[1].Result.CommitSha, ShouldBeEmpty)
+			So(options[1].Result.FallbackAction, ShouldEqual, models.GitFallbackSkipDelete)
+		})
+
+		Convey("Should not commit changes to different branches together", func() {
+			other := change(CreateDashboard, "Memory", "Ops")
+			other.Branch = "feature"
+
+			err := connector.UpdateDashboards([]*UpdateDashboardOptions{change(CreateDashboard, "CPU", "General"), other}, "token")
+			So(err, ShouldNotBeNil)
+			So(commits, ShouldBeEmpty)
+		})
+
+		Convey("Should fail the whole commit on a conflict with the fail policy", func() {
+			current.ConflictPolicy = models.GitConflictFail
+			existingFiles["1"]["dashboards/General/cpu.json"] = true
+
+			cpu := change(UpdateDashboard, "CPU", "General")
+			cpu.LastSync = &models.DashboardGitSync{CommitSha: "old", FilePath: "dashboards/General/cpu.json"}
+
+			err := connector.UpdateDashboards([]*UpdateDashboardOptions{change(CreateDashboard, "Memory", "Ops"), cpu}, "token")
+			So(err, ShouldEqual, models.ErrDashboardGitConflict)
+			So(commits, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,135 @@
+package social
+
+import (
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// resolveRepoMirrors maps the repositories to the repositories their dashboard commits are mirrored to. Mirrors
+// are selected by name or id among the repositories of the same organization. A repository mirrors a single
+// repository and cannot have mirrors of its own, other references are logged and ignored.
+func resolveRepoMirrors(repos []*GrafanaGitlabRepo, logger log.Logger) map[*GrafanaGitlabRepo][]*GrafanaGitlabRepo {
+	mirrors := make(map[*GrafanaGitlabRepo][]*GrafanaGitlabRepo)
+	mirrored := make(map[*GrafanaGitlabRepo]bool)
+
+	for _, repo := range repos {
+		for _, name := range repo.Mirrors {
+			mirror := findRepo(repos, repo.OrgId, name)
+			switch {
+			case mirror == nil:
+				logger.Error("Ignoring unknown mirror of repository", "repo", repo.Name, "mirror", name)
+			case mirror == repo || len(mirror.Mirrors) > 0:
+				logger.Error("Ignoring mirror of repository, mirrors cannot have mirrors", "repo", repo.Name, "mirror", name)
+			case mirrored[mirror]:
+				logger.Error("Ignoring mirror of repository, it already mirrors another repository", "repo", repo.Name, "mirror", name)
+			default:
+				mirrors[repo] = append(mirrors[repo], mirror)
+				mirrored[mirror] = true
+			}
+		}
+	}
+
+	return mirrors
+}
+
+// isMirror tells whether the dashboard commits of another repository are mirrored to the repository. The caller
+// holds mirrorsMu.
+func (s *SocialGitlab) isMirror(repo *GrafanaGitlabRepo) bool {
+	for _, mirrors := range s.mirrors {
+		for _, mirror := range mirrors {
+			if mirror == repo {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mirrorDashboard commits the dashboard change to a mirror of the repository. The mirror can be behind the
+// repository, e.g. missing the files of dashboards not changed since it was added, so the file action follows
+// the file in the mirror. Conflicts are not checked and no snapshots are made. Failures are logged and returned
+// in the result, they never fail the change.
+func (s *SocialGitlab) mirrorDashboard(mirror *GrafanaGitlabRepo, options *UpdateDashboardOptions, token string) *MirrorSyncResult {
+	filePath := mirror.dashboardFilePath(options.Folder, options.Name)
+	result := &MirrorSyncResult{RepoId: mirror.RepoId, Name: mirror.Name, FilePath: filePath}
+
+	git := newDashboardCommitClient(mirror, token)
+	existing, err := resolveFileAction(git, mirror, filePath, gitlab.FileUpdate)
+	if err != nil {
+		s.log.Warn("Failed to check dashboard file in mirror", "mirror", mirror.Name, "repoId", mirror.RepoId, "path", filePath, "error", err)
+		result.Err = err
+		return result
+	}
+
+	action := s.getGitlabAction(options.Action)
+	if action == gitlab.FileDelete && existing == gitlab.FileCreate {
+		// nothing to delete
+		return result
+	}
+	if action != gitlab.FileDelete {
+		action = existing
+	}
+
+	message := createCommitMessage(options, mirror.CommitFooter)
+	commit := &gitlab.CreateCommitOptions{
+		Branch:        &mirror.Branch,
+		CommitMessage: &message,
+		Actions: []*gitlab.CommitAction{
+			{
+				Action:   action,
+				Content:  mirror.formatDashboard(options.Dashboard),
+				FilePath: filePath,
+			},
+		},
+	}
+
+	commitResult, mode, err := s.createDashboardCommit(git, mirror, commit, options)
+	if err != nil {
+		s.log.Warn("Failed to commit dashboard to mirror", "mirror", mirror.Name, "repoId", mirror.RepoId, "path", filePath, "mode", mode, "error", err)
+		result.Err = err
+		return result
+	}
+
+	result.CommitSha = commitResult.ID
+	return result
+}
+
+// PromoteMirror swaps the repository of the organization with one of its mirrors: dashboards are committed to the
+// mirror first, and mirrored to the former repository along with the other mirrors. Commits in progress finish
+// with the repositories they started with. The promotion is kept in memory, the mirrors setting of the
+// repositories should be swapped as well before Grafana restarts.
+func (s *SocialGitlab) PromoteMirror(orgId int64, name string) (*SyncRepo, error) {
+	s.mirrorsMu.Lock()
+	defer s.mirrorsMu.Unlock()
+
+	primary := s.orgRepo(orgId)
+	promoted := findRepo(s.repos, orgId, name)
+	if primary == nil || promoted == nil {
+		return nil, models.ErrDashboardGitRepoNotFound
+	}
+
+	mirrors := append([]*GrafanaGitlabRepo{}, s.mirrors[primary]...)
+	index := -1
+	for i, mirror := range mirrors {
+		if mirror == promoted {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, ErrRepoNotMirror
+	}
+	mirrors[index] = primary
+
+	if s.primaries == nil {
+		s.primaries = make(map[int64]*GrafanaGitlabRepo)
+	}
+	delete(s.mirrors, primary)
+	s.mirrors[promoted] = mirrors
+	s.primaries[orgId] = promoted
+
+	s.log.Info("Promoted mirror to repository of the organization", "orgId", orgId, "repo", promoted.Name, "repoId", promoted.RepoId, "former", primary.Name, "formerRepoId", primary.RepoId)
+
+	return s.syncRepo(promoted), nil
+}
@@ -0,0 +1,230 @@
+package social
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGitlabRepoMirrors(t *testing.T) {
+	Convey("Given a GitLab repository mirrored to two repositories", t, func() {
+		// existingFiles are the files of each project, failingProjects reject all commits
+		existingFiles := map[string]map[string]bool{"1": {}, "2": {}, "3": {}}
+		failingProjects := map[string]bool{}
+		type commit struct {
+			project string
+			action  string
+			path    string
+		}
+		var commits []commit
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.Split(r.URL.Path, "/")
+			if len(parts) < 5 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			project := parts[4]
+
+			switch {
+			case r.Method == "HEAD" && strings.Contains(r.URL.Path, "/repository/files/"):
+				filePath := r.URL.Path[strings.Index(r.URL.Path, "/repository/files/")+len("/repository/files/"):]
+				if !existingFiles[project][filePath] {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+
+			case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/repository/commits"):
+				if failingProjects[project] {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write([]byte(`{"message": "500 Internal Server Error"}`))
+					return
+				}
+
+				var body struct {
+					Actions []struct {
+						Action   string `json:"action"`
+						FilePath string `json:"file_path"`
+					} `json:"actions"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				for _, action := range body.Actions {
+					commits = append(commits, commit{project: project, action: action.Action, path: action.FilePath})
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id": "sha-` + project + `"}`))
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		current := &GrafanaGitlabRepo{Name: "current", OrgId: 1, RepoId: 1, Branch: "master", DashboardsPath: "dashboards", Url: server.URL, Mirrors: []string{"next", "3"}}
+		next := &GrafanaGitlabRepo{Name: "next", OrgId: 1, RepoId: 2, Branch: "main", DashboardsPath: "grafana", Url: server.URL}
+		archive := &GrafanaGitlabRepo{Name: "archive", OrgId: 1, RepoId: 3, Branch: "master", DashboardsPath: "dashboards", Url: server.URL}
+		repos := []*GrafanaGitlabRepo{next, current, archive}
+
+		logger := log.New("oauth.gitlab")
+		connector := &SocialGitlab{
+			SocialBase: &SocialBase{log: logger},
+			repos:      repos,
+			mirrors:    resolveRepoMirrors(repos, logger),
+		}
+
+		update := func(action DashboardAction) *UpdateDashboardOptions {
+			options := &UpdateDashboardOptions{
+				Action:    action,
+				Title:     "Production",
+				Name:      "production",
+				Folder:    "General",
+				Dashboard: "{}",
+				OrgId:     1,
+			}
+			So(connector.UpdateDashboard(options, "token"), ShouldBeNil)
+			return options
+		}
+
+		Convey("Should sync the dashboards of the organization to the repository, not its mirrors", func() {
+			So(connector.getRepo(1), ShouldEqual, current)
+
+			repo := connector.SyncRepo(1)
+			So(repo.RepoId, ShouldEqual, 1)
+			So(repo.Mirrors, ShouldResemble, []*SyncRepo{
+				{Provider: "gitlab", Name: "next", RepoId: 2},
+				{Provider: "gitlab", Name: "archive", RepoId: 3},
+			})
+		})
+
+		Convey("Should commit to the repository then to its mirrors at their own paths", func() {
+			existingFiles["1"]["dashboards/General/production.json"] = true
+
+			options := update(UpdateDashboard)
+			So(commits, ShouldResemble, []commit{
+				{project: "1", action: "update", path: "dashboards/General/production.json"},
+				{project: "2", action: "create", path: "grafana/General/production.json"},
+				{project: "3", action: "create", path: "dashboards/General/production.json"},
+			})
+			So(options.Result.RepoId, ShouldEqual, 1)
+			So(options.Result.CommitSha, ShouldEqual, "sha-1")
+			So(options.Result.Mirrors, ShouldResemble, []*MirrorSyncResult{
+				{RepoId: 2, Name: "next", FilePath: "grafana/General/production.json", CommitSha: "sha-2"},
+				{RepoId: 3, Name: "archive", FilePath: "dashboards/General/production.json", CommitSha: "sha-3"},
+			})
+		})
+
+		Convey("Should not fail the commit or the other mirrors when a mirror fails", func() {
+			failingProjects["2"] = true
+
+			options := update(CreateDashboard)
+			So(options.Result.CommitSha, ShouldEqual, "sha-1")
+			So(options.Result.Mirrors, ShouldHaveLength, 2)
+			So(options.Result.Mirrors[0].Err, ShouldNotBeNil)
+			So(options.Result.Mirrors[0].CommitSha, ShouldBeEmpty)
+			So(options.Result.Mirrors[1].Err, ShouldBeNil)
+			So(options.Result.Mirrors[1].CommitSha, ShouldEqual, "sha-3")
+			So(commits, ShouldHaveLength, 2)
+		})
+
+		Convey("Should not commit to the mirrors when the repository fails", func() {
+			failingProjects["1"] = true
+
+			options := &UpdateDashboardOptions{Action: CreateDashboard, Name: "production", Folder: "General", Dashboard: "{}", OrgId: 1}
+			So(connector.UpdateDashboard(options, "token"), ShouldEqual, models.ErrDashboardGitlabSync)
+			So(commits, ShouldBeEmpty)
+		})
+
+		Convey("Should only delete the files the mirrors have", func() {
+			existingFiles["1"]["dashboards/General/production.json"] = true
+			existingFiles["3"]["dashboards/General/production.json"] = true
+
+			options := update(DeleteDashboard)
+			So(commits, ShouldResemble, []commit{
+				{project: "1", action: "delete", path: "dashboards/General/production.json"},
+				{project: "3", action: "delete", path: "dashboards/General/production.json"},
+			})
+			So(options.Result.Mirrors[0], ShouldResemble, &MirrorSyncResult{RepoId: 2, Name: "next", FilePath: "grafana/General/production.json"})
+		})
+
+		Convey("Should not mirror commits to an overridden branch", func() {
+			current.AllowBranchOverride = []string{"preview/*"}
+
+			options := &UpdateDashboardOptions{Action: CreateDashboard, Name: "production", Folder: "General", Dashboard: "{}", OrgId: 1, Branch: "preview/a"}
+			So(connector.UpdateDashboard(options, "token"), ShouldBeNil)
+			So(commits, ShouldHaveLength, 1)
+			So(options.Result.Mirrors, ShouldBeEmpty)
+		})
+
+		Convey("When a mirror is promoted", func() {
+			repo, err := connector.PromoteMirror(1, "next")
+			So(err, ShouldBeNil)
+
+			Convey("Should swap the repository with the mirror", func() {
+				So(repo.RepoId, ShouldEqual, 2)
+				So(repo.Mirrors, ShouldResemble, []*SyncRepo{
+					{Provider: "gitlab", Name: "current", RepoId: 1},
+					{Provider: "gitlab", Name: "archive", RepoId: 3},
+				})
+				So(connector.getRepo(1), ShouldEqual, next)
+				So(connector.SyncRepo(1), ShouldResemble, repo)
+			})
+
+			Convey("Should commit to the promoted mirror first and mirror to the former repository", func() {
+				options := update(CreateDashboard)
+				So(commits, ShouldResemble, []commit{
+					{project: "2", action: "create", path: "grafana/General/production.json"},
+					{project: "1", action: "create", path: "dashboards/General/production.json"},
+					{project: "3", action: "create", path: "dashboards/General/production.json"},
+				})
+				So(options.Result.RepoId, ShouldEqual, 2)
+			})
+
+			Convey("Should promote the former repository back", func() {
+				repo, err := connector.PromoteMirror(1, "1")
+				So(err, ShouldBeNil)
+				So(repo.RepoId, ShouldEqual, 1)
+				So(repo.Mirrors[0].RepoId, ShouldEqual, 2)
+				So(connector.getRepo(1), ShouldEqual, current)
+			})
+		})
+
+		Convey("Should only promote mirrors of the repository of the organization", func() {
+			_, err := connector.PromoteMirror(1, "current")
+			So(err, ShouldEqual, ErrRepoNotMirror)
+
+			_, err = connector.PromoteMirror(1, "unknown")
+			So(err, ShouldEqual, models.ErrDashboardGitRepoNotFound)
+
+			_, err = connector.PromoteMirror(2, "next")
+			So(err, ShouldEqual, models.ErrDashboardGitRepoNotFound)
+			So(connector.getRepo(1), ShouldEqual, current)
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+
+	Convey("Should ignore invalid mirrors", t, func() {
+		primary := &GrafanaGitlabRepo{Name: "primary", OrgId: 1, RepoId: 1, Mirrors: []string{"primary", "unknown", "other-org", "chained", "mirror"}}
+		chained := &GrafanaGitlabRepo{Name: "chained", OrgId: 1, RepoId: 2, Mirrors: []string{"mirror"}}
+		mirror := &GrafanaGitlabRepo{Name: "mirror", OrgId: 1, RepoId: 3}
+		second := &GrafanaGitlabRepo{Name: "second", OrgId: 1, RepoId: 4, Mirrors: []string{"mirror"}}
+		otherOrg := &GrafanaGitlabRepo{Name: "other-org", OrgId: 2, RepoId: 5}
+
+		mirrors := resolveRepoMirrors([]*GrafanaGitlabRepo{primary, chained, mirror, second, otherOrg}, log.New("oauth.gitlab"))
+		So(mirrors, ShouldResemble, map[*GrafanaGitlabRepo][]*GrafanaGitlabRepo{
+			primary: {mirror},
+		})
+	})
+}
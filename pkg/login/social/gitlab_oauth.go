@@ -1,25 +1,75 @@
 package social
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"path"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/xanzy/go-gitlab"
 
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
 )
 
 type GrafanaGitlabRepo struct {
+	// Name is the name of the settings section, dashboards can select the repository by it
+	Name           string
 	OrgId          int64
 	RepoId         int
 	Branch         string
 	DashboardsPath string
 	Url            string
+	WebUrl         string
+	// VerifyFileExistence makes commits check the file on the branch to choose between create and update
+	VerifyFileExistence bool
+	// AccessToken is used to export org-level resources, which are not changed through a user's session
+	AccessToken       string
+	ExportDatasources bool
+	ExportNotifiers   bool
+	// ExportPermissions writes the permissions of each folder and its dashboards to _permissions.yaml in the
+	// directory of the folder
+	ExportPermissions bool
+	// ExportPermissionEmails adds the emails of users to the exported permissions, only their logins by default
+	ExportPermissionEmails bool
+	// SudoCommits makes dashboard commits use AccessToken on behalf of the user, so GitLab shows them as the author
+	SudoCommits bool
+	// AllowBranchOverride are the patterns of the branches single saves can commit to instead of Branch
+	AllowBranchOverride []string
+	// RequestIdTrailer adds the id of the HTTP request of the save to dashboard commits
+	RequestIdTrailer bool
+	// CommitFooter are the fields of the key=value footer of dashboard commits, empty disables the footer
+	CommitFooter []string
+	// AuditBranch receives a new timestamped snapshot of the dashboard on every change, empty disables snapshots.
+	// Snapshots are part of the dashboard commit when it is Branch, and committed separately otherwise.
+	AuditBranch string
+	// AuditPath is the directory of the snapshots on AuditBranch
+	AuditPath string
+	// JsonIndent indents the committed dashboard files, two spaces by default
+	JsonIndent string
+	// JsonTrailingNewline ends the committed dashboard files with a newline
+	JsonTrailingNewline bool
+	// Jsonnet imports the .jsonnet files under DashboardsPath as dashboards, rendered with JsonnetSettings.
+	// Nil when disabled.
+	Jsonnet *JsonnetSettings
+	// ConflictPolicy tells what a dashboard commit does when the file was changed in the repository since the
+	// dashboard was last synced, see the models.GitConflict constants. Empty overwrites the change.
+	ConflictPolicy string
+	// Mirrors are the names or ids of the repositories of the organization dashboard commits are also made to,
+	// e.g. while moving the dashboards to another repository, see resolveRepoMirrors
+	Mirrors []string
 }
 
 type SocialGitlab struct {
@@ -29,16 +79,122 @@ type SocialGitlab struct {
 	apiUrl         string
 	allowSignup    bool
 	repos          []*GrafanaGitlabRepo
+
+	// groupRoleMapping maps groups to org roles, the groups are only fetched at login when it or allowedGroups is set
+	groupRoleMapping map[string]string
+
+	// groupCacheTTL is how long the groups of an allowed user are reused at login, 0 disables the cache
+	groupCacheTTL time.Duration
+	// groupCacheNegativeTTL is how long a denial is remembered when GitLab cannot be reached
+	groupCacheNegativeTTL time.Duration
+	// maxStaleOnError is how long after groupCacheTTL the groups of an allowed user are still used when GitLab fails
+	maxStaleOnError time.Duration
+	// allowedStates are the GitLab account states that may log in, only "active" when empty
+	allowedStates []string
+	// allowPartialGroups lets users in with the groups read before GitLab failed, when they include an
+	// allowed group, instead of failing the login
+	allowPartialGroups bool
+	// maxGroups stops reading the groups of a user once that many are read, 0 reads all of them
+	maxGroups int
+
+	// mirrorsMu guards the mirrors of the repositories, which change when a mirror is promoted
+	mirrorsMu sync.RWMutex
+	// mirrors maps repositories to the repositories their dashboard commits are mirrored to
+	mirrors map[*GrafanaGitlabRepo][]*GrafanaGitlabRepo
+	// primaries are the repositories of the organizations whose mirror was promoted
+	primaries map[int64]*GrafanaGitlabRepo
 }
 
 var (
 	ErrMissingGroupMembership = &Error{"User not a member of one of the required groups"}
+	ErrGroupsUnavailable      = &Error{"Could not get the groups of the user from GitLab, try again later"}
+)
+
+// userStateErrors explain to users why the state of their GitLab account keeps them from logging in
+var userStateErrors = map[string]*Error{
+	"blocked":                  {"Your GitLab account is blocked, contact your GitLab administrator"},
+	"blocked_pending_approval": {"Your GitLab account is waiting for approval by a GitLab administrator"},
+	"ldap_blocked":             {"Your GitLab account is blocked by LDAP, contact your LDAP administrator"},
+	"deactivated":              {"Your GitLab account is deactivated, sign in to GitLab to reactivate it"},
+}
+
+// The fields of the commit footer
+const (
+	FooterDashboardUid   = "dashboard-uid"
+	FooterOrgId          = "org-id"
+	FooterGrafanaUser    = "grafana-user"
+	FooterGrafanaVersion = "grafana-version"
 )
 
+// commitFooterFields are the fields the commit footer can contain
+var commitFooterFields = []string{FooterDashboardUid, FooterOrgId, FooterGrafanaUser, FooterGrafanaVersion}
+
+// auditNow returns the time of audit snapshots, tests replace it
+var auditNow = time.Now
+
+// groupPageAttempts is how many times a page of groups is requested before giving up
+const groupPageAttempts = 3
+
+// groupPageRetryDelay is the wait before the first retry of a page, doubled for each retry. Tests disable it.
+var groupPageRetryDelay = 200 * time.Millisecond
+
 func (s *SocialGitlab) getRepo(orgId int64) *GrafanaGitlabRepo {
+	s.mirrorsMu.RLock()
+	defer s.mirrorsMu.RUnlock()
+	return s.orgRepo(orgId)
+}
+
+// orgRepo returns the repository of the organization: the promoted mirror, or the first repository of the
+// organization that is not a mirror. The caller holds mirrorsMu.
+func (s *SocialGitlab) orgRepo(orgId int64) *GrafanaGitlabRepo {
+	if repo, ok := s.primaries[orgId]; ok {
+		return repo
+	}
+
 	// TODO: Check multiple repositories
 	for _, repo := range s.repos {
-		if repo.OrgId == orgId {
+		if repo.OrgId == orgId && !s.isMirror(repo) {
+			return repo
+		}
+	}
+
+	return nil
+}
+
+func (repo *GrafanaGitlabRepo) dashboardFilePath(folder string, name string) string {
+	return DashboardFilePath(repo.DashboardsPath, folder, name)
+}
+
+// getDashboardRepo returns the repository a dashboard selects by name or id, or the repository of the organization.
+// Dashboards can only select repositories configured for their organization.
+func (s *SocialGitlab) getDashboardRepo(orgId int64, name string) (*GrafanaGitlabRepo, error) {
+	repo, _, err := s.getDashboardRepoAndMirrors(orgId, name)
+	return repo, err
+}
+
+// getDashboardRepoAndMirrors returns the repository a dashboard selects along with its mirrors, read together so
+// a commit is made either before or after a mirror is promoted
+func (s *SocialGitlab) getDashboardRepoAndMirrors(orgId int64, name string) (*GrafanaGitlabRepo, []*GrafanaGitlabRepo, error) {
+	s.mirrorsMu.RLock()
+	defer s.mirrorsMu.RUnlock()
+
+	repo := s.orgRepo(orgId)
+	if name != "" {
+		if repo = findRepo(s.repos, orgId, name); repo == nil {
+			return nil, nil, models.ErrDashboardGitRepoNotFound
+		}
+	}
+
+	if repo == nil {
+		return nil, nil, nil
+	}
+	return repo, append([]*GrafanaGitlabRepo{}, s.mirrors[repo]...), nil
+}
+
+// findRepo returns the repository of the organization with the name or id
+func findRepo(repos []*GrafanaGitlabRepo, orgId int64, name string) *GrafanaGitlabRepo {
+	for _, repo := range repos {
+		if repo.OrgId == orgId && (repo.Name == name || strconv.Itoa(repo.RepoId) == name) {
 			return repo
 		}
 	}
@@ -46,6 +202,76 @@ func (s *SocialGitlab) getRepo(orgId int64) *GrafanaGitlabRepo {
 	return nil
 }
 
+// withBranchOverride returns a copy of the repository committing to the branch, which must be a valid branch
+// name matching one of the branch override patterns. Patterns use path.Match syntax, e.g. preview/* matches
+// preview/login.
+func (repo *GrafanaGitlabRepo) withBranchOverride(branch string) (*GrafanaGitlabRepo, error) {
+	if err := ValidateBranchName(branch); err != nil {
+		return nil, models.ErrDashboardGitBranchNotAllowed
+	}
+
+	for _, pattern := range repo.AllowBranchOverride {
+		if matched, _ := path.Match(pattern, branch); matched {
+			override := *repo
+			override.Branch = branch
+			return &override, nil
+		}
+	}
+
+	return nil, models.ErrDashboardGitBranchNotAllowed
+}
+
+// auditFilePath returns the path of a new snapshot of the dashboard, e.g. audit/<uid>/20190901T120000.000Z-update.json
+func (repo *GrafanaGitlabRepo) auditFilePath(options *UpdateDashboardOptions) string {
+	id := options.Uid
+	if id == "" {
+		id = options.Name
+	}
+
+	timestamp := auditNow().UTC().Format("20060102T150405.000Z")
+	return path.Join(repo.AuditPath, id, fmt.Sprintf("%s-%s.json", timestamp, options.Action))
+}
+
+// formatDashboard formats the json of a dashboard file as configured for the repository. Only the whitespace
+// changes, the keys keep their order. Content that is not valid json is committed as is.
+func (repo *GrafanaGitlabRepo) formatDashboard(content string) string {
+	return formatDashboardJson(content, repo.JsonIndent, repo.JsonTrailingNewline)
+}
+
+// formatDashboardJson indents the json of a dashboard file, with two spaces when indent is empty. Content that
+// is not valid json is returned as is.
+func formatDashboardJson(content string, indent string, trailingNewline bool) string {
+	if indent == "" {
+		indent = "  "
+	}
+
+	var formatted bytes.Buffer
+	if err := json.Indent(&formatted, []byte(strings.TrimSpace(content)), "", indent); err != nil {
+		return content
+	}
+
+	if trailingNewline {
+		formatted.WriteByte('\n')
+	}
+	return formatted.String()
+}
+
+// isDashboardFile tells whether a file under the dashboards path holds a dashboard, a json file or, when
+// rendering is enabled, a jsonnet file. Jsonnet libraries are only imported by other files.
+func (repo *GrafanaGitlabRepo) isDashboardFile(filePath string) bool {
+	switch path.Ext(filePath) {
+	case ".json":
+		return true
+	case ".jsonnet":
+		return repo.Jsonnet != nil
+	}
+	return false
+}
+
+func (repo *GrafanaGitlabRepo) dashboardFolder(filePath string) string {
+	return DashboardFolderFromPath(repo.DashboardsPath, filePath)
+}
+
 func (s *SocialGitlab) getGitlabAction(action DashboardAction) gitlab.FileAction {
 	switch action {
 	case UpdateDashboard:
@@ -59,52 +285,771 @@ func (s *SocialGitlab) getGitlabAction(action DashboardAction) gitlab.FileAction
 	return gitlab.FileUpdate
 }
 
-func createCommitMessage(options *UpdateDashboardOptions) (message string) {
+// createCommitMessage describes the dashboard change. The footer fields are added as key=value lines in their
+// own paragraph, before the source, the request id and the co-authors, followed by the additional co-authors,
+// which are added as trailers in the last paragraph of the message.
+func createCommitMessage(options *UpdateDashboardOptions, footer []string, coauthors ...models.GitCommitAuthor) (message string) {
+	if len(options.batch) > 0 {
+		message = batchCommitMessage(options.batch)
+	} else {
+		message = dashboardChangeMessage(options)
+	}
+
+	if lines := commitFooter(options, footer); len(lines) > 0 {
+		message = fmt.Sprintf("%s\n\n%s", strings.TrimRight(message, "\n"), strings.Join(lines, "\n"))
+	}
+
+	trailers := make([]string, 0)
+	if options.Source != "" {
+		trailers = append(trailers, fmt.Sprintf("Source: %s", options.Source))
+	}
+	if options.RequestId != "" {
+		trailers = append(trailers, fmt.Sprintf("Request-Id: %s", options.RequestId))
+	}
+
+	credited := make(map[string]bool)
+	coauthors = append(append([]models.GitCommitAuthor{}, options.Coauthors...), coauthors...)
+	for _, coauthor := range coauthors {
+		email := strings.TrimSpace(coauthor.Email)
+		if email == "" || credited[strings.ToLower(email)] {
+			continue
+		}
+		credited[strings.ToLower(email)] = true
+
+		// names are single line, and fall back to the email like git does for authors without a name
+		name := strings.Join(strings.Fields(coauthor.Name), " ")
+		if name == "" {
+			name = email
+		}
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", name, email))
+	}
+
+	if len(trailers) > 0 {
+		message = fmt.Sprintf("%s\n\n%s", strings.TrimRight(message, "\n"), strings.Join(trailers, "\n"))
+	}
+
+	return
+}
+
+func dashboardChangeMessage(options *UpdateDashboardOptions) string {
 	switch options.Action {
 	case CreateDashboard:
-		message = fmt.Sprintf("Create %s dashboard", options.Title)
+		return fmt.Sprintf("Create %s dashboard", options.Title)
 	case DeleteDashboard:
-		message = fmt.Sprintf("Delete %s dashboard", options.Title)
+		return fmt.Sprintf("Delete %s dashboard", options.Title)
 	case UpdateDashboard:
-		message = fmt.Sprintf("Update %s dashboard\n\n%s", options.Title, options.Message)
+		return fmt.Sprintf("Update %s dashboard\n\n%s", options.Title, options.Message)
 	}
+	return ""
+}
 
-	return
+// batchCommitMessage lists the changes of a commit of several dashboards, followed by their distinct messages
+func batchCommitMessage(batch []*UpdateDashboardOptions) string {
+	changes := make([]string, 0, len(batch))
+	messages := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, options := range batch {
+		changes = append(changes, strings.SplitN(dashboardChangeMessage(options), "\n", 2)[0])
+
+		message := strings.TrimSpace(options.Message)
+		if options.Action == UpdateDashboard && message != "" && !seen[message] {
+			seen[message] = true
+			messages = append(messages, message)
+		}
+	}
+
+	message := fmt.Sprintf("Save %d dashboards\n\n%s", len(batch), strings.Join(changes, "\n"))
+	if len(messages) > 0 {
+		message = fmt.Sprintf("%s\n\n%s", message, strings.Join(messages, "\n\n"))
+	}
+	return message
+}
+
+// commitFooter returns the key=value lines of the footer fields, skipping the fields without value, e.g. the
+// user of provisioned saves
+func commitFooter(options *UpdateDashboardOptions, fields []string) []string {
+	lines := make([]string, 0, len(fields))
+	for _, field := range fields {
+		var value string
+		switch field {
+		case FooterDashboardUid:
+			value = options.Uid
+		case FooterOrgId:
+			if options.OrgId != 0 {
+				value = strconv.FormatInt(options.OrgId, 10)
+			}
+		case FooterGrafanaUser:
+			value = options.UserLogin
+		case FooterGrafanaVersion:
+			value = setting.BuildVersion
+		}
+
+		if value != "" {
+			lines = append(lines, fmt.Sprintf("%s=%s", field, value))
+		}
+	}
+	return lines
 }
 
+// UpdateDashboard commits the dashboard change to the repository the dashboard selects, then to the mirrors of the
+// repository. Commits to the mirrors are best-effort, see mirrorDashboard.
 func (s *SocialGitlab) UpdateDashboard(options *UpdateDashboardOptions, token string) error {
-	org_id := options.OrgId
-	repo := s.getRepo(org_id)
-	message := createCommitMessage(options)
-	fileName := fmt.Sprintf("%s.json", options.Name)
-	filePath := path.Join(repo.DashboardsPath, options.Folder, fileName)
+	repo, mirrors, err := s.getDashboardRepoAndMirrors(options.OrgId, options.Repo)
+	if err != nil {
+		return err
+	}
+
+	if err := s.commitDashboard(repo, options, token); err != nil {
+		return err
+	}
+
+	// commits to an overridden branch and skipped commits are not mirrored
+	if options.Branch != "" || options.Result == nil || options.Result.ConflictCommitSha != "" {
+		return nil
+	}
+
+	for _, mirror := range mirrors {
+		options.Result.Mirrors = append(options.Result.Mirrors, s.mirrorDashboard(mirror, options, token))
+	}
+
+	return nil
+}
+
+func (s *SocialGitlab) commitDashboard(repo *GrafanaGitlabRepo, options *UpdateDashboardOptions, token string) error {
+	var err error
+	if options.Branch != "" {
+		if repo, err = repo.withBranchOverride(options.Branch); err != nil {
+			return err
+		}
+	}
+
+	if !repo.RequestIdTrailer {
+		options.RequestId = ""
+	}
 
-	client := &http.Client{}
+	message := createCommitMessage(options, repo.CommitFooter)
+	filePath := repo.dashboardFilePath(options.Folder, options.Name)
+	content := repo.formatDashboard(options.Dashboard)
+
+	git := newDashboardCommitClient(repo, token)
+	action := s.getGitlabAction(options.Action)
+	if repo.VerifyFileExistence {
+		if action, err = resolveFileAction(git, repo, filePath, action); err != nil {
+			s.log.Error("Failed to check dashboard file in repository", "path", filePath, "error", err)
+			return models.ErrDashboardGitlabSync
+		}
+	}
+
+	if action == gitlab.FileUpdate && repo.detectsConflicts() {
+		foreign, err := foreignCommit(git, repo, filePath, options)
+		if err != nil {
+			s.log.Error("Failed to check dashboard file for changes in repository", "path", filePath, "error", err)
+			return models.ErrDashboardGitlabSync
+		}
+
+		if foreign != "" {
+			s.log.Warn("Dashboard file changed in repository since last sync", "path", filePath, "commit", foreign, "policy", repo.ConflictPolicy)
+			if repo.ConflictPolicy == models.GitConflictFail {
+				return models.ErrDashboardGitConflict
+			}
+
+			options.Result = &DashboardSyncResult{
+				FilePath:          filePath,
+				RepoId:            repo.RepoId,
+				Branch:            options.Branch,
+				ConflictCommitSha: foreign,
+			}
+			return nil
+		}
+	}
 
 	commit := &gitlab.CreateCommitOptions{
 		Branch:        &repo.Branch,
 		CommitMessage: &message,
 		Actions: []*gitlab.CommitAction{
 			{
-				Action:   s.getGitlabAction(options.Action),
-				Content:  options.Dashboard,
+				Action:   action,
+				Content:  content,
 				FilePath: filePath,
 			},
 		},
 	}
 
-	git := gitlab.NewOAuthClient(client, token)
-	git.SetBaseURL(repo.Url)
+	// snapshots are always created, so an existing snapshot fails the commit rather than being overwritten
+	var snapshot *gitlab.CommitAction
+	if repo.AuditBranch != "" {
+		snapshot = &gitlab.CommitAction{Action: gitlab.FileCreate, Content: content, FilePath: repo.auditFilePath(options)}
+		if repo.AuditBranch == repo.Branch {
+			commit.Actions = append(commit.Actions, snapshot)
+			snapshot = nil
+		}
+	}
 
-	_, _, err := git.Commits.CreateCommit(repo.RepoId, commit)
+	result, mode, err := s.createDashboardCommit(git, repo, commit, options)
+
+	// the repository can be out of sync with Grafana, e.g. files deleted or added by hand, the commit is retried
+	// once with the action matching the file
+	fallback := fileActionFallback(err, action)
+	switch fallback {
+	case models.GitFallbackCreate, models.GitFallbackUpdate:
+		s.log.Warn("Dashboard file not in the expected state, retrying the commit", "path", filePath, "action", action, "fallback", fallback, "error", err)
+		commit.Actions[0].Action = gitlab.FileAction(fallback)
+		result, mode, err = s.createDashboardCommit(git, repo, commit, options)
+	case models.GitFallbackSkipDelete:
+		s.log.Warn("Dashboard file already deleted from repository", "path", filePath, "error", err)
+		if len(commit.Actions) == 1 {
+			options.Result = &DashboardSyncResult{
+				FilePath:       filePath,
+				CommitMode:     mode,
+				RepoId:         repo.RepoId,
+				Branch:         options.Branch,
+				FallbackAction: fallback,
+			}
+			return nil
+		}
+		// the snapshot committed with the delete is still written
+		commit.Actions = commit.Actions[1:]
+		result, mode, err = s.createDashboardCommit(git, repo, commit, options)
+	}
 
 	if err != nil {
+		s.log.Error("Failed to commit dashboard", "path", filePath, "mode", mode, "error", err)
 		return models.ErrDashboardGitlabSync
 	}
 
+	// the dashboard is already committed, a failing snapshot does not fail the save
+	if snapshot != nil {
+		auditCommit := &gitlab.CreateCommitOptions{
+			Branch:        &repo.AuditBranch,
+			CommitMessage: &message,
+			Actions:       []*gitlab.CommitAction{snapshot},
+		}
+		if _, mode, err := s.createDashboardCommit(git, repo, auditCommit, options); err != nil {
+			s.log.Error("Failed to commit dashboard snapshot", "path", snapshot.FilePath, "branch", repo.AuditBranch, "mode", mode, "error", err)
+		}
+	}
+
+	options.Result = &DashboardSyncResult{
+		CommitSha:  result.ID,
+		FilePath:   filePath,
+		CommitMode: mode,
+		RepoId:     repo.RepoId,
+		Branch:     options.Branch,
+
+		FallbackAction: fallback,
+		ContentHash:    contentHash(content),
+	}
+
 	return nil
 }
 
+// detectsConflicts tells whether dashboard commits check the file for changes made outside of Grafana first
+func (repo *GrafanaGitlabRepo) detectsConflicts() bool {
+	return repo.ConflictPolicy == models.GitConflictSkip || repo.ConflictPolicy == models.GitConflictFail
+}
+
+// foreignCommit returns the last commit of the file when it was changed in the repository since the dashboard was
+// last synced to it, or an empty string. Commits that left the content as Grafana wrote it, e.g. reverted edits,
+// are not changes. Files Grafana never committed to, or committed to another branch, are not checked.
+func foreignCommit(git *gitlab.Client, repo *GrafanaGitlabRepo, filePath string, options *UpdateDashboardOptions) (string, error) {
+	last := options.LastSync
+	if last == nil || last.CommitSha == "" || last.FilePath != filePath || last.Branch != options.Branch {
+		return "", nil
+	}
+	if last.RepoId != 0 && last.RepoId != repo.RepoId {
+		return "", nil
+	}
+
+	file, resp, err := git.RepositoryFiles.GetFileMetaData(repo.RepoId, filePath, &gitlab.GetFileMetaDataOptions{Ref: &repo.Branch})
+	if err != nil {
+		// a deleted file is recreated by the fallback of the update
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if file.CommitID == "" || file.CommitID == last.CommitSha {
+		return "", nil
+	}
+	if last.ContentHash != "" && resp.Header.Get("X-Gitlab-Content-Sha256") == last.ContentHash {
+		return "", nil
+	}
+
+	return file.CommitID, nil
+}
+
+// contentHash returns the sha256 of a file the way GitLab reports it
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// fileActionFallback returns the action to retry a commit with when GitLab rejected it because the file is
+// missing or already exists, a models.GitFallback* value, or an empty string for other errors. GitLab versions
+// word the errors differently, e.g. "A file with this name doesn't exist" or "404 File Not Found".
+func fileActionFallback(err error, action gitlab.FileAction) string {
+	errResp, ok := err.(*gitlab.ErrorResponse)
+	if !ok || errResp.Response == nil {
+		return ""
+	}
+
+	switch errResp.Response.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity:
+	default:
+		return ""
+	}
+
+	message := strings.ToLower(errResp.Message)
+	missing := strings.Contains(message, "doesn't exist") || strings.Contains(message, "does not exist") ||
+		strings.Contains(message, "file not found")
+	exists := strings.Contains(message, "already exists")
+
+	switch {
+	case action == gitlab.FileUpdate && missing:
+		return models.GitFallbackCreate
+	case action == gitlab.FileCreate && exists:
+		return models.GitFallbackUpdate
+	case action == gitlab.FileDelete && missing:
+		return models.GitFallbackSkipDelete
+	}
+
+	return ""
+}
+
+// createDashboardCommit commits with the session of the user, or with the access token of the repository
+// when sudo commits are enabled. Sudo makes GitLab author the commit as the user, it needs an admin token,
+// so a forbidden sudo request is retried as the service identity, crediting the user as co-author.
+func (s *SocialGitlab) createDashboardCommit(git *gitlab.Client, repo *GrafanaGitlabRepo, commit *gitlab.CreateCommitOptions, options *UpdateDashboardOptions) (*gitlab.Commit, string, error) {
+	if !repo.SudoCommits || repo.AccessToken == "" {
+		result, _, err := git.Commits.CreateCommit(repo.RepoId, commit)
+		return result, models.GitCommitModeUser, err
+	}
+
+	if gitlabUserId := getGitlabUserId(options.ExternalIdentity); gitlabUserId != 0 {
+		result, resp, err := git.Commits.CreateCommit(repo.RepoId, commit, gitlab.WithSudo(gitlabUserId))
+		if resp == nil || resp.StatusCode != http.StatusForbidden {
+			return result, models.GitCommitModeSudo, err
+		}
+		s.log.Warn("Sudo commit forbidden, committing as the repository user", "gitlabUserId", gitlabUserId)
+	}
+
+	if options.Author != nil {
+		message := createCommitMessage(options, repo.CommitFooter, *options.Author)
+		commit.CommitMessage = &message
+	}
+
+	result, _, err := git.Commits.CreateCommit(repo.RepoId, commit)
+	return result, models.GitCommitModeService, err
+}
+
+// getGitlabUserId returns the GitLab id of the identity, or 0 if it is unknown.
+func getGitlabUserId(identity *models.ExternalIdentity) int {
+	if identity == nil || identity.Provider != "oauth_gitlab" {
+		return 0
+	}
+
+	id, err := strconv.Atoi(identity.ExternalId)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// resolveFileAction turns a create into an update, or an update into a create, depending on whether
+// the file exists on the branch. Grafana's dashboard version does not tell if git state has diverged.
+func resolveFileAction(git *gitlab.Client, repo *GrafanaGitlabRepo, filePath string, action gitlab.FileAction) (gitlab.FileAction, error) {
+	if action != gitlab.FileCreate && action != gitlab.FileUpdate {
+		return action, nil
+	}
+
+	_, resp, err := git.RepositoryFiles.GetFileMetaData(repo.RepoId, filePath, &gitlab.GetFileMetaDataOptions{Ref: &repo.Branch})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return gitlab.FileCreate, nil
+		}
+		return action, err
+	}
+
+	return gitlab.FileUpdate, nil
+}
+
+func (s *SocialGitlab) ExportSettings(orgId int64) *ExportSettings {
+	repo := s.getRepo(orgId)
+	if repo == nil || repo.AccessToken == "" {
+		return nil
+	}
+
+	return &ExportSettings{
+		Datasources:      repo.ExportDatasources,
+		Notifiers:        repo.ExportNotifiers,
+		Permissions:      repo.ExportPermissions,
+		PermissionEmails: repo.ExportPermissionEmails,
+		DashboardsPath:   repo.DashboardsPath,
+	}
+}
+
+func (s *SocialGitlab) JsonnetSettings(orgId int64) *JsonnetSettings {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return nil
+	}
+	return repo.Jsonnet
+}
+
+func (s *SocialGitlab) WriteFile(orgId int64, filePath string, content string, message string) error {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	git := newRepoClient(repo)
+	action, err := resolveFileAction(git, repo, filePath, gitlab.FileUpdate)
+	if err != nil {
+		return err
+	}
+
+	return commitFile(git, repo, action, filePath, content, message)
+}
+
+func (s *SocialGitlab) DeleteFile(orgId int64, filePath string, message string) error {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	git := newRepoClient(repo)
+	action, err := resolveFileAction(git, repo, filePath, gitlab.FileUpdate)
+	if err != nil {
+		return err
+	}
+
+	if action == gitlab.FileCreate {
+		// nothing to delete
+		return nil
+	}
+
+	return commitFile(git, repo, gitlab.FileDelete, filePath, "", message)
+}
+
+func (s *SocialGitlab) DashboardFilePath(orgId int64, folder string, name string) string {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return ""
+	}
+
+	return repo.dashboardFilePath(folder, name)
+}
+
+// MoveFiles deletes the old files and writes the new ones in a single commit. Old files missing on the
+// branch are skipped, new files that already exist are overwritten.
+func (s *SocialGitlab) MoveFiles(orgId int64, moves []FileMove, message string) (string, error) {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return "", fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	git := newRepoClient(repo)
+	deleted := make(map[string]bool)
+	deletes := make([]*gitlab.CommitAction, 0, len(moves))
+	writes := make([]*gitlab.CommitAction, 0, len(moves))
+
+	for _, move := range moves {
+		action, err := resolveFileAction(git, repo, move.From, gitlab.FileUpdate)
+		if err != nil {
+			return "", err
+		}
+
+		if action == gitlab.FileUpdate {
+			deletes = append(deletes, &gitlab.CommitAction{Action: gitlab.FileDelete, FilePath: move.From})
+			deleted[move.From] = true
+		}
+	}
+
+	// deletes come first, so a file can move to the previous path of another one
+	for _, move := range moves {
+		action := gitlab.FileCreate
+		if !deleted[move.To] {
+			var err error
+			if action, err = resolveFileAction(git, repo, move.To, gitlab.FileCreate); err != nil {
+				return "", err
+			}
+		}
+
+		writes = append(writes, &gitlab.CommitAction{Action: action, FilePath: move.To, Content: repo.formatDashboard(move.Content)})
+	}
+
+	commit := &gitlab.CreateCommitOptions{
+		Branch:        &repo.Branch,
+		CommitMessage: &message,
+		Actions:       append(deletes, writes...),
+	}
+
+	result, _, err := git.Commits.CreateCommit(repo.RepoId, commit)
+	if err != nil {
+		return "", err
+	}
+
+	return result.ID, nil
+}
+
+func (s *SocialGitlab) ListDashboardFiles(orgId int64) ([]DashboardFile, error) {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return nil, fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	git := newRepoClient(repo)
+	recursive := true
+	opt := &gitlab.ListTreeOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100, Page: 1},
+		Path:        &repo.DashboardsPath,
+		Ref:         &repo.Branch,
+		Recursive:   &recursive,
+	}
+
+	files := make([]DashboardFile, 0)
+	for {
+		nodes, resp, err := git.Repositories.ListTree(repo.RepoId, opt)
+		if err != nil {
+			// a dashboards path nothing was committed to yet has no files
+			if resp != nil && resp.StatusCode == http.StatusNotFound && opt.Page == 1 {
+				missing, missingErr := dashboardsPathMissing(git, repo)
+				if missingErr != nil {
+					return nil, missingErr
+				}
+				if missing {
+					return files, nil
+				}
+			}
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			if node.Type != "blob" || !repo.isDashboardFile(node.Path) {
+				continue
+			}
+			files = append(files, DashboardFile{Path: node.Path, Folder: repo.dashboardFolder(node.Path)})
+		}
+
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// DashboardsPathExists tells whether the dashboards path exists on the branch. It fails when the repository or the
+// branch cannot be read, so callers do not mistake them for an empty dashboards path.
+func (s *SocialGitlab) DashboardsPathExists(orgId int64) (bool, error) {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return false, fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	git := newRepoClient(repo)
+	opt := &gitlab.ListTreeOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1, Page: 1},
+		Path:        &repo.DashboardsPath,
+		Ref:         &repo.Branch,
+	}
+
+	_, resp, err := git.Repositories.ListTree(repo.RepoId, opt)
+	if err == nil {
+		return true, nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return false, err
+	}
+
+	missing, missingErr := dashboardsPathMissing(git, repo)
+	if missingErr != nil {
+		return false, missingErr
+	}
+	if !missing {
+		return false, err
+	}
+	return false, nil
+}
+
+// CreateDashboardsPath commits an empty .gitkeep file to the dashboards path, so it exists before the first
+// dashboard is committed. It returns the sha of the commit.
+func (s *SocialGitlab) CreateDashboardsPath(orgId int64, message string) (string, error) {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return "", fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	commit := &gitlab.CreateCommitOptions{
+		Branch:        &repo.Branch,
+		CommitMessage: &message,
+		Actions: []*gitlab.CommitAction{
+			{Action: gitlab.FileCreate, FilePath: dashboardsPathKeepFile(repo.DashboardsPath)},
+		},
+	}
+
+	result, _, err := newRepoClient(repo).Commits.CreateCommit(repo.RepoId, commit)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// dashboardsPathKeepFile returns the path of the file committed to create the dashboards path
+func dashboardsPathKeepFile(dashboardsPath string) string {
+	return path.Join(strings.Trim(path.Clean("/"+dashboardsPath), "/"), ".gitkeep")
+}
+
+// dashboardsPathMissing is called when listing the dashboards path returned a 404. GitLab returns it for a
+// missing path, but also for a missing repository or branch. The path is only missing when the repository
+// has no commits yet, or when the branch exists.
+func dashboardsPathMissing(git *gitlab.Client, repo *GrafanaGitlabRepo) (bool, error) {
+	project, _, err := git.Projects.GetProject(repo.RepoId, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// repositories without commits have no default branch
+	if project.DefaultBranch == "" {
+		return true, nil
+	}
+
+	_, resp, err := git.Branches.GetBranch(repo.RepoId, repo.Branch)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SocialGitlab) ReadFile(orgId int64, filePath string) (string, error) {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return "", fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	content, _, err := newRepoClient(repo).RepositoryFiles.GetRawFile(repo.RepoId, filePath, &gitlab.GetRawFileOptions{Ref: &repo.Branch})
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// ReadFileAtRef reads the file at a ref. GitLab answers 404 for both a missing ref and a missing file, so the ref is
+// resolved to its commit first to tell them apart.
+func (s *SocialGitlab) ReadFileAtRef(orgId int64, filePath string, ref string) (string, error) {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return "", fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	git := newRepoClient(repo)
+	if _, resp, err := git.Commits.GetCommit(repo.RepoId, ref); err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", ErrGitRefNotFound
+		}
+		return "", err
+	}
+
+	content, resp, err := git.RepositoryFiles.GetRawFile(repo.RepoId, filePath, &gitlab.GetRawFileOptions{Ref: &ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", ErrGitFileNotFound
+		}
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+func (s *SocialGitlab) FileAuthor(orgId int64, filePath string) (*ExternalIdentity, error) {
+	repo := s.getRepo(orgId)
+	if repo == nil {
+		return nil, fmt.Errorf("No GitLab repository configured for org %d", orgId)
+	}
+
+	opt := &gitlab.ListCommitsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1, Page: 1},
+		RefName:     &repo.Branch,
+		Path:        &filePath,
+	}
+
+	commits, _, err := newRepoClient(repo).Commits.ListCommits(repo.RepoId, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("No commit found for %s", filePath)
+	}
+
+	return &ExternalIdentity{Name: commits[0].AuthorName, Email: commits[0].AuthorEmail}, nil
+}
+
+// LookupGrafanaUser maps GitLab users by the GitLab user id stored when they signed in with GitLab, and
+// by email otherwise, e.g. for commit authors
+func (s *SocialGitlab) LookupGrafanaUser(ctx context.Context, orgId int64, identity ExternalIdentity) (*models.SignedInUser, error) {
+	return lookupGrafanaUser("oauth_gitlab", orgId, identity)
+}
+
+// newDashboardCommitClient returns the client dashboard commits are made with: the access token of the repository
+// for sudo commits, otherwise the token of the user
+func newDashboardCommitClient(repo *GrafanaGitlabRepo, token string) *gitlab.Client {
+	if repo.SudoCommits && repo.AccessToken != "" {
+		return newRepoClient(repo)
+	}
+
+	git := gitlab.NewOAuthClient(&http.Client{}, token)
+	git.SetBaseURL(repo.Url)
+	return git
+}
+
+func newRepoClient(repo *GrafanaGitlabRepo) *gitlab.Client {
+	git := gitlab.NewClient(&http.Client{}, repo.AccessToken)
+	git.SetBaseURL(repo.Url)
+	return git
+}
+
+func commitFile(git *gitlab.Client, repo *GrafanaGitlabRepo, action gitlab.FileAction, filePath string, content string, message string) error {
+	commit := &gitlab.CreateCommitOptions{
+		Branch:        &repo.Branch,
+		CommitMessage: &message,
+		Actions: []*gitlab.CommitAction{
+			{
+				Action:   action,
+				Content:  content,
+				FilePath: filePath,
+			},
+		},
+	}
+
+	_, _, err := git.Commits.CreateCommit(repo.RepoId, commit)
+	return err
+}
+
+func (s *SocialGitlab) SyncRepo(orgId int64) *SyncRepo {
+	s.mirrorsMu.RLock()
+	defer s.mirrorsMu.RUnlock()
+
+	repo := s.orgRepo(orgId)
+	if repo == nil {
+		return nil
+	}
+
+	return s.syncRepo(repo)
+}
+
+// syncRepo describes the repository with its mirrors. The caller holds mirrorsMu.
+func (s *SocialGitlab) syncRepo(repo *GrafanaGitlabRepo) *SyncRepo {
+	syncRepo := &SyncRepo{Provider: "gitlab", Name: repo.Name, WebUrl: repo.WebUrl, RepoId: repo.RepoId}
+	for _, mirror := range s.mirrors[repo] {
+		syncRepo.Mirrors = append(syncRepo.Mirrors, &SyncRepo{Provider: "gitlab", Name: mirror.Name, WebUrl: mirror.WebUrl, RepoId: mirror.RepoId})
+	}
+	return syncRepo
+}
+
 func (s *SocialGitlab) Type() int {
 	return int(models.GITLAB)
 }
@@ -117,6 +1062,14 @@ func (s *SocialGitlab) IsSignupAllowed() bool {
 	return s.allowSignup
 }
 
+// Capabilities adds the groups of users, and the dashboard sync when repositories are configured
+func (s *SocialGitlab) Capabilities() Capabilities {
+	capabilities := s.SocialBase.Capabilities()
+	capabilities.DashboardSync = len(s.repos) > 0
+	capabilities.GroupFetching = true
+	return capabilities
+}
+
 func (s *SocialGitlab) IsGroupMember(groups []string) bool {
 	if len(s.allowedGroups) == 0 {
 		return true
@@ -133,18 +1086,129 @@ func (s *SocialGitlab) IsGroupMember(groups []string) bool {
 	return false
 }
 
-func (s *SocialGitlab) GetGroups(client *http.Client) []string {
+// checkUserState returns why a GitLab account in the state cannot log in, or nil when the state is allowed
+func (s *SocialGitlab) checkUserState(state string) error {
+	allowed := s.allowedStates
+	if len(allowed) == 0 {
+		allowed = []string{"active"}
+	}
+
+	for _, allowedState := range allowed {
+		if strings.EqualFold(state, allowedState) {
+			return nil
+		}
+	}
+
+	if err, ok := userStateErrors[strings.ToLower(state)]; ok {
+		return err
+	}
+
+	return &Error{fmt.Sprintf("Your GitLab account is not active (state %q), contact your GitLab administrator", state)}
+}
+
+// needsGroups tells whether the groups of the user decide the login or the role of the user
+func (s *SocialGitlab) needsGroups() bool {
+	return len(s.allowedGroups) > 0 || len(s.groupRoleMapping) > 0
+}
+
+// GetGroups returns the groups of the user. Failing pages are requested again a few times. If a page still
+// fails, the groups of the pages read so far are returned with the error. With maxGroups, the first maxGroups
+// groups are returned, so users in more groups may be denied or get a lower role than with all of their groups.
+func (s *SocialGitlab) GetGroups(client *http.Client) ([]string, error) {
+	return s.getGroups(context.Background(), client)
+}
+
+// getGroups is GetGroups stopping at the page being read when the context is canceled
+func (s *SocialGitlab) getGroups(ctx context.Context, client *http.Client) ([]string, error) {
 	groups := make([]string, 0)
 
-	for page, url := s.GetGroupsPage(client, s.apiUrl+"/groups"); page != nil; page, url = s.GetGroupsPage(client, url) {
+	url := s.apiUrl + "/groups"
+	for url != "" {
+		page, next, err := s.getGroupsPageWithRetry(ctx, client, url)
+		if err != nil {
+			return groups, err
+		}
+
 		groups = append(groups, page...)
+		url = next
+
+		if s.maxGroups > 0 && len(groups) >= s.maxGroups {
+			if len(groups) > s.maxGroups || url != "" {
+				s.log.Warn("Stopped reading groups from GitLab API at max_groups, group membership and roles may be incomplete", "maxGroups", s.maxGroups)
+			}
+			return groups[:s.maxGroups], nil
+		}
+	}
+
+	return groups, nil
+}
+
+func (s *SocialGitlab) getGroupsPageWithRetry(ctx context.Context, client *http.Client, url string) ([]string, string, error) {
+	delay := groupPageRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		page, next, err := s.getGroupsPage(ctx, client, url)
+		if err == nil || attempt == groupPageAttempts || ctx.Err() != nil {
+			return page, next, err
+		}
+
+		s.log.Warn("Retrying page of groups from GitLab API", "url", url, "attempt", attempt, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// getUserGroups returns the groups of the user, reusing the cached groups of allowed users. Users that
+// were denied are always checked again, so being added to a group takes effect on the next login.
+// Without usable cached groups, a GitLab error returns the groups read so far with the error.
+func (s *SocialGitlab) getUserGroups(ctx context.Context, client *http.Client, key string, login string) ([]string, error) {
+	var entry *groupCacheEntry
+	var age time.Duration
+
+	if s.groupCacheTTL > 0 {
+		if entry = gitlabGroupCache.get(key); entry != nil {
+			age = groupCacheNow().Sub(entry.fetched)
+			if entry.allowed && age < s.groupCacheTTL {
+				return entry.groups, nil
+			}
+		}
 	}
 
-	return groups
+	groups, err := s.getGroups(ctx, client)
+	if err == nil {
+		if s.groupCacheTTL > 0 {
+			gitlabGroupCache.set(key, groups, s.IsGroupMember(groups))
+		}
+		return groups, nil
+	}
+
+	s.log.Error("Error getting groups from GitLab API", "err", err)
+
+	if entry != nil {
+		if entry.allowed && age < s.groupCacheTTL+s.maxStaleOnError {
+			auditLog.Warn("Serving stale group membership after GitLab error", "login", login, "age", age, "error", err)
+			return entry.groups, nil
+		}
+
+		if !entry.allowed && age < s.groupCacheNegativeTTL {
+			auditLog.Warn("Serving cached group denial after GitLab error", "login", login, "age", age, "error", err)
+			return entry.groups, nil
+		}
+	}
+
+	return groups, err
 }
 
 // GetGroupsPage returns groups and link to the next page if response is paginated
-func (s *SocialGitlab) GetGroupsPage(client *http.Client, url string) ([]string, string) {
+func (s *SocialGitlab) GetGroupsPage(client *http.Client, url string) ([]string, string, error) {
+	return s.getGroupsPage(context.Background(), client, url)
+}
+
+func (s *SocialGitlab) getGroupsPage(ctx context.Context, client *http.Client, url string) ([]string, string, error) {
 	type Group struct {
 		FullPath string `json:"full_path"`
 	}
@@ -154,19 +1218,13 @@ func (s *SocialGitlab) GetGroupsPage(client *http.Client, url string) ([]string,
 		next   string
 	)
 
-	if url == "" {
-		return nil, next
-	}
-
-	response, err := HttpGet(client, url)
+	response, err := httpGetContext(ctx, client, url)
 	if err != nil {
-		s.log.Error("Error getting groups from GitLab API", "err", err)
-		return nil, next
+		return nil, next, err
 	}
 
 	if err := json.Unmarshal(response.Body, &groups); err != nil {
-		s.log.Error("Error parsing JSON from GitLab API", "err", err)
-		return nil, next
+		return nil, next, fmt.Errorf("Error parsing JSON from GitLab API: %s", err)
 	}
 
 	fullPaths := make([]string, len(groups))
@@ -182,11 +1240,69 @@ func (s *SocialGitlab) GetGroupsPage(client *http.Client, url string) ([]string,
 		}
 	}
 
-	return fullPaths, next
+	return fullPaths, next, nil
 }
 
 func (s *SocialGitlab) UserInfo(client *http.Client, token *oauth2.Token) (*BasicUserInfo, error) {
+	return s.UserInfoContext(context.Background(), client, token)
+}
 
+// UserInfoContext returns the user with the groups when a setting uses them. Without a group cache, the user and
+// the groups are fetched concurrently: a user who is not allowed to log in cancels the pages of groups still being
+// read, while errors reading the groups are only checked once both are fetched. The group cache is keyed by the id
+// of the user, so with a cache the groups are fetched after the user.
+func (s *SocialGitlab) UserInfoContext(ctx context.Context, client *http.Client, token *oauth2.Token) (*BasicUserInfo, error) {
+	// the groups take a request per page, skip them unless a setting uses them
+	if !s.needsGroups() {
+		userInfo, err := s.getUser(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+
+		key := groupCacheKey(s.apiUrl, userInfo.Id)
+		userInfo.loadGroups = func() ([]string, error) {
+			return s.getUserGroups(context.Background(), client, key, userInfo.Login)
+		}
+		return userInfo, nil
+	}
+
+	if s.groupCacheTTL > 0 {
+		userInfo, err := s.getUser(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+
+		groups, err := s.getUserGroups(ctx, client, groupCacheKey(s.apiUrl, userInfo.Id), userInfo.Login)
+		return s.checkGroups(userInfo, groups, err)
+	}
+
+	var (
+		userInfo  *BasicUserInfo
+		groups    []string
+		groupsErr error
+	)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		var err error
+		userInfo, err = s.getUser(gctx, client)
+		return err
+	})
+	g.Go(func() error {
+		// the key and the login are only used by the cache
+		groups, groupsErr = s.getUserGroups(gctx, client, "", "")
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return s.checkGroups(userInfo, groups, groupsErr)
+}
+
+// getUser fetches the user and returns an error for users whose state does not allow them to log in
+func (s *SocialGitlab) getUser(ctx context.Context, client *http.Client) (*BasicUserInfo, error) {
 	var data struct {
 		Id       int
 		Username string
@@ -195,7 +1311,7 @@ func (s *SocialGitlab) UserInfo(client *http.Client, token *oauth2.Token) (*Basi
 		State    string
 	}
 
-	response, err := HttpGet(client, s.apiUrl+"/user")
+	response, err := httpGetContext(ctx, client, s.apiUrl+"/user")
 	if err != nil {
 		return nil, fmt.Errorf("Error getting user info: %s", err)
 	}
@@ -205,23 +1321,35 @@ func (s *SocialGitlab) UserInfo(client *http.Client, token *oauth2.Token) (*Basi
 		return nil, fmt.Errorf("Error getting user info: %s", err)
 	}
 
-	if data.State != "active" {
-		return nil, fmt.Errorf("User %s is inactive", data.Username)
+	if err := s.checkUserState(data.State); err != nil {
+		s.log.Info("GitLab user not allowed to log in", "login", data.Username, "state", data.State)
+		return nil, err
 	}
 
-	groups := s.GetGroups(client)
+	return &BasicUserInfo{
+		Id:    fmt.Sprintf("%d", data.Id),
+		Name:  data.Name,
+		Login: data.Username,
+		Email: data.Email,
+	}, nil
+}
 
-	userInfo := &BasicUserInfo{
-		Id:     fmt.Sprintf("%d", data.Id),
-		Name:   data.Name,
-		Login:  data.Username,
-		Email:  data.Email,
-		Groups: groups,
-	}
+// checkGroups sets the groups of the user and returns an error when they do not allow the user to log in
+func (s *SocialGitlab) checkGroups(userInfo *BasicUserInfo, groups []string, err error) (*BasicUserInfo, error) {
+	userInfo.Groups = groups
+	userInfo.GroupsPartial = err != nil
 
 	if !s.IsGroupMember(groups) {
+		// a missing group may be on a page that could not be read
+		if err != nil {
+			return nil, ErrGroupsUnavailable
+		}
 		return nil, ErrMissingGroupMembership
 	}
 
+	if err != nil && len(s.allowedGroups) > 0 && !s.allowPartialGroups {
+		return nil, ErrGroupsUnavailable
+	}
+
 	return userInfo, nil
 }
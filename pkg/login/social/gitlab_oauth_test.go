@@ -0,0 +1,1522 @@
+package social
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	ini "gopkg.in/ini.v1"
+)
+
+func TestGitlabUpdateDashboard(t *testing.T) {
+	Convey("Given a GitLab repository", t, func() {
+		existingFiles := map[string]bool{}
+		// fileCommits and fileHashes are the last commit and the content sha256 of the existing files
+		fileCommits := map[string]string{}
+		fileHashes := map[string]string{}
+		fileChecks := 0
+		var checkedRefs []string
+		var committedActions []string
+		var privateTokens []string
+		var sudoHeaders []string
+		var treeQueries []string
+		var commitQueries []string
+		var rawRefs []string
+		var committedProjects []string
+		var committedBranches []string
+		var committedMessages []string
+		var committedPaths []string
+		var committedContents []string
+		forbidSudo := false
+
+		// commitErrors are returned by the next commits, like GitLab rejecting an action for the file
+		type commitError struct {
+			status int
+			body   string
+		}
+		var commitErrors []commitError
+		var rejectedActions []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "HEAD" && strings.HasPrefix(r.URL.EscapedPath(), "/api/v4/projects/1/repository/files/"):
+				fileChecks++
+				checkedRefs = append(checkedRefs, r.URL.Query().Get("ref"))
+
+				filePath := strings.TrimPrefix(r.URL.Path, "/api/v4/projects/1/repository/files/")
+				if !existingFiles[filePath] {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("X-Gitlab-File-Path", filePath)
+				w.Header().Set("X-Gitlab-Last-Commit-Id", fileCommits[filePath])
+				w.Header().Set("X-Gitlab-Content-Sha256", fileHashes[filePath])
+				w.WriteHeader(http.StatusOK)
+
+			case r.Method == "GET" && r.URL.Path == "/api/v4/projects/1/repository/tree":
+				treeQueries = append(treeQueries, r.URL.RawQuery)
+				if r.URL.Query().Get("page") == "1" {
+					w.Header().Set("X-Next-Page", "2")
+					w.Write([]byte(`[{"type": "tree", "path": "dashboards/Team"}, {"type": "blob", "path": "dashboards/home.json"}, {"type": "blob", "path": "dashboards/README.md"}]`))
+					return
+				}
+				w.Write([]byte(`[{"type": "blob", "path": "dashboards/Team/service.json"}, {"type": "blob", "path": "dashboards/Team/api.jsonnet"}, {"type": "blob", "path": "dashboards/Team/panels.libsonnet"}]`))
+
+			case r.Method == "GET" && r.URL.Path == "/api/v4/projects/1/repository/commits":
+				commitQueries = append(commitQueries, r.URL.RawQuery)
+				w.Write([]byte(`[{"id": "e83c5163316f89bfbde7d9ab23ca2e25604af290", "author_name": "Jane Doe", "author_email": "jane@example.com"}]`))
+
+			case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/api/v4/projects/1/repository/commits/"):
+				if strings.TrimPrefix(r.URL.Path, "/api/v4/projects/1/repository/commits/") != "release/1.0" {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message": "404 Commit Not Found"}`))
+					return
+				}
+				w.Write([]byte(`{"id": "e83c5163316f89bfbde7d9ab23ca2e25604af290"}`))
+
+			case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/raw"):
+				rawRefs = append(rawRefs, r.URL.Query().Get("ref"))
+				if strings.Contains(r.URL.Path, "missing") {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message": "404 File Not Found"}`))
+					return
+				}
+				w.Write([]byte(`{"title": "Service"}`))
+
+			case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/repository/commits"):
+				committedProjects = append(committedProjects, strings.Split(r.URL.Path, "/")[4])
+				privateTokens = append(privateTokens, r.Header.Get("Private-Token"))
+				sudoHeaders = append(sudoHeaders, r.Header.Get("Sudo"))
+
+				if forbidSudo && r.Header.Get("Sudo") != "" {
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte(`{"message": "403 Forbidden - Must be admin to use sudo"}`))
+					return
+				}
+
+				var body struct {
+					Branch  string `json:"branch"`
+					Message string `json:"commit_message"`
+					Actions []struct {
+						Action   string `json:"action"`
+						FilePath string `json:"file_path"`
+						Content  string `json:"content"`
+					} `json:"actions"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if len(commitErrors) > 0 {
+					rejectedActions = append(rejectedActions, body.Actions[0].Action)
+					w.WriteHeader(commitErrors[0].status)
+					w.Write([]byte(commitErrors[0].body))
+					commitErrors = commitErrors[1:]
+					return
+				}
+
+				committedBranches = append(committedBranches, body.Branch)
+				committedMessages = append(committedMessages, body.Message)
+				for _, action := range body.Actions {
+					committedActions = append(committedActions, action.Action)
+					committedPaths = append(committedPaths, action.FilePath)
+					committedContents = append(committedContents, action.Content)
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id": "e83c5163316f89bfbde7d9ab23ca2e25604af290"}`))
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		repo := &GrafanaGitlabRepo{
+			OrgId:          1,
+			RepoId:         1,
+			Branch:         "master",
+			DashboardsPath: "dashboards",
+			Url:            server.URL,
+		}
+
+		connector := &SocialGitlab{
+			SocialBase: &SocialBase{log: log.New("oauth.gitlab")},
+			repos:      []*GrafanaGitlabRepo{repo},
+		}
+
+		var identity *models.ExternalIdentity
+		updateDashboard := func(action DashboardAction) *UpdateDashboardOptions {
+			options := &UpdateDashboardOptions{
+				Action:    action,
+				Title:     "Production",
+				Name:      "production",
+				Folder:    "General",
+				Dashboard: "{}",
+				OrgId:     1,
+				UserId:    10,
+
+				ExternalIdentity: identity,
+			}
+			So(connector.UpdateDashboard(options, "token"), ShouldBeNil)
+			return options
+		}
+
+		Convey("Without file verification", func() {
+			Convey("Should commit with the action chosen by Grafana", func() {
+				existingFiles["dashboards/General/production.json"] = true
+
+				options := updateDashboard(CreateDashboard)
+				So(committedActions, ShouldResemble, []string{"create"})
+				So(fileChecks, ShouldEqual, 0)
+				So(sudoHeaders, ShouldResemble, []string{""})
+				So(options.Result.CommitMode, ShouldEqual, models.GitCommitModeUser)
+				So(options.Result.CommitSha, ShouldEqual, "e83c5163316f89bfbde7d9ab23ca2e25604af290")
+				So(options.Result.FilePath, ShouldEqual, "dashboards/General/production.json")
+			})
+		})
+
+		Convey("With dashboards selecting a repository", func() {
+			library := &GrafanaGitlabRepo{Name: "library", OrgId: 1, RepoId: 2, Branch: "master", DashboardsPath: "shared", Url: server.URL}
+			otherOrg := &GrafanaGitlabRepo{Name: "other", OrgId: 2, RepoId: 3, Branch: "master", Url: server.URL}
+			connector.repos = append(connector.repos, library, otherOrg)
+
+			commit := func(repoName string) (*UpdateDashboardOptions, error) {
+				options := &UpdateDashboardOptions{
+					Action:    UpdateDashboard,
+					Title:     "Production",
+					Name:      "production",
+					Folder:    "General",
+					Dashboard: "{}",
+					OrgId:     1,
+					Repo:      repoName,
+				}
+				return options, connector.UpdateDashboard(options, "token")
+			}
+
+			Convey("Should commit to the repository selected by name or id", func() {
+				options, err := commit("library")
+				So(err, ShouldBeNil)
+				So(options.Result.FilePath, ShouldEqual, "shared/General/production.json")
+
+				_, err = commit("2")
+				So(err, ShouldBeNil)
+				So(committedProjects, ShouldResemble, []string{"2", "2"})
+			})
+
+			Convey("Should commit to the repository of the organization by default", func() {
+				_, err := commit("")
+				So(err, ShouldBeNil)
+				So(committedProjects, ShouldResemble, []string{"1"})
+			})
+
+			Convey("Should reject repositories that are not configured for the organization", func() {
+				_, err := commit("unknown")
+				So(err, ShouldEqual, models.ErrDashboardGitRepoNotFound)
+
+				_, err = commit("other")
+				So(err, ShouldEqual, models.ErrDashboardGitRepoNotFound)
+				So(committedProjects, ShouldBeEmpty)
+			})
+		})
+
+		Convey("With request ids", func() {
+			commit := func() {
+				options := &UpdateDashboardOptions{
+					Action:    CreateDashboard,
+					Title:     "Production",
+					Name:      "production",
+					Folder:    "General",
+					Dashboard: "{}",
+					OrgId:     1,
+					RequestId: "f3a9c2",
+				}
+				So(connector.UpdateDashboard(options, "token"), ShouldBeNil)
+			}
+
+			Convey("Should add the request id trailer for repositories enabling it", func() {
+				repo.RequestIdTrailer = true
+				commit()
+				So(committedMessages, ShouldResemble, []string{"Create Production dashboard\n\nRequest-Id: f3a9c2"})
+			})
+
+			Convey("Should not commit the request id by default", func() {
+				commit()
+				So(committedMessages, ShouldResemble, []string{"Create Production dashboard"})
+			})
+		})
+
+		Convey("With branch overrides", func() {
+			repo.AllowBranchOverride = []string{"preview/*", "release"}
+
+			commit := func(branch string) (*UpdateDashboardOptions, error) {
+				options := &UpdateDashboardOptions{
+					Action:    UpdateDashboard,
+					Title:     "Production",
+					Name:      "production",
+					Folder:    "General",
+					Dashboard: "{}",
+					OrgId:     1,
+					Branch:    branch,
+				}
+				return options, connector.UpdateDashboard(options, "token")
+			}
+
+			Convey("Should commit to a branch matching an allowed pattern", func() {
+				options, err := commit("preview/login")
+				So(err, ShouldBeNil)
+				So(options.Result.Branch, ShouldEqual, "preview/login")
+
+				_, err = commit("release")
+				So(err, ShouldBeNil)
+				So(committedBranches, ShouldResemble, []string{"preview/login", "release"})
+				So(repo.Branch, ShouldEqual, "master")
+			})
+
+			Convey("Should reject branches that are not allowed", func() {
+				_, err := commit("preview/login/fix")
+				So(err, ShouldEqual, models.ErrDashboardGitBranchNotAllowed)
+
+				_, err = commit("master-copy")
+				So(err, ShouldEqual, models.ErrDashboardGitBranchNotAllowed)
+				So(committedBranches, ShouldBeEmpty)
+			})
+
+			Convey("Should commit to the branch of the repository without override", func() {
+				options, err := commit("")
+				So(err, ShouldBeNil)
+				So(options.Result.Branch, ShouldBeEmpty)
+				So(committedBranches, ShouldResemble, []string{"master"})
+			})
+		})
+
+		Convey("With audit snapshots", func() {
+			auditNow = func() time.Time { return time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC) }
+			repo.AuditPath = "audit"
+
+			update := func(action DashboardAction) {
+				options := &UpdateDashboardOptions{
+					Action:    action,
+					Title:     "Production",
+					Name:      "production",
+					Uid:       "prod",
+					Folder:    "General",
+					Dashboard: "{}",
+					OrgId:     1,
+				}
+				So(connector.UpdateDashboard(options, "token"), ShouldBeNil)
+			}
+
+			Convey("Should add the snapshot to the commit of the dashboard on the same branch", func() {
+				repo.AuditBranch = "master"
+
+				update(UpdateDashboard)
+				So(committedBranches, ShouldResemble, []string{"master"})
+				So(committedActions, ShouldResemble, []string{"update", "create"})
+				So(committedPaths, ShouldResemble, []string{"dashboards/General/production.json", "audit/prod/20190901T120000.000Z-update.json"})
+			})
+
+			Convey("Should commit the snapshot to the audit branch after the dashboard", func() {
+				repo.AuditBranch = "audit"
+
+				update(DeleteDashboard)
+				So(committedBranches, ShouldResemble, []string{"master", "audit"})
+				So(committedActions, ShouldResemble, []string{"delete", "create"})
+				So(committedPaths[1], ShouldEqual, "audit/prod/20190901T120000.000Z-delete.json")
+			})
+
+			Convey("Should not write snapshots by default", func() {
+				update(UpdateDashboard)
+				So(committedActions, ShouldResemble, []string{"update"})
+			})
+
+			Reset(func() {
+				auditNow = time.Now
+			})
+		})
+
+		Convey("With json formatting", func() {
+			update := func() {
+				options := &UpdateDashboardOptions{
+					Action:    UpdateDashboard,
+					Name:      "production",
+					Folder:    "General",
+					Dashboard: "{\n  \"panels\": [],\n  \"title\": \"Production\"\n}",
+					OrgId:     1,
+				}
+				So(connector.UpdateDashboard(options, "token"), ShouldBeNil)
+			}
+
+			Convey("Should commit the dashboard indented with two spaces by default", func() {
+				update()
+				So(committedContents, ShouldResemble, []string{"{\n  \"panels\": [],\n  \"title\": \"Production\"\n}"})
+			})
+
+			Convey("Should commit the dashboard with the indent and trailing newline of the repository", func() {
+				repo.JsonIndent = "\t"
+				repo.JsonTrailingNewline = true
+
+				update()
+				So(committedContents, ShouldResemble, []string{"{\n\t\"panels\": [],\n\t\"title\": \"Production\"\n}\n"})
+			})
+
+			Convey("Should format the snapshots and moved files too", func() {
+				repo.JsonIndent = "    "
+				repo.AuditBranch = "master"
+				repo.AuditPath = "audit"
+				repo.AccessToken = "repo-token"
+
+				update()
+				_, err := connector.MoveFiles(1, []FileMove{
+					{From: "dashboards/General/a.json", To: "dashboards/General/b.json", Content: `{"title":"B"}`},
+				}, "Move")
+				So(err, ShouldBeNil)
+
+				formatted := "{\n    \"panels\": [],\n    \"title\": \"Production\"\n}"
+				So(committedContents, ShouldResemble, []string{formatted, formatted, "{\n    \"title\": \"B\"\n}"})
+			})
+		})
+
+		Convey("With file verification", func() {
+			repo.VerifyFileExistence = true
+
+			Convey("Should update a file that already exists when Grafana creates the dashboard", func() {
+				existingFiles["dashboards/General/production.json"] = true
+
+				updateDashboard(CreateDashboard)
+				So(committedActions, ShouldResemble, []string{"update"})
+				So(checkedRefs, ShouldResemble, []string{"master"})
+			})
+
+			Convey("Should create a file that is missing when Grafana updates the dashboard", func() {
+				updateDashboard(UpdateDashboard)
+				So(committedActions, ShouldResemble, []string{"create"})
+				So(fileChecks, ShouldEqual, 1)
+			})
+
+			Convey("Should keep matching actions", func() {
+				updateDashboard(CreateDashboard)
+				existingFiles["dashboards/General/production.json"] = true
+				updateDashboard(UpdateDashboard)
+				So(committedActions, ShouldResemble, []string{"create", "update"})
+			})
+
+			Convey("Should not check the file when deleting", func() {
+				updateDashboard(DeleteDashboard)
+				So(committedActions, ShouldResemble, []string{"delete"})
+				So(fileChecks, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the file was changed in the repository since the last sync", func() {
+			filePath := "dashboards/General/production.json"
+			existingFiles[filePath] = true
+			fileCommits[filePath] = "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678"
+			fileHashes[filePath] = contentHash(`{"title": "Edited in GitLab"}`)
+
+			lastSync := &models.DashboardGitSync{
+				RepoId:      1,
+				FilePath:    filePath,
+				CommitSha:   "e83c5163316f89bfbde7d9ab23ca2e25604af290",
+				ContentHash: contentHash("{}"),
+			}
+			syncDashboard := func() (*UpdateDashboardOptions, error) {
+				options := &UpdateDashboardOptions{
+					Action:    UpdateDashboard,
+					Title:     "Production",
+					Name:      "production",
+					Folder:    "General",
+					Dashboard: "{}",
+					OrgId:     1,
+					LastSync:  lastSync,
+				}
+				return options, connector.UpdateDashboard(options, "token")
+			}
+
+			Convey("Should overwrite the change by default", func() {
+				options, err := syncDashboard()
+				So(err, ShouldBeNil)
+				So(committedActions, ShouldResemble, []string{"update"})
+				So(options.Result.ContentHash, ShouldEqual, contentHash(committedContents[0]))
+				So(fileChecks, ShouldEqual, 0)
+			})
+
+			Convey("Should skip the commit and report the foreign commit when skipping", func() {
+				repo.ConflictPolicy = models.GitConflictSkip
+
+				options, err := syncDashboard()
+				So(err, ShouldBeNil)
+				So(committedActions, ShouldBeEmpty)
+				So(options.Result, ShouldResemble, &DashboardSyncResult{
+					FilePath:          filePath,
+					RepoId:            1,
+					ConflictCommitSha: "a1b2c3d4e5f60718293a4b5c6d7e8f9012345678",
+				})
+			})
+
+			Convey("Should fail with a conflict when failing", func() {
+				repo.ConflictPolicy = models.GitConflictFail
+
+				options, err := syncDashboard()
+				So(err, ShouldEqual, models.ErrDashboardGitConflict)
+				So(options.Result, ShouldBeNil)
+				So(committedActions, ShouldBeEmpty)
+			})
+
+			Convey("Should commit when the content is still the synced content", func() {
+				repo.ConflictPolicy = models.GitConflictFail
+				fileHashes[filePath] = lastSync.ContentHash
+
+				_, err := syncDashboard()
+				So(err, ShouldBeNil)
+				So(committedActions, ShouldResemble, []string{"update"})
+			})
+
+			Convey("Should commit when the last commit of the file is the last sync", func() {
+				repo.ConflictPolicy = models.GitConflictFail
+				fileCommits[filePath] = lastSync.CommitSha
+
+				_, err := syncDashboard()
+				So(err, ShouldBeNil)
+				So(committedActions, ShouldResemble, []string{"update"})
+			})
+
+			Convey("Should not check files the dashboard was never committed to", func() {
+				repo.ConflictPolicy = models.GitConflictFail
+				lastSync.FilePath = "dashboards/Team/production.json"
+
+				_, err := syncDashboard()
+				So(err, ShouldBeNil)
+				So(committedActions, ShouldResemble, []string{"update"})
+				So(fileChecks, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the file is not in the expected state", func() {
+			Convey("Should create the file when GitLab rejects the update", func() {
+				for _, message := range []string{
+					`{"message": "A file with this name doesn't exist"}`,
+					`{"message": "the file does not exist"}`,
+					`{"message": "404 File Not Found"}`,
+					`{"error": "File does not exist"}`,
+				} {
+					committedActions, rejectedActions = nil, nil
+					commitErrors = []commitError{{status: http.StatusBadRequest, body: message}}
+
+					options := updateDashboard(UpdateDashboard)
+					So(rejectedActions, ShouldResemble, []string{"update"})
+					So(committedActions, ShouldResemble, []string{"create"})
+					So(options.Result.FallbackAction, ShouldEqual, models.GitFallbackCreate)
+					So(options.Result.CommitSha, ShouldEqual, "e83c5163316f89bfbde7d9ab23ca2e25604af290")
+				}
+			})
+
+			Convey("Should update the file when GitLab rejects the create", func() {
+				for _, message := range []string{
+					`{"message": "A file with this name already exists"}`,
+					`{"message": "File already exists"}`,
+				} {
+					committedActions, rejectedActions = nil, nil
+					commitErrors = []commitError{{status: http.StatusBadRequest, body: message}}
+
+					options := updateDashboard(CreateDashboard)
+					So(rejectedActions, ShouldResemble, []string{"create"})
+					So(committedActions, ShouldResemble, []string{"update"})
+					So(options.Result.FallbackAction, ShouldEqual, models.GitFallbackUpdate)
+				}
+			})
+
+			Convey("Should treat deleting a missing file as done", func() {
+				commitErrors = []commitError{{status: http.StatusBadRequest, body: `{"message": "A file with this name doesn't exist"}`}}
+
+				options := updateDashboard(DeleteDashboard)
+				So(rejectedActions, ShouldResemble, []string{"delete"})
+				So(committedActions, ShouldBeEmpty)
+				So(options.Result.FallbackAction, ShouldEqual, models.GitFallbackSkipDelete)
+				So(options.Result.CommitSha, ShouldBeEmpty)
+				So(options.Result.FilePath, ShouldEqual, "dashboards/General/production.json")
+			})
+
+			Convey("Should only retry once", func() {
+				commitErrors = []commitError{
+					{status: http.StatusBadRequest, body: `{"message": "A file with this name doesn't exist"}`},
+					{status: http.StatusBadRequest, body: `{"message": "A file with this name already exists"}`},
+				}
+
+				err := connector.UpdateDashboard(&UpdateDashboardOptions{Action: UpdateDashboard, Name: "production", Folder: "General", Dashboard: "{}", OrgId: 1}, "token")
+				So(err, ShouldEqual, models.ErrDashboardGitlabSync)
+				So(rejectedActions, ShouldResemble, []string{"update", "create"})
+				So(committedActions, ShouldBeEmpty)
+			})
+
+			Convey("Should not retry other errors", func() {
+				commitErrors = []commitError{{status: http.StatusBadRequest, body: `{"message": "You can only create or edit files when you are on a branch"}`}}
+
+				err := connector.UpdateDashboard(&UpdateDashboardOptions{Action: UpdateDashboard, Name: "production", Folder: "General", Dashboard: "{}", OrgId: 1}, "token")
+				So(err, ShouldEqual, models.ErrDashboardGitlabSync)
+				So(rejectedActions, ShouldResemble, []string{"update"})
+			})
+		})
+
+		Convey("With sudo commits", func() {
+			repo.AccessToken = "repo-token"
+			repo.SudoCommits = true
+
+			identity = &models.ExternalIdentity{Provider: "oauth_gitlab", ExternalId: "42", Login: "jdoe"}
+
+			Convey("Should commit on behalf of the GitLab user", func() {
+				options := updateDashboard(UpdateDashboard)
+				So(sudoHeaders, ShouldResemble, []string{"42"})
+				So(privateTokens, ShouldResemble, []string{"repo-token"})
+				So(options.Result.CommitMode, ShouldEqual, models.GitCommitModeSudo)
+			})
+
+			Convey("Should fall back to the repository user when sudo is forbidden", func() {
+				forbidSudo = true
+
+				options := updateDashboard(UpdateDashboard)
+				So(sudoHeaders, ShouldResemble, []string{"42", ""})
+				So(options.Result.CommitMode, ShouldEqual, models.GitCommitModeService)
+			})
+
+			Convey("Should credit the user as co-author when committing as the repository user", func() {
+				forbidSudo = true
+
+				options := &UpdateDashboardOptions{
+					Action:    UpdateDashboard,
+					Title:     "Production",
+					Name:      "production",
+					Folder:    "General",
+					Dashboard: "{}",
+					OrgId:     1,
+					UserId:    10,
+					Author:    &models.GitCommitAuthor{Name: "Jane Doe", Email: "jane@example.com"},
+
+					ExternalIdentity: identity,
+				}
+				So(connector.UpdateDashboard(options, "token"), ShouldBeNil)
+				// the forbidden sudo commit is not recorded
+				So(sudoHeaders, ShouldResemble, []string{"42", ""})
+				So(committedMessages, ShouldResemble, []string{"Update Production dashboard\n\nCo-authored-by: Jane Doe <jane@example.com>"})
+			})
+
+			Convey("Should commit as the repository user when the GitLab user is unknown", func() {
+				identity = nil
+
+				options := updateDashboard(UpdateDashboard)
+				So(sudoHeaders, ShouldResemble, []string{""})
+				So(privateTokens, ShouldResemble, []string{"repo-token"})
+				So(options.Result.CommitMode, ShouldEqual, models.GitCommitModeService)
+			})
+
+			Convey("Should not commit on behalf of the identity of another provider", func() {
+				identity = &models.ExternalIdentity{Provider: "oauth_github", ExternalId: "42"}
+
+				options := updateDashboard(UpdateDashboard)
+				So(sudoHeaders, ShouldResemble, []string{""})
+				So(options.Result.CommitMode, ShouldEqual, models.GitCommitModeService)
+			})
+
+			Reset(func() {
+				identity = nil
+			})
+		})
+
+		Convey("When exporting resources with the repository access token", func() {
+			So(connector.ExportSettings(1), ShouldBeNil)
+
+			repo.AccessToken = "repo-token"
+			repo.ExportDatasources = true
+			So(connector.ExportSettings(1), ShouldResemble, &ExportSettings{Datasources: true, DashboardsPath: "dashboards"})
+
+			repo.ExportPermissions = true
+			So(connector.ExportSettings(1).Permissions, ShouldBeTrue)
+			So(connector.ExportSettings(1).PermissionEmails, ShouldBeFalse)
+			So(connector.ExportSettings(2), ShouldBeNil)
+
+			Convey("Should create or update files depending on their existence", func() {
+				So(connector.WriteFile(1, "_resources/datasources/graphite.yaml", "content", "Update"), ShouldBeNil)
+				existingFiles["_resources/datasources/graphite.yaml"] = true
+				So(connector.WriteFile(1, "_resources/datasources/graphite.yaml", "content", "Update"), ShouldBeNil)
+
+				So(committedActions, ShouldResemble, []string{"create", "update"})
+				So(privateTokens, ShouldResemble, []string{"repo-token", "repo-token"})
+			})
+
+			Convey("Should move files in one commit, deleting before writing", func() {
+				existingFiles["dashboards/General/a.json"] = true
+				existingFiles["dashboards/General/b.json"] = true
+				existingFiles["grafana/General/c.json"] = true
+
+				sha, err := connector.MoveFiles(1, []FileMove{
+					{From: "dashboards/General/a.json", To: "dashboards/General/b.json", Content: "a"},
+					{From: "dashboards/General/b.json", To: "grafana/General/b.json", Content: "b"},
+					{From: "dashboards/General/missing.json", To: "grafana/General/c.json", Content: "c"},
+				}, "Move")
+				So(err, ShouldBeNil)
+				So(sha, ShouldEqual, "e83c5163316f89bfbde7d9ab23ca2e25604af290")
+				So(committedActions, ShouldResemble, []string{"delete", "delete", "create", "create", "update"})
+				So(connector.DashboardFilePath(1, "General", "b"), ShouldEqual, "dashboards/General/b.json")
+			})
+
+			Convey("Should list and read the dashboard files", func() {
+				files, err := connector.ListDashboardFiles(1)
+				So(err, ShouldBeNil)
+				So(files, ShouldResemble, []DashboardFile{
+					{Path: "dashboards/home.json", Folder: "General"},
+					{Path: "dashboards/Team/service.json", Folder: "Team"},
+				})
+				So(len(treeQueries), ShouldEqual, 2)
+				So(treeQueries[0], ShouldContainSubstring, "recursive=true")
+				So(treeQueries[0], ShouldContainSubstring, "ref=master")
+
+				content, err := connector.ReadFile(1, "dashboards/Team/service.json")
+				So(err, ShouldBeNil)
+				So(content, ShouldEqual, `{"title": "Service"}`)
+			})
+
+			Convey("Should read the files at a ref, telling unknown refs from missing files", func() {
+				content, err := connector.ReadFileAtRef(1, "dashboards/Team/service.json", "release/1.0")
+				So(err, ShouldBeNil)
+				So(content, ShouldEqual, `{"title": "Service"}`)
+				So(rawRefs, ShouldResemble, []string{"release/1.0"})
+
+				_, err = connector.ReadFileAtRef(1, "dashboards/Team/missing.json", "release/1.0")
+				So(err, ShouldEqual, ErrGitFileNotFound)
+
+				_, err = connector.ReadFileAtRef(1, "dashboards/Team/service.json", "0123abc")
+				So(err, ShouldEqual, ErrGitRefNotFound)
+			})
+
+			Convey("Should list the jsonnet files when they are rendered", func() {
+				So(connector.JsonnetSettings(1), ShouldBeNil)
+
+				repo.Jsonnet = &JsonnetSettings{ImportPaths: []string{"lib"}, Timeout: time.Second, MaxStack: 500}
+				So(connector.JsonnetSettings(1), ShouldEqual, repo.Jsonnet)
+
+				files, err := connector.ListDashboardFiles(1)
+				So(err, ShouldBeNil)
+				So(files, ShouldResemble, []DashboardFile{
+					{Path: "dashboards/home.json", Folder: "General"},
+					{Path: "dashboards/Team/service.json", Folder: "Team"},
+					{Path: "dashboards/Team/api.jsonnet", Folder: "Team"},
+				})
+			})
+
+			Convey("Should return the author of the last commit of a file", func() {
+				author, err := connector.FileAuthor(1, "dashboards/Team/service.json")
+				So(err, ShouldBeNil)
+				So(author, ShouldResemble, &ExternalIdentity{Name: "Jane Doe", Email: "jane@example.com"})
+				So(author.String(), ShouldEqual, "Jane Doe <jane@example.com>")
+
+				So(len(commitQueries), ShouldEqual, 1)
+				So(commitQueries[0], ShouldContainSubstring, "per_page=1")
+				So(commitQueries[0], ShouldContainSubstring, "ref_name=master")
+				So(commitQueries[0], ShouldContainSubstring, "path=dashboards%2FTeam%2Fservice.json")
+			})
+
+			Convey("Should only delete files that exist", func() {
+				So(connector.DeleteFile(1, "_resources/datasources/graphite.yaml", "Delete"), ShouldBeNil)
+				So(committedActions, ShouldBeEmpty)
+
+				existingFiles["_resources/datasources/graphite.yaml"] = true
+				So(connector.DeleteFile(1, "_resources/datasources/graphite.yaml", "Delete"), ShouldBeNil)
+				So(committedActions, ShouldResemble, []string{"delete"})
+			})
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestGitlabDashboardsPath(t *testing.T) {
+	Convey("Given a GitLab repository", t, func() {
+		treeStatus := http.StatusOK
+		defaultBranch := `"master"`
+		branchStatus := http.StatusOK
+		var committedPaths []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/api/v4/projects/1/repository/tree":
+				w.WriteHeader(treeStatus)
+				if treeStatus == http.StatusOK {
+					w.Write([]byte(`[{"type": "blob", "path": "dashboards/home.json"}]`))
+					return
+				}
+				w.Write([]byte(`{"message": "404 Tree Not Found"}`))
+
+			case r.Method == "GET" && r.URL.Path == "/api/v4/projects/1":
+				w.Write([]byte(`{"id": 1, "default_branch": ` + defaultBranch + `}`))
+
+			case r.Method == "GET" && r.URL.Path == "/api/v4/projects/1/repository/branches/master":
+				w.WriteHeader(branchStatus)
+				w.Write([]byte(`{"name": "master"}`))
+
+			case r.Method == "POST" && r.URL.Path == "/api/v4/projects/1/repository/commits":
+				var body struct {
+					Actions []struct {
+						FilePath string `json:"file_path"`
+					} `json:"actions"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				for _, action := range body.Actions {
+					committedPaths = append(committedPaths, action.FilePath)
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id": "e83c5163316f89bfbde7d9ab23ca2e25604af290"}`))
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		connector := &SocialGitlab{
+			SocialBase: &SocialBase{log: log.New("oauth.gitlab")},
+			repos: []*GrafanaGitlabRepo{
+				{OrgId: 1, RepoId: 1, Branch: "master", DashboardsPath: "/dashboards/", Url: server.URL},
+			},
+		}
+
+		Convey("Should list the files of an existing path", func() {
+			files, err := connector.ListDashboardFiles(1)
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 1)
+
+			exists, err := connector.DashboardsPathExists(1)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+		})
+
+		Convey("Should treat a missing path as empty", func() {
+			treeStatus = http.StatusNotFound
+
+			files, err := connector.ListDashboardFiles(1)
+			So(err, ShouldBeNil)
+			So(files, ShouldBeEmpty)
+
+			exists, err := connector.DashboardsPathExists(1)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+		})
+
+		Convey("Should treat a repository without commits as empty", func() {
+			treeStatus = http.StatusNotFound
+			defaultBranch = "null"
+			branchStatus = http.StatusNotFound
+
+			files, err := connector.ListDashboardFiles(1)
+			So(err, ShouldBeNil)
+			So(files, ShouldBeEmpty)
+		})
+
+		Convey("Should fail when the branch is missing", func() {
+			treeStatus = http.StatusNotFound
+			branchStatus = http.StatusNotFound
+
+			_, err := connector.ListDashboardFiles(1)
+			So(err, ShouldNotBeNil)
+
+			_, err = connector.DashboardsPathExists(1)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should fail when GitLab fails", func() {
+			treeStatus = http.StatusInternalServerError
+
+			_, err := connector.ListDashboardFiles(1)
+			So(err, ShouldNotBeNil)
+
+			_, err = connector.DashboardsPathExists(1)
+			So(err, ShouldNotBeNil)
+
+			treeStatus = http.StatusNotFound
+			branchStatus = http.StatusInternalServerError
+
+			_, err = connector.ListDashboardFiles(1)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should create the path with a keep file", func() {
+			sha, err := connector.CreateDashboardsPath(1, "Create dashboards directory")
+			So(err, ShouldBeNil)
+			So(sha, ShouldEqual, "e83c5163316f89bfbde7d9ab23ca2e25604af290")
+			So(committedPaths, ShouldResemble, []string{"dashboards/.gitkeep"})
+			So(dashboardsPathKeepFile(""), ShouldEqual, ".gitkeep")
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestGitlabCommitMessage(t *testing.T) {
+	Convey("Given a dashboard change", t, func() {
+		options := &UpdateDashboardOptions{
+			Action:  UpdateDashboard,
+			Title:   "Production",
+			Message: "Raise thresholds",
+			Source:  "api",
+		}
+
+		Convey("Should add the co-authors as trailers after the source", func() {
+			options.Coauthors = []models.GitCommitAuthor{
+				{Name: "Jane Doe", Email: "jane@example.com"},
+				{Name: "deploy\nbot", Email: " bot@example.com "},
+			}
+
+			So(createCommitMessage(options, nil), ShouldEqual, `Update Production dashboard
+
+Raise thresholds
+
+Source: api
+Co-authored-by: Jane Doe <jane@example.com>
+Co-authored-by: deploy bot <bot@example.com>`)
+		})
+
+		Convey("Should credit each email once and skip co-authors without email", func() {
+			options.Action = CreateDashboard
+			options.Source = ""
+			options.Coauthors = []models.GitCommitAuthor{
+				{Name: "Jane Doe", Email: "jane@example.com"},
+				{Name: "No Email"},
+				{Email: "john@example.com"},
+			}
+
+			So(createCommitMessage(options, nil, models.GitCommitAuthor{Name: "Jane", Email: "JANE@example.com"}), ShouldEqual, `Create Production dashboard
+
+Co-authored-by: Jane Doe <jane@example.com>
+Co-authored-by: john@example.com <john@example.com>`)
+		})
+
+		Convey("Should add the request id after the source", func() {
+			options.RequestId = "f3a9c2"
+			options.Coauthors = []models.GitCommitAuthor{{Name: "Jane Doe", Email: "jane@example.com"}}
+
+			So(createCommitMessage(options, nil), ShouldEqual, `Update Production dashboard
+
+Raise thresholds
+
+Source: api
+Request-Id: f3a9c2
+Co-authored-by: Jane Doe <jane@example.com>`)
+		})
+
+		Convey("Should not add trailers without source and co-authors", func() {
+			options.Action = DeleteDashboard
+			options.Source = ""
+
+			So(createCommitMessage(options, nil), ShouldEqual, "Delete Production dashboard")
+		})
+
+		Convey("Given a commit footer", func() {
+			origBuildVersion := setting.BuildVersion
+			setting.BuildVersion = "6.4.0"
+
+			options.Uid = "prod"
+			options.OrgId = 2
+			options.UserLogin = "jane"
+			footer := []string{FooterDashboardUid, FooterOrgId, FooterGrafanaUser, FooterGrafanaVersion}
+
+			Convey("Should add the fields before the trailers", func() {
+				options.RequestId = "f3a9c2"
+
+				So(createCommitMessage(options, footer), ShouldEqual, `Update Production dashboard
+
+Raise thresholds
+
+dashboard-uid=prod
+org-id=2
+grafana-user=jane
+grafana-version=6.4.0
+
+Source: api
+Request-Id: f3a9c2`)
+			})
+
+			Convey("Should only add the configured fields with a value", func() {
+				options.Action = DeleteDashboard
+				options.Source = ""
+				options.UserLogin = ""
+
+				So(createCommitMessage(options, []string{FooterGrafanaUser, FooterDashboardUid}), ShouldEqual, `Delete Production dashboard
+
+dashboard-uid=prod`)
+			})
+
+			Reset(func() {
+				setting.BuildVersion = origBuildVersion
+			})
+		})
+
+		Convey("Should configure the json indent as spaces or a tab", func() {
+			logger := log.New("test")
+			So(jsonIndentSetting("", logger), ShouldEqual, "  ")
+			So(jsonIndentSetting("4", logger), ShouldEqual, "    ")
+			So(jsonIndentSetting("Tab", logger), ShouldEqual, "\t")
+			So(jsonIndentSetting("0", logger), ShouldEqual, "  ")
+			So(jsonIndentSetting("wide", logger), ShouldEqual, "  ")
+		})
+
+		Convey("Should only configure known footer fields", func() {
+			fields := commitFooterSetting("Dashboard-UID, org-id, branch", log.New("test"))
+			So(fields, ShouldResemble, []string{FooterDashboardUid, FooterOrgId})
+		})
+
+		Convey("Should configure the rendering of jsonnet files when enabled", func() {
+			sec := ini.Empty().Section("auth.gitlab.repo.ops")
+			So(jsonnetSettings(sec), ShouldBeNil)
+
+			sec.Key("jsonnet").SetValue("true")
+			sec.Key("jsonnet_import_paths").SetValue("lib, /vendor/, ../outside")
+			So(jsonnetSettings(sec), ShouldResemble, &JsonnetSettings{
+				ImportPaths: []string{"lib", "vendor", "outside"},
+				Timeout:     10 * time.Second,
+				MaxStack:    500,
+				MaxOutput:   2097152,
+			})
+		})
+
+		Convey("Should configure the conflict policy, overwriting by default", func() {
+			logger := log.New("test")
+			So(conflictPolicySetting("", logger), ShouldEqual, models.GitConflictOverwrite)
+			So(conflictPolicySetting(" Skip ", logger), ShouldEqual, models.GitConflictSkip)
+			So(conflictPolicySetting("fail", logger), ShouldEqual, models.GitConflictFail)
+			So(conflictPolicySetting("merge", logger), ShouldEqual, models.GitConflictOverwrite)
+		})
+	})
+}
+
+func TestGitlabGroupCache(t *testing.T) {
+	Convey("Given a GitLab connector with a group cache", t, func() {
+		groups := []string{"example"}
+		failGroups := false
+		groupRequests := 0
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/user":
+				w.Write([]byte(`{"id": 7, "username": "alice", "state": "active"}`))
+
+			case "/groups":
+				groupRequests++
+				if failGroups {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+
+				body := make([]map[string]string, len(groups))
+				for i, group := range groups {
+					body[i] = map[string]string{"full_path": group}
+				}
+				json.NewEncoder(w).Encode(body)
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		now := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+		groupCacheNow = func() time.Time { return now }
+		groupPageRetryDelay = 0
+
+		connector := &SocialGitlab{
+			SocialBase:            &SocialBase{log: log.New("oauth.gitlab")},
+			apiUrl:                server.URL,
+			allowedGroups:         []string{"example"},
+			groupCacheTTL:         10 * time.Minute,
+			groupCacheNegativeTTL: time.Hour,
+			maxStaleOnError:       30 * time.Minute,
+		}
+
+		login := func() error {
+			_, err := connector.UserInfo(server.Client(), nil)
+			return err
+		}
+
+		Convey("Should keep allowing a removed user until the TTL expires", func() {
+			So(login(), ShouldBeNil)
+
+			groups = []string{"other"}
+			now = now.Add(9 * time.Minute)
+			So(login(), ShouldBeNil)
+			So(groupRequests, ShouldEqual, 1)
+
+			now = now.Add(2 * time.Minute)
+			So(login(), ShouldEqual, ErrMissingGroupMembership)
+			So(groupRequests, ShouldEqual, 2)
+		})
+
+		Convey("Should check denied users again on every login", func() {
+			groups = []string{"other"}
+			So(login(), ShouldEqual, ErrMissingGroupMembership)
+
+			groups = []string{"example"}
+			So(login(), ShouldBeNil)
+			So(groupRequests, ShouldEqual, 2)
+		})
+
+		Convey("Should fetch the groups again after the cache is invalidated", func() {
+			bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+				query.Result = &models.UserAuth{UserId: query.UserId, AuthModule: "oauth_gitlab", AuthId: "7"}
+				return nil
+			})
+
+			So(login(), ShouldBeNil)
+
+			groups = []string{"other"}
+			So(InvalidateUserGroupCache(1), ShouldBeNil)
+			So(login(), ShouldEqual, ErrMissingGroupMembership)
+		})
+
+		Convey("When GitLab fails to return the groups", func() {
+			Convey("Should use stale groups of an allowed user for max_stale_on_error", func() {
+				So(login(), ShouldBeNil)
+
+				failGroups = true
+				now = now.Add(39 * time.Minute)
+				So(login(), ShouldBeNil)
+
+				now = now.Add(2 * time.Minute)
+				So(login(), ShouldEqual, ErrGroupsUnavailable)
+			})
+
+			Convey("Should keep denying a denied user", func() {
+				groups = []string{"other"}
+				So(login(), ShouldEqual, ErrMissingGroupMembership)
+
+				failGroups = true
+				now = now.Add(30 * time.Minute)
+				So(login(), ShouldEqual, ErrMissingGroupMembership)
+			})
+		})
+
+		Convey("Should not cache without a TTL", func() {
+			connector.groupCacheTTL = 0
+
+			So(login(), ShouldBeNil)
+			So(login(), ShouldBeNil)
+			So(groupRequests, ShouldEqual, 2)
+		})
+
+		Reset(func() {
+			server.Close()
+			groupCacheNow = time.Now
+			groupPageRetryDelay = 200 * time.Millisecond
+			gitlabGroupCache = newGroupCache()
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+func TestGitlabGroupPagination(t *testing.T) {
+	Convey("Given groups on three pages", t, func() {
+		// failures[page] is how many more times the page fails
+		failures := map[string]int{}
+		requests := map[string]int{}
+
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/user":
+				w.Write([]byte(`{"id": 7, "username": "alice", "state": "active"}`))
+
+			case "/groups":
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					page = "1"
+				}
+				requests[page]++
+
+				if failures[page] > 0 {
+					failures[page]--
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if page != "3" {
+					next, _ := strconv.Atoi(page)
+					w.Header().Set("Link", fmt.Sprintf(`<%s/groups?page=%d>; rel="next"`, server.URL, next+1))
+				}
+				fmt.Fprintf(w, `[{"full_path": "group-%s"}]`, page)
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		groupPageRetryDelay = 0
+
+		connector := &SocialGitlab{
+			SocialBase: &SocialBase{log: log.New("oauth.gitlab")},
+			apiUrl:     server.URL,
+		}
+
+		Convey("Should retry a failing page", func() {
+			failures["2"] = groupPageAttempts - 1
+
+			groups, err := connector.GetGroups(server.Client())
+			So(err, ShouldBeNil)
+			So(groups, ShouldResemble, []string{"group-1", "group-2", "group-3"})
+			So(requests["2"], ShouldEqual, groupPageAttempts)
+		})
+
+		Convey("Should return the groups read so far with the error of a page that keeps failing", func() {
+			failures["2"] = groupPageAttempts
+
+			groups, err := connector.GetGroups(server.Client())
+			So(err, ShouldNotBeNil)
+			So(groups, ShouldResemble, []string{"group-1"})
+			So(requests["3"], ShouldEqual, 0)
+		})
+
+		Convey("Should stop reading groups at the maximum", func() {
+			connector.maxGroups = 2
+
+			groups, err := connector.GetGroups(server.Client())
+			So(err, ShouldBeNil)
+			So(groups, ShouldResemble, []string{"group-1", "group-2"})
+			So(requests["3"], ShouldEqual, 0)
+		})
+
+		Convey("Should check the membership with the groups read up to the maximum", func() {
+			connector.maxGroups = 2
+			connector.allowedGroups = []string{"group-3"}
+
+			_, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldEqual, ErrMissingGroupMembership)
+		})
+
+		Convey("When a page keeps failing at login", func() {
+			failures["2"] = groupPageAttempts
+
+			Convey("Should flag the groups as partial without allowed groups", func() {
+				connector.groupRoleMapping = map[string]string{"group-3": "Editor"}
+
+				userInfo, err := connector.UserInfo(server.Client(), nil)
+				So(err, ShouldBeNil)
+				So(userInfo.Groups, ShouldResemble, []string{"group-1"})
+				So(userInfo.GroupsPartial, ShouldBeTrue)
+			})
+
+			Convey("Should fail the login with allowed groups, even when an allowed group was read", func() {
+				connector.allowedGroups = []string{"group-1"}
+
+				_, err := connector.UserInfo(server.Client(), nil)
+				So(err, ShouldEqual, ErrGroupsUnavailable)
+			})
+
+			Convey("Should allow a user with an allowed group read when partial groups are allowed", func() {
+				connector.allowedGroups = []string{"group-1"}
+				connector.allowPartialGroups = true
+
+				userInfo, err := connector.UserInfo(server.Client(), nil)
+				So(err, ShouldBeNil)
+				So(userInfo.GroupsPartial, ShouldBeTrue)
+			})
+
+			Convey("Should not deny a user whose allowed group may be on the failing page", func() {
+				connector.allowedGroups = []string{"group-3"}
+				connector.allowPartialGroups = true
+
+				_, err := connector.UserInfo(server.Client(), nil)
+				So(err, ShouldEqual, ErrGroupsUnavailable)
+			})
+		})
+
+		Reset(func() {
+			server.Close()
+			groupPageRetryDelay = 200 * time.Millisecond
+		})
+	})
+}
+
+func TestGitlabLazyGroups(t *testing.T) {
+	Convey("Given a GitLab connector", t, func() {
+		groupRequests := 0
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/user":
+				w.Write([]byte(`{"id": 7, "username": "alice", "email": "alice@example.com", "state": "active"}`))
+
+			case "/groups":
+				groupRequests++
+				w.Write([]byte(`[{"full_path": "developers"}]`))
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		connector := &SocialGitlab{
+			SocialBase: &SocialBase{log: log.New("oauth.gitlab")},
+			apiUrl:     server.URL,
+		}
+
+		Convey("Should not fetch the groups at login when no setting uses them", func() {
+			userInfo, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Groups, ShouldBeEmpty)
+			So(groupRequests, ShouldEqual, 0)
+
+			So(ResolveOrgRole(userInfo, &setting.OAuthInfo{}), ShouldEqual, "")
+			So(groupRequests, ShouldEqual, 0)
+
+			Convey("Should fetch them once when they are needed", func() {
+				So(userInfo.LoadGroups(), ShouldResemble, []string{"developers"})
+				So(userInfo.LoadGroups(), ShouldResemble, []string{"developers"})
+				So(groupRequests, ShouldEqual, 1)
+			})
+
+			Convey("Should fetch them to resolve a group role mapping", func() {
+				info := &setting.OAuthInfo{GroupRoleMapping: map[string]string{"developers": "Editor"}}
+				So(ResolveOrgRole(userInfo, info), ShouldEqual, "Editor")
+				So(groupRequests, ShouldEqual, 1)
+			})
+		})
+
+		Convey("Should fetch the groups at login with allowed groups", func() {
+			connector.allowedGroups = []string{"developers"}
+
+			userInfo, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Groups, ShouldResemble, []string{"developers"})
+			So(groupRequests, ShouldEqual, 1)
+		})
+
+		Convey("Should fetch the groups at login with a group role mapping", func() {
+			connector.groupRoleMapping = map[string]string{"developers": "Editor"}
+
+			userInfo, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Groups, ShouldResemble, []string{"developers"})
+			So(groupRequests, ShouldEqual, 1)
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestGitlabUserState(t *testing.T) {
+	Convey("Given a GitLab connector", t, func() {
+		state := "active"
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/user":
+				fmt.Fprintf(w, `{"id": 7, "username": "alice", "state": %q}`, state)
+
+			case "/groups":
+				w.Write([]byte(`[]`))
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		connector := &SocialGitlab{
+			SocialBase: &SocialBase{log: log.New("oauth.gitlab")},
+			apiUrl:     server.URL,
+		}
+
+		login := func() error {
+			_, err := connector.UserInfo(server.Client(), nil)
+			return err
+		}
+
+		Convey("Should only allow active users by default", func() {
+			So(login(), ShouldBeNil)
+
+			state = "blocked"
+			So(login(), ShouldEqual, userStateErrors["blocked"])
+		})
+
+		Convey("Should explain why the state keeps the user out", func() {
+			state = "blocked_pending_approval"
+			So(login().Error(), ShouldContainSubstring, "waiting for approval")
+
+			state = "ldap_blocked"
+			So(login().Error(), ShouldContainSubstring, "blocked by LDAP")
+
+			state = "deactivated"
+			So(login().Error(), ShouldContainSubstring, "deactivated")
+		})
+
+		Convey("Should name an unknown state", func() {
+			state = "archived"
+
+			err := login()
+			So(err, ShouldHaveSameTypeAs, &Error{})
+			So(err.Error(), ShouldContainSubstring, `"archived"`)
+		})
+
+		Convey("Should allow the configured states", func() {
+			connector.allowedStates = []string{"active", "ldap_blocked"}
+
+			state = "ldap_blocked"
+			So(login(), ShouldBeNil)
+
+			state = "blocked"
+			So(login(), ShouldEqual, userStateErrors["blocked"])
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestGitlabConcurrentUserInfo(t *testing.T) {
+	Convey("Given a user in groups on three pages", t, func() {
+		var mu sync.Mutex
+		requestLog := make([]string, 0)
+		logRequest := func(entry string) {
+			mu.Lock()
+			defer mu.Unlock()
+			requestLog = append(requestLog, entry)
+		}
+		indexOf := func(entry string) int {
+			mu.Lock()
+			defer mu.Unlock()
+			for i, e := range requestLog {
+				if e == entry {
+					return i
+				}
+			}
+			return -1
+		}
+
+		state := "active"
+		// waitForGroups holds the user until the groups are requested, failPage fails a page, blockPage holds it
+		// until the request is canceled
+		waitForGroups := true
+		failPage := ""
+		blockPage := ""
+		groupsRequested := make(chan struct{})
+		var groupsRequestedOnce sync.Once
+
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/user":
+				logRequest("user started")
+				if waitForGroups {
+					select {
+					case <-groupsRequested:
+					case <-time.After(5 * time.Second):
+					}
+				}
+				fmt.Fprintf(w, `{"id": 7, "username": "alice", "state": %q}`, state)
+				logRequest("user done")
+
+			case "/groups":
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					page = "1"
+				}
+				logRequest("groups page " + page)
+				groupsRequestedOnce.Do(func() { close(groupsRequested) })
+
+				if page == failPage {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				if page == blockPage {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(5 * time.Second):
+					}
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				if page != "3" {
+					next, _ := strconv.Atoi(page)
+					w.Header().Set("Link", fmt.Sprintf(`<%s/groups?page=%d>; rel="next"`, server.URL, next+1))
+				}
+				fmt.Fprintf(w, `[{"full_path": "group-%s"}]`, page)
+
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		groupPageRetryDelay = 0
+
+		connector := &SocialGitlab{
+			SocialBase:    &SocialBase{log: log.New("oauth.gitlab")},
+			apiUrl:        server.URL,
+			allowedGroups: []string{"group-3"},
+		}
+
+		Convey("Should read the groups while the user is fetched, in the order of the pages", func() {
+			userInfo, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Login, ShouldEqual, "alice")
+			So(userInfo.Groups, ShouldResemble, []string{"group-1", "group-2", "group-3"})
+			So(userInfo.GroupsPartial, ShouldBeFalse)
+
+			So(indexOf("groups page 1"), ShouldBeLessThan, indexOf("user done"))
+		})
+
+		Convey("Should stop reading the groups of a user who cannot log in", func() {
+			state = "blocked"
+			blockPage = "2"
+
+			_, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldEqual, userStateErrors["blocked"])
+			So(indexOf("groups page 3"), ShouldEqual, -1)
+		})
+
+		Convey("Should return the state of the user before errors reading the groups", func() {
+			state = "blocked"
+			failPage = "2"
+
+			_, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldEqual, userStateErrors["blocked"])
+		})
+
+		Convey("Should check the groups read once the user is fetched", func() {
+			failPage = "2"
+
+			_, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldEqual, ErrGroupsUnavailable)
+			So(indexOf("user done"), ShouldBeGreaterThan, -1)
+		})
+
+		Convey("Should fetch the user before the groups with a group cache", func() {
+			waitForGroups = false
+			connector.groupCacheTTL = 10 * time.Minute
+
+			userInfo, err := connector.UserInfo(server.Client(), nil)
+			So(err, ShouldBeNil)
+			So(userInfo.Groups, ShouldResemble, []string{"group-1", "group-2", "group-3"})
+			So(indexOf("user done"), ShouldBeLessThan, indexOf("groups page 1"))
+		})
+
+		Reset(func() {
+			server.Close()
+			groupPageRetryDelay = 200 * time.Millisecond
+			gitlabGroupCache = newGroupCache()
+		})
+	})
+}
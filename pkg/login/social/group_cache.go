@@ -0,0 +1,84 @@
+package social
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+var (
+	// auditLog records access decisions made on cached group memberships
+	auditLog = log.New("oauth.audit")
+
+	groupCacheNow = time.Now
+
+	gitlabGroupCache = newGroupCache()
+)
+
+type groupCacheEntry struct {
+	groups  []string
+	allowed bool
+	fetched time.Time
+}
+
+// groupCache holds the groups of GitLab users between logins. It is shared by the connectors
+// of all organizations, entries are keyed by api url and GitLab user id.
+type groupCache struct {
+	mu      sync.Mutex
+	entries map[string]*groupCacheEntry
+}
+
+func newGroupCache() *groupCache {
+	return &groupCache{entries: make(map[string]*groupCacheEntry)}
+}
+
+func groupCacheKey(apiUrl string, id string) string {
+	return apiUrl + "#" + id
+}
+
+func (c *groupCache) get(key string) *groupCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *groupCache) set(key string, groups []string, allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &groupCacheEntry{groups: groups, allowed: allowed, fetched: groupCacheNow()}
+}
+
+// invalidate removes the entries of a GitLab user id for all api urls
+func (c *groupCache) invalidate(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key := range c.entries {
+		if strings.HasSuffix(key, "#"+id) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// InvalidateUserGroupCache makes the next login of the user fetch their groups from GitLab.
+// Users who never signed in with GitLab are ignored.
+func InvalidateUserGroupCache(userId int64) error {
+	query := &models.GetAuthInfoQuery{UserId: userId, AuthModule: "oauth_gitlab"}
+	if err := bus.Dispatch(query); err != nil {
+		if err == models.ErrUserNotFound {
+			return nil
+		}
+		return err
+	}
+
+	removed := gitlabGroupCache.invalidate(query.Result.AuthId)
+	auditLog.Info("Group membership cache invalidated", "userId", userId, "gitlabUserId", query.Result.AuthId, "entries", removed)
+	return nil
+}
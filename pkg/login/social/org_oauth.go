@@ -0,0 +1,47 @@
+package social
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// GetOrgConnector returns the connector and settings of the provider to log in to an organization.
+// Organizations that registered their own app with the identity provider get a connector using those
+// client credentials, other organizations share the connector of the global auth section.
+func GetOrgConnector(name string, orgId int64) (SocialConnector, *setting.OAuthInfo, error) {
+	name = ProviderName(name)
+	connect, ok := SocialMap[name]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	info := setting.OAuthService.OAuthInfos[name]
+	if orgId == 0 {
+		return connect, info, nil
+	}
+
+	query := &models.GetOrgOAuthConfigQuery{OrgId: orgId, Provider: name}
+	if err := bus.Dispatch(query); err != nil {
+		if err == models.ErrOrgOAuthConfigNotFound {
+			return connect, info, nil
+		}
+		return nil, nil, err
+	}
+
+	orgInfo := *info
+	orgInfo.ClientId = query.Result.ClientId
+	orgInfo.ClientSecret = query.Result.DecryptedClientSecret()
+
+	if query.Result.AuthUrl != "" {
+		orgInfo.AuthUrl = query.Result.AuthUrl
+	}
+	if query.Result.TokenUrl != "" {
+		orgInfo.TokenUrl = query.Result.TokenUrl
+	}
+	if query.Result.ApiUrl != "" {
+		orgInfo.ApiUrl = query.Result.ApiUrl
+	}
+
+	return newConnector(name, &orgInfo, oauthSections[name]), &orgInfo, nil
+}
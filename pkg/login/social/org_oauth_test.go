@@ -0,0 +1,96 @@
+package social
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/securejsondata"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	ini "gopkg.in/ini.v1"
+)
+
+func TestGetOrgConnector(t *testing.T) {
+	Convey("Given a globally configured GitHub provider", t, func() {
+		bus.ClearBusHandlers()
+
+		origRaw, origOAuthService := setting.Raw, setting.OAuthService
+		origConnector, hadConnector := SocialMap["github"]
+
+		info := &setting.OAuthInfo{
+			ClientId:     "global-client",
+			ClientSecret: "global-secret",
+			AuthUrl:      "https://github.com/login/oauth/authorize",
+			TokenUrl:     "https://github.com/login/oauth/access_token",
+			ApiUrl:       "https://api.github.com/user",
+			AllowSignup:  true,
+		}
+		setting.Raw = ini.Empty()
+		setting.OAuthService = &setting.OAuther{OAuthInfos: map[string]*setting.OAuthInfo{"github": info}}
+
+		sec := ini.Empty().Section("auth.github")
+		oauthSections["github"] = sec
+		SocialMap["github"] = newConnector("github", info, sec)
+
+		bus.AddHandler("test", func(query *models.GetOrgOAuthConfigQuery) error {
+			if query.OrgId != 2 || query.Provider != "github" {
+				return models.ErrOrgOAuthConfigNotFound
+			}
+
+			query.Result = &models.OrgOAuthConfig{
+				OrgId:          2,
+				Provider:       "github",
+				ClientId:       "org-client",
+				AuthUrl:        "https://github.example.com/login/oauth/authorize",
+				SecureJsonData: securejsondata.GetEncryptedJsonData(map[string]string{"clientSecret": "org-secret"}),
+			}
+			return nil
+		})
+
+		Convey("Should use the global config without org", func() {
+			connect, orgInfo, err := GetOrgConnector("github", 0)
+			So(err, ShouldBeNil)
+			So(connect, ShouldEqual, SocialMap["github"])
+			So(orgInfo, ShouldEqual, info)
+		})
+
+		Convey("Should use the global config for orgs without override", func() {
+			connect, orgInfo, err := GetOrgConnector("github", 1)
+			So(err, ShouldBeNil)
+			So(connect, ShouldEqual, SocialMap["github"])
+			So(orgInfo.ClientId, ShouldEqual, "global-client")
+		})
+
+		Convey("Should use the client credentials of the org", func() {
+			connect, orgInfo, err := GetOrgConnector("github", 2)
+			So(err, ShouldBeNil)
+			So(orgInfo.ClientId, ShouldEqual, "org-client")
+			So(orgInfo.ClientSecret, ShouldEqual, "org-secret")
+			So(orgInfo.TokenUrl, ShouldEqual, info.TokenUrl)
+			So(orgInfo.AllowSignup, ShouldBeTrue)
+
+			url := connect.AuthCodeURL("state")
+			So(url, ShouldStartWith, "https://github.example.com/login/oauth/authorize")
+			So(url, ShouldContainSubstring, "client_id=org-client")
+
+			So(info.ClientId, ShouldEqual, "global-client")
+		})
+
+		Convey("Should return nothing for providers that are not enabled", func() {
+			connect, _, err := GetOrgConnector("google", 2)
+			So(err, ShouldBeNil)
+			So(connect, ShouldBeNil)
+		})
+
+		Reset(func() {
+			setting.Raw, setting.OAuthService = origRaw, origOAuthService
+			delete(oauthSections, "github")
+			if hadConnector {
+				SocialMap["github"] = origConnector
+			} else {
+				delete(SocialMap, "github")
+			}
+		})
+	})
+}
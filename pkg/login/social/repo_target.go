@@ -0,0 +1,146 @@
+package social
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrRepoUrlInvalid    = errors.New("Invalid repository url")
+	ErrRepoUrlInsecure   = errors.New("Repository url must use https, set allow_insecure to allow http")
+	ErrRepoHostForbidden = errors.New("Repository host resolves to a link-local or metadata address")
+)
+
+// RepoBranchInvalidError is returned for branch names git does not accept as ref names
+type RepoBranchInvalidError struct {
+	Branch string
+	Reason string
+}
+
+func (e RepoBranchInvalidError) Error() string {
+	return fmt.Sprintf("Invalid branch name %q: %s", e.Branch, e.Reason)
+}
+
+// RepoTarget is where Grafana sends requests authenticated with the access token of a repository
+type RepoTarget struct {
+	Url      string
+	Branches []string
+	// AllowInsecure allows http urls
+	AllowInsecure bool
+	// AllowedHosts may resolve to link-local and metadata addresses, e.g. a GitLab reached through a link-local proxy
+	AllowedHosts []string
+}
+
+// lookupIP resolves the hosts of repository urls, tests replace it with a stub resolver
+var lookupIP = net.LookupIP
+
+// metadataIPs are the instance metadata endpoints of cloud providers outside of the link-local ranges
+var metadataIPs = []net.IP{
+	net.ParseIP("fd00:ec2::254"),   // AWS over IPv6
+	net.ParseIP("100.100.100.200"), // Alibaba Cloud
+}
+
+// ValidateRepoTarget checks a repository before requests are sent to it with its access token, so a repository
+// configured with a mistaken or malicious url cannot make Grafana send authenticated requests to internal
+// endpoints. The url must use https, unless AllowInsecure is set, and its host must not resolve to link-local
+// or metadata addresses, unless it is allowed. Branches must be valid git ref names. An empty url is the
+// default of the client and is not checked.
+func ValidateRepoTarget(target RepoTarget) error {
+	for _, branch := range target.Branches {
+		if err := ValidateBranchName(branch); err != nil {
+			return err
+		}
+	}
+
+	if target.Url == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(target.Url)
+	if err != nil || parsed.Hostname() == "" || parsed.User != nil {
+		return ErrRepoUrlInvalid
+	}
+
+	switch parsed.Scheme {
+	case "https":
+	case "http":
+		if !target.AllowInsecure {
+			return ErrRepoUrlInsecure
+		}
+	default:
+		return ErrRepoUrlInvalid
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range target.AllowedHosts {
+		if strings.ToLower(allowed) == host {
+			return nil
+		}
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = lookupIP(host); err != nil {
+			return fmt.Errorf("Failed to resolve repository host %s: %v", host, err)
+		}
+	}
+
+	for _, ip := range ips {
+		if isForbiddenRepoIP(ip) {
+			return ErrRepoHostForbidden
+		}
+	}
+
+	return nil
+}
+
+func isForbiddenRepoIP(ip net.IP) bool {
+	if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, metadata := range metadataIPs {
+		if ip.Equal(metadata) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateBranchName checks the branch name against the rules of git check-ref-format for branches
+func ValidateBranchName(branch string) error {
+	invalid := func(reason string) error {
+		return RepoBranchInvalidError{Branch: branch, Reason: reason}
+	}
+
+	switch {
+	case branch == "":
+		return invalid("empty name")
+	case branch == "@":
+		return invalid("@ is not a branch")
+	case strings.HasPrefix(branch, "-") || strings.HasPrefix(branch, "/"):
+		return invalid("starts with - or /")
+	case strings.HasSuffix(branch, "/") || strings.HasSuffix(branch, "."):
+		return invalid("ends with / or .")
+	case strings.Contains(branch, ".."), strings.Contains(branch, "//"), strings.Contains(branch, "@{"):
+		return invalid("contains .., // or @{")
+	}
+
+	for _, r := range branch {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return invalid(fmt.Sprintf("contains %q", r))
+		}
+	}
+
+	for _, component := range strings.Split(branch, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return invalid("has a component starting with . or ending with .lock")
+		}
+	}
+
+	return nil
+}
@@ -2,13 +2,18 @@ package social
 
 import (
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"context"
 
 	"golang.org/x/oauth2"
+	ini "gopkg.in/ini.v1"
 
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/util"
 )
@@ -21,6 +26,26 @@ type BasicUserInfo struct {
 	Company string
 	Role    string
 	Groups  []string
+	// GroupsPartial is set when the provider failed to return all the groups of the user
+	GroupsPartial bool
+	// loadGroups fetches the groups when the provider skipped them at login, see LoadGroups
+	loadGroups func() ([]string, error)
+
+	// VerifiedEmail is the address commits of the user are attributed to, when the provider knows it
+	VerifiedEmail string
+}
+
+// LoadGroups returns the groups of the user. Providers that skipped the groups at login because no setting
+// used them fetch them now.
+func (u *BasicUserInfo) LoadGroups() []string {
+	if u.loadGroups != nil {
+		groups, err := u.loadGroups()
+		u.loadGroups = nil
+		u.Groups = groups
+		u.GroupsPartial = err != nil
+	}
+
+	return u.Groups
 }
 
 type DashboardAction string
@@ -36,9 +61,67 @@ type UpdateDashboardOptions struct {
 	Message   string
 	Title     string
 	Name      string
+	Uid       string
 	Dashboard string
 	Folder    string
+	Source    string
 	OrgId     int64
+	// UserId is the Grafana user making the change
+	UserId int64
+	// Repo is the name or id of the repository the dashboard is synced to, instead of the repository of the organization
+	Repo string
+	// Branch overrides the branch of the repository, it must match one of the branch override patterns of the repository
+	Branch string
+	// Coauthors are added to the commit message as Co-authored-by trailers
+	Coauthors []models.GitCommitAuthor
+	// Author is the Grafana user making the change, credited as co-author when the commit is not made as the user
+	Author *models.GitCommitAuthor
+	// RequestId is added as a Request-Id trailer for repositories with request_id_trailer enabled
+	RequestId string
+	// UserLogin is the login of the Grafana user making the change, added to the commit footer
+	UserLogin string
+	// ExternalIdentity is the identity of the user making the change at the git provider, nil when unknown
+	ExternalIdentity *models.ExternalIdentity
+	// LastSync is the last commit of the dashboard, nil when it was never committed. Connectors compare it with
+	// the file in the repository to detect changes made outside of Grafana.
+	LastSync *models.DashboardGitSync
+
+	// Result is set by connectors that committed the dashboard to a repository
+	Result *DashboardSyncResult
+
+	// batch are the changes committed together, when the options describe a commit of several dashboards
+	batch []*UpdateDashboardOptions
+}
+
+// DashboardSyncResult describes the commit created for a dashboard change
+type DashboardSyncResult struct {
+	CommitSha  string
+	FilePath   string
+	CommitMode string
+	// RepoId is the repository the dashboard was committed to
+	RepoId int
+	// Branch is the overridden branch the commit was made to
+	Branch string
+	// FallbackAction is set when the file was not in the state expected and another action was used, see
+	// models.GitFallbackCreate
+	FallbackAction string
+	// ContentHash is the sha256 of the committed file
+	ContentHash string
+	// ConflictCommitSha is set instead of CommitSha when the commit was skipped because the file was changed in
+	// the repository, see models.GitConflictSkip
+	ConflictCommitSha string
+	// Mirrors are the commits of the change to the mirrors of the repository
+	Mirrors []*MirrorSyncResult
+}
+
+// SyncRepo describes the repository dashboards of an organization are synced to
+type SyncRepo struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name,omitempty"`
+	WebUrl   string `json:"webUrl,omitempty"`
+	RepoId   int    `json:"repoId"`
+	// Mirrors are the repositories the dashboard commits are also made to, on a best-effort basis
+	Mirrors []*SyncRepo `json:"mirrors,omitempty"`
 }
 
 type SocialConnector interface {
@@ -47,6 +130,11 @@ type SocialConnector interface {
 	IsEmailAllowed(email string) bool
 	IsSignupAllowed() bool
 	UpdateDashboard(options *UpdateDashboardOptions, token string) error
+	SyncRepo(orgId int64) *SyncRepo
+	Capabilities() Capabilities
+
+	EncodeState(state string, returnUrl string) string
+	DecodeState(state string) (string, error)
 
 	AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string
 	Exchange(ctx context.Context, code string, authOptions ...oauth2.AuthCodeOption) (*oauth2.Token, error)
@@ -54,13 +142,37 @@ type SocialConnector interface {
 	TokenSource(ctx context.Context, t *oauth2.Token) oauth2.TokenSource
 }
 
+// DashboardBatchUpdater is implemented by connectors that can commit the changes of several dashboards at once
+type DashboardBatchUpdater interface {
+	// UpdateDashboards commits the changes to the same repository and branch, for the same user, in a single
+	// commit, and sets the Result of each of them. When it fails none of the changes is committed.
+	UpdateDashboards(options []*UpdateDashboardOptions, token string) error
+}
+
+// ContextUserInfoReader is implemented by connectors whose requests for the user info can be canceled with the
+// context of the login request
+type ContextUserInfoReader interface {
+	UserInfoContext(ctx context.Context, client *http.Client, token *oauth2.Token) (*BasicUserInfo, error)
+}
+
 func (s SocialBase) UpdateDashboard(options *UpdateDashboardOptions, token string) error {
 	return nil
 }
 
+func (s SocialBase) SyncRepo(orgId int64) *SyncRepo {
+	return nil
+}
+
+// Capabilities returns what all connectors support: the org roles of users can be mapped from their email domain
+func (s SocialBase) Capabilities() Capabilities {
+	return Capabilities{RoleMapping: true}
+}
+
 type SocialBase struct {
 	*oauth2.Config
 	log log.Logger
+	// returnUrlInState enables encoding the URL to return to after login in the state, see EncodeState
+	returnUrlInState bool
 }
 
 type Error struct {
@@ -73,17 +185,38 @@ func (e *Error) Error() string {
 
 const (
 	grafanaCom = "grafana_com"
+	// grafanaNet is the former name of the grafana_com provider
+	grafanaNet = "grafananet"
 )
 
 var (
 	SocialBaseUrl = "/login/"
 	SocialMap     = make(map[string]SocialConnector)
-	allOauthes    = []string{"github", "gitlab", "google", "generic_oauth", "grafananet", grafanaCom}
+	allOauthes    = []string{"github", "gitlab", "google", "generic_oauth", grafanaNet, grafanaCom}
+
+	// providerAliases maps the former names of providers to their name, the former names resolve to the same
+	// connector until the settings, links and user_auth rows using them are updated
+	providerAliases = map[string]string{grafanaNet: grafanaCom}
+
+	// oauthSections holds the settings of the enabled providers to build org specific connectors
+	oauthSections = make(map[string]*ini.Section)
 )
 
+// ProviderName returns the name of the provider with the given former name, other names are returned as is
+func ProviderName(name string) string {
+	if current, ok := providerAliases[name]; ok {
+		return current
+	}
+	return name
+}
+
+// NewOAuthService registers the connectors of the enabled providers. Providers with invalid settings are not
+// registered, their problems are logged in a single report and returned by GetOAuthProviderInfos.
 func NewOAuthService() {
 	setting.OAuthService = &setting.OAuther{}
 	setting.OAuthService.OAuthInfos = make(map[string]*setting.OAuthInfo)
+	oauthProviderInfos = make(map[string]*OAuthProviderInfo)
+	report := make([]string, 0)
 
 	for _, name := range allOauthes {
 		sec := setting.Raw.Section("auth." + name)
@@ -106,139 +239,291 @@ func NewOAuthService() {
 			TlsClientCa:                  sec.Key("tls_client_ca").String(),
 			TlsSkipVerify:                sec.Key("tls_skip_verify_insecure").MustBool(),
 			SendClientCredentialsViaPost: sec.Key("send_client_credentials_via_post").MustBool(),
+			GroupRoleMapping:             parseRoleMapping(sec.Key("group_role_mapping").String()),
+			DomainRoleMapping:            parseRoleMapping(sec.Key("domain_role_mapping").String()),
+			ReturnUrlInState:             sec.Key("return_url_in_state").MustBool(false),
 		}
 
 		if !info.Enabled {
 			continue
 		}
 
+		if current := ProviderName(name); current != name {
+			log.New("oauth").Warn("The auth section of the provider uses its former name, rename it", "section", "auth."+name, "name", "auth."+current)
+			name = current
+		}
+
+		providerInfo := &OAuthProviderInfo{Name: name, DisplayName: info.Name, Enabled: true}
+		oauthProviderInfos[name] = providerInfo
+
+		if err := ValidateOAuthInfo(name, info); err != nil {
+			providerInfo.Enabled = false
+			providerInfo.DisabledReason = "Invalid settings"
+			if configErr, ok := err.(OAuthConfigError); ok {
+				providerInfo.Problems = configErr.Problems
+			}
+			report = append(report, err.Error())
+			delete(SocialMap, name)
+			continue
+		}
+
 		// handle the clients that do not properly support Basic auth headers and require passing client_id/client_secret via POST payload
 		if info.SendClientCredentialsViaPost {
 			// TODO: Fix the staticcheck error
 			oauth2.RegisterBrokenAuthHeaderProvider(info.TokenUrl) //nolint:staticcheck
 		}
 
-		if name == "grafananet" {
-			name = grafanaCom
+		setting.OAuthService.OAuthInfos[name] = info
+		oauthSections[name] = sec
+		SocialMap[name] = newConnector(name, info, sec)
+	}
+
+	// users and links of a provider under its former name get the same connector
+	for alias, name := range providerAliases {
+		if connect, ok := SocialMap[name]; ok {
+			SocialMap[alias] = connect
+		} else {
+			delete(SocialMap, alias)
 		}
+	}
 
-		setting.OAuthService.OAuthInfos[name] = info
+	if len(report) > 0 {
+		log.New("oauth").Error("Disabled OAuth providers with invalid settings", "report", strings.Join(report, "\n"))
+	}
+}
+
+// newConnector creates the connector of an OAuth provider from its settings
+func newConnector(name string, info *setting.OAuthInfo, sec *ini.Section) SocialConnector {
+	config := oauth2.Config{
+		ClientID:     info.ClientId,
+		ClientSecret: info.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  info.AuthUrl,
+			TokenURL: info.TokenUrl,
+		},
+		RedirectURL: strings.TrimSuffix(setting.AppUrl, "/") + SocialBaseUrl + name,
+		Scopes:      info.Scopes,
+	}
+
+	logger := log.New("oauth." + name)
+	base := &SocialBase{Config: &config, log: logger, returnUrlInState: info.ReturnUrlInState}
+
+	// GitHub.
+	if name == "github" {
+		var repos []*GrafanaGithubRepo
+
+		for _, repoSetting := range setting.Raw.ChildSections("auth." + name + ".repo") {
+			org_id, _ := repoSetting.Key("org_id").Int64()
+			repo_id, _ := repoSetting.Key("repo_id").Int()
+
+			repo := &GrafanaGithubRepo{
+				Name:           strings.TrimPrefix(repoSetting.Name(), "auth."+name+".repo."),
+				Branch:         repoSetting.Key("branch").String(),
+				OrgId:          org_id,
+				RepoId:         repo_id,
+				DashboardsPath: repoSetting.Key("dashboards_path").String(),
+				Url:            repoSetting.Key("url").String(),
+				WebUrl:         repoSetting.Key("web_url").String(),
+			}
+
+			target := RepoTarget{
+				Url:           repo.Url,
+				AllowInsecure: repoSetting.Key("allow_insecure").MustBool(false),
+				AllowedHosts:  util.SplitString(sec.Key("repo_allowed_hosts").String()),
+			}
+			if repo.Branch != "" {
+				target.Branches = []string{repo.Branch}
+			}
+
+			if err := ValidateRepoTarget(target); err != nil {
+				logger.Error("Ignoring repository with an invalid url or branch", "repo", repo.Name, "error", err)
+				continue
+			}
+
+			repos = append(repos, repo)
+		}
+
+		return &SocialGithub{
+			SocialBase:           base,
+			allowedDomains:       info.AllowedDomains,
+			apiUrl:               info.ApiUrl,
+			allowSignup:          info.AllowSignup,
+			teamIds:              sec.Key("team_ids").Ints(","),
+			allowedOrganizations: util.SplitString(sec.Key("allowed_organizations").String()),
+			fetchConcurrency:     sec.Key("fetch_concurrency").MustInt(4),
+			fetchMaxPages:        sec.Key("fetch_max_pages").MustInt(0),
+			fetchTimeout:         sec.Key("fetch_timeout").MustDuration(10 * time.Second),
+			repos:                repos,
+		}
+	}
+
+	// GitLab.
+	if name == "gitlab" {
+		reposSettings := setting.Raw.ChildSections("auth." + name + ".repo")
+		var repos []*GrafanaGitlabRepo
+
+		for _, repoSetting := range reposSettings {
+			org_id, _ := repoSetting.Key("org_id").Int64()
+			repo_id, _ := repoSetting.Key("repo_id").Int()
+
+			repo := &GrafanaGitlabRepo{
+				Name:                   strings.TrimPrefix(repoSetting.Name(), "auth."+name+".repo."),
+				Branch:                 repoSetting.Key("branch").String(),
+				OrgId:                  org_id,
+				RepoId:                 repo_id,
+				DashboardsPath:         repoSetting.Key("dashboards_path").String(),
+				Url:                    repoSetting.Key("url").String(),
+				WebUrl:                 repoSetting.Key("web_url").String(),
+				VerifyFileExistence:    repoSetting.Key("verify_file_existence").MustBool(false),
+				AccessToken:            repoSetting.Key("access_token").String(),
+				ExportDatasources:      repoSetting.Key("export_datasources").MustBool(false),
+				ExportNotifiers:        repoSetting.Key("export_notifiers").MustBool(false),
+				ExportPermissions:      repoSetting.Key("export_permissions").MustBool(false),
+				ExportPermissionEmails: repoSetting.Key("export_permission_emails").MustBool(false),
+				SudoCommits:            repoSetting.Key("sudo_commits").MustBool(false),
+				AllowBranchOverride:    util.SplitString(repoSetting.Key("allow_branch_override").String()),
+				RequestIdTrailer:       repoSetting.Key("request_id_trailer").MustBool(false),
+				CommitFooter:           commitFooterSetting(repoSetting.Key("commit_footer").String(), logger),
+				AuditBranch:            repoSetting.Key("audit_branch").String(),
+				AuditPath:              repoSetting.Key("audit_path").MustString("audit"),
+				JsonIndent:             jsonIndentSetting(repoSetting.Key("json_indent").String(), logger),
+				JsonTrailingNewline:    repoSetting.Key("json_trailing_newline").MustBool(false),
+				Jsonnet:                jsonnetSettings(repoSetting),
+				ConflictPolicy:         conflictPolicySetting(repoSetting.Key("conflict_policy").String(), logger),
+				Mirrors:                util.SplitString(repoSetting.Key("mirrors").String()),
+			}
+
+			target := RepoTarget{
+				Url:           repo.Url,
+				AllowInsecure: repoSetting.Key("allow_insecure").MustBool(false),
+				AllowedHosts:  util.SplitString(sec.Key("repo_allowed_hosts").String()),
+			}
+			for _, branch := range []string{repo.Branch, repo.AuditBranch} {
+				if branch != "" {
+					target.Branches = append(target.Branches, branch)
+				}
+			}
+
+			if err := ValidateRepoTarget(target); err != nil {
+				logger.Error("Ignoring repository with an invalid url or branch", "repo", repo.Name, "error", err)
+				continue
+			}
+
+			repos = append(repos, repo)
+		}
+
+		return &SocialGitlab{
+			SocialBase:     base,
+			allowedDomains: info.AllowedDomains,
+			apiUrl:         info.ApiUrl,
+			allowSignup:    info.AllowSignup,
+			allowedGroups:  util.SplitString(sec.Key("allowed_groups").String()),
+			repos:          repos,
+			mirrors:        resolveRepoMirrors(repos, logger),
+
+			groupRoleMapping: info.GroupRoleMapping,
+
+			groupCacheTTL:         sec.Key("group_cache_ttl").MustDuration(0),
+			groupCacheNegativeTTL: sec.Key("group_cache_negative_ttl").MustDuration(0),
+			maxStaleOnError:       sec.Key("max_stale_on_error").MustDuration(0),
+			allowPartialGroups:    sec.Key("allow_partial_groups").MustBool(false),
+			maxGroups:             sec.Key("max_groups").MustInt(0),
+			allowedStates:         util.SplitString(sec.Key("allowed_states").MustString("active")),
+		}
+	}
+
+	// Google.
+	if name == "google" {
+		return &SocialGoogle{
+			SocialBase:     base,
+			allowedDomains: info.AllowedDomains,
+			hostedDomain:   info.HostedDomain,
+			apiUrl:         info.ApiUrl,
+			allowSignup:    info.AllowSignup,
+		}
+	}
+
+	// Generic - Uses the same scheme as Github.
+	if name == "generic_oauth" {
+		return &SocialGenericOAuth{
+			SocialBase:           base,
+			allowedDomains:       info.AllowedDomains,
+			apiUrl:               info.ApiUrl,
+			allowSignup:          info.AllowSignup,
+			emailAttributeName:   info.EmailAttributeName,
+			emailAttributePath:   info.EmailAttributePath,
+			teamIds:              sec.Key("team_ids").Ints(","),
+			allowedOrganizations: util.SplitString(sec.Key("allowed_organizations").String()),
+		}
+	}
 
-		config := oauth2.Config{
+	if name == grafanaCom {
+		config = oauth2.Config{
 			ClientID:     info.ClientId,
 			ClientSecret: info.ClientSecret,
 			Endpoint: oauth2.Endpoint{
-				AuthURL:  info.AuthUrl,
-				TokenURL: info.TokenUrl,
+				AuthURL:  setting.GrafanaComUrl + "/oauth2/authorize",
+				TokenURL: setting.GrafanaComUrl + "/api/oauth2/token",
 			},
 			RedirectURL: strings.TrimSuffix(setting.AppUrl, "/") + SocialBaseUrl + name,
 			Scopes:      info.Scopes,
 		}
 
-		logger := log.New("oauth." + name)
-
-		// GitHub.
-		if name == "github" {
-			SocialMap["github"] = &SocialGithub{
-				SocialBase: &SocialBase{
-					Config: &config,
-					log:    logger,
-				},
-				allowedDomains:       info.AllowedDomains,
-				apiUrl:               info.ApiUrl,
-				allowSignup:          info.AllowSignup,
-				teamIds:              sec.Key("team_ids").Ints(","),
-				allowedOrganizations: util.SplitString(sec.Key("allowed_organizations").String()),
-			}
+		return &SocialGrafanaCom{
+			SocialBase:           base,
+			url:                  setting.GrafanaComUrl,
+			allowSignup:          info.AllowSignup,
+			allowedOrganizations: util.SplitString(sec.Key("allowed_organizations").String()),
 		}
+	}
 
-		// GitLab.
-		if name == "gitlab" {
-			reposSettings := setting.Raw.ChildSections("auth." + name + ".repo")
-			var repos []*GrafanaGitlabRepo
-
-			for _, repoSetting := range reposSettings {
-				org_id, _ := repoSetting.Key("org_id").Int64()
-				repo_id, _ := repoSetting.Key("repo_id").Int()
-
-				repo := &GrafanaGitlabRepo{
-					Branch:         repoSetting.Key("branch").String(),
-					OrgId:          org_id,
-					RepoId:         repo_id,
-					DashboardsPath: repoSetting.Key("dashboards_path").String(),
-					Url:            repoSetting.Key("url").String(),
-				}
+	return nil
+}
 
-				repos = append(repos, repo)
-			}
+// GetSyncRepo returns the repository dashboards of the organization are synced to,
+// or nil if git sync is not configured for it.
+func GetSyncRepo(orgId int64) *SyncRepo {
+	for _, name := range allOauthes {
+		name = ProviderName(name)
 
-			SocialMap["gitlab"] = &SocialGitlab{
-				SocialBase: &SocialBase{
-					Config: &config,
-					log:    logger,
-				},
-				allowedDomains: info.AllowedDomains,
-				apiUrl:         info.ApiUrl,
-				allowSignup:    info.AllowSignup,
-				allowedGroups:  util.SplitString(sec.Key("allowed_groups").String()),
-				repos:          repos,
+		if connect, ok := SocialMap[name]; ok {
+			if repo := connect.SyncRepo(orgId); repo != nil {
+				return repo
 			}
 		}
+	}
 
-		// Google.
-		if name == "google" {
-			SocialMap["google"] = &SocialGoogle{
-				SocialBase: &SocialBase{
-					Config: &config,
-					log:    logger,
-				},
-				allowedDomains: info.AllowedDomains,
-				hostedDomain:   info.HostedDomain,
-				apiUrl:         info.ApiUrl,
-				allowSignup:    info.AllowSignup,
-			}
-		}
+	return nil
+}
 
-		// Generic - Uses the same scheme as Github.
-		if name == "generic_oauth" {
-			SocialMap["generic_oauth"] = &SocialGenericOAuth{
-				SocialBase: &SocialBase{
-					Config: &config,
-					log:    logger,
-				},
-				allowedDomains:       info.AllowedDomains,
-				apiUrl:               info.ApiUrl,
-				allowSignup:          info.AllowSignup,
-				emailAttributeName:   info.EmailAttributeName,
-				emailAttributePath:   info.EmailAttributePath,
-				teamIds:              sec.Key("team_ids").Ints(","),
-				allowedOrganizations: util.SplitString(sec.Key("allowed_organizations").String()),
-			}
+// GetGitProvider returns the provider that org-level resources of the organization are exported with,
+// or nil if no repository of the organization has an access token configured.
+func GetGitProvider(orgId int64) GitProvider {
+	for _, name := range allOauthes {
+		name = ProviderName(name)
+
+		if provider, ok := SocialMap[name].(GitProvider); ok && provider.ExportSettings(orgId) != nil {
+			return provider
 		}
+	}
 
-		if name == grafanaCom {
-			config = oauth2.Config{
-				ClientID:     info.ClientId,
-				ClientSecret: info.ClientSecret,
-				Endpoint: oauth2.Endpoint{
-					AuthURL:  setting.GrafanaComUrl + "/oauth2/authorize",
-					TokenURL: setting.GrafanaComUrl + "/api/oauth2/token",
-				},
-				RedirectURL: strings.TrimSuffix(setting.AppUrl, "/") + SocialBaseUrl + name,
-				Scopes:      info.Scopes,
-			}
+	return nil
+}
+
+// GetMirrorPromoter returns the provider the dashboards of the organization are synced with when it can promote
+// the mirrors of the repository, or nil
+func GetMirrorPromoter(orgId int64) RepoMirrorPromoter {
+	for _, name := range allOauthes {
+		name = ProviderName(name)
 
-			SocialMap[grafanaCom] = &SocialGrafanaCom{
-				SocialBase: &SocialBase{
-					Config: &config,
-					log:    logger,
-				},
-				url:                  setting.GrafanaComUrl,
-				allowSignup:          info.AllowSignup,
-				allowedOrganizations: util.SplitString(sec.Key("allowed_organizations").String()),
+		if connect, ok := SocialMap[name]; ok && connect.SyncRepo(orgId) != nil {
+			if promoter, ok := connect.(RepoMirrorPromoter); ok {
+				return promoter
 			}
 		}
 	}
+
+	return nil
 }
 
 // GetOAuthProviders returns available oauth providers and if they're enabled or not
@@ -250,16 +535,90 @@ var GetOAuthProviders = func(cfg *setting.Cfg) map[string]bool {
 	}
 
 	for _, name := range allOauthes {
-		if name == "grafananet" {
-			name = grafanaCom
-		}
-
 		sec := cfg.Raw.Section("auth." + name)
 		if sec == nil {
 			continue
 		}
-		result[name] = sec.Key("enabled").MustBool()
+
+		// providers enabled under their former name are enabled
+		name = ProviderName(name)
+		result[name] = result[name] || sec.Key("enabled").MustBool()
 	}
 
 	return result
 }
+
+// commitFooterSetting returns the known fields of the commit_footer setting of a repository
+func commitFooterSetting(value string, logger log.Logger) []string {
+	fields := make([]string, 0)
+	for _, field := range util.SplitString(value) {
+		known := false
+		for _, name := range commitFooterFields {
+			if strings.EqualFold(field, name) {
+				fields = append(fields, name)
+				known = true
+			}
+		}
+
+		if !known {
+			logger.Warn("Ignoring unknown commit footer field", "field", field, "fields", strings.Join(commitFooterFields, ", "))
+		}
+	}
+	return fields
+}
+
+// jsonIndentSetting returns the indent of a json_indent setting, 1 to 8 spaces or tab. An invalid setting
+// falls back to two spaces.
+func jsonIndentSetting(value string, logger log.Logger) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "  "
+	}
+
+	if strings.EqualFold(value, "tab") {
+		return "\t"
+	}
+
+	spaces, err := strconv.Atoi(value)
+	if err != nil || spaces < 1 || spaces > 8 {
+		logger.Warn("Ignoring invalid json indent, expected 1 to 8 spaces or tab", "indent", value)
+		return "  "
+	}
+	return strings.Repeat(" ", spaces)
+}
+
+// conflictPolicySetting returns what dashboard commits do when the file was changed in the repository since the
+// last sync, see the models.GitConflict constants. Unknown policies overwrite the change, like before conflicts
+// were detected.
+func conflictPolicySetting(value string, logger log.Logger) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case models.GitConflictOverwrite, models.GitConflictSkip, models.GitConflictFail:
+		return value
+	case "":
+		return models.GitConflictOverwrite
+	}
+
+	logger.Warn("Ignoring invalid conflict policy, expected overwrite, skip or fail", "policy", value)
+	return models.GitConflictOverwrite
+}
+
+// jsonnetSettings returns the rendering settings of the jsonnet files of a repository, nil unless jsonnet is
+// enabled. Import paths are relative to the root of the repository.
+func jsonnetSettings(sec *ini.Section) *JsonnetSettings {
+	if !sec.Key("jsonnet").MustBool(false) {
+		return nil
+	}
+
+	importPaths := make([]string, 0)
+	for _, importPath := range util.SplitString(sec.Key("jsonnet_import_paths").String()) {
+		importPaths = append(importPaths, strings.Trim(path.Clean("/"+importPath), "/"))
+	}
+
+	return &JsonnetSettings{
+		ImportPaths: importPaths,
+		Timeout:     sec.Key("jsonnet_timeout").MustDuration(10 * time.Second),
+		MaxStack:    sec.Key("jsonnet_max_stack").MustInt(500),
+		MaxOutput:   sec.Key("jsonnet_max_output").MustInt(2097152),
+	}
+}
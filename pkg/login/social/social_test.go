@@ -0,0 +1,71 @@
+package social
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	ini "gopkg.in/ini.v1"
+)
+
+func TestOAuthProviderAliases(t *testing.T) {
+	Convey("Given Grafana.com enabled under its former name", t, func() {
+		origRaw, origOAuthService := setting.Raw, setting.OAuthService
+		origGrafanaCom, hadGrafanaCom := SocialMap[grafanaCom]
+
+		setting.Raw = ini.Empty()
+		sec := setting.Raw.Section("auth." + grafanaNet)
+		sec.Key("enabled").SetValue("true")
+		sec.Key("client_id").SetValue("client")
+		sec.Key("client_secret").SetValue("secret")
+
+		NewOAuthService()
+
+		Convey("Should register the connector under both names", func() {
+			So(SocialMap[grafanaCom], ShouldHaveSameTypeAs, &SocialGrafanaCom{})
+			So(SocialMap[grafanaNet], ShouldEqual, SocialMap[grafanaCom])
+			So(setting.OAuthService.OAuthInfos, ShouldContainKey, grafanaCom)
+			So(setting.OAuthService.OAuthInfos, ShouldNotContainKey, grafanaNet)
+
+			connect, info, err := GetOrgConnector(grafanaNet, 0)
+			So(err, ShouldBeNil)
+			So(connect, ShouldEqual, SocialMap[grafanaCom])
+			So(info.ClientId, ShouldEqual, "client")
+		})
+
+		Convey("Should return the provider as enabled under its name", func() {
+			So(GetOAuthProviders(&setting.Cfg{Raw: setting.Raw}), ShouldResemble, map[string]bool{
+				"github": false, "gitlab": false, "google": false, "generic_oauth": false, grafanaCom: true,
+			})
+
+			infos := GetOAuthProviderInfos()
+			So(infos, ShouldHaveLength, 1)
+			So(infos[0].Name, ShouldEqual, grafanaCom)
+		})
+
+		Convey("Should resolve the former name to the name of the provider", func() {
+			So(ProviderName(grafanaNet), ShouldEqual, grafanaCom)
+			So(ProviderName(grafanaCom), ShouldEqual, grafanaCom)
+			So(ProviderName("gitlab"), ShouldEqual, "gitlab")
+		})
+
+		Convey("Should remove the alias once the provider is disabled", func() {
+			sec.Key("enabled").SetValue("false")
+			delete(SocialMap, grafanaCom)
+			NewOAuthService()
+
+			So(SocialMap, ShouldNotContainKey, grafanaNet)
+		})
+
+		Reset(func() {
+			setting.Raw, setting.OAuthService = origRaw, origOAuthService
+			delete(SocialMap, grafanaCom)
+			delete(SocialMap, grafanaNet)
+			delete(oauthSections, grafanaCom)
+			if hadGrafanaCom {
+				SocialMap[grafanaCom] = origGrafanaCom
+			}
+			oauthProviderInfos = make(map[string]*OAuthProviderInfo)
+		})
+	})
+}
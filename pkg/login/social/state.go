@@ -0,0 +1,94 @@
+package social
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var (
+	ErrStateSignatureInvalid = errors.New("OAuth state signature is invalid")
+	ErrReturnUrlInvalid      = errors.New("OAuth return URL must be a path of Grafana")
+)
+
+// EncodeState adds the URL to return to after login to the state of the login, signed so it cannot be
+// changed to redirect elsewhere. Only paths of Grafana can be returned to, other URLs and providers without
+// return_url_in_state leave the state unchanged.
+func (s *SocialBase) EncodeState(state string, returnUrl string) string {
+	if !s.returnUrlInState || returnUrl == "" {
+		return state
+	}
+
+	if err := validateReturnUrl(returnUrl); err != nil {
+		s.log.Warn("Not returning to URL after login", "url", returnUrl, "error", err)
+		return state
+	}
+
+	payload := state + "." + base64.RawURLEncoding.EncodeToString([]byte(returnUrl))
+	return payload + "." + s.stateSignature(payload)
+}
+
+// DecodeState returns the URL to return to after login encoded in the state, or an empty string when the state
+// holds none. It fails when the signature or the URL is invalid.
+func (s *SocialBase) DecodeState(state string) (string, error) {
+	if !s.returnUrlInState {
+		return "", nil
+	}
+
+	parts := strings.Split(state, ".")
+	if len(parts) == 1 {
+		return "", nil
+	}
+	if len(parts) != 3 {
+		return "", ErrStateSignatureInvalid
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.stateSignature(payload))) {
+		return "", ErrStateSignatureInvalid
+	}
+
+	returnUrl, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrStateSignatureInvalid
+	}
+
+	if err := validateReturnUrl(string(returnUrl)); err != nil {
+		return "", err
+	}
+
+	return string(returnUrl), nil
+}
+
+// stateSignature signs with the secret key of Grafana and the client secret of the provider, so states are not
+// accepted by another provider
+func (s *SocialBase) stateSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(setting.SecretKey+s.ClientSecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateReturnUrl accepts paths below the sub path Grafana is served from, rejecting absolute and protocol
+// relative URLs that would redirect to another site
+func validateReturnUrl(returnUrl string) error {
+	if !strings.HasPrefix(returnUrl, "/") || strings.HasPrefix(returnUrl, "//") || strings.Contains(returnUrl, "\\") {
+		return ErrReturnUrlInvalid
+	}
+
+	parsed, err := url.Parse(returnUrl)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return ErrReturnUrlInvalid
+	}
+
+	if setting.AppSubUrl != "" && parsed.Path != setting.AppSubUrl && !strings.HasPrefix(parsed.Path, setting.AppSubUrl+"/") {
+		return ErrReturnUrlInvalid
+	}
+
+	return nil
+}
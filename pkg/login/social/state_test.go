@@ -0,0 +1,87 @@
+package social
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/oauth2"
+)
+
+func TestOAuthState(t *testing.T) {
+	Convey("Given a provider returning to the URL in the state", t, func() {
+		origSecretKey, origAppSubUrl := setting.SecretKey, setting.AppSubUrl
+		setting.SecretKey = "secret"
+		setting.AppSubUrl = ""
+
+		provider := &SocialBase{Config: &oauth2.Config{ClientSecret: "client-secret"}, log: log.New("test"), returnUrlInState: true}
+
+		Convey("Should return to the encoded URL", func() {
+			state := provider.EncodeState("abc=", "/d/uid/service?orgId=1&var-host=a.b")
+			So(state, ShouldStartWith, "abc=.")
+
+			returnUrl, err := provider.DecodeState(state)
+			So(err, ShouldBeNil)
+			So(returnUrl, ShouldEqual, "/d/uid/service?orgId=1&var-host=a.b")
+		})
+
+		Convey("Should leave the state without a return URL unchanged", func() {
+			So(provider.EncodeState("abc=", ""), ShouldEqual, "abc=")
+
+			returnUrl, err := provider.DecodeState("abc=")
+			So(err, ShouldBeNil)
+			So(returnUrl, ShouldBeEmpty)
+		})
+
+		Convey("Should not encode URLs of other sites", func() {
+			for _, returnUrl := range []string{"https://evil.example.com/", "//evil.example.com", "/\\\\evil.example.com", "d/uid"} {
+				So(provider.EncodeState("abc=", returnUrl), ShouldEqual, "abc=")
+			}
+		})
+
+		Convey("Should only encode paths below the sub path of Grafana", func() {
+			setting.AppSubUrl = "/grafana"
+			So(provider.EncodeState("abc=", "/other/d/uid"), ShouldEqual, "abc=")
+			So(provider.EncodeState("abc=", "/grafanax/d/uid"), ShouldEqual, "abc=")
+			So(provider.EncodeState("abc=", "/grafana/d/uid"), ShouldNotEqual, "abc=")
+		})
+
+		Convey("Should reject a changed return URL", func() {
+			parts := strings.Split(provider.EncodeState("abc=", "/d/uid"), ".")
+			forged := provider.EncodeState("abc=", "/d/other")
+			forgedParts := strings.Split(forged, ".")
+
+			_, err := provider.DecodeState(parts[0] + "." + forgedParts[1] + "." + parts[2])
+			So(err, ShouldEqual, ErrStateSignatureInvalid)
+		})
+
+		Convey("Should reject a state signed by another provider", func() {
+			other := &SocialBase{Config: &oauth2.Config{ClientSecret: "other-secret"}, log: log.New("test"), returnUrlInState: true}
+
+			_, err := provider.DecodeState(other.EncodeState("abc=", "/d/uid"))
+			So(err, ShouldEqual, ErrStateSignatureInvalid)
+		})
+
+		Convey("Should reject a signed URL of another site", func() {
+			payload := "abc=.Ly9ldmlsLmV4YW1wbGUuY29t"
+			_, err := provider.DecodeState(payload + "." + provider.stateSignature(payload))
+			So(err, ShouldEqual, ErrReturnUrlInvalid)
+		})
+
+		Convey("Should ignore the return URL when disabled", func() {
+			state := provider.EncodeState("abc=", "/d/uid")
+			provider.returnUrlInState = false
+
+			So(provider.EncodeState("abc=", "/d/uid"), ShouldEqual, "abc=")
+			returnUrl, err := provider.DecodeState(state)
+			So(err, ShouldBeNil)
+			So(returnUrl, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			setting.SecretKey, setting.AppSubUrl = origSecretKey, origAppSubUrl
+		})
+	})
+}
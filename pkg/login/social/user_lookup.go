@@ -0,0 +1,76 @@
+package social
+
+import (
+	"errors"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrAmbiguousExternalIdentity is returned when an identity of a git provider matches several Grafana users
+var ErrAmbiguousExternalIdentity = errors.New("External identity matches several users")
+
+// lookupGrafanaUser finds the user linked to the identity by the external id stored when the user
+// signed in with the provider, or else by the email of the identity. An email matching the login of
+// one user and the email of another is not resolved.
+func lookupGrafanaUser(authModule string, orgId int64, identity ExternalIdentity) (*models.SignedInUser, error) {
+	userId, err := lookupUserIdByAuthId(authModule, identity.Id)
+	if err == models.ErrUserNotFound {
+		userId, err = lookupUserIdByEmail(identity.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := &models.GetSignedInUserQuery{UserId: userId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	// users outside the organization are not attributed anything in it
+	if query.Result.OrgId != orgId {
+		return nil, models.ErrUserNotFound
+	}
+
+	return query.Result, nil
+}
+
+func lookupUserIdByAuthId(authModule string, authId string) (int64, error) {
+	if authId == "" {
+		return 0, models.ErrUserNotFound
+	}
+
+	query := &models.GetAuthInfoQuery{AuthModule: authModule, AuthId: authId}
+	if err := bus.Dispatch(query); err != nil {
+		return 0, err
+	}
+
+	return query.Result.UserId, nil
+}
+
+func lookupUserIdByEmail(email string) (int64, error) {
+	if email == "" {
+		return 0, models.ErrUserNotFound
+	}
+
+	byEmail := &models.GetUserByEmailQuery{Email: email}
+	if err := bus.Dispatch(byEmail); err != nil && err != models.ErrUserNotFound {
+		return 0, err
+	}
+
+	byLogin := &models.GetUserByLoginQuery{LoginOrEmail: email}
+	if err := bus.Dispatch(byLogin); err != nil && err != models.ErrUserNotFound {
+		return 0, err
+	}
+
+	switch {
+	case byEmail.Result != nil && byLogin.Result != nil && byEmail.Result.Id != byLogin.Result.Id:
+		return 0, ErrAmbiguousExternalIdentity
+	case byEmail.Result != nil:
+		return byEmail.Result.Id, nil
+	case byLogin.Result != nil:
+		return byLogin.Result.Id, nil
+	}
+
+	return 0, models.ErrUserNotFound
+}
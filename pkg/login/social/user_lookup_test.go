@@ -0,0 +1,108 @@
+package social
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupGrafanaUser(t *testing.T) {
+	Convey("Given users who signed in with GitLab and users who did not", t, func() {
+		users := map[int64]*models.User{
+			1: {Id: 1, Login: "jane", Email: "jane@example.com"},
+			2: {Id: 2, Login: "john", Email: "john@example.com"},
+			3: {Id: 3, Login: "shared@example.com", Email: "bob@example.com"},
+			4: {Id: 4, Login: "alice", Email: "shared@example.com"},
+			5: {Id: 5, Login: "other", Email: "other@example.com"},
+		}
+
+		bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+			if query.AuthModule == "oauth_gitlab" && query.AuthId == "42" {
+				query.Result = &models.UserAuth{UserId: 2, AuthModule: "oauth_gitlab", AuthId: "42"}
+				return nil
+			}
+			return models.ErrUserNotFound
+		})
+
+		bus.AddHandler("test", func(query *models.GetUserByEmailQuery) error {
+			for _, user := range users {
+				if user.Email == query.Email {
+					query.Result = user
+					return nil
+				}
+			}
+			return models.ErrUserNotFound
+		})
+
+		bus.AddHandler("test", func(query *models.GetUserByLoginQuery) error {
+			for _, user := range users {
+				if user.Login == query.LoginOrEmail {
+					query.Result = user
+					return nil
+				}
+			}
+			for _, user := range users {
+				if user.Email == query.LoginOrEmail {
+					query.Result = user
+					return nil
+				}
+			}
+			return models.ErrUserNotFound
+		})
+
+		bus.AddHandler("test", func(query *models.GetSignedInUserQuery) error {
+			user := users[query.UserId]
+			result := &models.SignedInUser{UserId: user.Id, Login: user.Login, Email: user.Email, OrgId: query.OrgId, OrgRole: models.ROLE_EDITOR}
+			// user 5 is not a member of the organization
+			if user.Id == 5 {
+				result.OrgId = -1
+				result.OrgRole = ""
+			}
+			query.Result = result
+			return nil
+		})
+
+		connector := &SocialGitlab{}
+		lookup := func(identity ExternalIdentity) (*models.SignedInUser, error) {
+			return connector.LookupGrafanaUser(context.Background(), 1, identity)
+		}
+
+		Convey("Should map the GitLab user id before the email", func() {
+			user, err := lookup(ExternalIdentity{Id: "42", Email: "jane@example.com"})
+			So(err, ShouldBeNil)
+			So(user.UserId, ShouldEqual, 2)
+			So(user.OrgId, ShouldEqual, 1)
+		})
+
+		Convey("Should fall back to the email for unknown GitLab user ids", func() {
+			user, err := lookup(ExternalIdentity{Id: "43", Name: "Jane Doe", Email: "jane@example.com"})
+			So(err, ShouldBeNil)
+			So(user.UserId, ShouldEqual, 1)
+		})
+
+		Convey("Should not find unmapped identities", func() {
+			_, err := lookup(ExternalIdentity{Name: "Unknown", Email: "unknown@example.com"})
+			So(err, ShouldEqual, models.ErrUserNotFound)
+
+			_, err = lookup(ExternalIdentity{Name: "Unknown"})
+			So(err, ShouldEqual, models.ErrUserNotFound)
+		})
+
+		Convey("Should not guess when the email matches several users", func() {
+			_, err := lookup(ExternalIdentity{Email: "shared@example.com"})
+			So(err, ShouldEqual, ErrAmbiguousExternalIdentity)
+		})
+
+		Convey("Should not map users outside the organization", func() {
+			_, err := lookup(ExternalIdentity{Email: "other@example.com"})
+			So(err, ShouldEqual, models.ErrUserNotFound)
+		})
+
+		Reset(func() {
+			bus.ClearBusHandlers()
+		})
+	})
+}
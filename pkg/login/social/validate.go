@@ -0,0 +1,116 @@
+package social
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// OAuthConfigError lists the problems of the settings of an OAuth provider
+type OAuthConfigError struct {
+	Provider string
+	Problems []string
+}
+
+func (e OAuthConfigError) Error() string {
+	return fmt.Sprintf("Invalid settings of auth.%s: %s", e.Provider, strings.Join(e.Problems, "; "))
+}
+
+// OAuthProviderInfo tells whether an enabled OAuth provider could be registered, and why not
+type OAuthProviderInfo struct {
+	Name           string   `json:"name"`
+	DisplayName    string   `json:"displayName"`
+	Enabled        bool     `json:"enabled"`
+	DisabledReason string   `json:"disabledReason,omitempty"`
+	Problems       []string `json:"problems,omitempty"`
+	// Capabilities are nil for providers that are not registered
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// oauthProviderInfos are the providers enabled in the settings, registered or not
+var oauthProviderInfos = make(map[string]*OAuthProviderInfo)
+
+// GetOAuthProviderInfos returns the providers enabled in the settings, including those disabled because their
+// settings are invalid, sorted by name. The registered providers have the capabilities of their connector.
+func GetOAuthProviderInfos() []*OAuthProviderInfo {
+	infos := make([]*OAuthProviderInfo, 0, len(oauthProviderInfos))
+	for name, info := range oauthProviderInfos {
+		info := *info
+		info.Capabilities = nil
+		if connector, ok := SocialMap[name]; ok && info.Enabled {
+			capabilities := connector.Capabilities()
+			info.Capabilities = &capabilities
+		}
+		infos = append(infos, &info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// ValidateOAuthInfo checks the settings an enabled provider needs to log users in, returning an OAuthConfigError
+// with all their problems
+func ValidateOAuthInfo(name string, info *setting.OAuthInfo) error {
+	problems := make([]string, 0)
+
+	if strings.TrimSpace(info.ClientId) == "" {
+		problems = append(problems, "client_id is required")
+	}
+	if strings.TrimSpace(info.ClientSecret) == "" {
+		problems = append(problems, "client_secret is required")
+	}
+
+	// the endpoints of Grafana.com are built from grafana_com_url
+	if name != grafanaCom {
+		problems = appendUrlProblem(problems, "auth_url", info.AuthUrl, true)
+		problems = appendUrlProblem(problems, "token_url", info.TokenUrl, true)
+	}
+
+	apiUrlRequired := name == "github" || name == "gitlab" || name == "generic_oauth"
+	problems = appendUrlProblem(problems, "api_url", info.ApiUrl, apiUrlRequired)
+
+	for _, scope := range info.Scopes {
+		if scope == "" {
+			problems = append(problems, "scopes has an empty entry, remove the leading or trailing separator")
+			break
+		}
+		if strings.ContainsAny(scope, "\t\n\"'") {
+			problems = append(problems, fmt.Sprintf("scope %q is not valid, separate scopes by commas or spaces", scope))
+		}
+	}
+
+	if len(problems) > 0 {
+		return OAuthConfigError{Provider: name, Problems: problems}
+	}
+	return nil
+}
+
+// appendUrlProblem checks that the URL of the key is absolute and has no surrounding whitespace
+func appendUrlProblem(problems []string, key string, value string, required bool) []string {
+	if value == "" {
+		if required {
+			return append(problems, key+" is required")
+		}
+		return problems
+	}
+
+	if strings.TrimSpace(value) != value {
+		return append(problems, key+" has leading or trailing whitespace")
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s is not a valid URL: %v", key, err))
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return append(problems, key+" must be an absolute http or https URL")
+	}
+
+	return problems
+}
@@ -0,0 +1,255 @@
+package social
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	ini "gopkg.in/ini.v1"
+)
+
+func TestValidateOAuthInfo(t *testing.T) {
+	validInfo := func() *setting.OAuthInfo {
+		return &setting.OAuthInfo{
+			ClientId:     "client",
+			ClientSecret: "secret",
+			Scopes:       []string{"user:email", "read:org"},
+			AuthUrl:      "https://provider.example.com/oauth/authorize",
+			TokenUrl:     "https://provider.example.com/oauth/token",
+			ApiUrl:       "https://provider.example.com/api",
+			Enabled:      true,
+		}
+	}
+
+	problems := func(name string, info *setting.OAuthInfo) []string {
+		err := ValidateOAuthInfo(name, info)
+		if err == nil {
+			return nil
+		}
+		So(err, ShouldHaveSameTypeAs, OAuthConfigError{})
+		return err.(OAuthConfigError).Problems
+	}
+
+	for _, name := range []string{"github", "gitlab", "google", "generic_oauth", grafanaCom} {
+		name := name
+
+		Convey("Given the settings of "+name, t, func() {
+			info := validInfo()
+
+			Convey("Should accept complete settings", func() {
+				So(ValidateOAuthInfo(name, info), ShouldBeNil)
+			})
+
+			Convey("Should require the client id", func() {
+				info.ClientId = " "
+				So(problems(name, info), ShouldResemble, []string{"client_id is required"})
+			})
+
+			Convey("Should require the client secret", func() {
+				info.ClientSecret = ""
+				So(problems(name, info), ShouldResemble, []string{"client_secret is required"})
+			})
+
+			Convey("Should reject an empty scope", func() {
+				info.Scopes = []string{"user:email", ""}
+				So(problems(name, info), ShouldHaveLength, 1)
+			})
+
+			Convey("Should reject a scope with quotes", func() {
+				info.Scopes = []string{`"user:email`}
+				So(problems(name, info), ShouldHaveLength, 1)
+			})
+
+			Convey("Should report all the problems", func() {
+				info.ClientId = ""
+				info.ClientSecret = ""
+				So(problems(name, info), ShouldHaveLength, 2)
+			})
+
+			if name == grafanaCom {
+				Convey("Should not require the auth and token URLs", func() {
+					info.AuthUrl = ""
+					info.TokenUrl = ""
+					So(ValidateOAuthInfo(name, info), ShouldBeNil)
+				})
+			} else {
+				Convey("Should require the auth URL", func() {
+					info.AuthUrl = ""
+					So(problems(name, info), ShouldResemble, []string{"auth_url is required"})
+				})
+
+				Convey("Should require the token URL", func() {
+					info.TokenUrl = ""
+					So(problems(name, info), ShouldResemble, []string{"token_url is required"})
+				})
+
+				Convey("Should reject a token URL with a trailing space", func() {
+					info.TokenUrl = "https://provider.example.com/oauth/token "
+					So(problems(name, info), ShouldResemble, []string{"token_url has leading or trailing whitespace"})
+				})
+
+				Convey("Should reject a relative auth URL", func() {
+					info.AuthUrl = "/oauth/authorize"
+					So(problems(name, info), ShouldResemble, []string{"auth_url must be an absolute http or https URL"})
+				})
+
+				Convey("Should reject an auth URL that does not parse", func() {
+					info.AuthUrl = "https://provider example.com:port/"
+					So(problems(name, info), ShouldHaveLength, 1)
+				})
+			}
+
+			Convey("Should reject an invalid API URL", func() {
+				info.ApiUrl = "provider.example.com/api"
+				So(problems(name, info), ShouldResemble, []string{"api_url must be an absolute http or https URL"})
+			})
+
+			if name == "github" || name == "gitlab" || name == "generic_oauth" {
+				Convey("Should require the API URL", func() {
+					info.ApiUrl = ""
+					So(problems(name, info), ShouldResemble, []string{"api_url is required"})
+				})
+			} else {
+				Convey("Should not require the API URL", func() {
+					info.ApiUrl = ""
+					So(ValidateOAuthInfo(name, info), ShouldBeNil)
+				})
+			}
+		})
+	}
+}
+
+func TestNewOAuthServiceValidation(t *testing.T) {
+	Convey("Given a valid and an invalid enabled provider", t, func() {
+		origRaw, origOAuthService := setting.Raw, setting.OAuthService
+		origGithub, hadGithub := SocialMap["github"]
+		origGoogle, hadGoogle := SocialMap["google"]
+
+		setting.Raw = ini.Empty()
+		github := setting.Raw.Section("auth.github")
+		github.Key("enabled").SetValue("true")
+		github.Key("client_id").SetValue("client")
+		github.Key("auth_url").SetValue("https://github.com/login/oauth/authorize")
+		github.Key("token_url").SetValue("https://github.com/login/oauth/access_token ")
+
+		google := setting.Raw.Section("auth.google")
+		google.Key("enabled").SetValue("true")
+		google.Key("name").SetValue("Google")
+		google.Key("client_id").SetValue("client")
+		google.Key("client_secret").SetValue("secret")
+		google.Key("auth_url").SetValue("https://accounts.google.com/o/oauth2/auth")
+		google.Key("token_url").SetValue("https://accounts.google.com/o/oauth2/token")
+
+		NewOAuthService()
+
+		Convey("Should only register the valid provider", func() {
+			_, ok := SocialMap["github"]
+			So(ok, ShouldBeFalse)
+			So(setting.OAuthService.OAuthInfos, ShouldContainKey, "google")
+			So(setting.OAuthService.OAuthInfos, ShouldNotContainKey, "github")
+			So(SocialMap["google"], ShouldNotBeNil)
+		})
+
+		Convey("Should return the invalid provider as disabled with its problems", func() {
+			infos := GetOAuthProviderInfos()
+			So(infos, ShouldHaveLength, 2)
+
+			So(infos[0].Name, ShouldEqual, "github")
+			So(infos[0].Enabled, ShouldBeFalse)
+			So(infos[0].DisabledReason, ShouldEqual, "Invalid settings")
+			So(infos[0].Problems, ShouldResemble, []string{
+				"client_secret is required",
+				"token_url has leading or trailing whitespace",
+				"api_url is required",
+			})
+
+			So(infos[1], ShouldResemble, &OAuthProviderInfo{
+				Name:         "google",
+				DisplayName:  "Google",
+				Enabled:      true,
+				Capabilities: &Capabilities{RoleMapping: true},
+			})
+		})
+
+		Reset(func() {
+			setting.Raw, setting.OAuthService = origRaw, origOAuthService
+			delete(SocialMap, "github")
+			delete(SocialMap, "google")
+			delete(oauthSections, "google")
+			if hadGithub {
+				SocialMap["github"] = origGithub
+			}
+			if hadGoogle {
+				SocialMap["google"] = origGoogle
+			}
+			oauthProviderInfos = make(map[string]*OAuthProviderInfo)
+		})
+	})
+}
+
+func TestOAuthProviderCapabilities(t *testing.T) {
+	Convey("Given enabled GitLab and generic OAuth providers", t, func() {
+		origRaw, origOAuthService := setting.Raw, setting.OAuthService
+		origGitlab, hadGitlab := SocialMap["gitlab"]
+		origGeneric, hadGeneric := SocialMap["generic_oauth"]
+
+		setting.Raw = ini.Empty()
+		for _, name := range []string{"gitlab", "generic_oauth"} {
+			sec := setting.Raw.Section("auth." + name)
+			sec.Key("enabled").SetValue("true")
+			sec.Key("client_id").SetValue("client")
+			sec.Key("client_secret").SetValue("secret")
+			sec.Key("auth_url").SetValue("https://provider.example.com/oauth/authorize")
+			sec.Key("token_url").SetValue("https://provider.example.com/oauth/token")
+			sec.Key("api_url").SetValue("https://provider.example.com/api")
+		}
+
+		capabilities := func() map[string]*Capabilities {
+			NewOAuthService()
+			result := make(map[string]*Capabilities)
+			for _, info := range GetOAuthProviderInfos() {
+				result[info.Name] = info.Capabilities
+			}
+			return result
+		}
+
+		Convey("Should sync dashboards with GitLab when repositories are configured", func() {
+			repo := setting.Raw.Section("auth.gitlab.repo.ops")
+			repo.Key("org_id").SetValue("1")
+			repo.Key("repo_id").SetValue("42")
+			repo.Key("url").SetValue("https://provider.example.com/api/v4/projects/42")
+			repo.Key("branch").SetValue("master")
+			setting.Raw.Section("auth.gitlab").Key("repo_allowed_hosts").SetValue("provider.example.com")
+
+			So(capabilities()["gitlab"], ShouldResemble, &Capabilities{DashboardSync: true, GroupFetching: true, RoleMapping: true})
+		})
+
+		Convey("Should not sync dashboards with GitLab without repositories", func() {
+			So(capabilities()["gitlab"], ShouldResemble, &Capabilities{GroupFetching: true, RoleMapping: true})
+		})
+
+		Convey("Should only map the roles of generic OAuth users", func() {
+			So(capabilities()["generic_oauth"], ShouldResemble, &Capabilities{RoleMapping: true})
+		})
+
+		Convey("Should not return capabilities for providers with invalid settings", func() {
+			setting.Raw.Section("auth.generic_oauth").Key("client_secret").SetValue("")
+			So(capabilities()["generic_oauth"], ShouldBeNil)
+		})
+
+		Reset(func() {
+			setting.Raw, setting.OAuthService = origRaw, origOAuthService
+			delete(SocialMap, "gitlab")
+			delete(SocialMap, "generic_oauth")
+			delete(oauthSections, "gitlab")
+			delete(oauthSections, "generic_oauth")
+			if hadGitlab {
+				SocialMap["gitlab"] = origGitlab
+			}
+			if hadGeneric {
+				SocialMap["generic_oauth"] = origGeneric
+			}
+			oauthProviderInfos = make(map[string]*OAuthProviderInfo)
+		})
+	})
+}
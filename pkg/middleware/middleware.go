@@ -226,6 +226,13 @@ func initContextWithToken(authTokenService models.UserTokenService, ctx *models.
 	if repoToken != "" {
 		result.AuthModule = oauthMode
 		result.Token = repoToken
+
+		identityQuery := &models.GetExternalIdentityQuery{UserId: result.UserId, Provider: "oauth_" + oauthMode}
+		if err := bus.Dispatch(identityQuery); err == nil {
+			result.ExternalIdentity = identityQuery.Result
+		} else if err != models.ErrUserNotFound {
+			ctx.Logger.Warn("Failed to get the external identity of the user", "userId", result.UserId, "provider", oauthMode, "error", err)
+		}
 	}
 
 	ctx.SignedInUser = result
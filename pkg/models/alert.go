@@ -1,12 +1,17 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/grafana/grafana/pkg/components/simplejson"
 )
 
+// ErrAlertExtractionTimeout is returned when extracting the alerts of a dashboard takes
+// longer than the configured timeout.
+var ErrAlertExtractionTimeout = errors.New("Timed out extracting alert rules from the dashboard")
+
 type AlertStateType string
 type AlertSeverityType string
 type NoDataOption string
@@ -239,6 +244,9 @@ type UpdateDashboardAlertsCommand struct {
 	OrgId     int64
 	Dashboard *Dashboard
 	User      *SignedInUser
+
+	// Progress, if set, is called as the alerts of the dashboard panels are extracted
+	Progress func(done int, total int)
 }
 
 type ValidateDashboardAlertsCommand struct {
@@ -246,4 +254,38 @@ type ValidateDashboardAlertsCommand struct {
 	OrgId     int64
 	Dashboard *Dashboard
 	User      *SignedInUser
+	// TargetFolder is the folder the dashboard moves to, with id 0 for the General folder. When set, the
+	// notification channels of the alerts are checked against the permissions of the user in the folder.
+	TargetFolder *Dashboard
+
+	// Result are the notification channels of the alerts the user cannot use from TargetFolder
+	Result []*AlertNotificationViolation
+}
+
+// AlertNotificationViolation is a notification channel of an alert the user cannot use from the folder of the
+// dashboard
+type AlertNotificationViolation struct {
+	AlertName        string `json:"alertName"`
+	PanelId          int64  `json:"panelId"`
+	NotificationUid  string `json:"notificationUid"`
+	NotificationName string `json:"notificationName"`
+}
+
+// AlertNotificationsDeniedError rejects moving a dashboard to a folder from which the user cannot use the
+// notification channels of its alerts
+type AlertNotificationsDeniedError struct {
+	Folder     string
+	Violations []*AlertNotificationViolation
+}
+
+func (e AlertNotificationsDeniedError) Error() string {
+	return fmt.Sprintf("%d alert notification channels cannot be used from folder %s", len(e.Violations), e.Folder)
+}
+
+// DiffDashboardAlertsQuery describes the alert changes between two versions of a dashboard, one line per change
+type DiffDashboardAlertsQuery struct {
+	Previous *Dashboard
+	Current  *Dashboard
+
+	Result []string
 }
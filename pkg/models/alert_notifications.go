@@ -113,6 +113,16 @@ type GetAlertNotificationsWithUidToSendQuery struct {
 	Result []*AlertNotification
 }
 
+// AlertNotificationsPermissionFilterQuery filters the notification channels the user can use in the alerts of
+// dashboards in the folder. Without a handler, every notification channel can be used.
+type AlertNotificationsPermissionFilterQuery struct {
+	User          *SignedInUser
+	Folder        *Dashboard
+	Notifications []*AlertNotification
+
+	Result []*AlertNotification
+}
+
 type GetAllAlertNotificationsQuery struct {
 	OrgId int64
 
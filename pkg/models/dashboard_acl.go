@@ -110,3 +110,11 @@ type GetDashboardAclInfoListQuery struct {
 	OrgId       int64
 	Result      []*DashboardAclInfoDTO
 }
+
+// GetFolderAclListQuery returns the permissions set on a folder and on each of its dashboards, without the
+// inherited and default ones. FolderId 0 returns the permissions of the dashboards in the General folder.
+type GetFolderAclListQuery struct {
+	FolderId int64
+	OrgId    int64
+	Result   []*DashboardAclInfoDTO
+}
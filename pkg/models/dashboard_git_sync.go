@@ -0,0 +1,164 @@
+package models
+
+import (
+	"time"
+)
+
+// Identities dashboard commits are made with
+const (
+	// GitCommitModeUser commits with the token of the signed in user
+	GitCommitModeUser = "user"
+	// GitCommitModeSudo commits with the access token of the repository on behalf of the user
+	GitCommitModeSudo = "sudo"
+	// GitCommitModeService commits with the access token of the repository
+	GitCommitModeService = "service"
+)
+
+// File actions a dashboard commit falls back to when the file is not in the state Grafana expected, e.g. it was
+// deleted in the repository
+const (
+	// GitFallbackCreate creates the file an update did not find
+	GitFallbackCreate = "create"
+	// GitFallbackUpdate updates the file a create found
+	GitFallbackUpdate = "update"
+	// GitFallbackSkipDelete skips the delete of a file that is already gone
+	GitFallbackSkipDelete = "skip-delete"
+)
+
+// What a dashboard commit does when the file was changed in the repository since the dashboard was last synced
+const (
+	// GitConflictOverwrite commits the dashboard over the change
+	GitConflictOverwrite = "overwrite"
+	// GitConflictSkip saves the dashboard without committing it and marks it drifted from its file
+	GitConflictSkip = "skip"
+	// GitConflictFail fails the save with ErrDashboardGitConflict
+	GitConflictFail = "fail"
+)
+
+// GitSourceFormatJsonnet marks dashboards imported from jsonnet files rendered to json. Their source is only
+// changed in the repository, Grafana never commits them.
+const GitSourceFormatJsonnet = "jsonnet"
+
+// DashboardGitSync holds the state of the last commit of a dashboard to a git repository
+type DashboardGitSync struct {
+	Id          int64
+	DashboardId int64
+	OrgId       int64
+	Provider    string
+	// RepoId is the repository the dashboard was committed to, 0 for commits made before it was recorded
+	RepoId     int
+	FilePath   string
+	CommitSha  string
+	CommitMode string
+	// ContentHash is the sha256 of the committed file, empty for commits made before it was recorded
+	ContentHash string
+	// ConflictCommitSha is the commit that changed the file outside of Grafana when a commit of the dashboard was
+	// skipped, see GitConflictSkip. The dashboard is drifted from its file until it is committed again.
+	ConflictCommitSha string
+	// Branch is set when the commit was made to an overridden branch instead of the branch of the repository
+	Branch string
+	// FallbackAction is set when the commit used another file action than Grafana chose, see GitFallbackCreate
+	FallbackAction string
+	// SourceFormat is set when FilePath is not a json file but the source the dashboard was rendered from, see
+	// GitSourceFormatJsonnet
+	SourceFormat string
+	// where the commit was requested from, only kept for audits
+	ClientIp  string
+	UserAgent string
+	RequestId string
+	Updated   time.Time
+}
+
+// DashboardGitSyncPath is a path a dashboard has been synced to, kept after the dashboard moves so files at
+// old paths can still be traced back to the dashboard. PathHash is the md5 of FilePath, which is too long to index.
+type DashboardGitSyncPath struct {
+	Id          int64
+	DashboardId int64
+	OrgId       int64
+	RepoId      int
+	FilePath    string
+	PathHash    string
+	Updated     time.Time
+}
+
+// DashboardGitSyncMeta is the git sync information returned with the dashboard meta
+type DashboardGitSyncMeta struct {
+	Enabled       bool   `json:"enabled"`
+	Provider      string `json:"provider"`
+	RepoWebUrl    string `json:"repoWebUrl,omitempty"`
+	FilePath      string `json:"filePath,omitempty"`
+	LastCommitSha string `json:"lastCommitSha,omitempty"`
+	CommitMode    string `json:"commitMode,omitempty"`
+	Branch        string `json:"branch,omitempty"`
+	// FallbackAction tells that the last commit fixed the file action, e.g. recreating a file deleted in the repository
+	FallbackAction string `json:"fallbackAction,omitempty"`
+	// SourceFormat tells that the dashboard is rendered from a source file it is never committed to
+	SourceFormat string `json:"sourceFormat,omitempty"`
+	// Drifted tells that the last change of the dashboard was not committed because the file was changed in the
+	// repository by ConflictCommitSha
+	Drifted           bool       `json:"drifted,omitempty"`
+	ConflictCommitSha string     `json:"conflictCommitSha,omitempty"`
+	LastSyncTime      *time.Time `json:"lastSyncTime,omitempty"`
+}
+
+// GitCommitAuthor is credited in a dashboard commit with a Co-authored-by trailer
+type GitCommitAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// DashboardGitOverride makes a single save commit the dashboard to another branch, and optionally another
+// repository of the organization, e.g. the feature branch a CI pipeline is working on
+type DashboardGitOverride struct {
+	Branch string `json:"branch"`
+	RepoId int    `json:"repoId"`
+}
+
+//
+// COMMANDS
+//
+
+type SaveDashboardGitSyncCommand struct {
+	DashboardId int64
+	OrgId       int64
+	Provider    string
+	RepoId      int
+	FilePath    string
+	CommitSha   string
+	CommitMode  string
+	Branch      string
+	RequestMeta *RequestMeta
+
+	FallbackAction    string
+	SourceFormat      string
+	ContentHash       string
+	ConflictCommitSha string
+
+	Result *DashboardGitSync
+}
+
+//
+// QUERIES
+//
+
+type GetDashboardGitSyncQuery struct {
+	DashboardId int64
+
+	Result *DashboardGitSync
+}
+
+type GetDashboardGitSyncsQuery struct {
+	OrgId int64
+
+	Result []*DashboardGitSync
+}
+
+// FindDashboardGitSyncPathsQuery returns the dashboards synced to FilePath now or in the past, most recent
+// first. RepoId 0 matches all repositories.
+type FindDashboardGitSyncPathsQuery struct {
+	OrgId    int64
+	RepoId   int
+	FilePath string
+
+	Result []*DashboardGitSyncPath
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrDashboardJobNotFound = errors.New("Dashboard job not found")
+
+type DashboardJobState string
+
+const (
+	DashboardJobQueued    DashboardJobState = "queued"
+	DashboardJobRunning   DashboardJobState = "running"
+	DashboardJobSucceeded DashboardJobState = "succeeded"
+	DashboardJobFailed    DashboardJobState = "failed"
+	DashboardJobCancelled DashboardJobState = "cancelled"
+)
+
+// Finished tells whether a job in the state will not run anymore
+func (s DashboardJobState) Finished() bool {
+	return s == DashboardJobSucceeded || s == DashboardJobFailed || s == DashboardJobCancelled
+}
+
+// DashboardJob is a long running dashboard operation, e.g. a repository layout migration, run in the
+// background. Its params and result are json documents specific to its kind.
+type DashboardJob struct {
+	Id        int64
+	OrgId     int64
+	Kind      string
+	Params    string
+	State     DashboardJobState
+	Done      int
+	Total     int
+	Result    string
+	Error     string
+	CreatedBy int64
+	Created   time.Time
+	Started   time.Time
+	Finished  time.Time
+	Updated   time.Time
+}
+
+//
+// COMMANDS
+//
+
+type CreateDashboardJobCommand struct {
+	OrgId     int64
+	Kind      string
+	Params    string
+	CreatedBy int64
+
+	Result *DashboardJob
+}
+
+// UpdateDashboardJobCommand stores the state, progress and outcome of the job
+type UpdateDashboardJobCommand struct {
+	Job *DashboardJob
+}
+
+// DeleteFinishedDashboardJobsCommand deletes the jobs that finished before the time
+type DeleteFinishedDashboardJobsCommand struct {
+	FinishedBefore time.Time
+
+	DeletedRows int64
+}
+
+//
+// QUERIES
+//
+
+type GetDashboardJobQuery struct {
+	Id int64
+
+	Result *DashboardJob
+}
+
+// GetDashboardJobsByStateQuery returns the jobs in any of the states, oldest first
+type GetDashboardJobsByStateQuery struct {
+	States []DashboardJobState
+
+	Result []*DashboardJob
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// DashboardMaintenance is the maintenance mode of dashboards set through the API. It is stored in a single row, so
+// all the instances of Grafana sharing the database see it. While ReadOnly, dashboards and folders cannot be saved
+// or deleted. EndsAt is the estimated end of the maintenance in unix seconds, 0 when unknown.
+type DashboardMaintenance struct {
+	Id        int64
+	ReadOnly  bool
+	Message   string
+	EndsAt    int64
+	UpdatedBy int64
+	Updated   time.Time
+}
+
+//
+// COMMANDS
+//
+
+type SetDashboardMaintenanceCommand struct {
+	ReadOnly  bool
+	Message   string
+	EndsAt    int64
+	UpdatedBy int64
+
+	Result *DashboardMaintenance
+}
+
+//
+// QUERIES
+//
+
+// GetDashboardMaintenanceQuery returns the maintenance mode of dashboards, nil when it was never set
+type GetDashboardMaintenanceQuery struct {
+	Result *DashboardMaintenance
+}
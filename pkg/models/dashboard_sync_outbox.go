@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrDashboardSyncOutboxItemNotFound = errors.New("Dashboard sync outbox item not found")
+	// ErrDashboardSyncOutboxLeaseLost is returned when completing an item whose lease expired and was claimed again
+	ErrDashboardSyncOutboxLeaseLost = errors.New("The lease of the dashboard sync outbox item was lost")
+)
+
+type DashboardSyncOutboxStatus string
+
+const (
+	DashboardSyncOutboxPending  DashboardSyncOutboxStatus = "pending"
+	DashboardSyncOutboxInflight DashboardSyncOutboxStatus = "inflight"
+	DashboardSyncOutboxDone     DashboardSyncOutboxStatus = "done"
+	DashboardSyncOutboxFailed   DashboardSyncOutboxStatus = "failed"
+)
+
+// DashboardSyncOutboxItem is a dashboard commit waiting to be made, stored with the save of the dashboard so it
+// survives restarts. The commit is made with the token the user logged in with.
+type DashboardSyncOutboxItem struct {
+	Id          int64
+	OrgId       int64
+	DashboardId int64
+	// Action is the social.DashboardAction of the commit
+	Action string
+	// Dashboard is the json of the dashboard committed, FolderId its folder
+	Dashboard string
+	FolderId  int64
+	// Repo is the repository the dashboard selects, empty for the repository of the organization
+	Repo    string
+	Message string
+	Source  string
+
+	UserId     int64
+	AuthModule string
+	// Branch and RepoId are the git override of the save
+	Branch string
+	RepoId int
+	// Coauthors is the json of the co-authors credited in the commit
+	Coauthors string
+	RequestId string
+
+	Status   DashboardSyncOutboxStatus
+	Attempts int
+	// NextRetry is when a pending item can be claimed
+	NextRetry time.Time
+	// LeaseOwner is the instance making the commit of an inflight item, other instances claim the item again
+	// once LeaseUntil is past
+	LeaseOwner string
+	LeaseUntil time.Time
+	// Version changes with each claim, so only the owner of the current lease completes the item
+	Version int64
+	Error   string
+	Created time.Time
+	Updated time.Time
+}
+
+func (item DashboardSyncOutboxItem) TableName() string {
+	return "dashboard_sync_outbox"
+}
+
+//
+// COMMANDS
+//
+
+// InsertDashboardSyncOutboxCommand queues commits of the stored dashboard without saving it, saves queue their
+// commits with SaveDashboardCommand.SyncOutbox. Items without a dashboard commit the stored dashboard.
+type InsertDashboardSyncOutboxCommand struct {
+	Dashboard *Dashboard
+	Items     []*DashboardSyncOutboxItem
+}
+
+// ClaimDashboardSyncOutboxItemCommand claims the oldest item that is pending and due, or inflight with an expired
+// lease, unless an older item of the same dashboard is not made yet. The claimed item is inflight for Owner until
+// LeaseUntil, Result is nil when no item can be claimed. Items claimed by other instances meanwhile are skipped.
+type ClaimDashboardSyncOutboxItemCommand struct {
+	Owner      string
+	Now        time.Time
+	LeaseUntil time.Time
+	// IgnoreRetry also claims the pending items whose retry time is not reached
+	IgnoreRetry bool
+
+	Result *DashboardSyncOutboxItem
+}
+
+// CompleteDashboardSyncOutboxItemCommand stores the outcome of the commit of a claimed item: done, failed, or
+// pending to be retried at NextRetry. It fails with ErrDashboardSyncOutboxLeaseLost when the item was claimed
+// again since Version.
+type CompleteDashboardSyncOutboxItemCommand struct {
+	Id        int64
+	Version   int64
+	Status    DashboardSyncOutboxStatus
+	Error     string
+	NextRetry time.Time
+}
+
+// RequeueDashboardSyncOutboxCommand makes failed items, and inflight items whose lease expired, pending again with
+// no attempts, the items of Ids, or all the failed items when Ids is empty
+type RequeueDashboardSyncOutboxCommand struct {
+	Ids []int64
+	Now time.Time
+
+	RequeuedRows int64
+}
+
+// PurgeDashboardSyncOutboxCommand deletes the items of Ids that are not done, or all the failed items when Ids is
+// empty
+type PurgeDashboardSyncOutboxCommand struct {
+	Ids []int64
+
+	DeletedRows int64
+}
+
+// PruneDashboardSyncOutboxCommand deletes the done items last updated before the time
+type PruneDashboardSyncOutboxCommand struct {
+	DoneBefore time.Time
+
+	DeletedRows int64
+}
+
+//
+// QUERIES
+//
+
+// GetDashboardSyncOutboxQuery returns the items with any of the statuses, oldest first, of the organization or of
+// all organizations when OrgId is 0
+type GetDashboardSyncOutboxQuery struct {
+	OrgId    int64
+	Statuses []DashboardSyncOutboxStatus
+
+	Result []*DashboardSyncOutboxItem
+}
+
+// GetDashboardSyncOutboxCountsQuery returns the number of items by status, of the organization or of all
+// organizations when OrgId is 0
+type GetDashboardSyncOutboxCountsQuery struct {
+	OrgId int64
+
+	Result map[DashboardSyncOutboxStatus]int
+}
@@ -26,6 +26,11 @@ type DashboardVersion struct {
 
 	Message string           `json:"message"`
 	Data    *simplejson.Json `json:"data"`
+
+	// where the version was saved from, only kept for audits
+	ClientIp  string `json:"-"`
+	UserAgent string `json:"-"`
+	RequestId string `json:"-"`
 }
 
 // DashboardVersionMeta extends the dashboard version model with the names
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// DashboardView is when a dashboard was last viewed, in unix seconds. It is updated at most once an hour per
+// dashboard.
+type DashboardView struct {
+	Id           int64
+	OrgId        int64
+	DashboardId  int64
+	LastViewedAt int64
+}
+
+// StaleDashboard is a dashboard not viewed since LastViewed, the creation of the dashboard when it was never
+// viewed
+type StaleDashboard struct {
+	Id          int64     `json:"id"`
+	Uid         string    `json:"uid"`
+	Title       string    `json:"title"`
+	Slug        string    `json:"slug"`
+	FolderId    int64     `json:"folderId"`
+	FolderTitle string    `json:"folderTitle"`
+	Version     int       `json:"version"`
+	LastViewed  time.Time `json:"lastViewed"`
+}
+
+//
+// COMMANDS
+//
+
+type RecordDashboardViewCommand struct {
+	OrgId       int64
+	DashboardId int64
+	ViewedAt    time.Time
+}
+
+//
+// QUERIES
+//
+
+// GetStaleDashboardsQuery returns the dashboards last viewed before ViewedBefore, except the ones tagged with
+// one of ExcludeTags, the ones in the folder ExcludeFolderId and the templates of folders
+type GetStaleDashboardsQuery struct {
+	OrgId           int64
+	ViewedBefore    time.Time
+	ExcludeTags     []string
+	ExcludeFolderId int64
+
+	Result []*StaleDashboard
+}
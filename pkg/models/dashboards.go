@@ -15,13 +15,23 @@ import (
 var (
 	ErrDashboardGitlabSync                       = errors.New("Commit to the repository failed")
 	ErrDashboardGitlabToken                      = errors.New("You have to be authenticated via GitLab")
+	ErrDashboardGitConflict                      = errors.New("The dashboard file was changed in the repository since it was last synced, pull the repository change first")
+	ErrDashboardGitRepoNotFound                  = errors.New("The git repository of the dashboard is not configured")
+	ErrDashboardGitBranchNotAllowed              = errors.New("The branch is not allowed as a branch override of the repository")
+	ErrDashboardGitOverrideAccessDenied          = errors.New("Only editors can override the branch of the dashboard sync")
+	ErrDashboardSyncUidMissing                   = errors.New("Dashboards committed to git must have a uid")
+	ErrDashboardSyncUidChanged                   = errors.New("The uid of the dashboard was changed by the sync transformers")
 	ErrDashboardNotFound                         = errors.New("Dashboard not found")
 	ErrDashboardFolderNotFound                   = errors.New("Folder not found")
 	ErrDashboardSnapshotNotFound                 = errors.New("Dashboard snapshot not found")
 	ErrDashboardWithSameUIDExists                = errors.New("A dashboard with the same uid already exists")
+	ErrDashboardUidUsedByFolder                  = errors.New("A folder with the same uid already exists, folders and dashboards cannot share a uid")
+	ErrDashboardUidChanged                       = errors.New("The uid of an existing dashboard cannot be changed without allowUidChange")
+	ErrDashboardProtected                        = errors.New("Dashboard is protected by protected_uids, it cannot be deleted or have its uid changed")
 	ErrDashboardWithSameNameInFolderExists       = errors.New("A dashboard with the same name in the folder already exists")
 	ErrDashboardVersionMismatch                  = errors.New("The dashboard has been changed by someone else")
 	ErrDashboardTitleEmpty                       = errors.New("Dashboard title cannot be empty")
+	ErrDashboardTitleWhitespace                  = errors.New("Dashboard title cannot be only whitespace, leading and trailing whitespace is removed from titles")
 	ErrDashboardFolderCannotHaveParent           = errors.New("A Dashboard Folder cannot be added to another folder")
 	ErrDashboardsWithSameSlugExists              = errors.New("Multiple dashboards with the same slug exists")
 	ErrDashboardFailedGenerateUniqueUid          = errors.New("Failed to generate unique dashboard id")
@@ -30,10 +40,21 @@ var (
 	ErrDashboardWithSameNameAsFolder             = errors.New("Dashboard name cannot be the same as folder")
 	ErrDashboardFolderNameExists                 = errors.New("A folder with that name already exists")
 	ErrDashboardUpdateAccessDenied               = errors.New("Access denied to save dashboard")
+	ErrDashboardViewAccessDenied                 = errors.New("Access denied to view dashboard")
 	ErrDashboardInvalidUid                       = errors.New("uid contains illegal characters")
 	ErrDashboardUidToLong                        = errors.New("uid to long. max 40 characters")
+	ErrDashboardUidReserved                      = errors.New("uid prefix is reserved for provisioned dashboards")
+	ErrDashboardUidNotReserved                   = errors.New("provisioned dashboards must use a reserved uid prefix")
 	ErrDashboardCannotSaveProvisionedDashboard   = errors.New("Cannot save provisioned dashboard")
 	ErrDashboardCannotDeleteProvisionedDashboard = errors.New("provisioned dashboard cannot be deleted")
+	ErrDashboardDeleteConfirmationRequired       = errors.New("Deleting dashboards requires a confirmation token")
+	ErrDashboardDeleteTokenInvalid               = errors.New("The delete confirmation token is invalid")
+	ErrDashboardDeleteTokenExpired               = errors.New("The delete confirmation token has expired")
+	ErrDashboardArchiveTokenInvalid              = errors.New("The archive link is invalid")
+	ErrDashboardArchiveTokenExpired              = errors.New("The archive link has expired")
+	ErrDashboardCannotArchiveFolder              = errors.New("Folders cannot be archived")
+	ErrTooManySaveRequests                       = errors.New("Too many dashboard saves, try again later")
+	ErrDashboardsReadOnly                        = errors.New("Dashboards are read-only for maintenance")
 	RootFolderName                               = "General"
 )
 
@@ -45,6 +66,211 @@ func (d UpdatePluginDashboardError) Error() string {
 	return "Dashboard belong to plugin"
 }
 
+// DashboardTimeSettingsError is returned when the refresh interval or time range of a dashboard is rejected
+type DashboardTimeSettingsError struct {
+	Reason string
+}
+
+func (e DashboardTimeSettingsError) Error() string {
+	return "Invalid dashboard time settings: " + e.Reason
+}
+
+// DashboardNestingDepthError is returned when objects and arrays in the dashboard json are nested too deeply
+type DashboardNestingDepthError struct {
+	MaxDepth int
+}
+
+func (e DashboardNestingDepthError) Error() string {
+	return fmt.Sprintf("Dashboard json is nested deeper than the maximum of %d levels", e.MaxDepth)
+}
+
+// DashboardLimitViolation is a limit on the size of dashboards that a save exceeds
+type DashboardLimitViolation struct {
+	Name    string `json:"name"`
+	Found   int    `json:"found"`
+	Allowed int    `json:"allowed"`
+}
+
+// DashboardLimitsError is returned when a save makes a dashboard exceed the configured panel limits
+type DashboardLimitsError struct {
+	Violations []DashboardLimitViolation
+}
+
+func (e DashboardLimitsError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = fmt.Sprintf("%d %s (maximum %d)", v.Found, v.Name, v.Allowed)
+	}
+
+	return "Dashboard exceeds the limits: " + strings.Join(parts, ", ")
+}
+
+// DashboardLargeValueError is returned when a value in the dashboard json, usually an embedded image, is too large
+type DashboardLargeValueError struct {
+	Path string
+	Size int
+}
+
+func (e DashboardLargeValueError) Error() string {
+	return fmt.Sprintf("Dashboard value at %s is too large (%d bytes)", e.Path, e.Size)
+}
+
+// DashboardInvalidTemplatingError is returned when the template variables of a dashboard are invalid
+type DashboardInvalidTemplatingError struct {
+	Issues []string
+}
+
+func (e DashboardInvalidTemplatingError) Error() string {
+	return "Invalid dashboard template variables: " + strings.Join(e.Issues, ", ")
+}
+
+// DashboardValidationError is returned when a validator registered by an extension rejects a dashboard
+type DashboardValidationError struct {
+	Validator string
+	Message   string
+}
+
+func (e DashboardValidationError) Error() string {
+	return fmt.Sprintf("Dashboard rejected by %s: %s", e.Validator, e.Message)
+}
+
+// DashboardTransformError is returned when a transformer configured for the organization fails, which aborts
+// the save or the commit of the dashboard
+type DashboardTransformError struct {
+	Transformer string
+	Message     string
+}
+
+func (e DashboardTransformError) Error() string {
+	return fmt.Sprintf("Dashboard transformer %s failed: %s", e.Transformer, e.Message)
+}
+
+// DashboardAdoptionError is returned when a provisioned dashboard uses the uid of a dashboard that is not
+// provisioned, which the provider is not allowed to take over
+type DashboardAdoptionError struct {
+	DashboardId int64
+	Uid         string
+	Title       string
+}
+
+func (e DashboardAdoptionError) Error() string {
+	return fmt.Sprintf("Dashboard %s with uid %s is not provisioned, the provider is not allowed to adopt it", e.Title, e.Uid)
+}
+
+// DashboardFolderNotFoundError is returned for a dashboard referencing a folder that does not exist, e.g. because
+// it was deleted out from under it. It names the stale folder id and unwraps to ErrDashboardFolderNotFound.
+type DashboardFolderNotFoundError struct {
+	FolderId int64
+}
+
+func (e DashboardFolderNotFoundError) Error() string {
+	return fmt.Sprintf("Folder %d of the dashboard not found, it may have been deleted", e.FolderId)
+}
+
+func (e DashboardFolderNotFoundError) Unwrap() error {
+	return ErrDashboardFolderNotFound
+}
+
+// DashboardSaveRateLimitError is returned for the saves of a user or an organization over its rate of dashboard
+// saves. It names the exceeded limit, user or org, and unwraps to ErrTooManySaveRequests.
+type DashboardSaveRateLimitError struct {
+	Limit string
+	// RetryAfter is how long until the limit allows a save again
+	RetryAfter time.Duration
+}
+
+func (e DashboardSaveRateLimitError) Error() string {
+	return fmt.Sprintf("Too many dashboard saves by the %s, try again in %s", e.Limit, e.RetryAfter)
+}
+
+func (e DashboardSaveRateLimitError) Unwrap() error {
+	return ErrTooManySaveRequests
+}
+
+// DashboardsReadOnlyError is returned for the dashboard writes during the read-only maintenance of dashboards. It has
+// the message of the operator and the estimated end of the maintenance, zero when unknown, and unwraps to
+// ErrDashboardsReadOnly.
+type DashboardsReadOnlyError struct {
+	Message string
+	Until   time.Time
+}
+
+func (e DashboardsReadOnlyError) Error() string {
+	msg := ErrDashboardsReadOnly.Error()
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if !e.Until.IsZero() {
+		msg += fmt.Sprintf(" (until %s)", e.Until.UTC().Format(time.RFC3339))
+	}
+	return msg
+}
+
+func (e DashboardsReadOnlyError) Unwrap() error {
+	return ErrDashboardsReadOnly
+}
+
+// DashboardSaveRule names a rule checked before a dashboard is saved
+type DashboardSaveRule string
+
+const (
+	DashboardSaveRuleFolderMovePermission    DashboardSaveRule = "folder-move-permission"
+	DashboardSaveRuleSavePermission          DashboardSaveRule = "save-permission"
+	DashboardSaveRuleProvisionedConflict     DashboardSaveRule = "provisioned-conflict"
+	DashboardSaveRuleAlertValidation         DashboardSaveRule = "alert-validation"
+	DashboardSaveRuleFolderMoveNotifications DashboardSaveRule = "folder-move-notifications"
+)
+
+// DashboardSaveRuleError is returned when a rule rejects the save of a dashboard. It wraps the error of the rule,
+// e.g. ErrDashboardUpdateAccessDenied, which xerrors.Is and xerrors.As find through it.
+type DashboardSaveRuleError struct {
+	Rule DashboardSaveRule
+	Err  error
+}
+
+func (e DashboardSaveRuleError) Error() string {
+	return e.Err.Error()
+}
+
+func (e DashboardSaveRuleError) Unwrap() error {
+	return e.Err
+}
+
+// DashboardVersionConflictError is returned by saves rejected because the dashboard was changed since the client
+// loaded it. It describes the stored version so clients can offer to merge, and unwraps to
+// ErrDashboardVersionMismatch.
+type DashboardVersionConflictError struct {
+	CurrentVersion int
+	UpdatedBy      int64
+	UpdatedAt      time.Time
+	// Changes summarizes the differences of the submitted dashboard to the stored one, e.g. "panels changed"
+	Changes          []string
+	ChangesTruncated bool
+}
+
+func (e DashboardVersionConflictError) Error() string {
+	return ErrDashboardVersionMismatch.Error()
+}
+
+func (e DashboardVersionConflictError) Unwrap() error {
+	return ErrDashboardVersionMismatch
+}
+
+// DashboardSource describes which entry point last saved a dashboard
+type DashboardSource string
+
+const (
+	DashboardSourceUnknown      DashboardSource = "unknown"
+	DashboardSourceUI           DashboardSource = "ui"
+	DashboardSourceAPI          DashboardSource = "api"
+	DashboardSourceProvisioning DashboardSource = "provisioning"
+	DashboardSourcePlugin       DashboardSource = "plugin"
+	DashboardSourceImport       DashboardSource = "import"
+	DashboardSourceGitImport    DashboardSource = "git-import"
+	DashboardSourceRestore      DashboardSource = "restore"
+	DashboardSourceRepair       DashboardSource = "repair"
+)
+
 var (
 	DashTypeJson     = "file"
 	DashTypeDB       = "db"
@@ -70,6 +296,7 @@ type Dashboard struct {
 	FolderId  int64
 	IsFolder  bool
 	HasAcl    bool
+	Source    DashboardSource
 
 	Title string
 	Data  *simplejson.Json
@@ -173,6 +400,10 @@ func (cmd *SaveDashboardCommand) GetDashboardModel() *Dashboard {
 	dash.PluginId = cmd.PluginId
 	dash.IsFolder = cmd.IsFolder
 	dash.FolderId = cmd.FolderId
+	dash.Source = cmd.Source
+	if dash.Source == "" {
+		dash.Source = DashboardSourceUnknown
+	}
 	dash.UpdateSlug()
 	return dash
 }
@@ -182,6 +413,12 @@ func (dash *Dashboard) GetString(prop string, defaultValue string) string {
 	return dash.Data.Get(prop).MustString(defaultValue)
 }
 
+// GitRepo returns the name or id of the configured repository the dashboard is synced to,
+// or an empty string for the repository of the organization
+func (dash *Dashboard) GitRepo() string {
+	return strings.TrimSpace(dash.GetString("gitRepo", ""))
+}
+
 // UpdateSlug updates the slug
 func (dash *Dashboard) UpdateSlug() {
 	title := dash.Data.Get("title").MustString()
@@ -226,6 +463,21 @@ func GetFolderUrl(folderUid string, slug string) string {
 	return fmt.Sprintf("%s/dashboards/f/%s/%s", setting.AppSubUrl, folderUid, slug)
 }
 
+// IsProtectedDashboardUid returns true if the uid is one of the protected_uids, dashboards that cannot be deleted
+// or have their uid changed by anyone
+func IsProtectedDashboardUid(uid string) bool {
+	if uid == "" {
+		return false
+	}
+
+	for _, protected := range setting.DashboardProtectedUids {
+		if protected == uid {
+			return true
+		}
+	}
+	return false
+}
+
 type ValidateDashboardBeforeSaveResult struct {
 	IsParentFolderChanged bool
 }
@@ -244,12 +496,33 @@ type SaveDashboardCommand struct {
 	PluginId     string           `json:"-"`
 	FolderId     int64            `json:"folderId"`
 	IsFolder     bool             `json:"isFolder"`
+	Source       DashboardSource  `json:"-"`
+	// GitOverride is only used by the dashboard service, it is not stored with the dashboard
+	GitOverride *DashboardGitOverride `json:"gitOverride"`
+	// Coauthors are credited in the commit of the dashboard, they are not stored with the dashboard
+	Coauthors []GitCommitAuthor `json:"coauthors"`
+	// AllowUidChange allows saving an existing dashboard with another uid, breaking the links to the dashboard
+	AllowUidChange bool `json:"allowUidChange"`
+	// SkipFolderTemplate creates a dashboard in the UI without merging the template of its folder into it
+	SkipFolderTemplate bool `json:"skipFolderTemplate"`
+	// RequestMeta describes the HTTP request of the save, it is recorded with the dashboard version
+	RequestMeta *RequestMeta `json:"-"`
+	// SyncOutbox are the queued commits of the save, stored in its transaction
+	SyncOutbox []*DashboardSyncOutboxItem `json:"-"`
 
 	UpdatedAt time.Time
 
 	Result *Dashboard
 }
 
+// RequestMeta identifies where a change was made from, for the audit of dashboard saves
+type RequestMeta struct {
+	ClientIp  string
+	UserAgent string
+	// RequestId is the X-Request-Id header set by the reverse proxy, so changes can be matched with its access logs
+	RequestId string
+}
+
 type DashboardProvisioning struct {
 	Id          int64
 	DashboardId int64
@@ -269,19 +542,56 @@ type SaveProvisionedDashboardCommand struct {
 type DeleteDashboardCommand struct {
 	Id    int64
 	OrgId int64
+	// Version makes the delete fail with ErrDashboardVersionMismatch unless it is the current version
+	Version int
+	// OnlyIfEmpty makes the delete of a folder fail with ErrFolderNotEmpty while it holds dashboards
+	OnlyIfEmpty bool
 }
 
 type ValidateDashboardBeforeSaveCommand struct {
-	OrgId     int64
-	Dashboard *Dashboard
-	Overwrite bool
-	Result    *ValidateDashboardBeforeSaveResult
+	OrgId          int64
+	Dashboard      *Dashboard
+	Overwrite      bool
+	AllowUidChange bool
+	Result         *ValidateDashboardBeforeSaveResult
 }
 
 //
 // QUERIES
 //
 
+// DashboardSaveSnapshot holds what the save of a dashboard is checked against, fetched in one query instead of
+// one query per check. The dashboards only have the ids, uid, title and kind the checks use.
+type DashboardSaveSnapshot struct {
+	// ExistingByUid is the dashboard or folder using the uid of the saved dashboard, nil when the uid is free
+	ExistingByUid *Dashboard
+	// ExistingByUidProvisioned tells that ExistingByUid is provisioned
+	ExistingByUidProvisioned bool
+	// Provisioning is nil when the saved dashboard is not provisioned
+	Provisioning *DashboardProvisioning
+	// Folder is the folder the dashboard is saved to, nil for the General folder
+	Folder *Dashboard
+	// Acl is the acl the permission to save is checked against, the acl of the dashboard or of the folder of a new
+	// dashboard. FolderAcl is the acl of the folder the dashboard is saved to, nil when the dashboard stays in its
+	// folder. Both are nil for org admins, who are not checked against acls.
+	Acl       []*DashboardAclInfoDTO
+	FolderAcl []*DashboardAclInfoDTO
+	// Teams are the teams of the user, nil unless the acls grant permissions to teams
+	Teams []*TeamDTO
+}
+
+// GetDashboardSaveSnapshotQuery fetches the snapshot of the save of dashboard DashboardId, or of a new dashboard
+// when 0, to FolderId by User
+type GetDashboardSaveSnapshotQuery struct {
+	OrgId       int64
+	DashboardId int64
+	Uid         string
+	FolderId    int64
+	User        *SignedInUser
+
+	Result *DashboardSaveSnapshot
+}
+
 type GetDashboardQuery struct {
 	Slug  string // required if no Id or Uid is specified
 	Id    int64  // optional if slug is set
@@ -330,6 +640,13 @@ type GetProvisionedDashboardDataByIdQuery struct {
 	Result      *DashboardProvisioning
 }
 
+// GetProvisionedDashboardDataByIdsQuery returns the provisioning data of the provisioned dashboards among the ids,
+// keyed by dashboard id. Dashboards that are not provisioned have no entry.
+type GetProvisionedDashboardDataByIdsQuery struct {
+	DashboardIds []int64
+	Result       map[int64]*DashboardProvisioning
+}
+
 type GetProvisionedDashboardDataQuery struct {
 	Name   string
 	Result []*DashboardProvisioning
@@ -342,6 +659,20 @@ type GetDashboardsBySlugQuery struct {
 	Result []*Dashboard
 }
 
+// GetDashboardsByOrgQuery returns all the dashboards and folders of the organization, folders first
+type GetDashboardsByOrgQuery struct {
+	OrgId int64
+
+	Result []*Dashboard
+}
+
+// GetOrphanedDashboardsQuery returns the dashboards of the organization whose folder does not exist
+type GetOrphanedDashboardsQuery struct {
+	OrgId int64
+
+	Result []*Dashboard
+}
+
 type DashboardPermissionForUser struct {
 	DashboardId    int64          `json:"dashboardId"`
 	Permission     PermissionType `json:"permission"`
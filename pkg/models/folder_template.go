@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrFolderTemplateIsFolder = errors.New("A folder cannot be the template of a folder")
+
+// FolderTemplate designates the dashboard whose panels, variables and tags new dashboards of the folder start from
+type FolderTemplate struct {
+	Id          int64
+	OrgId       int64
+	FolderId    int64
+	DashboardId int64
+	UpdatedBy   int64
+	Updated     time.Time
+}
+
+//
+// COMMANDS
+//
+
+// SetFolderTemplateCommand designates the template dashboard of the folder, a DashboardId of 0 removes the
+// template of the folder
+type SetFolderTemplateCommand struct {
+	OrgId       int64
+	FolderId    int64
+	DashboardId int64
+	UpdatedBy   int64
+}
+
+//
+// QUERIES
+//
+
+// GetFolderTemplateQuery returns the template of the folder, nil when the folder has none
+type GetFolderTemplateQuery struct {
+	OrgId    int64
+	FolderId int64
+
+	Result *FolderTemplate
+}
@@ -11,10 +11,13 @@ var (
 	ErrFolderNotFound                = errors.New("Folder not found")
 	ErrFolderVersionMismatch         = errors.New("The folder has been changed by someone else")
 	ErrFolderTitleEmpty              = errors.New("Folder title cannot be empty")
+	ErrFolderTitleWhitespace         = errors.New("Folder title cannot be only whitespace, leading and trailing whitespace is removed from titles")
 	ErrFolderWithSameUIDExists       = errors.New("A folder/dashboard with the same uid already exists")
+	ErrFolderUidUsedByDashboard      = errors.New("A dashboard with the same uid already exists, folders and dashboards cannot share a uid")
 	ErrFolderSameNameExists          = errors.New("A folder or dashboard in the general folder with the same name already exists")
 	ErrFolderFailedGenerateUniqueUid = errors.New("Failed to generate unique folder id")
 	ErrFolderAccessDenied            = errors.New("Access denied to folder")
+	ErrFolderNotEmpty                = errors.New("Folder is not empty")
 )
 
 type Folder struct {
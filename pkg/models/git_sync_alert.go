@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// GitSyncAlertState tracks the failing dashboard commits to a repository and when the admins of the
+// organization were last told about them. It is stored so a restart does not notify the admins again.
+type GitSyncAlertState struct {
+	Id           int64
+	OrgId        int64
+	Repo         string
+	Failures     int64
+	DashboardIds []int64
+	LastError    string
+	FirstFailure time.Time
+	LastNotified time.Time
+	Escalated    bool
+	Updated      time.Time
+}
+
+//
+// COMMANDS
+//
+
+type SaveGitSyncAlertStateCommand struct {
+	State *GitSyncAlertState
+}
+
+type DeleteGitSyncAlertStateCommand struct {
+	OrgId int64
+	Repo  string
+}
+
+//
+// QUERIES
+//
+
+// GetGitSyncAlertStateQuery returns the state of the repository, or a nil result when its commits are not failing
+type GetGitSyncAlertStateQuery struct {
+	OrgId int64
+	Repo  string
+
+	Result *GitSyncAlertState
+}
@@ -0,0 +1,10 @@
+package models
+
+// GetLibraryPanelsQuery returns the uids of the library panels of the organization among Uids. It is handled by
+// the service storing the library panels.
+type GetLibraryPanelsQuery struct {
+	OrgId int64
+	Uids  []string
+
+	Result []string
+}
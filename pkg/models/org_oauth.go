@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/securejsondata"
+)
+
+var (
+	ErrOrgOAuthConfigNotFound = errors.New("OAuth config for organization not found")
+)
+
+// OrgOAuthConfig overrides the client credentials of an OAuth provider for one organization,
+// so each organization can register its own app with the identity provider.
+type OrgOAuthConfig struct {
+	Id             int64
+	OrgId          int64
+	Provider       string
+	ClientId       string
+	AuthUrl        string
+	TokenUrl       string
+	ApiUrl         string
+	SecureJsonData securejsondata.SecureJsonData
+
+	Created time.Time
+	Updated time.Time
+}
+
+func (c OrgOAuthConfig) TableName() string {
+	return "org_oauth_config"
+}
+
+// DecryptedClientSecret returns the client secret in plain text
+func (c *OrgOAuthConfig) DecryptedClientSecret() string {
+	secret, _ := c.SecureJsonData.DecryptedValue("clientSecret")
+	return secret
+}
+
+// ---------------------
+// DTOS
+
+type OrgOAuthConfigDTO struct {
+	OrgId    int64     `json:"orgId"`
+	Provider string    `json:"provider"`
+	ClientId string    `json:"clientId"`
+	AuthUrl  string    `json:"authUrl"`
+	TokenUrl string    `json:"tokenUrl"`
+	ApiUrl   string    `json:"apiUrl"`
+	Updated  time.Time `json:"updated"`
+}
+
+// ---------------------
+// COMMANDS
+
+type SaveOrgOAuthConfigCommand struct {
+	ClientId     string `json:"clientId" binding:"Required"`
+	ClientSecret string `json:"clientSecret" binding:"Required"`
+	AuthUrl      string `json:"authUrl"`
+	TokenUrl     string `json:"tokenUrl"`
+	ApiUrl       string `json:"apiUrl"`
+
+	OrgId    int64  `json:"-"`
+	Provider string `json:"-"`
+
+	Result *OrgOAuthConfig `json:"-"`
+}
+
+type DeleteOrgOAuthConfigCommand struct {
+	OrgId    int64
+	Provider string
+}
+
+// ---------------------
+// QUERIES
+
+type GetOrgOAuthConfigQuery struct {
+	OrgId    int64
+	Provider string
+
+	Result *OrgOAuthConfig
+}
+
+type GetOrgOAuthConfigsQuery struct {
+	OrgId int64
+
+	Result []*OrgOAuthConfig
+}
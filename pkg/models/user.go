@@ -184,6 +184,8 @@ type SignedInUser struct {
 	Teams          []int64
 	Token          string
 	AuthModule     string
+	// ExternalIdentity is the identity at the provider of AuthModule of users signed in with a git provider
+	ExternalIdentity *ExternalIdentity
 }
 
 func (u *SignedInUser) ShouldUpdateLastSeenAt() bool {
@@ -20,6 +20,24 @@ type UserAuth struct {
 	OAuthRefreshToken string
 	OAuthTokenType    string
 	OAuthExpiry       time.Time
+	// ExternalLogin, ExternalEmail and ExternalGroups are the identity of the user at the provider, recorded at
+	// LastSyncedAt when the user last logged in with it. ExternalGroups is a json array.
+	ExternalLogin  string
+	ExternalEmail  string
+	ExternalGroups string
+	LastSyncedAt   time.Time
+}
+
+// ExternalIdentity is the identity of a user at an auth provider, e.g. to commit on behalf of the user or to map
+// the author of a webhook to the user. Provider is the auth module of the provider, e.g. oauth_gitlab or ldap.
+// Users linked to several providers have an identity at each.
+type ExternalIdentity struct {
+	Provider     string    `json:"provider"`
+	ExternalId   string    `json:"externalId"`
+	Login        string    `json:"login"`
+	Email        string    `json:"email"`
+	Groups       []string  `json:"groups"`
+	LastSyncedAt time.Time `json:"lastSyncedAt"`
 }
 
 type ExternalUserInfo struct {
@@ -52,6 +70,8 @@ type SetAuthInfoCommand struct {
 	AuthId     string
 	UserId     int64
 	OAuthToken *oauth2.Token
+	// Identity records the login, email and groups of the user at the provider, it is optional
+	Identity *ExternalUserInfo
 }
 
 type UpdateAuthInfoCommand struct {
@@ -59,6 +79,8 @@ type UpdateAuthInfoCommand struct {
 	AuthId     string
 	UserId     int64
 	OAuthToken *oauth2.Token
+	// Identity records the login, email and groups of the user at the provider, it is optional
+	Identity *ExternalUserInfo
 }
 
 type DeleteAuthInfoCommand struct {
@@ -100,6 +122,15 @@ type GetAuthInfoQuery struct {
 	Result *UserAuth
 }
 
+// GetExternalIdentityQuery returns the identity of the user at the provider, an auth module, or
+// ErrUserNotFound when the user never logged in with it
+type GetExternalIdentityQuery struct {
+	UserId   int64
+	Provider string
+
+	Result *ExternalIdentity
+}
+
 type TeamOrgGroupDTO struct {
 	TeamName string `json:"teamName"`
 	OrgName  string `json:"orgName"`
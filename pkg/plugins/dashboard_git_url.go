@@ -0,0 +1,299 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var (
+	ErrGitUrlImportDisabled  = errors.New("Importing dashboards by url is disabled, set git_url_import_allowed_hosts to enable it")
+	ErrGitUrlInvalid         = errors.New("Dashboard url must be an https url")
+	ErrGitUrlHostNotAllowed  = errors.New("Dashboard url host is not allowed, see git_url_import_allowed_hosts")
+	ErrGitUrlHostForbidden   = errors.New("Dashboard url host resolves to a link-local or metadata address")
+	ErrGitUrlDashboardTooBig = errors.New("Dashboard at url is too big")
+)
+
+// GitUrlFetchError is returned when the dashboard could not be fetched from the url
+type GitUrlFetchError struct {
+	Url    string
+	Status int
+	Err    error
+}
+
+func (e GitUrlFetchError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Failed to fetch dashboard from %s: %v", e.Url, e.Err)
+	}
+	return fmt.Sprintf("Failed to fetch dashboard from %s: status %d", e.Url, e.Status)
+}
+
+// GitUrlDashboardInvalidError is returned when the content at the url is not a dashboard json
+type GitUrlDashboardInvalidError struct {
+	Url string
+	Err error
+}
+
+func (e GitUrlDashboardInvalidError) Error() string {
+	return fmt.Sprintf("Content at %s is not a dashboard json: %v", e.Url, e.Err)
+}
+
+const (
+	gitUrlMaxDashboardBytes = 10 << 20
+	gitUrlFetchTimeout      = 30 * time.Second
+)
+
+// gitUrlTransport sends the requests fetching dashboards, tests replace it to trust their server
+var gitUrlTransport http.RoundTripper = http.DefaultTransport
+
+// getSyncRepo and getGitProvider return the repository of the organization and its provider, tests replace them
+var (
+	getSyncRepo    = social.GetSyncRepo
+	getGitProvider = social.GetGitProvider
+)
+
+// ImportFromGitURLOptions are the options of importing a dashboard from a url
+type ImportFromGitURLOptions struct {
+	// Token is sent as bearer token to fetch dashboards from private repositories
+	Token     string
+	Inputs    []ImportDashboardInput
+	Overwrite bool
+	FolderId  int64
+
+	TemplatizeMissingDatasources bool
+}
+
+// ImportDashboardFromURL imports the dashboard json at the url into the folder, see ImportDashboardFromGitURL
+func ImportDashboardFromURL(orgId int64, rawUrl string, folderId int64, user *m.SignedInUser, inputs []ImportDashboardInput) (*m.Dashboard, error) {
+	return ImportDashboardFromGitURL(rawUrl, orgId, user, ImportFromGitURLOptions{FolderId: folderId, Inputs: inputs})
+}
+
+// ImportDashboardFromGitURL fetches the dashboard json at the url and imports it like an uploaded dashboard,
+// resolving its inputs. Links to a file of the repository the organization syncs dashboards to are read through
+// the API of the repository with its access token. Other GitHub and GitLab links to a file are fetched from the
+// raw file. Only https urls on the hosts of git_url_import_allowed_hosts are fetched, redirects included, and
+// their hosts must not resolve to link-local or metadata addresses, so the import cannot be used to reach other
+// hosts from Grafana. The url is recorded in the message of the dashboard version.
+func ImportDashboardFromGitURL(rawUrl string, orgId int64, user *m.SignedInUser, opts ImportFromGitURLOptions) (*m.Dashboard, error) {
+	content, sourceUrl, err := readRepoUrl(orgId, rawUrl)
+	if err == nil && content == nil {
+		content, sourceUrl, err = fetchAllowedUrl(rawUrl, opts.Token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := simplejson.NewJson(content)
+	if err == nil {
+		_, err = data.Map()
+	}
+	if err != nil {
+		return nil, GitUrlDashboardInvalidError{Url: sourceUrl, Err: err}
+	}
+
+	return importDashboard(&ImportDashboardCommand{
+		Dashboard: data,
+		Inputs:    opts.Inputs,
+		Overwrite: opts.Overwrite,
+		FolderId:  opts.FolderId,
+		Message:   "Imported from " + sourceUrl,
+		OrgId:     orgId,
+		User:      user,
+
+		TemplatizeMissingDatasources: opts.TemplatizeMissingDatasources,
+	})
+}
+
+// readRepoUrl reads the file a link to a file of the repository of the organization points to, at the ref of the
+// link. It returns no content for other links, and for repositories without an access token. GitLab links have
+// the ref and path after /-/blob/ or /-/raw/, GitHub links after /blob/ or /raw/. Refs with a / are not recognized.
+func readRepoUrl(orgId int64, rawUrl string) ([]byte, string, error) {
+	repo := getSyncRepo(orgId)
+	if repo == nil || repo.WebUrl == "" {
+		return nil, "", nil
+	}
+
+	reader, ok := getGitProvider(orgId).(social.RevisionReader)
+	if !ok {
+		return nil, "", nil
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil {
+		return nil, "", nil
+	}
+	repoUrl, err := url.Parse(repo.WebUrl)
+	if err != nil || !strings.EqualFold(parsed.Scheme, repoUrl.Scheme) || !strings.EqualFold(parsed.Host, repoUrl.Host) {
+		return nil, "", nil
+	}
+
+	repoPath := strings.TrimSuffix(repoUrl.Path, "/")
+	if !strings.HasPrefix(parsed.Path, repoPath+"/") {
+		return nil, "", nil
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(parsed.Path, repoPath), "/-")
+
+	parts := strings.SplitN(strings.TrimPrefix(rest, "/"), "/", 3)
+	if len(parts) != 3 || (parts[0] != "blob" && parts[0] != "raw") || parts[1] == "" || parts[2] == "" {
+		return nil, "", nil
+	}
+	ref, filePath := parts[1], parts[2]
+
+	blob := "/blob/"
+	if repo.Provider == "gitlab" {
+		blob = "/-/blob/"
+	}
+	sourceUrl := strings.TrimSuffix(repo.WebUrl, "/") + blob + ref + "/" + filePath
+	content, err := reader.ReadFileAtRef(orgId, filePath, ref)
+	if err != nil {
+		if err == social.ErrGitRefNotFound || err == social.ErrGitFileNotFound {
+			return nil, "", GitUrlFetchError{Url: sourceUrl, Status: http.StatusNotFound}
+		}
+		return nil, "", GitUrlFetchError{Url: sourceUrl, Err: err}
+	}
+	if len(content) > gitUrlMaxDashboardBytes {
+		return nil, "", ErrGitUrlDashboardTooBig
+	}
+
+	return []byte(content), sourceUrl, nil
+}
+
+// fetchAllowedUrl fetches the file at a url on the allowed hosts, returning its url without the query, which may
+// hold a token, e.g. the links to raw files of private GitHub repositories
+func fetchAllowedUrl(rawUrl string, token string) ([]byte, string, error) {
+	dashboardUrl, err := gitRawUrl(rawUrl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err := fetchGitUrl(dashboardUrl, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sourceUrl := *dashboardUrl
+	sourceUrl.RawQuery = ""
+	sourceUrl.Fragment = ""
+	return content, sourceUrl.String(), nil
+}
+
+// gitRawUrl checks the url and turns links to a file on GitHub or GitLab into links to the raw file
+func gitRawUrl(rawUrl string) (*url.URL, error) {
+	if len(setting.DashboardGitUrlImportAllowedHosts) == 0 {
+		return nil, ErrGitUrlImportDisabled
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" || parsed.User != nil {
+		return nil, ErrGitUrlInvalid
+	}
+
+	switch {
+	case strings.EqualFold(parsed.Hostname(), "github.com"):
+		// /owner/repo/blob/ref/path is served from raw.githubusercontent.com/owner/repo/ref/path
+		parts := strings.SplitN(strings.TrimPrefix(parsed.Path, "/"), "/", 4)
+		if len(parts) == 4 && parts[2] == "blob" {
+			parsed.Host = "raw.githubusercontent.com"
+			parsed.Path = "/" + parts[0] + "/" + parts[1] + "/" + parts[3]
+			parsed.RawPath = ""
+		}
+	case strings.Contains(parsed.Path, "/-/blob/"):
+		parsed.Path = strings.Replace(parsed.Path, "/-/blob/", "/-/raw/", 1)
+		parsed.RawPath = ""
+	}
+
+	if !gitUrlHostAllowed(parsed) {
+		return nil, ErrGitUrlHostNotAllowed
+	}
+
+	return parsed, nil
+}
+
+// checkGitUrlHost checks that the host of the url is allowed and does not resolve to link-local or metadata
+// addresses
+func checkGitUrlHost(u *url.URL) error {
+	if !gitUrlHostAllowed(u) {
+		return ErrGitUrlHostNotAllowed
+	}
+
+	if err := social.ValidateRepoTarget(social.RepoTarget{Url: u.String()}); err != nil {
+		if err == social.ErrRepoHostForbidden {
+			return ErrGitUrlHostForbidden
+		}
+		return GitUrlFetchError{Url: u.String(), Err: err}
+	}
+
+	return nil
+}
+
+func gitUrlHostAllowed(u *url.URL) bool {
+	for _, host := range setting.DashboardGitUrlImportAllowedHosts {
+		if strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchGitUrl(dashboardUrl *url.URL, token string) ([]byte, error) {
+	client := &http.Client{
+		Transport: gitUrlTransport,
+		Timeout:   gitUrlFetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if req.URL.Scheme != "https" {
+				return ErrGitUrlHostNotAllowed
+			}
+			return checkGitUrlHost(req.URL)
+		},
+	}
+
+	if err := checkGitUrlHost(dashboardUrl); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", dashboardUrl.String(), nil)
+	if err != nil {
+		return nil, ErrGitUrlInvalid
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			if _, ok := urlErr.Err.(GitUrlFetchError); ok || urlErr.Err == ErrGitUrlHostNotAllowed || urlErr.Err == ErrGitUrlHostForbidden {
+				return nil, urlErr.Err
+			}
+		}
+		return nil, GitUrlFetchError{Url: dashboardUrl.String(), Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, GitUrlFetchError{Url: dashboardUrl.String(), Status: resp.StatusCode}
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, gitUrlMaxDashboardBytes+1))
+	if err != nil {
+		return nil, GitUrlFetchError{Url: dashboardUrl.String(), Err: err}
+	}
+	if len(content) > gitUrlMaxDashboardBytes {
+		return nil, ErrGitUrlDashboardTooBig
+	}
+
+	return content, nil
+}
@@ -17,6 +17,11 @@ type ImportDashboardCommand struct {
 	Inputs    []ImportDashboardInput
 	Overwrite bool
 	FolderId  int64
+	// TemplatizeMissingDatasources turns data sources missing from the organization into datasource inputs, and
+	// fails with a DashboardInputsRequiredError listing the inputs without a value
+	TemplatizeMissingDatasources bool
+	// Message is the message of the dashboard version, e.g. where the dashboard was imported from
+	Message string
 
 	OrgId    int64
 	User     *m.SignedInUser
@@ -44,17 +49,38 @@ func init() {
 }
 
 func ImportDashboard(cmd *ImportDashboardCommand) error {
+	_, err := importDashboard(cmd)
+	return err
+}
+
+// importDashboard imports the dashboard of the command, returning the saved dashboard
+func importDashboard(cmd *ImportDashboardCommand) (*m.Dashboard, error) {
 	var dashboard *m.Dashboard
 	var err error
 
 	if cmd.PluginId != "" {
 		if dashboard, err = loadPluginDashboard(cmd.PluginId, cmd.Path); err != nil {
-			return err
+			return nil, err
 		}
 	} else {
 		dashboard = m.NewDashboardFromJson(cmd.Dashboard)
 	}
 
+	// checked before the template evaluation walks the json
+	if err := dashboards.CheckNestingDepth(dashboard.Data); err != nil {
+		return nil, err
+	}
+
+	if cmd.TemplatizeMissingDatasources {
+		if err := templatizeMissingDatasources(dashboard.Data, cmd.OrgId); err != nil {
+			return nil, err
+		}
+
+		if missing := missingInputs(dashboard.Data, cmd.Inputs); len(missing) > 0 {
+			return nil, DashboardInputsRequiredError{Inputs: missing}
+		}
+	}
+
 	evaluator := &DashTemplateEvaluator{
 		template: dashboard.Data,
 		inputs:   cmd.Inputs,
@@ -62,7 +88,11 @@ func ImportDashboard(cmd *ImportDashboardCommand) error {
 
 	generatedDash, err := evaluator.Eval()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := dashboards.ValidateUID(generatedDash.Get("uid").MustString(), false); err != nil {
+		return nil, err
 	}
 
 	saveCmd := m.SaveDashboardCommand{
@@ -79,12 +109,18 @@ func ImportDashboard(cmd *ImportDashboardCommand) error {
 		Dashboard: saveCmd.GetDashboardModel(),
 		Overwrite: saveCmd.Overwrite,
 		User:      cmd.User,
+		Message:   cmd.Message,
+		Source:    m.DashboardSourceImport,
+	}
+
+	if cmd.PluginId != "" {
+		dto.Source = m.DashboardSourcePlugin
 	}
 
 	savedDash, err := dashboards.NewService().ImportDashboard(dto)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	cmd.Result = &PluginDashboardInfoDTO{
@@ -101,7 +137,7 @@ func ImportDashboard(cmd *ImportDashboardCommand) error {
 		Slug:             savedDash.Slug,
 	}
 
-	return nil
+	return savedDash, nil
 }
 
 type DashTemplateEvaluator struct {
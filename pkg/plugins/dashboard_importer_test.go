@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/dashboards"
@@ -45,6 +46,107 @@ func TestDashboardImport(t *testing.T) {
 			So(panel.Get("datasource").MustString(), ShouldEqual, "graphite")
 		})
 
+		Convey("should record plugin as dashboard source", func() {
+			So(mock.SavedDashboards[0].Source, ShouldEqual, m.DashboardSourcePlugin)
+		})
+
+		Reset(func() {
+			dashboards.NewService = origNewDashboardService
+		})
+	})
+
+	Convey("When importing a dashboard nested too deeply", t, func() {
+		origNewDashboardService := dashboards.NewService
+		mock := &dashboards.FakeDashboardService{}
+		dashboards.MockDashboardService(mock)
+
+		origMaxDepth := setting.DashboardMaxNestingDepth
+		setting.DashboardMaxNestingDepth = 3
+
+		cmd := ImportDashboardCommand{
+			OrgId: 1,
+			User:  &m.SignedInUser{UserId: 1, OrgRole: m.ROLE_ADMIN},
+			Dashboard: simplejson.NewFromAny(map[string]interface{}{
+				"title":  "Deep",
+				"panels": []interface{}{map[string]interface{}{"targets": []interface{}{}}},
+			}),
+		}
+
+		err := ImportDashboard(&cmd)
+
+		Convey("should reject it before saving", func() {
+			So(err, ShouldResemble, m.DashboardNestingDepthError{MaxDepth: 3})
+			So(mock.SavedDashboards, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			dashboards.NewService = origNewDashboardService
+			setting.DashboardMaxNestingDepth = origMaxDepth
+		})
+	})
+
+	Convey("When importing a dashboard using data sources missing from the organization", t, func() {
+		origNewDashboardService := dashboards.NewService
+		mock := &dashboards.FakeDashboardService{}
+		dashboards.MockDashboardService(mock)
+
+		bus.AddHandler("test", func(query *m.GetDataSourcesQuery) error {
+			query.Result = []*m.DataSource{{Name: "graphite", OrgId: 1}}
+			return nil
+		})
+
+		importDashboard := func(inputs ...ImportDashboardInput) (*ImportDashboardCommand, error) {
+			dashboard, err := simplejson.NewJson([]byte(`{
+				"title": "Shared",
+				"panels": [
+					{"datasource": "prometheus-east", "targets": [{"datasource": "graphite"}]},
+					{"datasource": "default"},
+					{"datasource": "$ds"}
+				],
+				"templating": {"list": [{"name": "host", "datasource": "prometheus-east"}]},
+				"annotations": {"list": [{"name": "deploys", "datasource": "Loki (prod)"}]}
+			}`))
+			So(err, ShouldBeNil)
+
+			cmd := &ImportDashboardCommand{
+				OrgId:                        1,
+				User:                         &m.SignedInUser{UserId: 1, OrgRole: m.ROLE_ADMIN},
+				Dashboard:                    dashboard,
+				Inputs:                       inputs,
+				TemplatizeMissingDatasources: true,
+			}
+			return cmd, ImportDashboard(cmd)
+		}
+
+		Convey("should return the inputs to resolve without saving", func() {
+			_, err := importDashboard()
+
+			inputsErr, ok := err.(DashboardInputsRequiredError)
+			So(ok, ShouldBeTrue)
+			So(inputsErr.Inputs, ShouldHaveLength, 2)
+			So(inputsErr.Inputs[0].Name, ShouldEqual, "DS_PROMETHEUS_EAST")
+			So(inputsErr.Inputs[0].Label, ShouldEqual, "prometheus-east")
+			So(inputsErr.Inputs[0].Type, ShouldEqual, "datasource")
+			So(inputsErr.Inputs[1].Name, ShouldEqual, "DS_LOKI_PROD")
+			So(mock.SavedDashboards, ShouldBeEmpty)
+		})
+
+		Convey("should import with the inputs of the missing data sources", func() {
+			_, err := importDashboard(
+				ImportDashboardInput{Name: "DS_PROMETHEUS_EAST", Type: "datasource", Value: "prometheus"},
+				ImportDashboardInput{Name: "DS_LOKI_PROD", Type: "datasource", Value: "loki"},
+			)
+			So(err, ShouldBeNil)
+
+			data := mock.SavedDashboards[0].Dashboard.Data
+			So(data.Get("panels").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "prometheus")
+			So(data.Get("panels").GetIndex(0).Get("targets").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "graphite")
+			So(data.Get("panels").GetIndex(1).Get("datasource").MustString(), ShouldEqual, "default")
+			So(data.Get("panels").GetIndex(2).Get("datasource").MustString(), ShouldEqual, "$ds")
+			So(data.Get("templating").Get("list").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "prometheus")
+			So(data.Get("annotations").Get("list").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "loki")
+		})
+
 		Reset(func() {
 			dashboards.NewService = origNewDashboardService
 		})
@@ -0,0 +1,132 @@
+package plugins
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	m "github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+)
+
+// DashboardInputDefinition is an input declared in the __inputs of a dashboard
+type DashboardInputDefinition struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	PluginId    string `json:"pluginId"`
+}
+
+// DashboardInputsRequiredError is returned by imports with TemplatizeMissingDatasources when inputs of the
+// dashboard, including the ones replacing missing data sources, have no value in the import command
+type DashboardInputsRequiredError struct {
+	Inputs []*DashboardInputDefinition
+}
+
+func (e DashboardInputsRequiredError) Error() string {
+	names := make([]string, len(e.Inputs))
+	for i, input := range e.Inputs {
+		names[i] = input.Name
+	}
+	return fmt.Sprintf("Dashboard inputs missing from import command: %s", strings.Join(names, ", "))
+}
+
+var inputNameInvalidChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// templatizeMissingDatasources replaces the references of the dashboard json to data sources that do not exist
+// in the organization with ${DS_<NAME>} and declares the matching datasource inputs in __inputs, like the
+// dashboards exported for sharing externally. References to variables and to inputs are kept.
+func templatizeMissingDatasources(data *simplejson.Json, orgId int64) error {
+	query := &m.GetDataSourcesQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool, len(query.Result))
+	for _, ds := range query.Result {
+		existing[ds.Name] = true
+	}
+
+	declared := make(map[string]bool)
+	for _, input := range data.Get("__inputs").MustArray() {
+		declared[simplejson.NewFromAny(input).Get("name").MustString()] = true
+	}
+
+	inputs := data.Get("__inputs").MustArray()
+	inputNames := make(map[string]string)
+
+	inputFor := func(name string, pluginId string) string {
+		if inputName, ok := inputNames[name]; ok {
+			return inputName
+		}
+
+		base := "DS_" + strings.Trim(inputNameInvalidChars.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+		inputName := base
+		for i := 2; declared[inputName]; i++ {
+			inputName = fmt.Sprintf("%s_%d", base, i)
+		}
+
+		declared[inputName] = true
+		inputNames[name] = inputName
+		inputs = append(inputs, map[string]interface{}{
+			"name":        inputName,
+			"label":       name,
+			"description": fmt.Sprintf("Replaces data source %s, missing from the organization", name),
+			"type":        "datasource",
+			"pluginId":    pluginId,
+		})
+
+		return inputName
+	}
+
+	dashboards.RangeDatasourceReferences(data, func(item *simplejson.Json) {
+		value := item.Get("datasource")
+
+		if name, err := value.String(); err == nil {
+			if dashboards.IsBuiltinDatasource(name) || strings.HasPrefix(name, "$") || existing[name] {
+				return
+			}
+			item.Set("datasource", "${"+inputFor(name, "")+"}")
+			return
+		}
+
+		// references with a uid are only found by name, this version has no data source uids
+		uid := value.Get("uid").MustString()
+		if uid == "" || strings.HasPrefix(uid, "$") || existing[uid] {
+			return
+		}
+		value.Set("uid", "${"+inputFor(uid, value.Get("type").MustString())+"}")
+	})
+
+	if len(inputNames) > 0 {
+		data.Set("__inputs", inputs)
+	}
+
+	return nil
+}
+
+// missingInputs returns the inputs declared by the dashboard json that have no value in the inputs of the import
+func missingInputs(data *simplejson.Json, values []ImportDashboardInput) []*DashboardInputDefinition {
+	evaluator := &DashTemplateEvaluator{inputs: values}
+	missing := make([]*DashboardInputDefinition, 0)
+
+	for _, item := range data.Get("__inputs").MustArray() {
+		input := simplejson.NewFromAny(item)
+		definition := &DashboardInputDefinition{
+			Name:        input.Get("name").MustString(),
+			Label:       input.Get("label").MustString(),
+			Description: input.Get("description").MustString(),
+			Type:        input.Get("type").MustString(),
+			PluginId:    input.Get("pluginId").MustString(),
+		}
+
+		if evaluator.findInput(definition.Name, definition.Type) == nil {
+			missing = append(missing, definition)
+		}
+	}
+
+	return missing
+}
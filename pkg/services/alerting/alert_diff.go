@@ -0,0 +1,128 @@
+package alerting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+var evaluatorDescriptions = map[string]string{
+	"gt":            "above",
+	"lt":            "below",
+	"within_range":  "within",
+	"outside_range": "outside",
+	"no_value":      "has no value",
+}
+
+// DiffAlerts describes the alerts added, removed or changed between two versions of the dashboard json.
+// Alerts are matched by panel id and found like the extractor does, including panels of collapsed rows.
+// Only the name, conditions, frequency and for of the alerts are compared.
+func DiffAlerts(previous *simplejson.Json, current *simplejson.Json) []string {
+	changes := make([]string, 0)
+
+	previousPanels := make(map[int64]*simplejson.Json)
+	for _, panel := range getAlertPanels(previous) {
+		previousPanels[panel.Get("id").MustInt64()] = panel
+	}
+
+	currentIds := make(map[int64]bool)
+	for _, panel := range getAlertPanels(current) {
+		id := panel.Get("id").MustInt64()
+		currentIds[id] = true
+
+		alert := panel.Get("alert")
+		name := alert.Get("name").MustString()
+		title := panelTitle(panel)
+
+		previousPanel, ok := previousPanels[id]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("Added alert %q on panel %q", name, title))
+			continue
+		}
+
+		previousAlert := previousPanel.Get("alert")
+		if previousName := previousAlert.Get("name").MustString(); previousName != name {
+			changes = append(changes, fmt.Sprintf("Renamed alert %q to %q on panel %q", previousName, name, title))
+		}
+
+		if before, after := describeConditions(previousAlert), describeConditions(alert); before != after {
+			changes = append(changes, fmt.Sprintf("Changed conditions of alert %q on panel %q: %s -> %s", name, title, before, after))
+		}
+
+		for _, key := range []string{"frequency", "for"} {
+			before, after := previousAlert.Get(key).MustString(), alert.Get(key).MustString()
+			if before != after {
+				changes = append(changes, fmt.Sprintf("Changed %s of alert %q on panel %q: %s -> %s", key, name, title, valueOrNone(before), valueOrNone(after)))
+			}
+		}
+	}
+
+	for _, panel := range getAlertPanels(previous) {
+		if !currentIds[panel.Get("id").MustInt64()] {
+			changes = append(changes, fmt.Sprintf("Removed alert %q from panel %q", panel.Get("alert").Get("name").MustString(), panelTitle(panel)))
+		}
+	}
+
+	return changes
+}
+
+func panelTitle(panel *simplejson.Json) string {
+	if title := panel.Get("title").MustString(); title != "" {
+		return title
+	}
+	return fmt.Sprintf("%d", panel.Get("id").MustInt64())
+}
+
+// describeConditions returns the conditions of an alert as shown in the alert tab, e.g. avg() of A(5m, now) above 80
+func describeConditions(alert *simplejson.Json) string {
+	conditions := alert.Get("conditions").MustArray()
+	if len(conditions) == 0 {
+		return "none"
+	}
+
+	parts := make([]string, len(conditions))
+	for i, c := range conditions {
+		condition := simplejson.NewFromAny(c)
+
+		query := condition.Get("query").Get("params").MustStringArray()
+		target := ""
+		if len(query) > 0 {
+			target = query[0]
+		}
+		if len(query) > 1 {
+			target = fmt.Sprintf("%s(%s)", target, strings.Join(query[1:], ", "))
+		}
+
+		evaluator := condition.Get("evaluator")
+		evaluatorType := evaluator.Get("type").MustString()
+		description, ok := evaluatorDescriptions[evaluatorType]
+		if !ok {
+			description = evaluatorType
+		}
+
+		values := make([]string, 0)
+		for _, param := range evaluator.Get("params").MustArray() {
+			values = append(values, fmt.Sprint(param))
+		}
+
+		part := fmt.Sprintf("%s() of %s %s", condition.Get("reducer").Get("type").MustString(), target, description)
+		if evaluatorType != "no_value" && len(values) > 0 {
+			part = fmt.Sprintf("%s %s", part, strings.Join(values, ", "))
+		}
+
+		if i > 0 {
+			part = fmt.Sprintf("%s %s", condition.Get("operator").Get("type").MustString("and"), part)
+		}
+		parts[i] = part
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
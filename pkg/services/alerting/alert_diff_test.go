@@ -0,0 +1,56 @@
+package alerting
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffAlerts(t *testing.T) {
+	Convey("Given two versions of a dashboard with alerts", t, func() {
+		previous := readDiffFixture("./testdata/alert-diff-previous.json")
+		current := readDiffFixture("./testdata/alert-diff-current.json")
+
+		Convey("Should describe the alert changes by panel", func() {
+			So(DiffAlerts(previous, current), ShouldResemble, []string{
+				`Changed conditions of alert "High CPU" on panel "CPU": avg() of A(5m, now) above 80 -> avg() of A(5m, now) above 90 or count() of A(5m, now) has no value`,
+				`Changed frequency of alert "High CPU" on panel "CPU": 1m -> 5m`,
+				`Added alert "Error rate" on panel "Errors"`,
+				`Renamed alert "Disk full" to "Disk almost full" on panel "Disk"`,
+				`Changed for of alert "Disk almost full" on panel "Disk": none -> 15m`,
+				`Removed alert "High memory" from panel "Memory"`,
+			})
+		})
+
+		Convey("Should describe the reverse changes", func() {
+			So(DiffAlerts(current, previous), ShouldResemble, []string{
+				`Changed conditions of alert "High CPU" on panel "CPU": avg() of A(5m, now) above 90 or count() of A(5m, now) has no value -> avg() of A(5m, now) above 80`,
+				`Changed frequency of alert "High CPU" on panel "CPU": 5m -> 1m`,
+				`Added alert "High memory" on panel "Memory"`,
+				`Renamed alert "Disk almost full" to "Disk full" on panel "Disk"`,
+				`Changed for of alert "Disk full" on panel "Disk": 15m -> none`,
+				`Removed alert "Error rate" from panel "Errors"`,
+			})
+		})
+
+		Convey("Should not report anything for the same alerts", func() {
+			So(DiffAlerts(previous, previous), ShouldBeEmpty)
+		})
+
+		Convey("Should describe range conditions", func() {
+			So(DiffAlerts(simplejson.New(), current), ShouldContain, `Added alert "Error rate" on panel "Errors"`)
+			So(describeConditions(getAlertPanels(current)[1].Get("alert")), ShouldEqual, "sum() of B(10m, now) outside 0, 5")
+		})
+	})
+}
+
+func readDiffFixture(path string) *simplejson.Json {
+	content, err := ioutil.ReadFile(path)
+	So(err, ShouldBeNil)
+
+	json, err := simplejson.NewJson(content)
+	So(err, ShouldBeNil)
+	return json
+}
@@ -8,12 +8,32 @@ import (
 func init() {
 	bus.AddHandler("alerting", updateDashboardAlerts)
 	bus.AddHandler("alerting", validateDashboardAlerts)
+	bus.AddHandler("alerting", diffDashboardAlerts)
 }
 
 func validateDashboardAlerts(cmd *models.ValidateDashboardAlertsCommand) error {
 	extractor := NewDashAlertExtractor(cmd.Dashboard, cmd.OrgId, cmd.User)
 
-	return extractor.ValidateAlerts()
+	if err := extractor.ValidateAlerts(); err != nil {
+		return err
+	}
+
+	if cmd.TargetFolder == nil {
+		return nil
+	}
+
+	violations, err := extractor.ValidateNotifications(cmd.TargetFolder)
+	if err != nil {
+		return err
+	}
+
+	cmd.Result = violations
+	return nil
+}
+
+func diffDashboardAlerts(query *models.DiffDashboardAlertsQuery) error {
+	query.Result = DiffAlerts(query.Previous.Data, query.Current.Data)
+	return nil
 }
 
 func updateDashboardAlerts(cmd *models.UpdateDashboardAlertsCommand) error {
@@ -24,6 +44,7 @@ func updateDashboardAlerts(cmd *models.UpdateDashboardAlertsCommand) error {
 	}
 
 	extractor := NewDashAlertExtractor(cmd.Dashboard, cmd.OrgId, cmd.User)
+	extractor.Progress = cmd.Progress
 
 	alerts, err := extractor.GetAlerts()
 	if err != nil {
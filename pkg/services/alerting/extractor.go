@@ -1,31 +1,50 @@
 package alerting
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
+// ErrAlertExtractionTimeout is returned when extracting the alerts of a dashboard takes
+// longer than the configured timeout.
+var ErrAlertExtractionTimeout = models.ErrAlertExtractionTimeout
+
 // DashAlertExtractor extracts alerts from the dashboard json.
 type DashAlertExtractor struct {
 	User  *models.SignedInUser
 	Dash  *models.Dashboard
 	OrgID int64
 	log   log.Logger
+
+	// Concurrency is the number of panels processed at the same time, defaults to the number of CPUs.
+	Concurrency int
+	// Timeout bounds the time spent extracting alerts, zero means no timeout.
+	Timeout time.Duration
+	// Progress, if set, is called each time the alert of a panel has been processed.
+	Progress func(done int, total int)
 }
 
 // NewDashAlertExtractor returns a new DashAlertExtractor.
 func NewDashAlertExtractor(dash *models.Dashboard, orgID int64, user *models.SignedInUser) *DashAlertExtractor {
 	return &DashAlertExtractor{
-		User:  user,
-		Dash:  dash,
-		OrgID: orgID,
-		log:   log.New("alerting.extractor"),
+		User:        user,
+		Dash:        dash,
+		OrgID:       orgID,
+		log:         log.New("alerting.extractor"),
+		Concurrency: setting.AlertingExtractionConcurrency,
+		Timeout:     setting.AlertingExtractionTimeout,
 	}
 }
 
@@ -73,8 +92,10 @@ func copyJSON(in *simplejson.Json) (*simplejson.Json, error) {
 	return simplejson.NewJson(rawJSON)
 }
 
-func (e *DashAlertExtractor) getAlertFromPanels(jsonWithPanels *simplejson.Json, validateAlertFunc func(*models.Alert) bool) ([]*models.Alert, error) {
-	alerts := make([]*models.Alert, 0)
+// getAlertPanels returns the panels with an alert, including panels in collapsed rows,
+// in the order they appear in the dashboard.
+func getAlertPanels(jsonWithPanels *simplejson.Json) []*simplejson.Json {
+	panels := make([]*simplejson.Json, 0)
 
 	for _, panelObj := range jsonWithPanels.Get("panels").MustArray() {
 		panel := simplejson.NewFromAny(panelObj)
@@ -82,122 +103,230 @@ func (e *DashAlertExtractor) getAlertFromPanels(jsonWithPanels *simplejson.Json,
 		collapsedJSON, collapsed := panel.CheckGet("collapsed")
 		// check if the panel is collapsed
 		if collapsed && collapsedJSON.MustBool() {
-
 			// extract alerts from sub panels for collapsed panels
-			alertSlice, err := e.getAlertFromPanels(panel, validateAlertFunc)
-			if err != nil {
-				return nil, err
-			}
-
-			alerts = append(alerts, alertSlice...)
+			panels = append(panels, getAlertPanels(panel)...)
 			continue
 		}
 
-		jsonAlert, hasAlert := panel.CheckGet("alert")
-
-		if !hasAlert {
-			continue
+		if _, hasAlert := panel.CheckGet("alert"); hasAlert {
+			panels = append(panels, panel)
 		}
+	}
+
+	return panels
+}
+
+// getAlertFromPanel returns the alert of the panel, or nil if the alert is disabled.
+func (e *DashAlertExtractor) getAlertFromPanel(panel *simplejson.Json, validateAlertFunc func(*models.Alert) bool) (*models.Alert, error) {
+	jsonAlert := panel.Get("alert")
 
-		panelID, err := panel.Get("id").Int64()
+	panelID, err := panel.Get("id").Int64()
+	if err != nil {
+		return nil, ValidationError{Reason: "A numeric panel id property is missing"}
+	}
+
+	// backward compatibility check, can be removed later
+	enabled, hasEnabled := jsonAlert.CheckGet("enabled")
+	if hasEnabled && !enabled.MustBool() {
+		return nil, nil
+	}
+
+	frequency, err := getTimeDurationStringToSeconds(jsonAlert.Get("frequency").MustString())
+	if err != nil {
+		return nil, ValidationError{Reason: err.Error()}
+	}
+
+	rawFor := jsonAlert.Get("for").MustString()
+	var forValue time.Duration
+	if rawFor != "" {
+		forValue, err = time.ParseDuration(rawFor)
 		if err != nil {
-			return nil, ValidationError{Reason: "A numeric panel id property is missing"}
+			return nil, ValidationError{Reason: "Could not parse for"}
 		}
+	}
 
-		// backward compatibility check, can be removed later
-		enabled, hasEnabled := jsonAlert.CheckGet("enabled")
-		if hasEnabled && !enabled.MustBool() {
-			continue
+	alert := &models.Alert{
+		DashboardId: e.Dash.Id,
+		OrgId:       e.OrgID,
+		PanelId:     panelID,
+		Id:          jsonAlert.Get("id").MustInt64(),
+		Name:        jsonAlert.Get("name").MustString(),
+		Handler:     jsonAlert.Get("handler").MustInt64(),
+		Message:     jsonAlert.Get("message").MustString(),
+		Frequency:   frequency,
+		For:         forValue,
+	}
+
+	for _, condition := range jsonAlert.Get("conditions").MustArray() {
+		jsonCondition := simplejson.NewFromAny(condition)
+
+		jsonQuery := jsonCondition.Get("query")
+		queryRefID := jsonQuery.Get("params").MustArray()[0].(string)
+		panelQuery := findPanelQueryByRefID(panel, queryRefID)
+
+		if panelQuery == nil {
+			reason := fmt.Sprintf("Alert on PanelId: %v refers to query(%s) that cannot be found", alert.PanelId, queryRefID)
+			return nil, ValidationError{Reason: reason}
+		}
+
+		dsName := ""
+		if panelQuery.Get("datasource").MustString() != "" {
+			dsName = panelQuery.Get("datasource").MustString()
+		} else if panel.Get("datasource").MustString() != "" {
+			dsName = panel.Get("datasource").MustString()
 		}
 
-		frequency, err := getTimeDurationStringToSeconds(jsonAlert.Get("frequency").MustString())
+		datasource, err := e.lookupDatasourceID(dsName)
 		if err != nil {
-			return nil, ValidationError{Reason: err.Error()}
+			e.log.Debug("Error looking up datasource", "error", err)
+			return nil, ValidationError{Reason: fmt.Sprintf("Data source used by alert rule not found, alertName=%v, datasource=%s", alert.Name, dsName)}
 		}
 
-		rawFor := jsonAlert.Get("for").MustString()
-		var forValue time.Duration
-		if rawFor != "" {
-			forValue, err = time.ParseDuration(rawFor)
-			if err != nil {
-				return nil, ValidationError{Reason: "Could not parse for"}
-			}
+		if err := e.checkDatasourceAccess(alert, datasource); err != nil {
+			return nil, err
 		}
 
-		alert := &models.Alert{
-			DashboardId: e.Dash.Id,
-			OrgId:       e.OrgID,
-			PanelId:     panelID,
-			Id:          jsonAlert.Get("id").MustInt64(),
-			Name:        jsonAlert.Get("name").MustString(),
-			Handler:     jsonAlert.Get("handler").MustInt64(),
-			Message:     jsonAlert.Get("message").MustString(),
-			Frequency:   frequency,
-			For:         forValue,
+		jsonQuery.SetPath([]string{"datasourceId"}, datasource.Id)
+
+		if interval, err := panel.Get("interval").String(); err == nil {
+			panelQuery.Set("interval", interval)
 		}
 
-		for _, condition := range jsonAlert.Get("conditions").MustArray() {
-			jsonCondition := simplejson.NewFromAny(condition)
+		jsonQuery.Set("model", panelQuery.Interface())
+	}
 
-			jsonQuery := jsonCondition.Get("query")
-			queryRefID := jsonQuery.Get("params").MustArray()[0].(string)
-			panelQuery := findPanelQueryByRefID(panel, queryRefID)
+	alert.Settings = jsonAlert
 
-			if panelQuery == nil {
-				reason := fmt.Sprintf("Alert on PanelId: %v refers to query(%s) that cannot be found", alert.PanelId, queryRefID)
-				return nil, ValidationError{Reason: reason}
-			}
+	// validate
+	_, err = NewRuleFromDBAlert(alert)
+	if err != nil {
+		return nil, err
+	}
 
-			dsName := ""
-			if panelQuery.Get("datasource").MustString() != "" {
-				dsName = panelQuery.Get("datasource").MustString()
-			} else if panel.Get("datasource").MustString() != "" {
-				dsName = panel.Get("datasource").MustString()
-			}
+	if !validateAlertFunc(alert) {
+		return nil, ValidationError{Reason: fmt.Sprintf("Panel id is not correct, alertName=%v, panelId=%v", alert.Name, alert.PanelId)}
+	}
 
-			datasource, err := e.lookupDatasourceID(dsName)
-			if err != nil {
-				e.log.Debug("Error looking up datasource", "error", err)
-				return nil, ValidationError{Reason: fmt.Sprintf("Data source used by alert rule not found, alertName=%v, datasource=%s", alert.Name, dsName)}
-			}
+	return alert, nil
+}
 
-			dsFilterQuery := models.DatasourcesPermissionFilterQuery{
-				User:        e.User,
-				Datasources: []*models.DataSource{datasource},
-			}
+// checkDatasourceAccess checks that the user may query the data source of the alert. With
+// verify_datasource_permissions the check goes through the guardian and names the alert and data source,
+// otherwise only the data source permission filter is checked, when one is registered.
+func (e *DashAlertExtractor) checkDatasourceAccess(alert *models.Alert, datasource *models.DataSource) error {
+	if setting.AlertingVerifyDatasourcePermissions {
+		canQuery, err := guardian.CanQueryDatasource(e.User, datasource)
+		if err != nil {
+			return err
+		}
+		if !canQuery {
+			return DatasourceAccessDeniedError{AlertName: alert.Name, PanelID: alert.PanelId, Datasource: datasource.Name}
+		}
+		return nil
+	}
 
-			if err := bus.Dispatch(&dsFilterQuery); err != nil {
-				if err != bus.ErrHandlerNotFound {
-					return nil, err
-				}
-			} else {
-				if len(dsFilterQuery.Result) == 0 {
-					return nil, models.ErrDataSourceAccessDenied
+	dsFilterQuery := models.DatasourcesPermissionFilterQuery{
+		User:        e.User,
+		Datasources: []*models.DataSource{datasource},
+	}
+
+	if err := bus.Dispatch(&dsFilterQuery); err != nil {
+		if err != bus.ErrHandlerNotFound {
+			return err
+		}
+	} else {
+		if len(dsFilterQuery.Result) == 0 {
+			return models.ErrDataSourceAccessDenied
+		}
+	}
+
+	return nil
+}
+
+// getAlertsFromPanels extracts the alerts of the panels using a bounded pool of workers.
+// Alerts are returned in the order of the panels, and when several panels fail the error
+// of the first one is returned, so the result does not depend on scheduling. Once the
+// timeout expires the workers stop picking panels, and the extraction returns when the
+// panels being processed are done, so no worker outlives it.
+func (e *DashAlertExtractor) getAlertsFromPanels(panels []*simplejson.Json, validateAlertFunc func(*models.Alert) bool) ([]*models.Alert, error) {
+	total := len(panels)
+	if total == 0 {
+		return []*models.Alert{}, nil
+	}
+
+	ctx := context.Background()
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	workers := e.Concurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > total {
+		workers = total
+	}
+
+	results := make([]*models.Alert, total)
+	errs := make([]error, total)
+
+	var (
+		next      int64 = -1
+		failedAt  int64 = int64(total)
+		done      int
+		doneMutex sync.Mutex
+		wg        sync.WaitGroup
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				i := atomic.AddInt64(&next, 1)
+				// panels are picked in order, so panels before a failed one are always processed
+				if i >= int64(total) || i > atomic.LoadInt64(&failedAt) || ctx.Err() != nil {
+					return
 				}
-			}
 
-			jsonQuery.SetPath([]string{"datasourceId"}, datasource.Id)
+				results[i], errs[i] = e.getAlertFromPanel(panels[i], validateAlertFunc)
+				if errs[i] != nil {
+					for {
+						current := atomic.LoadInt64(&failedAt)
+						if i >= current || atomic.CompareAndSwapInt64(&failedAt, current, i) {
+							break
+						}
+					}
+				}
 
-			if interval, err := panel.Get("interval").String(); err == nil {
-				panelQuery.Set("interval", interval)
+				if e.Progress != nil {
+					doneMutex.Lock()
+					done++
+					e.Progress(done, total)
+					doneMutex.Unlock()
+				}
 			}
+		}()
+	}
 
-			jsonQuery.Set("model", panelQuery.Interface())
-		}
+	wg.Wait()
 
-		alert.Settings = jsonAlert
+	if ctx.Err() != nil {
+		return nil, ErrAlertExtractionTimeout
+	}
 
-		// validate
-		_, err = NewRuleFromDBAlert(alert)
-		if err != nil {
-			return nil, err
+	alerts := make([]*models.Alert, 0, total)
+	for i := range panels {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
 
-		if !validateAlertFunc(alert) {
-			return nil, ValidationError{Reason: fmt.Sprintf("Panel id is not correct, alertName=%v, panelId=%v", alert.Name, alert.PanelId)}
+		if results[i] != nil {
+			alerts = append(alerts, results[i])
 		}
-
-		alerts = append(alerts, alert)
 	}
 
 	return alerts, nil
@@ -218,28 +347,22 @@ func (e *DashAlertExtractor) extractAlerts(validateFunc func(alert *models.Alert
 		return nil, err
 	}
 
-	alerts := make([]*models.Alert, 0)
+	panels := make([]*simplejson.Json, 0)
 
 	// We extract alerts from rows to be backwards compatible
 	// with the old dashboard json model.
 	rows := dashboardJSON.Get("rows").MustArray()
 	if len(rows) > 0 {
 		for _, rowObj := range rows {
-			row := simplejson.NewFromAny(rowObj)
-			a, err := e.getAlertFromPanels(row, validateFunc)
-			if err != nil {
-				return nil, err
-			}
-
-			alerts = append(alerts, a...)
+			panels = append(panels, getAlertPanels(simplejson.NewFromAny(rowObj))...)
 		}
 	} else {
-		a, err := e.getAlertFromPanels(dashboardJSON, validateFunc)
-		if err != nil {
-			return nil, err
-		}
+		panels = getAlertPanels(dashboardJSON)
+	}
 
-		alerts = append(alerts, a...)
+	alerts, err := e.getAlertsFromPanels(panels, validateFunc)
+	if err != nil {
+		return nil, err
 	}
 
 	e.log.Debug("Extracted alerts from dashboard", "alertCount", len(alerts))
@@ -252,3 +375,103 @@ func (e *DashAlertExtractor) ValidateAlerts() error {
 	_, err := e.extractAlerts(func(alert *models.Alert) bool { return alert.OrgId != 0 && alert.PanelId != 0 })
 	return err
 }
+
+// ValidateNotifications returns the notification channels of the alerts of the dashboard the user cannot use
+// from the folder, e.g. channels granted through the team owning the previous folder. Channels that do not exist
+// are left to the alert validation.
+func (e *DashAlertExtractor) ValidateNotifications(folder *models.Dashboard) ([]*models.AlertNotificationViolation, error) {
+	alerts, err := e.extractAlerts(func(alert *models.Alert) bool { return alert.OrgId != 0 && alert.PanelId != 0 })
+	if err != nil {
+		return nil, err
+	}
+
+	type alertNotification struct {
+		alert        *models.Alert
+		notification *models.AlertNotification
+	}
+
+	var used []alertNotification
+	notifications := make([]*models.AlertNotification, 0)
+	resolved := make(map[string]*models.AlertNotification)
+
+	for _, alert := range alerts {
+		for _, v := range alert.Settings.Get("notifications").MustArray() {
+			notification, err := e.lookupNotification(simplejson.NewFromAny(v), resolved)
+			if err != nil {
+				return nil, err
+			}
+			if notification == nil {
+				continue
+			}
+
+			if _, ok := resolved[notification.Uid]; !ok {
+				resolved[notification.Uid] = notification
+				notifications = append(notifications, notification)
+			}
+			used = append(used, alertNotification{alert: alert, notification: notification})
+		}
+	}
+
+	if len(used) == 0 {
+		return nil, nil
+	}
+
+	filterQuery := models.AlertNotificationsPermissionFilterQuery{
+		User:          e.User,
+		Folder:        folder,
+		Notifications: notifications,
+	}
+
+	if err := bus.Dispatch(&filterQuery); err != nil {
+		if err == bus.ErrHandlerNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	allowed := make(map[int64]bool)
+	for _, notification := range filterQuery.Result {
+		allowed[notification.Id] = true
+	}
+
+	var violations []*models.AlertNotificationViolation
+	for _, use := range used {
+		if allowed[use.notification.Id] {
+			continue
+		}
+		violations = append(violations, &models.AlertNotificationViolation{
+			AlertName:        use.alert.Name,
+			PanelId:          use.alert.PanelId,
+			NotificationUid:  use.notification.Uid,
+			NotificationName: use.notification.Name,
+		})
+	}
+
+	return violations, nil
+}
+
+// lookupNotification returns the notification channel referenced by id or uid in the settings of an alert, or
+// nil if it does not exist. Channels found by uid are reused from resolved.
+func (e *DashAlertExtractor) lookupNotification(ref *simplejson.Json, resolved map[string]*models.AlertNotification) (*models.AlertNotification, error) {
+	if id, err := ref.Get("id").Int64(); err == nil {
+		query := &models.GetAlertNotificationsQuery{Id: id, OrgId: e.OrgID}
+		if err := bus.Dispatch(query); err != nil {
+			return nil, err
+		}
+		return query.Result, nil
+	}
+
+	uid := ref.Get("uid").MustString()
+	if uid == "" {
+		return nil, nil
+	}
+	if notification, ok := resolved[uid]; ok {
+		return notification, nil
+	}
+
+	query := &models.GetAlertNotificationsWithUidQuery{Uid: uid, OrgId: e.OrgID}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	return query.Result, nil
+}
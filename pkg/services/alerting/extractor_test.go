@@ -1,7 +1,9 @@
 package alerting
 
 import (
+	"fmt"
 	"io/ioutil"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -9,7 +11,9 @@ import (
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
 	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
 )
 
 func TestAlertRuleExtraction(t *testing.T) {
@@ -280,3 +284,258 @@ func TestAlertRuleExtraction(t *testing.T) {
 		})
 	})
 }
+
+// generateAlertDashboard returns a dashboard with one alert per panel, every panel
+// querying the given data source.
+func generateAlertDashboard(alertCount int, dsName string) *models.Dashboard {
+	panels := make([]interface{}, 0, alertCount)
+
+	for i := 1; i <= alertCount; i++ {
+		panels = append(panels, map[string]interface{}{
+			"id":         i,
+			"datasource": dsName,
+			"targets": []interface{}{
+				map[string]interface{}{"refId": "A", "target": fmt.Sprintf("metric.%d", i)},
+			},
+			"alert": map[string]interface{}{
+				"id":        i * 10,
+				"name":      fmt.Sprintf("alert %d", i),
+				"frequency": "60s",
+				"conditions": []interface{}{
+					map[string]interface{}{
+						"type":  "query",
+						"query": map[string]interface{}{"params": []interface{}{"A", "5m", "now"}},
+					},
+				},
+			},
+		})
+	}
+
+	return models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+		"id":     1,
+		"title":  "generated",
+		"panels": panels,
+	}))
+}
+
+func setupSlowDatasourceLookup(delay time.Duration) {
+	RegisterCondition("query", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetDataSourceByNameQuery) error {
+		time.Sleep(delay)
+		query.Result = &models.DataSource{Id: 1, OrgId: 1, Name: query.Name}
+		return nil
+	})
+}
+
+func TestAlertRuleExtractionConcurrency(t *testing.T) {
+	Convey("Given a dashboard with many alerts", t, func() {
+		bus.ClearBusHandlers()
+		setupSlowDatasourceLookup(time.Millisecond)
+
+		dash := generateAlertDashboard(100, "graphite")
+
+		Convey("Should extract alerts in panel order regardless of concurrency", func() {
+			for _, concurrency := range []int{1, 4, 16} {
+				extractor := NewDashAlertExtractor(dash, 1, nil)
+				extractor.Concurrency = concurrency
+
+				alerts, err := extractor.GetAlerts()
+				So(err, ShouldBeNil)
+				So(len(alerts), ShouldEqual, 100)
+
+				for i, alert := range alerts {
+					So(alert.PanelId, ShouldEqual, i+1)
+					So(alert.Id, ShouldEqual, (i+1)*10)
+				}
+			}
+		})
+
+		Convey("Should return the error of the first invalid panel", func() {
+			dash.Data.Get("panels").GetIndex(60).Get("alert").Set("frequency", "invalid")
+			dash.Data.Get("panels").GetIndex(20).Del("id")
+
+			extractor := NewDashAlertExtractor(dash, 1, nil)
+			extractor.Concurrency = 8
+
+			_, err := extractor.GetAlerts()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Alert validation error: A numeric panel id property is missing")
+		})
+
+		Convey("Should report progress for every panel", func() {
+			extractor := NewDashAlertExtractor(dash, 1, nil)
+			extractor.Concurrency = 8
+
+			calls, lastDone, lastTotal := 0, 0, 0
+			extractor.Progress = func(done int, total int) {
+				calls++
+				lastDone, lastTotal = done, total
+			}
+
+			_, err := extractor.GetAlerts()
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 100)
+			So(lastDone, ShouldEqual, 100)
+			So(lastTotal, ShouldEqual, 100)
+		})
+
+		Convey("Should fail when extraction takes longer than the timeout", func() {
+			bus.ClearBusHandlers()
+			setupSlowDatasourceLookup(0)
+
+			var lookups int64
+			bus.AddHandler("test", func(query *models.GetDataSourceByNameQuery) error {
+				atomic.AddInt64(&lookups, 1)
+				time.Sleep(50 * time.Millisecond)
+				query.Result = &models.DataSource{Id: 1, OrgId: 1, Name: query.Name}
+				return nil
+			})
+
+			extractor := NewDashAlertExtractor(dash, 1, nil)
+			extractor.Concurrency = 2
+			extractor.Timeout = 20 * time.Millisecond
+
+			_, err := extractor.GetAlerts()
+			So(err, ShouldEqual, ErrAlertExtractionTimeout)
+
+			// the workers stop once their current lookup is done and are gone when the extraction returns
+			So(atomic.LoadInt64(&lookups), ShouldEqual, 2)
+			time.Sleep(100 * time.Millisecond)
+			So(atomic.LoadInt64(&lookups), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestAlertDatasourcePermissions(t *testing.T) {
+	Convey("Given a dashboard with an alert querying a restricted data source", t, func() {
+		bus.ClearBusHandlers()
+		setupSlowDatasourceLookup(0)
+
+		origVerify := setting.AlertingVerifyDatasourcePermissions
+		dash := generateAlertDashboard(2, "restricted")
+		user := &models.SignedInUser{UserId: 1, OrgId: 1}
+
+		bus.AddHandler("test", func(query *models.DatasourcesPermissionFilterQuery) error {
+			query.Result = []*models.DataSource{}
+			return nil
+		})
+
+		Convey("Should name the alert and the data source when verifying permissions", func() {
+			setting.AlertingVerifyDatasourcePermissions = true
+
+			err := NewDashAlertExtractor(dash, 1, user).ValidateAlerts()
+			So(err, ShouldResemble, DatasourceAccessDeniedError{AlertName: "alert 1", PanelID: 1, Datasource: "restricted"})
+			So(xerrors.Is(err, models.ErrDataSourceAccessDenied), ShouldBeTrue)
+			So(err.Error(), ShouldEqual, "Access denied to data source restricted used by alert alert 1 on panel 1")
+		})
+
+		Convey("Should deny alerts saved without a user when verifying permissions", func() {
+			setting.AlertingVerifyDatasourcePermissions = true
+			bus.ClearBusHandlers()
+			setupSlowDatasourceLookup(0)
+
+			_, err := NewDashAlertExtractor(dash, 1, nil).GetAlerts()
+			So(err, ShouldHaveSameTypeAs, DatasourceAccessDeniedError{})
+		})
+
+		Convey("Should keep the unnamed error by default", func() {
+			err := NewDashAlertExtractor(dash, 1, user).ValidateAlerts()
+			So(err, ShouldEqual, models.ErrDataSourceAccessDenied)
+		})
+
+		Reset(func() {
+			setting.AlertingVerifyDatasourcePermissions = origVerify
+		})
+	})
+}
+
+func TestAlertNotificationValidation(t *testing.T) {
+	Convey("Given a dashboard with alerts notifying channels", t, func() {
+		bus.ClearBusHandlers()
+		setupSlowDatasourceLookup(0)
+
+		teamA := &models.AlertNotification{Id: 1, Uid: "team-a", Name: "Team A pager"}
+		teamB := &models.AlertNotification{Id: 2, Uid: "team-b", Name: "Team B email"}
+
+		bus.AddHandler("test", func(query *models.GetAlertNotificationsWithUidQuery) error {
+			if query.Uid == teamA.Uid {
+				query.Result = teamA
+			}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetAlertNotificationsQuery) error {
+			if query.Id == teamB.Id {
+				query.Result = teamB
+			}
+			return nil
+		})
+
+		dash := generateAlertDashboard(3, "graphite")
+		setNotifications := func(panel int, notifications ...map[string]interface{}) {
+			refs := make([]interface{}, 0, len(notifications))
+			for _, notification := range notifications {
+				refs = append(refs, notification)
+			}
+			dash.Data.Get("panels").GetIndex(panel).Get("alert").Set("notifications", refs)
+		}
+		setNotifications(0, map[string]interface{}{"uid": "team-a"}, map[string]interface{}{"id": 2})
+		setNotifications(1, map[string]interface{}{"uid": "team-a"})
+		setNotifications(2, map[string]interface{}{"uid": "missing"})
+
+		user := &models.SignedInUser{UserId: 1, OrgId: 1}
+		folder := &models.Dashboard{Id: 5, OrgId: 1, Title: "Team B", IsFolder: true}
+
+		Convey("Should return the notification channels the user cannot use from the folder", func() {
+			var filtered []*models.AlertNotification
+			bus.AddHandler("test", func(query *models.AlertNotificationsPermissionFilterQuery) error {
+				So(query.Folder, ShouldEqual, folder)
+				So(query.User, ShouldEqual, user)
+				filtered = query.Notifications
+				query.Result = []*models.AlertNotification{teamB}
+				return nil
+			})
+
+			violations, err := NewDashAlertExtractor(dash, 1, user).ValidateNotifications(folder)
+			So(err, ShouldBeNil)
+			So(filtered, ShouldResemble, []*models.AlertNotification{teamA, teamB})
+			So(violations, ShouldResemble, []*models.AlertNotificationViolation{
+				{AlertName: "alert 1", PanelId: 1, NotificationUid: "team-a", NotificationName: "Team A pager"},
+				{AlertName: "alert 2", PanelId: 2, NotificationUid: "team-a", NotificationName: "Team A pager"},
+			})
+		})
+
+		Convey("Should allow every notification channel without a permission filter", func() {
+			violations, err := NewDashAlertExtractor(dash, 1, user).ValidateNotifications(folder)
+			So(err, ShouldBeNil)
+			So(violations, ShouldBeEmpty)
+		})
+	})
+}
+
+func benchmarkAlertRuleExtraction(b *testing.B, concurrency int) {
+	bus.ClearBusHandlers()
+	setupSlowDatasourceLookup(100 * time.Microsecond)
+
+	dash := generateAlertDashboard(400, "graphite")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		extractor := NewDashAlertExtractor(dash, 1, nil)
+		extractor.Concurrency = concurrency
+
+		if _, err := extractor.GetAlerts(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAlertRuleExtraction400Sequential(b *testing.B) {
+	benchmarkAlertRuleExtraction(b, 1)
+}
+
+func BenchmarkAlertRuleExtraction400Concurrent(b *testing.B) {
+	benchmarkAlertRuleExtraction(b, 8)
+}
@@ -71,6 +71,21 @@ func (e ValidationError) Error() string {
 	return fmt.Sprintf("Alert validation error: %s", extraInfo)
 }
 
+// DatasourceAccessDeniedError is returned when the user saving an alert cannot query one of its data sources
+type DatasourceAccessDeniedError struct {
+	AlertName  string
+	PanelID    int64
+	Datasource string
+}
+
+func (e DatasourceAccessDeniedError) Error() string {
+	return fmt.Sprintf("Access denied to data source %s used by alert %s on panel %d", e.Datasource, e.AlertName, e.PanelID)
+}
+
+func (e DatasourceAccessDeniedError) Unwrap() error {
+	return models.ErrDataSourceAccessDenied
+}
+
 var (
 	valueFormatRegex = regexp.MustCompile(`^\d+`)
 	unitFormatRegex  = regexp.MustCompile(`\w{1}$`)
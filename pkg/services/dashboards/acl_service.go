@@ -1,9 +1,12 @@
 package dashboards
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
 	"github.com/grafana/grafana/pkg/models"
-	"time"
 )
 
 func MakeUserAdmin(bus bus.Bus, orgId int64, userId int64, dashboardId int64, setViewAndEditPermissions bool) error {
@@ -53,3 +56,89 @@ func MakeUserAdmin(bus bus.Bus, orgId int64, userId int64, dashboardId int64, se
 
 	return nil
 }
+
+// UpdateDashboardPermissions replaces the permissions of a dashboard or folder. The grants added, changed and
+// removed are published with the login of the user, e.g. to export them to git.
+func (dr *dashboardServiceImpl) UpdateDashboardPermissions(cmd *models.UpdateDashboardAclCommand, orgId int64, user *models.SignedInUser) error {
+	before := &models.GetDashboardAclInfoListQuery{DashboardId: cmd.DashboardId, OrgId: orgId}
+	if err := bus.Dispatch(before); err != nil {
+		return err
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		return err
+	}
+
+	after := &models.GetDashboardAclInfoListQuery{DashboardId: cmd.DashboardId, OrgId: orgId}
+	if err := bus.Dispatch(after); err != nil {
+		return err
+	}
+
+	changes := aclChanges(customAcl(before.Result, cmd.DashboardId), customAcl(after.Result, cmd.DashboardId))
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return bus.Publish(&events.DashboardAclUpdated{
+		Timestamp:   time.Now(),
+		OrgId:       orgId,
+		DashboardId: cmd.DashboardId,
+		UpdatedBy:   user.Login,
+		Changes:     changes,
+	})
+}
+
+// customAcl returns the permissions set on the dashboard itself, without the inherited and default ones
+func customAcl(acl []*models.DashboardAclInfoDTO, dashboardId int64) []*models.DashboardAclInfoDTO {
+	var custom []*models.DashboardAclInfoDTO
+	for _, item := range acl {
+		if item.DashboardId == dashboardId && !item.Inherited {
+			custom = append(custom, item)
+		}
+	}
+	return custom
+}
+
+// aclChanges describes the grants added, changed and removed, naming users by login and never by email
+func aclChanges(before []*models.DashboardAclInfoDTO, after []*models.DashboardAclInfoDTO) []string {
+	previous := make(map[string]*models.DashboardAclInfoDTO, len(before))
+	for _, item := range before {
+		previous[aclGrantee(item)] = item
+	}
+
+	var changes []string
+	current := make(map[string]bool, len(after))
+	for _, item := range after {
+		grantee := aclGrantee(item)
+		current[grantee] = true
+
+		old, ok := previous[grantee]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("Grant %s to %s", item.Permission, grantee))
+		case old.Permission != item.Permission:
+			changes = append(changes, fmt.Sprintf("Change %s from %s to %s", grantee, old.Permission, item.Permission))
+		}
+	}
+
+	for _, item := range before {
+		if grantee := aclGrantee(item); !current[grantee] {
+			changes = append(changes, fmt.Sprintf("Revoke %s from %s", item.Permission, grantee))
+		}
+	}
+
+	return changes
+}
+
+// aclGrantee names who a permission is granted to, e.g. "role Editor", "team Ops" or "user jdoe"
+func aclGrantee(item *models.DashboardAclInfoDTO) string {
+	switch {
+	case item.UserId > 0:
+		return "user " + item.UserLogin
+	case item.TeamId > 0:
+		return "team " + item.Team
+	case item.Role != nil:
+		return "role " + string(*item.Role)
+	}
+	return "nobody"
+}
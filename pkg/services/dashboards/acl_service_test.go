@@ -0,0 +1,90 @@
+package dashboards
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateDashboardPermissions(t *testing.T) {
+	Convey("Given a dashboard with permissions", t, func() {
+		bus.ClearBusHandlers()
+
+		editor := models.ROLE_EDITOR
+		viewer := models.ROLE_VIEWER
+
+		// the folder grant is inherited and not part of the changes
+		acl := []*models.DashboardAclInfoDTO{
+			{DashboardId: 1, Role: &viewer, Permission: models.PERMISSION_VIEW, Inherited: true},
+			{DashboardId: 2, Role: &editor, Permission: models.PERMISSION_EDIT},
+			{DashboardId: 2, UserId: 5, UserLogin: "jdoe", UserEmail: "jdoe@example.com", Permission: models.PERMISSION_VIEW},
+		}
+
+		bus.AddHandler("test", func(query *models.GetDashboardAclInfoListQuery) error {
+			query.Result = acl
+			return nil
+		})
+
+		var updated []*models.UpdateDashboardAclCommand
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardAclCommand) error {
+			updated = append(updated, cmd)
+			acl = []*models.DashboardAclInfoDTO{
+				{DashboardId: 1, Role: &viewer, Permission: models.PERMISSION_VIEW, Inherited: true},
+				{DashboardId: 2, UserId: 5, UserLogin: "jdoe", UserEmail: "jdoe@example.com", Permission: models.PERMISSION_ADMIN},
+				{DashboardId: 2, TeamId: 4, Team: "SRE", Permission: models.PERMISSION_EDIT},
+			}
+			return nil
+		})
+
+		var published []*events.DashboardAclUpdated
+		bus.AddEventListener(func(event *events.DashboardAclUpdated) error {
+			published = append(published, event)
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, Login: "admin"}
+
+		Convey("Should publish the added, changed and removed grants", func() {
+			cmd := &models.UpdateDashboardAclCommand{DashboardId: 2}
+			err := service.UpdateDashboardPermissions(cmd, 1, user)
+			So(err, ShouldBeNil)
+			So(updated, ShouldResemble, []*models.UpdateDashboardAclCommand{cmd})
+
+			So(len(published), ShouldEqual, 1)
+			So(published[0].DashboardId, ShouldEqual, 2)
+			So(published[0].UpdatedBy, ShouldEqual, "admin")
+			So(published[0].Changes, ShouldResemble, []string{
+				"Change user jdoe from View to Admin",
+				"Grant Edit to team SRE",
+				"Revoke Edit from role Editor",
+			})
+		})
+
+		Convey("Should not publish when the grants are unchanged", func() {
+			bus.ClearBusHandlers()
+			bus.AddHandler("test", func(query *models.GetDashboardAclInfoListQuery) error {
+				query.Result = acl
+				return nil
+			})
+			bus.AddHandler("test", func(cmd *models.UpdateDashboardAclCommand) error {
+				return nil
+			})
+			bus.AddEventListener(func(event *events.DashboardAclUpdated) error {
+				published = append(published, event)
+				return nil
+			})
+
+			err := service.UpdateDashboardPermissions(&models.UpdateDashboardAclCommand{DashboardId: 2}, 1, user)
+			So(err, ShouldBeNil)
+			So(published, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package dashboards
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// maxAlertChangesInCommit caps the lines of the alert changes section of a commit message
+const maxAlertChangesInCommit = 10
+
+// withAlertChanges appends the alert changes between the stored and the saved dashboard to a commit message.
+// The message is left as is when the alerts did not change or could not be compared.
+func withAlertChanges(message string, previous *models.Dashboard, current *models.Dashboard) string {
+	query := &models.DiffDashboardAlertsQuery{Previous: previous, Current: current}
+	if err := bus.Dispatch(query); err != nil {
+		return message
+	}
+
+	return appendAlertChanges(message, query.Result)
+}
+
+func appendAlertChanges(message string, changes []string) string {
+	if len(changes) == 0 {
+		return message
+	}
+
+	var b strings.Builder
+	if message = strings.TrimSpace(message); message != "" {
+		b.WriteString(message)
+		b.WriteString("\n\n")
+	}
+
+	b.WriteString("Alert changes:\n")
+	for i, change := range changes {
+		if i == maxAlertChangesInCommit {
+			fmt.Fprintf(&b, "- and %d more\n", len(changes)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- %s\n", change)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
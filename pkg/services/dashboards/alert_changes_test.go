@@ -0,0 +1,76 @@
+package dashboards
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAlertChangesInCommitMessage(t *testing.T) {
+	Convey("Given alert changes of a saved dashboard", t, func() {
+		changes := []string{
+			`Changed frequency of alert "High CPU" on panel "CPU": 1m -> 5m`,
+			`Removed alert "High memory" from panel "Memory"`,
+		}
+
+		Convey("Should append them to the message of the user", func() {
+			So(appendAlertChanges("Raise CPU threshold\n", changes), ShouldEqual, `Raise CPU threshold
+
+Alert changes:
+- Changed frequency of alert "High CPU" on panel "CPU": 1m -> 5m
+- Removed alert "High memory" from panel "Memory"`)
+		})
+
+		Convey("Should be the whole message without a message of the user", func() {
+			So(appendAlertChanges("", changes[:1]), ShouldEqual, `Alert changes:
+- Changed frequency of alert "High CPU" on panel "CPU": 1m -> 5m`)
+		})
+
+		Convey("Should keep the message without alert changes", func() {
+			So(appendAlertChanges("Rename panels", nil), ShouldEqual, "Rename panels")
+		})
+
+		Convey("Should cap the number of changes", func() {
+			many := make([]string, 0)
+			for i := 1; i <= 12; i++ {
+				many = append(many, fmt.Sprintf(`Added alert "Alert %d" on panel "Panel %d"`, i, i))
+			}
+
+			So(appendAlertChanges("", many), ShouldEqual, `Alert changes:
+- Added alert "Alert 1" on panel "Panel 1"
+- Added alert "Alert 2" on panel "Panel 2"
+- Added alert "Alert 3" on panel "Panel 3"
+- Added alert "Alert 4" on panel "Panel 4"
+- Added alert "Alert 5" on panel "Panel 5"
+- Added alert "Alert 6" on panel "Panel 6"
+- Added alert "Alert 7" on panel "Panel 7"
+- Added alert "Alert 8" on panel "Panel 8"
+- Added alert "Alert 9" on panel "Panel 9"
+- Added alert "Alert 10" on panel "Panel 10"
+- and 2 more`)
+		})
+
+		Convey("Should use the alert changes of the alerting service", func() {
+			bus.AddHandler("test", func(query *models.DiffDashboardAlertsQuery) error {
+				query.Result = changes[1:]
+				return nil
+			})
+
+			So(withAlertChanges("Clean up", &models.Dashboard{}, &models.Dashboard{}), ShouldEqual, `Clean up
+
+Alert changes:
+- Removed alert "High memory" from panel "Memory"`)
+		})
+
+		Convey("Should keep the message when the alerts cannot be compared", func() {
+			So(withAlertChanges("Clean up", &models.Dashboard{}, &models.Dashboard{}), ShouldEqual, "Clean up")
+		})
+
+		Reset(func() {
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,220 @@
+package dashboards
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// savePipelineBulk is the pipeline of the saves of BulkSaveDashboards, once the dashboards are validated and
+// committed
+const savePipelineBulk = "bulk"
+
+// BulkSaveError is the error of the dashboard failing a bulk save, Index is its position in the dashboards of the
+// bulk save. The dashboards before it are saved when the save itself failed, none is when its validation or its
+// commit failed.
+type BulkSaveError struct {
+	Index int
+	Title string
+	Uid   string
+	Err   error
+}
+
+func (e BulkSaveError) Error() string {
+	return fmt.Sprintf("dashboard %d (%s) of the bulk save failed: %v", e.Index, e.Title, e.Err)
+}
+
+func (e BulkSaveError) Unwrap() error {
+	return e.Err
+}
+
+func newBulkSaveError(index int, dto *SaveDashboardDTO, err error) BulkSaveError {
+	return BulkSaveError{Index: index, Title: dto.Dashboard.Title, Uid: dto.Dashboard.Uid, Err: saveStageCause(err)}
+}
+
+// BulkSaveDashboards validates all the dashboards before saving any of them, then commits them and saves them in
+// order. The dashboards committed with the same connector, repository and branch are committed at once when the
+// connector supports it, other connectors and queued syncs commit each dashboard on its own. A dashboard failing
+// its validation or its commit fails the bulk save before any dashboard is saved. A dashboard failing its save
+// stops the bulk save, the dashboards saved before it are returned with the error. The errors are BulkSaveErrors
+// telling which dashboard failed. Like the other batch operations the save rate limits do not apply.
+func (dr *dashboardServiceImpl) BulkSaveDashboards(dtos []*SaveDashboardDTO) ([]*models.Dashboard, error) {
+	if err := dashboardMaintenance.check(); err != nil {
+		return nil, err
+	}
+
+	states := make([]*saveState, 0, len(dtos))
+	uids := make(map[string]int)
+	titles := make(map[string]int)
+
+	for i, dto := range dtos {
+		dto.warnings = make([]Warning, 0)
+
+		if dto.GitOverride != nil && !dto.User.HasRole(models.ROLE_EDITOR) {
+			return nil, newBulkSaveError(i, dto, models.ErrDashboardGitOverrideAccessDenied)
+		}
+
+		if _, err := dr.buildSaveDashboardCommand(dto, true, true); err != nil {
+			return nil, newBulkSaveError(i, dto, err)
+		}
+
+		// the dashboards of the bulk save are validated against the stored ones, not against each other
+		dash := dto.Dashboard
+		if dash.Uid != "" {
+			if _, exists := uids[dash.Uid]; exists {
+				return nil, newBulkSaveError(i, dto, models.ErrDashboardWithSameUIDExists)
+			}
+			uids[dash.Uid] = i
+		}
+
+		title := fmt.Sprintf("%d/%s", dash.FolderId, strings.ToLower(dash.Slug))
+		if dash.IsFolder {
+			title = "folder/" + strings.ToLower(dash.Slug)
+		}
+		if _, exists := titles[title]; exists {
+			return nil, newBulkSaveError(i, dto, models.ErrDashboardWithSameNameInFolderExists)
+		}
+		titles[title] = i
+
+		states = append(states, &saveState{dto: dto, validateAlerts: true, validateProvisionedDashboard: true})
+	}
+
+	if !saveStageDisabled(SaveStageFlagSync) {
+		if err := dr.commitBulkSave(states); err != nil {
+			return nil, err
+		}
+	}
+
+	saved := make([]*models.Dashboard, 0, len(states))
+	for i, state := range states {
+		if err := runSavePipeline(savePipelineBulk, dr.bulkSaveStages(), state); err != nil {
+			return saved, newBulkSaveError(i, state.dto, err)
+		}
+		saved = append(saved, state.cmd.Result)
+	}
+
+	return saved, nil
+}
+
+// bulkSaveStages save the dashboards of a bulk save, validated and committed beforehand
+func (dr *dashboardServiceImpl) bulkSaveStages() []saveStage {
+	return []saveStage{
+		{name: StagePersist, run: dr.persistDashboard},
+		{name: StagePostSaveSync, flag: SaveStageFlagSync, run: dr.recordSync},
+		{name: StageUpdateAlerts, flag: SaveStageFlagUpdateAlerts, run: dr.updateDashboardAlerts},
+		{name: StagePublishEvents, flag: SaveStageFlagPublishEvents, run: dr.pruneFolderMovedFrom},
+	}
+}
+
+// bulkCommitBatch are the commits made at once, of the same user to the same repository and branch
+type bulkCommitBatch struct {
+	batcher social.DashboardBatchUpdater
+	token   string
+	options []*social.UpdateDashboardOptions
+}
+
+type bulkCommitKey struct {
+	authModule string
+	token      string
+	orgId      int64
+	repo       string
+	branch     string
+}
+
+// bulkCommit is a commit of a dashboard of a bulk save made with the other commits of its batch
+type bulkCommit struct {
+	index   int
+	state   *saveState
+	commits []*dashboardCommit
+	// position is the position of the commit in the commits of the dashboard
+	position int
+	options  *social.UpdateDashboardOptions
+	batch    *bulkCommitBatch
+}
+
+// commitBulkSave commits the dashboards of a bulk save of users with a token. The commits go through batches when
+// the connector of the user supports them, with the sync failure policy of each dashboard applied to the failed
+// batches of its commits.
+func (dr *dashboardServiceImpl) commitBulkSave(states []*saveState) error {
+	batches := make(map[bulkCommitKey]*bulkCommitBatch)
+	order := make([]*bulkCommitBatch, 0)
+	pending := make([]*bulkCommit, 0)
+
+	for i, state := range states {
+		dto := state.dto
+		if dto.User.Token == "" {
+			continue
+		}
+
+		connect, _ := social.SocialMap[dto.User.AuthModule]
+		batcher, ok := connect.(social.DashboardBatchUpdater)
+		if !ok || gitSyncQueue.active(dto.OrgId) {
+			if err := dr.commitBeforeSave(state); err != nil {
+				return newBulkSaveError(i, dto, err)
+			}
+			continue
+		}
+
+		dr.setSyncedUid(dto.Dashboard)
+		commits := dashboardCommits(state.loadPrevious(), dto.Dashboard, dto)
+		for position, commit := range commits {
+			options, err := dr.dashboardUpdateOptions(commit.dashboard, commit.action, commit.dto, commit.message)
+			if err != nil {
+				return newBulkSaveError(i, dto, err)
+			}
+			if options == nil {
+				continue
+			}
+
+			key := bulkCommitKey{authModule: dto.User.AuthModule, token: dto.User.Token, orgId: options.OrgId, repo: options.Repo, branch: options.Branch}
+			batch, exists := batches[key]
+			if !exists {
+				batch = &bulkCommitBatch{batcher: batcher, token: dto.User.Token}
+				batches[key] = batch
+				order = append(order, batch)
+			}
+			batch.options = append(batch.options, options)
+
+			pending = append(pending, &bulkCommit{index: i, state: state, commits: commits, position: position, options: options, batch: batch})
+		}
+	}
+
+	failed := make(map[*bulkCommitBatch]error)
+	for _, batch := range order {
+		if err := batch.batcher.UpdateDashboards(batch.options, batch.token); err != nil {
+			failed[batch] = err
+		}
+	}
+
+	// the commits of a dashboard may go through different batches, e.g. the delete of its previous file and its
+	// creation in another repository, so only the commits that failed are handed to its sync failure policy
+	failedCommits := make(map[*saveState][]*dashboardCommit)
+	firstFailures := make([]*bulkCommit, 0)
+	syncErrs := make(map[*saveState]error)
+
+	for _, made := range pending {
+		commit := made.commits[made.position]
+		result, err := dr.dashboardUpdated(commit.dashboard, commit.dto, made.options, failed[made.batch])
+		if err != nil {
+			if _, exists := syncErrs[made.state]; !exists {
+				syncErrs[made.state] = err
+				firstFailures = append(firstFailures, made)
+			}
+			failedCommits[made.state] = append(failedCommits[made.state], commit)
+			continue
+		}
+		if commit.action != social.DeleteDashboard {
+			made.state.syncResult = result
+		}
+	}
+
+	for _, made := range firstFailures {
+		if err := made.state.syncFailed(syncErrs[made.state], failedCommits[made.state]); err != nil {
+			return newBulkSaveError(made.index, made.state.dto, err)
+		}
+	}
+
+	return nil
+}
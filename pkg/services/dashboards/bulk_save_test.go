@@ -0,0 +1,194 @@
+package dashboards
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBulkSaveDashboards(t *testing.T) {
+	Convey("Given the dashboard service on an in-memory store", t, func() {
+		bus.ClearBusHandlers()
+
+		store := NewFakeDashboardStore()
+		store.Register()
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &fakeBatchSyncConnector{fakeSyncConnector: &fakeSyncConnector{orgId: 1, commitSha: "abc123"}}
+		social.SocialMap["gitlab"] = connector
+
+		syncs := make(map[int64]*models.SaveDashboardGitSyncCommand)
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			syncs[cmd.DashboardId] = cmd
+			return nil
+		})
+
+		service := NewServiceWithDeps(&fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}, shortUIDGenerator{})
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+
+		folder := store.AddFolder(1, "Ops")
+		existing := store.AddDashboard(1, folder.Id, "Memory")
+
+		newDashboard := func(title string) *models.Dashboard {
+			dash := models.NewDashboard(title)
+			dash.OrgId = 1
+			dash.FolderId = folder.Id
+			return dash
+		}
+		dtos := func(dashboards ...*models.Dashboard) []*SaveDashboardDTO {
+			result := make([]*SaveDashboardDTO, 0, len(dashboards))
+			for _, dash := range dashboards {
+				result = append(result, &SaveDashboardDTO{OrgId: 1, User: user, Dashboard: dash, Message: "Bulk save"})
+			}
+			return result
+		}
+
+		Convey("Should save all the dashboards in order", func() {
+			saved, err := service.BulkSaveDashboards(dtos(newDashboard("CPU"), newDashboard("Disk")))
+			So(err, ShouldBeNil)
+			So(saved, ShouldHaveLength, 2)
+			So(store.Dashboard(saved[0].Id).Title, ShouldEqual, "CPU")
+			So(store.Dashboard(saved[1].Id).Title, ShouldEqual, "Disk")
+		})
+
+		Convey("Should save none of the dashboards when one fails its validation", func() {
+			_, err := service.BulkSaveDashboards(dtos(newDashboard("CPU"), newDashboard("Memory")))
+			So(err, ShouldNotBeNil)
+
+			bulkErr, ok := err.(BulkSaveError)
+			So(ok, ShouldBeTrue)
+			So(bulkErr.Index, ShouldEqual, 1)
+			So(bulkErr.Err, ShouldEqual, models.ErrDashboardWithSameNameInFolderExists)
+			So(errors.Unwrap(err), ShouldEqual, models.ErrDashboardWithSameNameInFolderExists)
+			So(store.sorted(), ShouldHaveLength, 2)
+		})
+
+		Convey("Should save none of the dashboards when two of them have the same title in a folder", func() {
+			_, err := service.BulkSaveDashboards(dtos(newDashboard("CPU"), newDashboard("Disk"), newDashboard("cpu")))
+			So(err, ShouldNotBeNil)
+			So(err.(BulkSaveError).Index, ShouldEqual, 2)
+			So(store.sorted(), ShouldHaveLength, 2)
+		})
+
+		Convey("Should return the dashboards saved before the one failing its save", func() {
+			bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+				if cmd.Dashboard.Get("title").MustString() == "Disk" {
+					return errors.New("database is locked")
+				}
+				return store.saveDashboard(cmd)
+			})
+
+			saved, err := service.BulkSaveDashboards(dtos(newDashboard("CPU"), newDashboard("Disk"), newDashboard("Network")))
+			So(err, ShouldNotBeNil)
+			So(err.(BulkSaveError).Index, ShouldEqual, 1)
+			So(err.(BulkSaveError).Title, ShouldEqual, "Disk")
+			So(saved, ShouldHaveLength, 1)
+			So(saved[0].Title, ShouldEqual, "CPU")
+			So(store.sorted(), ShouldHaveLength, 3)
+		})
+
+		Convey("Given users syncing their dashboards to git", func() {
+			user.AuthModule = "gitlab"
+			user.Token = "token"
+
+			Convey("Should commit the dashboards at once with connectors committing batches", func() {
+				memory := store.Dashboard(existing.Id)
+				memory.Data.Set("description", "updated")
+
+				saved, err := service.BulkSaveDashboards(dtos(newDashboard("CPU"), memory))
+				So(err, ShouldBeNil)
+
+				So(connector.batches, ShouldHaveLength, 1)
+				So(connector.batches[0], ShouldHaveLength, 2)
+				So(connector.batches[0][0].Action, ShouldEqual, social.CreateDashboard)
+				So(connector.batches[0][1].Action, ShouldEqual, social.UpdateDashboard)
+				So(connector.lastOptions, ShouldBeNil)
+
+				So(syncs[saved[0].Id].CommitSha, ShouldEqual, "batch-1")
+				So(syncs[saved[1].Id].CommitSha, ShouldEqual, "batch-1")
+			})
+
+			Convey("Should save none of the dashboards when their commit fails", func() {
+				connector.err = models.ErrDashboardGitlabSync
+
+				_, err := service.BulkSaveDashboards(dtos(newDashboard("CPU"), newDashboard("Disk")))
+				So(err, ShouldNotBeNil)
+				So(err.(BulkSaveError).Index, ShouldEqual, 0)
+				So(errors.Unwrap(err), ShouldEqual, models.ErrDashboardGitlabSync)
+				So(store.sorted(), ShouldHaveLength, 2)
+			})
+
+			Convey("When the sync failure policy queues the failed commits", func() {
+				connector.err = models.ErrDashboardGitlabSync
+
+				Convey("Should queue the delete of the previous file of a moved dashboard with its creation", func() {
+					moved := store.Dashboard(existing.Id)
+					moved.FolderId = 0
+					save := dtos(moved)
+					save[0].SyncFailurePolicy = setting.SyncFailurePolicyQueue
+
+					_, err := service.BulkSaveDashboards(save)
+					So(err, ShouldBeNil)
+					So(save[0].warnings, ShouldHaveLength, 1)
+					So(store.Outbox.items, ShouldHaveLength, 2)
+					So(store.Outbox.items[0].Action, ShouldEqual, string(social.DeleteDashboard))
+					So(store.Outbox.items[1].Action, ShouldEqual, string(social.CreateDashboard))
+				})
+
+				Reset(func() {
+					gitSyncQueue = newSyncQueue()
+				})
+			})
+
+			Convey("Should commit each dashboard on its own with other connectors", func() {
+				single := &fakeSyncConnector{orgId: 1, commitSha: "abc123"}
+				social.SocialMap["gitlab"] = single
+
+				saved, err := service.BulkSaveDashboards(dtos(newDashboard("CPU"), newDashboard("Disk")))
+				So(err, ShouldBeNil)
+				So(single.lastOptions.Title, ShouldEqual, "Disk")
+				So(syncs[saved[0].Id].CommitSha, ShouldEqual, "abc123")
+				So(syncs[saved[1].Id].CommitSha, ShouldEqual, "abc123")
+			})
+		})
+
+		Reset(func() {
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+		})
+	})
+}
+
+// fakeBatchSyncConnector commits the batches of dashboards as commits named after their position
+type fakeBatchSyncConnector struct {
+	*fakeSyncConnector
+	batches [][]*social.UpdateDashboardOptions
+}
+
+func (c *fakeBatchSyncConnector) UpdateDashboards(options []*social.UpdateDashboardOptions, token string) error {
+	c.batches = append(c.batches, options)
+	if c.err != nil {
+		return c.err
+	}
+
+	for _, option := range options {
+		option.Result = &social.DashboardSyncResult{
+			CommitSha: fmt.Sprintf("batch-%d", len(c.batches)),
+			FilePath:  option.Folder + "/" + option.Name + ".json",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package dashboards
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var (
+	ErrGitPreviewNotSupported      = errors.New("No repository supporting dashboard previews is configured for the organization")
+	ErrGitRefInvalid               = errors.New("Invalid git ref, expected a commit sha or a branch or tag name")
+	ErrDashboardNotSynced          = errors.New("Dashboard is not synced to the repository")
+	ErrDashboardPreviewSource      = errors.New("Dashboard is rendered from a source file, it cannot be previewed at a ref")
+	ErrDashboardPreviewTooLarge    = errors.New("Dashboard file at the ref exceeds the preview size limit")
+	ErrDashboardPreviewInvalidJson = errors.New("Dashboard file at the ref is not a valid dashboard")
+)
+
+// gitRefPattern matches commit shas and branch or tag names. The names are checked further by validateGitRef.
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+const maxGitRefLength = 255
+
+// DashboardAtCommit is a dashboard as its file is in the repository at a ref. It is only read for previews, never
+// saved, so its alerts are not extracted either.
+type DashboardAtCommit struct {
+	// Dashboard is the stored dashboard, the preview is served with its meta
+	Dashboard *models.Dashboard
+	// Data is the json of the file at the ref, with the id and uid of the stored dashboard
+	Data     *simplejson.Json
+	Ref      string
+	FilePath string
+}
+
+// RenderDashboardAtCommit reads the file of a synced dashboard at a ref of the repository of the organization, e.g.
+// for reviewers to see a dashboard as it was at a commit without importing it. The file is read at the path the
+// dashboard is synced to now, so it is not found at refs from before the dashboard was moved. The user must be
+// allowed to view the dashboard.
+func (dr *dashboardServiceImpl) RenderDashboardAtCommit(orgId int64, uid string, ref string, user *models.SignedInUser) (*DashboardAtCommit, error) {
+	if err := validateGitRef(ref); err != nil {
+		return nil, err
+	}
+
+	query := &models.GetDashboardQuery{OrgId: orgId, Uid: uid}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	dash := query.Result
+
+	guard := guardian.New(dash.Id, orgId, user)
+	if canView, err := guard.CanView(); err != nil || !canView {
+		if err != nil {
+			return nil, err
+		}
+		return nil, models.ErrDashboardViewAccessDenied
+	}
+
+	reader, ok := getGitProvider(orgId).(social.RevisionReader)
+	if !ok {
+		return nil, ErrGitPreviewNotSupported
+	}
+
+	syncQuery := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+	if err := bus.Dispatch(syncQuery); err != nil {
+		return nil, err
+	}
+
+	lastSync := syncQuery.Result
+	if lastSync == nil || lastSync.FilePath == "" {
+		return nil, ErrDashboardNotSynced
+	}
+	if lastSync.SourceFormat != "" {
+		return nil, ErrDashboardPreviewSource
+	}
+
+	content, err := reader.ReadFileAtRef(orgId, lastSync.FilePath, ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > setting.DashboardPreviewMaxSize {
+		return nil, ErrDashboardPreviewTooLarge
+	}
+
+	data, err := simplejson.NewJson([]byte(content))
+	if err != nil {
+		return nil, ErrDashboardPreviewInvalidJson
+	}
+	if _, err := data.Map(); err != nil || strings.TrimSpace(data.Get("title").MustString()) == "" {
+		return nil, ErrDashboardPreviewInvalidJson
+	}
+
+	// the file may come from another instance, the preview keeps the identity of the stored dashboard
+	data.Set("id", dash.Id)
+	data.Set("uid", dash.Uid)
+
+	return &DashboardAtCommit{Dashboard: dash, Data: data, Ref: ref, FilePath: lastSync.FilePath}, nil
+}
+
+// validateGitRef accepts commit shas and the branch and tag names git allows, without the names that could
+// escape the ref, e.g. containing .. or starting with -
+func validateGitRef(ref string) error {
+	if len(ref) > maxGitRefLength || !gitRefPattern.MatchString(ref) {
+		return ErrGitRefInvalid
+	}
+
+	if strings.Contains(ref, "..") || strings.Contains(ref, "//") || strings.Contains(ref, "/.") ||
+		strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") || strings.HasSuffix(ref, ".lock") {
+		return ErrGitRefInvalid
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package dashboards
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenderDashboardAtCommit(t *testing.T) {
+	Convey("Given a dashboard synced to the repository", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		fakeGuardian := &guardian.FakeDashboardGuardian{CanViewValue: true}
+		guardian.MockDashboardGuardian(fakeGuardian)
+
+		origPreviewMaxSize := setting.DashboardPreviewMaxSize
+		setting.DashboardPreviewMaxSize = 1024
+
+		reader := &fakeRevisionReader{files: map[string]string{
+			"v1.0:dashboards/Team/service.json": `{"id": 41, "uid": "other", "title": "Service at v1", "alert": {"name": "cpu"}}`,
+			"v0.9:dashboards/Team/service.json": `{"title": `,
+		}}
+		getGitProvider = func(orgId int64) social.GitProvider {
+			return reader
+		}
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Uid != "service" {
+				return models.ErrDashboardNotFound
+			}
+			query.Result = &models.Dashboard{Id: 5, Uid: "service", OrgId: 1, Title: "Service", Slug: "service", Version: 7}
+			return nil
+		})
+
+		lastSync := &models.DashboardGitSync{DashboardId: 5, OrgId: 1, FilePath: "dashboards/Team/service.json"}
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			query.Result = lastSync
+			return nil
+		})
+
+		saves := 0
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			saves++
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1}
+
+		Convey("Should return the file at the ref with the identity of the stored dashboard", func() {
+			preview, err := service.RenderDashboardAtCommit(1, "service", "v1.0", user)
+			So(err, ShouldBeNil)
+			So(preview.Ref, ShouldEqual, "v1.0")
+			So(preview.FilePath, ShouldEqual, "dashboards/Team/service.json")
+			So(preview.Dashboard.Version, ShouldEqual, 7)
+			So(preview.Data.Get("title").MustString(), ShouldEqual, "Service at v1")
+			So(preview.Data.Get("id").MustInt64(), ShouldEqual, 5)
+			So(preview.Data.Get("uid").MustString(), ShouldEqual, "service")
+			So(fakeGuardian.DashId, ShouldEqual, 5)
+			So(saves, ShouldEqual, 0)
+		})
+
+		Convey("Should return the errors of unknown refs and missing files", func() {
+			_, err := service.RenderDashboardAtCommit(1, "service", "0123abcd", user)
+			So(err, ShouldEqual, social.ErrGitRefNotFound)
+
+			lastSync.FilePath = "dashboards/General/service.json"
+			_, err = service.RenderDashboardAtCommit(1, "service", "v1.0", user)
+			So(err, ShouldEqual, social.ErrGitFileNotFound)
+		})
+
+		Convey("Should reject invalid refs before reading the repository", func() {
+			refs := []string{"", "-v1", "../master", "feature//x", "release/", "v1.lock", "main~1", "a b", strings.Repeat("a", 256)}
+			for _, ref := range refs {
+				_, err := service.RenderDashboardAtCommit(1, "service", ref, user)
+				So(err, ShouldEqual, ErrGitRefInvalid)
+			}
+			So(reader.reads, ShouldEqual, 0)
+
+			So(validateGitRef("e83c5163316f89bfbde7d9ab23ca2e25604af290"), ShouldBeNil)
+			So(validateGitRef("release/1.0"), ShouldBeNil)
+		})
+
+		Convey("Should not return the file to users who cannot view the dashboard", func() {
+			fakeGuardian.CanViewValue = false
+
+			_, err := service.RenderDashboardAtCommit(1, "service", "v1.0", user)
+			So(err, ShouldEqual, models.ErrDashboardViewAccessDenied)
+			So(reader.reads, ShouldEqual, 0)
+		})
+
+		Convey("Should reject files that are too large or not a dashboard", func() {
+			_, err := service.RenderDashboardAtCommit(1, "service", "v0.9", user)
+			So(err, ShouldEqual, ErrDashboardPreviewInvalidJson)
+
+			setting.DashboardPreviewMaxSize = 10
+			_, err = service.RenderDashboardAtCommit(1, "service", "v1.0", user)
+			So(err, ShouldEqual, ErrDashboardPreviewTooLarge)
+		})
+
+		Convey("Should only preview dashboards synced as json", func() {
+			lastSync.SourceFormat = models.GitSourceFormatJsonnet
+			_, err := service.RenderDashboardAtCommit(1, "service", "v1.0", user)
+			So(err, ShouldEqual, ErrDashboardPreviewSource)
+
+			lastSync = nil
+			_, err = service.RenderDashboardAtCommit(1, "service", "v1.0", user)
+			So(err, ShouldEqual, ErrDashboardNotSynced)
+		})
+
+		Convey("Should fail for unknown dashboards", func() {
+			_, err := service.RenderDashboardAtCommit(1, "unknown", "v1.0", user)
+			So(err, ShouldEqual, models.ErrDashboardNotFound)
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+			getGitProvider = social.GetGitProvider
+			setting.DashboardPreviewMaxSize = origPreviewMaxSize
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+// fakeRevisionReader serves files keyed by ref and path, refs without files are unknown
+type fakeRevisionReader struct {
+	social.GitProvider
+	files map[string]string
+	reads int
+}
+
+func (r *fakeRevisionReader) ReadFileAtRef(orgId int64, filePath string, ref string) (string, error) {
+	r.reads++
+
+	knownRef := false
+	for key := range r.files {
+		if strings.HasPrefix(key, ref+":") {
+			knownRef = true
+		}
+	}
+	if !knownRef {
+		return "", social.ErrGitRefNotFound
+	}
+
+	content, ok := r.files[ref+":"+filePath]
+	if !ok {
+		return "", social.ErrGitFileNotFound
+	}
+	return content, nil
+}
@@ -1,25 +1,72 @@
 package dashboards
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
-	"encoding/json"
-
 	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/login/social"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/services/login"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/util"
 	"github.com/grafana/grafana/pkg/util/errutil"
 )
 
+// touchCommitMessage is the message of the commits of touched dashboards, their content is unchanged
+const touchCommitMessage = "Re-sync the dashboard without changes"
+
+// ErrProvisioningOnly is returned when saving as the provisioning admin outside of provisioning
+var ErrProvisioningOnly = errors.New("Provisioned dashboards can only be saved by provisioning")
+
 // DashboardService service for operating on dashboards
 type DashboardService interface {
 	SaveDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error)
+	SaveDashboardWithWarnings(dto *SaveDashboardDTO) (*SaveDashboardResult, error)
+	BulkSaveDashboards(dtos []*SaveDashboardDTO) ([]*models.Dashboard, error)
 	ImportDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error)
-	DeleteDashboard(dashboardId int64, orgId int64) error
+	TouchDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) error
+	DeleteDashboard(dashboardId int64, orgId int64) (*DeleteDashboardResult, error)
+	DeleteDashboardIfVersion(dashboardId int64, orgId int64, expectedVersion int64, user *models.SignedInUser) (*DeleteDashboardResult, error)
+	PrepareDeleteDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) (*DeleteConfirmation, error)
+	DeleteDashboardWithToken(dashboardId int64, orgId int64, token string, user *models.SignedInUser) (*DeleteDashboardResult, error)
+	CloneFolder(sourceFolderId int64, orgId int64, newFolderTitle string, user *models.SignedInUser) (*CloneResult, error)
+	GetGitSyncMeta(dashboardId int64, orgId int64) (*models.DashboardGitSyncMeta, error)
+	GetDashboardFolderPath(dashboardId int64, orgId int64, user *models.SignedInUser) (string, error)
+	RenderDashboardAtCommit(orgId int64, uid string, ref string, user *models.SignedInUser) (*DashboardAtCommit, error)
+	UpdateDashboardPermissions(cmd *models.UpdateDashboardAclCommand, orgId int64, user *models.SignedInUser) error
+	SetSyncPaused(paused bool) (*GitSyncStatus, error)
+	GetSyncStatus() *GitSyncStatus
+	GetQueuedSyncCommits(orgId int64, statuses []models.DashboardSyncOutboxStatus) ([]*QueuedSyncCommit, error)
+	RequeueSyncCommits(ids []int64) (int64, error)
+	PurgeSyncCommits(ids []int64) (int64, error)
+	MigrateRepoLayout(orgId int64, dryRun bool) (*RepoLayoutMigration, error)
+	ImportGitOnlyDashboards(orgId int64, user *models.SignedInUser, opts ImportGitOnlyOptions) (*ImportReport, error)
+	RepairOrphanedDashboards(orgId int64, user *models.SignedInUser, opts OrphanRepairOptions) (*OrphanRepairReport, error)
+	VerifyRepoConsistency(orgId int64, opts VerifyRepoOptions) (*RepoConsistencyReport, error)
+	GetProviderSyncReport(name string) (*ProviderSyncReport, error)
+	GetSyncBudget(orgId int64) *SyncBudgetStatus
+	GetSyncOverview(orgId int64) (*SyncOverview, error)
+	PromoteRepoMirror(orgId int64, mirror string) (*social.SyncRepo, error)
+	FindDashboardsByRepoPath(orgId int64, repoId int, filePath string) ([]*RepoPathDashboard, error)
+	ExportOrgDashboards(orgId int64, opts ExportBundleOptions, w io.Writer) error
+	ImportOrgDashboards(orgId int64, user *models.SignedInUser, bundle io.Reader, opts ImportBundleOptions) (*BundleImportReport, error)
+	StartJob(kind string, orgId int64, params interface{}, user *models.SignedInUser) (int64, error)
+	GetJob(id int64) (*Job, error)
+	CancelJob(id int64) (*Job, error)
+	GetStaleDashboards(orgId int64, olderThan time.Duration, excludeTags []string) ([]*models.StaleDashboard, error)
+	ArchiveDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) (*models.Dashboard, error)
+	ArchiveDashboardWithToken(dashboardId int64, orgId int64, token string, user *models.SignedInUser) (*models.Dashboard, error)
+	GetMaintenance() (*MaintenanceStatus, error)
+	SetMaintenance(opts MaintenanceOptions, user *models.SignedInUser) (*MaintenanceStatus, error)
 }
 
 // DashboardProvisioningService service for operating on provisioned dashboards
@@ -28,37 +75,157 @@ type DashboardProvisioningService interface {
 	SaveFolderForProvisionedDashboards(*SaveDashboardDTO) (*models.Dashboard, error)
 	GetProvisionedDashboardData(name string) ([]*models.DashboardProvisioning, error)
 	GetProvisionedDashboardDataByDashboardId(dashboardId int64) (*models.DashboardProvisioning, error)
+	GetProvisionedDashboardDataByDashboardIds(dashboardIds []int64) (map[int64]*models.DashboardProvisioning, error)
 	UnprovisionDashboard(dashboardId int64) error
 	DeleteProvisionedDashboard(dashboardId int64, orgId int64) error
+	GetMaintenance() (*MaintenanceStatus, error)
+}
+
+// Clock provides the current time to the dashboard service
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator provides the random identifiers, e.g. uids, generated by the dashboard service
+type IDGenerator interface {
+	NewID() string
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+type shortUIDGenerator struct{}
+
+func (shortUIDGenerator) NewID() string {
+	return util.GenerateShortUID()
 }
 
 // NewService factory for creating a new dashboard service
 var NewService = func() DashboardService {
+	return NewServiceWithDeps(realClock{}, shortUIDGenerator{})
+}
+
+// NewServiceWithDeps creates a dashboard service using the given clock and id generator,
+// so tests can freeze the time and predict generated identifiers.
+func NewServiceWithDeps(clock Clock, idGenerator IDGenerator) DashboardService {
 	return &dashboardServiceImpl{
-		log: log.New("dashboard-service"),
+		log:         log.New("dashboard-service"),
+		clock:       clock,
+		idGenerator: idGenerator,
 	}
 }
 
 // NewProvisioningService factory for creating a new dashboard provisioning service
 var NewProvisioningService = func() DashboardProvisioningService {
+	return NewProvisioningServiceWithDeps(realClock{}, shortUIDGenerator{})
+}
+
+// NewProvisioningServiceWithDeps creates a dashboard provisioning service using the given clock and id generator
+func NewProvisioningServiceWithDeps(clock Clock, idGenerator IDGenerator) DashboardProvisioningService {
 	return &dashboardServiceImpl{
-		log: log.New("dashboard-provisioning-service"),
+		log:          log.New("dashboard-provisioning-service"),
+		clock:        clock,
+		idGenerator:  idGenerator,
+		provisioning: true,
 	}
 }
 
+// SaveProgressFunc is called by the long running steps of a dashboard save to report progress
+type SaveProgressFunc func(step string, done int, total int)
+
 type SaveDashboardDTO struct {
 	OrgId     int64
 	UpdatedAt time.Time
 	User      *models.SignedInUser
 	Message   string
 	Overwrite bool
+	Source    models.DashboardSource
 	Dashboard *models.Dashboard
+	Progress  SaveProgressFunc
+	// GitOverride commits the dashboard to another branch than the branch of its repository, only editors can set it
+	GitOverride *models.DashboardGitOverride
+	// Coauthors are credited in the commit of the dashboard, e.g. the pair of the user
+	Coauthors []models.GitCommitAuthor
+	// RequestMeta describes the HTTP request of the save for the audit records, it is nil for provisioning
+	RequestMeta *models.RequestMeta
+	// ExternalIdentity is the identity of the user at the git provider, looked up when the commit needs it if unset
+	ExternalIdentity *models.ExternalIdentity
+	// AllowUidChange allows saving an existing dashboard with another uid, otherwise the save fails with
+	// models.ErrDashboardUidChanged
+	AllowUidChange bool
+	// AllowAdoption lets a provisioned save take over the dashboard using its uid when that dashboard is not
+	// provisioned, otherwise the save fails with models.DashboardAdoptionError
+	AllowAdoption bool
+	// SyncFailurePolicy tells what a failed commit does to the save, see the setting.SyncFailurePolicy
+	// constants. Empty fails the save, batch operations use batch_sync_failure_policy.
+	SyncFailurePolicy string
+	// ApplyFolderTemplate merges the template of the folder into the dashboard when it is new, the API sets it for
+	// the dashboards created in the UI
+	ApplyFolderTemplate bool
+
+	// warnings collects the issues of the soft validations during the save
+	warnings []Warning
+	// transformers are the transformers that changed the dashboard during the save
+	transformers []AppliedTransformer
+	// syncSkipped is set when the commit of the dashboard was skipped, the daily budget being exceeded
+	syncSkipped bool
 }
 
 type dashboardServiceImpl struct {
-	orgId int64
-	user  *models.SignedInUser
-	log   log.Logger
+	orgId       int64
+	user        *models.SignedInUser
+	log         log.Logger
+	clock       Clock
+	idGenerator IDGenerator
+	// provisioning allows the saves as the provisioning admin, only the provisioning service sets it
+	provisioning bool
+}
+
+func (dr *dashboardServiceImpl) now() time.Time {
+	if dr.clock == nil {
+		return time.Now()
+	}
+	return dr.clock.Now()
+}
+
+func (dr *dashboardServiceImpl) newID() string {
+	if dr.idGenerator == nil {
+		return util.GenerateShortUID()
+	}
+	return dr.idGenerator.NewID()
+}
+
+// untitledDashboardTitle is the title of dashboards saved with a title of only whitespace when
+// whitespace_title_policy is untitled
+const untitledDashboardTitle = "Untitled dashboard"
+
+// untitleWhitespaceTitle rejects titles that only have whitespace, which would be saved empty once trimmed, or
+// replaces them with untitledDashboardTitle when whitespace_title_policy is untitled. Folders are always rejected.
+// Empty titles are rejected by the title validator.
+func untitleWhitespaceTitle(dash *models.Dashboard) error {
+	if dash.Title == "" || strings.TrimSpace(dash.Title) != "" {
+		return nil
+	}
+
+	if dash.IsFolder || setting.DashboardWhitespaceTitlePolicy != "untitled" {
+		return models.ErrDashboardTitleWhitespace
+	}
+
+	dash.Title = untitledDashboardTitle
+	dash.Data.Set("title", dash.Title)
+	dash.UpdateSlug()
+	return nil
+}
+
+// setSyncedUid generates the uid of new dashboards committed before they are saved, the database would only
+// generate it once the file is committed without one
+func (dr *dashboardServiceImpl) setSyncedUid(dash *models.Dashboard) {
+	if dash.Uid == "" {
+		dash.SetUid(dr.newID())
+	}
 }
 
 func (dr *dashboardServiceImpl) GetProvisionedDashboardData(name string) ([]*models.DashboardProvisioning, error) {
@@ -81,100 +248,76 @@ func (dr *dashboardServiceImpl) GetProvisionedDashboardDataByDashboardId(dashboa
 	return cmd.Result, nil
 }
 
-func (dr *dashboardServiceImpl) buildSaveDashboardCommand(dto *SaveDashboardDTO, validateAlerts bool, validateProvisionedDashboard bool) (*models.SaveDashboardCommand, error) {
-	dash := dto.Dashboard
-
-	dash.Title = strings.TrimSpace(dash.Title)
-	dash.Data.Set("title", dash.Title)
-	dash.SetUid(strings.TrimSpace(dash.Uid))
-
-	if dash.Title == "" {
-		return nil, models.ErrDashboardTitleEmpty
-	}
-
-	if dash.IsFolder && dash.FolderId > 0 {
-		return nil, models.ErrDashboardFolderCannotHaveParent
+// GetProvisionedDashboardDataByDashboardIds returns the provisioning data of the provisioned dashboards among
+// the ids in one query, for operations on many dashboards. Dashboards that are not provisioned are absent.
+func (dr *dashboardServiceImpl) GetProvisionedDashboardDataByDashboardIds(dashboardIds []int64) (map[int64]*models.DashboardProvisioning, error) {
+	query := &models.GetProvisionedDashboardDataByIdsQuery{DashboardIds: dashboardIds}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
 	}
 
-	if dash.IsFolder && strings.EqualFold(dash.Title, models.RootFolderName) {
-		return nil, models.ErrDashboardFolderNameExists
-	}
+	return query.Result, nil
+}
 
-	if !util.IsValidShortUID(dash.Uid) {
-		return nil, models.ErrDashboardInvalidUid
-	} else if len(dash.Uid) > 40 {
-		return nil, models.ErrDashboardUidToLong
+// buildSaveDashboardCommand runs the stages preparing the save of the dashboard and returns its save command,
+// for the save paths dispatching the command themselves
+func (dr *dashboardServiceImpl) buildSaveDashboardCommand(dto *SaveDashboardDTO, validateAlerts bool, validateProvisionedDashboard bool) (*models.SaveDashboardCommand, error) {
+	state := &saveState{dto: dto, validateAlerts: validateAlerts, validateProvisionedDashboard: validateProvisionedDashboard}
+	if err := runSavePipeline(savePipelineCommand, dr.commandStages(), state); err != nil {
+		return nil, saveStageCause(err)
 	}
 
-	if validateAlerts {
-		validateAlertsCmd := models.ValidateDashboardAlertsCommand{
-			OrgId:     dto.OrgId,
-			Dashboard: dash,
-			User:      dto.User,
-		}
+	return dr.newSaveCommand(dto), nil
+}
 
-		if err := bus.Dispatch(&validateAlertsCmd); err != nil {
-			return nil, err
-		}
+// validateMovedDashboardAlerts checks the notification channels of the alerts of a dashboard moved to another
+// folder against the permissions of the user in that folder, since the user may only have been able to use
+// them through the previous folder. With folder_move_notification_check set to strict the channels the user
+// cannot use reject the move, by default they are returned as warnings. The folder is nil for the General folder.
+func validateMovedDashboardAlerts(dto *SaveDashboardDTO, folder *models.Dashboard) error {
+	if setting.AlertingFolderMoveNotificationCheck == setting.FolderMoveNotificationCheckOff {
+		return nil
 	}
 
-	validateBeforeSaveCmd := models.ValidateDashboardBeforeSaveCommand{
-		OrgId:     dto.OrgId,
-		Dashboard: dash,
-		Overwrite: dto.Overwrite,
+	dash := dto.Dashboard
+	if dash.FolderId != 0 && folder == nil {
+		return models.ErrDashboardFolderNotFound
 	}
-
-	if err := bus.Dispatch(&validateBeforeSaveCmd); err != nil {
-		return nil, err
+	if folder == nil {
+		folder = &models.Dashboard{OrgId: dto.OrgId, Title: models.RootFolderName, IsFolder: true}
 	}
 
-	if validateBeforeSaveCmd.Result.IsParentFolderChanged {
-		folderGuardian := guardian.New(dash.FolderId, dto.OrgId, dto.User)
-		if canSave, err := folderGuardian.CanSave(); err != nil || !canSave {
-			if err != nil {
-				return nil, err
-			}
-			return nil, models.ErrDashboardUpdateAccessDenied
-		}
+	validateAlertsCmd := models.ValidateDashboardAlertsCommand{
+		OrgId:        dto.OrgId,
+		Dashboard:    dash,
+		User:         dto.User,
+		TargetFolder: folder,
 	}
 
-	if validateProvisionedDashboard {
-		provisionedData, err := dr.GetProvisionedDashboardDataByDashboardId(dash.Id)
-		if err != nil {
-			return nil, err
-		}
-
-		if provisionedData != nil {
-			return nil, models.ErrDashboardCannotSaveProvisionedDashboard
-		}
+	if err := bus.Dispatch(&validateAlertsCmd); err != nil {
+		return models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleAlertValidation, Err: err}
 	}
 
-	guard := guardian.New(dash.GetDashboardIdForSavePermissionCheck(), dto.OrgId, dto.User)
-	if canSave, err := guard.CanSave(); err != nil || !canSave {
-		if err != nil {
-			return nil, err
-		}
-		return nil, models.ErrDashboardUpdateAccessDenied
+	if len(validateAlertsCmd.Result) == 0 {
+		return nil
 	}
 
-	cmd := &models.SaveDashboardCommand{
-		Dashboard: dash.Data,
-		Message:   dto.Message,
-		OrgId:     dto.OrgId,
-		Overwrite: dto.Overwrite,
-		UserId:    dto.User.UserId,
-		FolderId:  dash.FolderId,
-		IsFolder:  dash.IsFolder,
-		PluginId:  dash.PluginId,
+	if setting.AlertingFolderMoveNotificationCheck == setting.FolderMoveNotificationCheckStrict {
+		return models.DashboardSaveRuleError{
+			Rule: models.DashboardSaveRuleFolderMoveNotifications,
+			Err:  models.AlertNotificationsDeniedError{Folder: folder.Title, Violations: validateAlertsCmd.Result},
+		}
 	}
 
-	if !dto.UpdatedAt.IsZero() {
-		cmd.UpdatedAt = dto.UpdatedAt
+	for _, violation := range validateAlertsCmd.Result {
+		dto.AddWarning(WarningAlertNotificationDenied, "Alert %s notifies %s, which cannot be used from folder %s",
+			violation.AlertName, violation.NotificationName, folder.Title)
 	}
-
-	return cmd, nil
+	return nil
 }
 
+// updateAlerting updates the alerts of the saved dashboard. The dashboard is saved by then, so running out of time
+// extracting its alerts is a warning, the alerts are updated by the next save.
 func (dr *dashboardServiceImpl) updateAlerting(cmd *models.SaveDashboardCommand, dto *SaveDashboardDTO) error {
 	alertCmd := models.UpdateDashboardAlertsCommand{
 		OrgId:     dto.OrgId,
@@ -182,114 +325,258 @@ func (dr *dashboardServiceImpl) updateAlerting(cmd *models.SaveDashboardCommand,
 		User:      dto.User,
 	}
 
-	return bus.Dispatch(&alertCmd)
+	if dto.Progress != nil {
+		alertCmd.Progress = func(done int, total int) {
+			dto.Progress("alerts", done, total)
+		}
+	}
+
+	if err := bus.Dispatch(&alertCmd); err != nil {
+		if err != models.ErrAlertExtractionTimeout {
+			return err
+		}
+		dto.AddWarning(WarningAlertsNotUpdated, "The dashboard was saved, but its alerts were not updated: %v", err)
+	}
+	return nil
 }
 
-func (dr *dashboardServiceImpl) SaveProvisionedDashboard(dto *SaveDashboardDTO, provisioning *models.DashboardProvisioning) (*models.Dashboard, error) {
-	dto.User = &models.SignedInUser{
+// provisioningDTO returns a copy of the dto saving as the provisioning admin, an org admin without user id. It
+// fails unless the service was created for provisioning, so the admin cannot be reached from other code paths.
+func (dr *dashboardServiceImpl) provisioningDTO(dto *SaveDashboardDTO) (*SaveDashboardDTO, error) {
+	if !dr.provisioning {
+		return nil, ErrProvisioningOnly
+	}
+
+	if dto.User != nil && (dto.User.UserId != 0 || dto.User.Login != "") {
+		caller := "unknown"
+		if _, file, line, ok := runtime.Caller(2); ok {
+			caller = fmt.Sprintf("%s:%d", file, line)
+		}
+		dr.log.Warn("Replacing the user of a provisioned save with the provisioning admin", "userId", dto.User.UserId, "login", dto.User.Login, "caller", caller)
+	}
+
+	provisioningDto := *dto
+	provisioningDto.User = &models.SignedInUser{
 		UserId:  0,
 		OrgRole: models.ROLE_ADMIN,
 		OrgId:   dto.OrgId,
 	}
+	provisioningDto.Source = models.DashboardSourceProvisioning
+	provisioningDto.RequestMeta = nil
+
+	return &provisioningDto, nil
+}
+
+func (dr *dashboardServiceImpl) SaveProvisionedDashboard(dto *SaveDashboardDTO, provisioning *models.DashboardProvisioning) (*models.Dashboard, error) {
+	if err := dashboardMaintenance.check(); err != nil {
+		return nil, err
+	}
 
-	cmd, err := dr.buildSaveDashboardCommand(dto, true, false)
+	dto, err := dr.provisioningDTO(dto)
 	if err != nil {
 		return nil, err
 	}
 
-	saveCmd := &models.SaveProvisionedDashboardCommand{
-		DashboardCmd:          cmd,
-		DashboardProvisioning: provisioning,
+	state := &saveState{dto: dto, validateAlerts: true, validateAdoption: true}
+	if err := runSavePipeline(savePipelineProvisioning, dr.provisioningStages(provisioning), state); err != nil {
+		return nil, saveStageCause(err)
 	}
 
-	// dashboard
-	err = bus.Dispatch(saveCmd)
-	if err != nil {
+	return state.cmd.Result, nil
+}
+
+func (dr *dashboardServiceImpl) SaveFolderForProvisionedDashboards(dto *SaveDashboardDTO) (*models.Dashboard, error) {
+	if err := dashboardMaintenance.check(); err != nil {
 		return nil, err
 	}
 
-	//alerts
-	err = dr.updateAlerting(cmd, dto)
+	dto, err := dr.provisioningDTO(dto)
 	if err != nil {
 		return nil, err
 	}
 
-	return cmd.Result, nil
+	state := &saveState{dto: dto}
+	if err := runSavePipeline(savePipelineProvisioningFolder, dr.provisioningFolderStages(), state); err != nil {
+		return nil, saveStageCause(err)
+	}
+
+	return state.cmd.Result, nil
 }
 
-func (dr *dashboardServiceImpl) SaveFolderForProvisionedDashboards(dto *SaveDashboardDTO) (*models.Dashboard, error) {
-	dto.User = &models.SignedInUser{
-		UserId:  0,
-		OrgRole: models.ROLE_ADMIN,
-	}
-	cmd, err := dr.buildSaveDashboardCommand(dto, false, false)
+func (dr *dashboardServiceImpl) SaveDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error) {
+	result, err := dr.SaveDashboardWithWarnings(dto)
 	if err != nil {
 		return nil, err
 	}
 
-	err = bus.Dispatch(cmd)
-	if err != nil {
+	return result.Dashboard, nil
+}
+
+// SaveDashboardWithWarnings saves the dashboard like SaveDashboard and also returns the issues
+// found by the soft validations, e.g. time settings in warn mode, so clients can show them.
+// Saves beyond the save rate limits of the user or organization fail with a DashboardSaveRateLimitError, and
+// saves during the read-only maintenance of dashboards with a DashboardsReadOnlyError.
+func (dr *dashboardServiceImpl) SaveDashboardWithWarnings(dto *SaveDashboardDTO) (*SaveDashboardResult, error) {
+	if err := dashboardMaintenance.check(); err != nil {
 		return nil, err
 	}
 
-	err = dr.updateAlerting(cmd, dto)
-	if err != nil {
+	if err := saveLimiter.allow(dto); err != nil {
 		return nil, err
 	}
 
-	return cmd.Result, nil
+	return dr.saveDashboardWithWarnings(dto)
 }
 
-func (dr *dashboardServiceImpl) SaveDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error) {
-	cmd, err := dr.buildSaveDashboardCommand(dto, true, true)
-	if err != nil {
+// saveDashboardWithWarnings saves the dashboard without the save rate limits, for the batch operations
+// saving many dashboards on a single request. The maintenance is checked for each save, so it stops the batch
+// operations running when it starts.
+func (dr *dashboardServiceImpl) saveDashboardWithWarnings(dto *SaveDashboardDTO) (*SaveDashboardResult, error) {
+	if err := dashboardMaintenance.check(); err != nil {
 		return nil, err
 	}
 
-	if dto.User.Token != "" {
-		newDashboard := dto.Dashboard
-		previousDashboard := getPreviousDashboard(newDashboard)
+	dto.warnings = make([]Warning, 0)
+
+	if dto.GitOverride != nil && !dto.User.HasRole(models.ROLE_EDITOR) {
+		return nil, models.ErrDashboardGitOverrideAccessDenied
+	}
+
+	state := &saveState{dto: dto, validateAlerts: true, validateProvisionedDashboard: true}
+	if err := runSavePipeline(savePipelineDashboard, dr.dashboardSaveStages(), state); err != nil {
+		return nil, saveStageCause(err)
+	}
 
-		var err error
+	result := &SaveDashboardResult{
+		Dashboard:     state.cmd.Result,
+		Warnings:      dto.warnings,
+		PrunedFolders: make([]*PrunedFolder, 0),
+		Transformers:  dto.transformers,
+		Synced:        state.syncResult != nil && state.syncResult.ConflictCommitSha == "",
+		SyncQueued:    len(state.queued) > 0,
+		SyncError:     state.syncErr,
+	}
 
-		// TODO: Refactor
-		if previousDashboard != nil {
-			if previousDashboard.FolderId != dto.Dashboard.FolderId {
-				err = updateDashboard(previousDashboard, social.DeleteDashboard, dto.User, "")
-				err = updateDashboard(newDashboard, social.CreateDashboard, dto.User, "")
-			} else {
-				err = updateDashboard(newDashboard, social.UpdateDashboard, dto.User, dto.Message)
-			}
-		} else {
-			err = updateDashboard(newDashboard, social.CreateDashboard, dto.User, "")
+	// the sync transformers ran if the dashboard was committed during the save, queued commits run them later
+	if state.syncResult != nil {
+		for _, name := range configuredTransformers(dto.OrgId, TransformOnSync) {
+			result.Transformers = append(result.Transformers, AppliedTransformer{Name: name, Stage: TransformOnSync})
 		}
+	}
+
+	if state.prunedFolders != nil {
+		result.PrunedFolders = state.prunedFolders
+	}
+
+	return result, nil
+}
 
+// TouchDashboard commits the stored dashboard and updates its alerts again, without saving a new version, e.g. to
+// re-push its file or reattach its alerts once their configuration is fixed. The user must be allowed to save
+// the dashboard, and provisioned dashboards are rejected like their saves.
+func (dr *dashboardServiceImpl) TouchDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) error {
+	if err := dashboardMaintenance.check(); err != nil {
+		return err
+	}
+
+	guard := guardian.New(dashboardId, orgId, user)
+	if canSave, err := guard.CanSave(); err != nil || !canSave {
 		if err != nil {
-			return nil, err
+			return err
 		}
+		return models.ErrDashboardUpdateAccessDenied
 	}
 
-	err = bus.Dispatch(cmd)
+	provisionedData, err := dr.GetProvisionedDashboardDataByDashboardId(dashboardId)
 	if err != nil {
-		return nil, err
+		return errutil.Wrap("failed to check if dashboard is provisioned", err)
 	}
 
-	err = dr.updateAlerting(cmd, dto)
-	if err != nil {
-		return nil, err
+	if provisionedData != nil {
+		return models.ErrDashboardCannotSaveProvisionedDashboard
 	}
 
-	return cmd.Result, nil
+	query := &models.GetDashboardQuery{Id: dashboardId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return err
+	}
+
+	dash := query.Result
+	dto := &SaveDashboardDTO{OrgId: orgId, User: user, Message: touchCommitMessage, Dashboard: dash}
+	state := &saveState{
+		dto:            dto,
+		cmd:            &models.SaveDashboardCommand{Result: dash},
+		previous:       dash,
+		previousLoaded: true,
+	}
+
+	if err := runSavePipeline(savePipelineTouch, dr.touchStages(), state); err != nil {
+		return saveStageCause(err)
+	}
+	return nil
 }
 
 // DeleteDashboard removes dashboard from the DB. Errors out if the dashboard was provisioned. Should be used for
 // operations by the user where we want to make sure user does not delete provisioned dashboard.
-func (dr *dashboardServiceImpl) DeleteDashboard(dashboardId int64, orgId int64) error {
-	return dr.deleteDashboard(dashboardId, orgId, true)
+// The folder of the dashboard is pruned if it is left empty.
+func (dr *dashboardServiceImpl) DeleteDashboard(dashboardId int64, orgId int64) (*DeleteDashboardResult, error) {
+	if err := dashboardMaintenance.check(); err != nil {
+		return nil, err
+	}
+
+	folderId := dashboardFolderId(dashboardId, orgId)
+
+	if err := dr.deleteDashboard(dashboardId, orgId, true); err != nil {
+		return nil, err
+	}
+
+	return &DeleteDashboardResult{PrunedFolders: dr.pruneEmptyFolder(folderId, orgId)}, nil
+}
+
+// DeleteDashboardIfVersion removes dashboard from the DB like DeleteDashboard, but only if expectedVersion is its
+// current version. Otherwise ErrDashboardVersionMismatch is returned, so a concurrent save is not lost.
+func (dr *dashboardServiceImpl) DeleteDashboardIfVersion(dashboardId int64, orgId int64, expectedVersion int64, user *models.SignedInUser) (*DeleteDashboardResult, error) {
+	if err := dashboardMaintenance.check(); err != nil {
+		return nil, err
+	}
+
+	if expectedVersion <= 0 {
+		return nil, models.ErrDashboardVersionMismatch
+	}
+
+	guard := guardian.New(dashboardId, orgId, user)
+	if canSave, err := guard.CanSave(); err != nil || !canSave {
+		if err != nil {
+			return nil, err
+		}
+		return nil, models.ErrDashboardUpdateAccessDenied
+	}
+
+	provisionedData, err := dr.GetProvisionedDashboardDataByDashboardId(dashboardId)
+	if err != nil {
+		return nil, errutil.Wrap("failed to check if dashboard is provisioned", err)
+	}
+
+	if provisionedData != nil {
+		return nil, models.ErrDashboardCannotDeleteProvisionedDashboard
+	}
+
+	folderId := dashboardFolderId(dashboardId, orgId)
+
+	cmd := &models.DeleteDashboardCommand{OrgId: orgId, Id: dashboardId, Version: int(expectedVersion)}
+	if err := bus.Dispatch(cmd); err != nil {
+		return nil, err
+	}
+
+	return &DeleteDashboardResult{PrunedFolders: dr.pruneEmptyFolder(folderId, orgId)}, nil
 }
 
 // DeleteProvisionedDashboard removes dashboard from the DB even if it is provisioned.
 func (dr *dashboardServiceImpl) DeleteProvisionedDashboard(dashboardId int64, orgId int64) error {
+	if err := dashboardMaintenance.check(); err != nil {
+		return err
+	}
+
 	return dr.deleteDashboard(dashboardId, orgId, false)
 }
 
@@ -322,35 +609,96 @@ func getPreviousDashboard(newDashboard *models.Dashboard) *models.Dashboard {
 	return oldDashboardQuery.Result
 }
 
-func getDashboardFolder(dashboard *models.Dashboard) string {
+// getDashboardFolder returns the title of the folder of the dashboard, or General for dashboards at the root.
+// The paths of the synced dashboard files are built from it. A folder that was deleted out from under the
+// dashboard is returned as a DashboardFolderNotFoundError.
+func getDashboardFolder(dashboard *models.Dashboard) (string, error) {
 	if dashboard.FolderId == 0 {
-		return "General"
+		return models.RootFolderName, nil
 	}
 
 	folderQuery := models.GetDashboardQuery{Id: dashboard.FolderId}
-	err := bus.Dispatch(&folderQuery)
-	if err != nil {
-		return "unknown"
+	if err := bus.Dispatch(&folderQuery); err != nil {
+		if err == models.ErrDashboardNotFound {
+			return "", models.DashboardFolderNotFoundError{FolderId: dashboard.FolderId}
+		}
+		return "", err
 	}
-	folderName := folderQuery.Result.Title
 
-	return folderName
+	return folderQuery.Result.Title, nil
 }
 
-func updateDashboard(dashboard *models.Dashboard, action social.DashboardAction,
-	user *models.SignedInUser, message string) error {
+// GetDashboardFolderPath returns the folder of the dashboard as used in the path of its synced file, e.g. to build
+// breadcrumbs. The user must be allowed to view the dashboard.
+func (dr *dashboardServiceImpl) GetDashboardFolderPath(dashboardId int64, orgId int64, user *models.SignedInUser) (string, error) {
+	guard := guardian.New(dashboardId, orgId, user)
+	if canView, err := guard.CanView(); err != nil || !canView {
+		if err != nil {
+			return "", err
+		}
+		return "", models.ErrDashboardViewAccessDenied
+	}
+
+	query := &models.GetDashboardQuery{Id: dashboardId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return "", err
+	}
+
+	return getDashboardFolder(query.Result)
+}
 
-	authModule := user.AuthModule
-	connect, _ := social.SocialMap[authModule]
+func (dr *dashboardServiceImpl) updateDashboard(dashboard *models.Dashboard, action social.DashboardAction,
+	dto *SaveDashboardDTO, message string) (*social.DashboardSyncResult, error) {
+
+	updateOptions, err := dr.dashboardUpdateOptions(dashboard, action, dto, message)
+	if err != nil || updateOptions == nil {
+		return nil, err
+	}
+
+	connect, _ := social.SocialMap[dto.User.AuthModule]
+	err = connect.UpdateDashboard(updateOptions, dto.User.Token)
+	return dr.dashboardUpdated(dashboard, dto, updateOptions, err)
+}
 
-	dashboardModel, err := json.MarshalIndent(dashboard.Data, "", "  ")
+// dashboardUpdateOptions returns the options of the commit of the dashboard change, or nil when the change is not
+// committed, e.g. for dashboards rendered from a source file or beyond the sync budget of the organization
+func (dr *dashboardServiceImpl) dashboardUpdateOptions(dashboard *models.Dashboard, action social.DashboardAction,
+	dto *SaveDashboardDTO, message string) (*social.UpdateDashboardOptions, error) {
+
+	user := dto.User
+	dashboardModel, err := syncedDashboardJson(dashboard)
 	if err != nil {
-		return err
+		dr.publishSyncResult(dashboard, dashboard.GitRepo(), err)
+		return nil, err
+	}
+
+	lastSync, err := lastGitSync(dashboard.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// dashboards rendered from a source, e.g. jsonnet, are only changed in their source
+	if lastSync != nil && lastSync.SourceFormat != "" {
+		if action == social.DeleteDashboard {
+			return nil, nil
+		}
+		dto.AddWarning(WarningRenderedSource, "The dashboard is rendered from a %s file of the repository, the change was not committed", lastSync.SourceFormat)
+		return nil, nil
 	}
 
-	folderName := getDashboardFolder(dashboard)
+	// the dashboard is saved, only its commit is skipped
+	if !gitSyncBudget.allow(dashboard.OrgId, dashboard.Id, len(dashboardModel)) {
+		dto.syncSkipped = true
+		dto.AddWarning(WarningSyncBudgetExceeded, "The daily budget of dashboard commits of the organization is exceeded, the dashboard was not committed")
+		return nil, nil
+	}
 
-	updateOptions := social.UpdateDashboardOptions{
+	folderName, err := getDashboardFolder(dashboard)
+	if err != nil {
+		return nil, err
+	}
+
+	updateOptions := &social.UpdateDashboardOptions{
 		Dashboard: string(dashboardModel),
 		Message:   message,
 		OrgId:     dashboard.OrgId,
@@ -358,37 +706,266 @@ func updateDashboard(dashboard *models.Dashboard, action social.DashboardAction,
 		Title:     dashboard.Title,
 		Folder:    folderName,
 		Name:      dashboard.Slug,
+		Uid:       dashboard.Uid,
+		Source:    string(dto.Source),
+		UserId:    user.UserId,
+		UserLogin: user.Login,
+		Repo:      dashboard.GitRepo(),
+		Coauthors: dto.Coauthors,
+		Author:    commitAuthor(user),
+
+		ExternalIdentity: dto.externalIdentity(),
+		LastSync:         lastSync,
 	}
 
-	err = connect.UpdateDashboard(&updateOptions, user.Token)
+	if dto.RequestMeta != nil {
+		updateOptions.RequestId = dto.RequestMeta.RequestId
+	}
 
-	return err
+	if override := dto.GitOverride; override != nil {
+		updateOptions.Branch = override.Branch
+		if override.RepoId > 0 {
+			updateOptions.Repo = strconv.Itoa(override.RepoId)
+		}
+	}
+
+	return updateOptions, nil
 }
 
-func (dr *dashboardServiceImpl) ImportDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error) {
-	cmd, err := dr.buildSaveDashboardCommand(dto, false, true)
-	if err != nil {
+// dashboardUpdated handles the result of the commit of the dashboard change, err is the error of the commit
+func (dr *dashboardServiceImpl) dashboardUpdated(dashboard *models.Dashboard, dto *SaveDashboardDTO, updateOptions *social.UpdateDashboardOptions, err error) (*social.DashboardSyncResult, error) {
+	lastSync := updateOptions.LastSync
+
+	// the dashboard is saved but drifts from its file, changed in the repository since the last sync
+	if result := updateOptions.Result; err == nil && result != nil && result.ConflictCommitSha != "" {
+		dto.AddWarning(WarningSyncConflict, "The dashboard file was changed in the repository by commit %s, the dashboard was saved without being committed", result.ConflictCommitSha)
+		if lastSync != nil {
+			result.CommitSha = lastSync.CommitSha
+			result.CommitMode = lastSync.CommitMode
+			result.ContentHash = lastSync.ContentHash
+		}
+		dr.publishSyncResult(dashboard, updateOptions.Repo, models.ErrDashboardGitConflict)
+		return result, nil
+	}
+
+	dr.publishSyncResult(dashboard, updateOptions.Repo, err)
+	if err == nil {
+		dr.recordMirrorResults(dashboard, dto, updateOptions.Result)
+	}
+
+	return updateOptions.Result, err
+}
+
+// lastGitSync returns the last commit of a dashboard, or nil for dashboards that were never synced
+func lastGitSync(dashboardId int64) (*models.DashboardGitSync, error) {
+	if dashboardId == 0 {
+		return nil, nil
+	}
+
+	query := &models.GetDashboardGitSyncQuery{DashboardId: dashboardId}
+	if err := bus.Dispatch(query); err != nil {
 		return nil, err
 	}
+	return query.Result, nil
+}
 
-	if dto.User.Token != "" {
-		newDashboard := dto.Dashboard
+// publishSyncResult tells listeners, e.g. the alerts to org admins, whether the commit of the dashboard failed.
+// Failures are also kept for the sync overview of the organization.
+func (dr *dashboardServiceImpl) publishSyncResult(dashboard *models.Dashboard, repo string, syncErr error) {
+	var msg bus.Msg = &events.DashboardSynced{
+		Timestamp:   dr.now(),
+		OrgId:       dashboard.OrgId,
+		Repo:        repo,
+		DashboardId: dashboard.Id,
+	}
 
-		err := updateDashboard(newDashboard, social.CreateDashboard, dto.User, dto.Message)
+	if syncErr != nil {
+		gitSyncFailures.record(dashboard.OrgId, &SyncFailure{
+			DashboardId: dashboard.Id,
+			Title:       dashboard.Title,
+			Repo:        repo,
+			Error:       syncErr.Error(),
+			Time:        dr.now(),
+		})
+
+		msg = &events.DashboardSyncFailed{
+			Timestamp:   dr.now(),
+			OrgId:       dashboard.OrgId,
+			Repo:        repo,
+			DashboardId: dashboard.Id,
+			Title:       dashboard.Title,
+			Error:       syncErr.Error(),
+		}
+	}
 
-		if err != nil {
-			return nil, err
+	if err := bus.Publish(msg); err != nil {
+		log.New("dashboard-service").Warn("Failed to publish dashboard sync result", "dashboardId", dashboard.Id, "error", err)
+	}
+}
+
+// externalIdentity returns the identity of the user at the git provider the dashboard is committed with, from the
+// session of the user when it has one. It is nil for users who never logged in with the provider.
+func (dto *SaveDashboardDTO) externalIdentity() *models.ExternalIdentity {
+	if dto.ExternalIdentity == nil && dto.User.ExternalIdentity != nil {
+		dto.ExternalIdentity = dto.User.ExternalIdentity
+	}
+
+	if dto.ExternalIdentity == nil && dto.User.UserId != 0 && dto.User.AuthModule != "" {
+		identity, err := login.GetExternalIdentity(dto.User.UserId, "oauth_"+dto.User.AuthModule)
+		if err != nil && err != models.ErrUserNotFound {
+			log.New("dashboard-service").Warn("Failed to get the external identity of the user", "userId", dto.User.UserId, "error", err)
 		}
-	} else {
-		return nil, models.ErrDashboardGitlabSync
+		dto.ExternalIdentity = identity
 	}
 
-	err = bus.Dispatch(cmd)
-	if err != nil {
+	return dto.ExternalIdentity
+}
+
+// commitAuthor returns the user to credit when a commit is not made with the identity of the user,
+// or nil for users without an email such as API keys
+func commitAuthor(user *models.SignedInUser) *models.GitCommitAuthor {
+	if user.Email == "" {
+		return nil
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+
+	return &models.GitCommitAuthor{Name: name, Email: user.Email}
+}
+
+// saveGitSync records the commit created for a saved dashboard so it can be shown in the dashboard meta
+func saveGitSync(dashboard *models.Dashboard, dto *SaveDashboardDTO, result *social.DashboardSyncResult) error {
+	if result == nil {
+		return nil
+	}
+
+	cmd := &models.SaveDashboardGitSyncCommand{
+		DashboardId: dashboard.Id,
+		OrgId:       dashboard.OrgId,
+		Provider:    dto.User.AuthModule,
+		RepoId:      result.RepoId,
+		FilePath:    result.FilePath,
+		CommitSha:   result.CommitSha,
+		CommitMode:  result.CommitMode,
+		Branch:      result.Branch,
+		RequestMeta: dto.RequestMeta,
+
+		FallbackAction:    result.FallbackAction,
+		ContentHash:       result.ContentHash,
+		ConflictCommitSha: result.ConflictCommitSha,
+	}
+
+	return bus.Dispatch(cmd)
+}
+
+// GetGitSyncMeta returns the git sync state of a dashboard, or nil if git sync is not configured for the organization.
+func (dr *dashboardServiceImpl) GetGitSyncMeta(dashboardId int64, orgId int64) (*models.DashboardGitSyncMeta, error) {
+	repo := social.GetSyncRepo(orgId)
+	if repo == nil {
+		return nil, nil
+	}
+
+	meta := &models.DashboardGitSyncMeta{
+		Enabled:    true,
+		Provider:   repo.Provider,
+		RepoWebUrl: repo.WebUrl,
+	}
+
+	query := &models.GetDashboardGitSyncQuery{DashboardId: dashboardId}
+	if err := bus.Dispatch(query); err != nil {
 		return nil, err
 	}
 
-	return cmd.Result, nil
+	if query.Result != nil {
+		meta.FilePath = query.Result.FilePath
+		meta.LastCommitSha = query.Result.CommitSha
+		meta.CommitMode = query.Result.CommitMode
+		meta.FallbackAction = query.Result.FallbackAction
+		meta.SourceFormat = query.Result.SourceFormat
+		meta.ConflictCommitSha = query.Result.ConflictCommitSha
+		meta.Drifted = query.Result.ConflictCommitSha != ""
+		meta.Branch = query.Result.Branch
+		meta.LastSyncTime = &query.Result.Updated
+	}
+
+	return meta, nil
+}
+
+func (dr *dashboardServiceImpl) ImportDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error) {
+	if err := dashboardMaintenance.check(); err != nil {
+		return nil, err
+	}
+
+	if err := saveLimiter.allow(dto); err != nil {
+		return nil, err
+	}
+
+	state := &saveState{dto: dto, validateProvisionedDashboard: true}
+	if err := runSavePipeline(savePipelineImport, dr.importStages(), state); err != nil {
+		return nil, saveStageCause(err)
+	}
+
+	return state.cmd.Result, nil
+}
+
+// setDefaultImportFolder moves dashboards imported to the General folder to the default import folder
+func (dr *dashboardServiceImpl) setDefaultImportFolder(dto *SaveDashboardDTO) error {
+	if dto.Dashboard.FolderId != 0 || dto.Dashboard.IsFolder {
+		return nil
+	}
+
+	folderId, err := dr.getDefaultImportFolderId(dto.OrgId)
+	if err != nil {
+		return err
+	}
+
+	dto.Dashboard.FolderId = folderId
+	return nil
+}
+
+// getDefaultImportFolderId returns the id of the folder configured as default_import_folder, looked up by uid
+// and then by title. Imports go to the General folder if it is not configured or does not exist.
+func (dr *dashboardServiceImpl) getDefaultImportFolderId(orgId int64) (int64, error) {
+	name := setting.DashboardDefaultImportFolder
+	if name == "" {
+		return 0, nil
+	}
+
+	query := models.GetDashboardQuery{OrgId: orgId, Uid: name}
+	err := bus.Dispatch(&query)
+	if err == nil && query.Result.IsFolder {
+		return query.Result.Id, nil
+	}
+	if err != nil && err != models.ErrDashboardNotFound {
+		return 0, err
+	}
+
+	folderId, err := getFolderIdByTitle(orgId, name)
+	if err != nil || folderId > 0 {
+		return folderId, err
+	}
+
+	dr.log.Warn("Default import folder not found, importing to General", "folder", name, "orgId", orgId)
+	return 0, nil
+}
+
+// getFolderIdByTitle returns the id of the folder with the title, compared case-insensitively, or 0 if there is none
+func getFolderIdByTitle(orgId int64, title string) (int64, error) {
+	slugQuery := models.GetDashboardsBySlugQuery{OrgId: orgId, Slug: models.SlugifyTitle(title)}
+	if err := bus.Dispatch(&slugQuery); err != nil {
+		return 0, err
+	}
+
+	for _, dash := range slugQuery.Result {
+		if dash.IsFolder && strings.EqualFold(dash.Title, title) {
+			return dash.Id, nil
+		}
+	}
+
+	return 0, nil
 }
 
 // UnprovisionDashboard removes info about dashboard being provisioned. Used after provisioning configs are changed
@@ -399,9 +976,11 @@ func (dr *dashboardServiceImpl) UnprovisionDashboard(dashboardId int64) error {
 }
 
 type FakeDashboardService struct {
-	SaveDashboardResult *models.Dashboard
-	SaveDashboardError  error
-	SavedDashboards     []*SaveDashboardDTO
+	SaveDashboardResult   *models.Dashboard
+	SaveDashboardError    error
+	SaveDashboardWarnings []Warning
+	SavedDashboards       []*SaveDashboardDTO
+	StaleDashboards       []*models.StaleDashboard
 }
 
 func (s *FakeDashboardService) SaveDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error) {
@@ -414,20 +993,177 @@ func (s *FakeDashboardService) SaveDashboard(dto *SaveDashboardDTO) (*models.Das
 	return s.SaveDashboardResult, s.SaveDashboardError
 }
 
+func (s *FakeDashboardService) SaveDashboardWithWarnings(dto *SaveDashboardDTO) (*SaveDashboardResult, error) {
+	dashboard, err := s.SaveDashboard(dto)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SaveDashboardResult{Dashboard: dashboard, Warnings: s.SaveDashboardWarnings}, nil
+}
+
+func (s *FakeDashboardService) BulkSaveDashboards(dtos []*SaveDashboardDTO) ([]*models.Dashboard, error) {
+	saved := make([]*models.Dashboard, 0, len(dtos))
+	for i, dto := range dtos {
+		dashboard, err := s.SaveDashboard(dto)
+		if err != nil {
+			return saved, newBulkSaveError(i, dto, err)
+		}
+		saved = append(saved, dashboard)
+	}
+
+	return saved, nil
+}
+
 func (s *FakeDashboardService) ImportDashboard(dto *SaveDashboardDTO) (*models.Dashboard, error) {
 	return s.SaveDashboard(dto)
 }
 
-func (s *FakeDashboardService) DeleteDashboard(dashboardId int64, orgId int64) error {
+func (s *FakeDashboardService) TouchDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) error {
+	return nil
+}
+
+func (s *FakeDashboardService) DeleteDashboard(dashboardId int64, orgId int64) (*DeleteDashboardResult, error) {
 	for index, dash := range s.SavedDashboards {
 		if dash.Dashboard.Id == dashboardId && dash.OrgId == orgId {
 			s.SavedDashboards = append(s.SavedDashboards[:index], s.SavedDashboards[index+1:]...)
 			break
 		}
 	}
+	return &DeleteDashboardResult{}, nil
+}
+
+func (s *FakeDashboardService) DeleteDashboardIfVersion(dashboardId int64, orgId int64, expectedVersion int64, user *models.SignedInUser) (*DeleteDashboardResult, error) {
+	return s.DeleteDashboard(dashboardId, orgId)
+}
+
+func (s *FakeDashboardService) PrepareDeleteDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) (*DeleteConfirmation, error) {
+	return &DeleteConfirmation{DashboardId: dashboardId}, nil
+}
+
+func (s *FakeDashboardService) DeleteDashboardWithToken(dashboardId int64, orgId int64, token string, user *models.SignedInUser) (*DeleteDashboardResult, error) {
+	return s.DeleteDashboard(dashboardId, orgId)
+}
+
+func (s *FakeDashboardService) CloneFolder(sourceFolderId int64, orgId int64, newFolderTitle string, user *models.SignedInUser) (*CloneResult, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) GetGitSyncMeta(dashboardId int64, orgId int64) (*models.DashboardGitSyncMeta, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) GetDashboardFolderPath(dashboardId int64, orgId int64, user *models.SignedInUser) (string, error) {
+	return models.RootFolderName, nil
+}
+
+func (s *FakeDashboardService) RenderDashboardAtCommit(orgId int64, uid string, ref string, user *models.SignedInUser) (*DashboardAtCommit, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) UpdateDashboardPermissions(cmd *models.UpdateDashboardAclCommand, orgId int64, user *models.SignedInUser) error {
+	return bus.Dispatch(cmd)
+}
+
+func (s *FakeDashboardService) SetSyncPaused(paused bool) (*GitSyncStatus, error) {
+	return &GitSyncStatus{Paused: paused}, nil
+}
+
+func (s *FakeDashboardService) GetSyncStatus() *GitSyncStatus {
+	return &GitSyncStatus{}
+}
+
+func (s *FakeDashboardService) GetQueuedSyncCommits(orgId int64, statuses []models.DashboardSyncOutboxStatus) ([]*QueuedSyncCommit, error) {
+	return []*QueuedSyncCommit{}, nil
+}
+
+func (s *FakeDashboardService) RequeueSyncCommits(ids []int64) (int64, error) {
+	return 0, nil
+}
+
+func (s *FakeDashboardService) PurgeSyncCommits(ids []int64) (int64, error) {
+	return 0, nil
+}
+
+func (s *FakeDashboardService) MigrateRepoLayout(orgId int64, dryRun bool) (*RepoLayoutMigration, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) ImportGitOnlyDashboards(orgId int64, user *models.SignedInUser, opts ImportGitOnlyOptions) (*ImportReport, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) RepairOrphanedDashboards(orgId int64, user *models.SignedInUser, opts OrphanRepairOptions) (*OrphanRepairReport, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) VerifyRepoConsistency(orgId int64, opts VerifyRepoOptions) (*RepoConsistencyReport, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) GetProviderSyncReport(name string) (*ProviderSyncReport, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) GetSyncBudget(orgId int64) *SyncBudgetStatus {
+	return &SyncBudgetStatus{Skipped: make([]int64, 0)}
+}
+
+func (s *FakeDashboardService) GetSyncOverview(orgId int64) (*SyncOverview, error) {
+	return &SyncOverview{OrgId: orgId, Repos: make([]*RepoSyncOverview, 0), RecentFailures: make([]*SyncFailure, 0)}, nil
+}
+
+func (s *FakeDashboardService) PromoteRepoMirror(orgId int64, mirror string) (*social.SyncRepo, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) FindDashboardsByRepoPath(orgId int64, repoId int, filePath string) ([]*RepoPathDashboard, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) ExportOrgDashboards(orgId int64, opts ExportBundleOptions, w io.Writer) error {
 	return nil
 }
 
+func (s *FakeDashboardService) ImportOrgDashboards(orgId int64, user *models.SignedInUser, bundle io.Reader, opts ImportBundleOptions) (*BundleImportReport, error) {
+	return nil, nil
+}
+
+func (s *FakeDashboardService) StartJob(kind string, orgId int64, params interface{}, user *models.SignedInUser) (int64, error) {
+	return 1, nil
+}
+
+func (s *FakeDashboardService) GetJob(id int64) (*Job, error) {
+	return nil, models.ErrDashboardJobNotFound
+}
+
+func (s *FakeDashboardService) CancelJob(id int64) (*Job, error) {
+	return nil, models.ErrDashboardJobNotFound
+}
+
+func (s *FakeDashboardService) GetStaleDashboards(orgId int64, olderThan time.Duration, excludeTags []string) ([]*models.StaleDashboard, error) {
+	if s.StaleDashboards == nil {
+		return make([]*models.StaleDashboard, 0), nil
+	}
+	return s.StaleDashboards, nil
+}
+
+func (s *FakeDashboardService) ArchiveDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) (*models.Dashboard, error) {
+	return &models.Dashboard{Id: dashboardId, OrgId: orgId}, nil
+}
+
+func (s *FakeDashboardService) ArchiveDashboardWithToken(dashboardId int64, orgId int64, token string, user *models.SignedInUser) (*models.Dashboard, error) {
+	return s.ArchiveDashboard(dashboardId, orgId, user)
+}
+
+func (s *FakeDashboardService) GetMaintenance() (*MaintenanceStatus, error) {
+	return &MaintenanceStatus{}, nil
+}
+
+func (s *FakeDashboardService) SetMaintenance(opts MaintenanceOptions, user *models.SignedInUser) (*MaintenanceStatus, error) {
+	return nil, nil
+}
+
 func MockDashboardService(mock *FakeDashboardService) {
 	NewService = func() DashboardService {
 		return mock
@@ -0,0 +1,168 @@
+package dashboards
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardServiceFlows(t *testing.T) {
+	Convey("Given the dashboard service on an in-memory store", t, func() {
+		bus.ClearBusHandlers()
+
+		store := NewFakeDashboardStore()
+		store.Register()
+
+		service := NewServiceWithDeps(realClock{}, shortUIDGenerator{})
+		provisioningService := NewProvisioningServiceWithDeps(realClock{}, shortUIDGenerator{})
+
+		editor := &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+		newDashboard := func(title string) *models.Dashboard {
+			dash := models.NewDashboard(title)
+			dash.OrgId = 1
+			return dash
+		}
+		save := func(dash *models.Dashboard, overwrite bool) (*models.Dashboard, error) {
+			return service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: editor, Dashboard: dash, Overwrite: overwrite})
+		}
+
+		Convey("Should create a dashboard and bump its version on each save", func() {
+			created, err := save(newDashboard("CPU"), false)
+			So(err, ShouldBeNil)
+			So(created.Id, ShouldBeGreaterThan, 0)
+			So(created.Uid, ShouldNotBeEmpty)
+			So(created.Version, ShouldEqual, 1)
+			So(store.UpdatedAlerts, ShouldResemble, []int64{created.Id})
+
+			query := &models.GetDashboardQuery{OrgId: 1, Uid: created.Uid}
+			So(bus.Dispatch(query), ShouldBeNil)
+			So(query.Result.Title, ShouldEqual, "CPU")
+
+			dash := store.Dashboard(created.Id)
+			dash.Data.Set("tags", []string{"infra"})
+			updated, err := save(dash, false)
+			So(err, ShouldBeNil)
+			So(updated.Id, ShouldEqual, created.Id)
+			So(updated.Version, ShouldEqual, 2)
+			So(store.Dashboard(created.Id).Data.Get("tags").MustStringArray(), ShouldResemble, []string{"infra"})
+
+			_, err = save(newDashboard("CPU"), false)
+			So(err, ShouldEqual, models.ErrDashboardWithSameNameInFolderExists)
+		})
+
+		Convey("When two users save the same version of a dashboard", func() {
+			stored := store.AddDashboard(1, 0, "Memory")
+			first := store.Dashboard(stored.Id)
+			second := store.Dashboard(stored.Id)
+
+			first.Data.Set("refresh", "1m")
+			_, err := save(first, false)
+			So(err, ShouldBeNil)
+
+			Convey("Should return the conflict with the version saved first", func() {
+				second.Data.Set("refresh", "5m")
+				_, err := save(second, false)
+
+				conflict, ok := err.(models.DashboardVersionConflictError)
+				So(ok, ShouldBeTrue)
+				So(conflict.CurrentVersion, ShouldEqual, 2)
+				So(store.Dashboard(stored.Id).Data.Get("refresh").MustString(), ShouldEqual, "1m")
+			})
+
+			Convey("Should save over it with overwrite", func() {
+				second.Data.Set("refresh", "5m")
+				saved, err := save(second, true)
+				So(err, ShouldBeNil)
+				So(saved.Version, ShouldEqual, 3)
+				So(store.Dashboard(stored.Id).Data.Get("refresh").MustString(), ShouldEqual, "5m")
+			})
+		})
+
+		Convey("When an editor moves a dashboard to a folder", func() {
+			open := store.AddFolder(1, "Open")
+			restricted := store.AddFolder(1, "Restricted")
+			viewer := models.ROLE_VIEWER
+			store.SetAcl(restricted.Id, &models.DashboardAclInfoDTO{OrgId: 1, Role: &viewer, Permission: models.PERMISSION_VIEW})
+
+			stored := store.AddDashboard(1, 0, "Disk")
+
+			Convey("Should deny the move to a folder the editor cannot save to", func() {
+				dash := store.Dashboard(stored.Id)
+				dash.FolderId = restricted.Id
+
+				_, err := save(dash, false)
+				So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
+				So(store.Dashboard(stored.Id).FolderId, ShouldEqual, 0)
+				So(store.Dashboard(stored.Id).Version, ShouldEqual, 1)
+			})
+
+			Convey("Should move it to a folder with the default permissions", func() {
+				dash := store.Dashboard(stored.Id)
+				dash.FolderId = open.Id
+
+				moved, err := save(dash, false)
+				So(err, ShouldBeNil)
+				So(moved.FolderId, ShouldEqual, open.Id)
+				So(store.Dashboard(stored.Id).FolderId, ShouldEqual, open.Id)
+			})
+		})
+
+		Convey("Given a provisioned dashboard", func() {
+			stored := store.AddDashboard(1, 0, "Network")
+			store.Provision(stored.Id, &models.DashboardProvisioning{Name: "default", ExternalId: "network.json"})
+
+			Convey("Should not let users save it", func() {
+				_, err := save(store.Dashboard(stored.Id), false)
+				So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleProvisionedConflict, Err: models.ErrDashboardCannotSaveProvisionedDashboard})
+			})
+
+			Convey("Should let the provisioning save it", func() {
+				dash := store.Dashboard(stored.Id)
+				dash.Data.Set("refresh", "1m")
+
+				saved, err := provisioningService.SaveProvisionedDashboard(&SaveDashboardDTO{OrgId: 1, Dashboard: dash},
+					&models.DashboardProvisioning{Name: "default", ExternalId: "network.json", CheckSum: "abc"})
+				So(err, ShouldBeNil)
+				So(saved.Version, ShouldEqual, 2)
+				So(store.Provisioning(stored.Id).CheckSum, ShouldEqual, "abc")
+			})
+
+			Convey("Should not let the provisioning take over a dashboard made by hand", func() {
+				manual := store.AddDashboard(1, 0, "Manual")
+				dash := newDashboard("Manual from file")
+				dash.SetUid(manual.Uid)
+
+				_, err := provisioningService.SaveProvisionedDashboard(&SaveDashboardDTO{OrgId: 1, Dashboard: dash},
+					&models.DashboardProvisioning{Name: "default", ExternalId: "manual.json"})
+				So(err, ShouldResemble, models.DashboardAdoptionError{DashboardId: manual.Id, Uid: manual.Uid, Title: "Manual"})
+				So(store.Provisioning(manual.Id), ShouldBeNil)
+			})
+
+			Convey("Should not let users delete it", func() {
+				_, err := service.DeleteDashboard(stored.Id, 1)
+				So(err, ShouldEqual, models.ErrDashboardCannotDeleteProvisionedDashboard)
+				So(store.Dashboard(stored.Id), ShouldNotBeNil)
+			})
+
+			Convey("Should let the provisioning delete it", func() {
+				So(provisioningService.DeleteProvisionedDashboard(stored.Id, 1), ShouldBeNil)
+				So(store.Dashboard(stored.Id), ShouldBeNil)
+				So(store.Provisioning(stored.Id), ShouldBeNil)
+			})
+
+			Convey("Should let users delete it once it is unprovisioned", func() {
+				So(provisioningService.UnprovisionDashboard(stored.Id), ShouldBeNil)
+
+				_, err := service.DeleteDashboard(stored.Id, 1)
+				So(err, ShouldBeNil)
+				So(store.Dashboard(stored.Id), ShouldBeNil)
+			})
+		})
+
+		Reset(func() {
+			bus.ClearBusHandlers()
+		})
+	})
+}
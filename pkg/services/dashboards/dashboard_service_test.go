@@ -1,11 +1,17 @@
 package dashboards
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
 	. "github.com/smartystreets/goconvey/convey"
 	"golang.org/x/xerrors"
 )
@@ -23,15 +29,40 @@ func TestDashboardService(t *testing.T) {
 			dto := &SaveDashboardDTO{}
 
 			Convey("When saving a dashboard with empty title it should return error", func() {
-				titles := []string{"", " ", "   \t   "}
+				dto.Dashboard = models.NewDashboard("")
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldEqual, models.ErrDashboardTitleEmpty)
+			})
+
+			Convey("When saving a dashboard with a title of only whitespace it should return error", func() {
+				titles := []string{" ", "   \t   "}
 
 				for _, title := range titles {
 					dto.Dashboard = models.NewDashboard(title)
 					_, err := service.SaveDashboard(dto)
-					So(err, ShouldEqual, models.ErrDashboardTitleEmpty)
+					So(err, ShouldEqual, models.ErrDashboardTitleWhitespace)
 				}
 			})
 
+			Convey("When saving a title of only whitespace with the untitled policy", func() {
+				origPolicy := setting.DashboardWhitespaceTitlePolicy
+				setting.DashboardWhitespaceTitlePolicy = "untitled"
+				defer func() { setting.DashboardWhitespaceTitlePolicy = origPolicy }()
+
+				Convey("Should name dashboards Untitled dashboard", func() {
+					dash := models.NewDashboard("  ")
+					So(untitleWhitespaceTitle(dash), ShouldBeNil)
+					So(dash.Title, ShouldEqual, "Untitled dashboard")
+					So(dash.Slug, ShouldEqual, "untitled-dashboard")
+				})
+
+				Convey("Should still reject folders", func() {
+					dto.Dashboard = models.NewDashboardFolder("  ")
+					_, err := service.SaveDashboard(dto)
+					So(err, ShouldEqual, models.ErrDashboardTitleWhitespace)
+				})
+			})
+
 			Convey("Should return validation error if it's a folder and have a folder id", func() {
 				dto.Dashboard = models.NewDashboardFolder("Folder")
 				dto.Dashboard.FolderId = 1
@@ -45,6 +76,17 @@ func TestDashboardService(t *testing.T) {
 				So(err, ShouldEqual, models.ErrDashboardFolderNameExists)
 			})
 
+			Convey("Should return validation error if the uid has a reserved prefix", func() {
+				origPrefixes := setting.DashboardReservedUidPrefixes
+				setting.DashboardReservedUidPrefixes = []string{"sys-"}
+				defer func() { setting.DashboardReservedUidPrefixes = origPrefixes }()
+
+				dto.Dashboard = models.NewDashboard("Dash")
+				dto.Dashboard.SetUid("sys-dash")
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldEqual, models.ErrDashboardUidReserved)
+			})
+
 			Convey("When saving a dashboard should validate uid", func() {
 				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
 					return nil
@@ -55,8 +97,8 @@ func TestDashboardService(t *testing.T) {
 					return nil
 				})
 
-				bus.AddHandler("test", func(cmd *models.GetProvisionedDashboardDataByIdQuery) error {
-					cmd.Result = nil
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{}
 					return nil
 				})
 
@@ -83,11 +125,126 @@ func TestDashboardService(t *testing.T) {
 				}
 			})
 
+			Convey("Should not give a dashboard the uid of a folder, or a folder the uid of a dashboard", func() {
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+					return nil
+				})
+
+				rows := map[string]*models.Dashboard{
+					"team":    {Id: 3, Uid: "team", IsFolder: true},
+					"service": {Id: 5, Uid: "service"},
+				}
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{ExistingByUid: rows[query.Uid]}
+					return nil
+				})
+
+				testCases := []struct {
+					Id       int64
+					Uid      string
+					IsFolder bool
+					Error    error
+				}{
+					{Id: 0, Uid: "team", Error: models.ErrDashboardUidUsedByFolder},
+					{Id: 5, Uid: "team", Error: models.ErrDashboardUidUsedByFolder},
+					{Id: 0, Uid: "service", IsFolder: true, Error: models.ErrFolderUidUsedByDashboard},
+					{Id: 3, Uid: "service", IsFolder: true, Error: models.ErrFolderUidUsedByDashboard},
+					{Id: 5, Uid: "service", Error: nil},
+					{Id: 3, Uid: "team", IsFolder: true, Error: nil},
+					{Id: 0, Uid: "other", Error: nil},
+				}
+
+				for _, tc := range testCases {
+					dto.Dashboard = models.NewDashboard("Dash")
+					dto.Dashboard.SetId(tc.Id)
+					dto.Dashboard.SetUid(tc.Uid)
+					dto.Dashboard.IsFolder = tc.IsFolder
+					dto.User = &models.SignedInUser{UserId: 1}
+
+					_, err := service.buildSaveDashboardCommand(dto, true, false)
+					So(err, ShouldEqual, tc.Error)
+				}
+			})
+
+			Convey("Should pass dashboard source to the save command", func() {
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+					return nil
+				})
+
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{}
+					return nil
+				})
+
+				sources := []models.DashboardSource{
+					models.DashboardSourceUI,
+					models.DashboardSourceAPI,
+					models.DashboardSourceRestore,
+					models.DashboardSourceImport,
+				}
+
+				for _, source := range sources {
+					dto.Dashboard = models.NewDashboard("Dash")
+					dto.User = &models.SignedInUser{UserId: 1}
+					dto.Source = source
+
+					cmd, err := service.buildSaveDashboardCommand(dto, true, true)
+					So(err, ShouldBeNil)
+					So(cmd.Source, ShouldEqual, source)
+				}
+			})
+
+			Convey("Should report alert extraction progress through the save progress hook", func() {
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+					return nil
+				})
+
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{}
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+					cmd.Result = cmd.GetDashboardModel()
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+					cmd.Progress(1, 2)
+					cmd.Progress(2, 2)
+					return nil
+				})
+
+				steps := []string{}
+				dto.Dashboard = models.NewDashboard("Dash")
+				dto.User = &models.SignedInUser{UserId: 1}
+				dto.Progress = func(step string, done int, total int) {
+					steps = append(steps, fmt.Sprintf("%s %d/%d", step, done, total))
+				}
+
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []string{"alerts 1/2", "alerts 2/2"})
+			})
+
 			Convey("Should return validation error if dashboard is provisioned", func() {
-				provisioningValidated := false
-				bus.AddHandler("test", func(cmd *models.GetProvisionedDashboardDataByIdQuery) error {
-					provisioningValidated = true
-					cmd.Result = &models.DashboardProvisioning{}
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{Provisioning: &models.DashboardProvisioning{}}
 					return nil
 				})
 
@@ -104,13 +261,12 @@ func TestDashboardService(t *testing.T) {
 				dto.Dashboard.SetId(3)
 				dto.User = &models.SignedInUser{UserId: 1}
 				_, err := service.SaveDashboard(dto)
-				So(provisioningValidated, ShouldBeTrue)
-				So(err, ShouldEqual, models.ErrDashboardCannotSaveProvisionedDashboard)
+				So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleProvisionedConflict, Err: models.ErrDashboardCannotSaveProvisionedDashboard})
 			})
 
 			Convey("Should return validation error if alert data is invalid", func() {
-				bus.AddHandler("test", func(cmd *models.GetProvisionedDashboardDataByIdQuery) error {
-					cmd.Result = nil
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{}
 					return nil
 				})
 
@@ -121,17 +277,191 @@ func TestDashboardService(t *testing.T) {
 				dto.Dashboard = models.NewDashboard("Dash")
 				_, err := service.SaveDashboard(dto)
 				So(err.Error(), ShouldEqual, "Alert validation error")
+
+				var ruleErr models.DashboardSaveRuleError
+				So(xerrors.As(err, &ruleErr), ShouldBeTrue)
+				So(ruleErr.Rule, ShouldEqual, models.DashboardSaveRuleAlertValidation)
+			})
+
+			Convey("Should name the folder permission rule when a move to a folder is denied", func() {
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					cmd.Result = &models.ValidateDashboardBeforeSaveResult{IsParentFolderChanged: true}
+					return nil
+				})
+
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = snapshotWithFolder(query)
+					return nil
+				})
+
+				guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: false})
+
+				dto.Dashboard = models.NewDashboard("Dash")
+				dto.Dashboard.SetId(3)
+				dto.Dashboard.FolderId = 2
+				_, err := service.SaveDashboard(dto)
+				So(xerrors.Is(err, models.ErrDashboardUpdateAccessDenied), ShouldBeTrue)
+
+				var ruleErr models.DashboardSaveRuleError
+				So(xerrors.As(err, &ruleErr), ShouldBeTrue)
+				So(ruleErr.Rule, ShouldEqual, models.DashboardSaveRuleFolderMovePermission)
+			})
+
+			Convey("Should name the stale folder when the folder of the dashboard was deleted", func() {
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				validated := false
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					validated = true
+					return nil
+				})
+
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{}
+					return nil
+				})
+
+				dto.Dashboard = models.NewDashboard("Dash")
+				dto.Dashboard.SetId(3)
+				dto.Dashboard.FolderId = 9
+				dto.User = &models.SignedInUser{UserId: 1}
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldResemble, models.DashboardFolderNotFoundError{FolderId: 9})
+				So(err.Error(), ShouldContainSubstring, "9")
+				So(xerrors.Is(err, models.ErrDashboardFolderNotFound), ShouldBeTrue)
+				So(validated, ShouldBeFalse)
+
+				_, err = service.buildSaveDashboardCommand(dto, false, true)
+				So(err, ShouldResemble, models.DashboardFolderNotFoundError{FolderId: 9})
+			})
+
+			Convey("When moving a dashboard with alerts to another folder", func() {
+				origCheck := setting.AlertingFolderMoveNotificationCheck
+
+				var violations []*models.AlertNotificationViolation
+				var targetFolders []*models.Dashboard
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+					if cmd.TargetFolder != nil {
+						targetFolders = append(targetFolders, cmd.TargetFolder)
+						cmd.Result = violations
+					}
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					cmd.Result = &models.ValidateDashboardBeforeSaveResult{IsParentFolderChanged: true}
+					return nil
+				})
+
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{}
+					if query.FolderId > 0 {
+						query.Result.Folder = &models.Dashboard{Id: query.FolderId, OrgId: query.OrgId, Title: "Team B", IsFolder: true}
+					}
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+					cmd.Result = cmd.GetDashboardModel()
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				dto.OrgId = 1
+				dto.User = &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+				dto.Dashboard = models.NewDashboard("Dash")
+				dto.Dashboard.SetId(3)
+				dto.Dashboard.FolderId = 2
+
+				denied := []*models.AlertNotificationViolation{
+					{AlertName: "High latency", PanelId: 1, NotificationUid: "team-a-pager", NotificationName: "Team A pager"},
+				}
+
+				Convey("Should revalidate the alerts in the context of the target folder", func() {
+					result, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(result.Warnings, ShouldBeEmpty)
+					So(targetFolders, ShouldHaveLength, 1)
+					So(targetFolders[0].Id, ShouldEqual, 2)
+					So(targetFolders[0].Title, ShouldEqual, "Team B")
+				})
+
+				Convey("Should use the General folder when moving to the root", func() {
+					dto.Dashboard.FolderId = 0
+
+					_, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(targetFolders[0].Id, ShouldEqual, 0)
+					So(targetFolders[0].Title, ShouldEqual, models.RootFolderName)
+				})
+
+				Convey("Should warn about notification channels the user cannot use from the folder", func() {
+					violations = denied
+
+					result, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(result.Warnings, ShouldResemble, []Warning{{
+						Code:    WarningAlertNotificationDenied,
+						Message: "Alert High latency notifies Team A pager, which cannot be used from folder Team B",
+					}})
+				})
+
+				Convey("Should warn when the alerts of the saved dashboard time out", func() {
+					bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+						return models.ErrAlertExtractionTimeout
+					})
+
+					result, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(result.Warnings, ShouldResemble, []Warning{{
+						Code:    WarningAlertsNotUpdated,
+						Message: "The dashboard was saved, but its alerts were not updated: " + models.ErrAlertExtractionTimeout.Error(),
+					}})
+				})
+
+				Convey("Should reject the move under the strict check", func() {
+					setting.AlertingFolderMoveNotificationCheck = setting.FolderMoveNotificationCheckStrict
+					violations = denied
+
+					_, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldResemble, models.DashboardSaveRuleError{
+						Rule: models.DashboardSaveRuleFolderMoveNotifications,
+						Err:  models.AlertNotificationsDeniedError{Folder: "Team B", Violations: denied},
+					})
+				})
+
+				Convey("Should not revalidate the alerts when the check is off", func() {
+					setting.AlertingFolderMoveNotificationCheck = setting.FolderMoveNotificationCheckOff
+					violations = denied
+
+					result, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(result.Warnings, ShouldBeEmpty)
+					So(targetFolders, ShouldBeEmpty)
+				})
+
+				Reset(func() {
+					setting.AlertingFolderMoveNotificationCheck = origCheck
+				})
 			})
 		})
 
 		Convey("Save provisioned dashboard validation", func() {
 			dto := &SaveDashboardDTO{}
+			provisioningService := &dashboardServiceImpl{log: log.New("test"), provisioning: true}
 
 			Convey("Should not return validation error if dashboard is provisioned", func() {
-				provisioningValidated := false
-				bus.AddHandler("test", func(cmd *models.GetProvisionedDashboardDataByIdQuery) error {
-					provisioningValidated = true
-					cmd.Result = &models.DashboardProvisioning{}
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{Provisioning: &models.DashboardProvisioning{}}
 					return nil
 				})
 
@@ -144,7 +474,13 @@ func TestDashboardService(t *testing.T) {
 					return nil
 				})
 
+				var savedSource models.DashboardSource
+				var savedRequestMeta *models.RequestMeta
+				var savedUserId int64 = -1
 				bus.AddHandler("test", func(cmd *models.SaveProvisionedDashboardCommand) error {
+					savedSource = cmd.DashboardCmd.Source
+					savedRequestMeta = cmd.DashboardCmd.RequestMeta
+					savedUserId = cmd.DashboardCmd.UserId
 					return nil
 				})
 
@@ -155,9 +491,130 @@ func TestDashboardService(t *testing.T) {
 				dto.Dashboard = models.NewDashboard("Dash")
 				dto.Dashboard.SetId(3)
 				dto.User = &models.SignedInUser{UserId: 1}
+				dto.Source = models.DashboardSourceUI
+				dto.RequestMeta = &models.RequestMeta{ClientIp: "192.168.1.10"}
+				_, err := provisioningService.SaveProvisionedDashboard(dto, nil)
+				So(err, ShouldBeNil)
+				So(savedSource, ShouldEqual, models.DashboardSourceProvisioning)
+				So(savedRequestMeta, ShouldBeNil)
+				So(savedUserId, ShouldEqual, 0)
+
+				// the dto of the caller is left as it was
+				So(dto.User, ShouldResemble, &models.SignedInUser{UserId: 1})
+				So(dto.Source, ShouldEqual, models.DashboardSourceUI)
+				So(dto.RequestMeta, ShouldResemble, &models.RequestMeta{ClientIp: "192.168.1.10"})
+			})
+
+			Convey("When the uid of the provisioned dashboard is used", func() {
+				snapshot := &models.DashboardSaveSnapshot{}
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = snapshot
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+					return nil
+				})
+
+				saved := false
+				bus.AddHandler("test", func(cmd *models.SaveProvisionedDashboardCommand) error {
+					saved = true
+					cmd.Result = cmd.DashboardCmd.GetDashboardModel()
+					cmd.DashboardCmd.Result = cmd.Result
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				dto.Dashboard = models.NewDashboard("Provisioned")
+				dto.Dashboard.SetUid("shared")
+				provisioning := &models.DashboardProvisioning{Name: "default", ExternalId: "/dashboards/provisioned.json"}
+
+				Convey("Should save dashboards with a new uid", func() {
+					_, err := provisioningService.SaveProvisionedDashboard(dto, provisioning)
+					So(err, ShouldBeNil)
+					So(saved, ShouldBeTrue)
+				})
+
+				Convey("Should save over provisioned dashboards", func() {
+					snapshot.ExistingByUid = &models.Dashboard{Id: 7, Uid: "shared", Title: "Other provisioned"}
+					snapshot.ExistingByUidProvisioned = true
+
+					_, err := provisioningService.SaveProvisionedDashboard(dto, provisioning)
+					So(err, ShouldBeNil)
+					So(saved, ShouldBeTrue)
+				})
+
+				Convey("Should refuse to adopt dashboards that are not provisioned, naming them", func() {
+					snapshot.ExistingByUid = &models.Dashboard{Id: 7, Uid: "shared", Title: "Made by hand"}
+
+					_, err := provisioningService.SaveProvisionedDashboard(dto, provisioning)
+					So(err, ShouldResemble, models.DashboardAdoptionError{DashboardId: 7, Uid: "shared", Title: "Made by hand"})
+					So(err.Error(), ShouldContainSubstring, "Made by hand")
+					So(saved, ShouldBeFalse)
+				})
+
+				Convey("Should adopt dashboards that are not provisioned when allowed", func() {
+					snapshot.ExistingByUid = &models.Dashboard{Id: 7, Uid: "shared", Title: "Made by hand"}
+					dto.AllowAdoption = true
+
+					_, err := provisioningService.SaveProvisionedDashboard(dto, provisioning)
+					So(err, ShouldBeNil)
+					So(saved, ShouldBeTrue)
+				})
+			})
+
+			Convey("Should only save as the provisioning admin from provisioning", func() {
+				dto.Dashboard = models.NewDashboard("Dash")
+				dto.User = &models.SignedInUser{UserId: 1, OrgRole: models.ROLE_VIEWER}
+
 				_, err := service.SaveProvisionedDashboard(dto, nil)
+				So(err, ShouldEqual, ErrProvisioningOnly)
+
+				_, err = NewService().(DashboardProvisioningService).SaveFolderForProvisionedDashboards(dto)
+				So(err, ShouldEqual, ErrProvisioningOnly)
+				So(dto.User.OrgRole, ShouldEqual, models.ROLE_VIEWER)
+			})
+
+			Convey("Should save provisioning folders without changing the dto of the caller", func() {
+				bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+					cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+					return nil
+				})
+
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{}
+					return nil
+				})
+
+				var savedCmd *models.SaveDashboardCommand
+				bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+					savedCmd = cmd
+					cmd.Result = cmd.GetDashboardModel()
+					return nil
+				})
+
+				bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+					return nil
+				})
+
+				dto.Dashboard = models.NewDashboardFolder("Provisioned")
+				dto.OrgId = 2
+
+				_, err := provisioningService.SaveFolderForProvisionedDashboards(dto)
 				So(err, ShouldBeNil)
-				So(provisioningValidated, ShouldBeFalse)
+				So(savedCmd.UserId, ShouldEqual, 0)
+				So(savedCmd.OrgId, ShouldEqual, 2)
+				So(savedCmd.Source, ShouldEqual, models.DashboardSourceProvisioning)
+				So(dto.User, ShouldBeNil)
+				So(dto.Source, ShouldBeEmpty)
 			})
 		})
 
@@ -165,10 +622,8 @@ func TestDashboardService(t *testing.T) {
 			dto := &SaveDashboardDTO{}
 
 			Convey("Should return validation error if dashboard is provisioned", func() {
-				provisioningValidated := false
-				bus.AddHandler("test", func(cmd *models.GetProvisionedDashboardDataByIdQuery) error {
-					provisioningValidated = true
-					cmd.Result = &models.DashboardProvisioning{}
+				bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+					query.Result = &models.DashboardSaveSnapshot{Provisioning: &models.DashboardProvisioning{}}
 					return nil
 				})
 
@@ -193,8 +648,7 @@ func TestDashboardService(t *testing.T) {
 				dto.Dashboard.SetId(3)
 				dto.User = &models.SignedInUser{UserId: 1}
 				_, err := service.ImportDashboard(dto)
-				So(provisioningValidated, ShouldBeTrue)
-				So(err, ShouldEqual, models.ErrDashboardCannotSaveProvisionedDashboard)
+				So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleProvisionedConflict, Err: models.ErrDashboardCannotSaveProvisionedDashboard})
 			})
 		})
 
@@ -208,7 +662,13 @@ func TestDashboardService(t *testing.T) {
 			})
 
 			Convey("DeleteDashboard should fail to delete it", func() {
-				err := service.DeleteDashboard(1, 1)
+				_, err := service.DeleteDashboard(1, 1)
+				So(err, ShouldEqual, models.ErrDashboardCannotDeleteProvisionedDashboard)
+				So(result.deleteWasCalled, ShouldBeFalse)
+			})
+
+			Convey("DeleteDashboardIfVersion should fail to delete it", func() {
+				_, err := service.DeleteDashboardIfVersion(1, 1, 3, &models.SignedInUser{UserId: 1})
 				So(err, ShouldEqual, models.ErrDashboardCannotDeleteProvisionedDashboard)
 				So(result.deleteWasCalled, ShouldBeFalse)
 			})
@@ -224,20 +684,506 @@ func TestDashboardService(t *testing.T) {
 			})
 
 			Convey("DeleteDashboard should delete it", func() {
-				err := service.DeleteDashboard(1, 1)
+				_, err := service.DeleteDashboard(1, 1)
 				So(err, ShouldBeNil)
 				So(result.deleteWasCalled, ShouldBeTrue)
+				So(result.deletedVersion, ShouldEqual, 0)
+			})
+
+			Convey("DeleteDashboardIfVersion should delete it with the expected version", func() {
+				_, err := service.DeleteDashboardIfVersion(1, 1, 3, &models.SignedInUser{UserId: 1})
+				So(err, ShouldBeNil)
+				So(result.deletedVersion, ShouldEqual, 3)
+			})
+
+			Convey("DeleteDashboardIfVersion should not delete without a version", func() {
+				_, err := service.DeleteDashboardIfVersion(1, 1, 0, &models.SignedInUser{UserId: 1})
+				So(err, ShouldEqual, models.ErrDashboardVersionMismatch)
+				So(result.deleteWasCalled, ShouldBeFalse)
 			})
+
+			Convey("DeleteDashboardIfVersion should not delete without permission", func() {
+				guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: false})
+
+				_, err := service.DeleteDashboardIfVersion(1, 1, 3, &models.SignedInUser{UserId: 1})
+				So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+				So(result.deleteWasCalled, ShouldBeFalse)
+			})
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+		})
+	})
+}
+
+func TestDashboardGitSyncMeta(t *testing.T) {
+	Convey("Given git sync configured for org 1", t, func() {
+		bus.ClearBusHandlers()
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &fakeSyncConnector{orgId: 1, commitSha: "abc123"}
+		social.SocialMap["gitlab"] = connector
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		service := &dashboardServiceImpl{}
+		lastSync := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			if query.DashboardId == 1 {
+				query.Result = &models.DashboardGitSync{
+					DashboardId: 1,
+					OrgId:       1,
+					Provider:    "gitlab",
+					FilePath:    "dashboards/General/synced.json",
+					CommitSha:   "abc123",
+					Updated:     lastSync,
+				}
+			}
+			return nil
+		})
+
+		Convey("Should return the last commit of a synced dashboard", func() {
+			meta, err := service.GetGitSyncMeta(1, 1)
+			So(err, ShouldBeNil)
+			So(meta, ShouldResemble, &models.DashboardGitSyncMeta{
+				Enabled:       true,
+				Provider:      "gitlab",
+				RepoWebUrl:    "https://gitlab.example.com/ops/dashboards",
+				FilePath:      "dashboards/General/synced.json",
+				LastCommitSha: "abc123",
+				LastSyncTime:  &lastSync,
+			})
+		})
+
+		Convey("Should return sync enabled without commit for a dashboard that was never synced", func() {
+			meta, err := service.GetGitSyncMeta(2, 1)
+			So(err, ShouldBeNil)
+			So(meta, ShouldResemble, &models.DashboardGitSyncMeta{
+				Enabled:    true,
+				Provider:   "gitlab",
+				RepoWebUrl: "https://gitlab.example.com/ops/dashboards",
+			})
+		})
+
+		Convey("Should return the dashboards drifted from their file", func() {
+			bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+				query.Result = &models.DashboardGitSync{
+					DashboardId:       3,
+					FilePath:          "dashboards/General/drifted.json",
+					CommitSha:         "abc123",
+					ConflictCommitSha: "f00ba4",
+					Updated:           lastSync,
+				}
+				return nil
+			})
+
+			meta, err := service.GetGitSyncMeta(3, 1)
+			So(err, ShouldBeNil)
+			So(meta.LastCommitSha, ShouldEqual, "abc123")
+			So(meta.Drifted, ShouldBeTrue)
+			So(meta.ConflictCommitSha, ShouldEqual, "f00ba4")
+		})
+
+		Convey("Should return nothing for an org without git sync", func() {
+			bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+				t.Fatal("sync state should not be queried when git sync is disabled")
+				return nil
+			})
+
+			meta, err := service.GetGitSyncMeta(1, 2)
+			So(err, ShouldBeNil)
+			So(meta, ShouldBeNil)
+		})
+
+		Convey("When saving a dashboard", func() {
+			bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+				return nil
+			})
+
+			bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+				cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+				return nil
+			})
+
+			bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+				query.Result = &models.DashboardSaveSnapshot{}
+				return nil
+			})
+
+			bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+				return nil
+			})
+
+			bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+				cmd.Result = cmd.GetDashboardModel()
+				cmd.Result.Id = 5
+				return nil
+			})
+
+			var synced *models.SaveDashboardGitSyncCommand
+			bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+				synced = cmd
+				return nil
+			})
+
+			dash := models.NewDashboard("Synced")
+			dash.OrgId = 1
+			dto := &SaveDashboardDTO{
+				OrgId:     1,
+				Dashboard: dash,
+				User:      &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR, Login: "jdoe", Email: "jane@example.com", AuthModule: "gitlab", Token: "token"},
+			}
+
+			Convey("Should record the commit", func() {
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldBeNil)
+				So(synced, ShouldNotBeNil)
+				So(synced.DashboardId, ShouldEqual, 5)
+				So(synced.Provider, ShouldEqual, "gitlab")
+				So(synced.CommitSha, ShouldEqual, "abc123")
+				So(synced.FilePath, ShouldEqual, "General/synced.json")
+				So(synced.Branch, ShouldBeEmpty)
+				So(connector.lastOptions.Branch, ShouldBeEmpty)
+				So(connector.lastOptions.Repo, ShouldBeEmpty)
+			})
+
+			Convey("Should record where the dashboard was saved from", func() {
+				var saved *models.SaveDashboardCommand
+				bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+					saved = cmd
+					cmd.Result = cmd.GetDashboardModel()
+					cmd.Result.Id = 5
+					return nil
+				})
+
+				dto.RequestMeta = &models.RequestMeta{ClientIp: "192.168.1.10", UserAgent: "curl/7.64.1", RequestId: "f3a9c2"}
+
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldBeNil)
+				So(saved.RequestMeta, ShouldEqual, dto.RequestMeta)
+				So(synced.RequestMeta, ShouldEqual, dto.RequestMeta)
+				So(connector.lastOptions.RequestId, ShouldEqual, "f3a9c2")
+			})
+
+			Convey("Should pass the co-authors and the user to credit", func() {
+				dto.Coauthors = []models.GitCommitAuthor{{Name: "John Doe", Email: "john@example.com"}}
+
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldBeNil)
+				So(connector.lastOptions.Coauthors, ShouldResemble, dto.Coauthors)
+				So(connector.lastOptions.Author, ShouldResemble, &models.GitCommitAuthor{Name: "jdoe", Email: "jane@example.com"})
+			})
+
+			Convey("Should pass the external identity of the session", func() {
+				identity := &models.ExternalIdentity{Provider: "oauth_gitlab", ExternalId: "42", Login: "jdoe"}
+				dto.User.ExternalIdentity = identity
+
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldBeNil)
+				So(connector.lastOptions.ExternalIdentity, ShouldEqual, identity)
+			})
+
+			Convey("Should look the external identity up when the session has none", func() {
+				bus.AddHandler("test", func(query *models.GetExternalIdentityQuery) error {
+					if query.UserId != 1 || query.Provider != "oauth_gitlab" {
+						return models.ErrUserNotFound
+					}
+					query.Result = &models.ExternalIdentity{Provider: "oauth_gitlab", ExternalId: "42"}
+					return nil
+				})
+
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldBeNil)
+				So(connector.lastOptions.ExternalIdentity, ShouldResemble, &models.ExternalIdentity{Provider: "oauth_gitlab", ExternalId: "42"})
+			})
+
+			Convey("Should commit to the overridden branch and repository and record the branch", func() {
+				dto.GitOverride = &models.DashboardGitOverride{Branch: "preview/login", RepoId: 2}
+
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldBeNil)
+				So(connector.lastOptions.Branch, ShouldEqual, "preview/login")
+				So(connector.lastOptions.Repo, ShouldEqual, "2")
+				So(synced.Branch, ShouldEqual, "preview/login")
+			})
+
+			Convey("Should not allow viewers to override the branch", func() {
+				dto.User.OrgRole = models.ROLE_VIEWER
+				dto.GitOverride = &models.DashboardGitOverride{Branch: "preview/login"}
+
+				_, err := service.SaveDashboard(dto)
+				So(err, ShouldEqual, models.ErrDashboardGitOverrideAccessDenied)
+				So(connector.lastOptions, ShouldBeNil)
+				So(synced, ShouldBeNil)
+			})
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+		})
+	})
+}
+
+func TestDashboardGitConflicts(t *testing.T) {
+	Convey("Given a dashboard whose file was changed in the repository since the last sync", t, func() {
+		bus.ClearBusHandlers()
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &fakeSyncConnector{orgId: 1, commitSha: "def456"}
+		social.SocialMap["gitlab"] = connector
+
+		lastSync := &models.DashboardGitSync{
+			DashboardId: 1,
+			OrgId:       1,
+			FilePath:    "General/service.json",
+			CommitSha:   "abc123",
+			CommitMode:  models.GitCommitModeUser,
+			ContentHash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		}
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			query.Result = lastSync
+			return nil
+		})
+
+		var failures []*events.DashboardSyncFailed
+		bus.AddEventListener(func(event *events.DashboardSyncFailed) error {
+			failures = append(failures, event)
+			return nil
+		})
+		bus.AddEventListener(func(event *events.DashboardSynced) error {
+			return nil
+		})
+
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, AuthModule: "gitlab", Token: "token"}
+		dashboard := models.NewDashboard("Service")
+		dashboard.Id = 1
+		dashboard.OrgId = 1
+		dashboard.SetUid("service")
+		dto := &SaveDashboardDTO{OrgId: 1, User: user, Dashboard: dashboard}
+		service := &dashboardServiceImpl{clock: &fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}}
+
+		Convey("Should pass the last sync to compare the file with", func() {
+			_, err := service.updateDashboard(dashboard, social.UpdateDashboard, dto, "")
+			So(err, ShouldBeNil)
+			So(connector.lastOptions.LastSync, ShouldEqual, lastSync)
+		})
+
+		Convey("Should keep the last commit and flag the dashboard when the commit was skipped", func() {
+			connector.conflictCommitSha = "f00ba4"
+
+			result, err := service.updateDashboard(dashboard, social.UpdateDashboard, dto, "")
+			So(err, ShouldBeNil)
+			So(result.CommitSha, ShouldEqual, "abc123")
+			So(result.ContentHash, ShouldEqual, lastSync.ContentHash)
+			So(result.ConflictCommitSha, ShouldEqual, "f00ba4")
+			So(dto.warnings, ShouldHaveLength, 1)
+			So(dto.warnings[0].Code, ShouldEqual, WarningSyncConflict)
+			So(failures, ShouldHaveLength, 1)
+			So(failures[0].Error, ShouldEqual, models.ErrDashboardGitConflict.Error())
+			So(failures[0].Timestamp, ShouldEqual, time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC))
+
+			var synced *models.SaveDashboardGitSyncCommand
+			bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+				synced = cmd
+				return nil
+			})
+
+			So(saveGitSync(dashboard, dto, result), ShouldBeNil)
+			So(synced.CommitSha, ShouldEqual, "abc123")
+			So(synced.ConflictCommitSha, ShouldEqual, "f00ba4")
+		})
+
+		Convey("Should fail the commit when the repository fails conflicts", func() {
+			connector.err = models.ErrDashboardGitConflict
+
+			_, err := service.updateDashboard(dashboard, social.UpdateDashboard, dto, "")
+			So(err, ShouldEqual, models.ErrDashboardGitConflict)
+			So(dto.warnings, ShouldBeEmpty)
+			So(failures, ShouldHaveLength, 1)
+		})
+
+		Reset(func() {
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+func TestImportDashboardDefaultFolder(t *testing.T) {
+	Convey("Given a default import folder", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &fakeSyncConnector{orgId: 1, commitSha: "abc123"}
+		social.SocialMap["gitlab"] = connector
+
+		origDefaultImportFolder := setting.DashboardDefaultImportFolder
+		setting.DashboardDefaultImportFolder = "imported"
+
+		service := &dashboardServiceImpl{log: log.New("test")}
+
+		folder := models.NewDashboardFolder("Imported")
+		folder.Id = 7
+		folder.Uid = "imported-uid"
+		folder.OrgId = 1
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Id == folder.Id || query.Uid == folder.Uid {
+				query.Result = folder
+				return nil
+			}
+			return models.ErrDashboardNotFound
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardsBySlugQuery) error {
+			if query.Slug == folder.Slug {
+				query.Result = []*models.Dashboard{folder}
+			}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = snapshotWithFolder(query)
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			return nil
+		})
+
+		var saved *models.SaveDashboardCommand
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			saved = cmd
+			cmd.Result = cmd.GetDashboardModel()
+			return nil
+		})
+
+		importDashboard := func(folderId int64) (*models.Dashboard, error) {
+			dash := models.NewDashboard("Imported dashboard")
+			dash.OrgId = 1
+			dash.FolderId = folderId
+
+			return service.ImportDashboard(&SaveDashboardDTO{
+				OrgId:     1,
+				Dashboard: dash,
+				User:      &models.SignedInUser{UserId: 1, OrgId: 1, AuthModule: "gitlab", Token: "token"},
+			})
+		}
+
+		Convey("Should save dashboards imported without folder to the folder found by title", func() {
+			_, err := importDashboard(0)
+			So(err, ShouldBeNil)
+			So(saved.FolderId, ShouldEqual, 7)
+			So(connector.lastOptions.Folder, ShouldEqual, "Imported")
+		})
+
+		Convey("Should find the folder by uid", func() {
+			setting.DashboardDefaultImportFolder = "imported-uid"
+
+			_, err := importDashboard(0)
+			So(err, ShouldBeNil)
+			So(saved.FolderId, ShouldEqual, 7)
+		})
+
+		Convey("Should keep the folder selected for the import", func() {
+			bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+				if query.Id == 3 {
+					query.Result = models.NewDashboardFolder("Selected")
+					return nil
+				}
+				return models.ErrDashboardNotFound
+			})
+
+			_, err := importDashboard(3)
+			So(err, ShouldBeNil)
+			So(saved.FolderId, ShouldEqual, 3)
+			So(connector.lastOptions.Folder, ShouldEqual, "Selected")
+		})
+
+		Convey("Should import to General if the folder does not exist", func() {
+			setting.DashboardDefaultImportFolder = "missing"
+
+			_, err := importDashboard(0)
+			So(err, ShouldBeNil)
+			So(saved.FolderId, ShouldEqual, 0)
+			So(connector.lastOptions.Folder, ShouldEqual, "General")
 		})
 
 		Reset(func() {
 			guardian.New = origNewDashboardGuardian
+			setting.DashboardDefaultImportFolder = origDefaultImportFolder
+
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
 		})
 	})
 }
 
+type fakeSyncConnector struct {
+	social.SocialConnector
+	orgId       int64
+	commitSha   string
+	lastOptions *social.UpdateDashboardOptions
+	err         error
+	// conflictCommitSha makes the commits skipped because of a change made in the repository
+	conflictCommitSha string
+}
+
+func (c *fakeSyncConnector) UpdateDashboard(options *social.UpdateDashboardOptions, token string) error {
+	c.lastOptions = options
+	if c.err != nil {
+		return c.err
+	}
+	if c.conflictCommitSha != "" {
+		options.Result = &social.DashboardSyncResult{
+			FilePath:          options.Folder + "/" + options.Name + ".json",
+			Branch:            options.Branch,
+			ConflictCommitSha: c.conflictCommitSha,
+		}
+		return nil
+	}
+	options.Result = &social.DashboardSyncResult{
+		CommitSha: c.commitSha,
+		FilePath:  options.Folder + "/" + options.Name + ".json",
+		Branch:    options.Branch,
+	}
+	return nil
+}
+
+func (c *fakeSyncConnector) SyncRepo(orgId int64) *social.SyncRepo {
+	if orgId != c.orgId {
+		return nil
+	}
+	return &social.SyncRepo{Provider: "gitlab", WebUrl: "https://gitlab.example.com/ops/dashboards"}
+}
+
 type Result struct {
 	deleteWasCalled bool
+	deletedVersion  int
 }
 
 func setupDeleteHandlers(provisioned bool) *Result {
@@ -255,8 +1201,168 @@ func setupDeleteHandlers(provisioned bool) *Result {
 		So(cmd.Id, ShouldEqual, 1)
 		So(cmd.OrgId, ShouldEqual, 1)
 		result.deleteWasCalled = true
+		result.deletedVersion = cmd.Version
 		return nil
 	})
 
 	return result
 }
+
+// snapshotWithFolder returns a snapshot in which the folder of the saved dashboard exists
+func snapshotWithFolder(query *models.GetDashboardSaveSnapshotQuery) *models.DashboardSaveSnapshot {
+	snapshot := &models.DashboardSaveSnapshot{}
+	if query.FolderId > 0 {
+		snapshot.Folder = &models.Dashboard{Id: query.FolderId, OrgId: query.OrgId, IsFolder: true}
+	}
+	return snapshot
+}
+
+func TestDashboardServiceClock(t *testing.T) {
+	Convey("Given a dashboard service with a frozen clock", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		clock := &fakeClock{now: time.Date(2019, 8, 20, 14, 0, 0, 0, time.UTC)}
+		service := NewServiceWithDeps(clock, &fakeIDGenerator{})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = &models.DashboardSaveSnapshot{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		var saved *models.SaveDashboardCommand
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			saved = cmd
+			cmd.Result = cmd.GetDashboardModel()
+			return nil
+		})
+
+		saveDashboard := func(updatedAt time.Time) {
+			_, err := service.SaveDashboard(&SaveDashboardDTO{
+				OrgId:     1,
+				UpdatedAt: updatedAt,
+				Dashboard: models.NewDashboard("Dash"),
+				User:      &models.SignedInUser{UserId: 1, OrgId: 1},
+			})
+			So(err, ShouldBeNil)
+		}
+
+		Convey("Should set the update time from the clock", func() {
+			saveDashboard(time.Time{})
+			So(saved.UpdatedAt, ShouldEqual, clock.now)
+
+			clock.now = clock.now.Add(time.Hour)
+			saveDashboard(time.Time{})
+			So(saved.UpdatedAt, ShouldEqual, time.Date(2019, 8, 20, 15, 0, 0, 0, time.UTC))
+		})
+
+		Convey("Should keep the update time of the caller", func() {
+			updatedAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+			saveDashboard(updatedAt)
+			So(saved.UpdatedAt, ShouldEqual, updatedAt)
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+		})
+	})
+}
+
+func TestGetDashboardFolderPath(t *testing.T) {
+	Convey("Given dashboards in the root and in a folder", t, func() {
+		origNewDashboardGuardian := guardian.New
+		fakeGuardian := &guardian.FakeDashboardGuardian{CanViewValue: true}
+		guardian.MockDashboardGuardian(fakeGuardian)
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			switch query.Id {
+			case 1:
+				query.Result = &models.Dashboard{Id: 1, OrgId: 1, Title: "Home"}
+			case 2:
+				query.Result = &models.Dashboard{Id: 2, OrgId: 1, Title: "Service", FolderId: 3}
+			case 3:
+				query.Result = &models.Dashboard{Id: 3, OrgId: 1, Title: "Team A", IsFolder: true}
+			case 5:
+				query.Result = &models.Dashboard{Id: 5, OrgId: 1, Title: "Orphan", FolderId: 6}
+			default:
+				return models.ErrDashboardNotFound
+			}
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1}
+
+		Convey("Should return the folder the sync uses in the file path", func() {
+			folder, err := service.GetDashboardFolderPath(2, 1, user)
+			So(err, ShouldBeNil)
+			So(folder, ShouldEqual, "Team A")
+			So(fakeGuardian.DashId, ShouldEqual, 2)
+
+			synced, err := getDashboardFolder(&models.Dashboard{FolderId: 3})
+			So(err, ShouldBeNil)
+			So(folder, ShouldEqual, synced)
+		})
+
+		Convey("Should return General for dashboards in the root", func() {
+			folder, err := service.GetDashboardFolderPath(1, 1, user)
+			So(err, ShouldBeNil)
+			So(folder, ShouldEqual, "General")
+		})
+
+		Convey("Should not return the folder to users who cannot view the dashboard", func() {
+			fakeGuardian.CanViewValue = false
+
+			_, err := service.GetDashboardFolderPath(2, 1, user)
+			So(err, ShouldEqual, models.ErrDashboardViewAccessDenied)
+		})
+
+		Convey("Should fail for unknown dashboards", func() {
+			_, err := service.GetDashboardFolderPath(4, 1, user)
+			So(err, ShouldEqual, models.ErrDashboardNotFound)
+		})
+
+		Convey("Should return the stale folder of dashboards whose folder was deleted", func() {
+			_, err := service.GetDashboardFolderPath(5, 1, user)
+			So(err, ShouldResemble, models.DashboardFolderNotFoundError{FolderId: 6})
+			So(xerrors.Is(err, models.ErrDashboardFolderNotFound), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+type fakeIDGenerator struct {
+	count int
+}
+
+func (g *fakeIDGenerator) NewID() string {
+	g.count++
+	return fmt.Sprintf("uid-%d", g.count)
+}
@@ -0,0 +1,132 @@
+package dashboards
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// builtinDatasources are the data sources referenced by name that are not data sources of the organization
+var builtinDatasources = map[string]bool{
+	"":                true,
+	"default":         true,
+	"-- Grafana --":   true,
+	"-- Mixed --":     true,
+	"-- Dashboard --": true,
+}
+
+// IsBuiltinDatasource tells whether a data source name refers to the default data source or to one built into
+// Grafana rather than to a data source of the organization
+func IsBuiltinDatasource(name string) bool {
+	return builtinDatasources[name]
+}
+
+// DatasourceRef is a data source required by a dashboard. References by name have no uid, references by uid may
+// have the type of the data source, and data source template variables only require a data source of their type.
+type DatasourceRef struct {
+	Uid  string `json:"uid,omitempty"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// RangeDatasourceReferences calls fn with the panels, queries, template variables and annotations of the dashboard
+// json that have a datasource, a name or an object with a uid. Panels of collapsed rows and of the rows of
+// dashboards from before schema version 16 are included.
+func RangeDatasourceReferences(data *simplejson.Json, fn func(item *simplejson.Json)) {
+	visit := func(item *simplejson.Json) {
+		if _, ok := item.CheckGet("datasource"); ok {
+			fn(item)
+		}
+	}
+
+	var visitPanels func(panels *simplejson.Json)
+	visitPanels = func(panels *simplejson.Json) {
+		for i := range panels.MustArray() {
+			panel := panels.GetIndex(i)
+			visit(panel)
+
+			targets := panel.Get("targets")
+			for j := range targets.MustArray() {
+				visit(targets.GetIndex(j))
+			}
+
+			visitPanels(panel.Get("panels"))
+		}
+	}
+
+	visitPanels(data.Get("panels"))
+
+	rows := data.Get("rows")
+	for i := range rows.MustArray() {
+		visitPanels(rows.GetIndex(i).Get("panels"))
+	}
+
+	for _, variable := range templateVariables(data) {
+		visit(variable)
+	}
+
+	annotations := data.Get("annotations").Get("list")
+	for i := range annotations.MustArray() {
+		visit(annotations.GetIndex(i))
+	}
+}
+
+// GetDashboardRequiredDatasources returns the distinct data sources the dashboard json requires, in the order they
+// are referenced. It reads the references of both schemas, names and objects with a uid, and skips the default and
+// built-in data sources and references to template variables. Alert rules query the queries of their panel, so
+// their data sources are those of the panel. It does not look the data sources up, so it can check a dashboard
+// before it is saved or imported.
+func GetDashboardRequiredDatasources(data json.RawMessage) ([]DatasourceRef, error) {
+	dashboard, err := simplejson.NewJson(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dashboard.Map(); err != nil {
+		return nil, err
+	}
+
+	refs := make([]DatasourceRef, 0)
+	seen := make(map[DatasourceRef]bool)
+	add := func(ref DatasourceRef) {
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+
+	RangeDatasourceReferences(dashboard, func(item *simplejson.Json) {
+		value := item.Get("datasource")
+
+		if name, err := value.String(); err == nil {
+			if !IsBuiltinDatasource(name) && !isVariableReference(name) {
+				add(DatasourceRef{Name: name})
+			}
+			return
+		}
+
+		uid := value.Get("uid").MustString()
+		dsType := value.Get("type").MustString()
+		// built-in data sources of the newer schema have the datasource type, e.g. {"type": "datasource", "uid": "grafana"}
+		if uid == "" || dsType == "datasource" || IsBuiltinDatasource(uid) || isVariableReference(uid) {
+			return
+		}
+		add(DatasourceRef{Uid: uid, Type: dsType})
+	})
+
+	for _, variable := range templateVariables(dashboard) {
+		if variable.Get("type").MustString() != "datasource" {
+			continue
+		}
+		if dsType := variable.Get("query").MustString(); dsType != "" && !isVariableReference(dsType) {
+			add(DatasourceRef{Type: dsType})
+		}
+	}
+
+	return refs, nil
+}
+
+// isVariableReference tells whether a reference is to a template variable or to an input, e.g. $ds or ${DS_PROM}
+func isVariableReference(value string) bool {
+	return strings.HasPrefix(value, "$")
+}
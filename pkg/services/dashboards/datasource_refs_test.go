@@ -0,0 +1,74 @@
+package dashboards
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetDashboardRequiredDatasources(t *testing.T) {
+	Convey("Given dashboards referencing data sources", t, func() {
+		Convey("Should return the distinct data sources of panels, queries, variables and annotations", func() {
+			refs, err := GetDashboardRequiredDatasources([]byte(`{
+				"panels": [
+					{"datasource": "Prometheus", "targets": [{"refId": "A"}], "alert": {"conditions": [{"query": {"params": ["A", "5m", "now"]}}]}},
+					{"datasource": "-- Mixed --", "targets": [
+						{"datasource": "Loki"},
+						{"datasource": {"uid": "P1809F7CD0C75ACF3", "type": "prometheus"}}
+					]},
+					{"type": "row", "collapsed": true, "panels": [{"datasource": "Elasticsearch"}]},
+					{"datasource": "Prometheus"}
+				],
+				"templating": {"list": [
+					{"name": "host", "type": "query", "datasource": "Prometheus"},
+					{"name": "ds", "type": "datasource", "query": "influxdb"}
+				]},
+				"annotations": {"list": [{"datasource": "-- Grafana --"}, {"datasource": "Deploys"}]}
+			}`))
+			So(err, ShouldBeNil)
+			So(refs, ShouldResemble, []DatasourceRef{
+				{Name: "Prometheus"},
+				{Name: "Loki"},
+				{Uid: "P1809F7CD0C75ACF3", Type: "prometheus"},
+				{Name: "Elasticsearch"},
+				{Name: "Deploys"},
+				{Type: "influxdb"},
+			})
+		})
+
+		Convey("Should read the rows of dashboards before schema version 16", func() {
+			refs, err := GetDashboardRequiredDatasources([]byte(`{
+				"schemaVersion": 14,
+				"rows": [{"panels": [{"datasource": "Graphite", "targets": [{"target": "a.b.c"}]}]}]
+			}`))
+			So(err, ShouldBeNil)
+			So(refs, ShouldResemble, []DatasourceRef{{Name: "Graphite"}})
+		})
+
+		Convey("Should skip the default and built-in data sources and variables", func() {
+			refs, err := GetDashboardRequiredDatasources([]byte(`{
+				"panels": [
+					{"datasource": null, "targets": [{"refId": "A"}]},
+					{"datasource": "default"},
+					{"datasource": "-- Dashboard --"},
+					{"datasource": "$ds"},
+					{"datasource": "${DS_PROMETHEUS}"},
+					{"datasource": {"uid": "${ds}", "type": "prometheus"}},
+					{"datasource": {"uid": "grafana", "type": "datasource"}},
+					{"datasource": {"type": "prometheus"}}
+				],
+				"templating": {"list": [{"name": "ds", "type": "datasource", "query": "$type"}]}
+			}`))
+			So(err, ShouldBeNil)
+			So(refs, ShouldBeEmpty)
+		})
+
+		Convey("Should fail for json that is not a dashboard", func() {
+			_, err := GetDashboardRequiredDatasources([]byte(`{"panels": [`))
+			So(err, ShouldNotBeNil)
+
+			_, err = GetDashboardRequiredDatasources([]byte(`[1, 2]`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,153 @@
+package dashboards
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util/errutil"
+)
+
+// DeleteConfirmation describes what deleting a dashboard removes. Token confirms the delete until Expires, as
+// long as the dashboard is not changed in the meantime.
+type DeleteConfirmation struct {
+	Token       string    `json:"token"`
+	Expires     time.Time `json:"expires"`
+	DashboardId int64     `json:"dashboardId"`
+	Uid         string    `json:"uid"`
+	Title       string    `json:"title"`
+	Folder      string    `json:"folder"`
+	Version     int       `json:"version"`
+	// GitSync is set when the delete also deletes the file of the dashboard in the git repository
+	GitSync bool `json:"gitSync"`
+}
+
+// PrepareDeleteDashboard returns a short-lived token confirming the delete of the dashboard in its current
+// version, with a summary of what is removed, for the first phase of a two-phase delete.
+func (dr *dashboardServiceImpl) PrepareDeleteDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) (*DeleteConfirmation, error) {
+	guard := guardian.New(dashboardId, orgId, user)
+	if canSave, err := guard.CanSave(); err != nil || !canSave {
+		if err != nil {
+			return nil, err
+		}
+		return nil, models.ErrDashboardUpdateAccessDenied
+	}
+
+	provisionedData, err := dr.GetProvisionedDashboardDataByDashboardId(dashboardId)
+	if err != nil {
+		return nil, errutil.Wrap("failed to check if dashboard is provisioned", err)
+	}
+
+	if provisionedData != nil {
+		return nil, models.ErrDashboardCannotDeleteProvisionedDashboard
+	}
+
+	query := &models.GetDashboardQuery{Id: dashboardId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	dash := query.Result
+	if models.IsProtectedDashboardUid(dash.Uid) {
+		return nil, models.ErrDashboardProtected
+	}
+
+	folder, err := getDashboardFolder(dash)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := dr.now().Add(setting.DashboardDeleteConfirmationTTL)
+
+	return &DeleteConfirmation{
+		Token:       signDeleteToken(orgId, dash.Id, dash.Version, expires),
+		Expires:     expires,
+		DashboardId: dash.Id,
+		Uid:         dash.Uid,
+		Title:       dash.Title,
+		Folder:      folder,
+		Version:     dash.Version,
+		GitSync:     user.Token != "" && getSyncRepo(orgId) != nil,
+	}, nil
+}
+
+// DeleteDashboardWithToken deletes the dashboard like DeleteDashboardIfVersion, with the version the token of
+// PrepareDeleteDashboard was issued for, so a change since then fails the delete with ErrDashboardVersionMismatch.
+func (dr *dashboardServiceImpl) DeleteDashboardWithToken(dashboardId int64, orgId int64, token string, user *models.SignedInUser) (*DeleteDashboardResult, error) {
+	version, err := dr.verifyDeleteToken(token, orgId, dashboardId)
+	if err != nil {
+		return nil, err
+	}
+
+	return dr.DeleteDashboardIfVersion(dashboardId, orgId, int64(version), user)
+}
+
+// The purposes of the dashboard tokens, signed with the purpose so a token cannot be used for another one
+const (
+	deleteTokenPurpose  = "dashboard-delete"
+	archiveTokenPurpose = "dashboard-archive"
+)
+
+// signDeleteToken returns <payload>.<signature>, where the payload encodes the org, id and version of the
+// dashboard and the expiry of the token, and the signature is its HMAC with the secret key of the instance
+func signDeleteToken(orgId int64, dashboardId int64, version int, expires time.Time) string {
+	return signDashboardToken(deleteTokenPurpose, orgId, dashboardId, version, expires)
+}
+
+func signDashboardToken(purpose string, orgId int64, dashboardId int64, version int, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%d:%d", orgId, dashboardId, version, expires.Unix())))
+	return payload + "." + dashboardTokenSignature(purpose, payload)
+}
+
+func dashboardTokenSignature(purpose string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(setting.SecretKey))
+	mac.Write([]byte(purpose + ":" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDeleteToken returns the version of the dashboard the token was issued for
+func (dr *dashboardServiceImpl) verifyDeleteToken(token string, orgId int64, dashboardId int64) (int, error) {
+	version, expires, ok := parseDashboardToken(deleteTokenPurpose, token, orgId, dashboardId)
+	if !ok {
+		return 0, models.ErrDashboardDeleteTokenInvalid
+	}
+
+	if !dr.now().Before(expires) {
+		return 0, models.ErrDashboardDeleteTokenExpired
+	}
+
+	return version, nil
+}
+
+// parseDashboardToken returns the version and expiry of a token signed for the purpose, org and dashboard
+func parseDashboardToken(purpose string, token string, orgId int64, dashboardId int64) (int, time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(dashboardTokenSignature(purpose, parts[0]))) {
+		return 0, time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	var tokenOrgId, tokenDashboardId, expires int64
+	var version int
+	if _, err := fmt.Sscanf(string(payload), "%d:%d:%d:%d", &tokenOrgId, &tokenDashboardId, &version, &expires); err != nil {
+		return 0, time.Time{}, false
+	}
+
+	if tokenOrgId != orgId || tokenDashboardId != dashboardId {
+		return 0, time.Time{}, false
+	}
+
+	return version, time.Unix(expires, 0), true
+}
@@ -0,0 +1,118 @@
+package dashboards
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardDeleteConfirmation(t *testing.T) {
+	Convey("Given a dashboard service with a frozen clock", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		origSecretKey := setting.SecretKey
+		origTTL := setting.DashboardDeleteConfirmationTTL
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+		setting.SecretKey = "secret"
+		setting.DashboardDeleteConfirmationTTL = 5 * time.Minute
+
+		clock := &fakeClock{now: time.Date(2019, 8, 20, 14, 0, 0, 0, time.UTC)}
+		service := NewServiceWithDeps(clock, &fakeIDGenerator{})
+		user := &models.SignedInUser{UserId: 1, OrgId: 1}
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			query.Result = &models.Dashboard{Id: 1, OrgId: 1, Uid: "abc", Title: "Dash", Version: 3}
+			return nil
+		})
+
+		Convey("Given a non provisioned dashboard", func() {
+			result := setupDeleteHandlers(false)
+
+			confirmation, err := service.PrepareDeleteDashboard(1, 1, user)
+			So(err, ShouldBeNil)
+
+			Convey("Prepare should summarize the delete", func() {
+				So(confirmation.Uid, ShouldEqual, "abc")
+				So(confirmation.Title, ShouldEqual, "Dash")
+				So(confirmation.Folder, ShouldEqual, models.RootFolderName)
+				So(confirmation.Version, ShouldEqual, 3)
+				So(confirmation.GitSync, ShouldBeFalse)
+				So(confirmation.Expires, ShouldResemble, clock.now.Add(5*time.Minute))
+				So(confirmation.Token, ShouldNotBeEmpty)
+				So(result.deleteWasCalled, ShouldBeFalse)
+			})
+
+			Convey("The token should delete the version it was issued for", func() {
+				_, err := service.DeleteDashboardWithToken(1, 1, confirmation.Token, user)
+				So(err, ShouldBeNil)
+				So(result.deleteWasCalled, ShouldBeTrue)
+				So(result.deletedVersion, ShouldEqual, 3)
+			})
+
+			Convey("A tampered token should be rejected", func() {
+				// the payload of a token for another version, with the signature of the issued token
+				other := strings.Split(signDeleteToken(1, 1, 4, confirmation.Expires), ".")
+				tampered := other[0] + "." + strings.Split(confirmation.Token, ".")[1]
+
+				_, err := service.DeleteDashboardWithToken(1, 1, tampered, user)
+				So(err, ShouldEqual, models.ErrDashboardDeleteTokenInvalid)
+				So(result.deleteWasCalled, ShouldBeFalse)
+			})
+
+			Convey("The token of another dashboard should be rejected", func() {
+				_, err := service.DeleteDashboardWithToken(2, 1, confirmation.Token, user)
+				So(err, ShouldEqual, models.ErrDashboardDeleteTokenInvalid)
+
+				_, err = service.DeleteDashboardWithToken(1, 2, confirmation.Token, user)
+				So(err, ShouldEqual, models.ErrDashboardDeleteTokenInvalid)
+				So(result.deleteWasCalled, ShouldBeFalse)
+			})
+
+			Convey("A token signed with another key should be rejected", func() {
+				setting.SecretKey = "other"
+
+				_, err := service.DeleteDashboardWithToken(1, 1, confirmation.Token, user)
+				So(err, ShouldEqual, models.ErrDashboardDeleteTokenInvalid)
+				So(result.deleteWasCalled, ShouldBeFalse)
+			})
+
+			Convey("An expired token should be rejected", func() {
+				clock.now = clock.now.Add(5 * time.Minute)
+
+				_, err := service.DeleteDashboardWithToken(1, 1, confirmation.Token, user)
+				So(err, ShouldEqual, models.ErrDashboardDeleteTokenExpired)
+				So(result.deleteWasCalled, ShouldBeFalse)
+			})
+
+			Convey("Prepare should require permission to save the dashboard", func() {
+				guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: false})
+
+				_, err := service.PrepareDeleteDashboard(1, 1, user)
+				So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+			})
+		})
+
+		Convey("Given a provisioned dashboard", func() {
+			setupDeleteHandlers(true)
+
+			Convey("Prepare should fail", func() {
+				_, err := service.PrepareDeleteDashboard(1, 1, user)
+				So(err, ShouldEqual, models.ErrDashboardCannotDeleteProvisionedDashboard)
+			})
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+			setting.SecretKey = origSecretKey
+			setting.DashboardDeleteConfirmationTTL = origTTL
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package dashboards
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const (
+	// exportKindSync is the json committed to git, see syncedDashboardJson
+	exportKindSync = "sync"
+	// exportKindBundle is the json of a dashboard in an org bundle
+	exportKindBundle = "bundle"
+)
+
+var dashboardExportCache = newExportCache()
+
+type exportCacheKey struct {
+	kind        string
+	dashboardId int64
+	version     int
+}
+
+type exportCacheEntry struct {
+	key     exportCacheKey
+	content []byte
+}
+
+// exportCache keeps the exported json of the most recently used stored dashboards, up to export_cache_size
+// entries. Entries are keyed by dashboard id and version, every save changes the version so entries of older
+// versions are never read again and age out.
+type exportCache struct {
+	mu      sync.Mutex
+	entries map[exportCacheKey]*list.Element
+	order   *list.List
+}
+
+func newExportCache() *exportCache {
+	return &exportCache{entries: make(map[exportCacheKey]*list.Element), order: list.New()}
+}
+
+// content returns the exported json of the stored dashboard, calling export on a miss. Dashboards that are not
+// stored yet are exported every time, as their version does not describe their json. The returned content is
+// shared and must not be changed.
+func (c *exportCache) content(kind string, dash *models.Dashboard, export func() ([]byte, error)) ([]byte, error) {
+	size := setting.DashboardExportCacheSize
+	if size <= 0 || dash.Id == 0 {
+		return export()
+	}
+
+	key := exportCacheKey{kind: kind, dashboardId: dash.Id, version: dash.Version}
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*exportCacheEntry).content, nil
+	}
+	c.mu.Unlock()
+
+	content, err := export()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&exportCacheEntry{key: key, content: content})
+	}
+
+	for c.order.Len() > size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*exportCacheEntry).key)
+	}
+
+	return content, nil
+}
+
+func (c *exportCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// storedDashboardJson returns the json committed to git for a dashboard read from the database, from the export
+// cache when enabled. Dashboards being saved must use syncedDashboardJson, their version is not updated yet.
+func storedDashboardJson(dash *models.Dashboard) ([]byte, error) {
+	return dashboardExportCache.content(exportKindSync, dash, func() ([]byte, error) {
+		return syncedDashboardJson(dash)
+	})
+}
@@ -0,0 +1,131 @@
+package dashboards
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExportCache(t *testing.T) {
+	Convey("Given an export cache of 2 dashboards", t, func() {
+		origSize := setting.DashboardExportCacheSize
+		setting.DashboardExportCacheSize = 2
+		cache := newExportCache()
+
+		exports := 0
+		export := func(dash *models.Dashboard) []byte {
+			content, err := cache.content(exportKindSync, dash, func() ([]byte, error) {
+				exports++
+				return []byte(fmt.Sprintf("%d@%d", dash.Id, dash.Version)), nil
+			})
+			So(err, ShouldBeNil)
+			return content
+		}
+
+		dashboard := func(id int64, version int) *models.Dashboard {
+			dash := models.NewDashboard(fmt.Sprintf("Dash %d", id))
+			dash.Id = id
+			dash.Version = version
+			return dash
+		}
+
+		Convey("Should export an unchanged dashboard once", func() {
+			So(string(export(dashboard(1, 3))), ShouldEqual, "1@3")
+			So(string(export(dashboard(1, 3))), ShouldEqual, "1@3")
+			So(exports, ShouldEqual, 1)
+		})
+
+		Convey("Should export a dashboard again once its version changes", func() {
+			export(dashboard(1, 3))
+			So(string(export(dashboard(1, 4))), ShouldEqual, "1@4")
+			So(exports, ShouldEqual, 2)
+		})
+
+		Convey("Should keep the exports of each kind apart", func() {
+			export(dashboard(1, 3))
+			_, err := cache.content(exportKindBundle, dashboard(1, 3), func() ([]byte, error) {
+				exports++
+				return []byte("bundle"), nil
+			})
+			So(err, ShouldBeNil)
+			So(exports, ShouldEqual, 2)
+		})
+
+		Convey("Should evict the least recently used dashboard", func() {
+			export(dashboard(1, 1))
+			export(dashboard(2, 1))
+			export(dashboard(1, 1))
+			export(dashboard(3, 1))
+			So(cache.len(), ShouldEqual, 2)
+			So(exports, ShouldEqual, 3)
+
+			export(dashboard(1, 1))
+			So(exports, ShouldEqual, 3)
+
+			export(dashboard(2, 1))
+			So(exports, ShouldEqual, 4)
+		})
+
+		Convey("Should not cache dashboards that are not saved", func() {
+			export(dashboard(0, 0))
+			export(dashboard(0, 0))
+			So(exports, ShouldEqual, 2)
+			So(cache.len(), ShouldEqual, 0)
+		})
+
+		Convey("Should not cache failed exports", func() {
+			_, err := cache.content(exportKindSync, dashboard(1, 1), func() ([]byte, error) {
+				return nil, errors.New("export failed")
+			})
+			So(err, ShouldNotBeNil)
+			So(cache.len(), ShouldEqual, 0)
+		})
+
+		Convey("Should not cache when disabled", func() {
+			setting.DashboardExportCacheSize = 0
+			export(dashboard(1, 1))
+			export(dashboard(1, 1))
+			So(exports, ShouldEqual, 2)
+		})
+
+		Reset(func() {
+			setting.DashboardExportCacheSize = origSize
+		})
+	})
+
+	Convey("Given the json committed for stored dashboards", t, func() {
+		origSize := setting.DashboardExportCacheSize
+		setting.DashboardExportCacheSize = 10
+		dashboardExportCache = newExportCache()
+
+		dash := models.NewDashboard("Cached")
+		dash.Id = 7
+		dash.SetUid("cached")
+		dash.Version = 2
+
+		content, err := storedDashboardJson(dash)
+		So(err, ShouldBeNil)
+
+		Convey("Should reuse the json while the version is unchanged", func() {
+			dash.Data.Set("description", "not saved yet")
+
+			cached, err := storedDashboardJson(dash)
+			So(err, ShouldBeNil)
+			So(string(cached), ShouldEqual, string(content))
+
+			dash.Version = 3
+			updated, err := storedDashboardJson(dash)
+			So(err, ShouldBeNil)
+			So(string(updated), ShouldContainSubstring, "not saved yet")
+		})
+
+		Reset(func() {
+			setting.DashboardExportCacheSize = origSize
+			dashboardExportCache = newExportCache()
+		})
+	})
+}
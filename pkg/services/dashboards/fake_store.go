@@ -0,0 +1,941 @@
+package dashboards
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// FakeDashboardStore keeps dashboards, folders, their acls and their provisioning in memory and handles the
+// commands and queries the dashboard service dispatches the way the sql store does: saves bump the version and
+// reject stale versions, uids are unique in an organization, the validation before a save detects folder changes
+// and the acls fall back to the default permissions. Tests register it on the bus and use the service of
+// NewService, so the flows of the service run end to end without a database. Teams are not kept, acls granting
+// permissions to teams match no user.
+type FakeDashboardStore struct {
+	// AlertValidationError fails the validation of the alerts of every save when set
+	AlertValidationError error
+	// UpdatedAlerts are the ids of the dashboards whose alerts were updated, in the order of the updates
+	UpdatedAlerts []int64
+	// Outbox keeps the commits queued by the saves
+	Outbox *FakeSyncOutbox
+
+	mu           sync.Mutex
+	dashboards   map[int64]*models.Dashboard
+	acls         map[int64][]*models.DashboardAclInfoDTO
+	provisioning map[int64]*models.DashboardProvisioning
+	maintenance  *models.DashboardMaintenance
+	templates    map[int64]*models.FolderTemplate
+	lastId       int64
+	lastUid      int
+}
+
+func NewFakeDashboardStore() *FakeDashboardStore {
+	return &FakeDashboardStore{
+		UpdatedAlerts: make([]int64, 0),
+		Outbox:        NewFakeSyncOutbox(),
+		dashboards:    make(map[int64]*models.Dashboard),
+		acls:          make(map[int64][]*models.DashboardAclInfoDTO),
+		provisioning:  make(map[int64]*models.DashboardProvisioning),
+		templates:     make(map[int64]*models.FolderTemplate),
+	}
+}
+
+// Register adds the handlers of the store to the bus, replacing the handlers of the same messages. They are
+// removed with bus.ClearBusHandlers.
+func (s *FakeDashboardStore) Register() {
+	bus.AddHandler("test", s.getDashboard)
+	bus.AddHandler("test", s.getDashboardsBySlug)
+	bus.AddHandler("test", s.saveDashboard)
+	bus.AddHandler("test", s.deleteDashboard)
+	bus.AddHandler("test", s.validateDashboardBeforeSave)
+	bus.AddHandler("test", s.getDashboardSaveSnapshot)
+	bus.AddHandler("test", s.getDashboardAclInfoList)
+	bus.AddHandler("test", s.getTeamsByUser)
+	bus.AddHandler("test", s.validateDashboardAlerts)
+	bus.AddHandler("test", s.updateDashboardAlerts)
+	bus.AddHandler("test", s.saveProvisionedDashboard)
+	bus.AddHandler("test", s.getProvisionedDataByDashboardId)
+	bus.AddHandler("test", s.getProvisionedDataByDashboardIds)
+	bus.AddHandler("test", s.getProvisionedDashboardData)
+	bus.AddHandler("test", s.unprovisionDashboard)
+	bus.AddHandler("test", s.getDashboardMaintenance)
+	bus.AddHandler("test", s.setDashboardMaintenance)
+	bus.AddHandler("test", s.getFolderTemplate)
+	bus.AddHandler("test", s.setFolderTemplate)
+	s.Outbox.Register()
+}
+
+// AddFolder stores a folder at version 1 and returns a copy of it
+func (s *FakeDashboardStore) AddFolder(orgId int64, title string) *models.Dashboard {
+	return s.add(orgId, 0, title, true)
+}
+
+// AddDashboard stores a dashboard in the folder at version 1 and returns a copy of it
+func (s *FakeDashboardStore) AddDashboard(orgId int64, folderId int64, title string) *models.Dashboard {
+	return s.add(orgId, folderId, title, false)
+}
+
+func (s *FakeDashboardStore) add(orgId int64, folderId int64, title string, isFolder bool) *models.Dashboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastId++
+	dash := models.NewDashboard(title)
+	dash.SetId(s.lastId)
+	dash.SetUid(s.newUid())
+	dash.SetVersion(1)
+	dash.OrgId = orgId
+	dash.FolderId = folderId
+	dash.IsFolder = isFolder
+	dash.Created = time.Now()
+	dash.Updated = dash.Created
+
+	s.dashboards[dash.Id] = copyDashboard(dash)
+	return copyDashboard(dash)
+}
+
+// SetAcl replaces the permissions of a dashboard or folder, which then no longer has the default permissions
+func (s *FakeDashboardStore) SetAcl(dashboardId int64, items ...*models.DashboardAclInfoDTO) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range items {
+		item.DashboardId = dashboardId
+	}
+	s.acls[dashboardId] = items
+
+	if dash, ok := s.dashboards[dashboardId]; ok {
+		dash.HasAcl = true
+	}
+}
+
+// Provision marks the dashboard as provisioned by the provisioning
+func (s *FakeDashboardStore) Provision(dashboardId int64, provisioning *models.DashboardProvisioning) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provisioning.DashboardId = dashboardId
+	s.provisioning[dashboardId] = provisioning
+}
+
+// Dashboard returns a copy of the stored dashboard or folder as GetDashboardQuery does, nil when there is none
+// with the id
+func (s *FakeDashboardStore) Dashboard(id int64) *models.Dashboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dash, ok := s.dashboards[id]; ok {
+		return loadedDashboard(dash)
+	}
+	return nil
+}
+
+// Provisioning returns the provisioning of the dashboard, nil when it is not provisioned
+func (s *FakeDashboardStore) Provisioning(dashboardId int64) *models.DashboardProvisioning {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.provisioning[dashboardId]
+}
+
+// loadedDashboard is a copy of the stored dashboard with its id and uid in its json, like the sql store loads it
+func loadedDashboard(dash *models.Dashboard) *models.Dashboard {
+	result := copyDashboard(dash)
+	result.SetId(result.Id)
+	result.SetUid(result.Uid)
+	return result
+}
+
+func copyDashboard(dash *models.Dashboard) *models.Dashboard {
+	dashCopy := *dash
+	dashCopy.Data = simplejson.New()
+	if dash.Data != nil {
+		if data, err := dash.Data.Encode(); err == nil {
+			dashCopy.Data, _ = simplejson.NewJson(data)
+		}
+	}
+	return &dashCopy
+}
+
+func (s *FakeDashboardStore) newUid() string {
+	s.lastUid++
+	return fmt.Sprintf("fake-%d", s.lastUid)
+}
+
+// sorted returns the stored dashboards by id, so lookups matching several dashboards are deterministic
+func (s *FakeDashboardStore) sorted() []*models.Dashboard {
+	dashboards := make([]*models.Dashboard, 0, len(s.dashboards))
+	for _, dash := range s.dashboards {
+		dashboards = append(dashboards, dash)
+	}
+	sort.Slice(dashboards, func(i, j int) bool {
+		return dashboards[i].Id < dashboards[j].Id
+	})
+	return dashboards
+}
+
+func (s *FakeDashboardStore) find(match func(dash *models.Dashboard) bool) *models.Dashboard {
+	for _, dash := range s.sorted() {
+		if match(dash) {
+			return dash
+		}
+	}
+	return nil
+}
+
+func (s *FakeDashboardStore) byUid(orgId int64, uid string) *models.Dashboard {
+	return s.find(func(dash *models.Dashboard) bool {
+		return dash.OrgId == orgId && dash.Uid == uid
+	})
+}
+
+func (s *FakeDashboardStore) folder(orgId int64, folderId int64) *models.Dashboard {
+	if dash, ok := s.dashboards[folderId]; ok && dash.OrgId == orgId && dash.IsFolder {
+		return dash
+	}
+	return nil
+}
+
+// getDashboard matches the fields of the query that are set, like the sql store
+func (s *FakeDashboardStore) getDashboard(query *models.GetDashboardQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dash := s.find(func(dash *models.Dashboard) bool {
+		return (query.Id == 0 || dash.Id == query.Id) &&
+			(query.Uid == "" || dash.Uid == query.Uid) &&
+			(query.Slug == "" || dash.Slug == query.Slug) &&
+			(query.OrgId == 0 || dash.OrgId == query.OrgId)
+	})
+	if dash == nil {
+		return models.ErrDashboardNotFound
+	}
+
+	query.Result = loadedDashboard(dash)
+	return nil
+}
+
+func (s *FakeDashboardStore) getDashboardsBySlug(query *models.GetDashboardsBySlugQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query.Result = make([]*models.Dashboard, 0)
+	for _, dash := range s.sorted() {
+		if dash.OrgId == query.OrgId && dash.Slug == query.Slug {
+			query.Result = append(query.Result, loadedDashboard(dash))
+		}
+	}
+	return nil
+}
+
+func (s *FakeDashboardStore) saveDashboard(cmd *models.SaveDashboardCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(cmd)
+}
+
+func (s *FakeDashboardStore) save(cmd *models.SaveDashboardCommand) error {
+	dash := cmd.GetDashboardModel()
+
+	var existing *models.Dashboard
+	if dash.Id > 0 {
+		var ok bool
+		if existing, ok = s.dashboards[dash.Id]; !ok || existing.OrgId != dash.OrgId {
+			return models.ErrDashboardNotFound
+		}
+
+		if dash.Version != existing.Version {
+			if !cmd.Overwrite {
+				return models.ErrDashboardVersionMismatch
+			}
+			dash.SetVersion(existing.Version)
+		}
+
+		if existing.PluginId != "" && !cmd.Overwrite {
+			return models.UpdatePluginDashboardError{PluginId: existing.PluginId}
+		}
+	}
+
+	if dash.Uid == "" {
+		dash.SetUid(s.newUid())
+	}
+
+	// the sql store has a unique index on the organization and the uid
+	if other := s.byUid(dash.OrgId, dash.Uid); other != nil && other.Id != dash.Id {
+		return models.ErrDashboardWithSameUIDExists
+	}
+
+	now := time.Now()
+	if existing == nil {
+		s.lastId++
+		dash.Id = s.lastId
+		dash.SetVersion(1)
+		dash.Created = now
+		dash.CreatedBy = dash.UpdatedBy
+		dash.Updated = now
+	} else {
+		dash.SetVersion(dash.Version + 1)
+		dash.Created = existing.Created
+		dash.CreatedBy = existing.CreatedBy
+		dash.HasAcl = existing.HasAcl
+		dash.Updated = now
+		if !cmd.UpdatedAt.IsZero() {
+			dash.Updated = cmd.UpdatedAt
+		}
+	}
+
+	// the sql store stores the queued commits in the transaction of the save
+	if err := s.Outbox.Insert(dash, cmd.SyncOutbox); err != nil {
+		return err
+	}
+
+	s.dashboards[dash.Id] = copyDashboard(dash)
+	cmd.Result = dash
+	return nil
+}
+
+func (s *FakeDashboardStore) deleteDashboard(cmd *models.DeleteDashboardCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dash, ok := s.dashboards[cmd.Id]
+	if !ok || dash.OrgId != cmd.OrgId {
+		return models.ErrDashboardNotFound
+	}
+
+	if models.IsProtectedDashboardUid(dash.Uid) {
+		return models.ErrDashboardProtected
+	}
+
+	if cmd.Version > 0 && cmd.Version != dash.Version {
+		return models.ErrDashboardVersionMismatch
+	}
+
+	ids := []int64{dash.Id}
+	if dash.IsFolder {
+		for _, child := range s.sorted() {
+			if child.FolderId == dash.Id {
+				ids = append(ids, child.Id)
+			}
+		}
+		if cmd.OnlyIfEmpty && len(ids) > 1 {
+			return models.ErrFolderNotEmpty
+		}
+	}
+
+	for _, id := range ids {
+		delete(s.dashboards, id)
+		delete(s.acls, id)
+		delete(s.provisioning, id)
+		delete(s.templates, id)
+		for folderId, template := range s.templates {
+			if template.DashboardId == id {
+				delete(s.templates, folderId)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDashboardBeforeSave checks the dashboard against the dashboard using its id or its uid and the
+// dashboard using its title in the folder, like the sql store
+func (s *FakeDashboardStore) validateDashboardBeforeSave(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+	if err := s.validateIdAndUid(cmd); err != nil {
+		return err
+	}
+	return s.validateTitleInFolder(cmd)
+}
+
+func (s *FakeDashboardStore) validateIdAndUid(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+	dash := cmd.Dashboard
+
+	var existingById *models.Dashboard
+	if dash.Id > 0 {
+		existingById = s.dashboards[dash.Id]
+		if existingById == nil || existingById.OrgId != dash.OrgId {
+			return models.ErrDashboardNotFound
+		}
+		if dash.Uid == "" {
+			dash.SetUid(existingById.Uid)
+		}
+	}
+
+	var existingByUid *models.Dashboard
+	if dash.Uid != "" {
+		existingByUid = s.byUid(dash.OrgId, dash.Uid)
+	}
+
+	if dash.FolderId > 0 && s.folder(dash.OrgId, dash.FolderId) == nil {
+		return models.ErrDashboardFolderNotFound
+	}
+
+	if existingById == nil && existingByUid == nil {
+		return nil
+	}
+
+	if existingById != nil && existingByUid != nil && existingById.Id != existingByUid.Id {
+		return models.ErrDashboardWithSameUIDExists
+	}
+
+	if existingById != nil && dash.Uid != existingById.Uid {
+		if models.IsProtectedDashboardUid(existingById.Uid) {
+			return models.ErrDashboardProtected
+		}
+		if !cmd.AllowUidChange {
+			return models.ErrDashboardUidChanged
+		}
+	}
+
+	existing := existingById
+	if existingById == nil {
+		dash.SetId(existingByUid.Id)
+		dash.SetUid(existingByUid.Uid)
+		existing = existingByUid
+
+		if !dash.IsFolder {
+			cmd.Result.IsParentFolderChanged = true
+		}
+	}
+
+	if existing.IsFolder != dash.IsFolder {
+		return models.ErrDashboardTypeMismatch
+	}
+
+	if !dash.IsFolder && dash.FolderId != existing.FolderId {
+		cmd.Result.IsParentFolderChanged = true
+	}
+
+	if dash.Version != existing.Version {
+		if !cmd.Overwrite {
+			return models.ErrDashboardVersionMismatch
+		}
+		dash.SetVersion(existing.Version)
+	}
+
+	if existing.PluginId != "" && !cmd.Overwrite {
+		return models.UpdatePluginDashboardError{PluginId: existing.PluginId}
+	}
+
+	return nil
+}
+
+func (s *FakeDashboardStore) validateTitleInFolder(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+	dash := cmd.Dashboard
+
+	existing := s.find(func(other *models.Dashboard) bool {
+		return other.OrgId == dash.OrgId && other.Slug == dash.Slug && (other.IsFolder || other.FolderId == dash.FolderId)
+	})
+	if existing == nil || existing.Id == dash.Id {
+		return nil
+	}
+
+	if existing.IsFolder && !dash.IsFolder {
+		return models.ErrDashboardWithSameNameAsFolder
+	}
+
+	if !existing.IsFolder && dash.IsFolder {
+		return models.ErrDashboardFolderWithSameNameAsDashboard
+	}
+
+	if !dash.IsFolder && (dash.FolderId != existing.FolderId || dash.Id == 0) {
+		cmd.Result.IsParentFolderChanged = true
+	}
+
+	if !cmd.Overwrite {
+		return models.ErrDashboardWithSameNameInFolderExists
+	}
+
+	dash.SetId(existing.Id)
+	dash.SetUid(existing.Uid)
+	dash.SetVersion(existing.Version)
+	return nil
+}
+
+// getDashboardSaveSnapshot fetches what a save is checked against like the sql store, without the teams
+func (s *FakeDashboardStore) getDashboardSaveSnapshot(query *models.GetDashboardSaveSnapshotQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := &models.DashboardSaveSnapshot{}
+
+	if query.Uid != "" {
+		if existing := s.byUid(query.OrgId, query.Uid); existing != nil {
+			snapshot.ExistingByUid = copyDashboard(existing)
+			snapshot.ExistingByUidProvisioned = s.provisioning[existing.Id] != nil
+		}
+	}
+
+	var existing *models.Dashboard
+	if query.DashboardId > 0 {
+		if dash, ok := s.dashboards[query.DashboardId]; ok && dash.OrgId == query.OrgId {
+			existing = dash
+			snapshot.Provisioning = s.provisioning[dash.Id]
+		}
+	}
+
+	if folder := s.folder(query.OrgId, query.FolderId); folder != nil {
+		snapshot.Folder = copyDashboard(folder)
+	}
+
+	if query.User.OrgRole != models.ROLE_ADMIN {
+		if query.DashboardId > 0 {
+			snapshot.Acl = s.aclInfo(query.OrgId, query.DashboardId)
+		}
+		if query.DashboardId == 0 || existing == nil || existing.FolderId != query.FolderId {
+			snapshot.FolderAcl = s.aclInfo(query.OrgId, query.FolderId)
+		}
+		if query.DashboardId == 0 {
+			snapshot.Acl = snapshot.FolderAcl
+		}
+	}
+
+	query.Result = snapshot
+	return nil
+}
+
+func (s *FakeDashboardStore) getDashboardAclInfoList(query *models.GetDashboardAclInfoListQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query.Result = s.aclInfo(query.OrgId, query.DashboardId)
+	return nil
+}
+
+// aclInfo returns the permissions of the dashboard and the permissions it inherits from its folder, with the
+// default permissions when neither the folder, or the dashboard in the General folder, has permissions set
+func (s *FakeDashboardStore) aclInfo(orgId int64, dashboardId int64) []*models.DashboardAclInfoDTO {
+	result := make([]*models.DashboardAclInfoDTO, 0)
+	if dashboardId == 0 {
+		return append(result, defaultAcl(false)...)
+	}
+
+	dash, ok := s.dashboards[dashboardId]
+	if !ok || dash.OrgId != orgId {
+		return result
+	}
+
+	for _, item := range s.acls[dash.Id] {
+		itemCopy := *item
+		result = append(result, &itemCopy)
+	}
+
+	if folder := s.folder(orgId, dash.FolderId); folder != nil {
+		for _, item := range s.acls[folder.Id] {
+			itemCopy := *item
+			itemCopy.Inherited = true
+			result = append(result, &itemCopy)
+		}
+		if !folder.HasAcl {
+			result = append(result, defaultAcl(true)...)
+		}
+	} else if !dash.HasAcl {
+		result = append(result, defaultAcl(false)...)
+	}
+
+	return result
+}
+
+// defaultAcl are the permissions of dashboards without permissions set, viewers view and editors edit
+func defaultAcl(inherited bool) []*models.DashboardAclInfoDTO {
+	viewer := models.ROLE_VIEWER
+	editor := models.ROLE_EDITOR
+
+	return []*models.DashboardAclInfoDTO{
+		{OrgId: -1, DashboardId: -1, Role: &viewer, Permission: models.PERMISSION_VIEW, Inherited: inherited},
+		{OrgId: -1, DashboardId: -1, Role: &editor, Permission: models.PERMISSION_EDIT, Inherited: inherited},
+	}
+}
+
+func (s *FakeDashboardStore) getTeamsByUser(query *models.GetTeamsByUserQuery) error {
+	query.Result = make([]*models.TeamDTO, 0)
+	return nil
+}
+
+func (s *FakeDashboardStore) validateDashboardAlerts(cmd *models.ValidateDashboardAlertsCommand) error {
+	return s.AlertValidationError
+}
+
+func (s *FakeDashboardStore) updateDashboardAlerts(cmd *models.UpdateDashboardAlertsCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.UpdatedAlerts = append(s.UpdatedAlerts, cmd.Dashboard.Id)
+	return nil
+}
+
+func (s *FakeDashboardStore) saveProvisionedDashboard(cmd *models.SaveProvisionedDashboardCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.save(cmd.DashboardCmd); err != nil {
+		return err
+	}
+
+	cmd.Result = cmd.DashboardCmd.Result
+	provisioning := *cmd.DashboardProvisioning
+	provisioning.DashboardId = cmd.Result.Id
+	if provisioning.Updated == 0 {
+		provisioning.Updated = cmd.Result.Updated.Unix()
+	}
+	s.provisioning[cmd.Result.Id] = &provisioning
+	return nil
+}
+
+func (s *FakeDashboardStore) getProvisionedDataByDashboardId(query *models.GetProvisionedDashboardDataByIdQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query.Result = s.provisioning[query.DashboardId]
+	return nil
+}
+
+func (s *FakeDashboardStore) getProvisionedDataByDashboardIds(query *models.GetProvisionedDashboardDataByIdsQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query.Result = make(map[int64]*models.DashboardProvisioning)
+	for _, id := range query.DashboardIds {
+		if provisioning, ok := s.provisioning[id]; ok {
+			query.Result[id] = provisioning
+		}
+	}
+	return nil
+}
+
+func (s *FakeDashboardStore) getProvisionedDashboardData(query *models.GetProvisionedDashboardDataQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query.Result = make([]*models.DashboardProvisioning, 0)
+	for _, dash := range s.sorted() {
+		if provisioning, ok := s.provisioning[dash.Id]; ok && provisioning.Name == query.Name {
+			query.Result = append(query.Result, provisioning)
+		}
+	}
+	return nil
+}
+
+func (s *FakeDashboardStore) unprovisionDashboard(cmd *models.UnprovisionDashboardCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.provisioning, cmd.Id)
+	return nil
+}
+
+func (s *FakeDashboardStore) getDashboardMaintenance(query *models.GetDashboardMaintenanceQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maintenance != nil {
+		maintenance := *s.maintenance
+		query.Result = &maintenance
+	}
+	return nil
+}
+
+func (s *FakeDashboardStore) setDashboardMaintenance(cmd *models.SetDashboardMaintenanceCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maintenance = &models.DashboardMaintenance{
+		Id:        1,
+		ReadOnly:  cmd.ReadOnly,
+		Message:   cmd.Message,
+		EndsAt:    cmd.EndsAt,
+		UpdatedBy: cmd.UpdatedBy,
+		Updated:   time.Now(),
+	}
+	maintenance := *s.maintenance
+	cmd.Result = &maintenance
+	return nil
+}
+
+func (s *FakeDashboardStore) getFolderTemplate(query *models.GetFolderTemplateQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if template, ok := s.templates[query.FolderId]; ok && template.OrgId == query.OrgId {
+		templateCopy := *template
+		query.Result = &templateCopy
+	}
+	return nil
+}
+
+func (s *FakeDashboardStore) setFolderTemplate(cmd *models.SetFolderTemplateCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cmd.DashboardId == 0 {
+		delete(s.templates, cmd.FolderId)
+		return nil
+	}
+
+	s.templates[cmd.FolderId] = &models.FolderTemplate{
+		Id:          cmd.FolderId,
+		OrgId:       cmd.OrgId,
+		FolderId:    cmd.FolderId,
+		DashboardId: cmd.DashboardId,
+		UpdatedBy:   cmd.UpdatedBy,
+		Updated:     time.Now(),
+	}
+	return nil
+}
+
+// FakeSyncOutbox keeps the queued dashboard commits in memory and handles the commands and queries of the sync
+// outbox the way the sql store does, claims included, so tests can run several sync queues against it. The
+// FakeDashboardStore stores the commits of its saves in its outbox, tests saving dashboards with their own
+// handlers call Insert.
+type FakeSyncOutbox struct {
+	mu     sync.Mutex
+	items  []*models.DashboardSyncOutboxItem
+	lastId int64
+}
+
+func NewFakeSyncOutbox() *FakeSyncOutbox {
+	return &FakeSyncOutbox{items: make([]*models.DashboardSyncOutboxItem, 0)}
+}
+
+// Register adds the handlers of the outbox to the bus, replacing the handlers of the same messages
+func (o *FakeSyncOutbox) Register() {
+	bus.AddHandler("test", o.insert)
+	bus.AddHandler("test", o.claim)
+	bus.AddHandler("test", o.complete)
+	bus.AddHandler("test", o.requeue)
+	bus.AddHandler("test", o.purge)
+	bus.AddHandler("test", o.prune)
+	bus.AddHandler("test", o.getItems)
+	bus.AddHandler("test", o.getCounts)
+}
+
+// Insert stores the commits of a save of the dashboard, the commits without a dashboard commit the saved one
+func (o *FakeSyncOutbox) Insert(dash *models.Dashboard, items []*models.DashboardSyncOutboxItem) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for _, item := range items {
+		if item.Dashboard == "" {
+			data, err := dash.Data.Encode()
+			if err != nil {
+				return err
+			}
+			item.Dashboard = string(data)
+			item.DashboardId = dash.Id
+			item.FolderId = dash.FolderId
+		}
+
+		o.lastId++
+		item.Id = o.lastId
+		item.OrgId = dash.OrgId
+		item.Status = models.DashboardSyncOutboxPending
+		item.NextRetry = now
+		item.Version = 1
+		item.Created = now
+		item.Updated = now
+
+		stored := *item
+		o.items = append(o.items, &stored)
+	}
+	return nil
+}
+
+// Item returns a copy of the stored item, nil when there is none with the id
+func (o *FakeSyncOutbox) Item(id int64) *models.DashboardSyncOutboxItem {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if item := o.find(id); item != nil {
+		stored := *item
+		return &stored
+	}
+	return nil
+}
+
+func (o *FakeSyncOutbox) find(id int64) *models.DashboardSyncOutboxItem {
+	for _, item := range o.items {
+		if item.Id == id {
+			return item
+		}
+	}
+	return nil
+}
+
+func (o *FakeSyncOutbox) insert(cmd *models.InsertDashboardSyncOutboxCommand) error {
+	return o.Insert(cmd.Dashboard, cmd.Items)
+}
+
+func (o *FakeSyncOutbox) claim(cmd *models.ClaimDashboardSyncOutboxItemCommand) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// the items are kept in the order of their ids
+	for i, item := range o.items {
+		pending := item.Status == models.DashboardSyncOutboxPending && (cmd.IgnoreRetry || !item.NextRetry.After(cmd.Now))
+		expired := item.Status == models.DashboardSyncOutboxInflight && !item.LeaseUntil.After(cmd.Now)
+		if !pending && !expired {
+			continue
+		}
+
+		earlier := false
+		for _, other := range o.items[:i] {
+			if other.OrgId == item.OrgId && other.DashboardId == item.DashboardId &&
+				(other.Status == models.DashboardSyncOutboxPending || other.Status == models.DashboardSyncOutboxInflight) {
+				earlier = true
+				break
+			}
+		}
+		if earlier {
+			continue
+		}
+
+		item.Status = models.DashboardSyncOutboxInflight
+		item.LeaseOwner = cmd.Owner
+		item.LeaseUntil = cmd.LeaseUntil
+		item.Attempts++
+		item.Version++
+		item.Updated = time.Now()
+
+		claimed := *item
+		cmd.Result = &claimed
+		return nil
+	}
+	return nil
+}
+
+func (o *FakeSyncOutbox) complete(cmd *models.CompleteDashboardSyncOutboxItemCommand) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	item := o.find(cmd.Id)
+	if item == nil {
+		return models.ErrDashboardSyncOutboxItemNotFound
+	}
+	if item.Version != cmd.Version || item.Status != models.DashboardSyncOutboxInflight {
+		return models.ErrDashboardSyncOutboxLeaseLost
+	}
+
+	item.Status = cmd.Status
+	item.Error = cmd.Error
+	item.LeaseOwner = ""
+	item.LeaseUntil = time.Time{}
+	item.Version++
+	item.Updated = time.Now()
+	if cmd.Status == models.DashboardSyncOutboxPending {
+		item.NextRetry = cmd.NextRetry
+	}
+	return nil
+}
+
+func (o *FakeSyncOutbox) selected(ids []int64, item *models.DashboardSyncOutboxItem) bool {
+	if len(ids) == 0 {
+		return item.Status == models.DashboardSyncOutboxFailed
+	}
+	for _, id := range ids {
+		if id == item.Id {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *FakeSyncOutbox) requeue(cmd *models.RequeueDashboardSyncOutboxCommand) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cmd.RequeuedRows = 0
+	for _, item := range o.items {
+		stuck := len(cmd.Ids) > 0 && item.Status == models.DashboardSyncOutboxInflight && !item.LeaseUntil.After(cmd.Now)
+		if !o.selected(cmd.Ids, item) || (item.Status != models.DashboardSyncOutboxFailed && !stuck) {
+			continue
+		}
+
+		item.Status = models.DashboardSyncOutboxPending
+		item.Attempts = 0
+		item.NextRetry = cmd.Now
+		item.LeaseOwner = ""
+		item.LeaseUntil = time.Time{}
+		item.Version++
+		item.Updated = time.Now()
+		cmd.RequeuedRows++
+	}
+	return nil
+}
+
+func (o *FakeSyncOutbox) purge(cmd *models.PurgeDashboardSyncOutboxCommand) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	kept := make([]*models.DashboardSyncOutboxItem, 0, len(o.items))
+	cmd.DeletedRows = 0
+	for _, item := range o.items {
+		if o.selected(cmd.Ids, item) && item.Status != models.DashboardSyncOutboxDone {
+			cmd.DeletedRows++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	o.items = kept
+	return nil
+}
+
+func (o *FakeSyncOutbox) prune(cmd *models.PruneDashboardSyncOutboxCommand) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	kept := make([]*models.DashboardSyncOutboxItem, 0, len(o.items))
+	cmd.DeletedRows = 0
+	for _, item := range o.items {
+		if item.Status == models.DashboardSyncOutboxDone && item.Updated.Before(cmd.DoneBefore) {
+			cmd.DeletedRows++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	o.items = kept
+	return nil
+}
+
+func (o *FakeSyncOutbox) getItems(query *models.GetDashboardSyncOutboxQuery) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	query.Result = make([]*models.DashboardSyncOutboxItem, 0)
+	for _, item := range o.items {
+		if query.OrgId != 0 && item.OrgId != query.OrgId {
+			continue
+		}
+		for _, status := range query.Statuses {
+			if item.Status == status {
+				stored := *item
+				query.Result = append(query.Result, &stored)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (o *FakeSyncOutbox) getCounts(query *models.GetDashboardSyncOutboxCountsQuery) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	query.Result = make(map[models.DashboardSyncOutboxStatus]int)
+	for _, item := range o.items {
+		if query.OrgId == 0 || item.OrgId == query.OrgId {
+			query.Result[item.Status]++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package dashboards
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/services/search"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// CloneResult is the result of cloning a folder with its dashboards
+type CloneResult struct {
+	Folder *models.Dashboard
+	// Uids maps the uid of every cloned dashboard to the uid of its copy
+	Uids map[string]string
+	// Dashboards are the copies in the order they were saved
+	Dashboards []*ClonedDashboard
+}
+
+// ClonedDashboard is the copy of a dashboard of the source folder
+type ClonedDashboard struct {
+	Uid         string
+	NewUid      string
+	DashboardId int64
+	BatchItemState
+}
+
+// CloneFolder creates a new folder with a copy of every dashboard of the source folder.
+// Copies get new uids, and links between dashboards of the source folder are changed to
+// point at the copies. Provisioned dashboards are cloned as regular dashboards. Unless batch_sync_failure_policy
+// is fail, copies whose commit fails are kept and the clone goes on. A copy failing its save stops the clone, the
+// new folder and the copies saved before it are returned with the error.
+func (dr *dashboardServiceImpl) CloneFolder(sourceFolderId int64, orgId int64, newFolderTitle string, user *models.SignedInUser) (*CloneResult, error) {
+	sourceFolder, err := getFolder(models.GetDashboardQuery{OrgId: orgId, Id: sourceFolderId})
+	if err != nil {
+		return nil, err
+	}
+
+	g := guardian.New(sourceFolder.Id, orgId, user)
+	if canView, err := g.CanView(); err != nil || !canView {
+		if err != nil {
+			return nil, toFolderError(err)
+		}
+		return nil, models.ErrFolderAccessDenied
+	}
+
+	sources, err := getFolderDashboards(sourceFolder.Id, orgId, user)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := models.NewDashboardFolder(newFolderTitle)
+	folder.OrgId = orgId
+
+	folderCmd, err := dr.buildSaveDashboardCommand(&SaveDashboardDTO{
+		Dashboard: folder,
+		OrgId:     orgId,
+		User:      user,
+	}, false, false)
+	if err != nil {
+		return nil, toFolderError(err)
+	}
+
+	if err := bus.Dispatch(folderCmd); err != nil {
+		return nil, toFolderError(err)
+	}
+
+	result := &CloneResult{
+		Folder:     folderCmd.Result,
+		Uids:       make(map[string]string, len(sources)),
+		Dashboards: make([]*ClonedDashboard, 0, len(sources)),
+	}
+
+	for _, source := range sources {
+		result.Uids[source.Uid] = dr.newID()
+	}
+
+	for _, source := range sources {
+		data, err := copyDashboardData(source.Data)
+		if err != nil {
+			return result, err
+		}
+
+		data.Set("id", nil)
+		data.Set("uid", result.Uids[source.Uid])
+		data.Del("version")
+		data = simplejson.NewFromAny(rewriteDashboardLinks(data.Interface(), result.Uids))
+
+		dash := models.NewDashboardFromJson(data)
+		dash.OrgId = orgId
+		dash.FolderId = result.Folder.Id
+
+		saved, err := dr.saveDashboardWithWarnings(&SaveDashboardDTO{
+			Dashboard: dash,
+			OrgId:     orgId,
+			User:      user,
+			Message:   "Cloned from " + source.Uid,
+
+			SyncFailurePolicy: setting.DashboardBatchSyncFailurePolicy,
+		})
+		if err != nil {
+			return result, err
+		}
+
+		cloned := &ClonedDashboard{Uid: source.Uid, NewUid: dash.Uid, DashboardId: saved.Dashboard.Id}
+		cloned.saved(saved)
+		result.Dashboards = append(result.Dashboards, cloned)
+	}
+
+	return result, nil
+}
+
+func getFolderDashboards(folderId int64, orgId int64, user *models.SignedInUser) ([]*models.Dashboard, error) {
+	searchQuery := search.Query{
+		SignedInUser: user,
+		OrgId:        orgId,
+		FolderIds:    []int64{folderId},
+		Type:         string(search.DashHitDB),
+		Permission:   models.PERMISSION_VIEW,
+	}
+
+	if err := bus.Dispatch(&searchQuery); err != nil {
+		return nil, err
+	}
+
+	if len(searchQuery.Result) == 0 {
+		return []*models.Dashboard{}, nil
+	}
+
+	dashboardIds := make([]int64, 0, len(searchQuery.Result))
+	for _, hit := range searchQuery.Result {
+		dashboardIds = append(dashboardIds, hit.Id)
+	}
+
+	query := models.GetDashboardsQuery{DashboardIds: dashboardIds}
+	if err := bus.Dispatch(&query); err != nil {
+		return nil, err
+	}
+
+	return query.Result, nil
+}
+
+func copyDashboardData(data *simplejson.Json) (*simplejson.Json, error) {
+	raw, err := data.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return simplejson.NewJson(raw)
+}
+
+// rewriteDashboardLinks replaces "/d/<uid>" references in every string of the dashboard
+// model with references to the uid the dashboard is mapped to.
+func rewriteDashboardLinks(value interface{}, uids map[string]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = rewriteDashboardLinks(item, uids)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = rewriteDashboardLinks(item, uids)
+		}
+		return v
+	case string:
+		for oldUid, newUid := range uids {
+			v = replaceDashboardUidInUrl(v, oldUid, newUid)
+		}
+		return v
+	}
+
+	return value
+}
+
+func replaceDashboardUidInUrl(url string, oldUid string, newUid string) string {
+	pattern := "/d/" + oldUid
+	var sb strings.Builder
+
+	for {
+		idx := strings.Index(url, pattern)
+		if idx < 0 {
+			sb.WriteString(url)
+			return sb.String()
+		}
+
+		end := idx + len(pattern)
+		// only replace complete uids, e.g. not "/d/abc" in "/d/abcd"
+		if end < len(url) && url[end] != '/' && url[end] != '?' && url[end] != '#' {
+			sb.WriteString(url[:end])
+		} else {
+			sb.WriteString(url[:idx] + "/d/" + newUid)
+		}
+		url = url[end:]
+	}
+}
@@ -0,0 +1,212 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/services/search"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCloneFolder(t *testing.T) {
+	Convey("Given a folder with two linked dashboards", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true, CanViewValue: true})
+
+		service := &dashboardServiceImpl{idGenerator: &fakeIDGenerator{}}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1}
+
+		folder := models.NewDashboardFolder("Team template")
+		folder.Id = 1
+		folder.Uid = "folder"
+
+		first := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+			"id":    2,
+			"uid":   "first",
+			"title": "First",
+			"links": []interface{}{
+				map[string]interface{}{"url": "/d/second/second?orgId=1"},
+				map[string]interface{}{"url": "/d/secondary/other"},
+			},
+		}))
+		first.FolderId = 1
+
+		second := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+			"id":    3,
+			"uid":   "second",
+			"title": "Second",
+			"panels": []interface{}{
+				map[string]interface{}{
+					"links": []interface{}{
+						map[string]interface{}{"url": "/d/first"},
+					},
+				},
+			},
+		}))
+		second.FolderId = 1
+
+		saved := make([]*models.SaveDashboardCommand, 0)
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Id == folder.Id {
+				query.Result = folder
+				return nil
+			}
+			for _, cmd := range saved {
+				if cmd.Result.Id == query.Id {
+					query.Result = cmd.Result
+					return nil
+				}
+			}
+			return models.ErrDashboardNotFound
+		})
+
+		bus.AddHandler("test", func(query *search.Query) error {
+			So(query.FolderIds, ShouldResemble, []int64{1})
+			query.Result = search.HitList{{Id: 2}, {Id: 3}}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardsQuery) error {
+			query.Result = []*models.Dashboard{first, second}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = snapshotWithFolder(query)
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			saved = append(saved, cmd)
+			cmd.Result = cmd.GetDashboardModel()
+			cmd.Result.Id = int64(10 + len(saved))
+			return nil
+		})
+
+		Convey("When cloning the folder", func() {
+			result, err := service.CloneFolder(1, 1, "Team copy", user)
+			So(err, ShouldBeNil)
+
+			Convey("Should create the folder and a copy of each dashboard", func() {
+				So(len(saved), ShouldEqual, 3)
+				So(saved[0].IsFolder, ShouldBeTrue)
+				So(result.Folder.Title, ShouldEqual, "Team copy")
+				So(result.Uids, ShouldResemble, map[string]string{"first": "uid-1", "second": "uid-2"})
+
+				for _, cmd := range saved[1:] {
+					So(cmd.FolderId, ShouldEqual, result.Folder.Id)
+					So(cmd.Dashboard.Get("id").Interface(), ShouldBeNil)
+				}
+
+				So(saved[1].Dashboard.Get("uid").MustString(), ShouldEqual, result.Uids["first"])
+				So(saved[2].Dashboard.Get("uid").MustString(), ShouldEqual, result.Uids["second"])
+			})
+
+			Convey("Should point links between cloned dashboards at the copies", func() {
+				links := saved[1].Dashboard.Get("links")
+				So(links.GetIndex(0).Get("url").MustString(), ShouldEqual, "/d/"+result.Uids["second"]+"/second?orgId=1")
+				So(links.GetIndex(1).Get("url").MustString(), ShouldEqual, "/d/secondary/other")
+
+				panelLink := saved[2].Dashboard.Get("panels").GetIndex(0).Get("links").GetIndex(0)
+				So(panelLink.Get("url").MustString(), ShouldEqual, "/d/"+result.Uids["first"])
+			})
+
+			Convey("Should not modify the source dashboards", func() {
+				So(first.Data.Get("links").GetIndex(0).Get("url").MustString(), ShouldEqual, "/d/second/second?orgId=1")
+			})
+		})
+
+		Convey("When the commits of the copies fail", func() {
+			origConnector, hadConnector := social.SocialMap["gitlab"]
+			connector := &fakeSyncConnector{orgId: 1, err: errors.New("commit failed")}
+			social.SocialMap["gitlab"] = connector
+			user.AuthModule = "gitlab"
+			user.Token = "token"
+
+			origPolicy := setting.DashboardBatchSyncFailurePolicy
+
+			Convey("Should keep the copies with their commit errors when warning", func() {
+				setting.DashboardBatchSyncFailurePolicy = setting.SyncFailurePolicyWarn
+
+				result, err := service.CloneFolder(1, 1, "Team copy", user)
+				So(err, ShouldBeNil)
+				So(len(saved), ShouldEqual, 3)
+				So(result.Dashboards, ShouldHaveLength, 2)
+				So(result.Dashboards[1], ShouldResemble, &ClonedDashboard{
+					Uid:            "second",
+					NewUid:         "uid-2",
+					DashboardId:    13,
+					BatchItemState: BatchItemState{DbSaved: true, SyncError: "commit failed"},
+				})
+			})
+
+			Convey("Should fail the clone when failing", func() {
+				setting.DashboardBatchSyncFailurePolicy = setting.SyncFailurePolicyFail
+
+				result, err := service.CloneFolder(1, 1, "Team copy", user)
+				So(err, ShouldEqual, connector.err)
+				So(result.Folder.Title, ShouldEqual, "Team copy")
+				So(result.Dashboards, ShouldBeEmpty)
+			})
+
+			Reset(func() {
+				setting.DashboardBatchSyncFailurePolicy = origPolicy
+				delete(social.SocialMap, "gitlab")
+				if hadConnector {
+					social.SocialMap["gitlab"] = origConnector
+				}
+			})
+		})
+
+		Convey("When the save of a copy fails", func() {
+			bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+				if cmd.Dashboard.Get("title").MustString() == "Second" {
+					return errors.New("database is locked")
+				}
+				saved = append(saved, cmd)
+				cmd.Result = cmd.GetDashboardModel()
+				cmd.Result.Id = int64(10 + len(saved))
+				return nil
+			})
+
+			Convey("Should return the folder and the copies saved before it", func() {
+				result, err := service.CloneFolder(1, 1, "Team copy", user)
+				So(err, ShouldNotBeNil)
+				So(result.Folder.Id, ShouldEqual, 11)
+				So(result.Dashboards, ShouldHaveLength, 1)
+				So(result.Dashboards[0].Uid, ShouldEqual, "first")
+				So(result.Dashboards[0].DashboardId, ShouldEqual, 12)
+			})
+		})
+
+		Convey("When cloning a dashboard that is not a folder", func() {
+			_, err := service.CloneFolder(2, 1, "Team copy", user)
+			So(err, ShouldEqual, models.ErrFolderNotFound)
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+		})
+	})
+}
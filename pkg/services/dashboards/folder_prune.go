@@ -0,0 +1,120 @@
+package dashboards
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// PrunedFolder is a folder deleted because the operation left it empty
+type PrunedFolder struct {
+	Id    int64  `json:"id"`
+	Uid   string `json:"uid"`
+	Title string `json:"title"`
+}
+
+// DeleteDashboardResult lists the folders pruned after deleting a dashboard
+type DeleteDashboardResult struct {
+	PrunedFolders []*PrunedFolder
+}
+
+// dashboardFolderId returns the folder of a dashboard about to be deleted, or 0 when empty folders are not pruned
+func dashboardFolderId(dashboardId int64, orgId int64) int64 {
+	if !setting.DashboardAutoPruneEmptyFolders {
+		return 0
+	}
+
+	query := &models.GetDashboardQuery{Id: dashboardId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return 0
+	}
+
+	return query.Result.FolderId
+}
+
+// pruneEmptyFolder deletes the folder when a delete or move left it without dashboards. It runs once the
+// operation is saved, so failures are logged rather than failing the operation. Provisioned and protected
+// folders, folders with custom permissions and folders created within the grace period are kept.
+func (dr *dashboardServiceImpl) pruneEmptyFolder(folderId int64, orgId int64) []*PrunedFolder {
+	pruned := make([]*PrunedFolder, 0)
+	if !setting.DashboardAutoPruneEmptyFolders || folderId == 0 {
+		return pruned
+	}
+
+	query := &models.GetDashboardQuery{Id: folderId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		dr.log.Warn("Failed to get folder to prune", "folderId", folderId, "error", err)
+		return pruned
+	}
+
+	folder := query.Result
+	if reason, err := dr.keepFolder(folder); reason != "" || err != nil {
+		if err != nil {
+			dr.log.Warn("Failed to check folder to prune", "folderId", folderId, "error", err)
+		} else {
+			dr.log.Debug("Keeping empty folder", "folderId", folderId, "reason", reason)
+		}
+		return pruned
+	}
+
+	cmd := &models.DeleteDashboardCommand{Id: folder.Id, OrgId: orgId, OnlyIfEmpty: true}
+	if err := bus.Dispatch(cmd); err != nil {
+		if err != models.ErrFolderNotEmpty {
+			dr.log.Warn("Failed to prune empty folder", "folderId", folderId, "error", err)
+		}
+		return pruned
+	}
+
+	dr.log.Info("Pruned empty folder", "folderId", folder.Id, "title", folder.Title)
+
+	// listeners remove what is left of the folder in git, e.g. its permissions file
+	err := bus.Publish(&events.DashboardDeleted{
+		Timestamp: dr.now(),
+		Id:        folder.Id,
+		Uid:       folder.Uid,
+		OrgId:     orgId,
+		Title:     folder.Title,
+		IsFolder:  true,
+	})
+	if err != nil {
+		dr.log.Warn("Failed to publish pruned folder", "folderId", folder.Id, "error", err)
+	}
+
+	return append(pruned, &PrunedFolder{Id: folder.Id, Uid: folder.Uid, Title: folder.Title})
+}
+
+// keepFolder returns why an empty folder must not be pruned, or an empty string
+func (dr *dashboardServiceImpl) keepFolder(folder *models.Dashboard) (string, error) {
+	if !folder.IsFolder {
+		return "not a folder", nil
+	}
+
+	if folder.HasAcl {
+		return "custom permissions", nil
+	}
+
+	if hasReservedPrefix(folder.Uid) {
+		return "protected", nil
+	}
+
+	if name := setting.DashboardDefaultImportFolder; name != "" && (folder.Uid == name || strings.EqualFold(folder.Title, name)) {
+		return "protected", nil
+	}
+
+	if dr.now().Sub(folder.Created) < setting.DashboardAutoPruneGracePeriod {
+		return "grace period", nil
+	}
+
+	provisioning, err := dr.GetProvisionedDashboardDataByDashboardId(folder.Id)
+	if err != nil {
+		return "", err
+	}
+	if provisioning != nil {
+		return "provisioned", nil
+	}
+
+	return "", nil
+}
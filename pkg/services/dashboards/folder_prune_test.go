@@ -0,0 +1,184 @@
+package dashboards
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPruneEmptyFolders(t *testing.T) {
+	Convey("Given a folder with a single dashboard", t, func() {
+		bus.ClearBusHandlers()
+
+		origPrune := setting.DashboardAutoPruneEmptyFolders
+		origGracePeriod := setting.DashboardAutoPruneGracePeriod
+		origImportFolder := setting.DashboardDefaultImportFolder
+		origReservedPrefixes := setting.DashboardReservedUidPrefixes
+		setting.DashboardAutoPruneEmptyFolders = true
+		setting.DashboardAutoPruneGracePeriod = 24 * time.Hour
+		setting.DashboardDefaultImportFolder = ""
+		setting.DashboardReservedUidPrefixes = []string{"system-"}
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		now := time.Date(2019, 8, 20, 14, 0, 0, 0, time.UTC)
+		folder := &models.Dashboard{Id: 1, Uid: "team-a", Title: "Team A", IsFolder: true, Created: now.Add(-48 * time.Hour)}
+		dashboard := &models.Dashboard{Id: 2, Uid: "dash", Title: "Dash", FolderId: 1, Version: 1}
+
+		stored := map[int64]*models.Dashboard{folder.Id: folder, dashboard.Id: dashboard}
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			dash, ok := stored[query.Id]
+			if !ok {
+				return models.ErrDashboardNotFound
+			}
+			query.Result = dash
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.DeleteDashboardCommand) error {
+			if cmd.OnlyIfEmpty {
+				for _, dash := range stored {
+					if dash.FolderId == cmd.Id {
+						return models.ErrFolderNotEmpty
+					}
+				}
+			}
+			delete(stored, cmd.Id)
+			return nil
+		})
+
+		provisioned := map[int64]bool{}
+		bus.AddHandler("test", func(query *models.GetProvisionedDashboardDataByIdQuery) error {
+			if provisioned[query.DashboardId] {
+				query.Result = &models.DashboardProvisioning{DashboardId: query.DashboardId}
+			}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = &models.DashboardSaveSnapshot{}
+			return nil
+		})
+
+		var published []*events.DashboardDeleted
+		bus.AddEventListener(func(event *events.DashboardDeleted) error {
+			published = append(published, event)
+			return nil
+		})
+
+		service := &dashboardServiceImpl{log: log.New("test"), clock: &fakeClock{now: now}}
+
+		shouldKeepFolder := func() {
+			result, err := service.DeleteDashboard(2, 1)
+			So(err, ShouldBeNil)
+			So(result.PrunedFolders, ShouldBeEmpty)
+			So(stored, ShouldContainKey, int64(1))
+			So(published, ShouldBeEmpty)
+		}
+
+		Convey("Should prune the folder after deleting its last dashboard", func() {
+			result, err := service.DeleteDashboard(2, 1)
+			So(err, ShouldBeNil)
+			So(result.PrunedFolders, ShouldResemble, []*PrunedFolder{{Id: 1, Uid: "team-a", Title: "Team A"}})
+			So(stored, ShouldBeEmpty)
+
+			So(len(published), ShouldEqual, 1)
+			So(published[0].Uid, ShouldEqual, "team-a")
+			So(published[0].IsFolder, ShouldBeTrue)
+			So(published[0].Timestamp, ShouldEqual, now)
+		})
+
+		Convey("Should prune the folder after deleting its last dashboard by version", func() {
+			result, err := service.DeleteDashboardIfVersion(2, 1, 1, &models.SignedInUser{UserId: 1})
+			So(err, ShouldBeNil)
+			So(len(result.PrunedFolders), ShouldEqual, 1)
+			So(stored, ShouldBeEmpty)
+		})
+
+		Convey("Should prune the folder after moving its last dashboard", func() {
+			bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+				cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+				return nil
+			})
+			bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+				return nil
+			})
+			bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+				return nil
+			})
+			bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+				cmd.Result = cmd.GetDashboardModel()
+				stored[cmd.Result.Id] = cmd.Result
+				return nil
+			})
+
+			moved := models.NewDashboard("Dash")
+			moved.Id = 2
+			moved.Version = 1
+			moved.Data.Set("id", 2)
+			moved.Data.Set("version", 1)
+
+			user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			result, err := service.SaveDashboardWithWarnings(&SaveDashboardDTO{OrgId: 1, User: user, Dashboard: moved, Overwrite: true})
+			So(err, ShouldBeNil)
+			So(result.PrunedFolders, ShouldResemble, []*PrunedFolder{{Id: 1, Uid: "team-a", Title: "Team A"}})
+			So(stored, ShouldNotContainKey, int64(1))
+		})
+
+		Convey("Should keep the folder when it is not empty", func() {
+			stored[3] = &models.Dashboard{Id: 3, Uid: "other", Title: "Other", FolderId: 1}
+
+			result, err := service.DeleteDashboard(2, 1)
+			So(err, ShouldBeNil)
+			So(result.PrunedFolders, ShouldBeEmpty)
+			So(stored, ShouldContainKey, int64(1))
+			So(published, ShouldBeEmpty)
+		})
+
+		Convey("Should keep the folder when pruning is disabled", func() {
+			setting.DashboardAutoPruneEmptyFolders = false
+			shouldKeepFolder()
+		})
+
+		Convey("Should keep a folder with custom permissions", func() {
+			folder.HasAcl = true
+			shouldKeepFolder()
+		})
+
+		Convey("Should keep a protected folder", func() {
+			folder.Uid = "system-folder"
+			shouldKeepFolder()
+		})
+
+		Convey("Should keep the default import folder", func() {
+			setting.DashboardDefaultImportFolder = "team a"
+			shouldKeepFolder()
+		})
+
+		Convey("Should keep a folder created within the grace period", func() {
+			folder.Created = now.Add(-time.Hour)
+			shouldKeepFolder()
+		})
+
+		Convey("Should keep a provisioned folder", func() {
+			provisioned[1] = true
+			shouldKeepFolder()
+		})
+
+		Reset(func() {
+			setting.DashboardAutoPruneEmptyFolders = origPrune
+			setting.DashboardAutoPruneGracePeriod = origGracePeriod
+			setting.DashboardDefaultImportFolder = origImportFolder
+			setting.DashboardReservedUidPrefixes = origReservedPrefixes
+			guardian.New = origNewDashboardGuardian
+			bus.ClearBusHandlers()
+		})
+	})
+}
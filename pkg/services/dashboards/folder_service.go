@@ -5,6 +5,7 @@ import (
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/guardian"
 	"github.com/grafana/grafana/pkg/services/search"
+	"golang.org/x/xerrors"
 )
 
 // FolderService service for operating on folders
@@ -15,13 +16,17 @@ type FolderService interface {
 	CreateFolder(cmd *models.CreateFolderCommand) error
 	UpdateFolder(uid string, cmd *models.UpdateFolderCommand) error
 	DeleteFolder(uid string) (*models.Folder, error)
+	SetFolderTemplate(uid string, dashboardUid string) error
+	GetFolderTemplate(uid string) (*models.Dashboard, error)
 }
 
 // NewFolderService factory for creating a new folder service
 var NewFolderService = func(orgId int64, user *models.SignedInUser) FolderService {
 	return &dashboardServiceImpl{
-		orgId: orgId,
-		user:  user,
+		orgId:       orgId,
+		user:        user,
+		clock:       realClock{},
+		idGenerator: shortUIDGenerator{},
 	}
 }
 
@@ -92,6 +97,10 @@ func (dr *dashboardServiceImpl) GetFolderByUID(uid string) (*models.Folder, erro
 }
 
 func (dr *dashboardServiceImpl) CreateFolder(cmd *models.CreateFolderCommand) error {
+	if err := dashboardMaintenance.check(); err != nil {
+		return err
+	}
+
 	dashFolder := cmd.GetDashboardModel(dr.orgId, dr.user.UserId)
 
 	dto := &SaveDashboardDTO{
@@ -122,6 +131,10 @@ func (dr *dashboardServiceImpl) CreateFolder(cmd *models.CreateFolderCommand) er
 }
 
 func (dr *dashboardServiceImpl) UpdateFolder(existingUid string, cmd *models.UpdateFolderCommand) error {
+	if err := dashboardMaintenance.check(); err != nil {
+		return err
+	}
+
 	query := models.GetDashboardQuery{OrgId: dr.orgId, Uid: existingUid}
 	dashFolder, err := getFolder(query)
 	if err != nil {
@@ -159,6 +172,10 @@ func (dr *dashboardServiceImpl) UpdateFolder(existingUid string, cmd *models.Upd
 }
 
 func (dr *dashboardServiceImpl) DeleteFolder(uid string) (*models.Folder, error) {
+	if err := dashboardMaintenance.check(); err != nil {
+		return nil, err
+	}
+
 	query := models.GetDashboardQuery{OrgId: dr.orgId, Uid: uid}
 	dashFolder, err := getFolder(query)
 	if err != nil {
@@ -213,7 +230,11 @@ func toFolderError(err error) error {
 		return models.ErrFolderTitleEmpty
 	}
 
-	if err == models.ErrDashboardUpdateAccessDenied {
+	if err == models.ErrDashboardTitleWhitespace {
+		return models.ErrFolderTitleWhitespace
+	}
+
+	if xerrors.Is(err, models.ErrDashboardUpdateAccessDenied) {
 		return models.ErrFolderAccessDenied
 	}
 
@@ -225,7 +246,7 @@ func toFolderError(err error) error {
 		return models.ErrFolderWithSameUIDExists
 	}
 
-	if err == models.ErrDashboardVersionMismatch {
+	if xerrors.Is(err, models.ErrDashboardVersionMismatch) {
 		return models.ErrFolderVersionMismatch
 	}
 
@@ -36,6 +36,11 @@ func TestFolderService(t *testing.T) {
 				return models.ErrDashboardUpdateAccessDenied
 			})
 
+			bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+				query.Result = &models.DashboardSaveSnapshot{}
+				return nil
+			})
+
 			Convey("When get folder by id should return access denied error", func() {
 				_, err := service.GetFolderByID(1)
 				So(err, ShouldNotBeNil)
@@ -110,11 +115,9 @@ func TestFolderService(t *testing.T) {
 				return nil
 			})
 
-			provisioningValidated := false
-
-			bus.AddHandler("test", func(query *models.GetProvisionedDashboardDataByIdQuery) error {
-				provisioningValidated = true
-				query.Result = nil
+			// folders are saved without checking whether they are provisioned
+			bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+				query.Result = &models.DashboardSaveSnapshot{Provisioning: &models.DashboardProvisioning{}}
 				return nil
 			})
 
@@ -123,7 +126,6 @@ func TestFolderService(t *testing.T) {
 					Title: "Folder",
 				})
 				So(err, ShouldBeNil)
-				So(provisioningValidated, ShouldBeFalse)
 			})
 
 			Convey("When updating folder should not return access denied error", func() {
@@ -132,7 +134,6 @@ func TestFolderService(t *testing.T) {
 					Title: "Folder",
 				})
 				So(err, ShouldBeNil)
-				So(provisioningValidated, ShouldBeFalse)
 			})
 
 			Convey("When deleting folder by uid should not return access denied error", func() {
@@ -183,6 +184,7 @@ func TestFolderService(t *testing.T) {
 				ExpectedError error
 			}{
 				{ActualError: models.ErrDashboardTitleEmpty, ExpectedError: models.ErrFolderTitleEmpty},
+				{ActualError: models.ErrDashboardTitleWhitespace, ExpectedError: models.ErrFolderTitleWhitespace},
 				{ActualError: models.ErrDashboardUpdateAccessDenied, ExpectedError: models.ErrFolderAccessDenied},
 				{ActualError: models.ErrDashboardWithSameNameInFolderExists, ExpectedError: models.ErrFolderSameNameExists},
 				{ActualError: models.ErrDashboardWithSameUIDExists, ExpectedError: models.ErrFolderWithSameUIDExists},
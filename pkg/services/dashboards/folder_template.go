@@ -0,0 +1,244 @@
+package dashboards
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+)
+
+// SetFolderTemplate designates the dashboard of dashboardUid as the template of the folder, an empty dashboardUid
+// removes the template of the folder. Only the admins of the folder set its template, which must be a dashboard
+// they can view.
+func (dr *dashboardServiceImpl) SetFolderTemplate(uid string, dashboardUid string) error {
+	folder, err := getFolder(models.GetDashboardQuery{OrgId: dr.orgId, Uid: uid})
+	if err != nil {
+		return err
+	}
+
+	g := guardian.New(folder.Id, dr.orgId, dr.user)
+	if canAdmin, err := g.CanAdmin(); err != nil || !canAdmin {
+		if err != nil {
+			return toFolderError(err)
+		}
+		return models.ErrFolderAccessDenied
+	}
+
+	cmd := &models.SetFolderTemplateCommand{OrgId: dr.orgId, FolderId: folder.Id, UpdatedBy: dr.user.UserId}
+	if dashboardUid != "" {
+		query := &models.GetDashboardQuery{OrgId: dr.orgId, Uid: dashboardUid}
+		if err := bus.Dispatch(query); err != nil {
+			return err
+		}
+
+		if query.Result.IsFolder {
+			return models.ErrFolderTemplateIsFolder
+		}
+
+		g := guardian.New(query.Result.Id, dr.orgId, dr.user)
+		if canView, err := g.CanView(); err != nil || !canView {
+			if err != nil {
+				return err
+			}
+			return models.ErrDashboardUpdateAccessDenied
+		}
+
+		cmd.DashboardId = query.Result.Id
+	}
+
+	return bus.Dispatch(cmd)
+}
+
+// GetFolderTemplate returns the template dashboard of the folder, nil when the folder has none
+func (dr *dashboardServiceImpl) GetFolderTemplate(uid string) (*models.Dashboard, error) {
+	folder, err := dr.GetFolderByUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return getFolderTemplate(dr.orgId, folder.Id)
+}
+
+// getFolderTemplate returns the template dashboard of the folder, nil when the folder has none or its template
+// was deleted meanwhile
+func getFolderTemplate(orgId int64, folderId int64) (*models.Dashboard, error) {
+	templateQuery := &models.GetFolderTemplateQuery{OrgId: orgId, FolderId: folderId}
+	if err := bus.Dispatch(templateQuery); err != nil {
+		return nil, err
+	}
+
+	if templateQuery.Result == nil {
+		return nil, nil
+	}
+
+	query := &models.GetDashboardQuery{OrgId: orgId, Id: templateQuery.Result.DashboardId}
+	if err := bus.Dispatch(query); err != nil {
+		if err == models.ErrDashboardNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return query.Result, nil
+}
+
+// applyFolderTemplate merges the template of the folder into new dashboards saved with ApplyFolderTemplate. The
+// template itself is never merged, for instance when it is saved again from an export of it.
+func applyFolderTemplate(dto *SaveDashboardDTO) error {
+	dash := dto.Dashboard
+	if !dto.ApplyFolderTemplate || dash.IsFolder || dash.Id != 0 {
+		return nil
+	}
+
+	template, err := getFolderTemplate(dto.OrgId, dash.FolderId)
+	if err != nil || template == nil {
+		return err
+	}
+
+	if dash.Uid != "" && dash.Uid == template.Uid {
+		return nil
+	}
+
+	mergeFolderTemplate(dash.Data, template.Data)
+	return nil
+}
+
+// mergeFolderTemplate merges the panels, variables and tags of the template beneath the ones of the dashboard. The
+// panels of the template are prepended, at the top of the dashboard, and the panels of the dashboard are moved
+// down below them. Template panels using the id of a panel of the dashboard get the next free ids. The variables
+// of the template come first, except the ones the dashboard defines with the same name, which keep the definition
+// and the position of the dashboard. The tags of the template the dashboard does not have are appended to its tags.
+func mergeFolderTemplate(data *simplejson.Json, template *simplejson.Json) {
+	mergeTemplatePanels(data, template)
+	mergeTemplateVariables(data, template)
+	mergeTemplateTags(data, template)
+}
+
+func mergeTemplatePanels(data *simplejson.Json, template *simplejson.Json) {
+	templatePanels := template.Get("panels").MustArray()
+	if len(templatePanels) == 0 {
+		return
+	}
+	panels := data.Get("panels").MustArray()
+
+	// the ids of the panels of collapsed rows are used too
+	used := make(map[int64]bool)
+	var maxId int64
+	for _, panel := range panels {
+		for _, id := range panelIds(simplejson.NewFromAny(panel)) {
+			used[id] = true
+			if id > maxId {
+				maxId = id
+			}
+		}
+	}
+
+	var height int64
+	merged := make([]interface{}, 0, len(templatePanels)+len(panels))
+	for _, item := range templatePanels {
+		panel := simplejson.NewFromAny(item)
+		renumberTemplatePanel(panel, used, &maxId)
+		for _, row := range panel.Get("panels").MustArray() {
+			renumberTemplatePanel(simplejson.NewFromAny(row), used, &maxId)
+		}
+
+		gridPos := panel.Get("gridPos")
+		if bottom := gridPos.Get("y").MustInt64() + gridPos.Get("h").MustInt64(); bottom > height {
+			height = bottom
+		}
+		merged = append(merged, panel.Interface())
+	}
+
+	for _, item := range panels {
+		panel := simplejson.NewFromAny(item)
+		movePanelDown(panel, height)
+		for _, row := range panel.Get("panels").MustArray() {
+			movePanelDown(simplejson.NewFromAny(row), height)
+		}
+		merged = append(merged, panel.Interface())
+	}
+
+	data.Set("panels", merged)
+}
+
+func panelIds(panel *simplejson.Json) []int64 {
+	ids := []int64{panel.Get("id").MustInt64()}
+	for _, row := range panel.Get("panels").MustArray() {
+		ids = append(ids, simplejson.NewFromAny(row).Get("id").MustInt64())
+	}
+	return ids
+}
+
+func renumberTemplatePanel(panel *simplejson.Json, used map[int64]bool, maxId *int64) {
+	id := panel.Get("id").MustInt64()
+	if id > 0 && !used[id] {
+		used[id] = true
+		return
+	}
+
+	*maxId++
+	for used[*maxId] {
+		*maxId++
+	}
+	used[*maxId] = true
+	panel.Set("id", *maxId)
+}
+
+func movePanelDown(panel *simplejson.Json, height int64) {
+	if gridPos, ok := panel.CheckGet("gridPos"); ok && height > 0 {
+		gridPos.Set("y", gridPos.Get("y").MustInt64()+height)
+	}
+}
+
+func mergeTemplateVariables(data *simplejson.Json, template *simplejson.Json) {
+	defaults := templateVariables(template)
+	if len(defaults) == 0 {
+		return
+	}
+	variables := templateVariables(data)
+
+	names := make(map[string]bool)
+	for _, variable := range variables {
+		names[strings.TrimSpace(variable.Get("name").MustString())] = true
+	}
+
+	merged := make([]interface{}, 0, len(defaults)+len(variables))
+	for _, variable := range defaults {
+		if !names[strings.TrimSpace(variable.Get("name").MustString())] {
+			merged = append(merged, variable.Interface())
+		}
+	}
+	for _, variable := range variables {
+		merged = append(merged, variable.Interface())
+	}
+
+	data.SetPath([]string{"templating", "list"}, merged)
+}
+
+func mergeTemplateTags(data *simplejson.Json, template *simplejson.Json) {
+	templateTags := template.Get("tags").MustStringArray()
+	if len(templateTags) == 0 {
+		return
+	}
+	tags := data.Get("tags").MustStringArray()
+
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		seen[tag] = true
+	}
+
+	merged := make([]interface{}, 0, len(tags)+len(templateTags))
+	for _, tag := range tags {
+		merged = append(merged, tag)
+	}
+	for _, tag := range templateTags {
+		if !seen[tag] {
+			seen[tag] = true
+			merged = append(merged, tag)
+		}
+	}
+
+	data.Set("tags", merged)
+}
@@ -0,0 +1,219 @@
+package dashboards
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMergeFolderTemplate(t *testing.T) {
+	Convey("Given a folder template with panels, variables and tags", t, func() {
+		template := simplejson.NewFromAny(map[string]interface{}{
+			"panels": []interface{}{
+				map[string]interface{}{"id": 1, "type": "text", "gridPos": map[string]interface{}{"x": 0, "y": 0, "w": 24, "h": 3}},
+				map[string]interface{}{"id": 2, "type": "row", "gridPos": map[string]interface{}{"x": 0, "y": 3, "w": 24, "h": 1}},
+			},
+			"templating": map[string]interface{}{
+				"list": []interface{}{
+					map[string]interface{}{"name": "datasource", "type": "datasource", "query": "prometheus"},
+					map[string]interface{}{"name": "env", "type": "custom", "query": "prod,staging"},
+				},
+			},
+			"tags": []interface{}{"team-ops", "standard"},
+		})
+
+		Convey("Should use the template as is for an empty dashboard", func() {
+			data := simplejson.NewFromAny(map[string]interface{}{"title": "New"})
+			mergeFolderTemplate(data, template)
+
+			So(panelIdsOf(data), ShouldResemble, []int64{1, 2})
+			So(variableNamesOf(data), ShouldResemble, []string{"datasource", "env"})
+			So(data.Get("tags").MustStringArray(), ShouldResemble, []string{"team-ops", "standard"})
+		})
+
+		Convey("Should prepend the template panels and move the panels of the dashboard below them", func() {
+			data := simplejson.NewFromAny(map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{"id": 1, "type": "graph", "gridPos": map[string]interface{}{"x": 0, "y": 0, "w": 12, "h": 8}},
+					map[string]interface{}{"id": 4, "type": "row", "collapsed": true, "gridPos": map[string]interface{}{"x": 0, "y": 8, "w": 24, "h": 1},
+						"panels": []interface{}{
+							map[string]interface{}{"id": 3, "type": "graph", "gridPos": map[string]interface{}{"x": 0, "y": 9, "w": 12, "h": 8}},
+						},
+					},
+				},
+			})
+			mergeFolderTemplate(data, template)
+
+			// the template panel 1 gets the first id free after the ids of the dashboard
+			So(panelIdsOf(data), ShouldResemble, []int64{5, 2, 1, 4})
+			panels := data.Get("panels")
+			So(panels.GetIndex(0).Get("type").MustString(), ShouldEqual, "text")
+			So(panels.GetIndex(0).Get("gridPos").Get("y").MustInt64(), ShouldEqual, 0)
+			So(panels.GetIndex(2).Get("type").MustString(), ShouldEqual, "graph")
+			So(panels.GetIndex(2).Get("gridPos").Get("y").MustInt64(), ShouldEqual, 4)
+			So(panels.GetIndex(3).Get("gridPos").Get("y").MustInt64(), ShouldEqual, 12)
+			So(panels.GetIndex(3).Get("panels").GetIndex(0).Get("gridPos").Get("y").MustInt64(), ShouldEqual, 13)
+		})
+
+		Convey("Should keep the variables of the dashboard over the template variables of the same name", func() {
+			data := simplejson.NewFromAny(map[string]interface{}{
+				"templating": map[string]interface{}{
+					"list": []interface{}{
+						map[string]interface{}{"name": "host", "type": "query"},
+						map[string]interface{}{"name": "env", "type": "custom", "query": "dev"},
+					},
+				},
+			})
+			mergeFolderTemplate(data, template)
+
+			So(variableNamesOf(data), ShouldResemble, []string{"datasource", "host", "env"})
+			So(templateVariables(data)[2].Get("query").MustString(), ShouldEqual, "dev")
+		})
+
+		Convey("Should append the template tags the dashboard does not have", func() {
+			data := simplejson.NewFromAny(map[string]interface{}{"tags": []interface{}{"standard", "cpu"}})
+			mergeFolderTemplate(data, template)
+
+			So(data.Get("tags").MustStringArray(), ShouldResemble, []string{"standard", "cpu", "team-ops"})
+		})
+
+		Convey("Should merge the same way every time", func() {
+			merged := func() string {
+				data := simplejson.NewFromAny(map[string]interface{}{
+					"panels": []interface{}{map[string]interface{}{"id": 2, "gridPos": map[string]interface{}{"y": 0, "h": 4}}},
+					"tags":   []interface{}{"cpu"},
+				})
+				templateData, _ := template.Encode()
+				templateCopy, _ := simplejson.NewJson(templateData)
+				mergeFolderTemplate(data, templateCopy)
+				encoded, _ := data.Encode()
+				return string(encoded)
+			}
+
+			first := merged()
+			for i := 0; i < 5; i++ {
+				So(merged(), ShouldEqual, first)
+			}
+		})
+	})
+}
+
+func TestFolderTemplate(t *testing.T) {
+	Convey("Given the dashboard service on an in-memory store", t, func() {
+		bus.ClearBusHandlers()
+
+		store := NewFakeDashboardStore()
+		store.Register()
+
+		service := NewServiceWithDeps(&fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}, shortUIDGenerator{})
+		admin := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_ADMIN}
+		editor := &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+
+		folder := store.AddFolder(1, "Ops")
+		template := store.Dashboard(store.AddDashboard(1, folder.Id, "Ops template").Id)
+		template.Data.Set("panels", []interface{}{
+			map[string]interface{}{"id": 1, "type": "text", "gridPos": map[string]interface{}{"x": 0, "y": 0, "w": 24, "h": 3}},
+		})
+		template.Data.Set("tags", []interface{}{"team-ops"})
+		_, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: admin, Dashboard: template})
+		So(err, ShouldBeNil)
+
+		newDashboard := func(title string) *models.Dashboard {
+			dash := models.NewDashboard(title)
+			dash.OrgId = 1
+			dash.FolderId = folder.Id
+			return dash
+		}
+
+		Convey("Should only let the admins of the folder set its template", func() {
+			err := NewFolderService(1, editor).SetFolderTemplate(folder.Uid, template.Uid)
+			So(err, ShouldEqual, models.ErrFolderAccessDenied)
+
+			err = NewFolderService(1, admin).SetFolderTemplate(folder.Uid, folder.Uid)
+			So(err, ShouldEqual, models.ErrFolderTemplateIsFolder)
+
+			err = NewFolderService(1, admin).SetFolderTemplate(folder.Uid, "missing")
+			So(err, ShouldEqual, models.ErrDashboardNotFound)
+		})
+
+		Convey("Given the template of the folder", func() {
+			So(NewFolderService(1, admin).SetFolderTemplate(folder.Uid, template.Uid), ShouldBeNil)
+
+			current, err := NewFolderService(1, editor).GetFolderTemplate(folder.Uid)
+			So(err, ShouldBeNil)
+			So(current.Uid, ShouldEqual, template.Uid)
+
+			Convey("Should merge the template into new dashboards saved with ApplyFolderTemplate", func() {
+				saved, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: editor, Dashboard: newDashboard("CPU"), ApplyFolderTemplate: true})
+				So(err, ShouldBeNil)
+
+				stored := store.Dashboard(saved.Id)
+				So(panelIdsOf(stored.Data), ShouldResemble, []int64{1})
+				So(stored.GetTags(), ShouldResemble, []string{"team-ops"})
+
+				Convey("Should not merge the template into existing dashboards", func() {
+					stored.Data.Set("panels", []interface{}{})
+					_, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: editor, Dashboard: stored, ApplyFolderTemplate: true})
+					So(err, ShouldBeNil)
+					So(panelIdsOf(store.Dashboard(saved.Id).Data), ShouldBeEmpty)
+				})
+			})
+
+			Convey("Should not merge the template without ApplyFolderTemplate or in other folders", func() {
+				saved, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: editor, Dashboard: newDashboard("CPU")})
+				So(err, ShouldBeNil)
+				So(panelIdsOf(store.Dashboard(saved.Id).Data), ShouldBeEmpty)
+
+				other := newDashboard("Memory")
+				other.FolderId = 0
+				saved, err = service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: editor, Dashboard: other, ApplyFolderTemplate: true})
+				So(err, ShouldBeNil)
+				So(panelIdsOf(store.Dashboard(saved.Id).Data), ShouldBeEmpty)
+			})
+
+			Convey("Should not merge the template into itself", func() {
+				// an export of the template imported again over it
+				restored := newDashboard("Ops template")
+				restored.SetUid(template.Uid)
+				restored.Data.Set("tags", []interface{}{"restored"})
+
+				saved, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: admin, Dashboard: restored, ApplyFolderTemplate: true, Overwrite: true})
+				So(err, ShouldBeNil)
+				So(saved.Id, ShouldEqual, template.Id)
+				So(store.Dashboard(saved.Id).GetTags(), ShouldResemble, []string{"restored"})
+			})
+
+			Convey("Should forget the template once it is deleted", func() {
+				So(store.deleteDashboard(&models.DeleteDashboardCommand{Id: template.Id, OrgId: 1}), ShouldBeNil)
+
+				current, err := NewFolderService(1, editor).GetFolderTemplate(folder.Uid)
+				So(err, ShouldBeNil)
+				So(current, ShouldBeNil)
+
+				saved, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: editor, Dashboard: newDashboard("CPU"), ApplyFolderTemplate: true})
+				So(err, ShouldBeNil)
+				So(panelIdsOf(store.Dashboard(saved.Id).Data), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func panelIdsOf(data *simplejson.Json) []int64 {
+	ids := make([]int64, 0)
+	for _, panel := range data.Get("panels").MustArray() {
+		ids = append(ids, simplejson.NewFromAny(panel).Get("id").MustInt64())
+	}
+	return ids
+}
+
+func variableNamesOf(data *simplejson.Json) []string {
+	names := make([]string, 0)
+	for _, variable := range templateVariables(data) {
+		names = append(names, variable.Get("name").MustString())
+	}
+	return names
+}
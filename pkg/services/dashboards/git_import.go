@@ -0,0 +1,239 @@
+package dashboards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+var getSyncRepo = social.GetSyncRepo
+
+var ErrGitImportNotSupported = errors.New("No repository supporting dashboard import is configured for the organization")
+
+// errGitFileInDatabase marks files of dashboards that are already in the database under another path
+var errGitFileInDatabase = errors.New("dashboard already exists")
+
+// ImportGitOnlyOptions controls the import of the dashboards added directly to the repository
+type ImportGitOnlyOptions struct {
+	// DryRun lists the dashboards that would be imported without saving them or creating folders
+	DryRun bool
+}
+
+// ImportedFile is the result of importing a dashboard file of the repository
+type ImportedFile struct {
+	Path        string `json:"path"`
+	Folder      string `json:"folder"`
+	Title       string `json:"title,omitempty"`
+	DashboardId int64  `json:"dashboardId,omitempty"`
+	Author      string `json:"author,omitempty"`
+	// SourceFormat is set when the file is rendered to json, e.g. jsonnet
+	SourceFormat string `json:"sourceFormat,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ImportReport is the summary of an import of git-only dashboards. Files synced from Grafana, or holding
+// the uid of an existing dashboard, are counted as skipped.
+type ImportReport struct {
+	DryRun  bool            `json:"dryRun"`
+	Created []*ImportedFile `json:"created"`
+	Failed  []*ImportedFile `json:"failed"`
+	Skipped int             `json:"skipped"`
+}
+
+// ImportGitOnlyDashboards imports the dashboard files of the repository that have no dashboard in the database,
+// e.g. because they were committed directly to git. Each file is imported into the folder named by its directory,
+// which is created if missing. A failing file does not stop the import of the others. Jsonnet files are rendered
+// when the repository enables them, and their dashboards are never committed back to the repository.
+func (dr *dashboardServiceImpl) ImportGitOnlyDashboards(orgId int64, user *models.SignedInUser, opts ImportGitOnlyOptions) (*ImportReport, error) {
+	reader, ok := getGitProvider(orgId).(social.DashboardFileReader)
+	repo := getSyncRepo(orgId)
+	if !ok || repo == nil {
+		return nil, ErrGitImportNotSupported
+	}
+
+	files, err := reader.ListDashboardFiles(orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &models.GetDashboardGitSyncsQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	synced := make(map[string]bool, len(query.Result))
+	for _, sync := range query.Result {
+		synced[sync.FilePath] = true
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Created: make([]*ImportedFile, 0), Failed: make([]*ImportedFile, 0)}
+	folderIds := make(map[string]int64)
+
+	for _, file := range files {
+		if synced[file.Path] {
+			report.Skipped++
+			continue
+		}
+
+		imported := &ImportedFile{Path: file.Path, Folder: file.Folder}
+		err := dr.importGitFile(reader, repo, orgId, user, file, folderIds, imported, opts.DryRun)
+
+		switch {
+		case err == errGitFileInDatabase:
+			report.Skipped++
+		case err != nil:
+			imported.Error = err.Error()
+			report.Failed = append(report.Failed, imported)
+		default:
+			report.Created = append(report.Created, imported)
+		}
+	}
+
+	return report, nil
+}
+
+func (dr *dashboardServiceImpl) importGitFile(reader social.DashboardFileReader, repo *social.SyncRepo, orgId int64, user *models.SignedInUser,
+	file social.DashboardFile, folderIds map[string]int64, imported *ImportedFile, dryRun bool) error {
+
+	content, err := reader.ReadFile(orgId, file.Path)
+	if err != nil {
+		return err
+	}
+
+	if isJsonnetFile(file.Path) {
+		sources, ok := reader.(social.JsonnetSourceReader)
+		if !ok || sources.JsonnetSettings(orgId) == nil {
+			return fmt.Errorf("Jsonnet files are not rendered for the repository")
+		}
+
+		content, err = renderJsonnet(reader, orgId, file.Path, content, sources.JsonnetSettings(orgId))
+		if err != nil {
+			return err
+		}
+		imported.SourceFormat = models.GitSourceFormatJsonnet
+	}
+
+	data, err := simplejson.NewJson([]byte(content))
+	if err != nil {
+		return err
+	}
+
+	// the id of the file belongs to the instance it was exported from
+	data.Del("id")
+	imported.Title = strings.TrimSpace(data.Get("title").MustString())
+
+	if uid := data.Get("uid").MustString(); uid != "" {
+		uidQuery := &models.GetDashboardQuery{OrgId: orgId, Uid: uid}
+		err := bus.Dispatch(uidQuery)
+		if err == nil {
+			return errGitFileInDatabase
+		}
+		if err != models.ErrDashboardNotFound {
+			return err
+		}
+	}
+
+	folderId, err := dr.getImportFolderId(orgId, user, file.Folder, folderIds, dryRun)
+	if err != nil || dryRun {
+		return err
+	}
+
+	saveCmd := models.SaveDashboardCommand{
+		Dashboard: data,
+		OrgId:     orgId,
+		UserId:    user.UserId,
+		FolderId:  folderId,
+		Source:    models.DashboardSourceGitImport,
+	}
+
+	dto := &SaveDashboardDTO{
+		OrgId:     orgId,
+		Dashboard: saveCmd.GetDashboardModel(),
+		User:      user,
+		Source:    models.DashboardSourceGitImport,
+	}
+
+	cmd, err := dr.buildSaveDashboardCommand(dto, false, true)
+	if err != nil {
+		return err
+	}
+
+	dr.attributeGitImport(reader, orgId, file.Path, cmd, imported)
+
+	if err := bus.Dispatch(cmd); err != nil {
+		return err
+	}
+	imported.DashboardId = cmd.Result.Id
+
+	// the file is the synced copy of the dashboard from now on, or its source when it was rendered
+	return bus.Dispatch(&models.SaveDashboardGitSyncCommand{
+		DashboardId:  cmd.Result.Id,
+		OrgId:        orgId,
+		Provider:     repo.Provider,
+		RepoId:       repo.RepoId,
+		FilePath:     file.Path,
+		SourceFormat: imported.SourceFormat,
+	})
+}
+
+// attributeGitImport credits the imported version to the Grafana user who last changed the file. Authors who
+// cannot be mapped to a single member of the organization are named in the version message instead, and the
+// version is credited to the user running the import.
+func (dr *dashboardServiceImpl) attributeGitImport(reader social.DashboardFileReader, orgId int64, filePath string, cmd *models.SaveDashboardCommand, imported *ImportedFile) {
+	authors, ok := reader.(social.FileAuthorReader)
+	if !ok {
+		return
+	}
+
+	author, err := authors.FileAuthor(orgId, filePath)
+	if err != nil {
+		dr.log.Warn("Failed to get the author of an imported dashboard file", "path", filePath, "orgId", orgId, "error", err)
+		return
+	}
+	imported.Author = author.String()
+
+	if lookup, ok := reader.(social.UserLookup); ok {
+		user, err := lookup.LookupGrafanaUser(context.Background(), orgId, *author)
+		if err == nil {
+			cmd.UserId = user.UserId
+			cmd.Message = "Imported from git"
+			return
+		}
+		if err != models.ErrUserNotFound {
+			dr.log.Warn("Failed to map the author of an imported dashboard file", "path", filePath, "author", imported.Author, "error", err)
+		}
+	}
+
+	cmd.Message = fmt.Sprintf("Imported from git, last changed by %s", imported.Author)
+}
+
+// getImportFolderId returns the id of the folder with the title, creating it unless this is a dry run
+func (dr *dashboardServiceImpl) getImportFolderId(orgId int64, user *models.SignedInUser, title string, folderIds map[string]int64, dryRun bool) (int64, error) {
+	if strings.EqualFold(title, models.RootFolderName) {
+		return 0, nil
+	}
+
+	key := strings.ToLower(title)
+	if id, ok := folderIds[key]; ok {
+		return id, nil
+	}
+
+	id, err := getFolderIdByTitle(orgId, title)
+	if err != nil || id > 0 || dryRun {
+		return id, err
+	}
+
+	cmd := &models.CreateFolderCommand{Title: title}
+	if err := NewFolderService(orgId, user).CreateFolder(cmd); err != nil {
+		return 0, err
+	}
+
+	folderIds[key] = cmd.Result.Id
+	return cmd.Result.Id, nil
+}
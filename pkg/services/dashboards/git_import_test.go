@@ -0,0 +1,334 @@
+package dashboards
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImportGitOnlyDashboards(t *testing.T) {
+	Convey("Given a repository with dashboards added directly to git", t, func() {
+		reader := &fakeFileReader{
+			files: []social.DashboardFile{
+				{Path: "dashboards/General/synced.json", Folder: "General"},
+				{Path: "dashboards/General/home.json", Folder: "General"},
+				{Path: "dashboards/Team A/service.json", Folder: "Team A"},
+				{Path: "dashboards/Team B/existing-uid.json", Folder: "Team B"},
+				{Path: "dashboards/Team B/broken.json", Folder: "Team B"},
+			},
+			contents: map[string]string{
+				"dashboards/General/home.json":        `{"id": 12, "title": "Home"}`,
+				"dashboards/Team A/service.json":      `{"title": "Service", "uid": "service"}`,
+				"dashboards/Team B/existing-uid.json": `{"title": "Existing", "uid": "existing"}`,
+				"dashboards/Team B/broken.json":       `{"title": `,
+			},
+		}
+
+		getGitProvider = func(orgId int64) social.GitProvider {
+			return reader
+		}
+		getSyncRepo = func(orgId int64) *social.SyncRepo {
+			return &social.SyncRepo{Provider: "gitlab"}
+		}
+
+		folders := map[string]int64{"Team A": 3}
+		var saved []*models.SaveDashboardCommand
+		var syncs []*models.SaveDashboardGitSyncCommand
+		nextId := int64(100)
+
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncsQuery) error {
+			query.Result = []*models.DashboardGitSync{{DashboardId: 1, OrgId: 1, FilePath: "dashboards/General/synced.json"}}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Uid == "existing" {
+				query.Result = &models.Dashboard{Id: 2, Uid: "existing"}
+				return nil
+			}
+			if query.Id > 0 {
+				query.Result = models.NewDashboardFolder("Created")
+				query.Result.Id = query.Id
+				return nil
+			}
+			return models.ErrDashboardNotFound
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardsBySlugQuery) error {
+			query.Result = make([]*models.Dashboard, 0)
+			for title, id := range folders {
+				if models.SlugifyTitle(title) == query.Slug {
+					folder := models.NewDashboardFolder(title)
+					folder.Id = id
+					query.Result = append(query.Result, folder)
+				}
+			}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = snapshotWithFolder(query)
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			nextId++
+			cmd.Result = cmd.GetDashboardModel()
+			cmd.Result.Id = nextId
+			saved = append(saved, cmd)
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			syncs = append(syncs, cmd)
+			return nil
+		})
+
+		service := &dashboardServiceImpl{log: log.New("test")}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_ADMIN}
+
+		Convey("Should import the dashboards without a database record", func() {
+			report, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+			So(err, ShouldBeNil)
+
+			So(report.Skipped, ShouldEqual, 2)
+			So(len(report.Created), ShouldEqual, 2)
+			So(report.Created[0], ShouldResemble, &ImportedFile{Path: "dashboards/General/home.json", Folder: "General", Title: "Home", DashboardId: 101})
+			So(report.Created[1], ShouldResemble, &ImportedFile{Path: "dashboards/Team A/service.json", Folder: "Team A", Title: "Service", DashboardId: 102})
+
+			So(len(report.Failed), ShouldEqual, 1)
+			So(report.Failed[0].Path, ShouldEqual, "dashboards/Team B/broken.json")
+			So(report.Failed[0].Error, ShouldNotBeEmpty)
+
+			So(len(saved), ShouldEqual, 2)
+			So(saved[0].FolderId, ShouldEqual, 0)
+			So(saved[0].Dashboard.Get("id").Interface(), ShouldBeNil)
+			So(saved[0].Source, ShouldEqual, models.DashboardSourceGitImport)
+			So(saved[1].FolderId, ShouldEqual, 3)
+
+			So(len(syncs), ShouldEqual, 2)
+			So(syncs[1].DashboardId, ShouldEqual, 102)
+			So(syncs[1].FilePath, ShouldEqual, "dashboards/Team A/service.json")
+			So(syncs[1].Provider, ShouldEqual, "gitlab")
+		})
+
+		Convey("Should create the folders that do not exist", func() {
+			reader.contents["dashboards/Team B/broken.json"] = `{"title": "Fixed"}`
+
+			report, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+			So(err, ShouldBeNil)
+			So(len(report.Created), ShouldEqual, 3)
+			So(len(report.Failed), ShouldEqual, 0)
+
+			// the folder is saved before the dashboard in it
+			So(len(saved), ShouldEqual, 4)
+			So(saved[2].IsFolder, ShouldBeTrue)
+			So(saved[2].Dashboard.Get("title").MustString(), ShouldEqual, "Team B")
+			So(saved[3].FolderId, ShouldEqual, saved[2].Result.Id)
+		})
+
+		Convey("Should only report the imports in a dry run", func() {
+			report, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{DryRun: true})
+			So(err, ShouldBeNil)
+			So(report.DryRun, ShouldBeTrue)
+			So(len(report.Created), ShouldEqual, 2)
+			So(saved, ShouldBeEmpty)
+			So(syncs, ShouldBeEmpty)
+		})
+
+		Convey("When the repository tells who last changed the files", func() {
+			authors := &fakeAuthorReader{
+				fakeFileReader: reader,
+				authors: map[string]*social.ExternalIdentity{
+					"dashboards/General/home.json":   {Name: "Jane Doe", Email: "jane@example.com"},
+					"dashboards/Team A/service.json": {Name: "Shared", Email: "shared@example.com"},
+				},
+				users: map[string]*models.SignedInUser{
+					"jane@example.com": {UserId: 7, OrgId: 1},
+				},
+			}
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return authors
+			}
+
+			Convey("Should credit the versions to the mapped authors", func() {
+				report, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+				So(err, ShouldBeNil)
+				So(report.Created[0].Author, ShouldEqual, "Jane Doe <jane@example.com>")
+
+				So(saved[0].UserId, ShouldEqual, 7)
+				So(saved[0].Message, ShouldEqual, "Imported from git")
+			})
+
+			Convey("Should name the ambiguous or unmapped authors in the version message", func() {
+				authors.authors["dashboards/General/home.json"] = &social.ExternalIdentity{Name: "Unknown", Email: "unknown@example.com"}
+
+				_, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+				So(err, ShouldBeNil)
+
+				So(saved[0].UserId, ShouldEqual, 1)
+				So(saved[0].Message, ShouldEqual, "Imported from git, last changed by Unknown <unknown@example.com>")
+				So(saved[1].UserId, ShouldEqual, 1)
+				So(saved[1].Message, ShouldEqual, "Imported from git, last changed by Shared <shared@example.com>")
+			})
+
+			Convey("Should import the files whose author is unknown", func() {
+				delete(authors.authors, "dashboards/General/home.json")
+
+				report, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+				So(err, ShouldBeNil)
+				So(len(report.Created), ShouldEqual, 2)
+				So(report.Created[0].Author, ShouldBeEmpty)
+				So(saved[0].UserId, ShouldEqual, 1)
+				So(saved[0].Message, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the repository renders jsonnet files", func() {
+			fixtures := jsonnetFixtures(t)
+			for filePath, content := range fixtures.contents {
+				reader.contents[filePath] = content
+			}
+			reader.files = []social.DashboardFile{
+				{Path: "dashboards/General/home.json", Folder: "General"},
+				{Path: "dashboards/Team A/service.jsonnet", Folder: "Team A"},
+				{Path: "dashboards/Team A/broken.jsonnet", Folder: "Team A"},
+			}
+
+			sources := &fakeJsonnetReader{
+				fakeFileReader: reader,
+				settings:       &social.JsonnetSettings{ImportPaths: []string{"lib"}, Timeout: 5 * time.Second, MaxStack: 500},
+			}
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return sources
+			}
+
+			Convey("Should import the rendered dashboards and report the files failing to render", func() {
+				report, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+				So(err, ShouldBeNil)
+
+				So(len(report.Created), ShouldEqual, 2)
+				So(report.Created[1], ShouldResemble, &ImportedFile{
+					Path:         "dashboards/Team A/service.jsonnet",
+					Folder:       "Team A",
+					Title:        "Service",
+					DashboardId:  102,
+					SourceFormat: models.GitSourceFormatJsonnet,
+				})
+
+				So(len(report.Failed), ShouldEqual, 1)
+				So(report.Failed[0].Path, ShouldEqual, "dashboards/Team A/broken.jsonnet")
+				So(report.Failed[0].Error, ShouldContainSubstring, "table")
+
+				So(saved[1].Dashboard.Get("panels").MustArray(), ShouldHaveLength, 2)
+				So(saved[1].FolderId, ShouldEqual, 3)
+			})
+
+			Convey("Should mark the synced files as jsonnet sources", func() {
+				_, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+				So(err, ShouldBeNil)
+
+				So(len(syncs), ShouldEqual, 2)
+				So(syncs[0].SourceFormat, ShouldBeEmpty)
+				So(syncs[1].FilePath, ShouldEqual, "dashboards/Team A/service.jsonnet")
+				So(syncs[1].SourceFormat, ShouldEqual, models.GitSourceFormatJsonnet)
+			})
+
+			Convey("Should not import jsonnet files when rendering is disabled", func() {
+				sources.settings = nil
+
+				report, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+				So(err, ShouldBeNil)
+				So(len(report.Created), ShouldEqual, 1)
+				So(len(report.Failed), ShouldEqual, 2)
+			})
+		})
+
+		Convey("Should fail when the repository cannot be listed", func() {
+			reader.listErr = errors.New("unavailable")
+
+			_, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+			So(err, ShouldEqual, reader.listErr)
+		})
+
+		Convey("Should fail without a repository that can be read", func() {
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return nil
+			}
+
+			_, err := service.ImportGitOnlyDashboards(1, user, ImportGitOnlyOptions{})
+			So(err, ShouldEqual, ErrGitImportNotSupported)
+		})
+
+		Reset(func() {
+			getGitProvider = social.GetGitProvider
+			getSyncRepo = social.GetSyncRepo
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+type fakeFileReader struct {
+	social.GitProvider
+	files    []social.DashboardFile
+	contents map[string]string
+	listErr  error
+}
+
+func (r *fakeFileReader) ListDashboardFiles(orgId int64) ([]social.DashboardFile, error) {
+	return r.files, r.listErr
+}
+
+func (r *fakeFileReader) ReadFile(orgId int64, filePath string) (string, error) {
+	content, ok := r.contents[filePath]
+	if !ok {
+		return "", errors.New("file not found")
+	}
+	return content, nil
+}
+
+type fakeJsonnetReader struct {
+	*fakeFileReader
+	settings *social.JsonnetSettings
+}
+
+func (r *fakeJsonnetReader) JsonnetSettings(orgId int64) *social.JsonnetSettings {
+	return r.settings
+}
+
+type fakeAuthorReader struct {
+	*fakeFileReader
+	authors map[string]*social.ExternalIdentity
+	users   map[string]*models.SignedInUser
+}
+
+func (r *fakeAuthorReader) FileAuthor(orgId int64, filePath string) (*social.ExternalIdentity, error) {
+	author, ok := r.authors[filePath]
+	if !ok {
+		return nil, errors.New("no commit found")
+	}
+	return author, nil
+}
+
+func (r *fakeAuthorReader) LookupGrafanaUser(ctx context.Context, orgId int64, identity social.ExternalIdentity) (*models.SignedInUser, error) {
+	if identity.Email == "shared@example.com" {
+		return nil, social.ErrAmbiguousExternalIdentity
+	}
+	user, ok := r.users[identity.Email]
+	if !ok {
+		return nil, models.ErrUserNotFound
+	}
+	return user, nil
+}
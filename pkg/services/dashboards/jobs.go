@@ -0,0 +1,393 @@
+package dashboards
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/setting"
+	"golang.org/x/xerrors"
+)
+
+const JobKindRepoLayoutMigration = "repo-layout-migration"
+
+var (
+	ErrJobKindUnknown = errors.New("Unknown dashboard job kind")
+	ErrJobFinished    = errors.New("Dashboard job already finished")
+)
+
+const (
+	jobInterruptedError = "Interrupted by a restart of Grafana"
+	jobStoppedError     = "Grafana was stopped while the job was running"
+)
+
+// JobProgressFunc is called by a running job to report how many of its items are done
+type JobProgressFunc func(done int, total int)
+
+// jobKind runs the jobs of a kind. check, when set, rejects the params of a job before it is queued.
+type jobKind struct {
+	check func(orgId int64, params []byte) error
+	run   func(ctx context.Context, job *models.DashboardJob, progress JobProgressFunc) (interface{}, error)
+}
+
+var jobKinds = map[string]*jobKind{
+	JobKindRepoLayoutMigration: {check: checkRepoLayoutMigrationJob, run: runRepoLayoutMigrationJob},
+}
+
+// Job is the status of a dashboard job
+type Job struct {
+	Id       int64                    `json:"id"`
+	OrgId    int64                    `json:"orgId"`
+	Kind     string                   `json:"kind"`
+	State    models.DashboardJobState `json:"state"`
+	Done     int                      `json:"done"`
+	Total    int                      `json:"total"`
+	Params   json.RawMessage          `json:"params,omitempty"`
+	Result   json.RawMessage          `json:"result,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+	Created  time.Time                `json:"created"`
+	Started  *time.Time               `json:"started,omitempty"`
+	Finished *time.Time               `json:"finished,omitempty"`
+}
+
+func newJob(job *models.DashboardJob) *Job {
+	result := &Job{
+		Id:      job.Id,
+		OrgId:   job.OrgId,
+		Kind:    job.Kind,
+		State:   job.State,
+		Done:    job.Done,
+		Total:   job.Total,
+		Error:   job.Error,
+		Created: job.Created,
+	}
+
+	if job.Params != "" {
+		result.Params = json.RawMessage(job.Params)
+	}
+	if job.Result != "" {
+		result.Result = json.RawMessage(job.Result)
+	}
+	if !job.Started.IsZero() {
+		result.Started = &job.Started
+	}
+	if !job.Finished.IsZero() {
+		result.Finished = &job.Finished
+	}
+	return result
+}
+
+var dashboardJobs = newJobService()
+
+func init() {
+	registry.RegisterService(dashboardJobs)
+}
+
+// JobService runs the queued dashboard jobs one at a time in the background. The jobs are stored, so their
+// status can be polled and outlives them for job_retention. Jobs run on the instance that queued them: jobs
+// still queued when Grafana stops run once it starts again, running ones are failed as interrupted.
+type JobService struct {
+	log     log.Logger
+	now     func() time.Time
+	mu      sync.Mutex
+	queue   []int64
+	cancels map[int64]context.CancelFunc
+	wake    chan struct{}
+}
+
+func newJobService() *JobService {
+	return &JobService{
+		log:     log.New("dashboard-jobs"),
+		now:     time.Now,
+		cancels: make(map[int64]context.CancelFunc),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+func (s *JobService) Init() error {
+	return nil
+}
+
+func (s *JobService) Run(ctx context.Context) error {
+	s.recover()
+	s.cleanUp()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		for s.runNext(ctx) {
+		}
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+			s.cleanUp()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// start stores the job as queued and wakes up the worker
+func (s *JobService) start(kind string, orgId int64, params interface{}, user *models.SignedInUser) (int64, error) {
+	jobKind, ok := jobKinds[kind]
+	if !ok {
+		return 0, ErrJobKindUnknown
+	}
+
+	content, err := json.Marshal(params)
+	if err != nil {
+		return 0, err
+	}
+
+	if jobKind.check != nil {
+		if err := jobKind.check(orgId, content); err != nil {
+			return 0, err
+		}
+	}
+
+	cmd := &models.CreateDashboardJobCommand{OrgId: orgId, Kind: kind, Params: string(content)}
+	if user != nil {
+		cmd.CreatedBy = user.UserId
+	}
+	if err := bus.Dispatch(cmd); err != nil {
+		return 0, err
+	}
+
+	s.enqueue(cmd.Result.Id)
+	s.log.Info("Dashboard job queued", "id", cmd.Result.Id, "kind", kind, "orgId", orgId)
+	return cmd.Result.Id, nil
+}
+
+func (s *JobService) enqueue(id int64) {
+	s.mu.Lock()
+	s.queue = append(s.queue, id)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cancel cancels a queued job right away, and asks a running job to stop
+func (s *JobService) cancel(id int64) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := getDashboardJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.State {
+	case models.DashboardJobQueued:
+		for i, queued := range s.queue {
+			if queued == id {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+
+		s.finish(job, models.DashboardJobCancelled, "")
+		if err := updateDashboardJob(job); err != nil {
+			return nil, err
+		}
+	case models.DashboardJobRunning:
+		if cancel, ok := s.cancels[id]; ok {
+			cancel()
+		}
+	default:
+		return nil, ErrJobFinished
+	}
+
+	return newJob(job), nil
+}
+
+// recover fails the jobs left running by a previous process and queues the jobs it did not run
+func (s *JobService) recover() {
+	query := &models.GetDashboardJobsByStateQuery{States: []models.DashboardJobState{models.DashboardJobQueued, models.DashboardJobRunning}}
+	if err := bus.Dispatch(query); err != nil {
+		s.log.Error("Failed to get unfinished dashboard jobs", "error", err)
+		return
+	}
+
+	for _, job := range query.Result {
+		if job.State == models.DashboardJobQueued {
+			s.enqueue(job.Id)
+			continue
+		}
+
+		s.log.Warn("Failing dashboard job interrupted by a restart", "id", job.Id, "kind", job.Kind)
+		s.finish(job, models.DashboardJobFailed, jobInterruptedError)
+		if err := updateDashboardJob(job); err != nil {
+			s.log.Error("Failed to fail interrupted dashboard job", "id", job.Id, "error", err)
+		}
+	}
+}
+
+// cleanUp deletes the jobs that finished longer than job_retention ago
+func (s *JobService) cleanUp() {
+	if setting.DashboardJobRetention <= 0 {
+		return
+	}
+
+	cmd := &models.DeleteFinishedDashboardJobsCommand{FinishedBefore: s.now().Add(-setting.DashboardJobRetention)}
+	if err := bus.Dispatch(cmd); err != nil {
+		s.log.Error("Failed to delete finished dashboard jobs", "error", err)
+		return
+	}
+
+	if cmd.DeletedRows > 0 {
+		s.log.Debug("Deleted finished dashboard jobs", "rows", cmd.DeletedRows)
+	}
+}
+
+// runNext runs the next queued job, and tells whether there was one
+func (s *JobService) runNext(ctx context.Context) bool {
+	s.mu.Lock()
+	if len(s.queue) == 0 {
+		s.mu.Unlock()
+		return false
+	}
+	id := s.queue[0]
+	s.queue = s.queue[1:]
+	s.mu.Unlock()
+
+	s.run(ctx, id)
+	return true
+}
+
+func (s *JobService) run(ctx context.Context, id int64) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	job, kind, ok := s.begin(id, cancel)
+	if !ok {
+		return
+	}
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.cancels, id)
+		s.mu.Unlock()
+	}()
+
+	lastUpdate := time.Time{}
+	progress := func(done int, total int) {
+		job.Done, job.Total = done, total
+		if done < total && s.now().Sub(lastUpdate) < time.Second {
+			return
+		}
+
+		lastUpdate = s.now()
+		if err := updateDashboardJob(job); err != nil {
+			s.log.Warn("Failed to store dashboard job progress", "id", id, "error", err)
+		}
+	}
+
+	result, err := kind.run(jobCtx, job, progress)
+
+	if result != nil {
+		if content, marshalErr := json.Marshal(result); marshalErr == nil {
+			job.Result = string(content)
+		} else {
+			s.log.Error("Failed to store dashboard job result", "id", id, "error", marshalErr)
+		}
+	}
+
+	switch {
+	case err == nil:
+		s.finish(job, models.DashboardJobSucceeded, "")
+	case ctx.Err() != nil:
+		s.finish(job, models.DashboardJobFailed, jobStoppedError)
+	case xerrors.Is(err, context.Canceled):
+		s.finish(job, models.DashboardJobCancelled, "")
+	default:
+		s.finish(job, models.DashboardJobFailed, err.Error())
+	}
+
+	s.log.Info("Dashboard job finished", "id", id, "kind", job.Kind, "state", job.State, "error", job.Error)
+	if err := updateDashboardJob(job); err != nil {
+		s.log.Error("Failed to store finished dashboard job", "id", id, "error", err)
+	}
+}
+
+// begin marks a queued job as running, unless it was cancelled meanwhile
+func (s *JobService) begin(id int64, cancel context.CancelFunc) (*models.DashboardJob, *jobKind, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, err := getDashboardJob(id)
+	if err != nil {
+		s.log.Error("Failed to get queued dashboard job", "id", id, "error", err)
+		return nil, nil, false
+	}
+	if job.State != models.DashboardJobQueued {
+		return nil, nil, false
+	}
+
+	kind, ok := jobKinds[job.Kind]
+	if !ok {
+		s.finish(job, models.DashboardJobFailed, ErrJobKindUnknown.Error())
+		if err := updateDashboardJob(job); err != nil {
+			s.log.Error("Failed to fail dashboard job", "id", id, "error", err)
+		}
+		return nil, nil, false
+	}
+
+	job.State = models.DashboardJobRunning
+	job.Started = s.now()
+	if err := updateDashboardJob(job); err != nil {
+		s.log.Error("Failed to start dashboard job", "id", id, "error", err)
+		return nil, nil, false
+	}
+
+	s.cancels[id] = cancel
+	return job, kind, true
+}
+
+func (s *JobService) finish(job *models.DashboardJob, state models.DashboardJobState, errorMessage string) {
+	job.State = state
+	job.Error = errorMessage
+	job.Finished = s.now()
+}
+
+func getDashboardJob(id int64) (*models.DashboardJob, error) {
+	query := &models.GetDashboardJobQuery{Id: id}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	return query.Result, nil
+}
+
+func updateDashboardJob(job *models.DashboardJob) error {
+	return bus.Dispatch(&models.UpdateDashboardJobCommand{Job: job})
+}
+
+// StartJob queues a job of the kind with its params, returning its id
+func (dr *dashboardServiceImpl) StartJob(kind string, orgId int64, params interface{}, user *models.SignedInUser) (int64, error) {
+	return dashboardJobs.start(kind, orgId, params, user)
+}
+
+// GetJob returns the status of the job
+func (dr *dashboardServiceImpl) GetJob(id int64) (*Job, error) {
+	job, err := getDashboardJob(id)
+	if err != nil {
+		return nil, err
+	}
+	return newJob(job), nil
+}
+
+// CancelJob cancels a queued or running job. A running job stops at its next step, so its state only changes
+// to cancelled once it did.
+func (dr *dashboardServiceImpl) CancelJob(id int64) (*Job, error) {
+	return dashboardJobs.cancel(id)
+}
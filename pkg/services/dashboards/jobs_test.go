@@ -0,0 +1,357 @@
+package dashboards
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardJobs(t *testing.T) {
+	Convey("Given the dashboard job service", t, func() {
+		bus.ClearBusHandlers()
+
+		current := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+		origJobs := dashboardJobs
+		dashboardJobs = newJobService()
+		dashboardJobs.now = func() time.Time { return current }
+
+		origRetention := setting.DashboardJobRetention
+		setting.DashboardJobRetention = 24 * time.Hour
+
+		// the stored jobs, kept across service instances like the database
+		jobs := make(map[int64]*models.DashboardJob)
+		nextId := int64(0)
+		bus.AddHandler("test", func(cmd *models.CreateDashboardJobCommand) error {
+			nextId++
+			cmd.Result = &models.DashboardJob{
+				Id:        nextId,
+				OrgId:     cmd.OrgId,
+				Kind:      cmd.Kind,
+				Params:    cmd.Params,
+				State:     models.DashboardJobQueued,
+				CreatedBy: cmd.CreatedBy,
+				Created:   current,
+			}
+			copied := *cmd.Result
+			jobs[nextId] = &copied
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardJobCommand) error {
+			if _, ok := jobs[cmd.Job.Id]; !ok {
+				return models.ErrDashboardJobNotFound
+			}
+			copied := *cmd.Job
+			jobs[cmd.Job.Id] = &copied
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardJobQuery) error {
+			job, ok := jobs[query.Id]
+			if !ok {
+				return models.ErrDashboardJobNotFound
+			}
+			copied := *job
+			query.Result = &copied
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardJobsByStateQuery) error {
+			for id := int64(1); id <= nextId; id++ {
+				job, ok := jobs[id]
+				if !ok {
+					continue
+				}
+				for _, state := range query.States {
+					if job.State == state {
+						copied := *job
+						query.Result = append(query.Result, &copied)
+					}
+				}
+			}
+			return nil
+		})
+		var deletedBefore time.Time
+		bus.AddHandler("test", func(cmd *models.DeleteFinishedDashboardJobsCommand) error {
+			deletedBefore = cmd.FinishedBefore
+			return nil
+		})
+
+		// the test kind reports progress and returns the stored state of its job, or runs hook when set
+		var hook func(ctx context.Context, job *models.DashboardJob) error
+		runs := 0
+		jobKinds["test"] = &jobKind{
+			check: func(orgId int64, params []byte) error {
+				if string(params) == `"invalid"` {
+					return errors.New("Invalid params")
+				}
+				return nil
+			},
+			run: func(ctx context.Context, job *models.DashboardJob, progress JobProgressFunc) (interface{}, error) {
+				runs++
+				progress(1, 2)
+				if hook != nil {
+					if err := hook(ctx, job); err != nil {
+						return nil, err
+					}
+				}
+				progress(2, 2)
+				return map[string]interface{}{"state": jobs[job.Id].State, "params": json.RawMessage(job.Params)}, nil
+			},
+		}
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 3, OrgId: 1}
+
+		start := func() int64 {
+			id, err := service.StartJob("test", 1, map[string]int{"count": 2}, user)
+			So(err, ShouldBeNil)
+			return id
+		}
+
+		get := func(id int64) *Job {
+			job, err := service.GetJob(id)
+			So(err, ShouldBeNil)
+			return job
+		}
+
+		Convey("Should queue a started job", func() {
+			id := start()
+
+			job := get(id)
+			So(job.State, ShouldEqual, models.DashboardJobQueued)
+			So(job.Kind, ShouldEqual, "test")
+			So(string(job.Params), ShouldEqual, `{"count":2}`)
+			So(job.Started, ShouldBeNil)
+			So(jobs[id].CreatedBy, ShouldEqual, 3)
+			So(runs, ShouldEqual, 0)
+		})
+
+		Convey("Should run a queued job to success", func() {
+			id := start()
+			So(dashboardJobs.runNext(context.Background()), ShouldBeTrue)
+			So(dashboardJobs.runNext(context.Background()), ShouldBeFalse)
+
+			job := get(id)
+			So(job.State, ShouldEqual, models.DashboardJobSucceeded)
+			So(string(job.Result), ShouldEqual, `{"params":{"count":2},"state":"running"}`)
+			So(job.Done, ShouldEqual, 2)
+			So(job.Total, ShouldEqual, 2)
+			So(*job.Started, ShouldResemble, current)
+			So(*job.Finished, ShouldResemble, current)
+			So(job.Error, ShouldBeEmpty)
+		})
+
+		Convey("Should store the progress of a running job", func() {
+			id := start()
+			hook = func(ctx context.Context, job *models.DashboardJob) error {
+				So(jobs[id].Done, ShouldEqual, 1)
+				So(jobs[id].Total, ShouldEqual, 2)
+				return nil
+			}
+			dashboardJobs.runNext(context.Background())
+			So(get(id).State, ShouldEqual, models.DashboardJobSucceeded)
+		})
+
+		Convey("Should run the jobs in the order they were started", func() {
+			first, second := start(), start()
+			dashboardJobs.runNext(context.Background())
+
+			So(get(first).State, ShouldEqual, models.DashboardJobSucceeded)
+			So(get(second).State, ShouldEqual, models.DashboardJobQueued)
+		})
+
+		Convey("Should fail a job with its error", func() {
+			id := start()
+			hook = func(ctx context.Context, job *models.DashboardJob) error {
+				return errors.New("Repository unavailable")
+			}
+			dashboardJobs.runNext(context.Background())
+
+			job := get(id)
+			So(job.State, ShouldEqual, models.DashboardJobFailed)
+			So(job.Error, ShouldEqual, "Repository unavailable")
+			So(job.Finished, ShouldNotBeNil)
+		})
+
+		Convey("Should cancel a queued job without running it", func() {
+			id := start()
+			job, err := service.CancelJob(id)
+			So(err, ShouldBeNil)
+			So(job.State, ShouldEqual, models.DashboardJobCancelled)
+
+			So(dashboardJobs.runNext(context.Background()), ShouldBeFalse)
+			So(runs, ShouldEqual, 0)
+			So(get(id).State, ShouldEqual, models.DashboardJobCancelled)
+		})
+
+		Convey("Should cancel a running job once it stops", func() {
+			id := start()
+			hook = func(ctx context.Context, job *models.DashboardJob) error {
+				cancelled, err := service.CancelJob(id)
+				So(err, ShouldBeNil)
+				So(cancelled.State, ShouldEqual, models.DashboardJobRunning)
+				return ctx.Err()
+			}
+			dashboardJobs.runNext(context.Background())
+
+			job := get(id)
+			So(job.State, ShouldEqual, models.DashboardJobCancelled)
+			So(job.Error, ShouldBeEmpty)
+		})
+
+		Convey("Should fail a job running when Grafana stops", func() {
+			id := start()
+			ctx, cancel := context.WithCancel(context.Background())
+			hook = func(jobCtx context.Context, job *models.DashboardJob) error {
+				cancel()
+				return jobCtx.Err()
+			}
+			dashboardJobs.runNext(ctx)
+
+			job := get(id)
+			So(job.State, ShouldEqual, models.DashboardJobFailed)
+			So(job.Error, ShouldEqual, jobStoppedError)
+		})
+
+		Convey("Should not cancel a finished job", func() {
+			id := start()
+			dashboardJobs.runNext(context.Background())
+
+			_, err := service.CancelJob(id)
+			So(err, ShouldEqual, ErrJobFinished)
+		})
+
+		Convey("Should return not found for a missing job", func() {
+			_, err := service.GetJob(100)
+			So(err, ShouldEqual, models.ErrDashboardJobNotFound)
+			_, err = service.CancelJob(100)
+			So(err, ShouldEqual, models.ErrDashboardJobNotFound)
+		})
+
+		Convey("Should reject an unknown kind", func() {
+			_, err := service.StartJob("unknown", 1, nil, user)
+			So(err, ShouldEqual, ErrJobKindUnknown)
+			So(jobs, ShouldBeEmpty)
+		})
+
+		Convey("Should reject params failing the check of the kind", func() {
+			_, err := service.StartJob("test", 1, "invalid", user)
+			So(err, ShouldNotBeNil)
+			So(jobs, ShouldBeEmpty)
+		})
+
+		Convey("When Grafana restarts with unfinished jobs", func() {
+			running, queued := start(), start()
+			jobs[running].State = models.DashboardJobRunning
+			jobs[running].Started = current
+
+			dashboardJobs = newJobService()
+			dashboardJobs.now = func() time.Time { return current }
+			dashboardJobs.recover()
+
+			Convey("Should fail the orphaned running job", func() {
+				job := get(running)
+				So(job.State, ShouldEqual, models.DashboardJobFailed)
+				So(job.Error, ShouldEqual, jobInterruptedError)
+				So(job.Finished, ShouldNotBeNil)
+			})
+
+			Convey("Should run the queued job", func() {
+				So(dashboardJobs.runNext(context.Background()), ShouldBeTrue)
+				So(dashboardJobs.runNext(context.Background()), ShouldBeFalse)
+				So(get(queued).State, ShouldEqual, models.DashboardJobSucceeded)
+				So(runs, ShouldEqual, 1)
+			})
+		})
+
+		Convey("Should delete the jobs finished before the retention", func() {
+			dashboardJobs.cleanUp()
+			So(deletedBefore, ShouldResemble, current.Add(-24*time.Hour))
+		})
+
+		Convey("Should keep the finished jobs without a retention", func() {
+			setting.DashboardJobRetention = 0
+			dashboardJobs.cleanUp()
+			So(deletedBefore.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("Given a repository layout migration job", func() {
+			origGetGitProvider := getGitProvider
+			mover := &fakeFileMover{dashboardsPath: "grafana/dashboards", commitSha: "abc123"}
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return mover
+			}
+
+			dash := models.NewDashboard("Service")
+			dash.Id = 10
+			dash.SetUid("service")
+			dash.OrgId = 1
+			bus.AddHandler("test", func(query *models.GetDashboardGitSyncsQuery) error {
+				query.Result = []*models.DashboardGitSync{{DashboardId: 10, OrgId: 1, Provider: "gitlab", FilePath: "dashboards/General/service.json"}}
+				return nil
+			})
+			bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+				query.Result = dash
+				return nil
+			})
+			bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+				return nil
+			})
+
+			Convey("Should run the migration and store it as the result", func() {
+				id, err := service.StartJob(JobKindRepoLayoutMigration, 1, RepoLayoutMigrationParams{}, user)
+				So(err, ShouldBeNil)
+				dashboardJobs.runNext(context.Background())
+
+				job := get(id)
+				So(job.State, ShouldEqual, models.DashboardJobSucceeded)
+				So(job.Done, ShouldEqual, 1)
+				So(job.Total, ShouldEqual, 1)
+				So(mover.commits, ShouldEqual, 1)
+
+				migration := &RepoLayoutMigration{}
+				So(json.Unmarshal(job.Result, migration), ShouldBeNil)
+				So(migration.CommitSha, ShouldEqual, "abc123")
+				So(migration.Moves[0].To, ShouldEqual, "grafana/dashboards/General/service.json")
+			})
+
+			Convey("Should not commit a cancelled migration", func() {
+				id, err := service.StartJob(JobKindRepoLayoutMigration, 1, RepoLayoutMigrationParams{}, user)
+				So(err, ShouldBeNil)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, err = runRepoLayoutMigrationJob(ctx, jobs[id], func(done int, total int) {})
+				So(err, ShouldEqual, context.Canceled)
+				So(mover.commits, ShouldEqual, 0)
+			})
+
+			Convey("Should not start without a repository supporting the migration", func() {
+				getGitProvider = func(orgId int64) social.GitProvider {
+					return nil
+				}
+
+				_, err := service.StartJob(JobKindRepoLayoutMigration, 1, RepoLayoutMigrationParams{}, user)
+				So(err, ShouldEqual, ErrRepoLayoutNotSupported)
+				So(jobs, ShouldBeEmpty)
+			})
+
+			Reset(func() {
+				getGitProvider = origGetGitProvider
+			})
+		})
+
+		Reset(func() {
+			delete(jobKinds, "test")
+			dashboardJobs = origJobs
+			setting.DashboardJobRetention = origRetention
+			bus.ClearBusHandlers()
+		})
+	})
+}
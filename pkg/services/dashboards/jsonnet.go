@@ -0,0 +1,127 @@
+package dashboards
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/grafana/grafana/pkg/login/social"
+)
+
+// JsonnetTimeoutError is returned when a jsonnet file is not rendered within the timeout of the repository
+type JsonnetTimeoutError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e JsonnetTimeoutError) Error() string {
+	return fmt.Sprintf("Rendering %s took longer than %s", e.Path, e.Timeout)
+}
+
+// jsonnetWorkers bounds the jsonnet evaluations running at once. An evaluation holds its worker until it completes,
+// even once abandoned, so files that never complete cannot pile up evaluations.
+var jsonnetWorkers = make(chan struct{}, 4)
+
+func isJsonnetFile(filePath string) bool {
+	return path.Ext(filePath) == ".jsonnet"
+}
+
+// renderJsonnet evaluates a jsonnet file of the repository to the json of a dashboard. Imports are read from the
+// repository, next to the importing file first and then in the import paths, and never outside of it. An
+// evaluation cannot be interrupted, one exceeding the timeout is abandoned and left to complete on its own, keeping
+// its worker until then. Waiting for a free worker counts towards the timeout. The memory used by an evaluation
+// is only bounded through its stack, its output is rejected once larger than MaxOutput.
+func renderJsonnet(reader social.DashboardFileReader, orgId int64, filePath string, source string, settings *social.JsonnetSettings) (string, error) {
+	vm := jsonnet.MakeVM()
+	vm.MaxStack = settings.MaxStack
+	vm.Importer(&repoImporter{
+		reader: reader,
+		orgId:  orgId,
+		paths:  settings.ImportPaths,
+		files:  make(map[string]*repoImport),
+	})
+
+	type rendered struct {
+		json string
+		err  error
+	}
+
+	timeout := time.NewTimer(settings.Timeout)
+	defer timeout.Stop()
+
+	workers := jsonnetWorkers
+	select {
+	case workers <- struct{}{}:
+	case <-timeout.C:
+		return "", JsonnetTimeoutError{Path: filePath, Timeout: settings.Timeout}
+	}
+
+	done := make(chan rendered, 1)
+	go func() {
+		defer func() { <-workers }()
+		defer func() {
+			if r := recover(); r != nil {
+				done <- rendered{err: fmt.Errorf("Rendering %s failed: %v", filePath, r)}
+			}
+		}()
+
+		json, err := vm.EvaluateSnippet(filePath, source)
+		done <- rendered{json: json, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err == nil && settings.MaxOutput > 0 && len(result.json) > settings.MaxOutput {
+			return "", fmt.Errorf("Rendering %s produced %d bytes, more than the %d allowed", filePath, len(result.json), settings.MaxOutput)
+		}
+		return result.json, result.err
+	case <-timeout.C:
+		return "", JsonnetTimeoutError{Path: filePath, Timeout: settings.Timeout}
+	}
+}
+
+// repoImport is a file imported during an evaluation. Files are read once, the evaluation expects the same
+// contents every time a path is imported.
+type repoImport struct {
+	found    bool
+	contents jsonnet.Contents
+}
+
+// repoImporter imports the files of the repository of an organization
+type repoImporter struct {
+	reader social.DashboardFileReader
+	orgId  int64
+	paths  []string
+	files  map[string]*repoImport
+}
+
+func (i *repoImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	dirs := append([]string{path.Dir(importedFrom)}, i.paths...)
+	if path.IsAbs(importedPath) {
+		dirs = []string{"/"}
+	}
+
+	for _, dir := range dirs {
+		filePath := strings.TrimPrefix(path.Join(dir, importedPath), "/")
+		if filePath == ".." || strings.HasPrefix(filePath, "../") {
+			continue
+		}
+
+		file, ok := i.files[filePath]
+		if !ok {
+			file = &repoImport{}
+			if content, err := i.reader.ReadFile(i.orgId, filePath); err == nil {
+				file = &repoImport{found: true, contents: jsonnet.MakeContents(content)}
+			}
+			i.files[filePath] = file
+		}
+
+		if file.found {
+			return file.contents, filePath, nil
+		}
+	}
+
+	return jsonnet.Contents{}, "", fmt.Errorf("Could not find %s next to %s or in the jsonnet import paths of the repository", importedPath, importedFrom)
+}
@@ -0,0 +1,173 @@
+package dashboards
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenderJsonnet(t *testing.T) {
+	Convey("Given a repository with jsonnet dashboards", t, func() {
+		reader := jsonnetFixtures(t)
+		settings := &social.JsonnetSettings{ImportPaths: []string{"lib"}, Timeout: 5 * time.Second, MaxStack: 500}
+
+		render := func(filePath string) (string, error) {
+			content, err := reader.ReadFile(1, filePath)
+			So(err, ShouldBeNil)
+			return renderJsonnet(reader, 1, filePath, content, settings)
+		}
+
+		Convey("Should render the imports next to the file and in the import paths", func() {
+			rendered, err := render("dashboards/Team A/service.jsonnet")
+			So(err, ShouldBeNil)
+
+			data, err := simplejson.NewJson([]byte(rendered))
+			So(err, ShouldBeNil)
+			So(data.Get("title").MustString(), ShouldEqual, "Service")
+			So(data.Get("uid").MustString(), ShouldEqual, "service")
+			So(data.Get("schemaVersion").MustInt(), ShouldEqual, 21)
+			So(data.Get("panels").MustArray(), ShouldHaveLength, 2)
+			So(data.Get("panels").GetIndex(1).Get("title").MustString(), ShouldEqual, "Errors")
+		})
+
+		Convey("Should fail on evaluation errors", func() {
+			_, err := render("dashboards/Team A/broken.jsonnet")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "table")
+		})
+
+		Convey("Should not find imports missing from the import paths", func() {
+			settings.ImportPaths = []string{}
+
+			_, err := render("dashboards/Team A/service.jsonnet")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "grafana.libsonnet")
+		})
+
+		Convey("Should not import files outside of the repository", func() {
+			reader.contents["../secret.libsonnet"] = `{ title: 'Secret' }`
+
+			_, err := renderJsonnet(reader, 1, "dashboards/escape.jsonnet", `import '../../secret.libsonnet'`, settings)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Could not find")
+		})
+
+		Convey("Should stop waiting for evaluations exceeding the timeout", func() {
+			settings.Timeout = 10 * time.Millisecond
+
+			_, err := renderJsonnet(reader, 1, "dashboards/slow.jsonnet", `{ title: std.toString(std.length([i * j for i in std.range(1, 500) for j in std.range(1, 500)])) }`, settings)
+			So(err, ShouldResemble, JsonnetTimeoutError{Path: "dashboards/slow.jsonnet", Timeout: 10 * time.Millisecond})
+		})
+
+		Convey("Should not start evaluations while all the workers are busy", func() {
+			origWorkers := jsonnetWorkers
+			jsonnetWorkers = make(chan struct{}, 1)
+			jsonnetWorkers <- struct{}{}
+			settings.Timeout = 10 * time.Millisecond
+
+			Reset(func() {
+				jsonnetWorkers = origWorkers
+			})
+
+			_, err := render("dashboards/Team A/service.jsonnet")
+			So(err, ShouldResemble, JsonnetTimeoutError{Path: "dashboards/Team A/service.jsonnet", Timeout: 10 * time.Millisecond})
+		})
+
+		Convey("Should reject output larger than the limit", func() {
+			settings.MaxOutput = 10
+
+			_, err := render("dashboards/Team A/service.jsonnet")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "more than the 10 allowed")
+		})
+	})
+}
+
+func TestRenderedDashboardCommits(t *testing.T) {
+	Convey("Given a dashboard rendered from a jsonnet file", t, func() {
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &recordingSyncConnector{}
+		social.SocialMap["gitlab"] = connector
+
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			if query.DashboardId == 1 {
+				query.Result = &models.DashboardGitSync{DashboardId: 1, FilePath: "dashboards/service.jsonnet", SourceFormat: models.GitSourceFormatJsonnet}
+			}
+			return nil
+		})
+
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, AuthModule: "gitlab", Token: "token"}
+		dashboard := models.NewDashboard("Service")
+		dashboard.Id = 1
+		dashboard.OrgId = 1
+		dashboard.SetUid("service")
+		service := &dashboardServiceImpl{}
+
+		Convey("Should not commit changes to the dashboard", func() {
+			dto := &SaveDashboardDTO{OrgId: 1, User: user, Dashboard: dashboard}
+
+			result, err := service.updateDashboard(dashboard, social.UpdateDashboard, dto, "")
+			So(err, ShouldBeNil)
+			So(result, ShouldBeNil)
+			So(connector.committed, ShouldBeEmpty)
+			So(dto.warnings, ShouldHaveLength, 1)
+			So(dto.warnings[0].Code, ShouldEqual, WarningRenderedSource)
+		})
+
+		Convey("Should commit the dashboards synced to json files", func() {
+			dashboard.Id = 2
+			dto := &SaveDashboardDTO{OrgId: 1, User: user, Dashboard: dashboard}
+
+			_, err := service.updateDashboard(dashboard, social.UpdateDashboard, dto, "")
+			So(err, ShouldBeNil)
+			So(connector.committed, ShouldResemble, []string{"Service"})
+			So(dto.warnings, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+// jsonnetFixtures returns a reader of the files of testdata/jsonnet, by their path in the fixture repository
+func jsonnetFixtures(t *testing.T) *fakeFileReader {
+	reader := &fakeFileReader{contents: make(map[string]string)}
+	root := filepath.Join("testdata", "jsonnet")
+
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		reader.contents[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reader
+}
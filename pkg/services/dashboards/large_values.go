@@ -0,0 +1,186 @@
+package dashboards
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/grafana/grafana/pkg/components/imguploader"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// matches images embedded in markdown or html, e.g. ![](data:image/png;base64,iVBORw0...)
+var dataURIPattern = regexp.MustCompile(`data:image/(png|jpeg|gif|webp);base64,([A-Za-z0-9+/]+={0,2})`)
+
+var newImageUploader = imguploader.NewImageUploader
+
+type largeValue struct {
+	path string
+	size int
+	// read and replace the value in the dashboard json
+	get func() string
+	set func(value string)
+}
+
+// checkLargeValues looks for string values in the dashboard json larger than the configured maximum.
+// Depending on the policy the save is rejected, or embedded images are moved to the external image
+// storage and replaced with their url, which is reported as a warning of the save.
+func (dr *dashboardServiceImpl) checkLargeValues(dto *SaveDashboardDTO) error {
+	dash := dto.Dashboard
+	if setting.DashboardMaxValueSize <= 0 {
+		return nil
+	}
+
+	values := findLargeValues(dash.Data.Interface(), setting.DashboardMaxValueSize)
+	if len(values) == 0 {
+		return nil
+	}
+
+	for _, value := range values {
+		if setting.DashboardLargeValuePolicy == "extract" {
+			if err := dr.extractImages(value); err != nil {
+				dr.log.Warn("Failed to move embedded images to the image storage", "dashboard", dash.Title, "path", value.path, "error", err)
+			} else {
+				dto.AddWarning(WarningImagesExtracted, "images embedded in %s were moved to the image storage", value.path)
+			}
+		}
+
+		if size := len(value.get()); size > setting.DashboardMaxValueSize {
+			return models.DashboardLargeValueError{Path: value.path, Size: size}
+		}
+	}
+
+	return nil
+}
+
+// extractImages uploads the images embedded in the value and replaces them with their url
+func (dr *dashboardServiceImpl) extractImages(value *largeValue) error {
+	if setting.ImageUploadProvider == "" || setting.ImageUploadProvider == "local" {
+		return fmt.Errorf("an external image storage is required, the provider is %q", setting.ImageUploadProvider)
+	}
+
+	uploader, err := newImageUploader()
+	if err != nil {
+		return err
+	}
+
+	content := value.get()
+	var uploadErr error
+
+	replaced := dataURIPattern.ReplaceAllStringFunc(content, func(dataURI string) string {
+		if uploadErr != nil {
+			return dataURI
+		}
+
+		match := dataURIPattern.FindStringSubmatch(dataURI)
+		url, err := uploadImage(uploader, match[1], match[2])
+		if err != nil {
+			uploadErr = err
+			return dataURI
+		}
+
+		return url
+	})
+
+	if uploadErr != nil {
+		return uploadErr
+	}
+
+	value.set(replaced)
+	return nil
+}
+
+func uploadImage(uploader imguploader.ImageUploader, imageType string, encoded string) (string, error) {
+	image, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := ioutil.TempFile("", "dashboard-image-*."+imageType)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(image)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	url, err := uploader.Upload(context.Background(), file.Name())
+	if err != nil {
+		return "", err
+	}
+	if url == "" {
+		return "", fmt.Errorf("the image storage returned no url")
+	}
+
+	return url, nil
+}
+
+// findLargeValues returns the string values longer than maxSize, sorted by their json path,
+// e.g. panels[2].options.content
+func findLargeValues(data interface{}, maxSize int) []*largeValue {
+	values := make([]*largeValue, 0)
+	walkValues(data, "", maxSize, &values)
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].path < values[j].path
+	})
+
+	return values
+}
+
+func walkValues(data interface{}, path string, maxSize int, values *[]*largeValue) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key := range v {
+			key := key
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+
+			if s, ok := v[key].(string); ok {
+				if len(s) > maxSize {
+					*values = append(*values, &largeValue{
+						path: childPath,
+						size: len(s),
+						get:  func() string { return v[key].(string) },
+						set:  func(value string) { v[key] = value },
+					})
+				}
+				continue
+			}
+
+			walkValues(v[key], childPath, maxSize, values)
+		}
+	case []interface{}:
+		for i := range v {
+			i := i
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+
+			if s, ok := v[i].(string); ok {
+				if len(s) > maxSize {
+					*values = append(*values, &largeValue{
+						path: childPath,
+						size: len(s),
+						get:  func() string { return v[i].(string) },
+						set:  func(value string) { v[i] = value },
+					})
+				}
+				continue
+			}
+
+			walkValues(v[i], childPath, maxSize, values)
+		}
+	}
+}
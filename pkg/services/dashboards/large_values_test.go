@@ -0,0 +1,143 @@
+package dashboards
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/components/imguploader"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardLargeValues(t *testing.T) {
+	Convey("Given a dashboard with large values", t, func() {
+		origMaxValueSize := setting.DashboardMaxValueSize
+		origPolicy := setting.DashboardLargeValuePolicy
+		origProvider := setting.ImageUploadProvider
+		origNewImageUploader := newImageUploader
+
+		setting.DashboardMaxValueSize = 1000
+		setting.DashboardLargeValuePolicy = "reject"
+
+		image := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("png", 400)))
+		content := "# Architecture\n![](data:image/png;base64," + image + ")"
+		query := strings.Repeat("a", 1000)
+
+		dash := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+			"title": "Dash",
+			"panels": []interface{}{
+				map[string]interface{}{
+					"type":    "graph",
+					"targets": []interface{}{map[string]interface{}{"expr": query}},
+				},
+				map[string]interface{}{
+					"type": "row",
+					"panels": []interface{}{
+						map[string]interface{}{"type": "text", "content": content},
+					},
+				},
+			},
+			"annotations": map[string]interface{}{
+				"list": []interface{}{
+					map[string]interface{}{"name": "deploys", "text": strings.Repeat("b", 1001)},
+				},
+			},
+		}))
+
+		service := &dashboardServiceImpl{log: log.New("test")}
+		dto := &SaveDashboardDTO{Dashboard: dash}
+
+		Convey("Should find the values over the limit in nested panels and annotations", func() {
+			values := findLargeValues(dash.Data.Interface(), 1000)
+			So(len(values), ShouldEqual, 2)
+			So(values[0].path, ShouldEqual, "annotations.list[0].text")
+			So(values[0].size, ShouldEqual, 1001)
+			So(values[1].path, ShouldEqual, "panels[1].panels[0].content")
+			So(values[1].size, ShouldEqual, len(content))
+		})
+
+		Convey("Should not report queries at the limit", func() {
+			values := findLargeValues(dash.Data.Interface(), 1000)
+			for _, value := range values {
+				So(value.path, ShouldNotStartWith, "panels[0]")
+			}
+		})
+
+		Convey("Should reject the save with the path and size of the value", func() {
+			err := service.checkLargeValues(dto)
+			So(err, ShouldResemble, models.DashboardLargeValueError{Path: "annotations.list[0].text", Size: 1001})
+		})
+
+		Convey("Should not check when disabled", func() {
+			setting.DashboardMaxValueSize = 0
+			So(service.checkLargeValues(dto), ShouldBeNil)
+		})
+
+		Convey("When extracting images", func() {
+			setting.DashboardLargeValuePolicy = "extract"
+			setting.ImageUploadProvider = "s3"
+
+			uploader := &fakeImageUploader{}
+			newImageUploader = func() (imguploader.ImageUploader, error) {
+				return uploader, nil
+			}
+
+			dash.Data.Get("annotations").Get("list").GetIndex(0).Set("text", "deploy")
+
+			Convey("Should replace embedded images with their url", func() {
+				So(service.checkLargeValues(dto), ShouldBeNil)
+
+				text := dash.Data.Get("panels").GetIndex(1).Get("panels").GetIndex(0).Get("content").MustString()
+				So(text, ShouldEqual, "# Architecture\n![](https://images.example.com/1.png)")
+				So(uploader.uploaded, ShouldResemble, []string{strings.Repeat("png", 400)})
+				So(dash.Data.Get("panels").GetIndex(0).Get("targets").GetIndex(0).Get("expr").MustString(), ShouldEqual, query)
+				So(dto.warnings, ShouldResemble, []Warning{
+					{Code: WarningImagesExtracted, Message: "images embedded in panels[1].panels[0].content were moved to the image storage"},
+				})
+			})
+
+			Convey("Should reject values without images", func() {
+				dash.Data.Get("annotations").Get("list").GetIndex(0).Set("text", strings.Repeat("b", 1001))
+
+				err := service.checkLargeValues(dto)
+				So(err, ShouldResemble, models.DashboardLargeValueError{Path: "annotations.list[0].text", Size: 1001})
+			})
+
+			Convey("Should reject when images cannot be stored externally", func() {
+				setting.ImageUploadProvider = "local"
+
+				err := service.checkLargeValues(dto)
+				So(err, ShouldHaveSameTypeAs, models.DashboardLargeValueError{})
+				So(uploader.uploaded, ShouldBeEmpty)
+			})
+		})
+
+		Reset(func() {
+			setting.DashboardMaxValueSize = origMaxValueSize
+			setting.DashboardLargeValuePolicy = origPolicy
+			setting.ImageUploadProvider = origProvider
+			newImageUploader = origNewImageUploader
+		})
+	})
+}
+
+type fakeImageUploader struct {
+	uploaded []string
+}
+
+func (u *fakeImageUploader) Upload(ctx context.Context, path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	u.uploaded = append(u.uploaded, string(content))
+	return fmt.Sprintf("https://images.example.com/%d.png", len(u.uploaded)), nil
+}
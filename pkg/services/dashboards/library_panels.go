@@ -0,0 +1,102 @@
+package dashboards
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// WarningLibraryPanels reports library panels referenced by the dashboard that do not exist in the organization
+const WarningLibraryPanels = "library-panels"
+
+func init() {
+	RegisterValidator(&ValidatorRegistration{
+		Name:      "library-panels",
+		Order:     900,
+		Validator: ValidatorFunc(validateLibraryPanels),
+	})
+}
+
+// validateLibraryPanels applies the library panel validation policy to the dashboard. The library panels it
+// references that are missing from the organization are returned as warnings of the save in warn mode, and
+// fail the save in reject mode. So does a failed lookup of the library panels.
+func validateLibraryPanels(dto *SaveDashboardDTO) error {
+	policy := setting.DashboardLibraryPanelValidation
+	if policy == "off" || policy == "" || dto.Dashboard.IsFolder {
+		return nil
+	}
+
+	uids := libraryPanelUids(dto.Dashboard.Data)
+	if len(uids) == 0 {
+		return nil
+	}
+
+	query := &models.GetLibraryPanelsQuery{OrgId: dto.OrgId, Uids: uids}
+	if err := bus.Dispatch(query); err != nil {
+		if policy == "reject" {
+			return err
+		}
+		dto.AddWarning(WarningLibraryPanels, "The library panels of the dashboard could not be checked: %v", err)
+		return nil
+	}
+
+	found := make(map[string]bool, len(query.Result))
+	for _, uid := range query.Result {
+		found[uid] = true
+	}
+
+	missing := make([]string, 0)
+	for _, uid := range uids {
+		if !found[uid] {
+			missing = append(missing, uid)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if policy == "reject" {
+		return models.DashboardValidationError{Validator: "library-panels", Message: "missing library panels " + strings.Join(missing, ", ")}
+	}
+
+	for _, uid := range missing {
+		dto.AddWarning(WarningLibraryPanels, "Library panel %s does not exist", uid)
+	}
+
+	return nil
+}
+
+// libraryPanelUids returns the distinct uids of the library panels referenced by the dashboard json, in the order
+// they are referenced. Panels of collapsed rows and of the rows of dashboards from before schema version 16 are
+// included.
+func libraryPanelUids(data *simplejson.Json) []string {
+	uids := make([]string, 0)
+	seen := make(map[string]bool)
+
+	var visitPanels func(panels *simplejson.Json)
+	visitPanels = func(panels *simplejson.Json) {
+		for i := range panels.MustArray() {
+			panel := panels.GetIndex(i)
+
+			if uid := panel.GetPath("libraryPanel", "uid").MustString(); uid != "" && !seen[uid] {
+				seen[uid] = true
+				uids = append(uids, uid)
+			}
+
+			visitPanels(panel.Get("panels"))
+		}
+	}
+
+	visitPanels(data.Get("panels"))
+
+	rows := data.Get("rows")
+	for i := range rows.MustArray() {
+		visitPanels(rows.GetIndex(i).Get("panels"))
+	}
+
+	return uids
+}
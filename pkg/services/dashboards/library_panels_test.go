@@ -0,0 +1,127 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLibraryPanelReferences(t *testing.T) {
+	Convey("Should return the library panels of panels, collapsed rows and old rows once", t, func() {
+		data := simplejson.NewFromAny(map[string]interface{}{
+			"panels": []interface{}{
+				map[string]interface{}{"type": "graph", "libraryPanel": map[string]interface{}{"uid": "cpu", "name": "CPU"}},
+				map[string]interface{}{"type": "graph"},
+				map[string]interface{}{"type": "row", "panels": []interface{}{
+					map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": "memory"}},
+					map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": "cpu"}},
+				}},
+			},
+			"rows": []interface{}{
+				map[string]interface{}{"panels": []interface{}{
+					map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": "disk"}},
+				}},
+			},
+		})
+
+		So(libraryPanelUids(data), ShouldResemble, []string{"cpu", "memory", "disk"})
+	})
+
+	Convey("Given the library panel validation policy", t, func() {
+		bus.ClearBusHandlers()
+		origValidation := setting.DashboardLibraryPanelValidation
+
+		var lookups []*models.GetLibraryPanelsQuery
+		var lookupErr error
+		bus.AddHandler("test", func(query *models.GetLibraryPanelsQuery) error {
+			lookups = append(lookups, query)
+			if lookupErr != nil {
+				return lookupErr
+			}
+			for _, uid := range query.Uids {
+				if uid == "cpu" {
+					query.Result = append(query.Result, uid)
+				}
+			}
+			return nil
+		})
+
+		newDto := func(uids ...string) *SaveDashboardDTO {
+			panels := make([]interface{}, 0, len(uids))
+			for _, uid := range uids {
+				panels = append(panels, map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": uid}})
+			}
+			dash := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{"title": "Dash", "panels": panels}))
+			return &SaveDashboardDTO{OrgId: 1, Dashboard: dash}
+		}
+
+		Convey("Should not look the library panels up when off", func() {
+			setting.DashboardLibraryPanelValidation = "off"
+
+			dto := newDto("memory")
+			So(validateLibraryPanels(dto), ShouldBeNil)
+			So(lookups, ShouldBeEmpty)
+		})
+
+		Convey("Should look the library panels up in the organization of the dashboard", func() {
+			setting.DashboardLibraryPanelValidation = "warn"
+
+			So(validateLibraryPanels(newDto("cpu", "memory")), ShouldBeNil)
+			So(lookups, ShouldHaveLength, 1)
+			So(lookups[0].OrgId, ShouldEqual, 1)
+			So(lookups[0].Uids, ShouldResemble, []string{"cpu", "memory"})
+		})
+
+		Convey("Should not look the library panels up for dashboards without any", func() {
+			setting.DashboardLibraryPanelValidation = "reject"
+
+			So(validateLibraryPanels(newDto()), ShouldBeNil)
+			So(lookups, ShouldBeEmpty)
+		})
+
+		Convey("Should save with a warning per missing library panel in warn mode", func() {
+			setting.DashboardLibraryPanelValidation = "warn"
+
+			dto := newDto("cpu", "memory", "disk")
+			So(validateLibraryPanels(dto), ShouldBeNil)
+			So(dto.warnings, ShouldResemble, []Warning{
+				{Code: WarningLibraryPanels, Message: "Library panel memory does not exist"},
+				{Code: WarningLibraryPanels, Message: "Library panel disk does not exist"},
+			})
+		})
+
+		Convey("Should save with a warning when the library panels cannot be looked up in warn mode", func() {
+			setting.DashboardLibraryPanelValidation = "warn"
+			lookupErr = errors.New("library panels unavailable")
+
+			dto := newDto("cpu")
+			So(validateLibraryPanels(dto), ShouldBeNil)
+			So(dto.warnings, ShouldHaveLength, 1)
+			So(dto.warnings[0].Code, ShouldEqual, WarningLibraryPanels)
+		})
+
+		Convey("Should reject the missing library panels in reject mode", func() {
+			setting.DashboardLibraryPanelValidation = "reject"
+
+			err := validateLibraryPanels(newDto("cpu", "memory", "disk"))
+			So(err, ShouldResemble, models.DashboardValidationError{Validator: "library-panels", Message: "missing library panels memory, disk"})
+		})
+
+		Convey("Should run with the other validators of dashboard saves", func() {
+			setting.DashboardLibraryPanelValidation = "reject"
+			service := &dashboardServiceImpl{}
+
+			err := service.runValidators(newDto("memory"))
+			So(err, ShouldResemble, models.DashboardValidationError{Validator: "library-panels", Message: "missing library panels memory"})
+		})
+
+		Reset(func() {
+			setting.DashboardLibraryPanelValidation = origValidation
+		})
+	})
+}
@@ -0,0 +1,148 @@
+package dashboards
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// CheckNestingDepth returns a DashboardNestingDepthError if objects and arrays in the dashboard json are
+// nested deeper than the configured maximum. The json is walked without recursion, so pathological
+// documents are rejected before anything else processes them.
+func CheckNestingDepth(data *simplejson.Json) error {
+	maxDepth := setting.DashboardMaxNestingDepth
+	if maxDepth <= 0 || data == nil {
+		return nil
+	}
+
+	type node struct {
+		value interface{}
+		depth int
+	}
+
+	stack := []node{{value: data.Interface(), depth: 1}}
+
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		var children []interface{}
+		switch v := current.value.(type) {
+		case map[string]interface{}:
+			for _, child := range v {
+				children = append(children, child)
+			}
+		case []interface{}:
+			children = v
+		default:
+			continue
+		}
+
+		if current.depth > maxDepth {
+			return models.DashboardNestingDepthError{MaxDepth: maxDepth}
+		}
+
+		for _, child := range children {
+			stack = append(stack, node{value: child, depth: current.depth + 1})
+		}
+	}
+
+	return nil
+}
+
+// panelCounts describes the size of a dashboard. Panels inside rows, collapsed or from the old
+// rows schema, are counted as well.
+type panelCounts struct {
+	panels int
+	rows   int
+	depth  int
+}
+
+func countPanels(data *simplejson.Json) panelCounts {
+	counts := panelCounts{}
+	countPanelList(data.Get("panels"), 1, &counts)
+
+	// dashboards from before schema version 16 have their panels in rows
+	for _, row := range data.Get("rows").MustArray() {
+		counts.rows++
+		countPanelList(simplejson.NewFromAny(row).Get("panels"), 2, &counts)
+	}
+
+	return counts
+}
+
+func countPanelList(panels *simplejson.Json, depth int, counts *panelCounts) {
+	for _, item := range panels.MustArray() {
+		panel := simplejson.NewFromAny(item)
+
+		if depth > counts.depth {
+			counts.depth = depth
+		}
+
+		if panel.Get("type").MustString() == "row" {
+			counts.rows++
+		} else {
+			counts.panels++
+		}
+
+		countPanelList(panel.Get("panels"), depth+1, counts)
+	}
+}
+
+// checkPanelLimits rejects dashboards with more panels, rows or nested panels than configured. Dashboards
+// that are already over a limit can still be saved as long as the save does not increase the count.
+func checkPanelLimits(dash *models.Dashboard, orgId int64) error {
+	limits := []struct {
+		name    string
+		allowed int
+		count   func(panelCounts) int
+	}{
+		{"panels", setting.DashboardMaxPanels, func(c panelCounts) int { return c.panels }},
+		{"rows", setting.DashboardMaxRows, func(c panelCounts) int { return c.rows }},
+		{"panel depth", setting.DashboardMaxPanelDepth, func(c panelCounts) int { return c.depth }},
+	}
+
+	counts := countPanels(dash.Data)
+	var previous *panelCounts
+	violations := make([]models.DashboardLimitViolation, 0)
+
+	for _, limit := range limits {
+		found := limit.count(counts)
+		if limit.allowed <= 0 || found <= limit.allowed {
+			continue
+		}
+
+		if previous == nil {
+			previous = &panelCounts{}
+			if existing := getExistingDashboard(dash.Id, orgId); existing != nil {
+				*previous = countPanels(existing.Data)
+			}
+		}
+
+		if found <= limit.count(*previous) {
+			continue
+		}
+
+		violations = append(violations, models.DashboardLimitViolation{Name: limit.name, Found: found, Allowed: limit.allowed})
+	}
+
+	if len(violations) > 0 {
+		return models.DashboardLimitsError{Violations: violations}
+	}
+
+	return nil
+}
+
+func getExistingDashboard(dashboardId int64, orgId int64) *models.Dashboard {
+	if dashboardId == 0 {
+		return nil
+	}
+
+	query := models.GetDashboardQuery{Id: dashboardId, OrgId: orgId}
+	if err := bus.Dispatch(&query); err != nil {
+		return nil
+	}
+
+	return query.Result
+}
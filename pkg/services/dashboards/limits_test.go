@@ -0,0 +1,168 @@
+package dashboards
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardNestingDepth(t *testing.T) {
+	Convey("Checking the nesting depth of dashboard json", t, func() {
+		origMaxDepth := setting.DashboardMaxNestingDepth
+		setting.DashboardMaxNestingDepth = 10
+
+		// nested returns a dashboard with depth levels of objects and arrays
+		nested := func(depth int) *simplejson.Json {
+			var value interface{} = "leaf"
+			for i := depth; i > 1; i-- {
+				if i%2 == 0 {
+					value = []interface{}{value}
+				} else {
+					value = map[string]interface{}{"panels": value}
+				}
+			}
+			return simplejson.NewFromAny(map[string]interface{}{"title": "Dash", "nested": value})
+		}
+
+		Convey("Should accept dashboards at the limit", func() {
+			So(CheckNestingDepth(nested(10)), ShouldBeNil)
+		})
+
+		Convey("Should reject dashboards over the limit", func() {
+			So(CheckNestingDepth(nested(11)), ShouldResemble, models.DashboardNestingDepthError{MaxDepth: 10})
+		})
+
+		Convey("Should not check when disabled", func() {
+			setting.DashboardMaxNestingDepth = 0
+			So(CheckNestingDepth(nested(1000)), ShouldBeNil)
+		})
+
+		Convey("Should reject saving dashboards over the limit", func() {
+			service := &dashboardServiceImpl{}
+			_, err := service.SaveDashboard(&SaveDashboardDTO{
+				OrgId:     1,
+				Dashboard: models.NewDashboardFromJson(nested(11)),
+				User:      &models.SignedInUser{UserId: 1, OrgId: 1},
+			})
+			So(err, ShouldResemble, models.DashboardNestingDepthError{MaxDepth: 10})
+		})
+
+		Reset(func() {
+			setting.DashboardMaxNestingDepth = origMaxDepth
+		})
+	})
+}
+
+func TestDashboardPanelLimits(t *testing.T) {
+	Convey("Given panel limits", t, func() {
+		bus.ClearBusHandlers()
+
+		origMaxPanels := setting.DashboardMaxPanels
+		origMaxRows := setting.DashboardMaxRows
+		origMaxPanelDepth := setting.DashboardMaxPanelDepth
+		setting.DashboardMaxPanels = 5
+		setting.DashboardMaxRows = 2
+		setting.DashboardMaxPanelDepth = 2
+
+		// dashboard returns a dashboard with a collapsed row holding half of the panels
+		dashboard := func(id int64, panelCount int) *models.Dashboard {
+			top := make([]interface{}, 0)
+			collapsed := make([]interface{}, 0)
+			for i := 0; i < panelCount; i++ {
+				if i%2 == 0 {
+					top = append(top, map[string]interface{}{"type": "graph"})
+				} else {
+					collapsed = append(collapsed, map[string]interface{}{"type": "graph"})
+				}
+			}
+			top = append(top, map[string]interface{}{"type": "row", "collapsed": true, "panels": collapsed})
+
+			return models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+				"id":     id,
+				"title":  "Dash",
+				"panels": top,
+			}))
+		}
+
+		existing := dashboard(1, 8)
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Id != existing.Id {
+				return models.ErrDashboardNotFound
+			}
+			query.Result = existing
+			return nil
+		})
+
+		Convey("Should count panels in collapsed rows and the rows schema", func() {
+			So(countPanels(dashboard(0, 7).Data), ShouldResemble, panelCounts{panels: 7, rows: 1, depth: 2})
+
+			legacy := simplejson.NewFromAny(map[string]interface{}{
+				"rows": []interface{}{
+					map[string]interface{}{"panels": []interface{}{map[string]interface{}{}, map[string]interface{}{}}},
+					map[string]interface{}{"panels": []interface{}{map[string]interface{}{}}},
+				},
+			})
+			So(countPanels(legacy), ShouldResemble, panelCounts{panels: 3, rows: 2, depth: 2})
+		})
+
+		Convey("Should accept new dashboards at the limit", func() {
+			So(checkPanelLimits(dashboard(0, 5), 1), ShouldBeNil)
+		})
+
+		Convey("Should reject new dashboards over the limit with the counts", func() {
+			err := checkPanelLimits(dashboard(0, 6), 1)
+			So(err, ShouldResemble, models.DashboardLimitsError{Violations: []models.DashboardLimitViolation{
+				{Name: "panels", Found: 6, Allowed: 5},
+			}})
+		})
+
+		Convey("Should report every exceeded limit", func() {
+			dash := dashboard(0, 2)
+			dash.Data.Set("panels", []interface{}{
+				map[string]interface{}{"type": "row"},
+				map[string]interface{}{"type": "row"},
+				map[string]interface{}{"type": "row", "panels": []interface{}{
+					map[string]interface{}{"type": "row", "panels": []interface{}{map[string]interface{}{"type": "graph"}}},
+				}},
+			})
+
+			err := checkPanelLimits(dash, 1)
+			So(err, ShouldResemble, models.DashboardLimitsError{Violations: []models.DashboardLimitViolation{
+				{Name: "rows", Found: 4, Allowed: 2},
+				{Name: "panel depth", Found: 3, Allowed: 2},
+			}})
+		})
+
+		Convey("Given a dashboard already over the limit", func() {
+			Convey("Should allow saves that reduce the count", func() {
+				So(checkPanelLimits(dashboard(1, 7), 1), ShouldBeNil)
+			})
+
+			Convey("Should allow saves that keep the count", func() {
+				So(checkPanelLimits(dashboard(1, 8), 1), ShouldBeNil)
+			})
+
+			Convey("Should reject saves that increase the count", func() {
+				err := checkPanelLimits(dashboard(1, 9), 1)
+				So(err, ShouldResemble, models.DashboardLimitsError{Violations: []models.DashboardLimitViolation{
+					{Name: "panels", Found: 9, Allowed: 5},
+				}})
+			})
+		})
+
+		Convey("Should not check when no limits are configured", func() {
+			setting.DashboardMaxPanels = 0
+			So(checkPanelLimits(dashboard(0, 600), 1), ShouldBeNil)
+		})
+
+		Reset(func() {
+			setting.DashboardMaxPanels = origMaxPanels
+			setting.DashboardMaxRows = origMaxRows
+			setting.DashboardMaxPanelDepth = origMaxPanelDepth
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package dashboards
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// maintenanceRefreshInterval is how long the maintenance read from the database is used before it is read again, so
+// a maintenance set on one instance applies to the other instances sharing the database within the interval
+const maintenanceRefreshInterval = 10 * time.Second
+
+var dashboardMaintenance = newMaintenanceMode()
+
+// MaintenanceStatus is the read-only maintenance of dashboards
+type MaintenanceStatus struct {
+	ReadOnly bool   `json:"readOnly"`
+	Message  string `json:"message"`
+	// Until is the estimated end of the maintenance, nil when unknown
+	Until *time.Time `json:"until,omitempty"`
+	// Configured is set when the read_only setting keeps the maintenance on, the API cannot turn it off then
+	Configured bool `json:"configured"`
+}
+
+// MaintenanceOptions turns the read-only maintenance of dashboards on or off. Message and Until, zero when
+// unknown, are returned with the writes rejected during the maintenance.
+type MaintenanceOptions struct {
+	ReadOnly bool
+	Message  string
+	Until    time.Time
+}
+
+// maintenanceMode is the read-only maintenance of dashboards, either forced by the read_only setting or stored in
+// the database so it applies to all the instances. The stored maintenance is cached for maintenanceRefreshInterval,
+// the instance setting it sees the change at once.
+type maintenanceMode struct {
+	mu      sync.Mutex
+	log     log.Logger
+	now     func() time.Time
+	stored  *models.DashboardMaintenance
+	fetched time.Time
+}
+
+func newMaintenanceMode() *maintenanceMode {
+	return &maintenanceMode{
+		log: log.New("dashboard-maintenance"),
+		now: time.Now,
+	}
+}
+
+// load returns the stored maintenance, read again from the database once older than maintenanceRefreshInterval.
+// It returns the maintenance read last with the error when the database cannot be read.
+func (m *maintenanceMode) load() (*models.DashboardMaintenance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if !m.fetched.IsZero() && now.Sub(m.fetched) < maintenanceRefreshInterval {
+		return m.stored, nil
+	}
+
+	query := &models.GetDashboardMaintenanceQuery{}
+	if err := bus.Dispatch(query); err != nil {
+		return m.stored, err
+	}
+
+	m.stored, m.fetched = query.Result, now
+	return m.stored, nil
+}
+
+// status returns the maintenance, the one of the read_only setting when it is on
+func (m *maintenanceMode) status() (*MaintenanceStatus, error) {
+	if setting.DashboardReadOnly {
+		status := &MaintenanceStatus{ReadOnly: true, Message: setting.DashboardReadOnlyMessage, Configured: true}
+		if !setting.DashboardReadOnlyUntil.IsZero() {
+			until := setting.DashboardReadOnlyUntil
+			status.Until = &until
+		}
+		return status, nil
+	}
+
+	stored, err := m.load()
+	status := &MaintenanceStatus{}
+	if stored != nil && stored.ReadOnly {
+		status.ReadOnly = true
+		status.Message = stored.Message
+		if stored.EndsAt > 0 {
+			until := time.Unix(stored.EndsAt, 0)
+			status.Until = &until
+		}
+	}
+	return status, err
+}
+
+// check returns a models.DashboardsReadOnlyError during the maintenance. When the maintenance cannot be read, the
+// one read last applies, so a failing database does not turn the maintenance off.
+func (m *maintenanceMode) check() error {
+	status, err := m.status()
+	if err != nil {
+		m.log.Warn("Failed to read the maintenance of dashboards", "error", err)
+	}
+
+	if !status.ReadOnly {
+		return nil
+	}
+
+	readOnlyErr := models.DashboardsReadOnlyError{Message: status.Message}
+	if status.Until != nil {
+		readOnlyErr.Until = *status.Until
+	}
+	return readOnlyErr
+}
+
+// set stores the maintenance for all the instances and applies it to this one at once
+func (m *maintenanceMode) set(opts MaintenanceOptions, userId int64) (*MaintenanceStatus, error) {
+	cmd := &models.SetDashboardMaintenanceCommand{ReadOnly: opts.ReadOnly, Message: opts.Message, UpdatedBy: userId}
+	if opts.ReadOnly && !opts.Until.IsZero() {
+		cmd.EndsAt = opts.Until.Unix()
+	}
+	if !opts.ReadOnly {
+		cmd.Message = ""
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.stored, m.fetched = cmd.Result, m.now()
+	m.mu.Unlock()
+
+	m.log.Info("Dashboard maintenance changed", "readOnly", cmd.ReadOnly, "message", cmd.Message, "endsAt", cmd.EndsAt, "userId", userId)
+	return m.status()
+}
+
+// GetMaintenance returns the read-only maintenance of dashboards
+func (dr *dashboardServiceImpl) GetMaintenance() (*MaintenanceStatus, error) {
+	return dashboardMaintenance.status()
+}
+
+// SetMaintenance turns the read-only maintenance of dashboards on or off for all the instances sharing the
+// database. The other instances apply it within maintenanceRefreshInterval. Turning it off does not end the
+// maintenance of the read_only setting.
+func (dr *dashboardServiceImpl) SetMaintenance(opts MaintenanceOptions, user *models.SignedInUser) (*MaintenanceStatus, error) {
+	return dashboardMaintenance.set(opts, user.UserId)
+}
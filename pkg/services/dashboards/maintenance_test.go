@@ -0,0 +1,192 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+)
+
+func TestDashboardMaintenance(t *testing.T) {
+	Convey("Given the dashboard service on an in-memory store", t, func() {
+		bus.ClearBusHandlers()
+
+		store := NewFakeDashboardStore()
+		store.Register()
+
+		clock := &fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}
+		dashboardMaintenance = newMaintenanceMode()
+		dashboardMaintenance.now = clock.Now
+
+		service := NewServiceWithDeps(clock, shortUIDGenerator{})
+		provisioningService := NewProvisioningServiceWithDeps(clock, shortUIDGenerator{})
+
+		admin := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: true}
+		folders := NewFolderService(1, admin)
+
+		folder := store.AddFolder(1, "Ops")
+		stored := store.AddDashboard(1, folder.Id, "CPU")
+		provisioned := store.AddDashboard(1, 0, "Network")
+		store.Provision(provisioned.Id, &models.DashboardProvisioning{Name: "default", ExternalId: "network.json"})
+
+		until := time.Date(2019, 9, 10, 12, 0, 0, 0, time.UTC)
+
+		Convey("When an admin turns the read-only maintenance on", func() {
+			status, err := service.SetMaintenance(MaintenanceOptions{ReadOnly: true, Message: "Upgrading the database", Until: until}, admin)
+			So(err, ShouldBeNil)
+			So(status.ReadOnly, ShouldBeTrue)
+			So(status.Message, ShouldEqual, "Upgrading the database")
+			So(status.Until.Equal(until), ShouldBeTrue)
+			So(status.Configured, ShouldBeFalse)
+
+			expected := models.DashboardsReadOnlyError{Message: "Upgrading the database", Until: until}
+			shouldBeReadOnly := func(err error) {
+				So(xerrors.Is(err, models.ErrDashboardsReadOnly), ShouldBeTrue)
+				readOnlyErr, ok := err.(models.DashboardsReadOnlyError)
+				So(ok, ShouldBeTrue)
+				So(readOnlyErr.Message, ShouldEqual, expected.Message)
+				So(readOnlyErr.Until.Equal(expected.Until), ShouldBeTrue)
+			}
+
+			Convey("Should reject the saves and imports", func() {
+				dash := store.Dashboard(stored.Id)
+				dash.Data.Set("refresh", "1m")
+				_, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: admin, Dashboard: dash})
+				shouldBeReadOnly(err)
+
+				_, err = service.SaveDashboardWithWarnings(&SaveDashboardDTO{OrgId: 1, User: admin, Dashboard: dash})
+				shouldBeReadOnly(err)
+
+				imported := models.NewDashboard("Imported")
+				imported.OrgId = 1
+				_, err = service.ImportDashboard(&SaveDashboardDTO{OrgId: 1, User: admin, Dashboard: imported, Source: models.DashboardSourceImport})
+				shouldBeReadOnly(err)
+
+				shouldBeReadOnly(service.TouchDashboard(stored.Id, 1, admin))
+				So(store.Dashboard(stored.Id).Version, ShouldEqual, 1)
+			})
+
+			Convey("Should reject the deletes", func() {
+				_, err := service.DeleteDashboard(stored.Id, 1)
+				shouldBeReadOnly(err)
+
+				_, err = service.DeleteDashboardIfVersion(stored.Id, 1, 1, admin)
+				shouldBeReadOnly(err)
+
+				So(store.Dashboard(stored.Id), ShouldNotBeNil)
+			})
+
+			Convey("Should reject the writes of the provisioning", func() {
+				dash := store.Dashboard(provisioned.Id)
+				dash.Data.Set("refresh", "1m")
+				_, err := provisioningService.SaveProvisionedDashboard(&SaveDashboardDTO{OrgId: 1, Dashboard: dash},
+					&models.DashboardProvisioning{Name: "default", ExternalId: "network.json"})
+				shouldBeReadOnly(err)
+
+				_, err = provisioningService.SaveFolderForProvisionedDashboards(&SaveDashboardDTO{OrgId: 1, Dashboard: models.NewDashboardFolder("Provisioned")})
+				shouldBeReadOnly(err)
+
+				shouldBeReadOnly(provisioningService.DeleteProvisionedDashboard(provisioned.Id, 1))
+				So(store.Dashboard(provisioned.Id).Version, ShouldEqual, 1)
+
+				maintenance, err := provisioningService.GetMaintenance()
+				So(err, ShouldBeNil)
+				So(maintenance.ReadOnly, ShouldBeTrue)
+			})
+
+			Convey("Should reject the writes of folders", func() {
+				shouldBeReadOnly(folders.CreateFolder(&models.CreateFolderCommand{Title: "Infra"}))
+				shouldBeReadOnly(folders.UpdateFolder(folder.Uid, &models.UpdateFolderCommand{Title: "Operations"}))
+
+				_, err := folders.DeleteFolder(folder.Uid)
+				shouldBeReadOnly(err)
+				So(store.Dashboard(folder.Id).Title, ShouldEqual, "Ops")
+			})
+
+			Convey("Should allow the writes again once it is turned off", func() {
+				status, err := service.SetMaintenance(MaintenanceOptions{ReadOnly: false}, admin)
+				So(err, ShouldBeNil)
+				So(status, ShouldResemble, &MaintenanceStatus{})
+
+				dash := store.Dashboard(stored.Id)
+				dash.Data.Set("refresh", "1m")
+				saved, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: admin, Dashboard: dash})
+				So(err, ShouldBeNil)
+				So(saved.Version, ShouldEqual, 2)
+			})
+		})
+
+		Convey("Given two instances sharing the store", func() {
+			other := newMaintenanceMode()
+			other.now = clock.Now
+
+			So(dashboardMaintenance.check(), ShouldBeNil)
+			So(other.check(), ShouldBeNil)
+
+			Convey("Should apply the maintenance set on one instance to the other once it reads the store again", func() {
+				_, err := dashboardMaintenance.set(MaintenanceOptions{ReadOnly: true, Message: "Upgrading the database"}, admin.UserId)
+				So(err, ShouldBeNil)
+				So(dashboardMaintenance.check(), ShouldResemble, models.DashboardsReadOnlyError{Message: "Upgrading the database"})
+
+				clock.now = clock.now.Add(maintenanceRefreshInterval - time.Second)
+				So(other.check(), ShouldBeNil)
+
+				clock.now = clock.now.Add(time.Second)
+				So(other.check(), ShouldResemble, models.DashboardsReadOnlyError{Message: "Upgrading the database"})
+
+				Convey("Should end the maintenance on both instances", func() {
+					_, err := other.set(MaintenanceOptions{ReadOnly: false}, admin.UserId)
+					So(err, ShouldBeNil)
+					So(other.check(), ShouldBeNil)
+
+					clock.now = clock.now.Add(maintenanceRefreshInterval)
+					So(dashboardMaintenance.check(), ShouldBeNil)
+				})
+
+				Convey("Should keep the maintenance read last when the store cannot be read", func() {
+					bus.AddHandler("test", func(query *models.GetDashboardMaintenanceQuery) error {
+						return errors.New("database is locked")
+					})
+
+					clock.now = clock.now.Add(maintenanceRefreshInterval)
+					So(other.check(), ShouldResemble, models.DashboardsReadOnlyError{Message: "Upgrading the database"})
+				})
+			})
+		})
+
+		Convey("Given the maintenance is forced by the read_only setting", func() {
+			setting.DashboardReadOnly = true
+			setting.DashboardReadOnlyMessage = "Migrating to the new database"
+			setting.DashboardReadOnlyUntil = until
+
+			Convey("Should reject the saves with the configured message", func() {
+				_, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: admin, Dashboard: store.Dashboard(stored.Id)})
+				So(err, ShouldResemble, models.DashboardsReadOnlyError{Message: "Migrating to the new database", Until: until})
+			})
+
+			Convey("Should not be turned off by the API", func() {
+				status, err := service.SetMaintenance(MaintenanceOptions{ReadOnly: false}, admin)
+				So(err, ShouldBeNil)
+				So(status.ReadOnly, ShouldBeTrue)
+				So(status.Configured, ShouldBeTrue)
+				So(status.Message, ShouldEqual, "Migrating to the new database")
+			})
+
+			Reset(func() {
+				setting.DashboardReadOnly = false
+				setting.DashboardReadOnlyMessage = ""
+				setting.DashboardReadOnlyUntil = time.Time{}
+			})
+		})
+
+		Reset(func() {
+			dashboardMaintenance = newMaintenanceMode()
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,442 @@
+package dashboards
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// bundleFormatVersion is raised when the layout of the bundles changes incompatibly
+const bundleFormatVersion = 1
+
+const (
+	bundleManifestPath  = "manifest.json"
+	bundleSignaturePath = "manifest.json.sig"
+)
+
+var (
+	ErrBundleSigningKeyMissing = errors.New("No bundle_signing_key is configured to sign or verify dashboard bundles")
+	ErrBundleUnsigned          = errors.New("The dashboard bundle is not signed")
+	ErrBundleSignatureInvalid  = errors.New("The signature of the dashboard bundle does not match its manifest")
+	ErrBundleConflictMode      = errors.New("The conflict mode must be skip, overwrite or rename")
+)
+
+// BundleInvalidError is returned when a bundle cannot be read or its files do not match its manifest
+type BundleInvalidError struct {
+	Reason string
+}
+
+func (e BundleInvalidError) Error() string {
+	return "Invalid dashboard bundle: " + e.Reason
+}
+
+// ProvisionerPathFunc returns the resolved path of the dashboard provisioner with the name, or an empty string
+// when there is no such provisioner
+type ProvisionerPathFunc func(name string) string
+
+// ExportBundleOptions controls the export of the dashboards of an organization
+type ExportBundleOptions struct {
+	// Sign signs the manifest with the bundle_signing_key
+	Sign bool
+	// ProvisionerPath makes the files of provisioned dashboards relative to their provisioner
+	ProvisionerPath ProvisionerPathFunc
+}
+
+// BundleManifest describes the folders and dashboards of a bundle. Checksums maps the path of every other
+// file of the bundle to its sha256, so signing the manifest covers the whole bundle.
+type BundleManifest struct {
+	FormatVersion  int                `json:"formatVersion"`
+	GrafanaVersion string             `json:"grafanaVersion"`
+	OrgId          int64              `json:"orgId"`
+	Exported       time.Time          `json:"exported"`
+	Folders        []*BundleFolder    `json:"folders"`
+	Dashboards     []*BundleDashboard `json:"dashboards"`
+	Checksums      map[string]string  `json:"checksums"`
+}
+
+// BundleFolder is a folder of a bundle. Permissions is the path of its permissions file, empty when the folder
+// uses the default permissions.
+type BundleFolder struct {
+	Uid         string `json:"uid"`
+	Title       string `json:"title"`
+	Version     int    `json:"version"`
+	Permissions string `json:"permissions,omitempty"`
+}
+
+// BundleDashboard is a dashboard of a bundle, stored at Path without its id and version. FolderUid is empty
+// for dashboards of the General folder.
+type BundleDashboard struct {
+	Uid         string              `json:"uid"`
+	Title       string              `json:"title"`
+	FolderUid   string              `json:"folderUid,omitempty"`
+	Version     int                 `json:"version"`
+	Path        string              `json:"path"`
+	Permissions string              `json:"permissions,omitempty"`
+	Provisioned *BundleProvisioning `json:"provisioned,omitempty"`
+}
+
+// BundleProvisioning flags a provisioned dashboard. ExternalId is the file of the dashboard, relative to its
+// provisioner when Relative is set.
+type BundleProvisioning struct {
+	Name       string `json:"name"`
+	ExternalId string `json:"externalId"`
+	Relative   bool   `json:"relative"`
+	CheckSum   string `json:"checkSum"`
+	Updated    int64  `json:"updated"`
+}
+
+// BundlePermission is a permission set on a folder or dashboard. Users and teams are referenced by login and
+// name, as their ids belong to the instance.
+type BundlePermission struct {
+	Role       *models.RoleType      `json:"role,omitempty"`
+	UserLogin  string                `json:"userLogin,omitempty"`
+	Team       string                `json:"team,omitempty"`
+	Permission models.PermissionType `json:"permission"`
+}
+
+// bundleWriter collects the files of a bundle and their checksums
+type bundleWriter struct {
+	manifest *BundleManifest
+	paths    []string
+	files    map[string][]byte
+}
+
+func (bw *bundleWriter) add(path string, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	bw.addContent(path, content)
+	return nil
+}
+
+func (bw *bundleWriter) addContent(path string, content []byte) {
+	bw.paths = append(bw.paths, path)
+	bw.files[path] = content
+	bw.manifest.Checksums[path] = bundleChecksum(content)
+}
+
+// ExportOrgDashboards writes the folders and dashboards of the organization, with their custom permissions, to w
+// as a tar.gz bundle that ImportOrgDashboards recreates on another instance.
+func (dr *dashboardServiceImpl) ExportOrgDashboards(orgId int64, opts ExportBundleOptions, w io.Writer) error {
+	if opts.Sign && setting.DashboardBundleSigningKey == "" {
+		return ErrBundleSigningKeyMissing
+	}
+
+	query := &models.GetDashboardsByOrgQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return err
+	}
+
+	bw := &bundleWriter{
+		manifest: &BundleManifest{
+			FormatVersion:  bundleFormatVersion,
+			GrafanaVersion: setting.BuildVersion,
+			OrgId:          orgId,
+			Exported:       dr.now(),
+			Folders:        make([]*BundleFolder, 0),
+			Dashboards:     make([]*BundleDashboard, 0),
+			Checksums:      make(map[string]string),
+		},
+		files: make(map[string][]byte),
+	}
+
+	dashboardIds := make([]int64, 0, len(query.Result))
+	for _, dash := range query.Result {
+		if !dash.IsFolder {
+			dashboardIds = append(dashboardIds, dash.Id)
+		}
+	}
+
+	provisioned := map[int64]*models.DashboardProvisioning{}
+	if len(dashboardIds) > 0 {
+		var err error
+		if provisioned, err = dr.GetProvisionedDashboardDataByDashboardIds(dashboardIds); err != nil {
+			return err
+		}
+	}
+
+	folderUids := make(map[int64]string)
+	for _, dash := range query.Result {
+		permissions, err := exportPermissions(bw, dash)
+		if err != nil {
+			return err
+		}
+
+		if dash.IsFolder {
+			folderUids[dash.Id] = dash.Uid
+			bw.manifest.Folders = append(bw.manifest.Folders, &BundleFolder{
+				Uid:         dash.Uid,
+				Title:       dash.Title,
+				Version:     dash.Version,
+				Permissions: permissions,
+			})
+			continue
+		}
+
+		content, err := dashboardExportCache.content(exportKindBundle, dash, func() ([]byte, error) {
+			return bundleDashboardJson(dash)
+		})
+		if err != nil {
+			return err
+		}
+
+		entry := &BundleDashboard{
+			Uid:         dash.Uid,
+			Title:       dash.Title,
+			FolderUid:   folderUids[dash.FolderId],
+			Version:     dash.Version,
+			Path:        "dashboards/" + dash.Uid + ".json",
+			Permissions: permissions,
+		}
+		if provisioning, ok := provisioned[dash.Id]; ok {
+			entry.Provisioned = exportProvisioning(provisioning, opts.ProvisionerPath)
+		}
+
+		bw.addContent(entry.Path, content)
+		bw.manifest.Dashboards = append(bw.manifest.Dashboards, entry)
+	}
+
+	return writeBundle(w, bw, opts.Sign)
+}
+
+// bundleDashboardJson returns the json of the dashboard in a bundle, without the id and version of the instance
+func bundleDashboardJson(dash *models.Dashboard) ([]byte, error) {
+	data, err := copyDashboardData(dash.Data)
+	if err != nil {
+		return nil, err
+	}
+	data.Del("id")
+	data.Del("version")
+
+	return json.MarshalIndent(data, "", "  ")
+}
+
+// exportPermissions adds the permissions set on the dashboard itself to the bundle, returning the path of their
+// file or an empty string when the dashboard uses the default or inherited permissions
+func exportPermissions(bw *bundleWriter, dash *models.Dashboard) (string, error) {
+	if !dash.HasAcl {
+		return "", nil
+	}
+
+	query := &models.GetDashboardAclInfoListQuery{DashboardId: dash.Id, OrgId: dash.OrgId}
+	if err := bus.Dispatch(query); err != nil {
+		return "", err
+	}
+
+	permissions := make([]*BundlePermission, 0)
+	for _, item := range customAcl(query.Result, dash.Id) {
+		permission := &BundlePermission{Role: item.Role, Permission: item.Permission}
+		if item.UserId > 0 {
+			permission.UserLogin = item.UserLogin
+		}
+		if item.TeamId > 0 {
+			permission.Team = item.Team
+		}
+		permissions = append(permissions, permission)
+	}
+
+	path := "permissions/" + dash.Uid + ".json"
+	return path, bw.add(path, permissions)
+}
+
+func exportProvisioning(provisioning *models.DashboardProvisioning, provisionerPath ProvisionerPathFunc) *BundleProvisioning {
+	result := &BundleProvisioning{
+		Name:       provisioning.Name,
+		ExternalId: provisioning.ExternalId,
+		CheckSum:   provisioning.CheckSum,
+		Updated:    provisioning.Updated,
+	}
+
+	if provisionerPath == nil {
+		return result
+	}
+
+	base := provisionerPath(provisioning.Name)
+	if base == "" {
+		return result
+	}
+
+	rel, err := filepath.Rel(base, provisioning.ExternalId)
+	if err == nil && !strings.HasPrefix(rel, "..") {
+		result.ExternalId = filepath.ToSlash(rel)
+		result.Relative = true
+	}
+	return result
+}
+
+func writeBundle(w io.Writer, bw *bundleWriter, sign bool) error {
+	manifest, err := json.MarshalIndent(bw.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := writeBundleFile(tw, bundleManifestPath, manifest); err != nil {
+		return err
+	}
+
+	if sign {
+		signature := []byte(signBundleManifest(manifest, setting.DashboardBundleSigningKey))
+		if err := writeBundleFile(tw, bundleSignaturePath, signature); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range bw.paths {
+		if err := writeBundleFile(tw, path, bw.files[path]); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeBundleFile(tw *tar.Writer, path string, content []byte) error {
+	header := &tar.Header{Name: path, Mode: 0644, Size: int64(len(content)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(content)
+	return err
+}
+
+// readBundle returns the files of a tar.gz bundle by path
+func readBundle(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, BundleInvalidError{Reason: err.Error()}
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, BundleInvalidError{Reason: err.Error()}
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, BundleInvalidError{Reason: err.Error()}
+		}
+		files[header.Name] = content
+	}
+}
+
+// verifyBundle checks the signature and the checksums of the bundle before anything is imported. It returns
+// the manifest, and whether its signature was verified.
+func verifyBundle(files map[string][]byte, opts ImportBundleOptions) (*BundleManifest, bool, error) {
+	content, ok := files[bundleManifestPath]
+	if !ok {
+		return nil, false, BundleInvalidError{Reason: "the manifest is missing"}
+	}
+
+	verified := false
+	key := setting.DashboardBundleSigningKey
+	if signature, signed := files[bundleSignaturePath]; signed {
+		if key == "" {
+			return nil, false, ErrBundleSigningKeyMissing
+		}
+		expected := signBundleManifest(content, key)
+		if !hmac.Equal([]byte(strings.TrimSpace(string(signature))), []byte(expected)) {
+			return nil, false, ErrBundleSignatureInvalid
+		}
+		verified = true
+	} else if key != "" && !opts.AllowUnsigned {
+		return nil, false, ErrBundleUnsigned
+	}
+
+	manifest := &BundleManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, false, BundleInvalidError{Reason: "the manifest cannot be parsed: " + err.Error()}
+	}
+
+	if manifest.FormatVersion != bundleFormatVersion {
+		return nil, false, BundleInvalidError{Reason: fmt.Sprintf("format version %d is not supported", manifest.FormatVersion)}
+	}
+
+	for path, checksum := range manifest.Checksums {
+		file, ok := files[path]
+		if !ok {
+			return nil, false, BundleInvalidError{Reason: "file " + path + " is missing"}
+		}
+		if bundleChecksum(file) != checksum {
+			return nil, false, BundleInvalidError{Reason: "the checksum of " + path + " does not match the manifest"}
+		}
+	}
+
+	folders := make(map[string]bool)
+	for _, folder := range manifest.Folders {
+		folders[folder.Uid] = true
+		if err := checkBundlePath(manifest, folder.Permissions, false); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, dash := range manifest.Dashboards {
+		if dash.FolderUid != "" && !folders[dash.FolderUid] {
+			return nil, false, BundleInvalidError{Reason: "the folder of dashboard " + dash.Uid + " is missing"}
+		}
+		if err := checkBundlePath(manifest, dash.Path, true); err != nil {
+			return nil, false, err
+		}
+		if err := checkBundlePath(manifest, dash.Permissions, false); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return manifest, verified, nil
+}
+
+// checkBundlePath makes sure a file referenced by the manifest is covered by its checksums
+func checkBundlePath(manifest *BundleManifest, path string, required bool) error {
+	if path == "" && !required {
+		return nil
+	}
+
+	if _, ok := manifest.Checksums[path]; !ok {
+		return BundleInvalidError{Reason: "file " + path + " has no checksum"}
+	}
+	return nil
+}
+
+func bundleChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func signBundleManifest(manifest []byte, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(manifest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
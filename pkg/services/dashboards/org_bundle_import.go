@@ -0,0 +1,547 @@
+package dashboards
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// BundleConflictMode tells what happens to the items of a bundle whose uid, or title within the folder, is
+// already used in the organization
+type BundleConflictMode string
+
+const (
+	BundleConflictSkip      BundleConflictMode = "skip"
+	BundleConflictOverwrite BundleConflictMode = "overwrite"
+	BundleConflictRename    BundleConflictMode = "rename"
+)
+
+// The statuses of the items of an imported bundle
+const (
+	BundleItemCreated     = "created"
+	BundleItemOverwritten = "overwritten"
+	BundleItemRenamed     = "renamed"
+	BundleItemSkipped     = "skipped"
+	BundleItemFailed      = "failed"
+	BundleItemRolledBack  = "rolled-back"
+)
+
+// renamedTitleSuffix is added to the titles of renamed items that clash with an existing title
+const renamedTitleSuffix = " (imported)"
+
+// ImportBundleOptions controls the import of a dashboard bundle
+type ImportBundleOptions struct {
+	// OnConflict defaults to skip
+	OnConflict BundleConflictMode
+	// AllowUnsigned imports unsigned bundles although a bundle_signing_key is configured
+	AllowUnsigned bool
+	// ProvisionerPath tells which provisioners exist, provisioned dashboards of other provisioners are
+	// imported as regular dashboards
+	ProvisionerPath ProvisionerPathFunc
+}
+
+// BundleImportReport lists the result of importing each folder and dashboard of a bundle. Verified is set when
+// the signature of the bundle was checked.
+type BundleImportReport struct {
+	Verified bool                `json:"verified"`
+	Items    []*BundleImportItem `json:"items"`
+}
+
+// BundleImportItem is the result of importing a folder or dashboard. NewUid is set when it was renamed. Folders
+// are not committed, dashboards are saved even when their commit fails unless batch_sync_failure_policy is fail.
+type BundleImportItem struct {
+	Uid         string   `json:"uid"`
+	NewUid      string   `json:"newUid,omitempty"`
+	Title       string   `json:"title"`
+	IsFolder    bool     `json:"isFolder"`
+	DashboardId int64    `json:"dashboardId,omitempty"`
+	Status      string   `json:"status"`
+	Provisioned bool     `json:"provisioned"`
+	Error       string   `json:"error,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"`
+	BatchItemState
+}
+
+func (item *BundleImportItem) warn(format string, args ...interface{}) {
+	item.Warnings = append(item.Warnings, fmt.Sprintf(format, args...))
+}
+
+// ImportOrgDashboards recreates the folders and dashboards of a bundle made by ExportOrgDashboards in the
+// organization. The signature and checksums of the bundle are verified before anything is imported. Each folder
+// is imported with its dashboards as a unit: when one of them fails, the items of the folder imported so far are
+// deleted or restored. Permissions are set once all the items of a folder are imported, and those that cannot
+// be set, e.g. for a user missing from the organization, are reported as warnings.
+func (dr *dashboardServiceImpl) ImportOrgDashboards(orgId int64, user *models.SignedInUser, bundle io.Reader, opts ImportBundleOptions) (*BundleImportReport, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = BundleConflictSkip
+	case BundleConflictSkip, BundleConflictOverwrite, BundleConflictRename:
+	default:
+		return nil, ErrBundleConflictMode
+	}
+
+	files, err := readBundle(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, verified, err := verifyBundle(files, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bi := &bundleImporter{
+		dr:     dr,
+		orgId:  orgId,
+		user:   user,
+		opts:   opts,
+		files:  files,
+		report: &BundleImportReport{Verified: verified, Items: make([]*BundleImportItem, 0)},
+	}
+
+	byFolder := make(map[string][]*BundleDashboard)
+	for _, dash := range manifest.Dashboards {
+		byFolder[dash.FolderUid] = append(byFolder[dash.FolderUid], dash)
+	}
+
+	bi.importFolder(nil, byFolder[""])
+	for _, folder := range manifest.Folders {
+		bi.importFolder(folder, byFolder[folder.Uid])
+	}
+
+	return bi.report, nil
+}
+
+type bundleImporter struct {
+	dr     *dashboardServiceImpl
+	orgId  int64
+	user   *models.SignedInUser
+	opts   ImportBundleOptions
+	files  map[string][]byte
+	report *BundleImportReport
+}
+
+// folderImport tracks how to undo the items of a folder imported so far, and the permissions to set once
+// they are all imported
+type folderImport struct {
+	undo        []bundleUndo
+	permissions []pendingPermissions
+}
+
+type bundleUndo struct {
+	item *BundleImportItem
+	fn   func() error
+}
+
+type pendingPermissions struct {
+	item *BundleImportItem
+	path string
+}
+
+func (fi *folderImport) imported(item *BundleImportItem, permissions string, undo func() error) {
+	fi.undo = append(fi.undo, bundleUndo{item: item, fn: undo})
+	if permissions != "" {
+		fi.permissions = append(fi.permissions, pendingPermissions{item: item, path: permissions})
+	}
+}
+
+// importFolder imports the folder, nil for the General folder, and its dashboards
+func (bi *bundleImporter) importFolder(folder *BundleFolder, dashboards []*BundleDashboard) {
+	fi := &folderImport{}
+	folderId := int64(0)
+
+	if folder != nil {
+		item := &BundleImportItem{Uid: folder.Uid, Title: folder.Title, IsFolder: true}
+		bi.report.Items = append(bi.report.Items, item)
+
+		id, err := bi.importFolderEntry(folder, item, fi)
+		if err != nil {
+			item.Status = BundleItemFailed
+			item.Error = err.Error()
+			bi.notImported(dashboards, "the folder could not be imported")
+			return
+		}
+		folderId = id
+	}
+
+	for i, dash := range dashboards {
+		item := &BundleImportItem{Uid: dash.Uid, Title: dash.Title}
+		bi.report.Items = append(bi.report.Items, item)
+
+		if err := bi.importDashboard(dash, folderId, item, fi); err != nil {
+			item.Status = BundleItemFailed
+			item.Error = err.Error()
+			bi.rollback(fi)
+			bi.notImported(dashboards[i+1:], "another item of the folder failed")
+			return
+		}
+	}
+
+	for _, pending := range fi.permissions {
+		bi.importPermissions(pending)
+	}
+}
+
+func (bi *bundleImporter) notImported(dashboards []*BundleDashboard, reason string) {
+	for _, dash := range dashboards {
+		bi.report.Items = append(bi.report.Items, &BundleImportItem{
+			Uid:    dash.Uid,
+			Title:  dash.Title,
+			Status: BundleItemFailed,
+			Error:  "Not imported, " + reason,
+		})
+	}
+}
+
+// rollback undoes the items of the folder imported so far, latest first
+func (bi *bundleImporter) rollback(fi *folderImport) {
+	for i := len(fi.undo) - 1; i >= 0; i-- {
+		undo := fi.undo[i]
+		if err := undo.fn(); err != nil {
+			bi.dr.log.Error("Failed to roll back bundle import", "uid", undo.item.Uid, "error", err)
+			undo.item.warn("Failed to roll back: %v", err)
+			continue
+		}
+		undo.item.Status = BundleItemRolledBack
+		undo.item.DbSaved = false
+	}
+}
+
+func (bi *bundleImporter) importFolderEntry(folder *BundleFolder, item *BundleImportItem, fi *folderImport) (int64, error) {
+	existing, err := bi.getByUid(folder.Uid)
+	if err != nil {
+		return 0, err
+	}
+
+	if existing == nil {
+		return bi.createFolder(folder.Uid, folder, item, fi)
+	}
+
+	switch bi.opts.OnConflict {
+	case BundleConflictOverwrite:
+		if !existing.IsFolder {
+			return 0, models.ErrFolderWithSameUIDExists
+		}
+
+		previousTitle := existing.Title
+		folders := NewFolderService(bi.orgId, bi.user)
+		if err := folders.UpdateFolder(folder.Uid, &models.UpdateFolderCommand{Title: folder.Title, Overwrite: true}); err != nil {
+			return 0, err
+		}
+
+		item.DashboardId = existing.Id
+		item.Status = BundleItemOverwritten
+		item.DbSaved = true
+		fi.imported(item, folder.Permissions, func() error {
+			return folders.UpdateFolder(folder.Uid, &models.UpdateFolderCommand{Title: previousTitle, Overwrite: true})
+		})
+		return existing.Id, nil
+	case BundleConflictRename:
+		item.NewUid = bi.dr.newID()
+		return bi.createFolder(item.NewUid, folder, item, fi)
+	default:
+		if !existing.IsFolder {
+			return 0, models.ErrFolderWithSameUIDExists
+		}
+		item.Status = BundleItemSkipped
+		return existing.Id, nil
+	}
+}
+
+// createFolder creates the folder with the uid. When another folder has its title, the dashboards are imported
+// into that folder unless items are renamed on conflict.
+func (bi *bundleImporter) createFolder(uid string, folder *BundleFolder, item *BundleImportItem, fi *folderImport) (int64, error) {
+	folders := NewFolderService(bi.orgId, bi.user)
+	cmd := &models.CreateFolderCommand{Uid: uid, Title: folder.Title}
+
+	err := folders.CreateFolder(cmd)
+	if err == models.ErrFolderSameNameExists {
+		if bi.opts.OnConflict != BundleConflictRename {
+			item.Status = BundleItemSkipped
+			item.warn("A folder with the same title exists, its dashboards are imported into it")
+			return getFolderIdByTitle(bi.orgId, folder.Title)
+		}
+
+		cmd.Title = folder.Title + renamedTitleSuffix
+		err = folders.CreateFolder(cmd)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	item.DashboardId = cmd.Result.Id
+	item.Status = BundleItemCreated
+	item.DbSaved = true
+	if item.NewUid != "" || cmd.Title != folder.Title {
+		item.Status = BundleItemRenamed
+	}
+
+	fi.imported(item, folder.Permissions, func() error {
+		return bi.dr.deleteDashboard(cmd.Result.Id, bi.orgId, false)
+	})
+	return cmd.Result.Id, nil
+}
+
+func (bi *bundleImporter) importDashboard(entry *BundleDashboard, folderId int64, item *BundleImportItem, fi *folderImport) error {
+	data, err := simplejson.NewJson(bi.files[entry.Path])
+	if err != nil {
+		return err
+	}
+	data.Set("uid", entry.Uid)
+
+	previous, err := bi.getByUid(entry.Uid)
+	if err != nil {
+		return err
+	}
+
+	if previous != nil {
+		switch bi.opts.OnConflict {
+		case BundleConflictSkip:
+			item.Status = BundleItemSkipped
+			return nil
+		case BundleConflictRename:
+			item.NewUid = bi.dr.newID()
+			data.Set("uid", item.NewUid)
+			previous = nil
+		}
+	}
+
+	saved, err := bi.saveDashboard(entry, data, folderId, previous != nil, item)
+	if err == models.ErrDashboardWithSameNameInFolderExists {
+		switch bi.opts.OnConflict {
+		case BundleConflictSkip:
+			item.Status = BundleItemSkipped
+			item.warn("A dashboard with the same title exists in the folder")
+			return nil
+		case BundleConflictRename:
+			data.Set("title", entry.Title+renamedTitleSuffix)
+		case BundleConflictOverwrite:
+			if previous, err = bi.getByTitle(entry.Title, folderId); err != nil {
+				return err
+			}
+		}
+		saved, err = bi.saveDashboard(entry, data, folderId, previous != nil, item)
+	}
+	if err != nil {
+		return err
+	}
+
+	item.DashboardId = saved.Id
+	switch {
+	case previous != nil:
+		item.Status = BundleItemOverwritten
+		fi.imported(item, entry.Permissions, func() error {
+			return bi.restoreDashboard(previous)
+		})
+	default:
+		item.Status = BundleItemCreated
+		if item.NewUid != "" || data.Get("title").MustString() != entry.Title {
+			item.Status = BundleItemRenamed
+		}
+		fi.imported(item, entry.Permissions, func() error {
+			return bi.dr.deleteDashboard(saved.Id, bi.orgId, false)
+		})
+	}
+	return nil
+}
+
+// saveDashboard saves the dashboard, as provisioned when it was exported provisioned and its provisioner exists
+func (bi *bundleImporter) saveDashboard(entry *BundleDashboard, data *simplejson.Json, folderId int64, overwrite bool, item *BundleImportItem) (*models.Dashboard, error) {
+	dash := models.NewDashboardFromJson(data)
+	dash.OrgId = bi.orgId
+	dash.FolderId = folderId
+
+	dto := &SaveDashboardDTO{
+		OrgId:     bi.orgId,
+		User:      bi.user,
+		Dashboard: dash,
+		Overwrite: overwrite,
+		Message:   "Imported from bundle",
+		Source:    models.DashboardSourceImport,
+
+		SyncFailurePolicy: setting.DashboardBatchSyncFailurePolicy,
+	}
+
+	provisioning := bi.provisioning(entry, item)
+	if provisioning == nil {
+		result, err := bi.dr.saveDashboardWithWarnings(dto)
+		if err != nil {
+			return nil, err
+		}
+		item.saved(result)
+		return result.Dashboard, nil
+	}
+
+	saved, err := NewProvisioningService().SaveProvisionedDashboard(dto, provisioning)
+	if err == nil {
+		item.Provisioned = true
+		item.DbSaved = true
+	}
+	return saved, err
+}
+
+// provisioning returns the provisioning data of the dashboard in this instance, or nil to import it as a
+// regular dashboard
+func (bi *bundleImporter) provisioning(entry *BundleDashboard, item *BundleImportItem) *models.DashboardProvisioning {
+	if entry.Provisioned == nil {
+		return nil
+	}
+
+	base := ""
+	if bi.opts.ProvisionerPath != nil {
+		base = bi.opts.ProvisionerPath(entry.Provisioned.Name)
+	}
+	if base == "" {
+		if len(item.Warnings) == 0 {
+			item.warn("Provisioner %s does not exist, imported as a regular dashboard", entry.Provisioned.Name)
+		}
+		return nil
+	}
+
+	externalId := entry.Provisioned.ExternalId
+	if entry.Provisioned.Relative {
+		externalId = filepath.Join(base, filepath.FromSlash(externalId))
+	}
+
+	return &models.DashboardProvisioning{
+		Name:       entry.Provisioned.Name,
+		ExternalId: externalId,
+		CheckSum:   entry.Provisioned.CheckSum,
+		Updated:    entry.Provisioned.Updated,
+	}
+}
+
+// restoreDashboard saves the dashboard replaced by the import back
+func (bi *bundleImporter) restoreDashboard(previous *models.Dashboard) error {
+	data, err := copyDashboardData(previous.Data)
+	if err != nil {
+		return err
+	}
+
+	dash := models.NewDashboardFromJson(data)
+	dash.OrgId = bi.orgId
+	dash.FolderId = previous.FolderId
+
+	_, err = bi.dr.SaveDashboard(&SaveDashboardDTO{
+		OrgId:     bi.orgId,
+		User:      bi.user,
+		Dashboard: dash,
+		Overwrite: true,
+		Message:   "Restored after a failed bundle import",
+		Source:    models.DashboardSourceRestore,
+
+		SyncFailurePolicy: setting.DashboardBatchSyncFailurePolicy,
+	})
+	return err
+}
+
+// importPermissions replaces the permissions of an imported item with those of the bundle
+func (bi *bundleImporter) importPermissions(pending pendingPermissions) {
+	item := pending.item
+
+	var permissions []*BundlePermission
+	if err := json.Unmarshal(bi.files[pending.path], &permissions); err != nil {
+		item.warn("Failed to read permissions: %v", err)
+		return
+	}
+
+	now := bi.dr.now()
+	acl := make([]*models.DashboardAcl, 0, len(permissions))
+	for _, permission := range permissions {
+		entry := &models.DashboardAcl{
+			OrgId:       bi.orgId,
+			DashboardId: item.DashboardId,
+			Role:        permission.Role,
+			Permission:  permission.Permission,
+			Created:     now,
+			Updated:     now,
+		}
+
+		switch {
+		case permission.UserLogin != "":
+			userId, err := bi.getOrgUserId(permission.UserLogin)
+			if err != nil {
+				item.warn("Permission of user %s not imported: %v", permission.UserLogin, err)
+				continue
+			}
+			entry.UserId = userId
+		case permission.Team != "":
+			teamId, err := bi.getTeamId(permission.Team)
+			if err != nil {
+				item.warn("Permission of team %s not imported: %v", permission.Team, err)
+				continue
+			}
+			entry.TeamId = teamId
+		}
+
+		acl = append(acl, entry)
+	}
+
+	cmd := &models.UpdateDashboardAclCommand{DashboardId: item.DashboardId, Items: acl}
+	if err := bi.dr.UpdateDashboardPermissions(cmd, bi.orgId, bi.user); err != nil {
+		item.warn("Failed to set permissions: %v", err)
+	}
+}
+
+func (bi *bundleImporter) getOrgUserId(login string) (int64, error) {
+	query := &models.GetUserByLoginQuery{LoginOrEmail: login}
+	if err := bus.Dispatch(query); err != nil {
+		return 0, err
+	}
+
+	orgs := &models.GetUserOrgListQuery{UserId: query.Result.Id}
+	if err := bus.Dispatch(orgs); err != nil {
+		return 0, err
+	}
+
+	for _, org := range orgs.Result {
+		if org.OrgId == bi.orgId {
+			return query.Result.Id, nil
+		}
+	}
+	return 0, models.ErrOrgUserNotFound
+}
+
+func (bi *bundleImporter) getTeamId(name string) (int64, error) {
+	query := &models.SearchTeamsQuery{OrgId: bi.orgId, Name: name, Limit: 1, Page: 1}
+	if err := bus.Dispatch(query); err != nil {
+		return 0, err
+	}
+
+	if len(query.Result.Teams) == 0 {
+		return 0, models.ErrTeamNotFound
+	}
+	return query.Result.Teams[0].Id, nil
+}
+
+// getByUid returns the dashboard or folder with the uid, or nil when there is none
+func (bi *bundleImporter) getByUid(uid string) (*models.Dashboard, error) {
+	query := &models.GetDashboardQuery{OrgId: bi.orgId, Uid: uid}
+	err := bus.Dispatch(query)
+	if err == models.ErrDashboardNotFound {
+		return nil, nil
+	}
+	return query.Result, err
+}
+
+// getByTitle returns the dashboard of the folder with the title, or nil when there is none
+func (bi *bundleImporter) getByTitle(title string, folderId int64) (*models.Dashboard, error) {
+	query := &models.GetDashboardsBySlugQuery{OrgId: bi.orgId, Slug: models.SlugifyTitle(title)}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	for _, dash := range query.Result {
+		if !dash.IsFolder && dash.FolderId == folderId && strings.EqualFold(dash.Title, title) {
+			return dash, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,573 @@
+package dashboards
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeBundleStore keeps the dashboards, permissions and provisioning data of several organizations on the bus
+type fakeBundleStore struct {
+	nextId       int64
+	dashboards   map[int64]*models.Dashboard
+	acl          map[int64][]*models.DashboardAclInfoDTO
+	provisioning map[int64]*models.DashboardProvisioning
+	failSave     func(dash *models.Dashboard) error
+}
+
+func (s *fakeBundleStore) add(dash *models.Dashboard, orgId int64, uid string) *models.Dashboard {
+	s.nextId++
+	dash.Id = s.nextId
+	dash.OrgId = orgId
+	dash.Uid = uid
+	dash.Version = 3
+	dash.Data.Set("id", dash.Id)
+	dash.Data.Set("uid", uid)
+	s.dashboards[dash.Id] = dash
+	return dash
+}
+
+func (s *fakeBundleStore) byUid(orgId int64, uid string) *models.Dashboard {
+	for _, dash := range s.dashboards {
+		if dash.OrgId == orgId && dash.Uid == uid {
+			return dash
+		}
+	}
+	return nil
+}
+
+func (s *fakeBundleStore) save(cmd *models.SaveDashboardCommand) (*models.Dashboard, error) {
+	dash := cmd.GetDashboardModel()
+	if s.failSave != nil {
+		if err := s.failSave(dash); err != nil {
+			return nil, err
+		}
+	}
+
+	if dash.Uid == "" {
+		dash.Uid = "generated"
+	}
+
+	if existing := s.byUid(dash.OrgId, dash.Uid); existing != nil {
+		if !cmd.Overwrite && dash.Id != existing.Id {
+			return nil, models.ErrDashboardWithSameUIDExists
+		}
+		dash.Id = existing.Id
+		dash.HasAcl = existing.HasAcl
+	} else {
+		s.nextId++
+		dash.Id = s.nextId
+	}
+
+	dash.Data.Set("id", dash.Id)
+	s.dashboards[dash.Id] = dash
+	return dash, nil
+}
+
+func (s *fakeBundleStore) register() {
+	bus.AddHandler("test", func(query *models.GetDashboardsByOrgQuery) error {
+		for _, isFolder := range []bool{true, false} {
+			for id := int64(1); id <= s.nextId; id++ {
+				if dash, ok := s.dashboards[id]; ok && dash.OrgId == query.OrgId && dash.IsFolder == isFolder {
+					query.Result = append(query.Result, dash)
+				}
+			}
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+		if query.Id > 0 {
+			if dash, ok := s.dashboards[query.Id]; ok {
+				query.Result = dash
+				return nil
+			}
+		} else if dash := s.byUid(query.OrgId, query.Uid); dash != nil {
+			query.Result = dash
+			return nil
+		}
+		return models.ErrDashboardNotFound
+	})
+
+	bus.AddHandler("test", func(query *models.GetDashboardsBySlugQuery) error {
+		for _, dash := range s.dashboards {
+			if dash.OrgId == query.OrgId && dash.Slug == query.Slug {
+				query.Result = append(query.Result, dash)
+			}
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+		for _, dash := range s.dashboards {
+			if dash.OrgId != cmd.OrgId || dash.FolderId != cmd.Dashboard.FolderId || dash.Uid == cmd.Dashboard.Uid {
+				continue
+			}
+			if !strings.EqualFold(dash.Title, cmd.Dashboard.Title) {
+				continue
+			}
+			if !cmd.Overwrite {
+				return models.ErrDashboardWithSameNameInFolderExists
+			}
+			cmd.Dashboard.SetId(dash.Id)
+			cmd.Dashboard.SetUid(dash.Uid)
+		}
+		cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+		query.Result = snapshotWithFolder(query)
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+		dash, err := s.save(cmd)
+		cmd.Result = dash
+		return err
+	})
+
+	bus.AddHandler("test", func(cmd *models.SaveProvisionedDashboardCommand) error {
+		dash, err := s.save(cmd.DashboardCmd)
+		if err != nil {
+			return err
+		}
+		s.provisioning[dash.Id] = cmd.DashboardProvisioning
+		cmd.DashboardCmd.Result = dash
+		cmd.Result = dash
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetProvisionedDashboardDataByIdsQuery) error {
+		query.Result = make(map[int64]*models.DashboardProvisioning)
+		for _, id := range query.DashboardIds {
+			if provisioning, ok := s.provisioning[id]; ok {
+				query.Result[id] = provisioning
+			}
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.DeleteDashboardCommand) error {
+		delete(s.dashboards, cmd.Id)
+		delete(s.acl, cmd.Id)
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetDashboardAclInfoListQuery) error {
+		query.Result = s.acl[query.DashboardId]
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.UpdateDashboardAclCommand) error {
+		acl := make([]*models.DashboardAclInfoDTO, 0)
+		for _, item := range cmd.Items {
+			acl = append(acl, &models.DashboardAclInfoDTO{
+				DashboardId: cmd.DashboardId,
+				UserId:      item.UserId,
+				TeamId:      item.TeamId,
+				Role:        item.Role,
+				Permission:  item.Permission,
+			})
+		}
+		s.acl[cmd.DashboardId] = acl
+		s.dashboards[cmd.DashboardId].HasAcl = true
+		return nil
+	})
+
+	// alice is a member of both organizations, bob only of the first one
+	users := map[string]*models.User{"alice": {Id: 21, Login: "alice"}, "bob": {Id: 22, Login: "bob"}}
+	bus.AddHandler("test", func(query *models.GetUserByLoginQuery) error {
+		user, ok := users[query.LoginOrEmail]
+		if !ok {
+			return models.ErrUserNotFound
+		}
+		query.Result = user
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetUserOrgListQuery) error {
+		query.Result = []*models.UserOrgDTO{{OrgId: 1}}
+		if query.UserId == 21 {
+			query.Result = append(query.Result, &models.UserOrgDTO{OrgId: 2})
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.SearchTeamsQuery) error {
+		if query.Name == "ops" {
+			query.Result.Teams = []*models.TeamDTO{{Id: 30 + query.OrgId, Name: "ops"}}
+		}
+		return nil
+	})
+}
+
+func rebuildBundle(files map[string][]byte) *bytes.Buffer {
+	var bundle bytes.Buffer
+	gz := gzip.NewWriter(&bundle)
+	tw := tar.NewWriter(gz)
+	for path, content := range files {
+		So(writeBundleFile(tw, path, content), ShouldBeNil)
+	}
+	So(tw.Close(), ShouldBeNil)
+	So(gz.Close(), ShouldBeNil)
+	return &bundle
+}
+
+func findBundleItem(report *BundleImportReport, uid string) *BundleImportItem {
+	for _, item := range report.Items {
+		if item.Uid == uid {
+			return item
+		}
+	}
+	return nil
+}
+
+func TestOrgDashboardBundle(t *testing.T) {
+	Convey("Given an organization with folders, permissions and a provisioned dashboard", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true, CanViewValue: true})
+
+		origSigningKey := setting.DashboardBundleSigningKey
+		setting.DashboardBundleSigningKey = "secret"
+
+		store := &fakeBundleStore{
+			dashboards:   make(map[int64]*models.Dashboard),
+			acl:          make(map[int64][]*models.DashboardAclInfoDTO),
+			provisioning: make(map[int64]*models.DashboardProvisioning),
+		}
+		store.register()
+
+		teamA := store.add(models.NewDashboardFolder("Team A"), 1, "team-a")
+		teamA.HasAcl = true
+		store.acl[teamA.Id] = []*models.DashboardAclInfoDTO{
+			{DashboardId: teamA.Id, UserId: 21, UserLogin: "alice", Permission: models.PERMISSION_EDIT},
+			{DashboardId: teamA.Id, UserId: 22, UserLogin: "bob", Permission: models.PERMISSION_VIEW},
+			{DashboardId: teamA.Id, TeamId: 31, Team: "ops", Permission: models.PERMISSION_ADMIN},
+		}
+		store.add(models.NewDashboardFolder("Empty"), 1, "empty")
+
+		store.add(models.NewDashboard("Home"), 1, "home")
+
+		board := store.add(models.NewDashboard("Board"), 1, "board")
+		board.FolderId = teamA.Id
+
+		provisioned := store.add(models.NewDashboard("Provisioned"), 1, "provisioned")
+		provisioned.FolderId = teamA.Id
+		store.provisioning[provisioned.Id] = &models.DashboardProvisioning{
+			Name:       "default",
+			ExternalId: "/etc/grafana/dashboards/team-a/provisioned.json",
+			CheckSum:   "abc",
+			Updated:    100,
+		}
+
+		service := &dashboardServiceImpl{idGenerator: &fakeIDGenerator{}}
+		user := &models.SignedInUser{UserId: 1, OrgId: 2, Login: "admin", OrgRole: models.ROLE_ADMIN}
+
+		export := func(sign bool) *bytes.Buffer {
+			var bundle bytes.Buffer
+			opts := ExportBundleOptions{
+				Sign: sign,
+				ProvisionerPath: func(name string) string {
+					if name == "default" {
+						return "/etc/grafana/dashboards"
+					}
+					return ""
+				},
+			}
+			So(service.ExportOrgDashboards(1, opts, &bundle), ShouldBeNil)
+			return &bundle
+		}
+
+		importOpts := ImportBundleOptions{
+			ProvisionerPath: func(name string) string {
+				if name == "default" {
+					return "/var/lib/dashboards"
+				}
+				return ""
+			},
+		}
+
+		Convey("When exporting the organization", func() {
+			files, err := readBundle(export(true))
+			So(err, ShouldBeNil)
+
+			manifest, verified, err := verifyBundle(files, ImportBundleOptions{})
+			So(err, ShouldBeNil)
+			So(verified, ShouldBeTrue)
+
+			Convey("Should list the folders and their dashboards", func() {
+				So(len(manifest.Folders), ShouldEqual, 2)
+				So(manifest.Folders[0].Uid, ShouldEqual, "team-a")
+				So(manifest.Folders[0].Permissions, ShouldEqual, "permissions/team-a.json")
+				So(manifest.Folders[1].Permissions, ShouldEqual, "")
+
+				So(len(manifest.Dashboards), ShouldEqual, 3)
+				So(manifest.Dashboards[0].FolderUid, ShouldEqual, "")
+				So(manifest.Dashboards[1].FolderUid, ShouldEqual, "team-a")
+				So(manifest.Dashboards[1].Version, ShouldEqual, 3)
+			})
+
+			Convey("Should store dashboards without their id and version", func() {
+				So(string(files["dashboards/board.json"]), ShouldNotContainSubstring, `"id"`)
+				So(string(files["dashboards/board.json"]), ShouldContainSubstring, `"title": "Board"`)
+			})
+
+			Convey("Should make provisioned files relative to their provisioner", func() {
+				So(manifest.Dashboards[2].Provisioned, ShouldResemble, &BundleProvisioning{
+					Name:       "default",
+					ExternalId: "team-a/provisioned.json",
+					Relative:   true,
+					CheckSum:   "abc",
+					Updated:    100,
+				})
+			})
+		})
+
+		Convey("When exporting a signed bundle without a signing key", func() {
+			setting.DashboardBundleSigningKey = ""
+			err := service.ExportOrgDashboards(1, ExportBundleOptions{Sign: true}, &bytes.Buffer{})
+			So(err, ShouldEqual, ErrBundleSigningKeyMissing)
+		})
+
+		Convey("When importing the bundle into another organization", func() {
+			report, err := service.ImportOrgDashboards(2, user, export(true), importOpts)
+			So(err, ShouldBeNil)
+			So(report.Verified, ShouldBeTrue)
+			So(len(report.Items), ShouldEqual, 5)
+
+			for _, item := range report.Items {
+				So(item.Status, ShouldEqual, BundleItemCreated)
+			}
+
+			importedFolder := store.byUid(2, "team-a")
+			importedBoard := store.byUid(2, "board")
+
+			Convey("Should recreate the folders and dashboards", func() {
+				So(importedFolder.IsFolder, ShouldBeTrue)
+				So(importedFolder.Title, ShouldEqual, "Team A")
+				So(importedBoard.FolderId, ShouldEqual, importedFolder.Id)
+				So(importedBoard.Id, ShouldNotEqual, board.Id)
+				So(store.byUid(2, "home").FolderId, ShouldEqual, 0)
+				So(store.byUid(2, "empty").IsFolder, ShouldBeTrue)
+			})
+
+			Convey("Should provision dashboards under the local provisioner path", func() {
+				importedProvisioned := store.byUid(2, "provisioned")
+				So(findBundleItem(report, "provisioned").Provisioned, ShouldBeTrue)
+				So(store.provisioning[importedProvisioned.Id].ExternalId, ShouldEqual, "/var/lib/dashboards/team-a/provisioned.json")
+			})
+
+			Convey("Should set the permissions of members of the organization", func() {
+				acl := store.acl[importedFolder.Id]
+				So(len(acl), ShouldEqual, 2)
+				So(acl[0].UserId, ShouldEqual, 21)
+				So(acl[0].Permission, ShouldEqual, models.PERMISSION_EDIT)
+				So(acl[1].TeamId, ShouldEqual, 32)
+
+				warnings := findBundleItem(report, "team-a").Warnings
+				So(len(warnings), ShouldEqual, 1)
+				So(warnings[0], ShouldContainSubstring, "user bob")
+			})
+		})
+
+		Convey("When importing a provisioned dashboard without its provisioner", func() {
+			report, err := service.ImportOrgDashboards(2, user, export(true), ImportBundleOptions{})
+			So(err, ShouldBeNil)
+
+			item := findBundleItem(report, "provisioned")
+			So(item.Status, ShouldEqual, BundleItemCreated)
+			So(item.Provisioned, ShouldBeFalse)
+			So(item.Warnings[0], ShouldContainSubstring, "Provisioner default does not exist")
+			So(store.provisioning[store.byUid(2, "provisioned").Id], ShouldBeNil)
+		})
+
+		Convey("When importing into the organization the bundle was exported from", func() {
+			bundle := export(true).Bytes()
+			importInto := func(mode BundleConflictMode) *BundleImportReport {
+				opts := importOpts
+				opts.OnConflict = mode
+				report, err := service.ImportOrgDashboards(1, user, bytes.NewReader(bundle), opts)
+				So(err, ShouldBeNil)
+				return report
+			}
+
+			Convey("Should skip existing items by default", func() {
+				report := importInto("")
+				for _, item := range report.Items {
+					So(item.Status, ShouldEqual, BundleItemSkipped)
+				}
+				So(len(store.dashboards), ShouldEqual, 5)
+			})
+
+			Convey("Should overwrite existing items", func() {
+				board.Data.Set("description", "changed locally")
+
+				report := importInto(BundleConflictOverwrite)
+				for _, item := range report.Items {
+					So(item.Status, ShouldEqual, BundleItemOverwritten)
+				}
+				So(len(store.dashboards), ShouldEqual, 5)
+				So(store.byUid(1, "board").Id, ShouldEqual, board.Id)
+				So(store.byUid(1, "board").Data.Get("description").Interface(), ShouldBeNil)
+			})
+
+			Convey("Should import renamed copies", func() {
+				report := importInto(BundleConflictRename)
+				for _, item := range report.Items {
+					So(item.Status, ShouldEqual, BundleItemRenamed)
+					So(item.NewUid, ShouldStartWith, "uid-")
+				}
+				So(len(store.dashboards), ShouldEqual, 10)
+
+				copy := store.byUid(1, findBundleItem(report, "team-a").NewUid)
+				So(copy.Title, ShouldEqual, "Team A (imported)")
+				So(store.byUid(1, findBundleItem(report, "board").NewUid).FolderId, ShouldEqual, copy.Id)
+			})
+
+			Convey("Given a dashboard with the same title but another uid", func() {
+				home := store.byUid(1, "home")
+				home.Uid = "local-home"
+
+				Convey("Should skip it", func() {
+					report := importInto(BundleConflictSkip)
+					So(findBundleItem(report, "home").Status, ShouldEqual, BundleItemSkipped)
+					So(findBundleItem(report, "home").Warnings, ShouldNotBeEmpty)
+				})
+
+				Convey("Should import a copy with another title", func() {
+					report := importInto(BundleConflictRename)
+					So(findBundleItem(report, "home").Status, ShouldEqual, BundleItemRenamed)
+					So(store.byUid(1, "home").Title, ShouldEqual, "Home (imported)")
+				})
+
+				Convey("Should overwrite it", func() {
+					report := importInto(BundleConflictOverwrite)
+					So(findBundleItem(report, "home").Status, ShouldEqual, BundleItemOverwritten)
+					So(findBundleItem(report, "home").DashboardId, ShouldEqual, home.Id)
+					So(store.byUid(1, "home"), ShouldBeNil)
+				})
+			})
+
+			Convey("Should reject unknown conflict modes", func() {
+				_, err := service.ImportOrgDashboards(1, user, bytes.NewReader(bundle), ImportBundleOptions{OnConflict: "merge"})
+				So(err, ShouldEqual, ErrBundleConflictMode)
+			})
+		})
+
+		Convey("When a dashboard of a folder fails to import", func() {
+			store.failSave = func(dash *models.Dashboard) error {
+				if dash.OrgId == 2 && dash.Uid == "provisioned" {
+					return errors.New("disk full")
+				}
+				return nil
+			}
+
+			report, err := service.ImportOrgDashboards(2, user, export(true), importOpts)
+			So(err, ShouldBeNil)
+
+			Convey("Should roll back the other items of the folder", func() {
+				So(findBundleItem(report, "provisioned").Status, ShouldEqual, BundleItemFailed)
+				So(findBundleItem(report, "provisioned").Error, ShouldEqual, "disk full")
+				So(findBundleItem(report, "board").Status, ShouldEqual, BundleItemRolledBack)
+				So(findBundleItem(report, "team-a").Status, ShouldEqual, BundleItemRolledBack)
+				So(store.byUid(2, "board"), ShouldBeNil)
+				So(store.byUid(2, "team-a"), ShouldBeNil)
+			})
+
+			Convey("Should keep the items of other folders", func() {
+				So(findBundleItem(report, "home").Status, ShouldEqual, BundleItemCreated)
+				So(findBundleItem(report, "empty").Status, ShouldEqual, BundleItemCreated)
+				So(store.byUid(2, "home"), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When an overwritten folder fails to import", func() {
+			bundle := export(true)
+			board.Data.Set("description", "changed locally")
+			store.failSave = func(dash *models.Dashboard) error {
+				if dash.OrgId == 1 && dash.Uid == "provisioned" {
+					return errors.New("disk full")
+				}
+				return nil
+			}
+
+			opts := importOpts
+			opts.OnConflict = BundleConflictOverwrite
+			report, err := service.ImportOrgDashboards(1, user, bundle, opts)
+			So(err, ShouldBeNil)
+
+			Convey("Should restore the dashboards it replaced", func() {
+				So(findBundleItem(report, "board").Status, ShouldEqual, BundleItemRolledBack)
+				So(store.byUid(1, "board").Data.Get("description").MustString(), ShouldEqual, "changed locally")
+				So(store.byUid(1, "team-a"), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When verifying bundles", func() {
+			files, err := readBundle(export(true))
+			So(err, ShouldBeNil)
+
+			Convey("Should reject files that do not match their checksum", func() {
+				files["dashboards/board.json"] = []byte(`{"title": "Tampered"}`)
+				_, err := service.ImportOrgDashboards(2, user, rebuildBundle(files), importOpts)
+				So(err, ShouldHaveSameTypeAs, BundleInvalidError{})
+				So(len(store.dashboards), ShouldEqual, 5)
+			})
+
+			Convey("Should reject a manifest that does not match its signature", func() {
+				files[bundleManifestPath] = bytes.Replace(files[bundleManifestPath], []byte("Team A"), []byte("Team B"), 1)
+				_, err := service.ImportOrgDashboards(2, user, rebuildBundle(files), importOpts)
+				So(err, ShouldEqual, ErrBundleSignatureInvalid)
+			})
+
+			Convey("Should reject unsigned bundles unless allowed", func() {
+				delete(files, bundleSignaturePath)
+				_, err := service.ImportOrgDashboards(2, user, rebuildBundle(files), importOpts)
+				So(err, ShouldEqual, ErrBundleUnsigned)
+
+				opts := importOpts
+				opts.AllowUnsigned = true
+				report, err := service.ImportOrgDashboards(2, user, rebuildBundle(files), opts)
+				So(err, ShouldBeNil)
+				So(report.Verified, ShouldBeFalse)
+			})
+
+			Convey("Should not verify signed bundles without a signing key", func() {
+				setting.DashboardBundleSigningKey = ""
+				_, err := service.ImportOrgDashboards(2, user, rebuildBundle(files), importOpts)
+				So(err, ShouldEqual, ErrBundleSigningKeyMissing)
+			})
+
+			Convey("Should reject archives that are not bundles", func() {
+				_, err := service.ImportOrgDashboards(2, user, strings.NewReader("not a bundle"), importOpts)
+				So(err, ShouldHaveSameTypeAs, BundleInvalidError{})
+			})
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+			setting.DashboardBundleSigningKey = origSigningKey
+			bus.ClearBusHandlers()
+		})
+	})
+}
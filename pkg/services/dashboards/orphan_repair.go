@@ -0,0 +1,95 @@
+package dashboards
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// orphanRepairMessage is the version message of the dashboards moved out of a deleted folder
+const orphanRepairMessage = "Moved out of the deleted folder %d"
+
+// OrphanRepairOptions controls the repair of the dashboards whose folder was deleted out from under them
+type OrphanRepairOptions struct {
+	// DryRun lists the dashboards that would be moved without moving them
+	DryRun bool
+}
+
+// RepairedDashboard is a dashboard moved out of a folder that does not exist anymore
+type RepairedDashboard struct {
+	DashboardId int64  `json:"dashboardId"`
+	Uid         string `json:"uid"`
+	Title       string `json:"title"`
+	// StaleFolderId is the id of the deleted folder the dashboard referenced
+	StaleFolderId int64  `json:"staleFolderId"`
+	Error         string `json:"error,omitempty"`
+}
+
+// OrphanRepairReport is the summary of a repair of the dashboards of an organization left in deleted folders
+type OrphanRepairReport struct {
+	DryRun bool `json:"dryRun"`
+	// FolderId is the folder the dashboards are moved to, the default import folder or General
+	FolderId int64                `json:"folderId"`
+	Repaired []*RepairedDashboard `json:"repaired"`
+	Failed   []*RepairedDashboard `json:"failed"`
+}
+
+// RepairOrphanedDashboards moves the dashboards of the organization whose folder was deleted out from under them
+// to the default import folder, or General when none is configured. Each dashboard is saved with a version
+// naming the stale folder, and the repair is recorded in the audit log. A failing dashboard does not stop the
+// repair of the others.
+func (dr *dashboardServiceImpl) RepairOrphanedDashboards(orgId int64, user *models.SignedInUser, opts OrphanRepairOptions) (*OrphanRepairReport, error) {
+	query := &models.GetOrphanedDashboardsQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	folderId, err := dr.getDefaultImportFolderId(orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OrphanRepairReport{
+		DryRun:   opts.DryRun,
+		FolderId: folderId,
+		Repaired: make([]*RepairedDashboard, 0),
+		Failed:   make([]*RepairedDashboard, 0),
+	}
+
+	for _, dash := range query.Result {
+		repaired := &RepairedDashboard{DashboardId: dash.Id, Uid: dash.Uid, Title: dash.Title, StaleFolderId: dash.FolderId}
+		if opts.DryRun {
+			report.Repaired = append(report.Repaired, repaired)
+			continue
+		}
+
+		if err := dr.repairOrphanedDashboard(dash, folderId, user); err != nil {
+			repaired.Error = err.Error()
+			report.Failed = append(report.Failed, repaired)
+			continue
+		}
+
+		auditLog.Info("Dashboard moved out of a deleted folder", "dashboardId", dash.Id, "uid", dash.Uid,
+			"staleFolderId", repaired.StaleFolderId, "folderId", folderId, "orgId", orgId, "userId", user.UserId)
+		report.Repaired = append(report.Repaired, repaired)
+	}
+
+	return report, nil
+}
+
+func (dr *dashboardServiceImpl) repairOrphanedDashboard(dash *models.Dashboard, folderId int64, user *models.SignedInUser) error {
+	staleFolderId := dash.FolderId
+	dash.FolderId = folderId
+
+	dto := &SaveDashboardDTO{
+		OrgId:     dash.OrgId,
+		Dashboard: dash,
+		User:      user,
+		Message:   fmt.Sprintf(orphanRepairMessage, staleFolderId),
+		Source:    models.DashboardSourceRepair,
+	}
+
+	_, err := dr.saveDashboardWithWarnings(dto)
+	return err
+}
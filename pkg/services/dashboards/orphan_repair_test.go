@@ -0,0 +1,131 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRepairOrphanedDashboards(t *testing.T) {
+	Convey("Given dashboards left in a deleted folder", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		origDefaultImportFolder := setting.DashboardDefaultImportFolder
+		setting.DashboardDefaultImportFolder = ""
+
+		newOrphan := func(id int64, uid string, title string) *models.Dashboard {
+			dash := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+				"id":      id,
+				"uid":     uid,
+				"title":   title,
+				"version": 2,
+			}))
+			dash.OrgId = 1
+			dash.FolderId = 9
+			return dash
+		}
+
+		orphans := []*models.Dashboard{newOrphan(1, "first", "First"), newOrphan(2, "second", "Second")}
+		bus.AddHandler("test", func(query *models.GetOrphanedDashboardsQuery) error {
+			So(query.OrgId, ShouldEqual, 1)
+			query.Result = orphans
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Uid == "imported" {
+				query.Result = &models.Dashboard{Id: 4, Uid: "imported", IsFolder: true}
+				return nil
+			}
+			return models.ErrDashboardNotFound
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{IsParentFolderChanged: true}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = snapshotWithFolder(query)
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		saved := make([]*models.SaveDashboardCommand, 0)
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			if cmd.Dashboard.Get("uid").MustString() == "second" {
+				return errors.New("database is locked")
+			}
+			saved = append(saved, cmd)
+			cmd.Result = cmd.GetDashboardModel()
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_ADMIN}
+
+		Convey("Should move them to General with a version naming the stale folder", func() {
+			report, err := service.RepairOrphanedDashboards(1, user, OrphanRepairOptions{})
+			So(err, ShouldBeNil)
+			So(report.FolderId, ShouldEqual, 0)
+
+			So(saved, ShouldHaveLength, 1)
+			So(saved[0].FolderId, ShouldEqual, 0)
+			So(saved[0].Message, ShouldEqual, "Moved out of the deleted folder 9")
+			So(saved[0].Source, ShouldEqual, models.DashboardSourceRepair)
+
+			So(report.Repaired, ShouldResemble, []*RepairedDashboard{{DashboardId: 1, Uid: "first", Title: "First", StaleFolderId: 9}})
+		})
+
+		Convey("Should report the dashboards that failed without stopping the repair", func() {
+			orphans[0], orphans[1] = orphans[1], orphans[0]
+
+			report, err := service.RepairOrphanedDashboards(1, user, OrphanRepairOptions{})
+			So(err, ShouldBeNil)
+			So(saved, ShouldHaveLength, 1)
+			So(report.Repaired, ShouldHaveLength, 1)
+			So(report.Failed, ShouldResemble, []*RepairedDashboard{{DashboardId: 2, Uid: "second", Title: "Second", StaleFolderId: 9, Error: "database is locked"}})
+		})
+
+		Convey("Should move them to the default import folder when configured", func() {
+			setting.DashboardDefaultImportFolder = "imported"
+
+			report, err := service.RepairOrphanedDashboards(1, user, OrphanRepairOptions{})
+			So(err, ShouldBeNil)
+			So(report.FolderId, ShouldEqual, 4)
+			So(saved[0].FolderId, ShouldEqual, 4)
+		})
+
+		Convey("Should only list them on a dry run", func() {
+			report, err := service.RepairOrphanedDashboards(1, user, OrphanRepairOptions{DryRun: true})
+			So(err, ShouldBeNil)
+			So(report.DryRun, ShouldBeTrue)
+			So(report.Repaired, ShouldHaveLength, 2)
+			So(report.Failed, ShouldBeEmpty)
+			So(saved, ShouldBeEmpty)
+			So(orphans[0].FolderId, ShouldEqual, 9)
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+			setting.DashboardDefaultImportFolder = origDefaultImportFolder
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package dashboards
+
+import (
+	"sort"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+const (
+	ProviderSyncInSync       = "in-sync"
+	ProviderSyncDrifted      = "drifted"
+	ProviderSyncMissingInGit = "missing-in-git"
+	ProviderSyncMissingInDb  = "missing-in-db"
+)
+
+// ProviderSyncEntry is the sync state of a dashboard provisioned by a provider
+type ProviderSyncEntry struct {
+	DashboardId int64  `json:"dashboardId"`
+	Uid         string `json:"uid,omitempty"`
+	Title       string `json:"title,omitempty"`
+	// ExternalId is the file the provider provisions the dashboard from
+	ExternalId string `json:"externalId"`
+	// Path is the file of the dashboard in the repository, empty for dashboards that were never synced
+	Path   string `json:"path,omitempty"`
+	Status string `json:"status"`
+	// Diff lists the top-level properties of the dashboard that differ from the file in the repository
+	Diff []string `json:"diff,omitempty"`
+}
+
+// ProviderSyncReport lists the dashboards of a provisioning provider by the file they are provisioned from.
+// Drifted is set when any of them is not in sync.
+type ProviderSyncReport struct {
+	Provider   string               `json:"provider"`
+	Drifted    bool                 `json:"drifted"`
+	Dashboards []*ProviderSyncEntry `json:"dashboards"`
+}
+
+// GetProviderSyncReport classifies the dashboards provisioned by the named provider by their sync state with the
+// repository of their organization: in sync or drifted from their file, missing in git when the dashboard has no
+// file in the repository, and missing in the database when the provisioned dashboard was deleted. The repository
+// is only read.
+func (dr *dashboardServiceImpl) GetProviderSyncReport(name string) (*ProviderSyncReport, error) {
+	provisioned, err := dr.GetProvisionedDashboardData(name)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ProviderSyncReport{Provider: name, Dashboards: make([]*ProviderSyncEntry, 0, len(provisioned))}
+	// the files of the repository of each organization, listed once
+	repoFiles := make(map[int64]map[string]bool)
+
+	for _, data := range provisioned {
+		entry := &ProviderSyncEntry{DashboardId: data.DashboardId, ExternalId: data.ExternalId, Status: ProviderSyncMissingInDb}
+		report.Dashboards = append(report.Dashboards, entry)
+
+		dashQuery := &models.GetDashboardQuery{Id: data.DashboardId}
+		if err := bus.Dispatch(dashQuery); err != nil {
+			if err == models.ErrDashboardNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		dash := dashQuery.Result
+		entry.Uid = dash.Uid
+		entry.Title = dash.Title
+		entry.Status = ProviderSyncMissingInGit
+
+		reader, ok := getGitProvider(dash.OrgId).(social.DashboardFileReader)
+		if !ok {
+			return nil, ErrRepoVerifyNotSupported
+		}
+
+		inRepo, ok := repoFiles[dash.OrgId]
+		if !ok {
+			files, err := reader.ListDashboardFiles(dash.OrgId)
+			if err != nil {
+				return nil, err
+			}
+
+			inRepo = make(map[string]bool, len(files))
+			for _, file := range files {
+				inRepo[file.Path] = true
+			}
+			repoFiles[dash.OrgId] = inRepo
+		}
+
+		syncQuery := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+		if err := bus.Dispatch(syncQuery); err != nil {
+			return nil, err
+		}
+
+		if syncQuery.Result == nil {
+			continue
+		}
+
+		entry.Path = syncQuery.Result.FilePath
+		if !inRepo[entry.Path] {
+			continue
+		}
+
+		content, err := reader.ReadFile(dash.OrgId, entry.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := compareDashboardFile(content, dash)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Equal {
+			entry.Status = ProviderSyncInSync
+		} else {
+			entry.Status = ProviderSyncDrifted
+			entry.Diff = result.Changes
+		}
+	}
+
+	sort.Slice(report.Dashboards, func(i, j int) bool {
+		return report.Dashboards[i].ExternalId < report.Dashboards[j].ExternalId
+	})
+
+	for _, entry := range report.Dashboards {
+		if entry.Status != ProviderSyncInSync {
+			report.Drifted = true
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,130 @@
+package dashboards
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProviderSyncReport(t *testing.T) {
+	Convey("Given the dashboards of a provisioning provider and their repository", t, func() {
+		bus.ClearBusHandlers()
+
+		reader := &fakeFileReader{
+			files: []social.DashboardFile{
+				{Path: "dashboards/General/synced.json", Folder: "General"},
+				{Path: "dashboards/General/drifted.json", Folder: "General"},
+			},
+			contents: map[string]string{
+				"dashboards/General/synced.json":  `{"id": 11, "uid": "synced", "title": "Synced", "version": 1}`,
+				"dashboards/General/drifted.json": `{"id": 2, "uid": "drifted", "title": "Drifted", "refresh": "5s"}`,
+			},
+		}
+
+		getGitProvider = func(orgId int64) social.GitProvider {
+			return reader
+		}
+
+		bus.AddHandler("test", func(query *models.GetProvisionedDashboardDataQuery) error {
+			So(query.Name, ShouldEqual, "ops")
+			query.Result = []*models.DashboardProvisioning{
+				{DashboardId: 1, Name: "ops", ExternalId: "/etc/dashboards/a-synced.json"},
+				{DashboardId: 2, Name: "ops", ExternalId: "/etc/dashboards/b-drifted.json"},
+				{DashboardId: 3, Name: "ops", ExternalId: "/etc/dashboards/c-removed.json"},
+				{DashboardId: 4, Name: "ops", ExternalId: "/etc/dashboards/d-deleted.json"},
+				{DashboardId: 5, Name: "ops", ExternalId: "/etc/dashboards/e-unsynced.json"},
+			}
+			return nil
+		})
+
+		dashboards := map[int64]*models.Dashboard{
+			1: {Id: 1, OrgId: 1, Uid: "synced", Title: "Synced", Data: simplejson.NewFromAny(map[string]interface{}{
+				"id": 1, "uid": "synced", "title": "Synced", "version": 3,
+			})},
+			2: {Id: 2, OrgId: 1, Uid: "drifted", Title: "Drifted", Data: simplejson.NewFromAny(map[string]interface{}{
+				"id": 2, "uid": "drifted", "title": "Drifted", "refresh": "1m",
+			})},
+			3: {Id: 3, OrgId: 1, Uid: "removed", Title: "Removed", Data: simplejson.NewFromAny(map[string]interface{}{
+				"id": 3, "uid": "removed", "title": "Removed",
+			})},
+			5: {Id: 5, OrgId: 1, Uid: "unsynced", Title: "Unsynced", Data: simplejson.NewFromAny(map[string]interface{}{
+				"id": 5, "uid": "unsynced", "title": "Unsynced",
+			})},
+		}
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			dash, ok := dashboards[query.Id]
+			if !ok {
+				return models.ErrDashboardNotFound
+			}
+			query.Result = dash
+			return nil
+		})
+
+		syncs := map[int64]string{
+			1: "dashboards/General/synced.json",
+			2: "dashboards/General/drifted.json",
+			3: "dashboards/General/removed.json",
+		}
+
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			if path, ok := syncs[query.DashboardId]; ok {
+				query.Result = &models.DashboardGitSync{DashboardId: query.DashboardId, OrgId: 1, FilePath: path}
+			}
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+
+		Convey("Should classify each dashboard of the provider", func() {
+			report, err := service.GetProviderSyncReport("ops")
+			So(err, ShouldBeNil)
+			So(report.Provider, ShouldEqual, "ops")
+			So(report.Drifted, ShouldBeTrue)
+			So(report.Dashboards, ShouldHaveLength, 5)
+
+			statuses := make([]string, 0)
+			for _, entry := range report.Dashboards {
+				statuses = append(statuses, entry.Status)
+			}
+			So(statuses, ShouldResemble, []string{
+				ProviderSyncInSync, ProviderSyncDrifted, ProviderSyncMissingInGit, ProviderSyncMissingInDb, ProviderSyncMissingInGit,
+			})
+
+			So(report.Dashboards[1].Diff, ShouldResemble, []string{"refresh changed"})
+			So(report.Dashboards[2].Path, ShouldEqual, "dashboards/General/removed.json")
+			So(report.Dashboards[3].Uid, ShouldEqual, "")
+			So(report.Dashboards[3].ExternalId, ShouldEqual, "/etc/dashboards/d-deleted.json")
+			So(report.Dashboards[4].Path, ShouldEqual, "")
+		})
+
+		Convey("Should not be drifted when all dashboards are in sync", func() {
+			bus.AddHandler("test", func(query *models.GetProvisionedDashboardDataQuery) error {
+				query.Result = []*models.DashboardProvisioning{{DashboardId: 1, Name: "ops", ExternalId: "a.json"}}
+				return nil
+			})
+
+			report, err := service.GetProviderSyncReport("ops")
+			So(err, ShouldBeNil)
+			So(report.Drifted, ShouldBeFalse)
+			So(report.Dashboards[0].Status, ShouldEqual, ProviderSyncInSync)
+		})
+
+		Convey("Should fail when the organization has no readable repository", func() {
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return nil
+			}
+
+			_, err := service.GetProviderSyncReport("ops")
+			So(err, ShouldEqual, ErrRepoVerifyNotSupported)
+		})
+
+		Reset(func() {
+			getGitProvider = social.GetGitProvider
+		})
+	})
+}
@@ -0,0 +1,200 @@
+package dashboards
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/jsoncompare"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+var ErrRepoVerifyNotSupported = errors.New("No repository supporting dashboard verification is configured for the organization")
+
+// verifySleep waits between the reads of repository files, tests replace it
+var verifySleep = time.Sleep
+
+// consistencyIgnoredProperties differ between the database and a file matching it, e.g. the id of files imported
+// from another instance, and the version of files committed outside Grafana
+var consistencyIgnoredProperties = []string{"id", "version"}
+
+const (
+	RepoConsistencyMatch         = "match"
+	RepoConsistencyDrifted       = "drifted"
+	RepoConsistencyMissingInRepo = "missing-in-repo"
+	RepoConsistencyMissingInDb   = "missing-in-db"
+)
+
+// VerifyRepoOptions controls the verification of the synced dashboards against the repository
+type VerifyRepoOptions struct {
+	// Folder limits the verification to the dashboards of the folder, and the files of its directory
+	Folder string
+	// ReadInterval is the minimum time between two reads of repository files, to stay under the rate limits
+	ReadInterval time.Duration
+	// CreatePath commits a seed file to the dashboards path when it does not exist yet, e.g. in a new repository
+	CreatePath bool
+}
+
+// RepoConsistencyEntry is the result of comparing a dashboard to its file in the repository
+type RepoConsistencyEntry struct {
+	Uid    string `json:"uid,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	// Diff lists the top-level properties of the dashboard that differ from the file
+	Diff []string `json:"diff,omitempty"`
+}
+
+// RepoConsistencyReport lists the dashboards and repository files by path. Drifted is set when any of them
+// does not match. PathMissing is set when the dashboards path does not exist in the repository, and PathCreated
+// when it was created for the verification.
+type RepoConsistencyReport struct {
+	Drifted     bool                    `json:"drifted"`
+	PathMissing bool                    `json:"pathMissing,omitempty"`
+	PathCreated bool                    `json:"pathCreated,omitempty"`
+	Dashboards  []*RepoConsistencyEntry `json:"dashboards"`
+}
+
+// VerifyRepoConsistency compares the synced dashboards of an organization to their files in the repository,
+// e.g. to check for drift before a release. Dashboards are serialized as they are when committed, and the files
+// under the dashboards path without a dashboard are reported as missing in the database. The repository is
+// only read.
+func (dr *dashboardServiceImpl) VerifyRepoConsistency(orgId int64, opts VerifyRepoOptions) (*RepoConsistencyReport, error) {
+	reader, ok := getGitProvider(orgId).(social.DashboardFileReader)
+	if !ok {
+		return nil, ErrRepoVerifyNotSupported
+	}
+
+	report := &RepoConsistencyReport{Dashboards: make([]*RepoConsistencyEntry, 0)}
+
+	// a missing dashboards path lists no files, while failing to read the repository is an error, so synced
+	// dashboards are only reported missing in the repository when it was read
+	if creator, ok := reader.(social.DashboardsPathCreator); ok {
+		exists, err := creator.DashboardsPathExists(orgId)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			report.PathMissing = true
+			if opts.CreatePath {
+				if _, err := creator.CreateDashboardsPath(orgId, "Create dashboards directory"); err != nil {
+					return nil, err
+				}
+				report.PathCreated = true
+			}
+		}
+	}
+
+	files, err := reader.ListDashboardFiles(orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	inRepo := make(map[string]bool, len(files))
+	for _, file := range files {
+		inRepo[file.Path] = true
+	}
+
+	query := &models.GetDashboardGitSyncsQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	synced := make(map[string]bool, len(query.Result))
+	folders := make(map[int64]string)
+	reads := 0
+
+	for _, sync := range query.Result {
+		dashQuery := &models.GetDashboardQuery{Id: sync.DashboardId, OrgId: orgId}
+		if err := bus.Dispatch(dashQuery); err != nil {
+			// the file of a deleted dashboard is reported with the files added to the repository
+			if err == models.ErrDashboardNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		dash := dashQuery.Result
+		synced[sync.FilePath] = true
+
+		folder, ok := folders[dash.FolderId]
+		if !ok {
+			var err error
+			if folder, err = getDashboardFolder(dash); err != nil {
+				return nil, err
+			}
+			folders[dash.FolderId] = folder
+		}
+		if opts.Folder != "" && !strings.EqualFold(folder, opts.Folder) {
+			continue
+		}
+
+		entry := &RepoConsistencyEntry{Uid: dash.Uid, Title: dash.Title, Path: sync.FilePath, Status: RepoConsistencyMissingInRepo}
+		report.Dashboards = append(report.Dashboards, entry)
+
+		if !inRepo[sync.FilePath] {
+			continue
+		}
+
+		if reads > 0 && opts.ReadInterval > 0 {
+			verifySleep(opts.ReadInterval)
+		}
+		reads++
+
+		content, err := reader.ReadFile(orgId, sync.FilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := compareDashboardFile(content, dash)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Equal {
+			entry.Status = RepoConsistencyMatch
+		} else {
+			entry.Status = RepoConsistencyDrifted
+			entry.Diff = result.Changes
+		}
+	}
+
+	for _, file := range files {
+		if synced[file.Path] || (opts.Folder != "" && !strings.EqualFold(file.Folder, opts.Folder)) {
+			continue
+		}
+		report.Dashboards = append(report.Dashboards, &RepoConsistencyEntry{Path: file.Path, Status: RepoConsistencyMissingInDb})
+	}
+
+	sort.Slice(report.Dashboards, func(i, j int) bool {
+		return report.Dashboards[i].Path < report.Dashboards[j].Path
+	})
+
+	for _, entry := range report.Dashboards {
+		if entry.Status != RepoConsistencyMatch {
+			report.Drifted = true
+		}
+	}
+
+	return report, nil
+}
+
+// compareDashboardFile compares the content of the file of a dashboard to the dashboard as it is committed by
+// updateDashboard. A file that is not valid json differs from any dashboard.
+func compareDashboardFile(content string, dash *models.Dashboard) (*jsoncompare.Result, error) {
+	current, err := storedDashboardJson(dash)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := jsoncompare.Compare([]byte(content), current, consistencyIgnoredProperties...)
+	if err != nil {
+		return &jsoncompare.Result{Changes: []string{"file is not valid json"}}, nil
+	}
+
+	return result, nil
+}
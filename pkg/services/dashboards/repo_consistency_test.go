@@ -0,0 +1,200 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifyRepoConsistency(t *testing.T) {
+	Convey("Given synced dashboards and their repository", t, func() {
+		reader := &fakeFileReader{
+			files: []social.DashboardFile{
+				{Path: "dashboards/General/match.json", Folder: "General"},
+				{Path: "dashboards/General/drifted.json", Folder: "General"},
+				{Path: "dashboards/Team/added.json", Folder: "Team"},
+				{Path: "dashboards/Team/deleted.json", Folder: "Team"},
+			},
+			contents: map[string]string{
+				"dashboards/General/match.json":   `{"id": 12, "uid": "match", "title": "Match", "version": 2, "tags": ["a"]}`,
+				"dashboards/General/drifted.json": `{"id": 2, "uid": "drifted", "title": "Drifted", "version": 3, "refresh": "5s"}`,
+			},
+		}
+
+		getGitProvider = func(orgId int64) social.GitProvider {
+			return reader
+		}
+
+		var sleeps []time.Duration
+		verifySleep = func(d time.Duration) {
+			sleeps = append(sleeps, d)
+		}
+
+		dashboards := map[int64]*models.Dashboard{
+			1: {Id: 1, Uid: "match", Title: "Match", Data: simplejson.NewFromAny(map[string]interface{}{
+				"id": 1, "uid": "match", "title": "Match", "version": 5, "tags": []interface{}{"a"},
+			})},
+			2: {Id: 2, Uid: "drifted", Title: "Drifted", Data: simplejson.NewFromAny(map[string]interface{}{
+				"id": 2, "uid": "drifted", "title": "Drifted", "version": 4, "refresh": "1m", "tags": []interface{}{"b"},
+			})},
+			3: {Id: 3, Uid: "unpushed", Title: "Unpushed", FolderId: 10, Data: simplejson.NewFromAny(map[string]interface{}{
+				"id": 3, "uid": "unpushed", "title": "Unpushed",
+			})},
+		}
+
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncsQuery) error {
+			query.Result = []*models.DashboardGitSync{
+				{DashboardId: 1, OrgId: 1, FilePath: "dashboards/General/match.json"},
+				{DashboardId: 2, OrgId: 1, FilePath: "dashboards/General/drifted.json"},
+				{DashboardId: 3, OrgId: 1, FilePath: "dashboards/Team/unpushed.json"},
+				{DashboardId: 4, OrgId: 1, FilePath: "dashboards/Team/deleted.json"},
+			}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Id == 10 {
+				query.Result = models.NewDashboardFolder("Team")
+				return nil
+			}
+			dash, ok := dashboards[query.Id]
+			if !ok {
+				return models.ErrDashboardNotFound
+			}
+			query.Result = dash
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+
+		Convey("Should report the status of every dashboard and file by path", func() {
+			report, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{})
+			So(err, ShouldBeNil)
+			So(report.Drifted, ShouldBeTrue)
+			So(report.Dashboards, ShouldResemble, []*RepoConsistencyEntry{
+				{Uid: "drifted", Title: "Drifted", Path: "dashboards/General/drifted.json", Status: RepoConsistencyDrifted, Diff: []string{"refresh changed", "tags added"}},
+				{Uid: "match", Title: "Match", Path: "dashboards/General/match.json", Status: RepoConsistencyMatch},
+				{Path: "dashboards/Team/added.json", Status: RepoConsistencyMissingInDb},
+				{Path: "dashboards/Team/deleted.json", Status: RepoConsistencyMissingInDb},
+				{Uid: "unpushed", Title: "Unpushed", Path: "dashboards/Team/unpushed.json", Status: RepoConsistencyMissingInRepo},
+			})
+		})
+
+		Convey("Should not report drift when everything matches", func() {
+			reader.files = reader.files[:1]
+			dashboards = map[int64]*models.Dashboard{1: dashboards[1]}
+
+			report, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{})
+			So(err, ShouldBeNil)
+			So(report.Drifted, ShouldBeFalse)
+			So(len(report.Dashboards), ShouldEqual, 1)
+		})
+
+		Convey("Should report files that are not valid json as drifted", func() {
+			reader.contents["dashboards/General/match.json"] = `{"title": `
+
+			report, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{Folder: "general"})
+			So(err, ShouldBeNil)
+			So(report.Dashboards[1].Status, ShouldEqual, RepoConsistencyDrifted)
+			So(report.Dashboards[1].Diff, ShouldResemble, []string{"file is not valid json"})
+		})
+
+		Convey("Should only verify the dashboards and files of the folder", func() {
+			report, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{Folder: "team"})
+			So(err, ShouldBeNil)
+			So(len(report.Dashboards), ShouldEqual, 3)
+			So(report.Dashboards[0].Path, ShouldEqual, "dashboards/Team/added.json")
+			So(report.Dashboards[2].Uid, ShouldEqual, "unpushed")
+		})
+
+		Convey("Should wait between the reads of files", func() {
+			_, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{ReadInterval: time.Second})
+			So(err, ShouldBeNil)
+			So(sleeps, ShouldResemble, []time.Duration{time.Second})
+		})
+
+		Convey("Should fail when a file cannot be read", func() {
+			delete(reader.contents, "dashboards/General/match.json")
+
+			_, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should fail when the repository cannot be listed", func() {
+			reader.listErr = errors.New("unavailable")
+
+			_, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{})
+			So(err, ShouldEqual, reader.listErr)
+		})
+
+		Convey("Given a repository without the dashboards path", func() {
+			creator := &fakePathCreator{fakeFileReader: reader}
+			reader.files = []social.DashboardFile{}
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return creator
+			}
+
+			Convey("Should report the synced dashboards missing in the repository", func() {
+				report, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{})
+				So(err, ShouldBeNil)
+				So(report.PathMissing, ShouldBeTrue)
+				So(report.PathCreated, ShouldBeFalse)
+				So(len(report.Dashboards), ShouldEqual, 3)
+				So(report.Dashboards[0].Status, ShouldEqual, RepoConsistencyMissingInRepo)
+				So(creator.created, ShouldEqual, 0)
+			})
+
+			Convey("Should create the path when asked to", func() {
+				report, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{CreatePath: true})
+				So(err, ShouldBeNil)
+				So(report.PathMissing, ShouldBeTrue)
+				So(report.PathCreated, ShouldBeTrue)
+				So(creator.created, ShouldEqual, 1)
+			})
+
+			Convey("Should fail when the repository cannot be read", func() {
+				creator.existsErr = errors.New("404 Project Not Found")
+
+				_, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{CreatePath: true})
+				So(err, ShouldEqual, creator.existsErr)
+				So(creator.created, ShouldEqual, 0)
+			})
+		})
+
+		Convey("Should fail without a repository that can be read", func() {
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return nil
+			}
+
+			_, err := service.VerifyRepoConsistency(1, VerifyRepoOptions{})
+			So(err, ShouldEqual, ErrRepoVerifyNotSupported)
+		})
+
+		Reset(func() {
+			getGitProvider = social.GetGitProvider
+			verifySleep = time.Sleep
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+type fakePathCreator struct {
+	*fakeFileReader
+	existsErr error
+	created   int
+}
+
+func (c *fakePathCreator) DashboardsPathExists(orgId int64) (bool, error) {
+	return c.created > 0, c.existsErr
+}
+
+func (c *fakePathCreator) CreateDashboardsPath(orgId int64, message string) (string, error) {
+	c.created++
+	return "e83c5163", nil
+}
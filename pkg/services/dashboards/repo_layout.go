@@ -0,0 +1,223 @@
+package dashboards
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+var getGitProvider = social.GetGitProvider
+
+var ErrRepoLayoutNotSupported = errors.New("No repository supporting layout migration is configured for the organization")
+
+// RepoLayoutMove is a dashboard file that moves to a new path in the repository
+type RepoLayoutMove struct {
+	DashboardId int64  `json:"dashboardId"`
+	Title       string `json:"title"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+}
+
+// RepoLayoutMigration is the summary of a repository layout migration
+type RepoLayoutMigration struct {
+	DryRun    bool              `json:"dryRun"`
+	Moves     []*RepoLayoutMove `json:"moves"`
+	Unchanged int               `json:"unchanged"`
+	CommitSha string            `json:"commitSha,omitempty"`
+}
+
+// RepoLayoutMigrationParams are the params of a repository layout migration job
+type RepoLayoutMigrationParams struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// RepoLayoutConflict lists the dashboards that would be synced to the same path
+type RepoLayoutConflict struct {
+	Path         string  `json:"path"`
+	DashboardIds []int64 `json:"dashboardIds"`
+}
+
+// RepoLayoutConflictError is returned when the new layout maps several dashboards to the same path
+type RepoLayoutConflictError struct {
+	Conflicts []*RepoLayoutConflict
+}
+
+func (e RepoLayoutConflictError) Error() string {
+	paths := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		paths[i] = conflict.Path
+	}
+
+	return fmt.Sprintf("Several dashboards would be synced to %s", strings.Join(paths, ", "))
+}
+
+// MigrateRepoLayout moves the synced dashboards of an organization to the paths of the current repository
+// configuration, e.g. after dashboards_path changed. All moves are committed at once and the sync state of
+// the dashboards is updated. A dry run only returns the planned moves. Jsonnet sources are never moved.
+func (dr *dashboardServiceImpl) MigrateRepoLayout(orgId int64, dryRun bool) (*RepoLayoutMigration, error) {
+	return migrateRepoLayout(context.Background(), orgId, dryRun, func(done int, total int) {})
+}
+
+func checkRepoLayoutMigrationJob(orgId int64, params []byte) error {
+	if _, ok := getGitProvider(orgId).(social.DashboardFileMover); !ok {
+		return ErrRepoLayoutNotSupported
+	}
+	return nil
+}
+
+// runRepoLayoutMigrationJob runs the migration as a job. The job can be cancelled until the moves are committed,
+// and the conflicts of a failed migration are its result.
+func runRepoLayoutMigrationJob(ctx context.Context, job *models.DashboardJob, progress JobProgressFunc) (interface{}, error) {
+	params := RepoLayoutMigrationParams{}
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		return nil, err
+	}
+
+	migration, err := migrateRepoLayout(ctx, job.OrgId, params.DryRun, progress)
+	if conflictErr, ok := err.(RepoLayoutConflictError); ok {
+		return conflictErr.Conflicts, err
+	}
+	return migration, err
+}
+
+func migrateRepoLayout(ctx context.Context, orgId int64, dryRun bool, progress JobProgressFunc) (*RepoLayoutMigration, error) {
+	mover, ok := getGitProvider(orgId).(social.DashboardFileMover)
+	if !ok {
+		return nil, ErrRepoLayoutNotSupported
+	}
+
+	query := &models.GetDashboardGitSyncsQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	migration := &RepoLayoutMigration{DryRun: dryRun, Moves: make([]*RepoLayoutMove, 0)}
+	syncs := make(map[int64]*models.DashboardGitSync)
+	dashboards := make(map[int64]*models.Dashboard)
+	dashboardsByPath := make(map[string][]int64)
+	folders := make(map[int64]string)
+
+	for i, sync := range query.Result {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress(i, len(query.Result))
+
+		// sources rendered to dashboards, e.g. jsonnet, stay where they are
+		if sync.SourceFormat != "" {
+			migration.Unchanged++
+			continue
+		}
+
+		dashQuery := &models.GetDashboardQuery{Id: sync.DashboardId, OrgId: orgId}
+		if err := bus.Dispatch(dashQuery); err != nil {
+			if err == models.ErrDashboardNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		dash := dashQuery.Result
+		folder, ok := folders[dash.FolderId]
+		if !ok {
+			var err error
+			if folder, err = getDashboardFolder(dash); err != nil {
+				return nil, err
+			}
+			folders[dash.FolderId] = folder
+		}
+
+		newPath := mover.DashboardFilePath(orgId, folder, dash.Slug)
+		dashboardsByPath[newPath] = append(dashboardsByPath[newPath], dash.Id)
+
+		if newPath == sync.FilePath {
+			migration.Unchanged++
+			continue
+		}
+
+		syncs[dash.Id] = sync
+		dashboards[dash.Id] = dash
+		migration.Moves = append(migration.Moves, &RepoLayoutMove{
+			DashboardId: dash.Id,
+			Title:       dash.Title,
+			From:        sync.FilePath,
+			To:          newPath,
+		})
+	}
+
+	if conflicts := findLayoutConflicts(dashboardsByPath); len(conflicts) > 0 {
+		return nil, RepoLayoutConflictError{Conflicts: conflicts}
+	}
+
+	sort.Slice(migration.Moves, func(i, j int) bool {
+		return migration.Moves[i].From < migration.Moves[j].From
+	})
+
+	progress(len(query.Result), len(query.Result))
+
+	if dryRun || len(migration.Moves) == 0 {
+		return migration, nil
+	}
+
+	moves := make([]social.FileMove, 0, len(migration.Moves))
+	for _, move := range migration.Moves {
+		content, err := storedDashboardJson(dashboards[move.DashboardId])
+		if err != nil {
+			return nil, err
+		}
+
+		moves = append(moves, social.FileMove{From: move.From, To: move.To, Content: string(content)})
+	}
+
+	// the moves are committed and recorded as a whole, a cancelled migration stops before committing them
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Move %d dashboards to the new repository layout", len(moves))
+	commitSha, err := mover.MoveFiles(orgId, moves, message)
+	if err != nil {
+		return nil, err
+	}
+	migration.CommitSha = commitSha
+
+	for _, move := range migration.Moves {
+		cmd := &models.SaveDashboardGitSyncCommand{
+			DashboardId: move.DashboardId,
+			OrgId:       orgId,
+			Provider:    syncs[move.DashboardId].Provider,
+			RepoId:      syncs[move.DashboardId].RepoId,
+			FilePath:    move.To,
+			CommitSha:   commitSha,
+			CommitMode:  models.GitCommitModeService,
+		}
+
+		if err := bus.Dispatch(cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	return migration, nil
+}
+
+func findLayoutConflicts(dashboardsByPath map[string][]int64) []*RepoLayoutConflict {
+	conflicts := make([]*RepoLayoutConflict, 0)
+	for path, dashboardIds := range dashboardsByPath {
+		if len(dashboardIds) > 1 {
+			conflicts = append(conflicts, &RepoLayoutConflict{Path: path, DashboardIds: dashboardIds})
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+
+	return conflicts
+}
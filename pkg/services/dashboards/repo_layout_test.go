@@ -0,0 +1,177 @@
+package dashboards
+
+import (
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMigrateRepoLayout(t *testing.T) {
+	Convey("Given synced dashboards in three folders", t, func() {
+		bus.ClearBusHandlers()
+
+		origGetGitProvider := getGitProvider
+		mover := &fakeFileMover{dashboardsPath: "grafana/dashboards", commitSha: "abc123"}
+		getGitProvider = func(orgId int64) social.GitProvider {
+			return mover
+		}
+
+		service := &dashboardServiceImpl{}
+		dashboardsById := make(map[int64]*models.Dashboard)
+		syncs := make([]*models.DashboardGitSync, 0)
+
+		for folderId := int64(1); folderId <= 3; folderId++ {
+			folder := models.NewDashboardFolder(fmt.Sprintf("Team %d", folderId))
+			folder.Id = folderId
+			folder.SetUid(fmt.Sprintf("team-%d", folderId))
+			folder.OrgId = 1
+			dashboardsById[folder.Id] = folder
+
+			for i := 0; i < 12; i++ {
+				dash := models.NewDashboard(fmt.Sprintf("Service %d", i))
+				dash.Id = folderId*100 + int64(i)
+				dash.SetUid(fmt.Sprintf("service-%d", dash.Id))
+				dash.OrgId = 1
+				dash.FolderId = folderId
+				dashboardsById[dash.Id] = dash
+
+				syncs = append(syncs, &models.DashboardGitSync{
+					DashboardId: dash.Id,
+					OrgId:       1,
+					Provider:    "gitlab",
+					FilePath:    path.Join("dashboards", folder.Title, dash.Slug+".json"),
+					CommitSha:   "old",
+				})
+			}
+		}
+
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncsQuery) error {
+			query.Result = syncs
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			dash, ok := dashboardsById[query.Id]
+			if !ok {
+				return models.ErrDashboardNotFound
+			}
+			query.Result = dash
+			return nil
+		})
+
+		saved := make(map[int64]*models.SaveDashboardGitSyncCommand)
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			saved[cmd.DashboardId] = cmd
+			return nil
+		})
+
+		Convey("A dry run should plan the moves without committing", func() {
+			migration, err := service.MigrateRepoLayout(1, true)
+			So(err, ShouldBeNil)
+			So(migration.DryRun, ShouldBeTrue)
+			So(len(migration.Moves), ShouldEqual, 36)
+			So(migration.Moves[0], ShouldResemble, &RepoLayoutMove{
+				DashboardId: 100,
+				Title:       "Service 0",
+				From:        "dashboards/Team 1/service-0.json",
+				To:          "grafana/dashboards/Team 1/service-0.json",
+			})
+			So(mover.moves, ShouldBeNil)
+			So(saved, ShouldBeEmpty)
+		})
+
+		Convey("Should move all files in one commit and update the sync state", func() {
+			migration, err := service.MigrateRepoLayout(1, false)
+			So(err, ShouldBeNil)
+			So(migration.CommitSha, ShouldEqual, "abc123")
+			So(mover.commits, ShouldEqual, 1)
+			So(mover.message, ShouldEqual, "Move 36 dashboards to the new repository layout")
+			So(len(mover.moves), ShouldEqual, 36)
+			So(mover.moves[0].Content, ShouldContainSubstring, `"title": "Service 0"`)
+
+			So(len(saved), ShouldEqual, 36)
+			So(saved[305].FilePath, ShouldEqual, "grafana/dashboards/Team 3/service-5.json")
+			So(saved[305].CommitSha, ShouldEqual, "abc123")
+			So(saved[305].Provider, ShouldEqual, "gitlab")
+		})
+
+		Convey("Should skip dashboards already at their path and deleted dashboards", func() {
+			mover.dashboardsPath = "dashboards"
+			folder := models.NewDashboardFolder("Team 4")
+			folder.Id = 4
+			folder.SetUid("team-4")
+			dashboardsById[folder.Id] = folder
+			dashboardsById[200].FolderId = 4
+			dashboardsById[201].Data.Set("title", "Renamed")
+			dashboardsById[201].UpdateSlug()
+			delete(dashboardsById, 202)
+
+			migration, err := service.MigrateRepoLayout(1, false)
+			So(err, ShouldBeNil)
+			So(migration.Unchanged, ShouldEqual, 33)
+			So(len(migration.Moves), ShouldEqual, 2)
+			So(migration.Moves[0].To, ShouldEqual, "dashboards/Team 4/service-0.json")
+			So(migration.Moves[1].To, ShouldEqual, "dashboards/Team 2/renamed.json")
+		})
+
+		Convey("Should not commit when nothing moves", func() {
+			mover.dashboardsPath = "dashboards"
+
+			migration, err := service.MigrateRepoLayout(1, false)
+			So(err, ShouldBeNil)
+			So(migration.Unchanged, ShouldEqual, 36)
+			So(mover.commits, ShouldEqual, 0)
+		})
+
+		Convey("Should abort with the conflicts when dashboards map to the same path", func() {
+			dashboardsById[101].FolderId = 2
+			dashboardsById[102].FolderId = 2
+
+			_, err := service.MigrateRepoLayout(1, false)
+			So(err, ShouldResemble, RepoLayoutConflictError{Conflicts: []*RepoLayoutConflict{
+				{Path: "grafana/dashboards/Team 2/service-1.json", DashboardIds: []int64{101, 201}},
+				{Path: "grafana/dashboards/Team 2/service-2.json", DashboardIds: []int64{102, 202}},
+			}})
+			So(mover.commits, ShouldEqual, 0)
+			So(saved, ShouldBeEmpty)
+		})
+
+		Convey("Should fail without a repository supporting the migration", func() {
+			getGitProvider = func(orgId int64) social.GitProvider {
+				return nil
+			}
+
+			_, err := service.MigrateRepoLayout(1, true)
+			So(err, ShouldEqual, ErrRepoLayoutNotSupported)
+		})
+
+		Reset(func() {
+			getGitProvider = origGetGitProvider
+		})
+	})
+}
+
+type fakeFileMover struct {
+	social.GitProvider
+	dashboardsPath string
+	commitSha      string
+	commits        int
+	message        string
+	moves          []social.FileMove
+}
+
+func (m *fakeFileMover) DashboardFilePath(orgId int64, folder string, name string) string {
+	return path.Join(m.dashboardsPath, folder, name+".json")
+}
+
+func (m *fakeFileMover) MoveFiles(orgId int64, moves []social.FileMove, message string) (string, error) {
+	m.commits++
+	m.message = message
+	m.moves = moves
+	return m.commitSha, nil
+}
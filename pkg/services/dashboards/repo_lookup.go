@@ -0,0 +1,118 @@
+package dashboards
+
+import (
+	"path"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// RepoPathDashboard is a dashboard synced to a path of the repository
+type RepoPathDashboard struct {
+	Id    int64  `json:"id"`
+	Uid   string `json:"uid"`
+	Title string `json:"title"`
+	Url   string `json:"url"`
+	// Current is false when the dashboard has moved away from the path since
+	Current bool `json:"current"`
+}
+
+// FindDashboardsByRepoPath returns the dashboards synced to a file of the repository, including dashboards that
+// were synced to it before being renamed or moved. Several dashboards can match a path, e.g. one that moved away
+// and the one synced there now. When no dashboard was ever recorded at the path, e.g. for dashboards synced
+// before paths were recorded, the dashboards whose path in the current repository layout is the file are
+// returned. repoId 0 matches all repositories of the organization.
+func (dr *dashboardServiceImpl) FindDashboardsByRepoPath(orgId int64, repoId int, filePath string) ([]*RepoPathDashboard, error) {
+	filePath = strings.TrimPrefix(path.Clean("/"+filePath), "/")
+	result := make([]*RepoPathDashboard, 0)
+
+	query := &models.FindDashboardGitSyncPathsQuery{OrgId: orgId, RepoId: repoId, FilePath: filePath}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	found := make(map[int64]bool)
+	for _, syncPath := range query.Result {
+		if found[syncPath.DashboardId] {
+			continue
+		}
+		found[syncPath.DashboardId] = true
+
+		dashQuery := &models.GetDashboardQuery{Id: syncPath.DashboardId, OrgId: orgId}
+		if err := bus.Dispatch(dashQuery); err != nil {
+			if err == models.ErrDashboardNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		syncQuery := &models.GetDashboardGitSyncQuery{DashboardId: syncPath.DashboardId}
+		if err := bus.Dispatch(syncQuery); err != nil {
+			return nil, err
+		}
+
+		current := syncQuery.Result != nil && syncQuery.Result.FilePath == filePath
+		result = append(result, newRepoPathDashboard(dashQuery.Result, current))
+	}
+
+	if len(query.Result) > 0 {
+		return result, nil
+	}
+
+	return findDashboardsByLayoutPath(orgId, repoId, filePath)
+}
+
+// findDashboardsByLayoutPath returns the dashboards the current layout of the repository of the organization
+// syncs to the file. Only dashboards with the slug of the file name can match, so they are the only ones checked.
+func findDashboardsByLayoutPath(orgId int64, repoId int, filePath string) ([]*RepoPathDashboard, error) {
+	result := make([]*RepoPathDashboard, 0)
+
+	if repoId > 0 {
+		if repo := getSyncRepo(orgId); repo == nil || repo.RepoId != repoId {
+			return result, nil
+		}
+	}
+
+	mover, ok := getGitProvider(orgId).(social.DashboardFileMover)
+	if !ok || path.Ext(filePath) != ".json" {
+		return result, nil
+	}
+
+	query := &models.GetDashboardsBySlugQuery{OrgId: orgId, Slug: strings.TrimSuffix(path.Base(filePath), ".json")}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	for _, dash := range query.Result {
+		if dash.IsFolder {
+			continue
+		}
+
+		folder, err := getDashboardFolder(dash)
+		if err != nil {
+			// the file of a dashboard left in a deleted folder is not known until it is repaired
+			if _, ok := err.(models.DashboardFolderNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+
+		if mover.DashboardFilePath(orgId, folder, dash.Slug) == filePath {
+			result = append(result, newRepoPathDashboard(dash, true))
+		}
+	}
+
+	return result, nil
+}
+
+func newRepoPathDashboard(dash *models.Dashboard, current bool) *RepoPathDashboard {
+	return &RepoPathDashboard{
+		Id:      dash.Id,
+		Uid:     dash.Uid,
+		Title:   dash.Title,
+		Url:     dash.GetUrl(),
+		Current: current,
+	}
+}
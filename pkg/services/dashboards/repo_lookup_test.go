@@ -0,0 +1,156 @@
+package dashboards
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFindDashboardsByRepoPath(t *testing.T) {
+	Convey("Given dashboards synced to a repository", t, func() {
+		bus.ClearBusHandlers()
+
+		origGetGitProvider := getGitProvider
+		getGitProvider = func(orgId int64) social.GitProvider {
+			return &fakeFileMover{dashboardsPath: "dashboards"}
+		}
+
+		origGetSyncRepo := getSyncRepo
+		getSyncRepo = func(orgId int64) *social.SyncRepo {
+			return &social.SyncRepo{Provider: "gitlab", RepoId: 7}
+		}
+
+		folder := models.NewDashboardFolder("Team A")
+		folder.Id = 1
+		folder.OrgId = 1
+
+		// renamed from Old Name, which was synced to dashboards/General/old-name.json
+		renamed := models.NewDashboard("Renamed")
+		renamed.Id = 2
+		renamed.Uid = "renamed"
+		renamed.OrgId = 1
+
+		// synced to the old path of the renamed dashboard since
+		replacement := models.NewDashboard("Old Name")
+		replacement.Id = 3
+		replacement.Uid = "replacement"
+		replacement.OrgId = 1
+
+		// synced before paths were recorded
+		legacy := models.NewDashboard("Legacy")
+		legacy.Id = 4
+		legacy.Uid = "legacy"
+		legacy.OrgId = 1
+		legacy.FolderId = folder.Id
+
+		dashboardsById := map[int64]*models.Dashboard{1: folder, 2: renamed, 3: replacement, 4: legacy}
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			dash, ok := dashboardsById[query.Id]
+			if !ok {
+				return models.ErrDashboardNotFound
+			}
+			query.Result = dash
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardsBySlugQuery) error {
+			for _, dash := range dashboardsById {
+				if dash.OrgId == query.OrgId && dash.Slug == query.Slug {
+					query.Result = append(query.Result, dash)
+				}
+			}
+			return nil
+		})
+
+		syncs := map[int64]string{
+			2: "dashboards/General/renamed.json",
+			3: "dashboards/General/old-name.json",
+			4: "dashboards/Team A/legacy.json",
+		}
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			if filePath, ok := syncs[query.DashboardId]; ok {
+				query.Result = &models.DashboardGitSync{DashboardId: query.DashboardId, FilePath: filePath}
+			}
+			return nil
+		})
+
+		paths := []*models.DashboardGitSyncPath{
+			{DashboardId: 3, OrgId: 1, RepoId: 7, FilePath: "dashboards/General/old-name.json"},
+			{DashboardId: 2, OrgId: 1, RepoId: 7, FilePath: "dashboards/General/renamed.json"},
+			{DashboardId: 2, OrgId: 1, RepoId: 7, FilePath: "dashboards/General/old-name.json"},
+		}
+		var queries []*models.FindDashboardGitSyncPathsQuery
+		bus.AddHandler("test", func(query *models.FindDashboardGitSyncPathsQuery) error {
+			queries = append(queries, query)
+			for _, syncPath := range paths {
+				if syncPath.OrgId == query.OrgId && syncPath.FilePath == query.FilePath && (query.RepoId == 0 || syncPath.RepoId == query.RepoId) {
+					query.Result = append(query.Result, syncPath)
+				}
+			}
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+
+		Convey("Should find the dashboard synced to its current path", func() {
+			result, err := service.FindDashboardsByRepoPath(1, 7, "/dashboards/General/renamed.json")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, []*RepoPathDashboard{
+				{Id: 2, Uid: "renamed", Title: "Renamed", Url: renamed.GetUrl(), Current: true},
+			})
+			So(queries[0].FilePath, ShouldEqual, "dashboards/General/renamed.json")
+		})
+
+		Convey("Should find the dashboards synced to a historical path", func() {
+			result, err := service.FindDashboardsByRepoPath(1, 7, "dashboards/General/old-name.json")
+			So(err, ShouldBeNil)
+			So(len(result), ShouldEqual, 2)
+			So(result[0].Uid, ShouldEqual, "replacement")
+			So(result[0].Current, ShouldBeTrue)
+			So(result[1].Uid, ShouldEqual, "renamed")
+			So(result[1].Current, ShouldBeFalse)
+		})
+
+		Convey("Should skip deleted dashboards", func() {
+			delete(dashboardsById, 3)
+
+			result, err := service.FindDashboardsByRepoPath(1, 7, "dashboards/General/old-name.json")
+			So(err, ShouldBeNil)
+			So(len(result), ShouldEqual, 1)
+			So(result[0].Uid, ShouldEqual, "renamed")
+		})
+
+		Convey("Should fall back to the current layout without recorded paths", func() {
+			expected := []*RepoPathDashboard{
+				{Id: 4, Uid: "legacy", Title: "Legacy", Url: legacy.GetUrl(), Current: true},
+			}
+
+			result, err := service.FindDashboardsByRepoPath(1, 0, "dashboards/Team A/legacy.json")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, expected)
+
+			result, err = service.FindDashboardsByRepoPath(1, 7, "dashboards/Team A/legacy.json")
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, expected)
+		})
+
+		Convey("Should return no match for an unknown path", func() {
+			result, err := service.FindDashboardsByRepoPath(1, 7, "dashboards/General/unknown.json")
+			So(err, ShouldBeNil)
+			So(result, ShouldBeEmpty)
+
+			result, err = service.FindDashboardsByRepoPath(1, 8, "dashboards/General/renamed.json")
+			So(err, ShouldBeNil)
+			So(result, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			getGitProvider = origGetGitProvider
+			getSyncRepo = origGetSyncRepo
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,574 @@
+package dashboards
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// SaveStage is a stage of the pipelines saving dashboards. The stages run in the order of the constants,
+// each pipeline leaves out the stages its save path does not need.
+type SaveStage string
+
+const (
+	// StagePreSaveTransform applies the whitespace title policy, the folder template, the transformers and the time
+	// policy, before the validation so the validators see the dashboard that is saved
+	StagePreSaveTransform SaveStage = "pre-save-transform"
+	// StageValidate runs the validators, validates the alerts and checks the dashboard against the database
+	StageValidate SaveStage = "validate"
+	// StageCheckPermissions checks the permissions of the user in the dashboard and the new folder, and that
+	// the dashboard is not provisioned
+	StageCheckPermissions SaveStage = "check-permissions"
+	// StagePreSaveSync commits the dashboard before it is saved, so a failed commit prevents the save
+	StagePreSaveSync SaveStage = "pre-save-sync"
+	// StagePersist saves the dashboard
+	StagePersist SaveStage = "persist"
+	// StagePostSaveSync queues the commits of asynchronous syncs and records the commit of the dashboard
+	StagePostSaveSync SaveStage = "post-save-sync"
+	// StageUpdateAlerts updates the alerts of the dashboard
+	StageUpdateAlerts SaveStage = "update-alerts"
+	// StagePublishEvents prunes the folder the dashboard was moved out of, publishing the deletes
+	StagePublishEvents SaveStage = "publish-events"
+)
+
+// The flags of disabled_save_stages skipping the optional stages, the sync flag skips both sync stages
+const (
+	SaveStageFlagSync          = "sync"
+	SaveStageFlagUpdateAlerts  = "update-alerts"
+	SaveStageFlagPublishEvents = "publish-events"
+)
+
+// The pipelines of the save paths, the label of the stage durations
+const (
+	savePipelineDashboard          = "dashboard"
+	savePipelineImport             = "import"
+	savePipelineProvisioning       = "provisioning"
+	savePipelineProvisioningFolder = "provisioning-folder"
+	savePipelineCommand            = "command"
+	savePipelineTouch              = "touch"
+)
+
+var savePipelineLog = log.New("dashboard-save-pipeline")
+
+// auditLog records the changes of dashboards no user asked for one by one, e.g. provisioning adopting a dashboard
+// or the repair of dashboards left in a deleted folder
+var auditLog = log.New("dashboard.audit")
+
+// SaveStageError is the error of the stage failing a save. The service methods return the error of the stage
+// so callers can compare it with the model errors, the stage is logged.
+type SaveStageError struct {
+	Pipeline string
+	Stage    SaveStage
+	Err      error
+}
+
+func (e SaveStageError) Error() string {
+	return fmt.Sprintf("%s stage of the %s save failed: %v", e.Stage, e.Pipeline, e.Err)
+}
+
+func (e SaveStageError) Unwrap() error {
+	return e.Err
+}
+
+// saveStageCause returns the error of the stage that failed the save, or the error itself
+func saveStageCause(err error) error {
+	if stageErr, ok := err.(SaveStageError); ok {
+		return stageErr.Err
+	}
+	return err
+}
+
+// saveStage is a stage of a save pipeline, optional stages have the flag of disabled_save_stages skipping them
+type saveStage struct {
+	name SaveStage
+	flag string
+	run  func(state *saveState) error
+}
+
+// saveState is the state shared by the stages of a save
+type saveState struct {
+	dto *SaveDashboardDTO
+	// validateAlerts and validateProvisionedDashboard select the checks of the save path
+	validateAlerts               bool
+	validateProvisionedDashboard bool
+	// validateAdoption checks that a provisioned save only takes over dashboards that are not provisioned when it
+	// is allowed to, adopted is the dashboard it takes over
+	validateAdoption bool
+	adopted          *models.Dashboard
+
+	parentFolderChanged bool
+	cmd                 *models.SaveDashboardCommand
+
+	// previous is the saved version of the dashboard, loaded once by the stages needing it
+	previous       *models.Dashboard
+	previousLoaded bool
+
+	// snapshot holds what the save is checked against. It is refetched when the validation resolved the save to
+	// another dashboard or folder, the uid check only needs the snapshot of the validated uid.
+	snapshot      *models.DashboardSaveSnapshot
+	snapshotQuery models.GetDashboardSaveSnapshotQuery
+
+	queued     []*dashboardCommit
+	syncResult *social.DashboardSyncResult
+	// syncErr is the failed commit kept by the sync failure policy of the save
+	syncErr       error
+	prunedFolders []*PrunedFolder
+}
+
+func (s *saveState) loadPrevious() *models.Dashboard {
+	if !s.previousLoaded {
+		s.previous = getPreviousDashboard(s.dto.Dashboard)
+		s.previousLoaded = true
+	}
+	return s.previous
+}
+
+func (s *saveState) loadSnapshot() (*models.DashboardSaveSnapshot, error) {
+	dash := s.dto.Dashboard
+	query := models.GetDashboardSaveSnapshotQuery{
+		OrgId:       s.dto.OrgId,
+		DashboardId: dash.Id,
+		Uid:         dash.Uid,
+		FolderId:    dash.FolderId,
+		User:        s.dto.User,
+	}
+
+	if s.snapshot != nil && query.DashboardId == s.snapshotQuery.DashboardId && query.FolderId == s.snapshotQuery.FolderId {
+		return s.snapshot, nil
+	}
+
+	if err := bus.Dispatch(&query); err != nil {
+		return nil, err
+	}
+
+	s.snapshot = query.Result
+	s.snapshotQuery = query
+	return s.snapshot, nil
+}
+
+func saveStageDisabled(flag string) bool {
+	for _, disabled := range setting.DashboardDisabledSaveStages {
+		if strings.EqualFold(disabled, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// runSavePipeline runs the stages in order, skipping the disabled ones, until one fails. The duration of each
+// stage is reported by pipeline and stage.
+func runSavePipeline(pipeline string, stages []saveStage, state *saveState) error {
+	for _, stage := range stages {
+		if stage.flag != "" && saveStageDisabled(stage.flag) {
+			continue
+		}
+
+		start := time.Now()
+		err := stage.run(state)
+		elapsed := time.Since(start).Nanoseconds() / int64(time.Millisecond)
+		metrics.MDashboardSaveStageDuration.WithLabelValues(pipeline, string(stage.name)).Observe(float64(elapsed))
+
+		if err != nil {
+			savePipelineLog.Debug("Dashboard save failed", "pipeline", pipeline, "stage", stage.name, "error", err)
+			return SaveStageError{Pipeline: pipeline, Stage: stage.name, Err: err}
+		}
+	}
+	return nil
+}
+
+// commandStages are the stages preparing the save command of a dashboard, shared by all the save paths
+func (dr *dashboardServiceImpl) commandStages() []saveStage {
+	return []saveStage{
+		{name: StagePreSaveTransform, run: dr.transformDashboard},
+		{name: StageValidate, run: dr.validateDashboard},
+		{name: StageCheckPermissions, run: dr.checkSavePermissions},
+	}
+}
+
+func (dr *dashboardServiceImpl) dashboardSaveStages() []saveStage {
+	return append(dr.commandStages(),
+		saveStage{name: StagePreSaveSync, flag: SaveStageFlagSync, run: dr.commitBeforeSave},
+		saveStage{name: StagePersist, run: dr.persistDashboard},
+		saveStage{name: StagePostSaveSync, flag: SaveStageFlagSync, run: dr.recordSync},
+		saveStage{name: StageUpdateAlerts, flag: SaveStageFlagUpdateAlerts, run: dr.updateDashboardAlerts},
+		saveStage{name: StagePublishEvents, flag: SaveStageFlagPublishEvents, run: dr.pruneFolderMovedFrom},
+	)
+}
+
+// importStages save imported dashboards to the default import folder, committing them as new files. Imports
+// do not update alerts.
+func (dr *dashboardServiceImpl) importStages() []saveStage {
+	stages := dr.commandStages()
+	transform := stages[0].run
+	stages[0].run = func(s *saveState) error {
+		if err := dr.setDefaultImportFolder(s.dto); err != nil {
+			return err
+		}
+		return transform(s)
+	}
+
+	return append(stages,
+		saveStage{name: StagePreSaveSync, flag: SaveStageFlagSync, run: dr.commitImportedDashboard},
+		saveStage{name: StagePersist, run: dr.saveCommand},
+		saveStage{name: StagePostSaveSync, flag: SaveStageFlagSync, run: dr.recordSync},
+	)
+}
+
+// provisioningStages save provisioned dashboards with their provisioning data, without syncing them
+func (dr *dashboardServiceImpl) provisioningStages(provisioning *models.DashboardProvisioning) []saveStage {
+	persist := func(s *saveState) error {
+		s.cmd = dr.newSaveCommand(s.dto)
+		err := bus.Dispatch(&models.SaveProvisionedDashboardCommand{
+			DashboardCmd:          s.cmd,
+			DashboardProvisioning: provisioning,
+		})
+
+		if err == nil && s.adopted != nil {
+			auditLog.Info("Provisioned dashboard adopted", "dashboardId", s.adopted.Id, "uid", s.adopted.Uid,
+				"title", s.adopted.Title, "orgId", s.dto.OrgId, "provisioner", provisioning.Name, "externalId", provisioning.ExternalId)
+		}
+		return err
+	}
+
+	return append(dr.commandStages(),
+		saveStage{name: StagePersist, run: persist},
+		saveStage{name: StageUpdateAlerts, flag: SaveStageFlagUpdateAlerts, run: dr.updateDashboardAlerts},
+	)
+}
+
+func (dr *dashboardServiceImpl) provisioningFolderStages() []saveStage {
+	return append(dr.commandStages(),
+		saveStage{name: StagePersist, run: dr.saveCommand},
+		saveStage{name: StageUpdateAlerts, flag: SaveStageFlagUpdateAlerts, run: dr.updateDashboardAlerts},
+	)
+}
+
+// touchStages commit the stored dashboard and update its alerts again, without saving it. The state holds the
+// stored dashboard as both the previous version and the result of the save.
+func (dr *dashboardServiceImpl) touchStages() []saveStage {
+	return []saveStage{
+		{name: StagePreSaveSync, flag: SaveStageFlagSync, run: dr.commitBeforeSave},
+		{name: StagePostSaveSync, flag: SaveStageFlagSync, run: dr.recordSync},
+		{name: StageUpdateAlerts, flag: SaveStageFlagUpdateAlerts, run: dr.updateDashboardAlerts},
+	}
+}
+
+func (dr *dashboardServiceImpl) transformDashboard(s *saveState) error {
+	dto := s.dto
+	dash := dto.Dashboard
+
+	if err := untitleWhitespaceTitle(dash); err != nil {
+		return err
+	}
+
+	dash.Title = strings.TrimSpace(dash.Title)
+	dash.Data.Set("title", dash.Title)
+	dash.SetUid(strings.TrimSpace(dash.Uid))
+
+	if err := applyFolderTemplate(dto); err != nil {
+		return err
+	}
+
+	dto.transformers = make([]AppliedTransformer, 0)
+	if !dash.IsFolder {
+		applied, err := runTransformers(dash, dash.Data, dto.OrgId, TransformOnSave)
+		if err != nil {
+			return err
+		}
+		dto.transformers = applied
+	}
+
+	return dr.applyTimePolicy(dto)
+}
+
+func (dr *dashboardServiceImpl) validateDashboard(s *saveState) error {
+	dto := s.dto
+	dash := dto.Dashboard
+
+	if err := dr.runValidators(dto); err != nil {
+		return err
+	}
+
+	if s.validateAlerts {
+		validateAlertsCmd := models.ValidateDashboardAlertsCommand{
+			OrgId:     dto.OrgId,
+			Dashboard: dash,
+			User:      dto.User,
+		}
+
+		if err := bus.Dispatch(&validateAlertsCmd); err != nil {
+			return models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleAlertValidation, Err: err}
+		}
+	}
+
+	snapshot, err := s.loadSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if err := checkUidKind(dash, snapshot.ExistingByUid); err != nil {
+		return err
+	}
+
+	// the folder may have been deleted since the dashboard was loaded, RepairOrphanedDashboards moves the
+	// dashboards left in it
+	if dash.FolderId > 0 && snapshot.Folder == nil {
+		return models.DashboardFolderNotFoundError{FolderId: dash.FolderId}
+	}
+
+	if s.validateAdoption {
+		if err := s.checkAdoption(snapshot); err != nil {
+			return err
+		}
+	}
+
+	validateBeforeSaveCmd := models.ValidateDashboardBeforeSaveCommand{
+		OrgId:          dto.OrgId,
+		Dashboard:      dash,
+		Overwrite:      dto.Overwrite,
+		AllowUidChange: dto.AllowUidChange,
+	}
+
+	if err := bus.Dispatch(&validateBeforeSaveCmd); err != nil {
+		if err == models.ErrDashboardVersionMismatch {
+			return versionConflictError(dash, dto.OrgId)
+		}
+		return err
+	}
+
+	s.parentFolderChanged = validateBeforeSaveCmd.Result.IsParentFolderChanged
+	return nil
+}
+
+// checkUidKind rejects a uid used by a folder for a dashboard, or by a dashboard for a folder. Both are dashboard
+// rows sharing the uids of their links and git paths, a collision would resolve them to the wrong kind.
+func checkUidKind(dash *models.Dashboard, existing *models.Dashboard) error {
+	if existing == nil || existing.Id == dash.Id || existing.IsFolder == dash.IsFolder {
+		return nil
+	}
+
+	if existing.IsFolder {
+		return models.ErrDashboardUidUsedByFolder
+	}
+	return models.ErrFolderUidUsedByDashboard
+}
+
+// checkAdoption rejects the provisioned save of a dashboard using the uid of a dashboard that is not provisioned,
+// unless the dto allows adopting it. Taking it over would make a dashboard made by hand read-only.
+func (s *saveState) checkAdoption(snapshot *models.DashboardSaveSnapshot) error {
+	existing := snapshot.ExistingByUid
+	if existing == nil || snapshot.ExistingByUidProvisioned {
+		return nil
+	}
+
+	if !s.dto.AllowAdoption {
+		return models.DashboardAdoptionError{DashboardId: existing.Id, Uid: existing.Uid, Title: existing.Title}
+	}
+
+	s.adopted = existing
+	return nil
+}
+
+func (dr *dashboardServiceImpl) checkSavePermissions(s *saveState) error {
+	dto := s.dto
+	dash := dto.Dashboard
+
+	snapshot, err := s.loadSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if s.parentFolderChanged {
+		folderGuardian := guardian.NewWithAcl(dash.FolderId, dto.OrgId, dto.User, snapshot.FolderAcl, snapshot.Teams)
+		if canSave, err := folderGuardian.CanSave(); err != nil || !canSave {
+			if err != nil {
+				return err
+			}
+			return models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied}
+		}
+
+		if s.validateAlerts && !dash.IsFolder {
+			if err := validateMovedDashboardAlerts(dto, snapshot.Folder); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.validateProvisionedDashboard {
+		if snapshot.Provisioning != nil {
+			return models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleProvisionedConflict, Err: models.ErrDashboardCannotSaveProvisionedDashboard}
+		}
+	}
+
+	guard := guardian.NewWithAcl(dash.GetDashboardIdForSavePermissionCheck(), dto.OrgId, dto.User, snapshot.Acl, snapshot.Teams)
+	if canSave, err := guard.CanSave(); err != nil || !canSave {
+		if err != nil {
+			return err
+		}
+		return models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleSavePermission, Err: models.ErrDashboardUpdateAccessDenied}
+	}
+
+	return nil
+}
+
+// commitBeforeSave commits the dashboard of users with a token, moving its file when it changed folder. The
+// commits are queued while the sync queue is active, stored with the dashboard and made once it is saved. A failed
+// delete of the previous file is handled by the sync failure policy like any other failed commit, so a moved
+// dashboard never leaves its old file behind unnoticed.
+func (dr *dashboardServiceImpl) commitBeforeSave(s *saveState) error {
+	dto := s.dto
+	if dto.User.Token == "" {
+		return nil
+	}
+
+	dr.setSyncedUid(dto.Dashboard)
+	commits := dashboardCommits(s.loadPrevious(), dto.Dashboard, dto)
+
+	if gitSyncQueue.active(dto.OrgId) {
+		s.queued = commits
+		return nil
+	}
+
+	for i, commit := range commits {
+		result, err := commit.commit(dr, false)
+		if err != nil {
+			return s.syncFailed(err, commits[i:])
+		}
+		if commit.action != social.DeleteDashboard {
+			s.syncResult = result
+		}
+	}
+
+	return nil
+}
+
+// commitImportedDashboard commits the imported dashboard as a new file, imports need the token of the user
+func (dr *dashboardServiceImpl) commitImportedDashboard(s *saveState) error {
+	dto := s.dto
+	if dto.User.Token == "" {
+		return models.ErrDashboardGitlabSync
+	}
+
+	dr.setSyncedUid(dto.Dashboard)
+	result, err := dr.updateDashboard(dto.Dashboard, social.CreateDashboard, dto, dto.Message)
+	if err != nil {
+		commit := &dashboardCommit{dashboard: dto.Dashboard, action: social.CreateDashboard, dto: dto, message: dto.Message, record: true}
+		return s.syncFailed(err, []*dashboardCommit{commit})
+	}
+
+	s.syncResult = result
+	return nil
+}
+
+// syncFailed fails the save with the error of the commit, unless the sync failure policy of the save keeps the
+// dashboard saved with a warning. The queue policy also queues the failed commit and those following it.
+func (s *saveState) syncFailed(err error, commits []*dashboardCommit) error {
+	switch s.dto.SyncFailurePolicy {
+	case setting.SyncFailurePolicyWarn:
+		s.dto.AddWarning(WarningSyncFailed, "The dashboard was saved without being committed: %v", err)
+	case setting.SyncFailurePolicyQueue:
+		s.queued = commits
+		s.dto.AddWarning(WarningSyncFailed, "The dashboard was saved and its commit queued: %v", err)
+	default:
+		return err
+	}
+
+	s.syncErr = err
+	return nil
+}
+
+func (dr *dashboardServiceImpl) newSaveCommand(dto *SaveDashboardDTO) *models.SaveDashboardCommand {
+	dash := dto.Dashboard
+	cmd := &models.SaveDashboardCommand{
+		Dashboard:   dash.Data,
+		Message:     dto.Message,
+		OrgId:       dto.OrgId,
+		Overwrite:   dto.Overwrite,
+		UserId:      dto.User.UserId,
+		FolderId:    dash.FolderId,
+		IsFolder:    dash.IsFolder,
+		PluginId:    dash.PluginId,
+		Source:      dto.Source,
+		RequestMeta: dto.RequestMeta,
+	}
+
+	if !dto.UpdatedAt.IsZero() {
+		cmd.UpdatedAt = dto.UpdatedAt
+	} else {
+		cmd.UpdatedAt = dr.now()
+	}
+
+	return cmd
+}
+
+func (dr *dashboardServiceImpl) saveCommand(s *saveState) error {
+	s.cmd = dr.newSaveCommand(s.dto)
+
+	// the queued commits are stored in the transaction of the save, so they are never lost nor made for a
+	// dashboard that was not saved
+	if len(s.queued) > 0 {
+		items, err := outboxItems(s.queued)
+		if err != nil {
+			return err
+		}
+		s.cmd.SyncOutbox = items
+	}
+
+	return bus.Dispatch(s.cmd)
+}
+
+// persistDashboard saves the dashboard, returning version mismatches as conflicts with the current dashboard.
+// The previous version is loaded first when the folder it leaves may be pruned.
+func (dr *dashboardServiceImpl) persistDashboard(s *saveState) error {
+	if setting.DashboardAutoPruneEmptyFolders {
+		s.loadPrevious()
+	}
+
+	err := dr.saveCommand(s)
+	if err == models.ErrDashboardVersionMismatch {
+		return versionConflictError(s.cmd.GetDashboardModel(), s.dto.OrgId)
+	}
+	return err
+}
+
+func (dr *dashboardServiceImpl) recordSync(s *saveState) error {
+	if len(s.queued) > 0 {
+		// touches do not save the dashboard, their commits are stored on their own
+		if len(s.cmd.SyncOutbox) == 0 {
+			items, err := outboxItems(s.queued)
+			if err != nil {
+				return err
+			}
+			if err := bus.Dispatch(&models.InsertDashboardSyncOutboxCommand{Dashboard: s.cmd.Result, Items: items}); err != nil {
+				return err
+			}
+		}
+		gitSyncQueue.enqueue()
+	}
+
+	// new dashboards only have an id once saved
+	if s.dto.syncSkipped {
+		gitSyncBudget.skip(s.cmd.Result.OrgId, s.cmd.Result.Id)
+	}
+
+	return saveGitSync(s.cmd.Result, s.dto, s.syncResult)
+}
+
+func (dr *dashboardServiceImpl) updateDashboardAlerts(s *saveState) error {
+	return dr.updateAlerting(s.cmd, s.dto)
+}
+
+func (dr *dashboardServiceImpl) pruneFolderMovedFrom(s *saveState) error {
+	if s.previous != nil && s.previous.FolderId != s.cmd.Result.FolderId {
+		s.prunedFolders = dr.pruneEmptyFolder(s.previous.FolderId, s.dto.OrgId)
+	}
+	return nil
+}
@@ -0,0 +1,476 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestSavePathsCharacterization records the steps of the three save paths with the default settings, the
+// commands they dispatch, the commits and the events in order, so changes to the paths are deliberate.
+func TestSavePathsCharacterization(t *testing.T) {
+	Convey("Given the save paths", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		fakeGuardian := &guardian.FakeDashboardGuardian{CanSaveValue: true}
+		guardian.MockDashboardGuardian(fakeGuardian)
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &fakeSyncConnector{orgId: 1, commitSha: "abc123"}
+		social.SocialMap["gitlab"] = &recordingConnector{fakeSyncConnector: connector}
+
+		var steps []string
+		recordingSteps = &steps
+
+		origDisabledStages := setting.DashboardDisabledSaveStages
+
+		var saveErr error
+		var parentFolderChanged bool
+
+		outbox := NewFakeSyncOutbox()
+		outbox.Register()
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+			steps = append(steps, "validate-alerts")
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			steps = append(steps, "validate-before-save")
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{IsParentFolderChanged: parentFolderChanged}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			steps = append(steps, "get-snapshot")
+			query.Result = &models.DashboardSaveSnapshot{}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			steps = append(steps, "get-dashboard")
+			query.Result = models.NewDashboard("Current")
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			steps = append(steps, "save")
+			if saveErr != nil {
+				return saveErr
+			}
+			cmd.Result = cmd.GetDashboardModel()
+			cmd.Result.Id = 5
+			return outbox.Insert(cmd.Result, cmd.SyncOutbox)
+		})
+		bus.AddHandler("test", func(cmd *models.SaveProvisionedDashboardCommand) error {
+			steps = append(steps, "save-provisioned")
+			cmd.Result = cmd.DashboardCmd.GetDashboardModel()
+			cmd.Result.Id = 5
+			cmd.DashboardCmd.Result = cmd.Result
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			steps = append(steps, "record-commit")
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+			steps = append(steps, "update-alerts")
+			return nil
+		})
+		bus.AddEventListener(func(event *events.DashboardSynced) error {
+			steps = append(steps, "event-synced")
+			return nil
+		})
+		bus.AddEventListener(func(event *events.DashboardSyncFailed) error {
+			steps = append(steps, "event-sync-failed")
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR, Login: "jdoe", AuthModule: "gitlab"}
+		newDto := func() *SaveDashboardDTO {
+			dash := models.NewDashboard("Dash")
+			dash.OrgId = 1
+			return &SaveDashboardDTO{OrgId: 1, Dashboard: dash, User: user}
+		}
+		// movedDto saves the dashboard 5 at the root, moving it out of the folder 2
+		movedDto := func() *SaveDashboardDTO {
+			bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+				steps = append(steps, "get-dashboard")
+				if query.Id == 2 {
+					query.Result = models.NewDashboardFolder("Ops")
+					return nil
+				}
+				query.Result = models.NewDashboard("Dash")
+				query.Result.SetUid("dash")
+				query.Result.FolderId = 2
+				return nil
+			})
+
+			dto := newDto()
+			dto.Dashboard.Id = 5
+			dto.Dashboard.SetUid("dash")
+			dto.Dashboard.Version = 1
+			return dto
+		}
+
+		Convey("SaveDashboardWithWarnings", func() {
+			Convey("Should validate, save and update the alerts", func() {
+				result, err := service.SaveDashboardWithWarnings(newDto())
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []string{"validate-alerts", "get-snapshot", "validate-before-save", "save", "update-alerts"})
+				So(result.Dashboard.Id, ShouldEqual, 5)
+				So(result.Warnings, ShouldBeEmpty)
+				So(result.PrunedFolders, ShouldBeEmpty)
+				So(result.Transformers, ShouldBeEmpty)
+			})
+
+			Convey("Should commit before saving and record the commit after", func() {
+				user.Token = "token"
+				dto := newDto()
+
+				_, err := service.SaveDashboardWithWarnings(dto)
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []string{
+					"validate-alerts", "get-snapshot", "validate-before-save",
+					"commit", "event-synced", "save", "record-commit", "update-alerts",
+				})
+				So(dto.Dashboard.Uid, ShouldNotBeEmpty)
+			})
+
+			Convey("Should report the commit of the save", func() {
+				user.Token = "token"
+
+				result, err := service.SaveDashboardWithWarnings(newDto())
+				So(err, ShouldBeNil)
+				So(result.Synced, ShouldBeTrue)
+				So(result.SyncError, ShouldBeNil)
+			})
+
+			Convey("Should not save when the commit fails", func() {
+				user.Token = "token"
+				connector.err = errors.New("commit failed")
+
+				_, err := service.SaveDashboardWithWarnings(newDto())
+				So(err, ShouldEqual, connector.err)
+				So(steps, ShouldResemble, []string{
+					"validate-alerts", "get-snapshot", "validate-before-save", "commit", "event-sync-failed",
+				})
+			})
+
+			Convey("Should not save a moved dashboard when the delete of its previous file fails", func() {
+				user.Token = "token"
+				connector.err = errors.New("delete failed")
+				dto := movedDto()
+
+				_, err := service.SaveDashboardWithWarnings(dto)
+				So(err, ShouldEqual, connector.err)
+				So(connector.lastOptions.Action, ShouldEqual, social.DeleteDashboard)
+				So(steps, ShouldNotContain, "save")
+			})
+
+			Convey("When the sync failure policy keeps the dashboards of failed commits", func() {
+				user.Token = "token"
+				connector.err = errors.New("commit failed")
+
+				Convey("Should save with a warning", func() {
+					dto := newDto()
+					dto.SyncFailurePolicy = setting.SyncFailurePolicyWarn
+
+					result, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(steps, ShouldResemble, []string{
+						"validate-alerts", "get-snapshot", "validate-before-save",
+						"commit", "event-sync-failed", "save", "update-alerts",
+					})
+					So(result.Synced, ShouldBeFalse)
+					So(result.SyncQueued, ShouldBeFalse)
+					So(result.SyncError, ShouldEqual, connector.err)
+					So(result.Warnings, ShouldHaveLength, 1)
+					So(result.Warnings[0].Code, ShouldEqual, WarningSyncFailed)
+				})
+
+				Convey("Should save a moved dashboard with a warning when the delete of its previous file fails", func() {
+					dto := movedDto()
+					dto.SyncFailurePolicy = setting.SyncFailurePolicyWarn
+
+					result, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(connector.lastOptions.Action, ShouldEqual, social.DeleteDashboard)
+					So(result.Synced, ShouldBeFalse)
+					So(result.SyncError, ShouldEqual, connector.err)
+					So(result.Warnings, ShouldHaveLength, 1)
+					So(result.Warnings[0].Code, ShouldEqual, WarningSyncFailed)
+				})
+
+				Convey("Should save and queue the commit", func() {
+					dto := newDto()
+					dto.SyncFailurePolicy = setting.SyncFailurePolicyQueue
+
+					result, err := service.SaveDashboardWithWarnings(dto)
+					So(err, ShouldBeNil)
+					So(result.Synced, ShouldBeFalse)
+					So(result.SyncQueued, ShouldBeTrue)
+					So(result.SyncError, ShouldEqual, connector.err)
+					So(gitSyncQueue.status().QueueDepth, ShouldEqual, 1)
+
+					registerQueuedCommitUser(user)
+					connector.err = nil
+					So(gitSyncQueue.flush(true), ShouldBeNil)
+					So(gitSyncQueue.status().QueueDepth, ShouldEqual, 0)
+					So(steps[len(steps)-1], ShouldEqual, "record-commit")
+				})
+
+				Reset(func() {
+					gitSyncQueue = newSyncQueue()
+				})
+			})
+
+			Convey("Should stop at the first failing validation", func() {
+				dto := newDto()
+				dto.Dashboard.Title = ""
+
+				_, err := service.SaveDashboardWithWarnings(dto)
+				So(err, ShouldEqual, models.ErrDashboardTitleEmpty)
+				So(steps, ShouldBeEmpty)
+			})
+
+			Convey("Should check the git override before anything else", func() {
+				dto := newDto()
+				dto.User = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+				dto.GitOverride = &models.DashboardGitOverride{Branch: "feature"}
+				dto.Dashboard.Title = ""
+
+				_, err := service.SaveDashboardWithWarnings(dto)
+				So(err, ShouldEqual, models.ErrDashboardGitOverrideAccessDenied)
+				So(steps, ShouldBeEmpty)
+			})
+
+			Convey("Should check the permissions after the database validation", func() {
+				fakeGuardian.CanSaveValue = false
+
+				_, err := service.SaveDashboardWithWarnings(newDto())
+				So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleSavePermission, Err: models.ErrDashboardUpdateAccessDenied})
+				So(steps, ShouldResemble, []string{"validate-alerts", "get-snapshot", "validate-before-save"})
+			})
+
+			Convey("Should check the folder permission before the provisioning", func() {
+				parentFolderChanged = true
+				fakeGuardian.CanSaveValue = false
+
+				_, err := service.SaveDashboardWithWarnings(newDto())
+				So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
+				So(steps, ShouldResemble, []string{"validate-alerts", "get-snapshot", "validate-before-save"})
+			})
+
+			Convey("Should return version conflicts of the save with the current dashboard", func() {
+				saveErr = models.ErrDashboardVersionMismatch
+				dto := newDto()
+				dto.Dashboard.Id = 5
+
+				_, err := service.SaveDashboardWithWarnings(dto)
+				So(err, ShouldHaveSameTypeAs, models.DashboardVersionConflictError{})
+				So(steps, ShouldResemble, []string{"validate-alerts", "get-snapshot", "validate-before-save", "save", "get-dashboard"})
+			})
+		})
+
+		Convey("ImportDashboard", func() {
+			Convey("Should validate, commit and save without updating the alerts", func() {
+				user.Token = "token"
+
+				dash, err := service.ImportDashboard(newDto())
+				So(err, ShouldBeNil)
+				So(dash.Id, ShouldEqual, 5)
+				So(steps, ShouldResemble, []string{
+					"get-snapshot", "validate-before-save", "commit", "event-synced", "save", "record-commit",
+				})
+				So(connector.lastOptions.Action, ShouldEqual, social.CreateDashboard)
+			})
+
+			Convey("Should fail after the validation without a token", func() {
+				_, err := service.ImportDashboard(newDto())
+				So(err, ShouldEqual, models.ErrDashboardGitlabSync)
+				So(steps, ShouldResemble, []string{"get-snapshot", "validate-before-save"})
+			})
+
+			Convey("Should return version mismatches of the save as is", func() {
+				user.Token = "token"
+				saveErr = models.ErrDashboardVersionMismatch
+
+				_, err := service.ImportDashboard(newDto())
+				So(err, ShouldEqual, models.ErrDashboardVersionMismatch)
+			})
+		})
+
+		Convey("With the sync stages disabled", func() {
+			setting.DashboardDisabledSaveStages = []string{"sync"}
+			user.Token = "token"
+
+			Convey("Should save without committing", func() {
+				_, err := service.SaveDashboardWithWarnings(newDto())
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []string{"validate-alerts", "get-snapshot", "validate-before-save", "save", "update-alerts"})
+			})
+
+			Convey("Should import without a token", func() {
+				user.Token = ""
+
+				_, err := service.ImportDashboard(newDto())
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []string{"get-snapshot", "validate-before-save", "save"})
+			})
+		})
+
+		Convey("TouchDashboard", func() {
+			var provisioning *models.DashboardProvisioning
+			bus.AddHandler("test", func(query *models.GetProvisionedDashboardDataByIdQuery) error {
+				steps = append(steps, "get-provisioning")
+				query.Result = provisioning
+				return nil
+			})
+
+			Convey("Should update the alerts of the stored dashboard without saving it", func() {
+				err := service.TouchDashboard(5, 1, user)
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []string{"get-provisioning", "get-dashboard", "update-alerts"})
+			})
+
+			Convey("Should commit the stored dashboard as an update and record the commit", func() {
+				user.Token = "token"
+
+				err := service.TouchDashboard(5, 1, user)
+				So(err, ShouldBeNil)
+				So(steps, ShouldResemble, []string{
+					"get-provisioning", "get-dashboard",
+					"commit", "event-synced", "record-commit", "update-alerts",
+				})
+				So(connector.lastOptions.Action, ShouldEqual, social.UpdateDashboard)
+				So(connector.lastOptions.Title, ShouldEqual, "Current")
+				So(connector.lastOptions.Message, ShouldEqual, touchCommitMessage)
+			})
+
+			Convey("Should not update the alerts when the commit fails", func() {
+				user.Token = "token"
+				connector.err = errors.New("gitlab unavailable")
+
+				err := service.TouchDashboard(5, 1, user)
+				So(err, ShouldEqual, connector.err)
+				So(steps, ShouldResemble, []string{"get-provisioning", "get-dashboard", "commit", "event-sync-failed"})
+			})
+
+			Convey("Should reject provisioned dashboards", func() {
+				provisioning = &models.DashboardProvisioning{Name: "default"}
+
+				err := service.TouchDashboard(5, 1, user)
+				So(err, ShouldEqual, models.ErrDashboardCannotSaveProvisionedDashboard)
+				So(steps, ShouldResemble, []string{"get-provisioning"})
+			})
+
+			Convey("Should reject users not allowed to save the dashboard", func() {
+				fakeGuardian.CanSaveValue = false
+
+				err := service.TouchDashboard(5, 1, user)
+				So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+				So(steps, ShouldBeEmpty)
+			})
+		})
+
+		Convey("SaveProvisionedDashboard", func() {
+			service.provisioning = true
+
+			Convey("Should validate without checking the provisioning, save and update the alerts", func() {
+				dto := newDto()
+				dto.User = nil
+
+				dash, err := service.SaveProvisionedDashboard(dto, &models.DashboardProvisioning{Name: "default"})
+				So(err, ShouldBeNil)
+				So(dash.Id, ShouldEqual, 5)
+				So(steps, ShouldResemble, []string{"validate-alerts", "get-snapshot", "validate-before-save", "save-provisioned", "update-alerts"})
+			})
+		})
+
+		Reset(func() {
+			recordingSteps = nil
+			setting.DashboardDisabledSaveStages = origDisabledStages
+			user.Token = ""
+			guardian.New = origNewDashboardGuardian
+			delete(social.SocialMap, "gitlab")
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			}
+		})
+	})
+}
+
+func TestSavePipelineRunner(t *testing.T) {
+	Convey("Given a save pipeline", t, func() {
+		origDisabledStages := setting.DashboardDisabledSaveStages
+
+		var ran []SaveStage
+		stageErr := errors.New("invalid")
+		failing := SaveStage("")
+		stage := func(name SaveStage, flag string) saveStage {
+			return saveStage{name: name, flag: flag, run: func(state *saveState) error {
+				ran = append(ran, name)
+				if name == failing {
+					return stageErr
+				}
+				return nil
+			}}
+		}
+		stages := []saveStage{
+			stage(StageValidate, ""),
+			stage(StagePreSaveSync, SaveStageFlagSync),
+			stage(StagePersist, ""),
+			stage(StagePostSaveSync, SaveStageFlagSync),
+			stage(StageUpdateAlerts, SaveStageFlagUpdateAlerts),
+		}
+
+		Convey("Should run the stages in order", func() {
+			So(runSavePipeline("test", stages, &saveState{}), ShouldBeNil)
+			So(ran, ShouldResemble, []SaveStage{StageValidate, StagePreSaveSync, StagePersist, StagePostSaveSync, StageUpdateAlerts})
+		})
+
+		Convey("Should skip the stages disabled by their flag", func() {
+			setting.DashboardDisabledSaveStages = []string{"Sync", "update-alerts"}
+
+			So(runSavePipeline("test", stages, &saveState{}), ShouldBeNil)
+			So(ran, ShouldResemble, []SaveStage{StageValidate, StagePersist})
+		})
+
+		Convey("Should stop at the failing stage and name it in the error", func() {
+			failing = StagePersist
+
+			err := runSavePipeline("test", stages, &saveState{})
+			So(err, ShouldResemble, SaveStageError{Pipeline: "test", Stage: StagePersist, Err: stageErr})
+			So(err.Error(), ShouldEqual, "persist stage of the test save failed: invalid")
+			So(saveStageCause(err), ShouldEqual, stageErr)
+			So(ran, ShouldResemble, []SaveStage{StageValidate, StagePreSaveSync, StagePersist})
+		})
+
+		Reset(func() {
+			setting.DashboardDisabledSaveStages = origDisabledStages
+		})
+	})
+}
+
+// recordingSteps collects the commits of recordingConnector with the other steps of the characterization
+var recordingSteps *[]string
+
+type recordingConnector struct {
+	*fakeSyncConnector
+}
+
+func (c *recordingConnector) UpdateDashboard(options *social.UpdateDashboardOptions, token string) error {
+	if recordingSteps != nil {
+		*recordingSteps = append(*recordingSteps, "commit")
+	}
+	return c.fakeSyncConnector.UpdateDashboard(options, token)
+}
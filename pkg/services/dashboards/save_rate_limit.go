@@ -0,0 +1,185 @@
+package dashboards
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// The limits of dashboard saves, the label of the throttled saves metric
+const (
+	saveRateLimitUser = "user"
+	saveRateLimitOrg  = "org"
+)
+
+// maxSaveRateBuckets is the number of buckets above which the full buckets are dropped, a full bucket is the same
+// as no bucket
+const maxSaveRateBuckets = 10000
+
+var saveLimiter = newSaveRateLimiter()
+
+// saveRateBucket is a token bucket of dashboard saves, refilled continuously at the rate of its limit
+type saveRateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// saveRateUser identifies the user of a save, API keys have their own bucket
+type saveRateUser struct {
+	orgId    int64
+	userId   int64
+	apiKeyId int64
+}
+
+// saveRateLimit is a limit of dashboard saves, a rate of 0 is unlimited
+type saveRateLimit struct {
+	name      string
+	perMinute int
+	burst     int
+}
+
+// saveRateLimiter limits the dashboard saves of each user and each organization with token buckets. The buckets
+// are kept in memory, so restarting Grafana refills them. The limits are read from the settings on each save.
+type saveRateLimiter struct {
+	mu    sync.Mutex
+	log   log.Logger
+	now   func() time.Time
+	users map[saveRateUser]*saveRateBucket
+	orgs  map[int64]*saveRateBucket
+}
+
+func newSaveRateLimiter() *saveRateLimiter {
+	return &saveRateLimiter{
+		log:   log.New("dashboard-save-rate"),
+		now:   time.Now,
+		users: make(map[saveRateUser]*saveRateBucket),
+		orgs:  make(map[int64]*saveRateBucket),
+	}
+}
+
+func saveRateLimits() (saveRateLimit, saveRateLimit) {
+	return saveRateLimit{name: saveRateLimitUser, perMinute: setting.DashboardSaveRatePerUser, burst: setting.DashboardSaveBurstPerUser},
+		saveRateLimit{name: saveRateLimitOrg, perMinute: setting.DashboardSaveRatePerOrg, burst: setting.DashboardSaveBurstPerOrg}
+}
+
+func (l saveRateLimit) enabled() bool {
+	return l.perMinute > 0
+}
+
+// capacity is the number of saves the bucket holds, at least one save
+func (l saveRateLimit) capacity() float64 {
+	return math.Max(float64(l.burst), 1)
+}
+
+// refill adds the saves the limit allowed since the bucket was last updated, up to its capacity
+func (b *saveRateBucket) refill(limit saveRateLimit, now time.Time) {
+	elapsed := now.Sub(b.updated).Minutes()
+	if elapsed > 0 {
+		b.tokens = math.Min(limit.capacity(), b.tokens+elapsed*float64(limit.perMinute))
+		b.updated = now
+	}
+	// a lower burst applies to the buckets already full
+	b.tokens = math.Min(b.tokens, limit.capacity())
+}
+
+// retryAfter is how long until the bucket holds a save, rounded up to the second
+func (b *saveRateBucket) retryAfter(limit saveRateLimit) time.Duration {
+	minutes := (1 - b.tokens) / float64(limit.perMinute)
+	return time.Duration(math.Ceil(minutes*60)) * time.Second
+}
+
+// exempted tells whether the saves of the dto are not limited: provisioning saves and restores of versions
+func (l *saveRateLimiter) exempted(dto *SaveDashboardDTO) bool {
+	return dto.Source == models.DashboardSourceProvisioning || dto.Source == models.DashboardSourceRestore
+}
+
+// allow takes a save from the buckets of the user and of the organization of the dto, or returns a
+// DashboardSaveRateLimitError when either is empty. A rejected save takes nothing from the other bucket.
+func (l *saveRateLimiter) allow(dto *SaveDashboardDTO) error {
+	userLimit, orgLimit := saveRateLimits()
+	if l.exempted(dto) || (!userLimit.enabled() && !orgLimit.enabled()) {
+		return nil
+	}
+
+	user := saveRateUser{orgId: dto.OrgId}
+	if dto.User != nil {
+		user.userId = dto.User.UserId
+		user.apiKeyId = dto.User.ApiKeyId
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	l.prune(userLimit, orgLimit, now)
+
+	type check struct {
+		limit  saveRateLimit
+		bucket *saveRateBucket
+	}
+	checks := make([]check, 0, 2)
+	if userLimit.enabled() {
+		checks = append(checks, check{userLimit, l.userBucket(user, userLimit, now)})
+	}
+	if orgLimit.enabled() {
+		checks = append(checks, check{orgLimit, l.orgBucket(dto.OrgId, orgLimit, now)})
+	}
+
+	for _, c := range checks {
+		c.bucket.refill(c.limit, now)
+		if c.bucket.tokens < 1 {
+			err := models.DashboardSaveRateLimitError{Limit: c.limit.name, RetryAfter: c.bucket.retryAfter(c.limit)}
+			l.mu.Unlock()
+
+			metrics.MDashboardSaveThrottled.WithLabelValues(c.limit.name).Inc()
+			l.log.Info("Dashboard save throttled", "limit", c.limit.name, "orgId", user.orgId, "userId", user.userId, "apiKeyId", user.apiKeyId, "retryAfter", err.RetryAfter)
+			return err
+		}
+	}
+
+	for _, c := range checks {
+		c.bucket.tokens--
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// userBucket and orgBucket return the bucket of the user or organization, new buckets are full
+func (l *saveRateLimiter) userBucket(user saveRateUser, limit saveRateLimit, now time.Time) *saveRateBucket {
+	bucket, ok := l.users[user]
+	if !ok {
+		bucket = &saveRateBucket{tokens: limit.capacity(), updated: now}
+		l.users[user] = bucket
+	}
+	return bucket
+}
+
+func (l *saveRateLimiter) orgBucket(orgId int64, limit saveRateLimit, now time.Time) *saveRateBucket {
+	bucket, ok := l.orgs[orgId]
+	if !ok {
+		bucket = &saveRateBucket{tokens: limit.capacity(), updated: now}
+		l.orgs[orgId] = bucket
+	}
+	return bucket
+}
+
+// prune drops the full buckets once there are too many, so users saving once do not keep a bucket forever
+func (l *saveRateLimiter) prune(userLimit saveRateLimit, orgLimit saveRateLimit, now time.Time) {
+	if len(l.users)+len(l.orgs) <= maxSaveRateBuckets {
+		return
+	}
+
+	for user, bucket := range l.users {
+		if bucket.refill(userLimit, now); !userLimit.enabled() || bucket.tokens >= userLimit.capacity() {
+			delete(l.users, user)
+		}
+	}
+	for orgId, bucket := range l.orgs {
+		if bucket.refill(orgLimit, now); !orgLimit.enabled() || bucket.tokens >= orgLimit.capacity() {
+			delete(l.orgs, orgId)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package dashboards
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+)
+
+func TestDashboardSaveRateLimit(t *testing.T) {
+	Convey("Given save rate limits of 2 saves a minute per user and 3 per org", t, func() {
+		bus.ClearBusHandlers()
+
+		store := NewFakeDashboardStore()
+		store.Register()
+
+		origRatePerUser, origBurstPerUser := setting.DashboardSaveRatePerUser, setting.DashboardSaveBurstPerUser
+		origRatePerOrg, origBurstPerOrg := setting.DashboardSaveRatePerOrg, setting.DashboardSaveBurstPerOrg
+		setting.DashboardSaveRatePerUser, setting.DashboardSaveBurstPerUser = 2, 2
+		setting.DashboardSaveRatePerOrg, setting.DashboardSaveBurstPerOrg = 3, 3
+
+		clock := &fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}
+		saveLimiter = newSaveRateLimiter()
+		saveLimiter.now = clock.Now
+
+		service := NewServiceWithDeps(clock, shortUIDGenerator{})
+		provisioningService := NewProvisioningServiceWithDeps(clock, shortUIDGenerator{})
+
+		alice := &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+		bob := &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+		titles := 0
+		save := func(user *models.SignedInUser, source models.DashboardSource) error {
+			titles++
+			dash := models.NewDashboard("Dashboard " + string(rune('A'+titles)))
+			dash.OrgId = user.OrgId
+			_, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: user.OrgId, User: user, Dashboard: dash, Source: source})
+			return err
+		}
+
+		Convey("Should reject the saves beyond the burst of the user with a retry hint", func() {
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+
+			err := save(alice, models.DashboardSourceUI)
+			So(err, ShouldResemble, models.DashboardSaveRateLimitError{Limit: "user", RetryAfter: 30 * time.Second})
+			So(xerrors.Is(err, models.ErrTooManySaveRequests), ShouldBeTrue)
+
+			Convey("Should refill the bucket as time passes", func() {
+				clock.now = clock.now.Add(29 * time.Second)
+				So(save(alice, models.DashboardSourceUI), ShouldResemble, models.DashboardSaveRateLimitError{Limit: "user", RetryAfter: time.Second})
+
+				clock.now = clock.now.Add(time.Second)
+				So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+				So(save(alice, models.DashboardSourceUI), ShouldNotBeNil)
+			})
+
+			Convey("Should not refill the bucket beyond the burst", func() {
+				clock.now = clock.now.Add(time.Hour)
+				So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+				So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+				So(save(alice, models.DashboardSourceUI), ShouldNotBeNil)
+			})
+		})
+
+		Convey("Should share the limit of the org between its users", func() {
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+			So(save(bob, models.DashboardSourceUI), ShouldBeNil)
+
+			err := save(bob, models.DashboardSourceUI)
+			So(err, ShouldResemble, models.DashboardSaveRateLimitError{Limit: "org", RetryAfter: 20 * time.Second})
+
+			other := &models.SignedInUser{UserId: 4, OrgId: 2, OrgRole: models.ROLE_EDITOR}
+			So(save(other, models.DashboardSourceUI), ShouldBeNil)
+
+			Convey("Should not take a save from the user when the org rejects it", func() {
+				clock.now = clock.now.Add(20 * time.Second)
+				So(save(bob, models.DashboardSourceUI), ShouldBeNil)
+			})
+		})
+
+		Convey("Should count imports with the saves", func() {
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+
+			dash := models.NewDashboard("Imported")
+			dash.OrgId = 1
+			_, err := service.ImportDashboard(&SaveDashboardDTO{OrgId: 1, User: alice, Dashboard: dash, Source: models.DashboardSourceImport})
+			So(err, ShouldResemble, models.DashboardSaveRateLimitError{Limit: "user", RetryAfter: 30 * time.Second})
+		})
+
+		Convey("When the user has no saves left", func() {
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+			So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+			So(save(alice, models.DashboardSourceUI), ShouldNotBeNil)
+
+			Convey("Should still restore versions", func() {
+				So(save(alice, models.DashboardSourceRestore), ShouldBeNil)
+				So(save(alice, models.DashboardSourceRestore), ShouldBeNil)
+			})
+
+			Convey("Should still save provisioned dashboards", func() {
+				for i := 0; i < 5; i++ {
+					dash := models.NewDashboard("Provisioned " + string(rune('A'+i)))
+					dash.OrgId = 1
+					_, err := provisioningService.SaveProvisionedDashboard(&SaveDashboardDTO{OrgId: 1, Dashboard: dash},
+						&models.DashboardProvisioning{Name: "default", ExternalId: "file.json"})
+					So(err, ShouldBeNil)
+				}
+			})
+
+			Convey("Should apply changed limits to the next saves", func() {
+				setting.DashboardSaveBurstPerUser = 3
+				clock.now = clock.now.Add(2 * time.Minute)
+				So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+				So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+				So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+				So(save(alice, models.DashboardSourceUI), ShouldResemble, models.DashboardSaveRateLimitError{Limit: "user", RetryAfter: 30 * time.Second})
+
+				setting.DashboardSaveRatePerUser = 0
+				So(save(alice, models.DashboardSourceUI), ShouldResemble, models.DashboardSaveRateLimitError{Limit: "org", RetryAfter: 20 * time.Second})
+
+				setting.DashboardSaveRatePerOrg = 0
+				for i := 0; i < 5; i++ {
+					So(save(alice, models.DashboardSourceUI), ShouldBeNil)
+				}
+			})
+		})
+
+		Reset(func() {
+			setting.DashboardSaveRatePerUser, setting.DashboardSaveBurstPerUser = origRatePerUser, origBurstPerUser
+			setting.DashboardSaveRatePerOrg, setting.DashboardSaveBurstPerOrg = origRatePerOrg, origBurstPerOrg
+			saveLimiter = newSaveRateLimiter()
+			bus.ClearBusHandlers()
+		})
+	})
+}
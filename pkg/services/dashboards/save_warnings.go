@@ -0,0 +1,64 @@
+package dashboards
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+const (
+	WarningTimeSettings            = "time-settings"
+	WarningTimePolicy              = "time-policy"
+	WarningImagesExtracted         = "images-extracted"
+	WarningAlertNotificationDenied = "alert-notification-denied"
+	WarningAlertsNotUpdated        = "alerts-not-updated"
+	WarningRenderedSource          = "rendered-source"
+	WarningSyncFailed              = "sync-failed"
+	WarningSyncConflict            = "sync-conflict"
+	WarningMirrorSyncFailed        = "mirror-sync-failed"
+)
+
+// Warning is an issue found by a soft validation that did not prevent saving the dashboard
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// SaveDashboardResult is the saved dashboard along with the warnings of the save
+type SaveDashboardResult struct {
+	Dashboard *models.Dashboard
+	Warnings  []Warning
+	// PrunedFolders are the folders deleted because moving the dashboard left them empty
+	PrunedFolders []*PrunedFolder
+	// Transformers are the transformers of the organization that changed the dashboard, in the order they ran
+	Transformers []AppliedTransformer
+	// Synced is set when the dashboard was committed during the save
+	Synced bool
+	// SyncQueued is set when the commit of the dashboard was queued
+	SyncQueued bool
+	// SyncError is the error of the commit when the sync failure policy of the save kept the dashboard saved
+	SyncError error
+}
+
+// BatchItemState tells whether an item of a batch operation was saved in the database and committed to git.
+// They are recorded independently, so the items saved without their commit can be committed again.
+type BatchItemState struct {
+	DbSaved    bool   `json:"dbSaved"`
+	GitSynced  bool   `json:"gitSynced"`
+	SyncQueued bool   `json:"syncQueued,omitempty"`
+	SyncError  string `json:"syncError,omitempty"`
+}
+
+func (state *BatchItemState) saved(result *SaveDashboardResult) {
+	state.DbSaved = true
+	state.GitSynced = result.Synced
+	state.SyncQueued = result.SyncQueued
+	if result.SyncError != nil {
+		state.SyncError = result.SyncError.Error()
+	}
+}
+
+// AddWarning reports an issue that does not prevent saving the dashboard, e.g. from a validator
+func (dto *SaveDashboardDTO) AddWarning(code string, format string, args ...interface{}) {
+	dto.warnings = append(dto.warnings, Warning{Code: code, Message: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,116 @@
+package dashboards
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// GetStaleDashboards returns the dashboards of the organization not viewed for olderThan, the least recently
+// viewed first. Dashboards tagged with one of excludeTags, the ones already in the archive folder and the templates
+// of folders are left out.
+func (dr *dashboardServiceImpl) GetStaleDashboards(orgId int64, olderThan time.Duration, excludeTags []string) ([]*models.StaleDashboard, error) {
+	archiveFolderId, err := getFolderIdByTitle(orgId, setting.DashboardArchiveFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &models.GetStaleDashboardsQuery{
+		OrgId:           orgId,
+		ViewedBefore:    dr.now().Add(-olderThan),
+		ExcludeTags:     excludeTags,
+		ExcludeFolderId: archiveFolderId,
+	}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	return query.Result, nil
+}
+
+// ArchiveDashboard moves the dashboard to the archive folder, creating the folder when needed. The move is a save
+// of the dashboard by the user, so it needs the permissions of one and moves the file of synced dashboards.
+func (dr *dashboardServiceImpl) ArchiveDashboard(dashboardId int64, orgId int64, user *models.SignedInUser) (*models.Dashboard, error) {
+	query := &models.GetDashboardQuery{Id: dashboardId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	return dr.archiveDashboard(query.Result, user)
+}
+
+// ArchiveDashboardWithToken archives the dashboard like ArchiveDashboard, with a token of the stale dashboards
+// report. The dashboard must not have changed since the report.
+func (dr *dashboardServiceImpl) ArchiveDashboardWithToken(dashboardId int64, orgId int64, token string, user *models.SignedInUser) (*models.Dashboard, error) {
+	version, expires, ok := parseDashboardToken(archiveTokenPurpose, token, orgId, dashboardId)
+	if !ok {
+		return nil, models.ErrDashboardArchiveTokenInvalid
+	}
+
+	if !dr.now().Before(expires) {
+		return nil, models.ErrDashboardArchiveTokenExpired
+	}
+
+	query := &models.GetDashboardQuery{Id: dashboardId, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	if query.Result.Version != version {
+		return nil, models.ErrDashboardVersionMismatch
+	}
+
+	return dr.archiveDashboard(query.Result, user)
+}
+
+func (dr *dashboardServiceImpl) archiveDashboard(dash *models.Dashboard, user *models.SignedInUser) (*models.Dashboard, error) {
+	if dash.IsFolder {
+		return nil, models.ErrDashboardCannotArchiveFolder
+	}
+
+	folderId, err := getArchiveFolderId(dash.OrgId, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if dash.FolderId == folderId {
+		return dash, nil
+	}
+
+	dash.FolderId = folderId
+	return dr.SaveDashboard(&SaveDashboardDTO{
+		OrgId:     dash.OrgId,
+		User:      user,
+		Dashboard: dash,
+		Message:   fmt.Sprintf("Archive the dashboard to %s", setting.DashboardArchiveFolder),
+	})
+}
+
+// getArchiveFolderId returns the id of the archive folder of the organization, creating it as the user
+func getArchiveFolderId(orgId int64, user *models.SignedInUser) (int64, error) {
+	folderId, err := getFolderIdByTitle(orgId, setting.DashboardArchiveFolder)
+	if err != nil || folderId > 0 {
+		return folderId, err
+	}
+
+	cmd := &models.CreateFolderCommand{Title: setting.DashboardArchiveFolder}
+	err = NewFolderService(orgId, user).CreateFolder(cmd)
+	if err == models.ErrFolderSameNameExists {
+		// created by another archive meanwhile
+		return getFolderIdByTitle(orgId, setting.DashboardArchiveFolder)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return cmd.Result.Id, nil
+}
+
+// SignArchiveToken returns a token archiving the dashboard in its version until expires, for the links of the
+// stale dashboards report
+func SignArchiveToken(orgId int64, dashboardId int64, version int, expires time.Time) string {
+	return signDashboardToken(archiveTokenPurpose, orgId, dashboardId, version, expires)
+}
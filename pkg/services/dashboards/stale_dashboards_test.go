@@ -0,0 +1,130 @@
+package dashboards
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+)
+
+func TestStaleDashboards(t *testing.T) {
+	Convey("Given the dashboard service on an in-memory store", t, func() {
+		bus.ClearBusHandlers()
+
+		store := NewFakeDashboardStore()
+		store.Register()
+
+		origSecretKey, origArchiveFolder := setting.SecretKey, setting.DashboardArchiveFolder
+		setting.SecretKey = "secret"
+		setting.DashboardArchiveFolder = "Archive"
+
+		clock := &fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}
+		service := NewServiceWithDeps(clock, shortUIDGenerator{})
+		editor := &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+
+		ops := store.AddFolder(1, "Ops")
+		stored := store.AddDashboard(1, ops.Id, "Disk")
+
+		Convey("Should query the dashboards viewed before the period, except the archived ones", func() {
+			archive := store.AddFolder(1, "Archive")
+
+			var query *models.GetStaleDashboardsQuery
+			bus.AddHandler("test", func(q *models.GetStaleDashboardsQuery) error {
+				query = q
+				q.Result = []*models.StaleDashboard{{Id: stored.Id}}
+				return nil
+			})
+
+			result, err := service.GetStaleDashboards(1, 24*time.Hour, []string{"keep"})
+			So(err, ShouldBeNil)
+			So(result, ShouldHaveLength, 1)
+			So(query.ViewedBefore, ShouldEqual, clock.now.Add(-24*time.Hour))
+			So(query.ExcludeTags, ShouldResemble, []string{"keep"})
+			So(query.ExcludeFolderId, ShouldEqual, archive.Id)
+		})
+
+		Convey("Should archive a dashboard into a new archive folder", func() {
+			archived, err := service.ArchiveDashboard(stored.Id, 1, editor)
+			So(err, ShouldBeNil)
+
+			folderId, err := getFolderIdByTitle(1, "Archive")
+			So(err, ShouldBeNil)
+			So(folderId, ShouldBeGreaterThan, 0)
+			So(archived.FolderId, ShouldEqual, folderId)
+			So(store.Dashboard(stored.Id).FolderId, ShouldEqual, folderId)
+			So(store.Dashboard(stored.Id).Version, ShouldEqual, 2)
+
+			Convey("Should leave archived dashboards as they are", func() {
+				_, err := service.ArchiveDashboard(stored.Id, 1, editor)
+				So(err, ShouldBeNil)
+				So(store.Dashboard(stored.Id).Version, ShouldEqual, 2)
+			})
+
+			Convey("Should archive other dashboards into the same folder", func() {
+				other := store.AddDashboard(1, 0, "Memory")
+				archived, err := service.ArchiveDashboard(other.Id, 1, editor)
+				So(err, ShouldBeNil)
+				So(archived.FolderId, ShouldEqual, folderId)
+			})
+		})
+
+		Convey("Should not archive folders", func() {
+			_, err := service.ArchiveDashboard(ops.Id, 1, editor)
+			So(err, ShouldEqual, models.ErrDashboardCannotArchiveFolder)
+		})
+
+		Convey("Should not archive dashboards the user cannot save", func() {
+			viewer := &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			store.AddFolder(1, "Archive")
+
+			_, err := service.ArchiveDashboard(stored.Id, 1, viewer)
+			So(xerrors.Is(err, models.ErrDashboardUpdateAccessDenied), ShouldBeTrue)
+			So(store.Dashboard(stored.Id).FolderId, ShouldEqual, ops.Id)
+		})
+
+		Convey("Given a link of the stale dashboards report", func() {
+			token := SignArchiveToken(1, stored.Id, stored.Version, clock.now.Add(time.Hour))
+
+			Convey("Should archive the dashboard", func() {
+				_, err := service.ArchiveDashboardWithToken(stored.Id, 1, token, editor)
+				So(err, ShouldBeNil)
+				So(store.Dashboard(stored.Id).FolderId, ShouldNotEqual, ops.Id)
+			})
+
+			Convey("Should not archive the dashboard once changed", func() {
+				dash := store.Dashboard(stored.Id)
+				dash.Data.Set("refresh", "1m")
+				_, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: editor, Dashboard: dash})
+				So(err, ShouldBeNil)
+
+				_, err = service.ArchiveDashboardWithToken(stored.Id, 1, token, editor)
+				So(err, ShouldEqual, models.ErrDashboardVersionMismatch)
+			})
+
+			Convey("Should not archive the dashboard once expired", func() {
+				clock.now = clock.now.Add(time.Hour)
+				_, err := service.ArchiveDashboardWithToken(stored.Id, 1, token, editor)
+				So(err, ShouldEqual, models.ErrDashboardArchiveTokenExpired)
+			})
+
+			Convey("Should not accept the link for another dashboard or a delete token", func() {
+				_, err := service.ArchiveDashboardWithToken(stored.Id+1, 1, token, editor)
+				So(err, ShouldEqual, models.ErrDashboardArchiveTokenInvalid)
+
+				deleteToken := signDeleteToken(1, stored.Id, stored.Version, clock.now.Add(time.Hour))
+				_, err = service.ArchiveDashboardWithToken(stored.Id, 1, deleteToken, editor)
+				So(err, ShouldEqual, models.ErrDashboardArchiveTokenInvalid)
+				So(store.Dashboard(stored.Id).FolderId, ShouldEqual, ops.Id)
+			})
+		})
+
+		Reset(func() {
+			setting.SecretKey, setting.DashboardArchiveFolder = origSecretKey, origArchiveFolder
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,183 @@
+package dashboards
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const WarningSyncBudgetExceeded = "sync-budget-exceeded"
+
+var gitSyncBudget = newSyncBudget()
+
+// SyncBudgetStatus is the use of the daily budget of dashboard commits of an organization
+type SyncBudgetStatus struct {
+	Commits int   `json:"commits"`
+	Bytes   int64 `json:"bytes"`
+	// CommitBudget and ByteBudget are the budgets of the day, 0 is unlimited
+	CommitBudget int   `json:"commitBudget"`
+	ByteBudget   int64 `json:"byteBudget"`
+	Exceeded     bool  `json:"exceeded"`
+	// Skipped are the dashboards whose changes were not committed since the budget was exceeded
+	Skipped []int64   `json:"skipped"`
+	ResetAt time.Time `json:"resetAt"`
+}
+
+// orgSyncBudget is the use of the budget of an organization on a day
+type orgSyncBudget struct {
+	day      time.Time
+	commits  int
+	bytes    int64
+	exceeded bool
+	skipped  []int64
+}
+
+// syncBudget counts the dashboard commits of each organization per day (UTC). The counts are kept in memory, so
+// restarting Grafana resets them.
+type syncBudget struct {
+	mu   sync.Mutex
+	log  log.Logger
+	now  func() time.Time
+	orgs map[int64]*orgSyncBudget
+}
+
+func newSyncBudget() *syncBudget {
+	return &syncBudget{log: log.New("dashboard-sync-budget"), now: time.Now, orgs: make(map[int64]*orgSyncBudget)}
+}
+
+func syncBudgetEnabled() bool {
+	return setting.DashboardSyncDailyCommitBudget > 0 || setting.DashboardSyncDailyByteBudget > 0
+}
+
+// current returns the use of the budget of the organization today, resetting it on a new day
+func (b *syncBudget) current(orgId int64) *orgSyncBudget {
+	day := b.now().UTC().Truncate(24 * time.Hour)
+
+	state, ok := b.orgs[orgId]
+	if !ok || !state.day.Equal(day) {
+		state = &orgSyncBudget{day: day, skipped: make([]int64, 0)}
+		b.orgs[orgId] = state
+	}
+	return state
+}
+
+// allow tells whether the commit of size bytes of the dashboard fits in the budget of its organization, and
+// counts it when it does. Once a commit does not fit, the budget is exceeded until the next day and the following
+// commits are skipped too. Skipped dashboards with an id are recorded, new ones are recorded by skip once saved.
+// Exceeding the budget publishes DashboardSyncBudgetExceeded.
+func (b *syncBudget) allow(orgId int64, dashboardId int64, size int) bool {
+	if !syncBudgetEnabled() {
+		return true
+	}
+
+	b.mu.Lock()
+	state := b.current(orgId)
+	commitBudget, byteBudget := setting.DashboardSyncDailyCommitBudget, setting.DashboardSyncDailyByteBudget
+
+	exceeded := false
+	if !state.exceeded {
+		if (commitBudget > 0 && state.commits+1 > commitBudget) || (byteBudget > 0 && state.bytes+int64(size) > byteBudget) {
+			state.exceeded = true
+			exceeded = true
+		} else {
+			state.commits++
+			state.bytes += int64(size)
+		}
+	}
+
+	allowed := !state.exceeded
+	if !allowed {
+		state.skip(dashboardId)
+	}
+
+	event := &events.DashboardSyncBudgetExceeded{
+		Timestamp:   b.now(),
+		OrgId:       orgId,
+		Commits:     state.commits,
+		Bytes:       state.bytes,
+		DashboardId: dashboardId,
+		ResetAt:     state.day.Add(24 * time.Hour),
+	}
+	b.setRemainingMetric(orgId, state)
+	b.mu.Unlock()
+
+	if exceeded {
+		b.log.Warn("Daily budget of dashboard commits exceeded, skipping commits", "orgId", orgId, "commits", event.Commits, "bytes", event.Bytes, "resetAt", event.ResetAt)
+		if err := bus.Publish(event); err != nil {
+			b.log.Warn("Failed to publish exceeded dashboard commit budget", "orgId", orgId, "error", err)
+		}
+	} else if !allowed {
+		b.log.Info("Skipping dashboard commit, daily budget exceeded", "orgId", orgId, "dashboardId", dashboardId)
+	}
+
+	return allowed
+}
+
+// skip records a dashboard whose commit was skipped
+func (b *syncBudget) skip(orgId int64, dashboardId int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current(orgId).skip(dashboardId)
+}
+
+func (s *orgSyncBudget) skip(dashboardId int64) {
+	if dashboardId == 0 || containsDashboardId(s.skipped, dashboardId) {
+		return
+	}
+	s.skipped = append(s.skipped, dashboardId)
+}
+
+func (b *syncBudget) setRemainingMetric(orgId int64, state *orgSyncBudget) {
+	org := strconv.FormatInt(orgId, 10)
+
+	if budget := setting.DashboardSyncDailyCommitBudget; budget > 0 {
+		metrics.MDashboardSyncBudgetRemaining.WithLabelValues(org, "commits").Set(remainingBudget(int64(budget), int64(state.commits), state.exceeded))
+	}
+	if budget := setting.DashboardSyncDailyByteBudget; budget > 0 {
+		metrics.MDashboardSyncBudgetRemaining.WithLabelValues(org, "bytes").Set(remainingBudget(budget, state.bytes, state.exceeded))
+	}
+}
+
+func remainingBudget(budget int64, used int64, exceeded bool) float64 {
+	if exceeded || used >= budget {
+		return 0
+	}
+	return float64(budget - used)
+}
+
+func (b *syncBudget) status(orgId int64) *SyncBudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.current(orgId)
+	return &SyncBudgetStatus{
+		Commits:      state.commits,
+		Bytes:        state.bytes,
+		CommitBudget: setting.DashboardSyncDailyCommitBudget,
+		ByteBudget:   setting.DashboardSyncDailyByteBudget,
+		Exceeded:     state.exceeded,
+		Skipped:      append([]int64{}, state.skipped...),
+		ResetAt:      state.day.Add(24 * time.Hour),
+	}
+}
+
+func containsDashboardId(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSyncBudget returns the use of the daily budget of dashboard commits of the organization, and the dashboards
+// whose commits were skipped since it was exceeded
+func (dr *dashboardServiceImpl) GetSyncBudget(orgId int64) *SyncBudgetStatus {
+	return gitSyncBudget.status(orgId)
+}
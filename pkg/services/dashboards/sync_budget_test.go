@@ -0,0 +1,204 @@
+package dashboards
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGitSyncBudget(t *testing.T) {
+	Convey("Given git sync configured for org 1 with a daily budget of 2 commits", t, func() {
+		bus.ClearBusHandlers()
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &recordingSyncConnector{}
+		social.SocialMap["gitlab"] = connector
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		origCommitBudget := setting.DashboardSyncDailyCommitBudget
+		origByteBudget := setting.DashboardSyncDailyByteBudget
+		setting.DashboardSyncDailyCommitBudget = 2
+		setting.DashboardSyncDailyByteBudget = 0
+
+		clock := &fakeClock{now: time.Date(2019, 9, 1, 22, 0, 0, 0, time.UTC)}
+		gitSyncBudget = newSyncBudget()
+		gitSyncBudget.now = clock.Now
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = &models.DashboardSaveSnapshot{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		outbox := NewFakeSyncOutbox()
+		outbox.Register()
+
+		nextId := int64(0)
+		var saved []string
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			nextId++
+			cmd.Result = cmd.GetDashboardModel()
+			cmd.Result.Id = nextId
+			saved = append(saved, cmd.Result.Title)
+			return outbox.Insert(cmd.Result, cmd.SyncOutbox)
+		})
+
+		var syncs []*models.SaveDashboardGitSyncCommand
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			syncs = append(syncs, cmd)
+			return nil
+		})
+
+		var exceeded []*events.DashboardSyncBudgetExceeded
+		bus.AddEventListener(func(event *events.DashboardSyncBudgetExceeded) error {
+			exceeded = append(exceeded, event)
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR, AuthModule: "gitlab", Token: "token"}
+		registerQueuedCommitUser(user)
+
+		save := func(title string) *SaveDashboardResult {
+			dash := models.NewDashboard(title)
+			dash.OrgId = 1
+			result, err := service.SaveDashboardWithWarnings(&SaveDashboardDTO{OrgId: 1, User: user, Dashboard: dash})
+			So(err, ShouldBeNil)
+			return result
+		}
+
+		Convey("Should commit the saves within the budget", func() {
+			save("First")
+			save("Second")
+
+			So(connector.committed, ShouldResemble, []string{"First", "Second"})
+			So(exceeded, ShouldBeEmpty)
+
+			status := service.GetSyncBudget(1)
+			So(status.Commits, ShouldEqual, 2)
+			So(status.CommitBudget, ShouldEqual, 2)
+			So(status.Exceeded, ShouldBeFalse)
+			So(status.ResetAt, ShouldResemble, time.Date(2019, 9, 2, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("When the budget is exceeded", func() {
+			save("First")
+			save("Second")
+			third := save("Third")
+			save("Fourth")
+
+			Convey("Should save the dashboards and skip their commits", func() {
+				So(saved, ShouldResemble, []string{"First", "Second", "Third", "Fourth"})
+				So(connector.committed, ShouldResemble, []string{"First", "Second"})
+				So(len(syncs), ShouldEqual, 2)
+				So(third.Warnings, ShouldHaveLength, 1)
+				So(third.Warnings[0].Code, ShouldEqual, WarningSyncBudgetExceeded)
+			})
+
+			Convey("Should record the skipped dashboards", func() {
+				status := service.GetSyncBudget(1)
+				So(status.Exceeded, ShouldBeTrue)
+				So(status.Commits, ShouldEqual, 2)
+				So(status.Skipped, ShouldResemble, []int64{3, 4})
+			})
+
+			Convey("Should publish the exceeded budget once", func() {
+				So(exceeded, ShouldHaveLength, 1)
+				So(exceeded[0].OrgId, ShouldEqual, 1)
+				So(exceeded[0].Commits, ShouldEqual, 2)
+				So(exceeded[0].ResetAt, ShouldResemble, time.Date(2019, 9, 2, 0, 0, 0, 0, time.UTC))
+			})
+
+			Convey("Should not limit other organizations", func() {
+				So(service.GetSyncBudget(2).Exceeded, ShouldBeFalse)
+			})
+
+			Convey("Should commit again once the day rolls over", func() {
+				clock.now = clock.now.Add(3 * time.Hour)
+
+				save("Fifth")
+				So(connector.committed, ShouldResemble, []string{"First", "Second", "Fifth"})
+
+				status := service.GetSyncBudget(1)
+				So(status.Exceeded, ShouldBeFalse)
+				So(status.Commits, ShouldEqual, 1)
+				So(status.Skipped, ShouldBeEmpty)
+				So(status.ResetAt, ShouldResemble, time.Date(2019, 9, 3, 0, 0, 0, 0, time.UTC))
+			})
+		})
+
+		Convey("Should skip the queued commits over the budget when resuming", func() {
+			_, err := service.SetSyncPaused(true)
+			So(err, ShouldBeNil)
+
+			save("First")
+			save("Second")
+			save("Third")
+
+			_, err = service.SetSyncPaused(false)
+			So(err, ShouldBeNil)
+			So(connector.committed, ShouldResemble, []string{"First", "Second"})
+			So(service.GetSyncStatus(), ShouldResemble, &GitSyncStatus{})
+			So(service.GetSyncBudget(1).Skipped, ShouldResemble, []int64{3})
+		})
+
+		Convey("Should limit the bytes committed", func() {
+			setting.DashboardSyncDailyCommitBudget = 0
+			setting.DashboardSyncDailyByteBudget = 1
+
+			save("First")
+			So(connector.committed, ShouldBeEmpty)
+			So(service.GetSyncBudget(1).Skipped, ShouldResemble, []int64{1})
+			So(exceeded, ShouldHaveLength, 1)
+		})
+
+		Convey("Should not count commits without a budget", func() {
+			setting.DashboardSyncDailyCommitBudget = 0
+
+			save("First")
+			save("Second")
+			save("Third")
+			So(connector.committed, ShouldResemble, []string{"First", "Second", "Third"})
+			So(service.GetSyncBudget(1).Commits, ShouldEqual, 0)
+		})
+
+		Reset(func() {
+			setting.DashboardSyncDailyCommitBudget = origCommitBudget
+			setting.DashboardSyncDailyByteBudget = origByteBudget
+			gitSyncBudget = newSyncBudget()
+			gitSyncQueue = newSyncQueue()
+			guardian.New = origNewDashboardGuardian
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,165 @@
+package dashboards
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestSyncedDashboardJsonContract checks the contract of the json committed to git with every serializer
+// configuration: the id is never committed, the uid is committed as saved, the saved dashboard is left as is,
+// and importing the committed file serializes back to the same bytes.
+func TestSyncedDashboardJsonContract(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/sync-contract/*.json")
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no sync contract fixtures: %v", err)
+	}
+
+	stored := func(fixture string) *models.Dashboard {
+		content, err := ioutil.ReadFile(fixture)
+		So(err, ShouldBeNil)
+
+		data, err := simplejson.NewJson(content)
+		So(err, ShouldBeNil)
+
+		dash := models.NewDashboardFromJson(data)
+		dash.OrgId = 1
+		return dash
+	}
+
+	// imported reads the committed file back like the git import, with the id the database gives it
+	imported := func(content []byte, id int64) *models.Dashboard {
+		data, err := simplejson.NewJson(content)
+		So(err, ShouldBeNil)
+		data.Del("id")
+
+		dash := models.NewDashboardFromJson(data)
+		dash.OrgId = 1
+		dash.SetId(id)
+		return dash
+	}
+
+	configurations := []struct {
+		name      string
+		normalize bool
+		onSync    []string
+	}{
+		{name: "without transformers"},
+		{name: "with normalized templating", normalize: true},
+		{name: "with a transformer removing the version", onSync: []string{"strip-version"}},
+	}
+
+	for _, configuration := range configurations {
+		configuration := configuration
+
+		Convey("Given the json committed "+configuration.name, t, func() {
+			origTransformers := registeredTransformers
+			origSettings := setting.DashboardTransformers
+			origNormalize := setting.DashboardNormalizeTemplating
+
+			registeredTransformers = map[string]Transformer{
+				"strip-version": func(data *simplejson.Json, ctx TransformContext) error {
+					data.Del("version")
+					return nil
+				},
+			}
+			setting.DashboardTransformers = []*setting.DashboardTransformerSettings{{OrgId: 1, OnSync: configuration.onSync}}
+			setting.DashboardNormalizeTemplating = configuration.normalize
+
+			for _, fixture := range fixtures {
+				fixture := fixture
+
+				Convey(filepath.Base(fixture), func() {
+					dash := stored(fixture)
+					before, err := dash.Data.Encode()
+					So(err, ShouldBeNil)
+
+					content, err := syncedDashboardJson(dash)
+					So(err, ShouldBeNil)
+
+					committed, err := simplejson.NewJson(content)
+					So(err, ShouldBeNil)
+
+					Convey("Should not commit the id", func() {
+						_, hasId := committed.CheckGet("id")
+						So(hasId, ShouldBeFalse)
+						// only the id of the dashboard, the ids of its panels are kept
+						So(strings.Count(string(content), `"id":`), ShouldEqual, strings.Count(string(before), `"id":`)-1)
+					})
+
+					Convey("Should commit the uid as saved", func() {
+						So(committed.Get("uid").MustString(), ShouldEqual, dash.Uid)
+					})
+
+					Convey("Should leave the saved dashboard as is", func() {
+						after, err := dash.Data.Encode()
+						So(err, ShouldBeNil)
+						So(string(after), ShouldEqual, string(before))
+						So(dash.Data.Get("version").MustInt(), ShouldEqual, dash.Version)
+					})
+
+					Convey("Should serialize the imported file to the same bytes", func() {
+						again, err := syncedDashboardJson(imported(content, dash.Id+100))
+						So(err, ShouldBeNil)
+						So(string(again), ShouldEqual, string(content))
+					})
+				})
+			}
+
+			Reset(func() {
+				registeredTransformers = origTransformers
+				setting.DashboardTransformers = origSettings
+				setting.DashboardNormalizeTemplating = origNormalize
+			})
+		})
+	}
+
+	Convey("Given sync transformers changing the uid", t, func() {
+		origTransformers := registeredTransformers
+		origSettings := setting.DashboardTransformers
+
+		registeredTransformers = map[string]Transformer{
+			"drop-uid": func(data *simplejson.Json, ctx TransformContext) error {
+				data.Del("uid")
+				return nil
+			},
+			"rename-uid": func(data *simplejson.Json, ctx TransformContext) error {
+				data.Set("uid", "renamed")
+				return nil
+			},
+		}
+		transformers := &setting.DashboardTransformerSettings{OrgId: 1}
+		setting.DashboardTransformers = []*setting.DashboardTransformerSettings{transformers}
+
+		dash := stored(fixtures[0])
+
+		Convey("Should fail when the uid is dropped", func() {
+			transformers.OnSync = []string{"drop-uid"}
+			_, err := syncedDashboardJson(dash)
+			So(err, ShouldEqual, models.ErrDashboardSyncUidMissing)
+		})
+
+		Convey("Should fail when the uid is changed", func() {
+			transformers.OnSync = []string{"rename-uid"}
+			_, err := syncedDashboardJson(dash)
+			So(err, ShouldEqual, models.ErrDashboardSyncUidChanged)
+		})
+
+		Convey("Should fail for dashboards without a uid", func() {
+			dash.SetUid("")
+			_, err := syncedDashboardJson(dash)
+			So(err, ShouldEqual, models.ErrDashboardSyncUidMissing)
+		})
+
+		Reset(func() {
+			registeredTransformers = origTransformers
+			setting.DashboardTransformers = origSettings
+		})
+	})
+}
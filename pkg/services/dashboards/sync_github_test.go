@@ -0,0 +1,128 @@
+package dashboards
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+	ini "gopkg.in/ini.v1"
+)
+
+func TestDashboardGithubSync(t *testing.T) {
+	Convey("Given dashboards of org 1 synced to a GitHub repository", t, func() {
+		bus.ClearBusHandlers()
+
+		// files are the contents of the files committed to the repository
+		files := map[string]string{}
+		var authorizations []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			filePath := strings.TrimPrefix(r.URL.Path, "/repositories/42/contents/")
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+
+			switch r.Method {
+			case "GET":
+				if _, ok := files[filePath]; !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(`{"sha": "1f2e3d4"}`))
+			case "PUT":
+				var commit struct {
+					Content string `json:"content"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&commit); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				content, _ := base64.StdEncoding.DecodeString(commit.Content)
+				files[filePath] = string(content)
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"commit": {"sha": "e83c5163316f89bfbde7d9ab23ca2e25604af290"}}`))
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}))
+
+		origRaw, origOAuthService := setting.Raw, setting.OAuthService
+		origConnector, hadConnector := social.SocialMap["github"]
+
+		setting.Raw = ini.Empty()
+		github := setting.Raw.Section("auth.github")
+		github.Key("enabled").SetValue("true")
+		github.Key("client_id").SetValue("client")
+		github.Key("client_secret").SetValue("secret")
+		github.Key("auth_url").SetValue("https://github.com/login/oauth/authorize")
+		github.Key("token_url").SetValue("https://github.com/login/oauth/access_token")
+		github.Key("api_url").SetValue("https://api.github.com/user")
+
+		repo := setting.Raw.Section("auth.github.repo.ops")
+		repo.Key("org_id").SetValue("1")
+		repo.Key("repo_id").SetValue("42")
+		repo.Key("branch").SetValue("main")
+		repo.Key("dashboards_path").SetValue("dashboards")
+		repo.Key("url").SetValue(server.URL)
+		repo.Key("allow_insecure").SetValue("true")
+
+		social.NewOAuthService()
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		store := NewFakeDashboardStore()
+		store.Register()
+
+		var synced *models.SaveDashboardGitSyncCommand
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			synced = cmd
+			return nil
+		})
+
+		service := NewServiceWithDeps(&fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}, shortUIDGenerator{})
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR, Login: "octocat", AuthModule: "github", Token: "gho_token"}
+
+		Convey("Should commit a saved dashboard to the repository with the token of the user", func() {
+			dashboard := models.NewDashboard("Service")
+			dashboard.OrgId = 1
+
+			saved, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: user, Dashboard: dashboard})
+			So(err, ShouldBeNil)
+
+			So(files, ShouldContainKey, "dashboards/General/service.json")
+			So(files["dashboards/General/service.json"], ShouldContainSubstring, `"title": "Service"`)
+			So(authorizations, ShouldNotBeEmpty)
+			So(authorizations[0], ShouldEqual, "token gho_token")
+
+			So(synced, ShouldNotBeNil)
+			So(synced.DashboardId, ShouldEqual, saved.Id)
+			So(synced.Provider, ShouldEqual, "github")
+			So(synced.FilePath, ShouldEqual, "dashboards/General/service.json")
+			So(synced.CommitSha, ShouldEqual, "e83c5163316f89bfbde7d9ab23ca2e25604af290")
+		})
+
+		Reset(func() {
+			server.Close()
+			guardian.New = origNewDashboardGuardian
+			setting.Raw, setting.OAuthService = origRaw, origOAuthService
+
+			if hadConnector {
+				social.SocialMap["github"] = origConnector
+			} else {
+				delete(social.SocialMap, "github")
+			}
+		})
+	})
+}
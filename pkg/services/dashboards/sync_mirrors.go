@@ -0,0 +1,134 @@
+package dashboards
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+var ErrRepoMirrorNotSupported = errors.New("No repository with mirrors is configured for the organization")
+
+var gitSyncMirrors = newMirrorSyncLog()
+
+var getMirrorPromoter = social.GetMirrorPromoter
+
+// MirrorSyncOverview is the state of a mirror of a repository since Grafana started. Commits to mirrors are
+// best-effort, their failures never fail the save of the dashboard.
+type MirrorSyncOverview struct {
+	RepoId int    `json:"repoId"`
+	Name   string `json:"name,omitempty"`
+	WebUrl string `json:"webUrl,omitempty"`
+	// LastCommit is nil when no dashboard was committed to the mirror since Grafana started
+	LastCommit *SyncCommit `json:"lastCommit"`
+	// LastFailure is nil when no commit to the mirror failed since Grafana started
+	LastFailure *SyncFailure `json:"lastFailure"`
+	// Failed counts the failed commits to the mirror since Grafana started
+	Failed int `json:"failed"`
+}
+
+type mirrorSyncKey struct {
+	orgId  int64
+	repoId int
+}
+
+// mirrorSyncLog keeps the last commit and failure of each mirror. It is kept in memory, so restarting Grafana
+// clears it.
+type mirrorSyncLog struct {
+	mu      sync.Mutex
+	mirrors map[mirrorSyncKey]*MirrorSyncOverview
+}
+
+func newMirrorSyncLog() *mirrorSyncLog {
+	return &mirrorSyncLog{mirrors: make(map[mirrorSyncKey]*MirrorSyncOverview)}
+}
+
+func (l *mirrorSyncLog) record(dashboard *models.Dashboard, result *social.MirrorSyncResult, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := mirrorSyncKey{orgId: dashboard.OrgId, repoId: result.RepoId}
+	mirror, ok := l.mirrors[key]
+	if !ok {
+		mirror = &MirrorSyncOverview{RepoId: result.RepoId}
+		l.mirrors[key] = mirror
+	}
+
+	if result.Err != nil {
+		mirror.Failed++
+		mirror.LastFailure = &SyncFailure{
+			DashboardId: dashboard.Id,
+			Title:       dashboard.Title,
+			Repo:        strconv.Itoa(result.RepoId),
+			Error:       result.Err.Error(),
+			Time:        now,
+		}
+		return
+	}
+
+	if result.CommitSha != "" {
+		mirror.LastCommit = &SyncCommit{DashboardId: dashboard.Id, CommitSha: result.CommitSha, FilePath: result.FilePath, Time: now}
+	}
+}
+
+// status returns the state of the mirrors of the repository of the organization
+func (l *mirrorSyncLog) status(orgId int64, mirrors []*social.SyncRepo) []*MirrorSyncOverview {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make([]*MirrorSyncOverview, 0, len(mirrors))
+	for _, repo := range mirrors {
+		mirror := MirrorSyncOverview{RepoId: repo.RepoId}
+		if recorded, ok := l.mirrors[mirrorSyncKey{orgId: orgId, repoId: repo.RepoId}]; ok {
+			mirror = *recorded
+		}
+		mirror.Name = repo.Name
+		mirror.WebUrl = repo.WebUrl
+		result = append(result, &mirror)
+	}
+	return result
+}
+
+// recordMirrorResults keeps the commits of a dashboard change to the mirrors of its repository for the sync
+// overview, and warns about the failed ones
+func (dr *dashboardServiceImpl) recordMirrorResults(dashboard *models.Dashboard, dto *SaveDashboardDTO, result *social.DashboardSyncResult) {
+	if result == nil {
+		return
+	}
+
+	for _, mirror := range result.Mirrors {
+		gitSyncMirrors.record(dashboard, mirror, dr.now())
+		if mirror.Err != nil {
+			dto.AddWarning(WarningMirrorSyncFailed, "The dashboard was not committed to the mirror %s of the repository: %s", mirrorName(mirror), mirror.Err)
+		}
+	}
+}
+
+func mirrorName(mirror *social.MirrorSyncResult) string {
+	if mirror.Name != "" {
+		return mirror.Name
+	}
+	return strconv.Itoa(mirror.RepoId)
+}
+
+// PromoteRepoMirror makes a mirror, selected by name or id, the repository the dashboards of the organization are
+// committed to, mirroring the commits to the former repository instead, see social.RepoMirrorPromoter
+func (dr *dashboardServiceImpl) PromoteRepoMirror(orgId int64, mirror string) (*social.SyncRepo, error) {
+	promoter := getMirrorPromoter(orgId)
+	if promoter == nil {
+		return nil, ErrRepoMirrorNotSupported
+	}
+
+	repo, err := promoter.PromoteMirror(orgId, mirror)
+	if err != nil {
+		return nil, err
+	}
+
+	log.New("dashboard-service").Info("Promoted repository mirror", "orgId", orgId, "repoId", repo.RepoId)
+	gitSyncOverviews.invalidate(orgId)
+	return repo, nil
+}
@@ -0,0 +1,173 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeMirrorConnector mirrors the commits of the fake connector with the results of mirrors
+type fakeMirrorConnector struct {
+	*fakeSyncConnector
+	mirrors []*social.MirrorSyncResult
+}
+
+func (c *fakeMirrorConnector) UpdateDashboard(options *social.UpdateDashboardOptions, token string) error {
+	if err := c.fakeSyncConnector.UpdateDashboard(options, token); err != nil {
+		return err
+	}
+	options.Result.Mirrors = c.mirrors
+	return nil
+}
+
+func (c *fakeMirrorConnector) SyncRepo(orgId int64) *social.SyncRepo {
+	repo := c.fakeSyncConnector.SyncRepo(orgId)
+	if repo != nil {
+		repo.Mirrors = []*social.SyncRepo{{Provider: "gitlab", Name: "next", RepoId: 8}, {Provider: "gitlab", Name: "archive", RepoId: 9}}
+	}
+	return repo
+}
+
+type fakeMirrorPromoter struct {
+	promoted []string
+	err      error
+}
+
+func (p *fakeMirrorPromoter) PromoteMirror(orgId int64, mirror string) (*social.SyncRepo, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.promoted = append(p.promoted, mirror)
+	return &social.SyncRepo{Provider: "gitlab", Name: mirror, RepoId: 8}, nil
+}
+
+func TestDashboardRepoMirrors(t *testing.T) {
+	Convey("Given a repository mirrored to two repositories", t, func() {
+		bus.ClearBusHandlers()
+
+		// failed commits of the other tests are kept too
+		gitSyncFailures = newSyncFailureLog()
+		gitSyncMirrors = newMirrorSyncLog()
+		gitSyncOverviews = &syncOverviewCache{overviews: make(map[int64]*cachedSyncOverview)}
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &fakeMirrorConnector{fakeSyncConnector: &fakeSyncConnector{orgId: 1, commitSha: "abc123"}}
+		social.SocialMap["gitlab"] = connector
+
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncsQuery) error {
+			return nil
+		})
+		var failures []*events.DashboardSyncFailed
+		bus.AddEventListener(func(event *events.DashboardSyncFailed) error {
+			failures = append(failures, event)
+			return nil
+		})
+		bus.AddEventListener(func(event *events.DashboardSynced) error {
+			return nil
+		})
+
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, AuthModule: "gitlab", Token: "token"}
+		dashboard := models.NewDashboard("Service")
+		dashboard.Id = 1
+		dashboard.OrgId = 1
+		dashboard.SetUid("service")
+		dto := &SaveDashboardDTO{OrgId: 1, User: user, Dashboard: dashboard}
+		service := &dashboardServiceImpl{clock: &fakeClock{now: time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)}}
+
+		Convey("When a mirror fails", func() {
+			connector.mirrors = []*social.MirrorSyncResult{
+				{RepoId: 8, Name: "next", FilePath: "grafana/General/service.json", Err: errors.New("500 Internal Server Error")},
+				{RepoId: 9, Name: "archive", FilePath: "General/service.json", CommitSha: "def456"},
+			}
+
+			result, err := service.updateDashboard(dashboard, social.UpdateDashboard, dto, "")
+
+			Convey("Should keep the commit to the repository and warn about the mirror", func() {
+				So(err, ShouldBeNil)
+				So(result.CommitSha, ShouldEqual, "abc123")
+				So(failures, ShouldBeEmpty)
+				So(dto.warnings, ShouldHaveLength, 1)
+				So(dto.warnings[0].Code, ShouldEqual, WarningMirrorSyncFailed)
+				So(dto.warnings[0].Message, ShouldContainSubstring, "next")
+			})
+
+			Convey("Should show the state of the mirrors in the sync overview", func() {
+				overview, err := (&dashboardServiceImpl{}).GetSyncOverview(1)
+				So(err, ShouldBeNil)
+				So(overview.Repos, ShouldHaveLength, 1)
+				So(overview.RecentFailures, ShouldBeEmpty)
+
+				mirrors := overview.Repos[0].Mirrors
+				So(mirrors, ShouldHaveLength, 2)
+				So(mirrors[0].RepoId, ShouldEqual, 8)
+				So(mirrors[0].Name, ShouldEqual, "next")
+				So(mirrors[0].Failed, ShouldEqual, 1)
+				So(mirrors[0].LastCommit, ShouldBeNil)
+				So(mirrors[0].LastFailure.Error, ShouldEqual, "500 Internal Server Error")
+				So(mirrors[1].Failed, ShouldEqual, 0)
+				So(mirrors[1].LastCommit.CommitSha, ShouldEqual, "def456")
+				So(mirrors[1].LastCommit.FilePath, ShouldEqual, "General/service.json")
+				So(mirrors[1].LastCommit.Time, ShouldEqual, time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC))
+			})
+		})
+
+		Convey("When promoting a mirror", func() {
+			origGetMirrorPromoter := getMirrorPromoter
+			promoter := &fakeMirrorPromoter{}
+			getMirrorPromoter = func(orgId int64) social.RepoMirrorPromoter {
+				return promoter
+			}
+
+			Convey("Should promote it and refresh the sync overview", func() {
+				_, err := service.GetSyncOverview(1)
+				So(err, ShouldBeNil)
+
+				repo, err := service.PromoteRepoMirror(1, "next")
+				So(err, ShouldBeNil)
+				So(repo.RepoId, ShouldEqual, 8)
+				So(promoter.promoted, ShouldResemble, []string{"next"})
+				So(gitSyncOverviews.get(1, service.now()), ShouldBeNil)
+			})
+
+			Convey("Should return the error of the provider", func() {
+				promoter.err = social.ErrRepoNotMirror
+
+				_, err := (&dashboardServiceImpl{}).PromoteRepoMirror(1, "current")
+				So(err, ShouldEqual, social.ErrRepoNotMirror)
+			})
+
+			Convey("Should fail without repository with mirrors", func() {
+				getMirrorPromoter = func(orgId int64) social.RepoMirrorPromoter {
+					return nil
+				}
+
+				_, err := (&dashboardServiceImpl{}).PromoteRepoMirror(1, "next")
+				So(err, ShouldEqual, ErrRepoMirrorNotSupported)
+			})
+
+			Reset(func() {
+				getMirrorPromoter = origGetMirrorPromoter
+			})
+		})
+
+		Reset(func() {
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+			gitSyncMirrors = newMirrorSyncLog()
+			gitSyncOverviews = &syncOverviewCache{overviews: make(map[int64]*cachedSyncOverview)}
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,245 @@
+package dashboards
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// recentSyncFailures is how many failed commits of an organization the overview keeps
+const recentSyncFailures = 5
+
+// syncOverviewTTL is how long an overview is served from the cache, so polling dashboards do not query the
+// database on every request
+const syncOverviewTTL = 10 * time.Second
+
+var gitSyncFailures = newSyncFailureLog()
+
+var gitSyncOverviews = &syncOverviewCache{overviews: make(map[int64]*cachedSyncOverview)}
+
+// SyncOverview is the health of the git sync of an organization. The parts of the subsystems that are not
+// enabled are nil, e.g. Budget when no daily budget of commits is configured.
+type SyncOverview struct {
+	OrgId int64 `json:"orgId"`
+	// Enabled tells that a repository is configured for the organization
+	Enabled bool                `json:"enabled"`
+	Repos   []*RepoSyncOverview `json:"repos"`
+	// Queue is the commit queue shared by all organizations
+	Queue  *GitSyncStatus    `json:"queue"`
+	Budget *SyncBudgetStatus `json:"budget"`
+	// Unsynced counts the dashboards whose last change is not committed: drifted from their file, skipped by the
+	// budget or queued
+	Unsynced int `json:"unsynced"`
+	// RecentFailures are the last failed commits of the organization since Grafana started, most recent first
+	RecentFailures []*SyncFailure `json:"recentFailures"`
+	GeneratedAt    time.Time      `json:"generatedAt"`
+}
+
+// RepoSyncOverview is the sync state of a repository dashboards of the organization are committed to
+type RepoSyncOverview struct {
+	RepoId   int    `json:"repoId"`
+	Provider string `json:"provider"`
+	WebUrl   string `json:"webUrl,omitempty"`
+	// LastCommit is nil when no dashboard was committed to the repository
+	LastCommit *SyncCommit `json:"lastCommit"`
+	// LastFailure is nil when no commit failed since Grafana started
+	LastFailure *SyncFailure `json:"lastFailure"`
+	// Pending counts the queued commits to the repository
+	Pending int `json:"pending"`
+	// Drifted counts the dashboards whose file was changed in the repository since they were last committed
+	Drifted int `json:"drifted"`
+	// Mirrors are the repositories the commits are mirrored to, only set for the repository of the organization
+	Mirrors []*MirrorSyncOverview `json:"mirrors,omitempty"`
+}
+
+// SyncCommit is the last commit of a dashboard to a repository
+type SyncCommit struct {
+	DashboardId int64     `json:"dashboardId"`
+	CommitSha   string    `json:"commitSha"`
+	FilePath    string    `json:"filePath"`
+	Time        time.Time `json:"time"`
+}
+
+// SyncFailure is a dashboard commit that failed. Repo is the repository the dashboard selects, empty for the
+// repository of the organization.
+type SyncFailure struct {
+	DashboardId int64     `json:"dashboardId"`
+	Title       string    `json:"title"`
+	Repo        string    `json:"repo"`
+	Error       string    `json:"error"`
+	Time        time.Time `json:"time"`
+}
+
+// syncFailureLog keeps the last failed commits of each organization. It is kept in memory, so restarting
+// Grafana clears it.
+type syncFailureLog struct {
+	mu       sync.Mutex
+	failures map[int64][]*SyncFailure
+}
+
+func newSyncFailureLog() *syncFailureLog {
+	return &syncFailureLog{failures: make(map[int64][]*SyncFailure)}
+}
+
+func (l *syncFailureLog) record(orgId int64, failure *SyncFailure) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failures := append([]*SyncFailure{failure}, l.failures[orgId]...)
+	if len(failures) > recentSyncFailures {
+		failures = failures[:recentSyncFailures]
+	}
+	l.failures[orgId] = failures
+}
+
+// recent returns the failures of the organization, most recent first
+func (l *syncFailureLog) recent(orgId int64) []*SyncFailure {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*SyncFailure{}, l.failures[orgId]...)
+}
+
+type cachedSyncOverview struct {
+	overview *SyncOverview
+	expires  time.Time
+}
+
+type syncOverviewCache struct {
+	mu        sync.Mutex
+	overviews map[int64]*cachedSyncOverview
+}
+
+func (c *syncOverviewCache) get(orgId int64, now time.Time) *SyncOverview {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.overviews[orgId]; ok && now.Before(cached.expires) {
+		return cached.overview
+	}
+	return nil
+}
+
+func (c *syncOverviewCache) set(overview *SyncOverview, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overviews[overview.OrgId] = &cachedSyncOverview{overview: overview, expires: now.Add(syncOverviewTTL)}
+}
+
+func (c *syncOverviewCache) invalidate(orgId int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.overviews, orgId)
+}
+
+// GetSyncOverview combines the sync state of the organization: its repositories with their last commit and
+// failure and the state of their mirrors, the queued and drifted dashboards, the use of the commit budget and the recent failures. The
+// overview is cached for syncOverviewTTL. Failures are matched to repositories by the id dashboards select
+// them with, failures of repositories selected by name are only listed in RecentFailures.
+func (dr *dashboardServiceImpl) GetSyncOverview(orgId int64) (*SyncOverview, error) {
+	now := dr.now()
+	if overview := gitSyncOverviews.get(orgId, now); overview != nil {
+		return overview, nil
+	}
+
+	query := &models.GetDashboardGitSyncsQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	overview := &SyncOverview{
+		OrgId:          orgId,
+		Repos:          make([]*RepoSyncOverview, 0),
+		Queue:          gitSyncQueue.status(),
+		RecentFailures: gitSyncFailures.recent(orgId),
+		GeneratedAt:    now,
+	}
+
+	// the repository of the organization also gets the commits made before the repository was recorded
+	orgRepoId := 0
+	repos := make(map[int]*RepoSyncOverview)
+	if repo := social.GetSyncRepo(orgId); repo != nil {
+		overview.Enabled = true
+		orgRepoId = repo.RepoId
+		repos[repo.RepoId] = &RepoSyncOverview{RepoId: repo.RepoId, Provider: repo.Provider, WebUrl: repo.WebUrl}
+		if len(repo.Mirrors) > 0 {
+			repos[repo.RepoId].Mirrors = gitSyncMirrors.status(orgId, repo.Mirrors)
+		}
+	}
+
+	repoOf := func(repoId int, provider string) *RepoSyncOverview {
+		if repoId == 0 {
+			repoId = orgRepoId
+		}
+		repo, ok := repos[repoId]
+		if !ok {
+			repo = &RepoSyncOverview{RepoId: repoId, Provider: provider}
+			repos[repoId] = repo
+		}
+		return repo
+	}
+
+	unsynced := make(map[int64]bool)
+	for _, record := range query.Result {
+		repo := repoOf(record.RepoId, record.Provider)
+		if record.ConflictCommitSha != "" {
+			repo.Drifted++
+			unsynced[record.DashboardId] = true
+		}
+		if record.CommitSha != "" && (repo.LastCommit == nil || record.Updated.After(repo.LastCommit.Time)) {
+			repo.LastCommit = &SyncCommit{DashboardId: record.DashboardId, CommitSha: record.CommitSha, FilePath: record.FilePath, Time: record.Updated}
+		}
+	}
+
+	for _, item := range gitSyncQueue.queued(orgId) {
+		if repo := repoSelectedBy(repos, orgRepoId, item.Repo); repo != nil {
+			repo.Pending++
+		}
+		if item.DashboardId != 0 {
+			unsynced[item.DashboardId] = true
+		}
+	}
+
+	// the failures are most recent first
+	for _, failure := range overview.RecentFailures {
+		if repo := repoSelectedBy(repos, orgRepoId, failure.Repo); repo != nil && repo.LastFailure == nil {
+			repo.LastFailure = failure
+		}
+	}
+
+	if syncBudgetEnabled() {
+		overview.Budget = gitSyncBudget.status(orgId)
+		for _, id := range overview.Budget.Skipped {
+			unsynced[id] = true
+		}
+	}
+	overview.Unsynced = len(unsynced)
+
+	for _, repo := range repos {
+		overview.Repos = append(overview.Repos, repo)
+	}
+	sort.Slice(overview.Repos, func(i, j int) bool {
+		return overview.Repos[i].RepoId < overview.Repos[j].RepoId
+	})
+
+	gitSyncOverviews.set(overview, now)
+	return overview, nil
+}
+
+// repoSelectedBy returns the repository a dashboard selects by id, or the repository of the organization when it
+// selects none. Repositories selected by name are not known to the overview.
+func repoSelectedBy(repos map[int]*RepoSyncOverview, orgRepoId int, selected string) *RepoSyncOverview {
+	if selected == "" {
+		return repos[orgRepoId]
+	}
+
+	repoId, err := strconv.Atoi(selected)
+	if err != nil {
+		return nil
+	}
+	return repos[repoId]
+}
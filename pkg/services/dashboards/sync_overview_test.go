@@ -0,0 +1,200 @@
+package dashboards
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetSyncOverview(t *testing.T) {
+	Convey("Given the sync overview of org 1", t, func() {
+		bus.ClearBusHandlers()
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		delete(social.SocialMap, "gitlab")
+
+		origCommitBudget := setting.DashboardSyncDailyCommitBudget
+		origByteBudget := setting.DashboardSyncDailyByteBudget
+		setting.DashboardSyncDailyCommitBudget = 0
+		setting.DashboardSyncDailyByteBudget = 0
+
+		// failed commits of the other tests are kept too
+		gitSyncFailures = newSyncFailureLog()
+
+		clock := &fakeClock{now: time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)}
+		service := &dashboardServiceImpl{clock: clock}
+
+		var records []*models.DashboardGitSync
+		queries := 0
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncsQuery) error {
+			queries++
+			query.Result = records
+			return nil
+		})
+
+		Convey("Without any sync subsystem enabled", func() {
+			overview, err := service.GetSyncOverview(1)
+			So(err, ShouldBeNil)
+
+			Convey("Should return an empty overview without errors", func() {
+				So(overview.Enabled, ShouldBeFalse)
+				So(overview.Repos, ShouldBeEmpty)
+				So(overview.Budget, ShouldBeNil)
+				So(overview.Unsynced, ShouldEqual, 0)
+				So(overview.RecentFailures, ShouldBeEmpty)
+				So(overview.Queue, ShouldResemble, &GitSyncStatus{})
+				So(overview.GeneratedAt, ShouldEqual, clock.now)
+			})
+		})
+
+		Convey("With a repository configured for the org", func() {
+			social.SocialMap["gitlab"] = &fakeSyncConnector{orgId: 1}
+			records = []*models.DashboardGitSync{
+				{DashboardId: 1, OrgId: 1, Provider: "gitlab", CommitSha: "old", FilePath: "General/a.json", Updated: clock.now.Add(-2 * time.Hour)},
+				{DashboardId: 2, OrgId: 1, Provider: "gitlab", CommitSha: "new", FilePath: "General/b.json", Updated: clock.now.Add(-time.Hour)},
+				{DashboardId: 3, OrgId: 1, Provider: "gitlab", CommitSha: "drift", ConflictCommitSha: "theirs", Updated: clock.now.Add(-3 * time.Hour)},
+				{DashboardId: 4, OrgId: 1, Provider: "gitlab", RepoId: 7, CommitSha: "other", FilePath: "Ops/c.json", Updated: clock.now.Add(-4 * time.Hour)},
+			}
+
+			Convey("Should list the repositories with their last commit and drifted dashboards", func() {
+				overview, err := service.GetSyncOverview(1)
+				So(err, ShouldBeNil)
+				So(overview.Enabled, ShouldBeTrue)
+				So(overview.Repos, ShouldHaveLength, 2)
+
+				orgRepo := overview.Repos[0]
+				So(orgRepo.RepoId, ShouldEqual, 0)
+				So(orgRepo.WebUrl, ShouldEqual, "https://gitlab.example.com/ops/dashboards")
+				So(orgRepo.LastCommit, ShouldResemble, &SyncCommit{DashboardId: 2, CommitSha: "new", FilePath: "General/b.json", Time: clock.now.Add(-time.Hour)})
+				So(orgRepo.Drifted, ShouldEqual, 1)
+				So(orgRepo.LastFailure, ShouldBeNil)
+
+				otherRepo := overview.Repos[1]
+				So(otherRepo.RepoId, ShouldEqual, 7)
+				So(otherRepo.Provider, ShouldEqual, "gitlab")
+				So(otherRepo.LastCommit.CommitSha, ShouldEqual, "other")
+				So(otherRepo.Drifted, ShouldEqual, 0)
+
+				So(overview.Unsynced, ShouldEqual, 1)
+				So(overview.Budget, ShouldBeNil)
+			})
+
+			Convey("Should match the failed commits to the repositories, keeping the last five", func() {
+				for i := 1; i <= 6; i++ {
+					dash := &models.Dashboard{Id: int64(10 + i), OrgId: 1, Title: fmt.Sprintf("Dash %d", i)}
+					service.publishSyncResult(dash, "", errors.New("gitlab unavailable"))
+				}
+				service.publishSyncResult(&models.Dashboard{Id: 20, OrgId: 1, Title: "Ops"}, "7", errors.New("forbidden"))
+				service.publishSyncResult(&models.Dashboard{Id: 21, OrgId: 2, Title: "Other org"}, "", errors.New("forbidden"))
+				service.publishSyncResult(&models.Dashboard{Id: 22, OrgId: 1, Title: "Synced"}, "", nil)
+
+				overview, err := service.GetSyncOverview(1)
+				So(err, ShouldBeNil)
+				So(overview.RecentFailures, ShouldHaveLength, recentSyncFailures)
+				So(overview.RecentFailures[0].Title, ShouldEqual, "Ops")
+				So(overview.RecentFailures[0].Time, ShouldEqual, clock.now)
+				So(overview.RecentFailures[1].Title, ShouldEqual, "Dash 6")
+				So(overview.RecentFailures[4].Title, ShouldEqual, "Dash 3")
+
+				So(overview.Repos[0].LastFailure.Title, ShouldEqual, "Dash 6")
+				So(overview.Repos[1].LastFailure.Title, ShouldEqual, "Ops")
+				So(overview.Repos[1].LastFailure.Error, ShouldEqual, "forbidden")
+			})
+
+			Convey("Should count the queued commits as pending and unsynced", func() {
+				gitSyncQueue.paused = true
+				outbox := NewFakeSyncOutbox()
+				outbox.Register()
+				queueOverviewCommit(outbox, 1, 1, "")
+				queueOverviewCommit(outbox, 3, 1, "")
+				queueOverviewCommit(outbox, 4, 1, "7")
+				queueOverviewCommit(outbox, 5, 2, "")
+
+				overview, err := service.GetSyncOverview(1)
+				So(err, ShouldBeNil)
+				So(overview.Queue, ShouldResemble, &GitSyncStatus{Paused: true, QueueDepth: 4})
+				So(overview.Repos[0].Pending, ShouldEqual, 2)
+				So(overview.Repos[1].Pending, ShouldEqual, 1)
+				// dashboard 3 is both drifted and queued
+				So(overview.Unsynced, ShouldEqual, 3)
+			})
+
+			Convey("With a daily budget of commits", func() {
+				setting.DashboardSyncDailyCommitBudget = 1
+				gitSyncBudget = newSyncBudget()
+				gitSyncBudget.now = clock.Now
+				gitSyncBudget.allow(1, 1, 10)
+				gitSyncBudget.allow(1, 8, 10)
+
+				Convey("Should report its use and count the skipped dashboards as unsynced", func() {
+					overview, err := service.GetSyncOverview(1)
+					So(err, ShouldBeNil)
+					So(overview.Budget, ShouldNotBeNil)
+					So(overview.Budget.Commits, ShouldEqual, 1)
+					So(overview.Budget.Exceeded, ShouldBeTrue)
+					So(overview.Budget.Skipped, ShouldResemble, []int64{8})
+					So(overview.Unsynced, ShouldEqual, 2)
+				})
+			})
+		})
+
+		Convey("Should serve the overview from the cache until it expires", func() {
+			first, err := service.GetSyncOverview(1)
+			So(err, ShouldBeNil)
+
+			clock.now = clock.now.Add(syncOverviewTTL - time.Second)
+			cached, err := service.GetSyncOverview(1)
+			So(err, ShouldBeNil)
+			So(cached, ShouldEqual, first)
+			So(queries, ShouldEqual, 1)
+
+			clock.now = clock.now.Add(time.Second)
+			refreshed, err := service.GetSyncOverview(1)
+			So(err, ShouldBeNil)
+			So(refreshed, ShouldNotEqual, first)
+			So(refreshed.GeneratedAt, ShouldEqual, clock.now)
+			So(queries, ShouldEqual, 2)
+		})
+
+		Convey("Should return the errors of the database", func() {
+			bus.AddHandler("test", func(query *models.GetDashboardGitSyncsQuery) error {
+				return errors.New("database is locked")
+			})
+
+			_, err := service.GetSyncOverview(1)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			gitSyncOverviews = &syncOverviewCache{overviews: make(map[int64]*cachedSyncOverview)}
+			gitSyncFailures = newSyncFailureLog()
+			gitSyncQueue = newSyncQueue()
+			gitSyncBudget = newSyncBudget()
+			setting.DashboardSyncDailyCommitBudget = origCommitBudget
+			setting.DashboardSyncDailyByteBudget = origByteBudget
+			delete(social.SocialMap, "gitlab")
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			}
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+func queueOverviewCommit(outbox *FakeSyncOutbox, dashboardId int64, orgId int64, repo string) {
+	data := simplejson.New()
+	if repo != "" {
+		data.Set("gitRepo", repo)
+	}
+	dash := &models.Dashboard{Id: dashboardId, OrgId: orgId, Data: data}
+	item := &models.DashboardSyncOutboxItem{Action: string(social.UpdateDashboard), Repo: repo}
+	So(outbox.Insert(dash, []*models.DashboardSyncOutboxItem{item}), ShouldBeNil)
+}
@@ -0,0 +1,508 @@
+package dashboards
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// syncQueuePollInterval is how often the queued commits are checked for retries and for commits left by other
+// instances
+const syncQueuePollInterval = 10 * time.Second
+
+// maxSyncRetryDelay caps the delay between the attempts of a queued commit
+const maxSyncRetryDelay = time.Hour
+
+var gitSyncQueue = newSyncQueue()
+
+func init() {
+	registry.RegisterService(gitSyncQueue)
+}
+
+// GitSyncStatus tells whether dashboard commits are paused and how many are waiting
+type GitSyncStatus struct {
+	Paused     bool `json:"paused"`
+	QueueDepth int  `json:"queueDepth"`
+	// Failed is the number of queued commits that failed all their attempts
+	Failed int `json:"failed"`
+}
+
+// QueuedSyncCommit is a queued dashboard commit, as listed to admins
+type QueuedSyncCommit struct {
+	Id          int64                            `json:"id"`
+	OrgId       int64                            `json:"orgId"`
+	DashboardId int64                            `json:"dashboardId"`
+	Title       string                           `json:"title"`
+	Action      string                           `json:"action"`
+	Status      models.DashboardSyncOutboxStatus `json:"status"`
+	Attempts    int                              `json:"attempts"`
+	NextRetry   *time.Time                       `json:"nextRetry,omitempty"`
+	LeaseOwner  string                           `json:"leaseOwner,omitempty"`
+	LeaseUntil  *time.Time                       `json:"leaseUntil,omitempty"`
+	Error       string                           `json:"error,omitempty"`
+	Created     time.Time                        `json:"created"`
+	Updated     time.Time                        `json:"updated"`
+}
+
+func newQueuedSyncCommit(item *models.DashboardSyncOutboxItem) *QueuedSyncCommit {
+	commit := &QueuedSyncCommit{
+		Id:          item.Id,
+		OrgId:       item.OrgId,
+		DashboardId: item.DashboardId,
+		Action:      item.Action,
+		Status:      item.Status,
+		Attempts:    item.Attempts,
+		Error:       item.Error,
+		Created:     item.Created,
+		Updated:     item.Updated,
+	}
+
+	if data, err := simplejson.NewJson([]byte(item.Dashboard)); err == nil {
+		commit.Title = data.Get("title").MustString()
+	}
+	if item.Status == models.DashboardSyncOutboxPending {
+		commit.NextRetry = &item.NextRetry
+	}
+	if item.Status == models.DashboardSyncOutboxInflight {
+		commit.LeaseOwner = item.LeaseOwner
+		commit.LeaseUntil = &item.LeaseUntil
+	}
+	return commit
+}
+
+// dashboardCommit is a commit syncing a save of a dashboard to git
+type dashboardCommit struct {
+	dashboard *models.Dashboard
+	action    social.DashboardAction
+	dto       *SaveDashboardDTO
+	message   string
+	// record makes the result of the commit the git sync state of the dashboard
+	record bool
+}
+
+// dashboardCommits returns the commits syncing a save of the dashboard. Moving a dashboard to another folder or
+// repository deletes its previous file and creates the new one.
+func dashboardCommits(previous *models.Dashboard, dashboard *models.Dashboard, dto *SaveDashboardDTO) []*dashboardCommit {
+	if previous == nil {
+		return []*dashboardCommit{{dashboard: dashboard, action: social.CreateDashboard, dto: dto, record: true}}
+	}
+
+	if previous.FolderId != dashboard.FolderId || previous.GitRepo() != dashboard.GitRepo() {
+		return []*dashboardCommit{
+			{dashboard: previous, action: social.DeleteDashboard, dto: dto},
+			{dashboard: dashboard, action: social.CreateDashboard, dto: dto, record: true},
+		}
+	}
+
+	message := withAlertChanges(dto.Message, previous, dashboard)
+	return []*dashboardCommit{{dashboard: dashboard, action: social.UpdateDashboard, dto: dto, message: message, record: true}}
+}
+
+// commit creates the commit, and records it as the sync state of the dashboard when it was queued
+func (c *dashboardCommit) commit(dr *dashboardServiceImpl, queued bool) (*social.DashboardSyncResult, error) {
+	result, err := dr.updateDashboard(c.dashboard, c.action, c.dto, c.message)
+	if err != nil || !queued || !c.record {
+		return result, err
+	}
+
+	return result, saveGitSync(c.dashboard, c.dto, result)
+}
+
+// outboxItem returns the item queuing the commit. Deletes commit the previous version of the dashboard, the
+// other commits the saved version, which the store adds to the item.
+func (c *dashboardCommit) outboxItem() (*models.DashboardSyncOutboxItem, error) {
+	user := c.dto.User
+	item := &models.DashboardSyncOutboxItem{
+		Action:     string(c.action),
+		Repo:       c.dashboard.GitRepo(),
+		Message:    c.message,
+		Source:     string(c.dto.Source),
+		UserId:     user.UserId,
+		AuthModule: user.AuthModule,
+	}
+
+	if c.action == social.DeleteDashboard {
+		data, err := c.dashboard.Data.Encode()
+		if err != nil {
+			return nil, err
+		}
+		item.Dashboard = string(data)
+		item.DashboardId = c.dashboard.Id
+		item.FolderId = c.dashboard.FolderId
+	}
+
+	if len(c.dto.Coauthors) > 0 {
+		coauthors, err := json.Marshal(c.dto.Coauthors)
+		if err != nil {
+			return nil, err
+		}
+		item.Coauthors = string(coauthors)
+	}
+	if c.dto.RequestMeta != nil {
+		item.RequestId = c.dto.RequestMeta.RequestId
+	}
+	if override := c.dto.GitOverride; override != nil {
+		item.Branch = override.Branch
+		item.RepoId = override.RepoId
+	}
+	return item, nil
+}
+
+func outboxItems(commits []*dashboardCommit) ([]*models.DashboardSyncOutboxItem, error) {
+	items := make([]*models.DashboardSyncOutboxItem, 0, len(commits))
+	for _, commit := range commits {
+		item, err := commit.outboxItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// outboxCommit returns the commit of a queued item, made with the token the user last logged in with
+func outboxCommit(item *models.DashboardSyncOutboxItem) (*dashboardCommit, error) {
+	data, err := simplejson.NewJson([]byte(item.Dashboard))
+	if err != nil {
+		return nil, err
+	}
+
+	dash := models.NewDashboardFromJson(data)
+	dash.Id = item.DashboardId
+	dash.OrgId = item.OrgId
+	dash.FolderId = item.FolderId
+
+	user, err := outboxUser(item)
+	if err != nil {
+		return nil, err
+	}
+
+	dto := &SaveDashboardDTO{
+		OrgId:     item.OrgId,
+		User:      user,
+		Message:   item.Message,
+		Source:    models.DashboardSource(item.Source),
+		Dashboard: dash,
+	}
+	if item.Coauthors != "" {
+		if err := json.Unmarshal([]byte(item.Coauthors), &dto.Coauthors); err != nil {
+			return nil, err
+		}
+	}
+	if item.RequestId != "" {
+		dto.RequestMeta = &models.RequestMeta{RequestId: item.RequestId}
+	}
+	if item.Branch != "" || item.RepoId != 0 {
+		dto.GitOverride = &models.DashboardGitOverride{Branch: item.Branch, RepoId: item.RepoId}
+	}
+
+	action := social.DashboardAction(item.Action)
+	return &dashboardCommit{dashboard: dash, action: action, dto: dto, message: item.Message, record: action != social.DeleteDashboard}, nil
+}
+
+func outboxUser(item *models.DashboardSyncOutboxItem) (*models.SignedInUser, error) {
+	query := &models.GetSignedInUserQuery{UserId: item.UserId, OrgId: item.OrgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	authQuery := &models.GetAuthInfoQuery{UserId: item.UserId, AuthModule: "oauth_" + item.AuthModule}
+	if err := bus.Dispatch(authQuery); err != nil {
+		if err == models.ErrUserNotFound {
+			return nil, models.ErrDashboardGitlabToken
+		}
+		return nil, err
+	}
+
+	user := query.Result
+	user.AuthModule = item.AuthModule
+	user.Token = authQuery.Result.OAuthAccessToken
+	return user, nil
+}
+
+// syncQueue makes the queued dashboard commits. The commits made while git sync is paused, failed with the queue
+// policy or queued behind such commits are stored with the save of their dashboard in the sync outbox, so they
+// survive restarts. Saves keep being queued until all the queued commits of their organization are made, and the
+// commits of a dashboard are made in order. Each instance makes the commits it claims from the outbox: an
+// instance holds a commit for sync_queue_lease, so the instances of a HA setup do not make it twice, and the
+// commits still held by an instance that stopped are retried once their lease expired. Pausing only pauses the
+// commits of the instance.
+type syncQueue struct {
+	mu     sync.Mutex
+	log    log.Logger
+	now    func() time.Time
+	owner  string
+	paused bool
+	wake   chan struct{}
+}
+
+func newSyncQueue() *syncQueue {
+	hostname, _ := os.Hostname()
+	return &syncQueue{
+		log:   log.New("dashboard-sync-queue"),
+		now:   time.Now,
+		owner: fmt.Sprintf("%s/%s", hostname, util.GenerateShortUID()),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Now makes the queue the clock of the commits it makes
+func (q *syncQueue) Now() time.Time {
+	return q.now()
+}
+
+func (q *syncQueue) Init() error {
+	return nil
+}
+
+func (q *syncQueue) Run(ctx context.Context) error {
+	q.prune()
+
+	ticker := time.NewTicker(syncQueuePollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
+
+	for {
+		if err := q.flush(false); err != nil {
+			q.log.Warn("Failed to make queued dashboard commits", "error", err)
+		}
+
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		case <-pruneTicker.C:
+			q.prune()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *syncQueue) isPaused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// counts returns the number of queued commits by status, of all organizations when orgId is 0
+func (q *syncQueue) counts(orgId int64) (map[models.DashboardSyncOutboxStatus]int, error) {
+	query := &models.GetDashboardSyncOutboxCountsQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+	return query.Result, nil
+}
+
+// active tells whether the saves of the organization are queued instead of committed
+func (q *syncQueue) active(orgId int64) bool {
+	if q.isPaused() {
+		return true
+	}
+
+	counts, err := q.counts(orgId)
+	if err != nil {
+		q.log.Warn("Failed to count queued dashboard commits", "orgId", orgId, "error", err)
+		return false
+	}
+	return counts[models.DashboardSyncOutboxPending]+counts[models.DashboardSyncOutboxInflight] > 0
+}
+
+func (q *syncQueue) status() *GitSyncStatus {
+	status := &GitSyncStatus{Paused: q.isPaused()}
+
+	counts, err := q.counts(0)
+	if err != nil {
+		q.log.Warn("Failed to count queued dashboard commits", "error", err)
+		return status
+	}
+
+	status.QueueDepth = counts[models.DashboardSyncOutboxPending] + counts[models.DashboardSyncOutboxInflight]
+	status.Failed = counts[models.DashboardSyncOutboxFailed]
+	return status
+}
+
+// queued returns the queued commits of the organization that are not made yet
+func (q *syncQueue) queued(orgId int64) []*models.DashboardSyncOutboxItem {
+	query := &models.GetDashboardSyncOutboxQuery{
+		OrgId:    orgId,
+		Statuses: []models.DashboardSyncOutboxStatus{models.DashboardSyncOutboxPending, models.DashboardSyncOutboxInflight},
+	}
+	if err := bus.Dispatch(query); err != nil {
+		q.log.Warn("Failed to get queued dashboard commits", "orgId", orgId, "error", err)
+		return nil
+	}
+	return query.Result
+}
+
+// enqueue makes the commits a save stored in the outbox unless sync is paused, e.g. when it resumed since the
+// save started
+func (q *syncQueue) enqueue() {
+	if q.isPaused() {
+		return
+	}
+
+	if err := q.flush(false); err != nil {
+		q.log.Warn("Failed to make queued dashboard commits", "error", err)
+	}
+}
+
+// notify wakes up the worker, e.g. once failed commits are requeued
+func (q *syncQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *syncQueue) setPaused(paused bool) error {
+	q.mu.Lock()
+	q.paused = paused
+	q.mu.Unlock()
+
+	if paused {
+		return nil
+	}
+
+	return q.flush(true)
+}
+
+// flush makes the queued commits it claims in order, retrying failed commits right away with ignoreRetry. It
+// stops at the first failure, or when sync is paused again.
+func (q *syncQueue) flush(ignoreRetry bool) error {
+	for !q.isPaused() {
+		now := q.now()
+		cmd := &models.ClaimDashboardSyncOutboxItemCommand{
+			Owner:       q.owner,
+			Now:         now,
+			LeaseUntil:  now.Add(setting.DashboardSyncQueueLease),
+			IgnoreRetry: ignoreRetry,
+		}
+		if err := bus.Dispatch(cmd); err != nil {
+			return err
+		}
+		if cmd.Result == nil {
+			return nil
+		}
+
+		if err := q.make(cmd.Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// make makes the commit of a claimed item and stores its outcome. Failed commits are retried after a delay
+// doubling at each attempt, until they failed sync_queue_max_attempts times.
+func (q *syncQueue) make(item *models.DashboardSyncOutboxItem) error {
+	commit, err := outboxCommit(item)
+	if err == nil {
+		_, err = commit.commit(&dashboardServiceImpl{clock: q}, true)
+	}
+
+	cmd := &models.CompleteDashboardSyncOutboxItemCommand{Id: item.Id, Version: item.Version, Status: models.DashboardSyncOutboxDone}
+	if err != nil {
+		cmd.Status = models.DashboardSyncOutboxPending
+		cmd.Error = err.Error()
+		cmd.NextRetry = q.now().Add(syncRetryDelay(item.Attempts))
+		if maxAttempts := setting.DashboardSyncQueueMaxAttempts; maxAttempts > 0 && item.Attempts >= maxAttempts {
+			cmd.Status = models.DashboardSyncOutboxFailed
+			q.log.Error("Queued dashboard commit failed", "id", item.Id, "dashboardId", item.DashboardId, "attempts", item.Attempts, "error", err)
+		}
+	}
+
+	if completeErr := bus.Dispatch(cmd); completeErr != nil {
+		// the commit was made anyway, it is made again by the instance that claimed it since
+		q.log.Warn("Failed to complete queued dashboard commit", "id", item.Id, "error", completeErr)
+	}
+	return err
+}
+
+func syncRetryDelay(attempts int) time.Duration {
+	delay := setting.DashboardSyncQueueRetryDelay
+	for i := 1; i < attempts && delay < maxSyncRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxSyncRetryDelay {
+		return maxSyncRetryDelay
+	}
+	return delay
+}
+
+// prune deletes the commits made longer than sync_queue_retention ago
+func (q *syncQueue) prune() {
+	if setting.DashboardSyncQueueRetention <= 0 {
+		return
+	}
+
+	cmd := &models.PruneDashboardSyncOutboxCommand{DoneBefore: q.now().Add(-setting.DashboardSyncQueueRetention)}
+	if err := bus.Dispatch(cmd); err != nil {
+		q.log.Error("Failed to prune made dashboard commits", "error", err)
+		return
+	}
+
+	if cmd.DeletedRows > 0 {
+		q.log.Debug("Pruned made dashboard commits", "rows", cmd.DeletedRows)
+	}
+}
+
+// SetSyncPaused pauses or resumes the dashboard commits of all organizations. While paused, saves are stored
+// and their commits queued. Resuming makes the queued commits, and returns the error of the first one failing.
+func (dr *dashboardServiceImpl) SetSyncPaused(paused bool) (*GitSyncStatus, error) {
+	err := gitSyncQueue.setPaused(paused)
+	return gitSyncQueue.status(), err
+}
+
+// GetSyncStatus returns whether dashboard commits are paused and how many are queued
+func (dr *dashboardServiceImpl) GetSyncStatus() *GitSyncStatus {
+	return gitSyncQueue.status()
+}
+
+// GetQueuedSyncCommits returns the queued commits with any of the statuses, oldest first, of the organization
+// or of all organizations when orgId is 0
+func (dr *dashboardServiceImpl) GetQueuedSyncCommits(orgId int64, statuses []models.DashboardSyncOutboxStatus) ([]*QueuedSyncCommit, error) {
+	query := &models.GetDashboardSyncOutboxQuery{OrgId: orgId, Statuses: statuses}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	commits := make([]*QueuedSyncCommit, 0, len(query.Result))
+	for _, item := range query.Result {
+		commits = append(commits, newQueuedSyncCommit(item))
+	}
+	return commits, nil
+}
+
+// RequeueSyncCommits retries the failed or stuck queued commits of ids, or all the failed ones when ids is empty,
+// as if they were just queued. Commits are stuck once the lease of the instance making them expired. It returns how many were requeued.
+func (dr *dashboardServiceImpl) RequeueSyncCommits(ids []int64) (int64, error) {
+	cmd := &models.RequeueDashboardSyncOutboxCommand{Ids: ids, Now: dr.now()}
+	if err := bus.Dispatch(cmd); err != nil {
+		return 0, err
+	}
+
+	gitSyncQueue.notify()
+	return cmd.RequeuedRows, nil
+}
+
+// PurgeSyncCommits deletes the queued commits of ids that are not made, or all the failed ones when ids is
+// empty, so they are never made. It returns how many were deleted.
+func (dr *dashboardServiceImpl) PurgeSyncCommits(ids []int64) (int64, error) {
+	cmd := &models.PurgeDashboardSyncOutboxCommand{Ids: ids}
+	if err := bus.Dispatch(cmd); err != nil {
+		return 0, err
+	}
+	return cmd.DeletedRows, nil
+}
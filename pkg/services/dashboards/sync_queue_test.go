@@ -0,0 +1,382 @@
+package dashboards
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGitSyncPause(t *testing.T) {
+	Convey("Given git sync configured for org 1", t, func() {
+		bus.ClearBusHandlers()
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &recordingSyncConnector{}
+		social.SocialMap["gitlab"] = connector
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = &models.DashboardSaveSnapshot{}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		outbox := NewFakeSyncOutbox()
+		outbox.Register()
+
+		nextId := int64(0)
+		var saved []string
+		bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+			nextId++
+			cmd.Result = cmd.GetDashboardModel()
+			cmd.Result.Id = nextId
+			saved = append(saved, cmd.Result.Title)
+			return outbox.Insert(cmd.Result, cmd.SyncOutbox)
+		})
+
+		var syncs []*models.SaveDashboardGitSyncCommand
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			syncs = append(syncs, cmd)
+			return nil
+		})
+
+		service := &dashboardServiceImpl{}
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR, AuthModule: "gitlab", Token: "token"}
+		registerQueuedCommitUser(user)
+
+		save := func(title string) {
+			_, err := service.SaveDashboard(&SaveDashboardDTO{OrgId: 1, User: user, Dashboard: models.NewDashboard(title)})
+			So(err, ShouldBeNil)
+		}
+
+		Convey("Should commit before saving when sync is not paused", func() {
+			save("Dash")
+			So(connector.committed, ShouldResemble, []string{"Dash"})
+			So(len(syncs), ShouldEqual, 1)
+			So(service.GetSyncStatus(), ShouldResemble, &GitSyncStatus{})
+		})
+
+		Convey("When sync is paused", func() {
+			status, err := service.SetSyncPaused(true)
+			So(err, ShouldBeNil)
+			So(status, ShouldResemble, &GitSyncStatus{Paused: true})
+
+			save("First")
+			save("Second")
+
+			Convey("Should save the dashboards and queue their commits", func() {
+				So(saved, ShouldResemble, []string{"First", "Second"})
+				So(connector.committed, ShouldBeEmpty)
+				So(syncs, ShouldBeEmpty)
+				So(service.GetSyncStatus(), ShouldResemble, &GitSyncStatus{Paused: true, QueueDepth: 2})
+			})
+
+			Convey("Should make the queued commits in order when resuming", func() {
+				status, err := service.SetSyncPaused(false)
+				So(err, ShouldBeNil)
+				So(status, ShouldResemble, &GitSyncStatus{})
+
+				So(connector.committed, ShouldResemble, []string{"First", "Second"})
+				So(len(syncs), ShouldEqual, 2)
+				So(syncs[0].DashboardId, ShouldEqual, 1)
+				So(syncs[1].DashboardId, ShouldEqual, 2)
+				So(syncs[1].FilePath, ShouldEqual, "General/second.json")
+			})
+
+			Convey("Should keep the commits queued when the provider still fails", func() {
+				connector.err = errors.New("maintenance")
+
+				status, err := service.SetSyncPaused(false)
+				So(err, ShouldEqual, connector.err)
+				So(status, ShouldResemble, &GitSyncStatus{QueueDepth: 2})
+
+				// saves are queued behind the pending commits
+				save("Third")
+				So(service.GetSyncStatus().QueueDepth, ShouldEqual, 3)
+
+				connector.err = nil
+				_, err = service.SetSyncPaused(false)
+				So(err, ShouldBeNil)
+				So(connector.committed, ShouldResemble, []string{"First", "Second", "Third"})
+				So(service.GetSyncStatus(), ShouldResemble, &GitSyncStatus{})
+			})
+		})
+
+		Reset(func() {
+			gitSyncQueue = newSyncQueue()
+			guardian.New = origNewDashboardGuardian
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+func TestGitSyncQueueOutbox(t *testing.T) {
+	Convey("Given commits queued in the sync outbox", t, func() {
+		bus.ClearBusHandlers()
+
+		origConnector, hadConnector := social.SocialMap["gitlab"]
+		connector := &countingSyncConnector{commits: make(map[string]int)}
+		social.SocialMap["gitlab"] = connector
+
+		origLease, origRetryDelay, origMaxAttempts := setting.DashboardSyncQueueLease, setting.DashboardSyncQueueRetryDelay, setting.DashboardSyncQueueMaxAttempts
+		setting.DashboardSyncQueueLease = 5 * time.Minute
+		setting.DashboardSyncQueueRetryDelay = time.Minute
+		setting.DashboardSyncQueueMaxAttempts = 3
+
+		outbox := NewFakeSyncOutbox()
+		outbox.Register()
+
+		var syncsMu sync.Mutex
+		var syncs []*models.SaveDashboardGitSyncCommand
+		bus.AddHandler("test", func(query *models.GetDashboardGitSyncQuery) error {
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SaveDashboardGitSyncCommand) error {
+			syncsMu.Lock()
+			defer syncsMu.Unlock()
+			syncs = append(syncs, cmd)
+			return nil
+		})
+
+		user := &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR, AuthModule: "gitlab", Token: "token"}
+		registerQueuedCommitUser(user)
+
+		queueCommit := func(dashboardId int64, message string) {
+			dash := models.NewDashboard(fmt.Sprintf("Dash %d", dashboardId))
+			dash.SetId(dashboardId)
+			dash.SetUid(fmt.Sprintf("dash-%d", dashboardId))
+			dash.OrgId = 1
+			item := &models.DashboardSyncOutboxItem{Action: string(social.UpdateDashboard), Message: message, UserId: 1, AuthModule: "gitlab"}
+			So(outbox.Insert(dash, []*models.DashboardSyncOutboxItem{item}), ShouldBeNil)
+		}
+
+		// the outbox queues the commits at the current time
+		clock := &fakeClock{now: time.Now().Add(time.Minute)}
+		queue := newSyncQueue()
+		queue.now = clock.Now
+
+		Convey("Should retry the commits left inflight by a stopped instance once their lease expired", func() {
+			queueCommit(1, "Add the latency panel")
+
+			crashed := newSyncQueue()
+			claim := &models.ClaimDashboardSyncOutboxItemCommand{Owner: crashed.owner, Now: clock.now, LeaseUntil: clock.now.Add(setting.DashboardSyncQueueLease)}
+			So(bus.Dispatch(claim), ShouldBeNil)
+			So(claim.Result, ShouldNotBeNil)
+
+			So(queue.flush(false), ShouldBeNil)
+			So(connector.total(), ShouldEqual, 0)
+			So(queue.status(), ShouldResemble, &GitSyncStatus{QueueDepth: 1})
+
+			clock.now = clock.now.Add(6 * time.Minute)
+			So(queue.flush(false), ShouldBeNil)
+			So(connector.commits["Dash 1: Add the latency panel"], ShouldEqual, 1)
+			So(syncs, ShouldHaveLength, 1)
+			So(syncs[0].DashboardId, ShouldEqual, 1)
+
+			item := outbox.Item(claim.Result.Id)
+			So(item.Status, ShouldEqual, models.DashboardSyncOutboxDone)
+			So(item.Attempts, ShouldEqual, 2)
+			So(queue.status(), ShouldResemble, &GitSyncStatus{})
+		})
+
+		Convey("Should retry a failing commit with a growing delay until it fails", func() {
+			queueCommit(1, "")
+			connector.err = errors.New("maintenance")
+
+			So(queue.flush(false), ShouldEqual, connector.err)
+			item := outbox.Item(1)
+			So(item.Status, ShouldEqual, models.DashboardSyncOutboxPending)
+			So(item.Error, ShouldEqual, "maintenance")
+			So(item.NextRetry, ShouldResemble, clock.now.Add(time.Minute))
+
+			// not due yet
+			So(queue.flush(false), ShouldBeNil)
+			So(outbox.Item(1).Attempts, ShouldEqual, 1)
+
+			clock.now = clock.now.Add(time.Minute)
+			So(queue.flush(false), ShouldEqual, connector.err)
+			So(outbox.Item(1).NextRetry, ShouldResemble, clock.now.Add(2*time.Minute))
+
+			clock.now = clock.now.Add(2 * time.Minute)
+			So(queue.flush(false), ShouldEqual, connector.err)
+			So(outbox.Item(1).Status, ShouldEqual, models.DashboardSyncOutboxFailed)
+			So(queue.status(), ShouldResemble, &GitSyncStatus{Failed: 1})
+
+			Convey("Should make the commit once requeued", func() {
+				connector.err = nil
+				service := &dashboardServiceImpl{clock: clock}
+
+				commits, err := service.GetQueuedSyncCommits(1, []models.DashboardSyncOutboxStatus{models.DashboardSyncOutboxFailed})
+				So(err, ShouldBeNil)
+				So(commits, ShouldHaveLength, 1)
+				So(commits[0].Title, ShouldEqual, "Dash 1")
+				So(commits[0].Attempts, ShouldEqual, 3)
+
+				requeued, err := service.RequeueSyncCommits(nil)
+				So(err, ShouldBeNil)
+				So(requeued, ShouldEqual, 1)
+
+				So(queue.flush(false), ShouldBeNil)
+				So(connector.total(), ShouldEqual, 1)
+				So(outbox.Item(1).Status, ShouldEqual, models.DashboardSyncOutboxDone)
+			})
+
+			Convey("Should not make the commit once purged", func() {
+				purged, err := (&dashboardServiceImpl{}).PurgeSyncCommits([]int64{1})
+				So(err, ShouldBeNil)
+				So(purged, ShouldEqual, 1)
+				So(queue.status(), ShouldResemble, &GitSyncStatus{})
+			})
+		})
+
+		Convey("Should make each commit once with two instances sharing the outbox", func() {
+			for version := 1; version <= 5; version++ {
+				for dashboardId := int64(1); dashboardId <= 4; dashboardId++ {
+					queueCommit(dashboardId, fmt.Sprintf("v%d", version))
+				}
+			}
+
+			other := newSyncQueue()
+			var wg sync.WaitGroup
+			errs := make([]error, 2)
+			for i, instance := range []*syncQueue{queue, other} {
+				wg.Add(1)
+				go func(i int, instance *syncQueue) {
+					defer wg.Done()
+					errs[i] = instance.flush(false)
+				}(i, instance)
+			}
+			wg.Wait()
+
+			So(errs, ShouldResemble, []error{nil, nil})
+			So(connector.total(), ShouldEqual, 20)
+			for key, count := range connector.commits {
+				So(fmt.Sprintf("%s x%d", key, count), ShouldEqual, key+" x1")
+			}
+
+			// the commits of each dashboard are made in order
+			for dashboardId := 1; dashboardId <= 4; dashboardId++ {
+				title := fmt.Sprintf("Dash %d", dashboardId)
+				So(connector.orders[title], ShouldResemble, []string{"v1", "v2", "v3", "v4", "v5"})
+			}
+			So(queue.status(), ShouldResemble, &GitSyncStatus{})
+		})
+
+		Reset(func() {
+			setting.DashboardSyncQueueLease, setting.DashboardSyncQueueRetryDelay, setting.DashboardSyncQueueMaxAttempts = origLease, origRetryDelay, origMaxAttempts
+			if hadConnector {
+				social.SocialMap["gitlab"] = origConnector
+			} else {
+				delete(social.SocialMap, "gitlab")
+			}
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+// registerQueuedCommitUser adds the handlers returning the user and its token, the queued commits are made
+// with the token the user last logged in with
+func registerQueuedCommitUser(user *models.SignedInUser) {
+	bus.AddHandler("test", func(query *models.GetSignedInUserQuery) error {
+		if query.UserId != user.UserId {
+			return models.ErrUserNotFound
+		}
+		result := *user
+		result.AuthModule, result.Token = "", ""
+		query.Result = &result
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+		if query.UserId != user.UserId || query.AuthModule != "oauth_"+user.AuthModule {
+			return models.ErrUserNotFound
+		}
+		query.Result = &models.UserAuth{UserId: user.UserId, AuthModule: query.AuthModule, OAuthAccessToken: user.Token}
+		return nil
+	})
+}
+
+type recordingSyncConnector struct {
+	social.SocialConnector
+	committed []string
+	err       error
+}
+
+func (c *recordingSyncConnector) UpdateDashboard(options *social.UpdateDashboardOptions, token string) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	c.committed = append(c.committed, options.Title)
+	options.Result = &social.DashboardSyncResult{CommitSha: "abc123", FilePath: options.Folder + "/" + options.Name + ".json"}
+	return nil
+}
+
+// countingSyncConnector counts the commits of each dashboard and message, it is safe for concurrent use
+type countingSyncConnector struct {
+	social.SocialConnector
+	mu      sync.Mutex
+	commits map[string]int
+	orders  map[string][]string
+	err     error
+}
+
+func (c *countingSyncConnector) UpdateDashboard(options *social.UpdateDashboardOptions, token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	if c.orders == nil {
+		c.orders = make(map[string][]string)
+	}
+	c.commits[options.Title+": "+options.Message]++
+	c.orders[options.Title] = append(c.orders[options.Title], options.Message)
+	options.Result = &social.DashboardSyncResult{CommitSha: "abc123", FilePath: options.Folder + "/" + options.Name + ".json"}
+	return nil
+}
+
+func (c *countingSyncConnector) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0
+	for _, count := range c.commits {
+		total += count
+	}
+	return total
+}
@@ -0,0 +1,128 @@
+package dashboards
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// validateTemplating rejects dashboards with template variables that break rendering, such as
+// duplicate or empty names. The names are also checked when the committed template variables are normalized,
+// so the commit of a saved dashboard does not fail. Data source references are only checked when enabled
+// separately.
+func validateTemplating(dash *models.Dashboard, orgId int64) error {
+	if !(setting.DashboardValidateTemplating || setting.DashboardNormalizeTemplating) || dash.IsFolder {
+		return nil
+	}
+
+	issues := checkTemplating(dash.Data)
+
+	if setting.DashboardValidateTemplating && setting.DashboardValidateTemplatingDatasources {
+		datasourceIssues, err := checkTemplatingDatasources(dash.Data, orgId)
+		if err != nil {
+			return err
+		}
+		issues = append(issues, datasourceIssues...)
+	}
+
+	if len(issues) > 0 {
+		return models.DashboardInvalidTemplatingError{Issues: issues}
+	}
+
+	return nil
+}
+
+func templateVariables(data *simplejson.Json) []*simplejson.Json {
+	list := data.Get("templating").Get("list")
+	variables := make([]*simplejson.Json, len(list.MustArray()))
+	for i := range variables {
+		variables[i] = list.GetIndex(i)
+	}
+	return variables
+}
+
+// checkTemplating returns the variables of the dashboard with an empty or duplicate name
+func checkTemplating(data *simplejson.Json) []string {
+	issues := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for i, variable := range templateVariables(data) {
+		name := strings.TrimSpace(variable.Get("name").MustString())
+		if name == "" {
+			issues = append(issues, fmt.Sprintf("variable %d has no name", i))
+			continue
+		}
+
+		if seen[name] {
+			issues = append(issues, fmt.Sprintf("variable %s is defined more than once", name))
+		}
+		seen[name] = true
+	}
+
+	return issues
+}
+
+// normalizeTemplating makes the template variables of the json committed to git independent of how the
+// dashboard was edited. Query variables refreshed on load or on time range change get their current selection
+// and options from the data source, so both are removed. With sort_template_variables the variables are sorted
+// by name. Variables with empty or duplicate names are rejected.
+func normalizeTemplating(data *simplejson.Json) error {
+	if issues := checkTemplating(data); len(issues) > 0 {
+		return models.DashboardInvalidTemplatingError{Issues: issues}
+	}
+
+	variables := templateVariables(data)
+	if len(variables) == 0 {
+		return nil
+	}
+
+	for _, variable := range variables {
+		if variable.Get("type").MustString() == "query" && variable.Get("refresh").MustInt() != 0 {
+			variable.Del("current")
+			variable.Del("options")
+		}
+	}
+
+	if setting.DashboardSortTemplateVariables {
+		sort.SliceStable(variables, func(i, j int) bool {
+			return strings.TrimSpace(variables[i].Get("name").MustString()) < strings.TrimSpace(variables[j].Get("name").MustString())
+		})
+	}
+
+	list := make([]interface{}, len(variables))
+	for i, variable := range variables {
+		list[i] = variable.Interface()
+	}
+	data.Get("templating").Set("list", list)
+
+	return nil
+}
+
+// checkTemplatingDatasources returns the query variables of the dashboard using a data source that does
+// not exist in the organization. The default data source and references to other variables are skipped.
+func checkTemplatingDatasources(data *simplejson.Json, orgId int64) ([]string, error) {
+	issues := make([]string, 0)
+
+	for _, variable := range templateVariables(data) {
+		name := variable.Get("datasource").MustString()
+		if name == "" || name == "default" || strings.HasPrefix(name, "$") {
+			continue
+		}
+
+		query := &models.GetDataSourceByNameQuery{Name: name, OrgId: orgId}
+		if err := bus.Dispatch(query); err != nil {
+			if err == models.ErrDataSourceNotFound {
+				issues = append(issues, fmt.Sprintf("variable %s uses unknown data source %s", variable.Get("name").MustString(), name))
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,177 @@
+package dashboards
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardTemplating(t *testing.T) {
+	Convey("Given dashboard template variable validation", t, func() {
+		origValidate := setting.DashboardValidateTemplating
+		origDatasources := setting.DashboardValidateTemplatingDatasources
+		setting.DashboardValidateTemplating = true
+
+		bus.AddHandler("test", func(query *models.GetDataSourceByNameQuery) error {
+			if query.Name != "Prometheus" || query.OrgId != 1 {
+				return models.ErrDataSourceNotFound
+			}
+			query.Result = &models.DataSource{Name: "Prometheus", OrgId: 1}
+			return nil
+		})
+
+		dashboard := func(variables ...map[string]interface{}) *models.Dashboard {
+			list := make([]interface{}, len(variables))
+			for i, v := range variables {
+				list[i] = v
+			}
+			return models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+				"title":      "Dash",
+				"templating": map[string]interface{}{"list": list},
+			}))
+		}
+
+		Convey("Should accept unique variable names", func() {
+			dash := dashboard(
+				map[string]interface{}{"name": "env", "type": "custom"},
+				map[string]interface{}{"name": "host", "type": "query", "datasource": "Unknown"},
+			)
+			So(validateTemplating(dash, 1), ShouldBeNil)
+		})
+
+		Convey("Should accept dashboards without templating", func() {
+			dash := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{"title": "Dash"}))
+			So(validateTemplating(dash, 1), ShouldBeNil)
+		})
+
+		Convey("Should report empty and duplicate names", func() {
+			dash := dashboard(
+				map[string]interface{}{"name": "env"},
+				map[string]interface{}{"name": " "},
+				map[string]interface{}{"name": "env"},
+			)
+
+			err := validateTemplating(dash, 1)
+			So(err, ShouldResemble, models.DashboardInvalidTemplatingError{Issues: []string{
+				"variable 1 has no name",
+				"variable env is defined more than once",
+			}})
+		})
+
+		Convey("Should not validate when disabled", func() {
+			setting.DashboardValidateTemplating = false
+			So(validateTemplating(dashboard(map[string]interface{}{"name": ""}), 1), ShouldBeNil)
+		})
+
+		Convey("With data source validation", func() {
+			setting.DashboardValidateTemplatingDatasources = true
+
+			Convey("Should report unknown data sources", func() {
+				dash := dashboard(
+					map[string]interface{}{"name": "host", "type": "query", "datasource": "Prometheus"},
+					map[string]interface{}{"name": "pod", "type": "query", "datasource": "Graphite"},
+					map[string]interface{}{"name": "ds", "type": "datasource", "query": "prometheus"},
+					map[string]interface{}{"name": "job", "type": "query", "datasource": "$ds"},
+					map[string]interface{}{"name": "env", "type": "query", "datasource": nil},
+				)
+
+				err := validateTemplating(dash, 1)
+				So(err, ShouldResemble, models.DashboardInvalidTemplatingError{Issues: []string{
+					"variable pod uses unknown data source Graphite",
+				}})
+			})
+
+			Convey("Should look up data sources in the organization of the dashboard", func() {
+				dash := dashboard(map[string]interface{}{"name": "host", "type": "query", "datasource": "Prometheus"})
+				So(validateTemplating(dash, 2), ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			setting.DashboardValidateTemplating = origValidate
+			setting.DashboardValidateTemplatingDatasources = origDatasources
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+func TestNormalizeTemplating(t *testing.T) {
+	Convey("Given normalized template variables", t, func() {
+		origNormalize := setting.DashboardNormalizeTemplating
+		origSort := setting.DashboardSortTemplateVariables
+		setting.DashboardNormalizeTemplating = true
+
+		input, err := ioutil.ReadFile("testdata/templating-normalize.json")
+		So(err, ShouldBeNil)
+
+		data, err := simplejson.NewJson(input)
+		So(err, ShouldBeNil)
+		dash := models.NewDashboardFromJson(data)
+
+		committed := func() string {
+			content, err := syncedDashboardJson(dash)
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		golden := func(name string) string {
+			content, err := ioutil.ReadFile("testdata/" + name)
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		Convey("Should commit the variables without their transient fields", func() {
+			So(committed(), ShouldEqual, golden("templating-normalize.golden.json"))
+		})
+
+		Convey("Should commit the variables sorted by name", func() {
+			setting.DashboardSortTemplateVariables = true
+			So(committed(), ShouldEqual, golden("templating-normalize-sorted.golden.json"))
+		})
+
+		Convey("Should leave the saved dashboard as is", func() {
+			setting.DashboardSortTemplateVariables = true
+			committed()
+
+			variables := templateVariables(dash.Data)
+			So(variables[0].Get("name").MustString(), ShouldEqual, "pod")
+			So(variables[0].Get("options").MustArray(), ShouldHaveLength, 2)
+		})
+
+		Convey("Should commit the same json however the variables were edited", func() {
+			setting.DashboardSortTemplateVariables = true
+			before := committed()
+
+			pod := templateVariables(dash.Data)[0]
+			pod.Set("current", map[string]interface{}{"text": "api-5c2a", "value": "api-5c2a"})
+			list := dash.Data.Get("templating").Get("list").MustArray()
+			dash.Data.Get("templating").Set("list", append(list[1:], list[0]))
+
+			So(committed(), ShouldEqual, before)
+		})
+
+		Convey("Should reject duplicate variable names", func() {
+			list := dash.Data.Get("templating").Get("list").MustArray()
+			dash.Data.Get("templating").Set("list", append(list, map[string]interface{}{"name": "env", "type": "constant"}))
+
+			_, err := syncedDashboardJson(dash)
+			So(err, ShouldResemble, models.DashboardInvalidTemplatingError{Issues: []string{"variable env is defined more than once"}})
+			So(validateTemplating(dash, 1), ShouldResemble, err)
+		})
+
+		Convey("Should commit the dashboard as is when disabled", func() {
+			setting.DashboardNormalizeTemplating = false
+			So(committed(), ShouldContainSubstring, "api-7d9f")
+		})
+
+		Reset(func() {
+			setting.DashboardNormalizeTemplating = origNormalize
+			setting.DashboardSortTemplateVariables = origSort
+		})
+	})
+}
@@ -0,0 +1,7 @@
+{
+  graph(id, title):: {
+    id: id,
+    type: 'graph',
+    title: title,
+  },
+}
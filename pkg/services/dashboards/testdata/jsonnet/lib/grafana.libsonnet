@@ -0,0 +1,8 @@
+{
+  dashboard(title):: {
+    title: title,
+    editable: true,
+    schemaVersion: 21,
+    panels: [],
+  },
+}
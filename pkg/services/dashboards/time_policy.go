@@ -0,0 +1,271 @@
+package dashboards
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/gtime"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const (
+	TimePolicyClamp  = "clamp"
+	TimePolicyReject = "reject"
+)
+
+// timePolicy is the time policy of an organization with its intervals parsed
+type timePolicy struct {
+	settings     *setting.DashboardTimePolicySettings
+	minRefresh   time.Duration
+	allowed      []time.Duration
+	maxTimeRange time.Duration
+}
+
+// timePolicyViolation is a setting of a dashboard breaking the time policy, with the change following it
+type timePolicyViolation struct {
+	// problem is the reason of the rejected save
+	problem string
+	// change is the warning of the clamped save
+	change string
+	clamp  func()
+}
+
+// orgTimePolicy returns the time policy of the organization, or nil if it has none
+func orgTimePolicy(orgId int64) *setting.DashboardTimePolicySettings {
+	for _, policy := range setting.DashboardTimePolicies {
+		if policy.OrgId == orgId {
+			return policy
+		}
+	}
+	return nil
+}
+
+// applyTimePolicy enforces the time policy of the organization on the refresh interval and the default time
+// range of the dashboard. In reject mode violations fail the save with DashboardTimeSettingsError. In clamp
+// mode, and always for provisioned dashboards so provisioning keeps working, the dashboard is changed to follow
+// the policy and each change is returned as a warning of the save.
+func (dr *dashboardServiceImpl) applyTimePolicy(dto *SaveDashboardDTO) error {
+	dash := dto.Dashboard
+	settings := orgTimePolicy(dto.OrgId)
+	if settings == nil || dash.IsFolder {
+		return nil
+	}
+
+	policy, err := parseTimePolicy(settings)
+	if err != nil {
+		return err
+	}
+
+	violations := policy.check(dash.Data, dr.now())
+	if len(violations) == 0 {
+		return nil
+	}
+
+	if settings.Mode == TimePolicyReject && dto.Source != models.DashboardSourceProvisioning {
+		problems := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			problems = append(problems, violation.problem)
+		}
+		return models.DashboardTimeSettingsError{Reason: strings.Join(problems, ", ")}
+	}
+
+	for _, violation := range violations {
+		violation.clamp()
+		dr.log.Info("Dashboard changed to follow the time policy", "dashboard", dash.Title, "uid", dash.Uid, "change", violation.change)
+		dto.AddWarning(WarningTimePolicy, "%s", violation.change)
+	}
+
+	return nil
+}
+
+func parseTimePolicy(settings *setting.DashboardTimePolicySettings) (*timePolicy, error) {
+	policy := &timePolicy{settings: settings}
+
+	parse := func(key string, value string) (time.Duration, error) {
+		if value == "" {
+			return 0, nil
+		}
+
+		interval, err := gtime.ParseInterval(value)
+		if err != nil || interval <= 0 {
+			return 0, fmt.Errorf("invalid %s %q in the time policy of organization %d", key, value, settings.OrgId)
+		}
+		return interval, nil
+	}
+
+	var err error
+	if policy.minRefresh, err = parse("min_refresh_interval", settings.MinRefreshInterval); err != nil {
+		return nil, err
+	}
+
+	if policy.maxTimeRange, err = parse("max_time_range", settings.MaxTimeRange); err != nil {
+		return nil, err
+	}
+
+	for _, value := range settings.AllowedRefreshIntervals {
+		interval, err := parse("allowed_refresh_intervals", value)
+		if err != nil {
+			return nil, err
+		}
+		policy.allowed = append(policy.allowed, interval)
+	}
+
+	return policy, nil
+}
+
+func (p *timePolicy) check(data *simplejson.Json, now time.Time) []*timePolicyViolation {
+	violations := make([]*timePolicyViolation, 0)
+
+	if violation := p.checkRefresh(data); violation != nil {
+		violations = append(violations, violation)
+	}
+
+	if violation := p.checkTimeRange(data, now); violation != nil {
+		violations = append(violations, violation)
+	}
+
+	return violations
+}
+
+func (p *timePolicy) checkRefresh(data *simplejson.Json) *timePolicyViolation {
+	if p.minRefresh == 0 && len(p.allowed) == 0 {
+		return nil
+	}
+
+	// refresh is false or an empty string when auto refresh is off
+	refresh, err := data.Get("refresh").String()
+	if err != nil || refresh == "" {
+		return nil
+	}
+
+	interval, err := gtime.ParseInterval(refresh)
+	if err != nil || interval < 0 {
+		interval = 0
+	}
+
+	var problem string
+	switch {
+	case interval == 0:
+		problem = fmt.Sprintf("refresh interval %s is invalid", refresh)
+	case interval < p.minRefresh:
+		problem = fmt.Sprintf("refresh interval %s is below the minimum of %s", refresh, p.settings.MinRefreshInterval)
+	case len(p.allowed) > 0 && !p.isAllowed(interval):
+		problem = fmt.Sprintf("refresh interval %s is not one of %s", refresh, strings.Join(p.settings.AllowedRefreshIntervals, ", "))
+	default:
+		return nil
+	}
+
+	clamped := p.clampRefresh(interval)
+	return &timePolicyViolation{
+		problem: problem,
+		change:  fmt.Sprintf("refresh interval %s was changed to %s", refresh, clamped),
+		clamp:   func() { data.Set("refresh", clamped) },
+	}
+}
+
+func (p *timePolicy) isAllowed(interval time.Duration) bool {
+	for _, allowed := range p.allowed {
+		if allowed == interval {
+			return true
+		}
+	}
+	return false
+}
+
+// clampRefresh returns the closest interval following the policy, the shortest allowed interval not below
+// the interval and the minimum, or the longest allowed interval if they are all shorter
+func (p *timePolicy) clampRefresh(interval time.Duration) string {
+	if len(p.allowed) == 0 {
+		return p.settings.MinRefreshInterval
+	}
+
+	floor := interval
+	if floor < p.minRefresh {
+		floor = p.minRefresh
+	}
+
+	closest, longest := -1, 0
+	for i, allowed := range p.allowed {
+		if allowed >= floor && (closest == -1 || allowed < p.allowed[closest]) {
+			closest = i
+		}
+		if allowed > p.allowed[longest] {
+			longest = i
+		}
+	}
+
+	if closest == -1 {
+		closest = longest
+	}
+	return p.settings.AllowedRefreshIntervals[closest]
+}
+
+// checkTimeRange checks the length of the default time range. Time ranges that cannot be parsed are left to
+// the time settings validation.
+func (p *timePolicy) checkTimeRange(data *simplejson.Json, now time.Time) *timePolicyViolation {
+	if p.maxTimeRange == 0 {
+		return nil
+	}
+
+	timeRange, ok := data.CheckGet("time")
+	if !ok {
+		return nil
+	}
+
+	fromValue := timeRange.Get("from").MustString()
+	toValue := timeRange.Get("to").MustString()
+
+	from, err := parseDashboardTime(fromValue, now)
+	if err != nil {
+		return nil
+	}
+
+	to, err := parseDashboardTime(toValue, now)
+	if err != nil || to.Sub(from) <= p.maxTimeRange {
+		return nil
+	}
+
+	// the range keeps its end and starts the maximum before it, relative when the end is relative
+	clamped := strconv.FormatInt(to.Add(-p.maxTimeRange).UnixNano()/int64(time.Millisecond), 10)
+	if relativeTimePattern.MatchString(toValue) {
+		offset := to.Sub(now) - p.maxTimeRange
+		switch {
+		case offset < 0:
+			clamped = "now-" + formatPolicyInterval(-offset)
+		case offset > 0:
+			clamped = "now+" + formatPolicyInterval(offset)
+		default:
+			clamped = "now"
+		}
+	}
+
+	return &timePolicyViolation{
+		problem: fmt.Sprintf("time range %s to %s is longer than the maximum of %s", fromValue, toValue, p.settings.MaxTimeRange),
+		change:  fmt.Sprintf("time range from %s was changed to %s", fromValue, clamped),
+		clamp:   func() { timeRange.Set("from", clamped) },
+	}
+}
+
+// formatPolicyInterval formats the interval in the largest unit of days, hours, minutes and seconds dividing it
+func formatPolicyInterval(interval time.Duration) string {
+	units := []struct {
+		suffix   string
+		duration time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	for _, unit := range units {
+		if interval%unit.duration == 0 {
+			return fmt.Sprintf("%d%s", interval/unit.duration, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%ds", interval/time.Second)
+}
@@ -0,0 +1,172 @@
+package dashboards
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardTimePolicy(t *testing.T) {
+	Convey("Given the time policy of an organization", t, func() {
+		origPolicies := setting.DashboardTimePolicies
+
+		policy := &setting.DashboardTimePolicySettings{
+			OrgId:              1,
+			Mode:               TimePolicyClamp,
+			MinRefreshInterval: "30s",
+			MaxTimeRange:       "7d",
+		}
+		setting.DashboardTimePolicies = []*setting.DashboardTimePolicySettings{policy}
+
+		now := time.Date(2019, 8, 20, 14, 0, 0, 0, time.UTC)
+		service := &dashboardServiceImpl{log: log.New("test"), clock: &fakeClock{now: now}}
+
+		save := func(refresh interface{}, from string, to string) (*SaveDashboardDTO, error) {
+			dash := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+				"title":   "Dash",
+				"refresh": refresh,
+				"time":    map[string]interface{}{"from": from, "to": to},
+			}))
+			dto := &SaveDashboardDTO{OrgId: 1, Dashboard: dash}
+			return dto, service.applyTimePolicy(dto)
+		}
+
+		Convey("Should pass dashboards following the policy through", func() {
+			for _, refresh := range []interface{}{"30s", "1m", "1h", "", false} {
+				dto, err := save(refresh, "now-7d", "now")
+				So(err, ShouldBeNil)
+				So(dto.warnings, ShouldBeEmpty)
+				So(dto.Dashboard.Data.Get("refresh").Interface(), ShouldEqual, refresh)
+				So(dto.Dashboard.Data.GetPath("time", "from").MustString(), ShouldEqual, "now-7d")
+			}
+		})
+
+		Convey("Should pass dashboards of other organizations through", func() {
+			policy.OrgId = 2
+			dto, err := save("1s", "now-30d", "now")
+			So(err, ShouldBeNil)
+			So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "1s")
+		})
+
+		Convey("Should not apply the policy to folders", func() {
+			dash := models.NewDashboardFolder("Folder")
+			dash.Data.Set("refresh", "1s")
+			So(service.applyTimePolicy(&SaveDashboardDTO{OrgId: 1, Dashboard: dash}), ShouldBeNil)
+		})
+
+		Convey("In clamp mode", func() {
+			Convey("Should raise the refresh interval to the minimum with a warning", func() {
+				dto, err := save("1s", "now-6h", "now")
+				So(err, ShouldBeNil)
+				So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "30s")
+				So(dto.warnings, ShouldResemble, []Warning{
+					{Code: WarningTimePolicy, Message: "refresh interval 1s was changed to 30s"},
+				})
+			})
+
+			Convey("Should replace an invalid refresh interval", func() {
+				dto, err := save("often", "now-6h", "now")
+				So(err, ShouldBeNil)
+				So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "30s")
+			})
+
+			Convey("Should change the refresh interval to the closest allowed interval", func() {
+				policy.AllowedRefreshIntervals = []string{"1m", "30s", "5m"}
+
+				dto, _ := save("1s", "now-6h", "now")
+				So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "30s")
+
+				dto, _ = save("2m", "now-6h", "now")
+				So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "5m")
+
+				dto, _ = save("1h", "now-6h", "now")
+				So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "5m")
+
+				dto, _ = save("60s", "now-6h", "now")
+				So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "60s")
+				So(dto.warnings, ShouldBeEmpty)
+			})
+
+			Convey("Should shorten the time range to the maximum keeping its end", func() {
+				dto, err := save("1m", "now-30d", "now")
+				So(err, ShouldBeNil)
+				So(dto.Dashboard.Data.GetPath("time", "from").MustString(), ShouldEqual, "now-7d")
+				So(dto.Dashboard.Data.GetPath("time", "to").MustString(), ShouldEqual, "now")
+				So(dto.warnings, ShouldResemble, []Warning{
+					{Code: WarningTimePolicy, Message: "time range from now-30d was changed to now-7d"},
+				})
+
+				dto, _ = save("1m", "now-30d", "now-1d")
+				So(dto.Dashboard.Data.GetPath("time", "from").MustString(), ShouldEqual, "now-8d")
+
+				dto, _ = save("1m", "2019-07-01T00:00:00Z", "2019-08-01T00:00:00Z")
+				So(dto.Dashboard.Data.GetPath("time", "from").MustString(), ShouldEqual, "1564012800000")
+			})
+
+			Convey("Should leave time ranges that cannot be parsed to the time settings validation", func() {
+				dto, err := save("1m", "yesterday", "now")
+				So(err, ShouldBeNil)
+				So(dto.warnings, ShouldBeEmpty)
+			})
+		})
+
+		Convey("In reject mode", func() {
+			policy.Mode = TimePolicyReject
+
+			Convey("Should reject refresh intervals below the minimum", func() {
+				dto, err := save("1s", "now-6h", "now")
+				So(err, ShouldResemble, models.DashboardTimeSettingsError{Reason: "refresh interval 1s is below the minimum of 30s"})
+				So(dto.Dashboard.Data.Get("refresh").MustString(), ShouldEqual, "1s")
+			})
+
+			Convey("Should reject refresh intervals that are not allowed and invalid", func() {
+				policy.AllowedRefreshIntervals = []string{"30s", "1m"}
+
+				_, err := save("5m", "now-6h", "now")
+				So(err, ShouldResemble, models.DashboardTimeSettingsError{Reason: "refresh interval 5m is not one of 30s, 1m"})
+
+				_, err = save("1x", "now-6h", "now")
+				So(err, ShouldResemble, models.DashboardTimeSettingsError{Reason: "refresh interval 1x is invalid"})
+			})
+
+			Convey("Should report all the violations", func() {
+				_, err := save("5s", "now-30d", "now")
+				So(err, ShouldResemble, models.DashboardTimeSettingsError{
+					Reason: "refresh interval 5s is below the minimum of 30s, time range now-30d to now is longer than the maximum of 7d",
+				})
+			})
+
+			Convey("Should clamp provisioned dashboards", func() {
+				dash := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{"title": "Dash", "refresh": "1s"}))
+				dto := &SaveDashboardDTO{OrgId: 1, Dashboard: dash, Source: models.DashboardSourceProvisioning}
+
+				So(service.applyTimePolicy(dto), ShouldBeNil)
+				So(dash.Data.Get("refresh").MustString(), ShouldEqual, "30s")
+				So(dto.warnings, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("Should fail with invalid intervals in the policy", func() {
+			policy.MinRefreshInterval = "fast"
+			_, err := save("1m", "now-6h", "now")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `invalid min_refresh_interval "fast" in the time policy of organization 1`)
+		})
+
+		Reset(func() {
+			setting.DashboardTimePolicies = origPolicies
+		})
+	})
+
+	Convey("Formatting policy intervals", t, func() {
+		So(formatPolicyInterval(8*24*time.Hour), ShouldEqual, "8d")
+		So(formatPolicyInterval(36*time.Hour), ShouldEqual, "36h")
+		So(formatPolicyInterval(90*time.Minute), ShouldEqual, "90m")
+		So(formatPolicyInterval(45*time.Second), ShouldEqual, "45s")
+	})
+}
@@ -0,0 +1,120 @@
+package dashboards
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/gtime"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// matches relative times like now, now-6h or now-1d/d
+var relativeTimePattern = regexp.MustCompile(`^now(?:([+-])(\d+)([smhdwMy]))?(?:/[smhdwMy])?$`)
+
+var relativeTimeUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": time.Hour * 24,
+	"w": time.Hour * 24 * 7,
+	"M": time.Hour * 24 * 30,
+	"y": time.Hour * 24 * 365,
+}
+
+// validateTimeSettings applies the time settings policy to the dashboard. Violations are logged and
+// returned as warnings of the save in warn mode, and returned as DashboardTimeSettingsError in reject mode.
+func (dr *dashboardServiceImpl) validateTimeSettings(dto *SaveDashboardDTO) error {
+	dash := dto.Dashboard
+	if setting.DashboardTimeSettingsValidation == "off" || setting.DashboardTimeSettingsValidation == "" || dash.IsFolder {
+		return nil
+	}
+
+	problems := checkTimeSettings(dash.Data, setting.DashboardMinRefreshInterval, dr.now())
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if setting.DashboardTimeSettingsValidation == "reject" {
+		return models.DashboardTimeSettingsError{Reason: strings.Join(problems, ", ")}
+	}
+
+	for _, problem := range problems {
+		dr.log.Warn("Dashboard has invalid time settings", "dashboard", dash.Title, "uid", dash.Uid, "problem", problem)
+		dto.AddWarning(WarningTimeSettings, "%s", problem)
+	}
+
+	return nil
+}
+
+// checkTimeSettings returns the problems with the refresh interval and the time range of the dashboard
+func checkTimeSettings(data *simplejson.Json, minRefresh time.Duration, now time.Time) []string {
+	problems := make([]string, 0)
+
+	// refresh is false or an empty string when auto refresh is off
+	if refresh, err := data.Get("refresh").String(); err == nil && refresh != "" {
+		interval, err := gtime.ParseInterval(refresh)
+		if err != nil || interval <= 0 {
+			problems = append(problems, fmt.Sprintf("refresh interval %s is invalid", refresh))
+		} else if minRefresh > 0 && interval < minRefresh {
+			problems = append(problems, fmt.Sprintf("refresh interval %s is below the minimum of %s", refresh, minRefresh))
+		}
+	}
+
+	timeRange, ok := data.CheckGet("time")
+	if !ok {
+		return problems
+	}
+
+	fromValue := timeRange.Get("from").MustString()
+	toValue := timeRange.Get("to").MustString()
+
+	from, fromErr := parseDashboardTime(fromValue, now)
+	if fromErr != nil {
+		problems = append(problems, fmt.Sprintf("time range from %q is invalid", fromValue))
+	}
+
+	to, toErr := parseDashboardTime(toValue, now)
+	if toErr != nil {
+		problems = append(problems, fmt.Sprintf("time range to %q is invalid", toValue))
+	}
+
+	// rounding is ignored, e.g. the range of today is now/d to now/d
+	if fromErr == nil && toErr == nil && from.After(to) {
+		problems = append(problems, fmt.Sprintf("time range from %s is after to %s", fromValue, toValue))
+	}
+
+	return problems
+}
+
+// parseDashboardTime parses relative times, epoch milliseconds and ISO 8601 dates used in the time
+// range of dashboards. The rounding of relative times is ignored.
+func parseDashboardTime(value string, now time.Time) (time.Time, error) {
+	if match := relativeTimePattern.FindStringSubmatch(value); match != nil {
+		if match[1] == "" {
+			return now, nil
+		}
+
+		amount, err := strconv.Atoi(match[2])
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		offset := time.Duration(amount) * relativeTimeUnits[match[3]]
+		if match[1] == "-" {
+			offset = -offset
+		}
+
+		return now.Add(offset), nil
+	}
+
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, epoch*int64(time.Millisecond)), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
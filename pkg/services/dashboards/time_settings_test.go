@@ -0,0 +1,101 @@
+package dashboards
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardTimeSettings(t *testing.T) {
+	Convey("Checking dashboard time settings", t, func() {
+		now := time.Date(2019, 8, 20, 14, 0, 0, 0, time.UTC)
+
+		check := func(refresh interface{}, from string, to string) []string {
+			data := simplejson.NewFromAny(map[string]interface{}{
+				"title":   "Dash",
+				"refresh": refresh,
+				"time":    map[string]interface{}{"from": from, "to": to},
+			})
+			return checkTimeSettings(data, 5*time.Second, now)
+		}
+
+		Convey("Should accept valid settings", func() {
+			So(check("5s", "now-6h", "now"), ShouldBeEmpty)
+			So(check("1d", "now-7d", "now-1d"), ShouldBeEmpty)
+			So(check(false, "now/d", "now/d"), ShouldBeEmpty)
+			So(check("", "2019-08-19T10:00:00.000Z", "2019-08-19T12:00:00.000Z"), ShouldBeEmpty)
+			So(check("1m", "1566208800000", "now"), ShouldBeEmpty)
+		})
+
+		Convey("Should report refresh intervals below the minimum", func() {
+			So(check("1s", "now-6h", "now"), ShouldResemble, []string{"refresh interval 1s is below the minimum of 5s"})
+		})
+
+		Convey("Should report invalid refresh intervals", func() {
+			So(check("often", "now-6h", "now"), ShouldResemble, []string{"refresh interval often is invalid"})
+		})
+
+		Convey("Should report time ranges that cannot be parsed", func() {
+			So(check(false, "yesterday", "now"), ShouldResemble, []string{`time range from "yesterday" is invalid`})
+			So(check(false, "now-6h", ""), ShouldResemble, []string{`time range to "" is invalid`})
+		})
+
+		Convey("Should report time ranges ending before they start", func() {
+			So(check(false, "now", "now-1h"), ShouldResemble, []string{"time range from now is after to now-1h"})
+		})
+
+		Convey("Should not require a time range", func() {
+			data := simplejson.NewFromAny(map[string]interface{}{"refresh": "10s"})
+			So(checkTimeSettings(data, 5*time.Second, now), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given the time settings policy", t, func() {
+		origValidation := setting.DashboardTimeSettingsValidation
+		origMinRefresh := setting.DashboardMinRefreshInterval
+		setting.DashboardMinRefreshInterval = 10 * time.Second
+
+		service := &dashboardServiceImpl{log: log.New("test"), clock: &fakeClock{now: time.Now()}}
+
+		dash := models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+			"title":   "Dash",
+			"refresh": "1s",
+		}))
+		dto := &SaveDashboardDTO{Dashboard: dash}
+
+		Convey("Should not validate when disabled", func() {
+			setting.DashboardTimeSettingsValidation = "off"
+			So(service.validateTimeSettings(dto), ShouldBeNil)
+		})
+
+		Convey("Should only warn about violations in warn mode", func() {
+			setting.DashboardTimeSettingsValidation = "warn"
+			So(service.validateTimeSettings(dto), ShouldBeNil)
+			So(dto.warnings, ShouldResemble, []Warning{
+				{Code: WarningTimeSettings, Message: "refresh interval 1s is below the minimum of 10s"},
+			})
+		})
+
+		Convey("Should reject violations in reject mode", func() {
+			setting.DashboardTimeSettingsValidation = "reject"
+			err := service.validateTimeSettings(dto)
+			So(err, ShouldResemble, models.DashboardTimeSettingsError{Reason: "refresh interval 1s is below the minimum of 10s"})
+		})
+
+		Convey("Should not validate folders", func() {
+			setting.DashboardTimeSettingsValidation = "reject"
+			dash.IsFolder = true
+			So(service.validateTimeSettings(dto), ShouldBeNil)
+		})
+
+		Reset(func() {
+			setting.DashboardTimeSettingsValidation = origValidation
+			setting.DashboardMinRefreshInterval = origMinRefresh
+		})
+	})
+}
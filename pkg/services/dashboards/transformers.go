@@ -0,0 +1,252 @@
+package dashboards
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/gtime"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// TransformStage is when a transformer changes a dashboard
+type TransformStage string
+
+const (
+	// TransformOnSave changes the dashboard before it is validated and saved
+	TransformOnSave TransformStage = "save"
+	// TransformOnSync changes the json committed to git only
+	TransformOnSync TransformStage = "sync"
+)
+
+// TransformContext describes the dashboard a transformer changes
+type TransformContext struct {
+	OrgId     int64
+	Stage     TransformStage
+	Dashboard *models.Dashboard
+	// Options are the keys of the transformers section of the organization, e.g. datasource_remap
+	Options map[string]string
+}
+
+// Transformer changes the json of a dashboard in place. Returning an error aborts the save or the commit of the
+// dashboard. The title and the uid of the dashboard are not read back from the json.
+type Transformer func(data *simplejson.Json, ctx TransformContext) error
+
+// AppliedTransformer is a transformer that changed a saved dashboard
+type AppliedTransformer struct {
+	Name  string         `json:"name"`
+	Stage TransformStage `json:"stage"`
+}
+
+var registeredTransformers = map[string]Transformer{}
+
+func init() {
+	RegisterTransformer("datasource-remap", remapDatasources)
+	RegisterTransformer("refresh-bounds", enforceRefreshBounds)
+}
+
+// RegisterTransformer makes a transformer available to the organizations, usually from the init function of the
+// package implementing it. Organizations choose the transformers run at save and at sync, and their order, in the
+// [dashboards.transformers.<name>] sections of the configuration. Registering a name twice panics.
+func RegisterTransformer(name string, transformer Transformer) {
+	if _, exists := registeredTransformers[name]; exists {
+		panic(fmt.Sprintf("dashboard transformer %s registered twice", name))
+	}
+
+	registeredTransformers[name] = transformer
+}
+
+// orgTransformers returns the settings of the transformers of the organization, or nil if it has none
+func orgTransformers(orgId int64) *setting.DashboardTransformerSettings {
+	for _, transformers := range setting.DashboardTransformers {
+		if transformers.OrgId == orgId {
+			return transformers
+		}
+	}
+	return nil
+}
+
+// configuredTransformers returns the names of the transformers the organization runs at the stage, in order
+func configuredTransformers(orgId int64, stage TransformStage) []string {
+	transformers := orgTransformers(orgId)
+	if transformers == nil {
+		return nil
+	}
+
+	if stage == TransformOnSync {
+		return transformers.OnSync
+	}
+	return transformers.OnSave
+}
+
+// runTransformers runs the transformers of the organization for the stage in order, stopping at the first error,
+// and returns the transformers that ran. Errors name the failing transformer.
+func runTransformers(dash *models.Dashboard, data *simplejson.Json, orgId int64, stage TransformStage) ([]AppliedTransformer, error) {
+	applied := make([]AppliedTransformer, 0)
+
+	names := configuredTransformers(orgId, stage)
+	if len(names) == 0 {
+		return applied, nil
+	}
+
+	ctx := TransformContext{OrgId: orgId, Stage: stage, Dashboard: dash, Options: orgTransformers(orgId).Options}
+
+	for _, name := range names {
+		transformer, ok := registeredTransformers[name]
+		if !ok {
+			return nil, models.DashboardTransformError{Transformer: name, Message: "transformer is not registered"}
+		}
+
+		if err := transformer(data, ctx); err != nil {
+			return nil, models.DashboardTransformError{Transformer: name, Message: err.Error()}
+		}
+
+		applied = append(applied, AppliedTransformer{Name: name, Stage: stage})
+	}
+
+	return applied, nil
+}
+
+// syncedDashboardJson returns the json committed to git for the dashboard, changed by the sync transformers of
+// its organization, with its template variables normalized when enabled. The id of the dashboard differs between
+// instances and is never committed, while the uid must be committed as saved so the file imports back to the same
+// dashboard. The saved dashboard, including its version, is left as is.
+func syncedDashboardJson(dashboard *models.Dashboard) ([]byte, error) {
+	var data *simplejson.Json
+
+	if len(configuredTransformers(dashboard.OrgId, TransformOnSync)) == 0 && !setting.DashboardNormalizeTemplating {
+		// only properties are removed, a copy of the top level is enough
+		properties := make(map[string]interface{})
+		for key, value := range dashboard.Data.MustMap() {
+			properties[key] = value
+		}
+		data = simplejson.NewFromAny(properties)
+	} else {
+		content, err := dashboard.Data.Encode()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = simplejson.NewJson(content)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := runTransformers(dashboard, data, dashboard.OrgId, TransformOnSync); err != nil {
+			return nil, err
+		}
+
+		if setting.DashboardNormalizeTemplating && !dashboard.IsFolder {
+			if err := normalizeTemplating(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data.Del("id")
+
+	uid := data.Get("uid").MustString()
+	if uid == "" {
+		return nil, models.ErrDashboardSyncUidMissing
+	}
+	if dashboard.Uid != "" && uid != dashboard.Uid {
+		return nil, models.ErrDashboardSyncUidChanged
+	}
+
+	return json.MarshalIndent(data, "", "  ")
+}
+
+// remapDatasources replaces the data sources of the panels, queries, template variables and annotations found in
+// the datasource_remap option, a comma separated list of from:to pairs. Data sources are matched by name, and by
+// uid for references with one.
+func remapDatasources(data *simplejson.Json, ctx TransformContext) error {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(ctx.Options["datasource_remap"], ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return fmt.Errorf("invalid datasource_remap entry %q, expected from:to", pair)
+		}
+		mapping[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	if len(mapping) == 0 {
+		return nil
+	}
+
+	RangeDatasourceReferences(data, func(item *simplejson.Json) {
+		value := item.Get("datasource")
+
+		if name, err := value.String(); err == nil {
+			if to, ok := mapping[name]; ok {
+				item.Set("datasource", to)
+			}
+			return
+		}
+
+		if uid := value.Get("uid").MustString(); uid != "" {
+			if to, ok := mapping[uid]; ok {
+				value.Set("uid", to)
+			}
+		}
+	})
+
+	return nil
+}
+
+// enforceRefreshBounds sets the refresh interval of the dashboard to refresh_min when it is shorter, and to
+// refresh_max when it is longer. Dashboards without auto refresh and with an invalid interval are left as is.
+func enforceRefreshBounds(data *simplejson.Json, ctx TransformContext) error {
+	parseBound := func(key string) (time.Duration, error) {
+		value := strings.TrimSpace(ctx.Options[key])
+		if value == "" {
+			return 0, nil
+		}
+
+		interval, err := gtime.ParseInterval(value)
+		if err != nil || interval <= 0 {
+			return 0, fmt.Errorf("invalid %s %q", key, value)
+		}
+		return interval, nil
+	}
+
+	min, err := parseBound("refresh_min")
+	if err != nil {
+		return err
+	}
+
+	max, err := parseBound("refresh_max")
+	if err != nil {
+		return err
+	}
+
+	if min > 0 && max > 0 && min > max {
+		return fmt.Errorf("refresh_min %s is above refresh_max %s", ctx.Options["refresh_min"], ctx.Options["refresh_max"])
+	}
+
+	// refresh is false or an empty string when auto refresh is off
+	refresh, err := data.Get("refresh").String()
+	if err != nil || refresh == "" {
+		return nil
+	}
+
+	interval, err := gtime.ParseInterval(refresh)
+	if err != nil || interval <= 0 {
+		return nil
+	}
+
+	if min > 0 && interval < min {
+		data.Set("refresh", strings.TrimSpace(ctx.Options["refresh_min"]))
+	} else if max > 0 && interval > max {
+		data.Set("refresh", strings.TrimSpace(ctx.Options["refresh_max"]))
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardTransformers(t *testing.T) {
+	Convey("Given transformers configured for an organization", t, func() {
+		origTransformers := registeredTransformers
+		origSettings := setting.DashboardTransformers
+
+		registeredTransformers = map[string]Transformer{}
+		for name, transformer := range origTransformers {
+			registeredTransformers[name] = transformer
+		}
+
+		var ran []string
+		register := func(name string, err error) {
+			RegisterTransformer(name, func(data *simplejson.Json, ctx TransformContext) error {
+				ran = append(ran, name+":"+string(ctx.Stage))
+				data.Set(name, true)
+				return err
+			})
+		}
+
+		transformers := &setting.DashboardTransformerSettings{OrgId: 1, Options: map[string]string{}}
+		setting.DashboardTransformers = []*setting.DashboardTransformerSettings{transformers}
+
+		dash := models.NewDashboard("Dash")
+		dash.SetUid("dash")
+		dash.OrgId = 1
+
+		Convey("Should run the transformers of the stage in the configured order", func() {
+			register("footer", nil)
+			register("time-range", nil)
+			transformers.OnSave = []string{"time-range", "footer"}
+			transformers.OnSync = []string{"footer"}
+
+			applied, err := runTransformers(dash, dash.Data, 1, TransformOnSave)
+			So(err, ShouldBeNil)
+			So(ran, ShouldResemble, []string{"time-range:save", "footer:save"})
+			So(applied, ShouldResemble, []AppliedTransformer{
+				{Name: "time-range", Stage: TransformOnSave},
+				{Name: "footer", Stage: TransformOnSave},
+			})
+		})
+
+		Convey("Should not run transformers for other organizations", func() {
+			register("footer", nil)
+			transformers.OnSave = []string{"footer"}
+
+			applied, err := runTransformers(dash, dash.Data, 2, TransformOnSave)
+			So(err, ShouldBeNil)
+			So(applied, ShouldBeEmpty)
+			So(ran, ShouldBeEmpty)
+		})
+
+		Convey("Should stop at the first error and name the transformer", func() {
+			register("footer", errors.New("no text panel"))
+			register("time-range", nil)
+			transformers.OnSave = []string{"footer", "time-range"}
+
+			_, err := runTransformers(dash, dash.Data, 1, TransformOnSave)
+			So(err, ShouldResemble, models.DashboardTransformError{Transformer: "footer", Message: "no text panel"})
+			So(ran, ShouldResemble, []string{"footer:save"})
+		})
+
+		Convey("Should fail on transformers that are not registered", func() {
+			transformers.OnSave = []string{"missing"}
+
+			_, err := runTransformers(dash, dash.Data, 1, TransformOnSave)
+			So(err, ShouldResemble, models.DashboardTransformError{Transformer: "missing", Message: "transformer is not registered"})
+		})
+
+		Convey("Should not register a name twice", func() {
+			register("footer", nil)
+			So(func() { register("footer", nil) }, ShouldPanic)
+		})
+
+		Convey("Should only change the json committed to git at sync", func() {
+			register("footer", nil)
+			transformers.OnSync = []string{"footer"}
+
+			content, err := syncedDashboardJson(dash)
+			So(err, ShouldBeNil)
+
+			synced, err := simplejson.NewJson(content)
+			So(err, ShouldBeNil)
+			So(synced.Get("footer").MustBool(), ShouldBeTrue)
+			So(synced.Get("title").MustString(), ShouldEqual, "Dash")
+
+			_, changed := dash.Data.CheckGet("footer")
+			So(changed, ShouldBeFalse)
+		})
+
+		Convey("When saving a dashboard", func() {
+			bus.ClearBusHandlers()
+
+			origNewDashboardGuardian := guardian.New
+			guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+			bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+				return nil
+			})
+
+			bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+				cmd.Result = &models.ValidateDashboardBeforeSaveResult{}
+				return nil
+			})
+
+			bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+				query.Result = &models.DashboardSaveSnapshot{}
+				return nil
+			})
+
+			bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+				return nil
+			})
+
+			var saved *models.SaveDashboardCommand
+			bus.AddHandler("test", func(cmd *models.SaveDashboardCommand) error {
+				saved = cmd
+				cmd.Result = cmd.GetDashboardModel()
+				return nil
+			})
+
+			save := func() (*SaveDashboardResult, error) {
+				return NewService().SaveDashboardWithWarnings(&SaveDashboardDTO{
+					OrgId:     1,
+					Dashboard: dash,
+					User:      &models.SignedInUser{UserId: 1, OrgId: 1},
+				})
+			}
+
+			Convey("Should save the transformed dashboard and list the transformers", func() {
+				register("footer", nil)
+				transformers.OnSave = []string{"footer"}
+
+				result, err := save()
+				So(err, ShouldBeNil)
+				So(saved.Dashboard.Get("footer").MustBool(), ShouldBeTrue)
+				So(result.Transformers, ShouldResemble, []AppliedTransformer{{Name: "footer", Stage: TransformOnSave}})
+			})
+
+			Convey("Should not save when a transformer fails", func() {
+				register("footer", errors.New("no text panel"))
+				transformers.OnSave = []string{"footer"}
+
+				_, err := save()
+				So(err, ShouldResemble, models.DashboardTransformError{Transformer: "footer", Message: "no text panel"})
+				So(saved, ShouldBeNil)
+			})
+
+			Reset(func() {
+				guardian.New = origNewDashboardGuardian
+			})
+		})
+
+		Reset(func() {
+			registeredTransformers = origTransformers
+			setting.DashboardTransformers = origSettings
+		})
+	})
+}
+
+func TestRemapDatasources(t *testing.T) {
+	Convey("Given a dashboard using data sources", t, func() {
+		data, err := simplejson.NewJson([]byte(`{
+			"panels": [
+				{"datasource": "staging", "targets": [{"datasource": "staging"}, {"datasource": "logs"}]},
+				{"type": "row", "panels": [{"datasource": {"uid": "stg-uid", "type": "prometheus"}}]}
+			],
+			"rows": [{"panels": [{"datasource": "staging"}]}],
+			"templating": {"list": [{"name": "host", "datasource": "staging"}]},
+			"annotations": {"list": [{"name": "deploys", "datasource": "logs"}]}
+		}`))
+		So(err, ShouldBeNil)
+
+		remap := func(mapping string) error {
+			return remapDatasources(data, TransformContext{Options: map[string]string{"datasource_remap": mapping}})
+		}
+
+		Convey("Should replace the mapped data sources by name and uid", func() {
+			So(remap("staging:production, stg-uid:prod-uid"), ShouldBeNil)
+
+			panels := data.Get("panels")
+			So(panels.GetIndex(0).Get("datasource").MustString(), ShouldEqual, "production")
+			So(panels.GetIndex(0).Get("targets").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "production")
+			So(panels.GetIndex(0).Get("targets").GetIndex(1).Get("datasource").MustString(), ShouldEqual, "logs")
+			So(panels.GetIndex(1).Get("panels").GetIndex(0).Get("datasource").Get("uid").MustString(), ShouldEqual, "prod-uid")
+			So(data.Get("rows").GetIndex(0).Get("panels").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "production")
+			So(templateVariables(data)[0].Get("datasource").MustString(), ShouldEqual, "production")
+			So(data.Get("annotations").Get("list").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "logs")
+		})
+
+		Convey("Should reject an invalid mapping", func() {
+			So(remap("staging"), ShouldNotBeNil)
+			So(data.Get("panels").GetIndex(0).Get("datasource").MustString(), ShouldEqual, "staging")
+		})
+	})
+}
+
+func TestEnforceRefreshBounds(t *testing.T) {
+	Convey("Given refresh interval bounds", t, func() {
+		options := map[string]string{"refresh_min": "10s", "refresh_max": "1h"}
+
+		refresh := func(value interface{}) interface{} {
+			data := simplejson.NewFromAny(map[string]interface{}{"refresh": value})
+			So(enforceRefreshBounds(data, TransformContext{Options: options}), ShouldBeNil)
+			return data.Get("refresh").Interface()
+		}
+
+		Convey("Should raise shorter intervals to the minimum", func() {
+			So(refresh("5s"), ShouldEqual, "10s")
+		})
+
+		Convey("Should lower longer intervals to the maximum", func() {
+			So(refresh("1d"), ShouldEqual, "1h")
+		})
+
+		Convey("Should keep intervals within the bounds", func() {
+			So(refresh("1m"), ShouldEqual, "1m")
+		})
+
+		Convey("Should keep dashboards without auto refresh and with invalid intervals", func() {
+			So(refresh(false), ShouldEqual, false)
+			So(refresh(""), ShouldEqual, "")
+			So(refresh("soon"), ShouldEqual, "soon")
+		})
+
+		Convey("Should reject invalid bounds", func() {
+			data := simplejson.NewFromAny(map[string]interface{}{"refresh": "5s"})
+
+			options["refresh_min"] = "fast"
+			So(enforceRefreshBounds(data, TransformContext{Options: options}), ShouldNotBeNil)
+
+			options["refresh_min"] = "2h"
+			So(enforceRefreshBounds(data, TransformContext{Options: options}), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package dashboards
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// ValidateUID checks the uid of a dashboard before it is saved. Uids starting with one of the reserved
+// prefixes, compared case-insensitively so SYS- cannot stand in for sys-, are kept for provisioned
+// dashboards. An empty uid is valid unless provisioned dashboards are required to use a reserved prefix.
+func ValidateUID(uid string, isProvisioned bool) error {
+	if !util.IsValidShortUID(uid) {
+		return models.ErrDashboardInvalidUid
+	}
+
+	if len(uid) > 40 {
+		return models.ErrDashboardUidToLong
+	}
+
+	reserved := hasReservedPrefix(uid)
+
+	if reserved && !isProvisioned {
+		return models.ErrDashboardUidReserved
+	}
+
+	if !reserved && isProvisioned && setting.DashboardRequireReservedUidPrefix && len(setting.DashboardReservedUidPrefixes) > 0 {
+		return models.ErrDashboardUidNotReserved
+	}
+
+	return nil
+}
+
+func hasReservedPrefix(uid string) bool {
+	for _, prefix := range setting.DashboardReservedUidPrefixes {
+		if prefix != "" && strings.HasPrefix(strings.ToLower(uid), strings.ToLower(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
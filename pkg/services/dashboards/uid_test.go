@@ -0,0 +1,61 @@
+package dashboards
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateUID(t *testing.T) {
+	Convey("Given reserved uid prefixes", t, func() {
+		origPrefixes := setting.DashboardReservedUidPrefixes
+		origRequired := setting.DashboardRequireReservedUidPrefix
+		setting.DashboardReservedUidPrefixes = []string{"sys-", "infra-"}
+
+		testCases := []struct {
+			desc          string
+			uid           string
+			isProvisioned bool
+			required      bool
+			err           error
+		}{
+			{desc: "valid uid", uid: "abc-123_X", err: nil},
+			{desc: "empty uid", uid: "", err: nil},
+			{desc: "illegal characters", uid: "abc/123", err: models.ErrDashboardInvalidUid},
+			{desc: "illegal characters when provisioned", uid: "sys abc", isProvisioned: true, err: models.ErrDashboardInvalidUid},
+			{desc: "too long", uid: strings.Repeat("a", 41), err: models.ErrDashboardUidToLong},
+			{desc: "40 characters", uid: strings.Repeat("a", 40), err: nil},
+			{desc: "reserved prefix", uid: "sys-overview", err: models.ErrDashboardUidReserved},
+			{desc: "second reserved prefix", uid: "infra-nodes", err: models.ErrDashboardUidReserved},
+			{desc: "reserved prefix in other case", uid: "SYS-overview", err: models.ErrDashboardUidReserved},
+			{desc: "prefix not at the start", uid: "my-sys-overview", err: nil},
+			{desc: "reserved prefix when provisioned", uid: "sys-overview", isProvisioned: true, err: nil},
+			{desc: "other uid when provisioned", uid: "overview", isProvisioned: true, err: nil},
+			{desc: "other uid when provisioned and required", uid: "overview", isProvisioned: true, required: true, err: models.ErrDashboardUidNotReserved},
+			{desc: "empty uid when provisioned and required", uid: "", isProvisioned: true, required: true, err: models.ErrDashboardUidNotReserved},
+			{desc: "reserved prefix when provisioned and required", uid: "Sys-overview", isProvisioned: true, required: true, err: nil},
+			{desc: "requirement does not apply to other saves", uid: "overview", required: true, err: nil},
+		}
+
+		for _, tc := range testCases {
+			setting.DashboardRequireReservedUidPrefix = tc.required
+			So(ValidateUID(tc.uid, tc.isProvisioned), ShouldEqual, tc.err)
+		}
+
+		Convey("Should not reserve anything without prefixes", func() {
+			setting.DashboardReservedUidPrefixes = nil
+			setting.DashboardRequireReservedUidPrefix = true
+
+			So(ValidateUID("sys-overview", false), ShouldBeNil)
+			So(ValidateUID("overview", true), ShouldBeNil)
+		})
+
+		Reset(func() {
+			setting.DashboardReservedUidPrefixes = origPrefixes
+			setting.DashboardRequireReservedUidPrefix = origRequired
+		})
+	})
+}
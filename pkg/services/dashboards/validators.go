@@ -0,0 +1,123 @@
+package dashboards
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// Validator checks a dashboard before it is saved. Returning an error rejects the save, issues that should not
+// prevent it are reported with dto.AddWarning. Validators run before the alerts and the permissions are checked.
+// Registered validators must not change the dashboard.
+type Validator interface {
+	Validate(dto *SaveDashboardDTO) error
+}
+
+// ValidatorFunc adapts a function to the Validator interface
+type ValidatorFunc func(dto *SaveDashboardDTO) error
+
+func (f ValidatorFunc) Validate(dto *SaveDashboardDTO) error {
+	return f(dto)
+}
+
+// ValidatorRegistration adds a validator to the checks of every dashboard save
+type ValidatorRegistration struct {
+	// Name identifies the validator in the errors it returns
+	Name string
+	// Order places the validator in the pipeline, lower orders run first. The built-in validators use the orders
+	// 100 to 800 and run before registered validators of the same order.
+	Order     int
+	Validator Validator
+}
+
+var registeredValidators []*ValidatorRegistration
+
+// RegisterValidator adds a validator, usually from the init function of the package implementing it. Registered
+// validators with the same order run in the order they were registered. Errors other than a
+// models.DashboardValidationError are returned as one naming the validator. Registering a name twice panics.
+func RegisterValidator(registration *ValidatorRegistration) {
+	for _, existing := range registeredValidators {
+		if existing.Name == registration.Name {
+			panic(fmt.Sprintf("dashboard validator %s registered twice", registration.Name))
+		}
+	}
+
+	registeredValidators = append(registeredValidators, registration)
+}
+
+// builtinValidators are the checks of Grafana itself. Their errors are returned as is.
+func (dr *dashboardServiceImpl) builtinValidators() []*ValidatorRegistration {
+	return []*ValidatorRegistration{
+		{Name: "title", Order: 100, Validator: ValidatorFunc(validateTitle)},
+		{Name: "folder", Order: 200, Validator: ValidatorFunc(validateFolder)},
+		{Name: "uid", Order: 300, Validator: ValidatorFunc(func(dto *SaveDashboardDTO) error {
+			// folders created by provisioning get generated uids, only provisioned dashboards can be required a reserved prefix
+			isProvisioned := dto.Source == models.DashboardSourceProvisioning && !dto.Dashboard.IsFolder
+			return ValidateUID(dto.Dashboard.Uid, isProvisioned)
+		})},
+		{Name: "nesting-depth", Order: 400, Validator: ValidatorFunc(func(dto *SaveDashboardDTO) error {
+			return CheckNestingDepth(dto.Dashboard.Data)
+		})},
+		{Name: "time-settings", Order: 500, Validator: ValidatorFunc(dr.validateTimeSettings)},
+		{Name: "large-values", Order: 600, Validator: ValidatorFunc(dr.checkLargeValues)},
+		{Name: "templating", Order: 700, Validator: ValidatorFunc(func(dto *SaveDashboardDTO) error {
+			return validateTemplating(dto.Dashboard, dto.OrgId)
+		})},
+		{Name: "panel-limits", Order: 800, Validator: ValidatorFunc(func(dto *SaveDashboardDTO) error {
+			return checkPanelLimits(dto.Dashboard, dto.OrgId)
+		})},
+	}
+}
+
+// runValidators runs the built-in and the registered validators by order, stopping at the first error
+func (dr *dashboardServiceImpl) runValidators(dto *SaveDashboardDTO) error {
+	builtins := dr.builtinValidators()
+	pipeline := append(builtins, registeredValidators...)
+
+	// the sort is stable, so built-in validators stay first among the validators of the same order
+	sort.SliceStable(pipeline, func(i, j int) bool {
+		return pipeline[i].Order < pipeline[j].Order
+	})
+
+	isBuiltin := make(map[*ValidatorRegistration]bool, len(builtins))
+	for _, builtin := range builtins {
+		isBuiltin[builtin] = true
+	}
+
+	for _, registration := range pipeline {
+		err := registration.Validator.Validate(dto)
+		if err == nil {
+			continue
+		}
+
+		if _, ok := err.(models.DashboardValidationError); ok || isBuiltin[registration] {
+			return err
+		}
+		return models.DashboardValidationError{Validator: registration.Name, Message: err.Error()}
+	}
+
+	return nil
+}
+
+func validateTitle(dto *SaveDashboardDTO) error {
+	if dto.Dashboard.Title == "" {
+		return models.ErrDashboardTitleEmpty
+	}
+	return nil
+}
+
+func validateFolder(dto *SaveDashboardDTO) error {
+	dash := dto.Dashboard
+
+	if dash.IsFolder && dash.FolderId > 0 {
+		return models.ErrDashboardFolderCannotHaveParent
+	}
+
+	if dash.IsFolder && strings.EqualFold(dash.Title, models.RootFolderName) {
+		return models.ErrDashboardFolderNameExists
+	}
+
+	return nil
+}
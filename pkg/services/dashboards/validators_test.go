@@ -0,0 +1,93 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardValidators(t *testing.T) {
+	Convey("Given validators registered by extensions", t, func() {
+		registered := registeredValidators
+		service := &dashboardServiceImpl{log: log.New("test")}
+		var ran []string
+
+		register := func(name string, order int, err error) {
+			RegisterValidator(&ValidatorRegistration{
+				Name:  name,
+				Order: order,
+				Validator: ValidatorFunc(func(dto *SaveDashboardDTO) error {
+					ran = append(ran, name)
+					return err
+				}),
+			})
+		}
+
+		dto := func(title string) *SaveDashboardDTO {
+			return &SaveDashboardDTO{
+				OrgId:     1,
+				Dashboard: models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{"title": title})),
+			}
+		}
+
+		Convey("Should run them by order, then by registration", func() {
+			register("required-tags", 900, nil)
+			register("naming", 50, nil)
+			register("forbidden-datasources", 900, nil)
+
+			So(service.runValidators(dto("Dash")), ShouldBeNil)
+			So(ran, ShouldResemble, []string{"naming", "required-tags", "forbidden-datasources"})
+		})
+
+		Convey("Should run the built-in validators first among the validators of the same order", func() {
+			register("naming", 100, nil)
+
+			err := service.runValidators(dto(""))
+			So(err, ShouldEqual, models.ErrDashboardTitleEmpty)
+			So(ran, ShouldBeEmpty)
+		})
+
+		Convey("Should stop at the first error and name the validator", func() {
+			register("naming", 900, errors.New("titles must start with a team name"))
+			register("required-tags", 1000, nil)
+
+			err := service.runValidators(dto("Dash"))
+			So(err, ShouldResemble, models.DashboardValidationError{Validator: "naming", Message: "titles must start with a team name"})
+			So(ran, ShouldResemble, []string{"naming"})
+		})
+
+		Convey("Should return validation errors as is", func() {
+			register("naming", 900, models.DashboardValidationError{Validator: "team-policy", Message: "no team"})
+
+			err := service.runValidators(dto("Dash"))
+			So(err, ShouldResemble, models.DashboardValidationError{Validator: "team-policy", Message: "no team"})
+		})
+
+		Convey("Should collect the warnings of the validators", func() {
+			RegisterValidator(&ValidatorRegistration{
+				Name: "required-tags",
+				Validator: ValidatorFunc(func(dto *SaveDashboardDTO) error {
+					dto.AddWarning("required-tags", "dashboard %s has no team tag", dto.Dashboard.Title)
+					return nil
+				}),
+			})
+
+			save := dto("Dash")
+			So(service.runValidators(save), ShouldBeNil)
+			So(save.warnings, ShouldResemble, []Warning{{Code: "required-tags", Message: "dashboard Dash has no team tag"}})
+		})
+
+		Convey("Should not register a name twice", func() {
+			register("naming", 900, nil)
+			So(func() { register("naming", 1000, nil) }, ShouldPanic)
+		})
+
+		Reset(func() {
+			registeredValidators = registered
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package dashboards
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/jsoncompare"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// versionConflictMaxChanges bounds the changes returned with a version conflict, whatever the size of the
+// dashboards. The dashboards themselves are not returned.
+const versionConflictMaxChanges = 50
+
+// versionConflictIgnoredProperties always differ between a submitted dashboard and the stored one
+var versionConflictIgnoredProperties = []string{"id", "version"}
+
+// versionConflictError returns the conflict between the dashboard submitted by the client and the version stored
+// since it was loaded. ErrDashboardVersionMismatch is returned as is when the stored dashboard cannot be read.
+func versionConflictError(dash *models.Dashboard, orgId int64) error {
+	query := &models.GetDashboardQuery{Id: dash.Id, Uid: dash.Uid, OrgId: orgId}
+	if query.Id != 0 {
+		query.Uid = ""
+	}
+
+	if err := bus.Dispatch(query); err != nil {
+		return models.ErrDashboardVersionMismatch
+	}
+	current := query.Result
+
+	conflict := models.DashboardVersionConflictError{
+		CurrentVersion: current.Version,
+		UpdatedBy:      current.UpdatedBy,
+		UpdatedAt:      current.Updated,
+		Changes:        make([]string, 0),
+	}
+
+	stored, err := current.Data.Encode()
+	if err != nil {
+		return conflict
+	}
+
+	submitted, err := dash.Data.Encode()
+	if err != nil {
+		return conflict
+	}
+
+	result, err := jsoncompare.Compare(stored, submitted, versionConflictIgnoredProperties...)
+	if err != nil {
+		return conflict
+	}
+
+	conflict.Changes = result.Changes
+	if len(conflict.Changes) > versionConflictMaxChanges {
+		conflict.Changes = conflict.Changes[:versionConflictMaxChanges]
+		conflict.ChangesTruncated = true
+	}
+
+	return conflict
+}
@@ -0,0 +1,125 @@
+package dashboards
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
+)
+
+func TestDashboardVersionConflict(t *testing.T) {
+	Convey("Given a dashboard saved by someone else since it was loaded", t, func() {
+		bus.ClearBusHandlers()
+
+		origNewDashboardGuardian := guardian.New
+		guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanSaveValue: true})
+
+		updated := time.Date(2019, 8, 20, 14, 0, 0, 0, time.UTC)
+		stored := &models.Dashboard{
+			Id:        1,
+			OrgId:     1,
+			Uid:       "abc",
+			Version:   4,
+			Updated:   updated,
+			UpdatedBy: 2,
+			Data: simplejson.NewFromAny(map[string]interface{}{
+				"id":      1,
+				"uid":     "abc",
+				"title":   "Dash",
+				"version": 4,
+				"tags":    []interface{}{"prod"},
+				"panels":  []interface{}{map[string]interface{}{"id": 1, "type": "graph"}},
+			}),
+		}
+
+		var queried *models.GetDashboardQuery
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			queried = query
+			query.Result = stored
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetDashboardSaveSnapshotQuery) error {
+			query.Result = &models.DashboardSaveSnapshot{ExistingByUid: stored}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.ValidateDashboardBeforeSaveCommand) error {
+			return models.ErrDashboardVersionMismatch
+		})
+
+		service := &dashboardServiceImpl{}
+		submitted := simplejson.NewFromAny(map[string]interface{}{
+			"id":      1,
+			"uid":     "abc",
+			"title":   "Dash renamed",
+			"version": 3,
+			"panels":  []interface{}{map[string]interface{}{"id": 1, "type": "graph"}},
+		})
+		dto := &SaveDashboardDTO{
+			OrgId:     1,
+			Dashboard: models.NewDashboardFromJson(submitted),
+			User:      &models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_EDITOR},
+		}
+
+		Convey("The save should return the stored version and the changes", func() {
+			_, err := service.SaveDashboard(dto)
+			So(xerrors.Is(err, models.ErrDashboardVersionMismatch), ShouldBeTrue)
+			So(queried.Id, ShouldEqual, 1)
+
+			conflict, ok := err.(models.DashboardVersionConflictError)
+			So(ok, ShouldBeTrue)
+			So(conflict.CurrentVersion, ShouldEqual, 4)
+			So(conflict.UpdatedBy, ShouldEqual, 2)
+			So(conflict.UpdatedAt, ShouldResemble, updated)
+			So(conflict.Changes, ShouldResemble, []string{"tags removed", "title changed"})
+			So(conflict.ChangesTruncated, ShouldBeFalse)
+		})
+
+		Convey("The changes should be capped", func() {
+			for i := 0; i < versionConflictMaxChanges+10; i++ {
+				submitted.Set(fmt.Sprintf("extra%03d", i), i)
+			}
+
+			_, err := service.SaveDashboard(dto)
+			conflict, ok := err.(models.DashboardVersionConflictError)
+			So(ok, ShouldBeTrue)
+			So(conflict.Changes, ShouldHaveLength, versionConflictMaxChanges)
+			So(conflict.ChangesTruncated, ShouldBeTrue)
+		})
+
+		Convey("A dashboard found by uid should be read by uid", func() {
+			submitted.Del("id")
+			dto.Dashboard = models.NewDashboardFromJson(submitted)
+
+			_, err := service.SaveDashboard(dto)
+			So(err, ShouldHaveSameTypeAs, models.DashboardVersionConflictError{})
+			So(queried.Id, ShouldEqual, 0)
+			So(queried.Uid, ShouldEqual, "abc")
+		})
+
+		Convey("The mismatch should be returned as is when the stored dashboard cannot be read", func() {
+			bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+				return models.ErrDashboardNotFound
+			})
+
+			_, err := service.SaveDashboard(dto)
+			So(err, ShouldEqual, models.ErrDashboardVersionMismatch)
+		})
+
+		Reset(func() {
+			guardian.New = origNewDashboardGuardian
+		})
+	})
+}
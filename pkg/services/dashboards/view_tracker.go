@@ -0,0 +1,106 @@
+package dashboards
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+)
+
+// viewRecordInterval is how often the view of a dashboard is recorded at most, views in between are not
+const viewRecordInterval = time.Hour
+
+// maxTrackedViews is the number of dashboards above which the ones recorded before the interval are forgotten
+const maxTrackedViews = 10000
+
+// viewQueueSize is the number of views waiting to be written above which views are dropped
+const viewQueueSize = 1000
+
+var viewTracker = newViewTracker()
+
+func init() {
+	registry.RegisterService(viewTracker)
+}
+
+// ViewTracker records when dashboards are viewed, at most once per viewRecordInterval and dashboard so views do
+// not write to the database on each load. The views are written in the background, so they never delay the
+// view, and dropped when too many are waiting. The recorded views are kept in memory, so each instance of
+// Grafana records a view once per interval.
+type ViewTracker struct {
+	mu       sync.Mutex
+	log      log.Logger
+	now      func() time.Time
+	recorded map[int64]time.Time
+	views    chan *models.RecordDashboardViewCommand
+}
+
+func newViewTracker() *ViewTracker {
+	return &ViewTracker{
+		log:      log.New("dashboard-views"),
+		now:      time.Now,
+		recorded: make(map[int64]time.Time),
+		views:    make(chan *models.RecordDashboardViewCommand, viewQueueSize),
+	}
+}
+
+func (t *ViewTracker) Init() error {
+	return nil
+}
+
+func (t *ViewTracker) Run(ctx context.Context) error {
+	for {
+		select {
+		case cmd := <-t.views:
+			t.write(cmd)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// RecordDashboardView records that the dashboard was viewed. It never fails nor blocks the view.
+func RecordDashboardView(orgId int64, dashboardId int64) {
+	viewTracker.record(orgId, dashboardId)
+}
+
+func (t *ViewTracker) record(orgId int64, dashboardId int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if last, ok := t.recorded[dashboardId]; ok && now.Sub(last) < viewRecordInterval {
+		return
+	}
+
+	select {
+	case t.views <- &models.RecordDashboardViewCommand{OrgId: orgId, DashboardId: dashboardId, ViewedAt: now}:
+		t.prune(now)
+		t.recorded[dashboardId] = now
+	default:
+		t.log.Warn("Dropped dashboard view, too many views are waiting to be recorded", "orgId", orgId, "dashboardId", dashboardId)
+	}
+}
+
+// write stores the view, a failed write is not retried before the next interval
+func (t *ViewTracker) write(cmd *models.RecordDashboardViewCommand) {
+	if err := bus.Dispatch(cmd); err != nil {
+		t.log.Warn("Failed to record dashboard view", "orgId", cmd.OrgId, "dashboardId", cmd.DashboardId, "error", err)
+	}
+}
+
+// prune forgets the views recorded before the interval once too many dashboards are tracked
+func (t *ViewTracker) prune(now time.Time) {
+	if len(t.recorded) < maxTrackedViews {
+		return
+	}
+
+	for dashboardId, last := range t.recorded {
+		if now.Sub(last) >= viewRecordInterval {
+			delete(t.recorded, dashboardId)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package dashboards
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardViewTracker(t *testing.T) {
+	Convey("Given the dashboard view tracker", t, func() {
+		bus.ClearBusHandlers()
+
+		clock := &fakeClock{now: time.Date(2019, 9, 10, 9, 0, 0, 0, time.UTC)}
+		viewTracker = newViewTracker()
+		viewTracker.now = clock.Now
+
+		recorded := make([]*models.RecordDashboardViewCommand, 0)
+		var recordErr error
+		bus.AddHandler("test", func(cmd *models.RecordDashboardViewCommand) error {
+			recorded = append(recorded, cmd)
+			return recordErr
+		})
+
+		// writes the waiting views like the background service
+		flush := func() {
+			for len(viewTracker.views) > 0 {
+				viewTracker.write(<-viewTracker.views)
+			}
+		}
+
+		Convey("Should record the first view of a dashboard", func() {
+			RecordDashboardView(1, 10)
+			flush()
+
+			So(recorded, ShouldHaveLength, 1)
+			So(recorded[0], ShouldResemble, &models.RecordDashboardViewCommand{OrgId: 1, DashboardId: 10, ViewedAt: clock.now})
+		})
+
+		Convey("Should record the views of a dashboard once an hour", func() {
+			RecordDashboardView(1, 10)
+			clock.now = clock.now.Add(59 * time.Minute)
+			RecordDashboardView(1, 10)
+			flush()
+			So(recorded, ShouldHaveLength, 1)
+
+			clock.now = clock.now.Add(time.Minute)
+			RecordDashboardView(1, 10)
+			flush()
+			So(recorded, ShouldHaveLength, 2)
+			So(recorded[1].ViewedAt, ShouldEqual, clock.now)
+		})
+
+		Convey("Should record the views of each dashboard apart", func() {
+			RecordDashboardView(1, 10)
+			RecordDashboardView(1, 11)
+			RecordDashboardView(1, 10)
+			flush()
+
+			So(recorded, ShouldHaveLength, 2)
+			So(recorded[1].DashboardId, ShouldEqual, 11)
+		})
+
+		Convey("Should not retry a failed view before the hour", func() {
+			recordErr = errors.New("database is locked")
+
+			RecordDashboardView(1, 10)
+			flush()
+			RecordDashboardView(1, 10)
+			flush()
+			So(recorded, ShouldHaveLength, 1)
+		})
+
+		Convey("When too many views are waiting", func() {
+			for id := int64(1); id <= viewQueueSize; id++ {
+				RecordDashboardView(1, id)
+			}
+
+			Convey("Should drop the view without blocking and record it on the next view", func() {
+				RecordDashboardView(1, viewQueueSize+1)
+				So(viewTracker.recorded, ShouldNotContainKey, viewQueueSize+1)
+
+				flush()
+				RecordDashboardView(1, viewQueueSize+1)
+				flush()
+				So(recorded, ShouldHaveLength, viewQueueSize+1)
+			})
+		})
+
+		Convey("Should forget the views recorded before the hour once too many dashboards are tracked", func() {
+			for id := int64(1); id < maxTrackedViews; id++ {
+				viewTracker.recorded[id] = clock.now.Add(-time.Hour)
+			}
+			viewTracker.recorded[maxTrackedViews] = clock.now
+
+			RecordDashboardView(1, maxTrackedViews+1)
+			So(viewTracker.recorded, ShouldHaveLength, 2)
+		})
+
+		Reset(func() {
+			viewTracker = newViewTracker()
+			bus.ClearBusHandlers()
+		})
+	})
+}
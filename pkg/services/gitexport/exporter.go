@@ -0,0 +1,260 @@
+package gitexport
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+)
+
+func init() {
+	registry.RegisterService(&ResourceExporter{})
+}
+
+var getGitProvider = social.GetGitProvider
+
+// ResourceExporter commits data sources, notification channels and permissions to the git repository of the
+// organization when they change. It is enabled per repository, independently of dashboard sync.
+type ResourceExporter struct {
+	log log.Logger
+}
+
+func (e *ResourceExporter) Init() error {
+	e.log = log.New("gitexport")
+
+	bus.AddEventListener(e.dataSourceCreated)
+	bus.AddEventListener(e.dataSourceUpdated)
+	bus.AddEventListener(e.dataSourceDeleted)
+	bus.AddEventListener(e.notifierCreated)
+	bus.AddEventListener(e.notifierUpdated)
+	bus.AddEventListener(e.notifierDeleted)
+	bus.AddEventListener(e.dashboardAclUpdated)
+	bus.AddEventListener(e.dashboardDeleted)
+
+	return nil
+}
+
+// Export failures are logged rather than returned, the change is already saved and
+// an error would stop the event from reaching the other listeners.
+
+func (e *ResourceExporter) dataSourceCreated(event *events.DataSourceCreated) error {
+	e.logError(e.exportDataSource(event.OrgId, event.Id, ""), "datasource", event.Name)
+	return nil
+}
+
+func (e *ResourceExporter) dataSourceUpdated(event *events.DataSourceUpdated) error {
+	e.logError(e.exportDataSource(event.OrgId, event.Id, event.PreviousName), "datasource", event.Name)
+	return nil
+}
+
+func (e *ResourceExporter) dataSourceDeleted(event *events.DataSourceDeleted) error {
+	provider := dataSourceProvider(event.OrgId)
+	if provider == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("Delete %s datasource", event.Name)
+	err := provider.DeleteFile(event.OrgId, dataSourceFilePath(event.Name, event.Id), message)
+	e.logError(err, "datasource", event.Name)
+	return nil
+}
+
+func (e *ResourceExporter) notifierCreated(event *events.AlertNotificationCreated) error {
+	e.logError(e.exportNotifier(event.OrgId, event.Id, ""), "notifier", event.Name)
+	return nil
+}
+
+func (e *ResourceExporter) notifierUpdated(event *events.AlertNotificationUpdated) error {
+	e.logError(e.exportNotifier(event.OrgId, event.Id, event.PreviousName), "notifier", event.Name)
+	return nil
+}
+
+func (e *ResourceExporter) notifierDeleted(event *events.AlertNotificationDeleted) error {
+	provider := notifierProvider(event.OrgId)
+	if provider == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("Delete %s notifier", event.Name)
+	err := provider.DeleteFile(event.OrgId, notifierFilePath(event.Name, event.Id), message)
+	e.logError(err, "notifier", event.Name)
+	return nil
+}
+
+func (e *ResourceExporter) dashboardAclUpdated(event *events.DashboardAclUpdated) error {
+	e.logError(e.exportPermissions(event), "permissions", fmt.Sprintf("dashboard %d", event.DashboardId))
+	return nil
+}
+
+// dashboardDeleted removes the permissions file of a deleted folder, the files of its dashboards are removed by
+// dashboard sync
+func (e *ResourceExporter) dashboardDeleted(event *events.DashboardDeleted) error {
+	if !event.IsFolder {
+		return nil
+	}
+
+	provider := getGitProvider(event.OrgId)
+	if provider == nil {
+		return nil
+	}
+
+	settings := provider.ExportSettings(event.OrgId)
+	if settings == nil || !settings.Permissions {
+		return nil
+	}
+
+	message := fmt.Sprintf("Delete permissions of removed folder %s", event.Title)
+	err := provider.DeleteFile(event.OrgId, permissionsFilePath(settings.DashboardsPath, event.Title), message)
+	e.logError(err, "permissions", event.Title)
+	return nil
+}
+
+// exportPermissions writes the permissions file of the folder of the dashboard, or of the folder itself, or
+// deletes it when no permissions are set on the folder and its dashboards anymore.
+func (e *ResourceExporter) exportPermissions(event *events.DashboardAclUpdated) error {
+	provider := getGitProvider(event.OrgId)
+	if provider == nil {
+		return nil
+	}
+
+	settings := provider.ExportSettings(event.OrgId)
+	if settings == nil || !settings.Permissions {
+		return nil
+	}
+
+	query := &models.GetDashboardQuery{Id: event.DashboardId, OrgId: event.OrgId}
+	if err := bus.Dispatch(query); err != nil {
+		return err
+	}
+
+	dash := query.Result
+	folderId, folder := dash.Id, dash.Title
+	if !dash.IsFolder {
+		folderId, folder = dash.FolderId, models.RootFolderName
+		if dash.FolderId > 0 {
+			folderQuery := &models.GetDashboardQuery{Id: dash.FolderId, OrgId: event.OrgId}
+			if err := bus.Dispatch(folderQuery); err != nil {
+				return err
+			}
+			folder = folderQuery.Result.Title
+		}
+	}
+
+	aclQuery := &models.GetFolderAclListQuery{FolderId: folderId, OrgId: event.OrgId}
+	if err := bus.Dispatch(aclQuery); err != nil {
+		return err
+	}
+
+	filePath := permissionsFilePath(settings.DashboardsPath, folder)
+	message := permissionsCommitMessage(dash.Title, event)
+
+	if len(aclQuery.Result) == 0 {
+		return provider.DeleteFile(event.OrgId, filePath, message)
+	}
+
+	content, err := permissionsToYaml(folder, aclQuery.Result, settings.PermissionEmails)
+	if err != nil {
+		return err
+	}
+
+	return provider.WriteFile(event.OrgId, filePath, content, message)
+}
+
+func (e *ResourceExporter) exportDataSource(orgId int64, id int64, previousName string) error {
+	provider := dataSourceProvider(orgId)
+	if provider == nil {
+		return nil
+	}
+
+	query := &models.GetDataSourceByIdQuery{Id: id, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return err
+	}
+
+	content, err := dataSourceToYaml(query.Result)
+	if err != nil {
+		return err
+	}
+
+	ds := query.Result
+	filePath := dataSourceFilePath(ds.Name, ds.Id)
+	if err := provider.WriteFile(orgId, filePath, content, fmt.Sprintf("Update %s datasource", ds.Name)); err != nil {
+		return err
+	}
+
+	if previousName == "" {
+		return nil
+	}
+
+	if previousPath := dataSourceFilePath(previousName, ds.Id); previousPath != filePath {
+		return provider.DeleteFile(orgId, previousPath, fmt.Sprintf("Rename %s datasource to %s", previousName, ds.Name))
+	}
+
+	return nil
+}
+
+func (e *ResourceExporter) exportNotifier(orgId int64, id int64, previousName string) error {
+	provider := notifierProvider(orgId)
+	if provider == nil {
+		return nil
+	}
+
+	query := &models.GetAlertNotificationsQuery{Id: id, OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		return err
+	}
+
+	if query.Result == nil {
+		// deleted in the meantime, the delete event removes the file
+		return nil
+	}
+
+	content, err := notifierToYaml(query.Result)
+	if err != nil {
+		return err
+	}
+
+	notification := query.Result
+	filePath := notifierFilePath(notification.Name, notification.Id)
+	if err := provider.WriteFile(orgId, filePath, content, fmt.Sprintf("Update %s notifier", notification.Name)); err != nil {
+		return err
+	}
+
+	if previousName == "" {
+		return nil
+	}
+
+	if previousPath := notifierFilePath(previousName, notification.Id); previousPath != filePath {
+		return provider.DeleteFile(orgId, previousPath, fmt.Sprintf("Rename %s notifier to %s", previousName, notification.Name))
+	}
+
+	return nil
+}
+
+func (e *ResourceExporter) logError(err error, kind string, name string) {
+	if err != nil {
+		e.log.Error("Failed to export to git repository", "kind", kind, "name", name, "error", err)
+	}
+}
+
+func dataSourceProvider(orgId int64) social.GitProvider {
+	provider := getGitProvider(orgId)
+	if provider == nil || !provider.ExportSettings(orgId).Datasources {
+		return nil
+	}
+
+	return provider
+}
+
+func notifierProvider(orgId int64) social.GitProvider {
+	provider := getGitProvider(orgId)
+	if provider == nil || !provider.ExportSettings(orgId).Notifiers {
+		return nil
+	}
+
+	return provider
+}
@@ -0,0 +1,239 @@
+package gitexport
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResourceExporter(t *testing.T) {
+	Convey("Given a repository exporting data sources only", t, func() {
+		bus.ClearBusHandlers()
+
+		provider := &fakeGitProvider{
+			files:    map[string]string{},
+			settings: &social.ExportSettings{Datasources: true},
+		}
+
+		origGetGitProvider := getGitProvider
+		getGitProvider = func(orgId int64) social.GitProvider {
+			if orgId != 1 {
+				return nil
+			}
+			return provider
+		}
+
+		exporter := &ResourceExporter{log: log.New("test")}
+
+		bus.AddHandler("test", func(query *models.GetDataSourceByIdQuery) error {
+			query.Result = &models.DataSource{Id: query.Id, OrgId: query.OrgId, Name: "Graphite", Type: "graphite"}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetAlertNotificationsQuery) error {
+			query.Result = &models.AlertNotification{Id: query.Id, OrgId: query.OrgId, Name: "Email", Type: "email", Settings: simplejson.New()}
+			return nil
+		})
+
+		Convey("Should write the data source when it is created", func() {
+			err := exporter.dataSourceCreated(&events.DataSourceCreated{Id: 1, OrgId: 1, Name: "Graphite"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldContainKey, "_resources/datasources/graphite.yaml")
+		})
+
+		Convey("Should remove the previous file when the data source is renamed", func() {
+			provider.files["_resources/datasources/old-graphite.yaml"] = "old"
+
+			err := exporter.dataSourceUpdated(&events.DataSourceUpdated{Id: 1, OrgId: 1, Name: "Graphite", PreviousName: "Old Graphite"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldContainKey, "_resources/datasources/graphite.yaml")
+			So(provider.files, ShouldNotContainKey, "_resources/datasources/old-graphite.yaml")
+		})
+
+		Convey("Should remove the file when the data source is deleted", func() {
+			provider.files["_resources/datasources/graphite.yaml"] = "content"
+
+			err := exporter.dataSourceDeleted(&events.DataSourceDeleted{Id: 1, OrgId: 1, Name: "Graphite"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldBeEmpty)
+		})
+
+		Convey("Should not export notifiers", func() {
+			err := exporter.notifierCreated(&events.AlertNotificationCreated{Id: 2, OrgId: 1, Name: "Email"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldBeEmpty)
+		})
+
+		Convey("Should export notifiers once enabled", func() {
+			provider.settings.Notifiers = true
+
+			err := exporter.notifierCreated(&events.AlertNotificationCreated{Id: 2, OrgId: 1, Name: "Email"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldContainKey, "_resources/notifiers/email.yaml")
+		})
+
+		Convey("Should not export resources of other orgs", func() {
+			err := exporter.dataSourceCreated(&events.DataSourceCreated{Id: 1, OrgId: 2, Name: "Graphite"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			getGitProvider = origGetGitProvider
+		})
+	})
+}
+
+func TestPermissionsExport(t *testing.T) {
+	Convey("Given a repository exporting permissions", t, func() {
+		bus.ClearBusHandlers()
+
+		provider := &fakeGitProvider{
+			files:    map[string]string{},
+			settings: &social.ExportSettings{Permissions: true, DashboardsPath: "dashboards"},
+		}
+
+		origGetGitProvider := getGitProvider
+		getGitProvider = func(orgId int64) social.GitProvider {
+			return provider
+		}
+
+		exporter := &ResourceExporter{log: log.New("test")}
+
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			switch query.Id {
+			case 1:
+				query.Result = &models.Dashboard{Id: 1, Title: "Ops", IsFolder: true}
+			case 2:
+				query.Result = &models.Dashboard{Id: 2, Uid: "overview", Title: "Overview", FolderId: 1}
+			case 3:
+				query.Result = &models.Dashboard{Id: 3, Uid: "home", Title: "Home"}
+			}
+			return nil
+		})
+
+		editor := models.ROLE_EDITOR
+		acl := map[int64][]*models.DashboardAclInfoDTO{}
+		bus.AddHandler("test", func(query *models.GetFolderAclListQuery) error {
+			query.Result = acl[query.FolderId]
+			return nil
+		})
+
+		Convey("Should write the permissions of the folder and its dashboards when a grant is added", func() {
+			acl[1] = []*models.DashboardAclInfoDTO{
+				{DashboardId: 1, IsFolder: true, Role: &editor, Permission: models.PERMISSION_EDIT},
+				{DashboardId: 2, Uid: "overview", Title: "Overview", TeamId: 4, Team: "SRE", Permission: models.PERMISSION_ADMIN},
+			}
+
+			err := exporter.dashboardAclUpdated(&events.DashboardAclUpdated{OrgId: 1, DashboardId: 2, UpdatedBy: "admin", Changes: []string{"Grant Admin to team SRE"}})
+			So(err, ShouldBeNil)
+			So(provider.files["dashboards/Ops/_permissions.yaml"], ShouldEqual, `folder: Ops
+permissions:
+- role: Editor
+  permission: Edit
+dashboards:
+- uid: overview
+  title: Overview
+  permissions:
+  - team: SRE
+    permission: Admin
+`)
+			So(provider.messages, ShouldResemble, []string{"Update permissions of Overview\n\nGrant Admin to team SRE\n\nChanged by admin"})
+		})
+
+		Convey("Should rewrite the file when a grant is changed", func() {
+			provider.files["dashboards/Ops/_permissions.yaml"] = "previous"
+			acl[1] = []*models.DashboardAclInfoDTO{
+				{DashboardId: 1, IsFolder: true, UserId: 5, UserLogin: "jdoe", UserEmail: "jdoe@example.com", Permission: models.PERMISSION_ADMIN},
+			}
+
+			err := exporter.dashboardAclUpdated(&events.DashboardAclUpdated{OrgId: 1, DashboardId: 1, UpdatedBy: "admin", Changes: []string{"Change user jdoe from View to Admin"}})
+			So(err, ShouldBeNil)
+			So(provider.files["dashboards/Ops/_permissions.yaml"], ShouldEqual, "folder: Ops\npermissions:\n- user: jdoe\n  permission: Admin\n")
+			So(provider.messages[0], ShouldStartWith, "Update permissions of Ops")
+		})
+
+		Convey("Should include the emails of users only when enabled", func() {
+			provider.settings.PermissionEmails = true
+			acl[1] = []*models.DashboardAclInfoDTO{
+				{DashboardId: 1, IsFolder: true, UserId: 5, UserLogin: "jdoe", UserEmail: "jdoe@example.com", Permission: models.PERMISSION_VIEW},
+			}
+
+			err := exporter.dashboardAclUpdated(&events.DashboardAclUpdated{OrgId: 1, DashboardId: 1, UpdatedBy: "admin"})
+			So(err, ShouldBeNil)
+			So(provider.files["dashboards/Ops/_permissions.yaml"], ShouldContainSubstring, "email: jdoe@example.com")
+		})
+
+		Convey("Should write the permissions of dashboards in the General folder", func() {
+			acl[0] = []*models.DashboardAclInfoDTO{
+				{DashboardId: 3, Uid: "home", Title: "Home", UserId: 5, UserLogin: "jdoe", Permission: models.PERMISSION_EDIT},
+			}
+
+			err := exporter.dashboardAclUpdated(&events.DashboardAclUpdated{OrgId: 1, DashboardId: 3, UpdatedBy: "admin"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldContainKey, "dashboards/General/_permissions.yaml")
+		})
+
+		Convey("Should remove the file when the last grant is removed", func() {
+			provider.files["dashboards/Ops/_permissions.yaml"] = "previous"
+
+			err := exporter.dashboardAclUpdated(&events.DashboardAclUpdated{OrgId: 1, DashboardId: 2, UpdatedBy: "admin", Changes: []string{"Revoke Admin from team SRE"}})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldBeEmpty)
+			So(provider.messages, ShouldResemble, []string{"Update permissions of Overview\n\nRevoke Admin from team SRE\n\nChanged by admin"})
+		})
+
+		Convey("Should remove the permissions file of a deleted folder", func() {
+			provider.files["dashboards/Ops/_permissions.yaml"] = "previous"
+
+			err := exporter.dashboardDeleted(&events.DashboardDeleted{OrgId: 1, Id: 1, Title: "Ops", IsFolder: true})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldBeEmpty)
+			So(provider.messages, ShouldResemble, []string{"Delete permissions of removed folder Ops"})
+		})
+
+		Convey("Should not export permissions unless enabled", func() {
+			provider.settings.Permissions = false
+			acl[1] = []*models.DashboardAclInfoDTO{
+				{DashboardId: 1, IsFolder: true, Role: &editor, Permission: models.PERMISSION_EDIT},
+			}
+
+			err := exporter.dashboardAclUpdated(&events.DashboardAclUpdated{OrgId: 1, DashboardId: 1, UpdatedBy: "admin"})
+			So(err, ShouldBeNil)
+			So(provider.files, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			getGitProvider = origGetGitProvider
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
+type fakeGitProvider struct {
+	files    map[string]string
+	messages []string
+	settings *social.ExportSettings
+}
+
+func (p *fakeGitProvider) ExportSettings(orgId int64) *social.ExportSettings {
+	return p.settings
+}
+
+func (p *fakeGitProvider) WriteFile(orgId int64, filePath string, content string, message string) error {
+	p.files[filePath] = content
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *fakeGitProvider) DeleteFile(orgId int64, filePath string, message string) error {
+	delete(p.files, filePath)
+	p.messages = append(p.messages, message)
+	return nil
+}
@@ -0,0 +1,85 @@
+package gitexport
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+const permissionsFileName = "_permissions.yaml"
+
+// The permissions file of a folder lists the permissions set on the folder and on each of its dashboards,
+// naming users, teams and roles rather than using ids, which differ between instances.
+
+type permissionsFile struct {
+	Folder      string                          `yaml:"folder"`
+	Permissions []*exportedPermission           `yaml:"permissions,omitempty"`
+	Dashboards  []*exportedDashboardPermissions `yaml:"dashboards,omitempty"`
+}
+
+type exportedDashboardPermissions struct {
+	Uid         string                `yaml:"uid"`
+	Title       string                `yaml:"title"`
+	Permissions []*exportedPermission `yaml:"permissions"`
+}
+
+type exportedPermission struct {
+	Role       string `yaml:"role,omitempty"`
+	Team       string `yaml:"team,omitempty"`
+	User       string `yaml:"user,omitempty"`
+	Email      string `yaml:"email,omitempty"`
+	Permission string `yaml:"permission"`
+}
+
+// permissionsToYaml returns the permissions file of the folder. Users are named by login, their emails are only
+// written when withEmails is set.
+func permissionsToYaml(folder string, acl []*models.DashboardAclInfoDTO, withEmails bool) (string, error) {
+	file := &permissionsFile{Folder: folder}
+	dashboards := make(map[int64]*exportedDashboardPermissions)
+
+	for _, item := range acl {
+		exported := &exportedPermission{Permission: item.Permission.String()}
+
+		switch {
+		case item.UserId > 0:
+			exported.User = item.UserLogin
+			if withEmails {
+				exported.Email = item.UserEmail
+			}
+		case item.TeamId > 0:
+			exported.Team = item.Team
+		case item.Role != nil:
+			exported.Role = string(*item.Role)
+		}
+
+		if item.IsFolder {
+			file.Permissions = append(file.Permissions, exported)
+			continue
+		}
+
+		dashboard, ok := dashboards[item.DashboardId]
+		if !ok {
+			dashboard = &exportedDashboardPermissions{Uid: item.Uid, Title: item.Title}
+			dashboards[item.DashboardId] = dashboard
+			file.Dashboards = append(file.Dashboards, dashboard)
+		}
+		dashboard.Permissions = append(dashboard.Permissions, exported)
+	}
+
+	out, err := yaml.Marshal(file)
+	return string(out), err
+}
+
+// permissionsCommitMessage describes the grant changes and names the user who made them
+func permissionsCommitMessage(title string, event *events.DashboardAclUpdated) string {
+	return fmt.Sprintf("Update permissions of %s\n\n%s\n\nChanged by %s", title, strings.Join(event.Changes, "\n"), event.UpdatedBy)
+}
+
+// permissionsFilePath returns the path of the permissions file in the directory of the synced dashboards of the folder
+func permissionsFilePath(dashboardsPath string, folder string) string {
+	return path.Join(dashboardsPath, folder, permissionsFileName)
+}
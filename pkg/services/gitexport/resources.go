@@ -0,0 +1,175 @@
+package gitexport
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	dataSourcesPath = "_resources/datasources"
+	notifiersPath   = "_resources/notifiers"
+)
+
+var (
+	// notifier settings holding credentials, e.g. slack webhook urls or pagerduty integration keys
+	secretSettingPattern = regexp.MustCompile(`(?i)(password|token|secret|key|url)`)
+	envNamePattern       = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// The exported files use the provisioning format, so they can be used to provision another instance.
+// Secrets are replaced with environment variable references that provisioning expands.
+
+type dataSourcesFile struct {
+	ApiVersion  int64                 `yaml:"apiVersion"`
+	Datasources []*exportedDataSource `yaml:"datasources"`
+}
+
+type exportedDataSource struct {
+	OrgId             int64                  `yaml:"orgId"`
+	Version           int                    `yaml:"version"`
+	Name              string                 `yaml:"name"`
+	Type              string                 `yaml:"type"`
+	Access            string                 `yaml:"access"`
+	Url               string                 `yaml:"url,omitempty"`
+	Password          string                 `yaml:"password,omitempty"`
+	User              string                 `yaml:"user,omitempty"`
+	Database          string                 `yaml:"database,omitempty"`
+	BasicAuth         bool                   `yaml:"basicAuth"`
+	BasicAuthUser     string                 `yaml:"basicAuthUser,omitempty"`
+	BasicAuthPassword string                 `yaml:"basicAuthPassword,omitempty"`
+	WithCredentials   bool                   `yaml:"withCredentials"`
+	IsDefault         bool                   `yaml:"isDefault"`
+	JsonData          map[string]interface{} `yaml:"jsonData,omitempty"`
+	SecureJsonData    map[string]string      `yaml:"secureJsonData,omitempty"`
+	Editable          bool                   `yaml:"editable"`
+}
+
+type notifiersFile struct {
+	Notifiers []*exportedNotifier `yaml:"notifiers"`
+}
+
+type exportedNotifier struct {
+	Uid                   string                 `yaml:"uid"`
+	OrgId                 int64                  `yaml:"org_id"`
+	Name                  string                 `yaml:"name"`
+	Type                  string                 `yaml:"type"`
+	IsDefault             bool                   `yaml:"is_default"`
+	SendReminder          bool                   `yaml:"send_reminder"`
+	DisableResolveMessage bool                   `yaml:"disable_resolve_message"`
+	Frequency             string                 `yaml:"frequency,omitempty"`
+	Settings              map[string]interface{} `yaml:"settings,omitempty"`
+}
+
+// dataSourceToYaml returns the provisioning file of the data source. The values of password fields and
+// secureJsonData are never written, they are replaced with placeholders.
+func dataSourceToYaml(ds *models.DataSource) (string, error) {
+	exported := &exportedDataSource{
+		OrgId:           ds.OrgId,
+		Version:         ds.Version,
+		Name:            ds.Name,
+		Type:            ds.Type,
+		Access:          string(ds.Access),
+		Url:             ds.Url,
+		User:            ds.User,
+		Database:        ds.Database,
+		BasicAuth:       ds.BasicAuth,
+		BasicAuthUser:   ds.BasicAuthUser,
+		WithCredentials: ds.WithCredentials,
+		IsDefault:       ds.IsDefault,
+		Editable:        !ds.ReadOnly,
+	}
+
+	if ds.JsonData != nil {
+		exported.JsonData = ds.JsonData.MustMap()
+	}
+
+	if ds.Password != "" {
+		exported.Password = secretPlaceholder("datasource", ds.Name, "password")
+	}
+
+	if ds.BasicAuthPassword != "" {
+		exported.BasicAuthPassword = secretPlaceholder("datasource", ds.Name, "basicAuthPassword")
+	}
+
+	if len(ds.SecureJsonData) > 0 {
+		exported.SecureJsonData = make(map[string]string, len(ds.SecureJsonData))
+		for key := range ds.SecureJsonData {
+			exported.SecureJsonData[key] = secretPlaceholder("datasource", ds.Name, key)
+		}
+	}
+
+	out, err := yaml.Marshal(&dataSourcesFile{ApiVersion: 1, Datasources: []*exportedDataSource{exported}})
+	return string(out), err
+}
+
+// notifierToYaml returns the provisioning file of the notification channel. Settings that can hold
+// credentials are replaced with placeholders.
+func notifierToYaml(notification *models.AlertNotification) (string, error) {
+	exported := &exportedNotifier{
+		Uid:                   notification.Uid,
+		OrgId:                 notification.OrgId,
+		Name:                  notification.Name,
+		Type:                  notification.Type,
+		IsDefault:             notification.IsDefault,
+		SendReminder:          notification.SendReminder,
+		DisableResolveMessage: notification.DisableResolveMessage,
+	}
+
+	if notification.SendReminder {
+		exported.Frequency = notification.Frequency.String()
+	}
+
+	if notification.Settings != nil {
+		exported.Settings = sanitizeSettings(notification.Settings.MustMap(), []string{"notifier", notification.Name})
+	}
+
+	out, err := yaml.Marshal(&notifiersFile{Notifiers: []*exportedNotifier{exported}})
+	return string(out), err
+}
+
+func sanitizeSettings(settings map[string]interface{}, prefix []string) map[string]interface{} {
+	sanitized := make(map[string]interface{}, len(settings))
+
+	for key, value := range settings {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			sanitized[key] = sanitizeSettings(v, append(prefix, key))
+		default:
+			if secretSettingPattern.MatchString(key) && value != nil && value != "" {
+				sanitized[key] = secretPlaceholder(append(prefix, key)...)
+			} else {
+				sanitized[key] = value
+			}
+		}
+	}
+
+	return sanitized
+}
+
+// secretPlaceholder returns a reference to an environment variable, e.g. ${DATASOURCE_PROMETHEUS_PASSWORD}
+func secretPlaceholder(parts ...string) string {
+	name := envNamePattern.ReplaceAllString(strings.ToUpper(strings.Join(parts, "_")), "_")
+	return fmt.Sprintf("${%s}", strings.Trim(name, "_"))
+}
+
+func dataSourceFilePath(name string, id int64) string {
+	return path.Join(dataSourcesPath, resourceFileName(name, id))
+}
+
+func notifierFilePath(name string, id int64) string {
+	return path.Join(notifiersPath, resourceFileName(name, id))
+}
+
+func resourceFileName(name string, id int64) string {
+	slug := models.SlugifyTitle(name)
+	if slug == "" {
+		slug = fmt.Sprintf("%d", id)
+	}
+
+	return slug + ".yaml"
+}
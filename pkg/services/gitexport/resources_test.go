@@ -0,0 +1,107 @@
+package gitexport
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/securejsondata"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v2"
+)
+
+func TestResourceSanitization(t *testing.T) {
+	Convey("Given a data source with secrets", t, func() {
+		secureJsonData := securejsondata.GetEncryptedJsonData(map[string]string{
+			"password":          "secure-s3cret",
+			"basicAuthPassword": "secure-basic-s3cret",
+		})
+
+		ds := &models.DataSource{
+			Id:                1,
+			OrgId:             1,
+			Version:           3,
+			Name:              "Production Prometheus",
+			Type:              "prometheus",
+			Access:            models.DS_ACCESS_PROXY,
+			Url:               "http://prometheus:9090",
+			Password:          "legacy-s3cret",
+			BasicAuth:         true,
+			BasicAuthUser:     "admin",
+			BasicAuthPassword: "legacy-basic-s3cret",
+			JsonData:          simplejson.NewFromAny(map[string]interface{}{"httpMethod": "POST"}),
+			SecureJsonData:    secureJsonData,
+		}
+
+		content, err := dataSourceToYaml(ds)
+		So(err, ShouldBeNil)
+
+		Convey("Should never write secret values", func() {
+			for _, secret := range []string{"secure-s3cret", "secure-basic-s3cret", "legacy-s3cret", "legacy-basic-s3cret"} {
+				So(content, ShouldNotContainSubstring, secret)
+			}
+
+			for _, encrypted := range secureJsonData {
+				So(content, ShouldNotContainSubstring, string(encrypted))
+			}
+		})
+
+		Convey("Should write a provisioning file with placeholders for secrets", func() {
+			file := dataSourcesFile{}
+			So(yaml.Unmarshal([]byte(content), &file), ShouldBeNil)
+			So(file.ApiVersion, ShouldEqual, 1)
+			So(len(file.Datasources), ShouldEqual, 1)
+
+			exported := file.Datasources[0]
+			So(exported.Name, ShouldEqual, "Production Prometheus")
+			So(exported.Url, ShouldEqual, "http://prometheus:9090")
+			So(exported.JsonData["httpMethod"], ShouldEqual, "POST")
+			So(exported.Password, ShouldEqual, "${DATASOURCE_PRODUCTION_PROMETHEUS_PASSWORD}")
+			So(exported.BasicAuthPassword, ShouldEqual, "${DATASOURCE_PRODUCTION_PROMETHEUS_BASICAUTHPASSWORD}")
+			So(exported.SecureJsonData, ShouldResemble, map[string]string{
+				"password":          "${DATASOURCE_PRODUCTION_PROMETHEUS_PASSWORD}",
+				"basicAuthPassword": "${DATASOURCE_PRODUCTION_PROMETHEUS_BASICAUTHPASSWORD}",
+			})
+		})
+
+		Convey("Should use the name for the file path", func() {
+			So(dataSourceFilePath(ds.Name, ds.Id), ShouldEqual, "_resources/datasources/production-prometheus.yaml")
+		})
+	})
+
+	Convey("Given a notifier with credentials in its settings", t, func() {
+		notification := &models.AlertNotification{
+			Id:           2,
+			Uid:          "ops-slack",
+			OrgId:        1,
+			Name:         "Ops Slack",
+			Type:         "slack",
+			SendReminder: true,
+			Frequency:    15 * time.Minute,
+			Settings: simplejson.NewFromAny(map[string]interface{}{
+				"url":       "https://hooks.slack.com/services/T000/B000/XXXX",
+				"recipient": "#ops",
+				"token":     "xoxb-s3cret",
+			}),
+		}
+
+		content, err := notifierToYaml(notification)
+		So(err, ShouldBeNil)
+
+		So(content, ShouldNotContainSubstring, "hooks.slack.com")
+		So(content, ShouldNotContainSubstring, "xoxb-s3cret")
+
+		file := notifiersFile{}
+		So(yaml.Unmarshal([]byte(content), &file), ShouldBeNil)
+
+		exported := file.Notifiers[0]
+		So(exported.Uid, ShouldEqual, "ops-slack")
+		So(exported.Frequency, ShouldEqual, "15m0s")
+		So(exported.Settings["recipient"], ShouldEqual, "#ops")
+		So(exported.Settings["url"], ShouldEqual, "${NOTIFIER_OPS_SLACK_URL}")
+		So(exported.Settings["token"], ShouldEqual, "${NOTIFIER_OPS_SLACK_TOKEN}")
+		So(strings.HasPrefix(notifierFilePath(notification.Name, notification.Id), "_resources/notifiers/"), ShouldBeTrue)
+	})
+}
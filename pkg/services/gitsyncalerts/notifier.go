@@ -0,0 +1,240 @@
+package gitsyncalerts
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func init() {
+	registry.RegisterService(&Notifier{})
+}
+
+var (
+	now         = time.Now
+	getSyncRepo = social.GetSyncRepo
+)
+
+const (
+	kindFailing   = "failing"
+	kindEscalated = "escalated"
+	kindRecovered = "recovered"
+)
+
+// Notifier emails the admins of an organization when dashboard commits to one of its repositories fail. The
+// admins are told once per sync_failure_alert_window however many commits fail, once more when the commits
+// keep failing past sync_failure_escalate_after, and when a commit succeeds again. The state of the failing
+// repositories is stored, so restarting Grafana does not notify the admins again. The admins are also told
+// when the organization exceeds its daily budget of dashboard commits.
+type Notifier struct {
+	log log.Logger
+	mu  sync.Mutex
+}
+
+func (n *Notifier) Init() error {
+	n.log = log.New("gitsyncalerts")
+
+	bus.AddEventListener(n.dashboardSyncFailed)
+	bus.AddEventListener(n.dashboardSynced)
+	bus.AddEventListener(n.dashboardSyncBudgetExceeded)
+
+	return nil
+}
+
+// Failures are logged rather than returned, the dashboard is already saved and
+// an error would stop the event from reaching the other listeners.
+
+func (n *Notifier) dashboardSyncFailed(event *events.DashboardSyncFailed) error {
+	if setting.DashboardSyncFailureAlertWindow <= 0 {
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	query := &models.GetGitSyncAlertStateQuery{OrgId: event.OrgId, Repo: event.Repo}
+	if err := bus.Dispatch(query); err != nil {
+		n.log.Error("Failed to get git sync alert state", "orgId", event.OrgId, "repo", event.Repo, "error", err)
+		return nil
+	}
+
+	state := query.Result
+	if state == nil {
+		state = &models.GitSyncAlertState{OrgId: event.OrgId, Repo: event.Repo, FirstFailure: event.Timestamp}
+	}
+
+	state.Failures++
+	state.LastError = event.Error
+	if !containsId(state.DashboardIds, event.DashboardId) {
+		state.DashboardIds = append(state.DashboardIds, event.DashboardId)
+	}
+
+	if kind := notificationKind(state); kind != "" {
+		n.notify(state, kind)
+		state.LastNotified = now()
+		if kind == kindEscalated {
+			state.Escalated = true
+		}
+	}
+
+	if err := bus.Dispatch(&models.SaveGitSyncAlertStateCommand{State: state}); err != nil {
+		n.log.Error("Failed to save git sync alert state", "orgId", event.OrgId, "repo", event.Repo, "error", err)
+	}
+	return nil
+}
+
+func (n *Notifier) dashboardSynced(event *events.DashboardSynced) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	query := &models.GetGitSyncAlertStateQuery{OrgId: event.OrgId, Repo: event.Repo}
+	if err := bus.Dispatch(query); err != nil {
+		n.log.Error("Failed to get git sync alert state", "orgId", event.OrgId, "repo", event.Repo, "error", err)
+		return nil
+	}
+
+	state := query.Result
+	if state == nil {
+		return nil
+	}
+
+	if !state.LastNotified.IsZero() {
+		n.notify(state, kindRecovered)
+	}
+
+	if err := bus.Dispatch(&models.DeleteGitSyncAlertStateCommand{OrgId: event.OrgId, Repo: event.Repo}); err != nil {
+		n.log.Error("Failed to delete git sync alert state", "orgId", event.OrgId, "repo", event.Repo, "error", err)
+	}
+	return nil
+}
+
+// dashboardSyncBudgetExceeded is published once per organization and day, when the first commit is skipped
+func (n *Notifier) dashboardSyncBudgetExceeded(event *events.DashboardSyncBudgetExceeded) error {
+	to := n.orgAdminEmails(event.OrgId)
+	if len(to) == 0 {
+		n.log.Warn("No org admin to notify about the exceeded dashboard commit budget", "orgId", event.OrgId)
+		return nil
+	}
+
+	cmd := &models.SendEmailCommand{
+		To:       to,
+		Template: "git_sync_budget.html",
+		Subject:  "Daily budget of dashboard commits exceeded",
+		Data: map[string]interface{}{
+			"Commits":      event.Commits,
+			"Bytes":        event.Bytes,
+			"CommitBudget": setting.DashboardSyncDailyCommitBudget,
+			"ByteBudget":   setting.DashboardSyncDailyByteBudget,
+			"ResetAt":      event.ResetAt.Format(time.RFC1123),
+		},
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		n.log.Error("Failed to send dashboard commit budget email", "orgId", event.OrgId, "error", err)
+	}
+	return nil
+}
+
+// notificationKind returns the email to send about the failing repository, or an empty string when the admins
+// were told about it recently enough
+func notificationKind(state *models.GitSyncAlertState) string {
+	if state.LastNotified.IsZero() {
+		return kindFailing
+	}
+
+	escalateAfter := setting.DashboardSyncFailureEscalateAfter
+	if escalateAfter > 0 && !state.Escalated && now().Sub(state.FirstFailure) >= escalateAfter {
+		return kindEscalated
+	}
+
+	if now().Sub(state.LastNotified) >= setting.DashboardSyncFailureAlertWindow {
+		return kindFailing
+	}
+
+	return ""
+}
+
+// orgAdminEmails returns the emails of the admins of the organization
+func (n *Notifier) orgAdminEmails(orgId int64) []string {
+	query := &models.GetOrgUsersQuery{OrgId: orgId}
+	if err := bus.Dispatch(query); err != nil {
+		n.log.Error("Failed to get org admins", "orgId", orgId, "error", err)
+		return nil
+	}
+
+	var to []string
+	for _, user := range query.Result {
+		if user.Role == string(models.ROLE_ADMIN) && user.Email != "" {
+			to = append(to, user.Email)
+		}
+	}
+	return to
+}
+
+func (n *Notifier) notify(state *models.GitSyncAlertState, kind string) {
+	to := n.orgAdminEmails(state.OrgId)
+	if len(to) == 0 {
+		n.log.Warn("No org admin to notify about failing dashboard commits", "orgId", state.OrgId, "repo", state.Repo)
+		return
+	}
+
+	repo := repoName(state)
+	cmd := &models.SendEmailCommand{
+		To:       to,
+		Template: "git_sync_failure.html",
+		Subject:  subject(repo, kind),
+		Data: map[string]interface{}{
+			"Kind":          kind,
+			"Repo":          repo,
+			"Error":         state.LastError,
+			"Failures":      state.Failures,
+			"Dashboards":    len(state.DashboardIds),
+			"FirstFailure":  state.FirstFailure.Format(time.RFC1123),
+			"EscalateAfter": setting.DashboardSyncFailureEscalateAfter.String(),
+		},
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		n.log.Error("Failed to send git sync failure email", "orgId", state.OrgId, "repo", state.Repo, "error", err)
+	}
+}
+
+func subject(repo string, kind string) string {
+	switch kind {
+	case kindRecovered:
+		return fmt.Sprintf("Dashboard commits to %s have recovered", repo)
+	case kindEscalated:
+		return fmt.Sprintf("Dashboard commits to %s are still failing", repo)
+	default:
+		return fmt.Sprintf("Dashboard commits to %s are failing", repo)
+	}
+}
+
+// repoName returns how the repository is named in emails. The repository a dashboard selects is only known by id.
+func repoName(state *models.GitSyncAlertState) string {
+	if state.Repo != "" {
+		return "repository " + state.Repo
+	}
+
+	if repo := getSyncRepo(state.OrgId); repo != nil && repo.WebUrl != "" {
+		return repo.WebUrl
+	}
+	return "the repository of the organization"
+}
+
+func containsId(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package gitsyncalerts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login/social"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNotifier(t *testing.T) {
+	Convey("Given a notifier of failing dashboard commits", t, func() {
+		bus.ClearBusHandlers()
+
+		current := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+		origNow := now
+		now = func() time.Time { return current }
+
+		origGetSyncRepo := getSyncRepo
+		getSyncRepo = func(orgId int64) *social.SyncRepo {
+			return &social.SyncRepo{Provider: "gitlab", WebUrl: "https://gitlab.example.com/ops/dashboards", RepoId: 7}
+		}
+
+		origWindow := setting.DashboardSyncFailureAlertWindow
+		origEscalateAfter := setting.DashboardSyncFailureEscalateAfter
+		setting.DashboardSyncFailureAlertWindow = time.Hour
+		setting.DashboardSyncFailureEscalateAfter = 24 * time.Hour
+
+		// the stored states, kept across notifier instances like the database
+		states := map[string]*models.GitSyncAlertState{}
+		bus.AddHandler("test", func(query *models.GetGitSyncAlertStateQuery) error {
+			if state, ok := states[query.Repo]; ok {
+				copied := *state
+				query.Result = &copied
+			}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SaveGitSyncAlertStateCommand) error {
+			states[cmd.State.Repo] = cmd.State
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.DeleteGitSyncAlertStateCommand) error {
+			delete(states, cmd.Repo)
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetOrgUsersQuery) error {
+			query.Result = []*models.OrgUserDTO{
+				{OrgId: query.OrgId, Email: "admin@example.com", Role: string(models.ROLE_ADMIN)},
+				{OrgId: query.OrgId, Email: "editor@example.com", Role: string(models.ROLE_EDITOR)},
+			}
+			return nil
+		})
+
+		var sent []*models.SendEmailCommand
+		bus.AddHandler("test", func(cmd *models.SendEmailCommand) error {
+			sent = append(sent, cmd)
+			return nil
+		})
+
+		notifier := &Notifier{log: log.New("test")}
+
+		fail := func(dashboardId int64) {
+			err := notifier.dashboardSyncFailed(&events.DashboardSyncFailed{
+				Timestamp:   current,
+				OrgId:       1,
+				DashboardId: dashboardId,
+				Error:       "Failed to sync dashboard",
+			})
+			So(err, ShouldBeNil)
+		}
+
+		Convey("Should email the org admins on the first failure", func() {
+			fail(1)
+
+			So(len(sent), ShouldEqual, 1)
+			So(sent[0].To, ShouldResemble, []string{"admin@example.com"})
+			So(sent[0].Template, ShouldEqual, "git_sync_failure.html")
+			So(sent[0].Subject, ShouldEqual, "Dashboard commits to https://gitlab.example.com/ops/dashboards are failing")
+			So(sent[0].Data["Kind"], ShouldEqual, kindFailing)
+			So(sent[0].Data["Error"], ShouldEqual, "Failed to sync dashboard")
+		})
+
+		Convey("Should not email again within the window", func() {
+			fail(1)
+			current = current.Add(10 * time.Minute)
+			fail(2)
+			fail(2)
+
+			So(len(sent), ShouldEqual, 1)
+			So(states[""].Failures, ShouldEqual, 3)
+			So(states[""].DashboardIds, ShouldResemble, []int64{1, 2})
+		})
+
+		Convey("Should email again once the window has passed", func() {
+			fail(1)
+			current = current.Add(time.Hour)
+			fail(2)
+
+			So(len(sent), ShouldEqual, 2)
+			So(sent[1].Data["Kind"], ShouldEqual, kindFailing)
+			So(sent[1].Data["Failures"], ShouldEqual, 2)
+			So(sent[1].Data["Dashboards"], ShouldEqual, 2)
+		})
+
+		Convey("Should escalate once when the commits keep failing", func() {
+			fail(1)
+			current = current.Add(24 * time.Hour)
+			fail(1)
+			current = current.Add(time.Minute)
+			fail(1)
+
+			So(len(sent), ShouldEqual, 2)
+			So(sent[1].Data["Kind"], ShouldEqual, kindEscalated)
+			So(sent[1].Subject, ShouldEqual, "Dashboard commits to https://gitlab.example.com/ops/dashboards are still failing")
+			So(states[""].Escalated, ShouldBeTrue)
+		})
+
+		Convey("Should email and clear the state when the commits recover", func() {
+			fail(1)
+			So(notifier.dashboardSynced(&events.DashboardSynced{Timestamp: current, OrgId: 1, DashboardId: 1}), ShouldBeNil)
+
+			So(len(sent), ShouldEqual, 2)
+			So(sent[1].Data["Kind"], ShouldEqual, kindRecovered)
+			So(states, ShouldBeEmpty)
+
+			fail(1)
+			So(len(sent), ShouldEqual, 3)
+			So(sent[2].Data["Kind"], ShouldEqual, kindFailing)
+		})
+
+		Convey("Should not email when a repository that is not failing syncs", func() {
+			So(notifier.dashboardSynced(&events.DashboardSynced{Timestamp: current, OrgId: 1, DashboardId: 1}), ShouldBeNil)
+			So(sent, ShouldBeEmpty)
+		})
+
+		Convey("Should keep the state of other repositories apart", func() {
+			fail(1)
+			err := notifier.dashboardSyncFailed(&events.DashboardSyncFailed{Timestamp: current, OrgId: 1, Repo: "8", DashboardId: 2})
+			So(err, ShouldBeNil)
+
+			So(len(sent), ShouldEqual, 2)
+			So(sent[1].Subject, ShouldEqual, "Dashboard commits to repository 8 are failing")
+		})
+
+		Convey("Should not email again after a restart", func() {
+			fail(1)
+			notifier = &Notifier{log: log.New("test")}
+			current = current.Add(10 * time.Minute)
+			fail(1)
+
+			So(len(sent), ShouldEqual, 1)
+		})
+
+		Convey("Should not email when disabled", func() {
+			setting.DashboardSyncFailureAlertWindow = 0
+			fail(1)
+
+			So(sent, ShouldBeEmpty)
+			So(states, ShouldBeEmpty)
+		})
+
+		Convey("Should keep the state when the email fails", func() {
+			bus.AddHandler("test", func(cmd *models.SendEmailCommand) error {
+				return errors.New("smtp not configured")
+			})
+			fail(1)
+
+			So(states[""].Failures, ShouldEqual, 1)
+		})
+
+		Convey("Should email the org admins when the commit budget is exceeded", func() {
+			err := notifier.dashboardSyncBudgetExceeded(&events.DashboardSyncBudgetExceeded{
+				Timestamp: current,
+				OrgId:     1,
+				Commits:   100,
+				ResetAt:   time.Date(2019, 9, 2, 0, 0, 0, 0, time.UTC),
+			})
+			So(err, ShouldBeNil)
+
+			So(len(sent), ShouldEqual, 1)
+			So(sent[0].To, ShouldResemble, []string{"admin@example.com"})
+			So(sent[0].Template, ShouldEqual, "git_sync_budget.html")
+			So(sent[0].Data["Commits"], ShouldEqual, 100)
+			So(sent[0].Data["ResetAt"], ShouldEqual, "Mon, 02 Sep 2019 00:00:00 UTC")
+		})
+
+		Reset(func() {
+			now = origNow
+			getSyncRepo = origGetSyncRepo
+			setting.DashboardSyncFailureAlertWindow = origWindow
+			setting.DashboardSyncFailureEscalateAfter = origEscalateAfter
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -0,0 +1,34 @@
+package guardian
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+// CanQueryDatasource tells whether the user may query the data source. The data source must belong to the org of
+// the user, and pass the data source permission filter when one is registered. Without a filter, every member of
+// the org may query the data sources of the org.
+func CanQueryDatasource(user *m.SignedInUser, ds *m.DataSource) (bool, error) {
+	if user == nil || ds.OrgId != user.OrgId {
+		return false, nil
+	}
+
+	filterQuery := m.DatasourcesPermissionFilterQuery{
+		User:        user,
+		Datasources: []*m.DataSource{ds},
+	}
+
+	if err := bus.Dispatch(&filterQuery); err != nil {
+		if err == bus.ErrHandlerNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+
+	for _, allowed := range filterQuery.Result {
+		if allowed.Id == ds.Id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,65 @@
+package guardian
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCanQueryDatasource(t *testing.T) {
+	Convey("Given a data source of org 1", t, func() {
+		bus.ClearBusHandlers()
+
+		ds := &m.DataSource{Id: 5, OrgId: orgID, Name: "Prometheus"}
+		user := &m.SignedInUser{UserId: userID, OrgId: orgID, OrgRole: viewerRole}
+
+		Convey("Should allow members of the org without a permission filter", func() {
+			canQuery, err := CanQueryDatasource(user, ds)
+			So(err, ShouldBeNil)
+			So(canQuery, ShouldBeTrue)
+		})
+
+		Convey("Should deny users of other orgs and missing users", func() {
+			canQuery, err := CanQueryDatasource(&m.SignedInUser{UserId: otherUserID, OrgId: 2}, ds)
+			So(err, ShouldBeNil)
+			So(canQuery, ShouldBeFalse)
+
+			canQuery, err = CanQueryDatasource(nil, ds)
+			So(err, ShouldBeNil)
+			So(canQuery, ShouldBeFalse)
+		})
+
+		Convey("Should only allow the data sources kept by the permission filter", func() {
+			allowed := []*m.DataSource{}
+			bus.AddHandler("test", func(query *m.DatasourcesPermissionFilterQuery) error {
+				query.Result = allowed
+				return nil
+			})
+
+			canQuery, err := CanQueryDatasource(user, ds)
+			So(err, ShouldBeNil)
+			So(canQuery, ShouldBeFalse)
+
+			allowed = []*m.DataSource{ds}
+			canQuery, err = CanQueryDatasource(user, ds)
+			So(err, ShouldBeNil)
+			So(canQuery, ShouldBeTrue)
+		})
+
+		Convey("Should return the error of the permission filter", func() {
+			bus.AddHandler("test", func(query *m.DatasourcesPermissionFilterQuery) error {
+				return errors.New("permissions unavailable")
+			})
+
+			_, err := CanQueryDatasource(user, ds)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -44,6 +44,17 @@ var New = func(dashId int64, orgId int64, user *m.SignedInUser) DashboardGuardia
 	}
 }
 
+// NewWithAcl creates a guardian checking the acl and teams fetched beforehand, e.g. with other queries, instead
+// of querying them. Nil acl or teams are still queried when needed.
+func NewWithAcl(dashId int64, orgId int64, user *m.SignedInUser, acl []*m.DashboardAclInfoDTO, teams []*m.TeamDTO) DashboardGuardian {
+	g := New(dashId, orgId, user)
+	if impl, ok := g.(*dashboardGuardianImpl); ok {
+		impl.acl = acl
+		impl.teams = teams
+	}
+	return g
+}
+
 func (g *dashboardGuardianImpl) CanSave() (bool, error) {
 	return g.HasPermission(m.PERMISSION_EDIT)
 }
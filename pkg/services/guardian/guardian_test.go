@@ -5,6 +5,7 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/grafana/grafana/pkg/bus"
 	m "github.com/grafana/grafana/pkg/models"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -176,6 +177,70 @@ func TestGuardianViewer(t *testing.T) {
 	})
 }
 
+func TestGuardianWithAcl(t *testing.T) {
+	Convey("Given a guardian created with a fetched acl", t, func() {
+		bus.ClearBusHandlers()
+
+		aclQueries := 0
+		bus.AddHandler("test", func(query *m.GetDashboardAclInfoListQuery) error {
+			aclQueries++
+			return nil
+		})
+		teamQueries := 0
+		bus.AddHandler("test", func(query *m.GetTeamsByUserQuery) error {
+			teamQueries++
+			query.Result = []*m.TeamDTO{{Id: teamID}}
+			return nil
+		})
+
+		user := &m.SignedInUser{UserId: userID, OrgId: orgID, OrgRole: m.ROLE_VIEWER}
+		acl := []*m.DashboardAclInfoDTO{
+			{OrgId: orgID, DashboardId: dashboardID, TeamId: teamID, Permission: m.PERMISSION_EDIT},
+		}
+
+		Convey("Should check the acl and the teams without querying them", func() {
+			g := NewWithAcl(dashboardID, orgID, user, acl, []*m.TeamDTO{{Id: teamID}})
+
+			canSave, err := g.CanSave()
+			So(err, ShouldBeNil)
+			So(canSave, ShouldBeTrue)
+			So(aclQueries, ShouldEqual, 0)
+			So(teamQueries, ShouldEqual, 0)
+		})
+
+		Convey("Should deny the users missing from the acl", func() {
+			g := NewWithAcl(dashboardID, orgID, user, acl, []*m.TeamDTO{{Id: otherTeamID}})
+
+			canSave, err := g.CanSave()
+			So(err, ShouldBeNil)
+			So(canSave, ShouldBeFalse)
+		})
+
+		Convey("Should query the teams that were not fetched", func() {
+			g := NewWithAcl(dashboardID, orgID, user, acl, nil)
+
+			canSave, err := g.CanSave()
+			So(err, ShouldBeNil)
+			So(canSave, ShouldBeTrue)
+			So(aclQueries, ShouldEqual, 0)
+			So(teamQueries, ShouldEqual, 1)
+		})
+
+		Convey("Should query the acl that was not fetched", func() {
+			g := NewWithAcl(dashboardID, orgID, user, nil, nil)
+
+			canSave, err := g.CanSave()
+			So(err, ShouldBeNil)
+			So(canSave, ShouldBeFalse)
+			So(aclQueries, ShouldEqual, 1)
+		})
+
+		Reset(func() {
+			bus.ClearBusHandlers()
+		})
+	})
+}
+
 func (sc *scenarioContext) defaultPermissionScenario(pt permissionType, flag permissionFlags) {
 	_, callerFile, callerLine, _ := runtime.Caller(1)
 	sc.callerFile = callerFile
@@ -69,6 +69,7 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 				AuthModule: extUser.AuthModule,
 				AuthId:     extUser.AuthId,
 				OAuthToken: extUser.OAuthToken,
+				Identity:   extUser,
 			}
 			if err := ls.Bus.Dispatch(cmd2); err != nil {
 				return err
@@ -83,8 +84,8 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 			return err
 		}
 
-		// Always persist the latest token at log-in
-		if extUser.AuthModule != "" && extUser.OAuthToken != nil {
+		// Always persist the latest token and identity at log-in
+		if extUser.AuthModule != "" {
 			err = updateUserAuth(cmd.Result, extUser)
 			if err != nil {
 				return err
@@ -124,6 +125,17 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 	return err
 }
 
+// GetExternalIdentity returns the identity of the user at the provider, the auth module the user logged in with,
+// e.g. oauth_gitlab. It fails with models.ErrUserNotFound when the user never logged in with the provider.
+func GetExternalIdentity(userId int64, provider string) (*models.ExternalIdentity, error) {
+	query := &models.GetExternalIdentityQuery{UserId: userId, Provider: provider}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	return query.Result, nil
+}
+
 func createUser(extUser *models.ExternalUserInfo) (*models.User, error) {
 	cmd := &models.CreateUserCommand{
 		Login:        extUser.Login,
@@ -178,6 +190,7 @@ func updateUserAuth(user *models.User, extUser *models.ExternalUserInfo) error {
 		AuthId:     extUser.AuthId,
 		UserId:     user.Id,
 		OAuthToken: extUser.OAuthToken,
+		Identity:   extUser,
 	}
 
 	logger.Debug("Updating user_auth info", "user_id", user.Id)
@@ -75,6 +75,7 @@ func validateDashboardAsConfig(t *testing.T, cfg []*DashboardsAsConfig) {
 	So(ds.Options["path"], ShouldEqual, "/var/lib/grafana/dashboards")
 	So(ds.DisableDeletion, ShouldBeTrue)
 	So(ds.UpdateIntervalSeconds, ShouldEqual, 15)
+	So(ds.AllowAdoption, ShouldBeTrue)
 
 	ds2 := cfg[1]
 	So(ds2.Name, ShouldEqual, "default")
@@ -87,4 +88,5 @@ func validateDashboardAsConfig(t *testing.T, cfg []*DashboardsAsConfig) {
 	So(ds2.Options["path"], ShouldEqual, "/var/lib/grafana/dashboards")
 	So(ds2.DisableDeletion, ShouldBeFalse)
 	So(ds2.UpdateIntervalSeconds, ShouldEqual, 10)
+	So(ds2.AllowAdoption, ShouldBeFalse)
 }
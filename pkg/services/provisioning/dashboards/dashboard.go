@@ -53,6 +53,21 @@ func (provider *DashboardProvisionerImpl) Provision() error {
 	return nil
 }
 
+// Report compares the dashboard files of each provisioner with the dashboards they provisioned, without
+// saving anything
+func (provider *DashboardProvisionerImpl) Report(opts ReportOptions) ([]*ProvisionerReport, error) {
+	reports := make([]*ProvisionerReport, 0, len(provider.fileReaders))
+	for _, reader := range provider.fileReaders {
+		report, err := reader.report(opts)
+		if err != nil {
+			return nil, errutil.Wrapf(err, "Failed to report config %v", reader.Cfg.Name)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
 // PollChanges starts polling for changes in dashboard definition files. It creates goroutine for each provider
 // defined in the config.
 func (provider *DashboardProvisionerImpl) PollChanges(ctx context.Context) {
@@ -6,6 +6,7 @@ type Calls struct {
 	Provision                  []interface{}
 	PollChanges                []interface{}
 	GetProvisionerResolvedPath []interface{}
+	Report                     []interface{}
 }
 
 type DashboardProvisionerMock struct {
@@ -13,6 +14,7 @@ type DashboardProvisionerMock struct {
 	ProvisionFunc                  func() error
 	PollChangesFunc                func(ctx context.Context)
 	GetProvisionerResolvedPathFunc func(name string) string
+	ReportFunc                     func(opts ReportOptions) ([]*ProvisionerReport, error)
 }
 
 func NewDashboardProvisionerMock() *DashboardProvisionerMock {
@@ -43,3 +45,11 @@ func (dpm *DashboardProvisionerMock) GetProvisionerResolvedPath(name string) str
 	}
 	return ""
 }
+
+func (dpm *DashboardProvisionerMock) Report(opts ReportOptions) ([]*ProvisionerReport, error) {
+	dpm.Calls.Report = append(dpm.Calls.Report, opts)
+	if dpm.ReportFunc != nil {
+		return dpm.ReportFunc(opts)
+	}
+	return nil, nil
+}
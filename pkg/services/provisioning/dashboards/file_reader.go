@@ -29,6 +29,8 @@ type fileReader struct {
 	Path                         string
 	log                          log.Logger
 	dashboardProvisioningService dashboards.DashboardProvisioningService
+	// paused is set while the dashboards are read-only for maintenance, the disk is not walked then
+	paused bool
 }
 
 func NewDashboardFileReader(cfg *DashboardsAsConfig, log log.Logger) (*fileReader, error) {
@@ -71,6 +73,10 @@ func (fr *fileReader) pollChanges(ctx context.Context) {
 // startWalkingDisk traverses the file system for defined path, reads dashboard definition files and applies any change
 // to the database.
 func (fr *fileReader) startWalkingDisk() error {
+	if fr.pausedForMaintenance() {
+		return nil
+	}
+
 	fr.log.Debug("Start walking disk", "path", fr.Path)
 	resolvedPath := fr.resolvedPath()
 	if _, err := os.Stat(resolvedPath); err != nil {
@@ -110,6 +116,25 @@ func (fr *fileReader) startWalkingDisk() error {
 	return nil
 }
 
+// pausedForMaintenance tells whether the dashboards are read-only for maintenance, so the changes on disk are applied
+// once it ends rather than failing on every dashboard. Pausing and resuming are logged once.
+func (fr *fileReader) pausedForMaintenance() bool {
+	maintenance, err := fr.dashboardProvisioningService.GetMaintenance()
+	if err != nil {
+		fr.log.Warn("failed to read the maintenance of dashboards", "error", err)
+	}
+
+	readOnly := maintenance != nil && maintenance.ReadOnly
+	if readOnly && !fr.paused {
+		fr.log.Info("pausing dashboard provisioning, dashboards are read-only for maintenance", "provisioner", fr.Cfg.Name, "message", maintenance.Message)
+	} else if !readOnly && fr.paused {
+		fr.log.Info("resuming dashboard provisioning, the maintenance of dashboards ended", "provisioner", fr.Cfg.Name)
+	}
+
+	fr.paused = readOnly
+	return readOnly
+}
+
 // handleMissingDashboardFiles will unprovision or delete dashboards which are missing on disk.
 func (fr *fileReader) handleMissingDashboardFiles(provisionedDashboardRefs map[string]*models.DashboardProvisioning, filesFoundOnDisk map[string]os.FileInfo) {
 	// find dashboards to delete since json file is missing
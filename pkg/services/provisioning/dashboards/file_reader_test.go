@@ -139,6 +139,26 @@ func TestDashboardFileReader(t *testing.T) {
 				So(len(fakeService.inserted), ShouldEqual, 1)
 			})
 
+			Convey("Pauses while the dashboards are read-only for maintenance", func() {
+				cfg.Options["path"] = defaultDashboards
+				fakeService.maintenance = &dashboards.MaintenanceStatus{ReadOnly: true, Message: "Upgrading the database"}
+
+				reader, err := NewDashboardFileReader(cfg, logger)
+				So(err, ShouldBeNil)
+
+				So(reader.startWalkingDisk(), ShouldBeNil)
+				So(reader.paused, ShouldBeTrue)
+				So(fakeService.inserted, ShouldBeEmpty)
+
+				Convey("Should apply the changes once the maintenance ends", func() {
+					fakeService.maintenance = &dashboards.MaintenanceStatus{}
+
+					So(reader.startWalkingDisk(), ShouldBeNil)
+					So(reader.paused, ShouldBeFalse)
+					So(len(fakeService.inserted), ShouldEqual, 2)
+				})
+			})
+
 			Convey("Overrides id from dashboard.json files", func() {
 				cfg.Options["path"] = containingId
 
@@ -358,6 +378,14 @@ type fakeDashboardProvisioningService struct {
 	inserted     []*dashboards.SaveDashboardDTO
 	provisioned  map[string][]*models.DashboardProvisioning
 	getDashboard []*models.Dashboard
+	maintenance  *dashboards.MaintenanceStatus
+}
+
+func (s *fakeDashboardProvisioningService) GetMaintenance() (*dashboards.MaintenanceStatus, error) {
+	if s.maintenance == nil {
+		return &dashboards.MaintenanceStatus{}, nil
+	}
+	return s.maintenance, nil
 }
 
 func (s *fakeDashboardProvisioningService) GetProvisionedDashboardData(name string) ([]*models.DashboardProvisioning, error) {
@@ -439,6 +467,10 @@ func (s *fakeDashboardProvisioningService) GetProvisionedDashboardDataByDashboar
 	return nil, nil
 }
 
+func (s *fakeDashboardProvisioningService) GetProvisionedDashboardDataByDashboardIds(dashboardIds []int64) (map[int64]*models.DashboardProvisioning, error) {
+	return map[int64]*models.DashboardProvisioning{}, nil
+}
+
 func mockGetDashboardQuery(cmd *models.GetDashboardQuery) error {
 	for _, d := range fakeService.getDashboard {
 		if d.Slug == cmd.Slug {
@@ -0,0 +1,164 @@
+package dashboards
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/dashdiffs"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ReportOptions controls what the report of the dashboard provisioners includes
+type ReportOptions struct {
+	// IncludeDiffs adds the diff of each changed dashboard. It loads every changed dashboard,
+	// which is expensive for large sets of dashboards.
+	IncludeDiffs bool
+}
+
+// ProvisionerReport compares the dashboard files of a provisioner with the dashboards they provisioned,
+// without saving anything. A dashboard is changed when the checksum of its file differs from the checksum
+// stored when it was provisioned.
+type ProvisionerReport struct {
+	Name      string           `json:"name"`
+	Unchanged int              `json:"unchanged"`
+	Changed   int              `json:"changed"`
+	New       int              `json:"new"`
+	Missing   int              `json:"missing"`
+	Invalid   int              `json:"invalid"`
+	Diffs     []*DashboardDiff `json:"diffs,omitempty"`
+}
+
+// DashboardDiff is the difference between a provisioned dashboard as stored and its file. Fields the store
+// sets on every save are ignored. An empty diff means only the formatting of the file changed.
+type DashboardDiff struct {
+	Path        string          `json:"path"`
+	DashboardId int64           `json:"dashboardId"`
+	Title       string          `json:"title"`
+	Diff        json.RawMessage `json:"diff,omitempty"`
+}
+
+// report compares the files on disk with the provisioned dashboards
+func (fr *fileReader) report(opts ReportOptions) (*ProvisionerReport, error) {
+	report := &ProvisionerReport{Name: fr.Cfg.Name}
+
+	resolvedPath := fr.resolvedPath()
+	if _, err := os.Stat(resolvedPath); err != nil {
+		return nil, err
+	}
+
+	provisionedDashboardRefs, err := getProvisionedDashboardByPath(fr.dashboardProvisioningService, fr.Cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	filesFoundOnDisk := map[string]os.FileInfo{}
+	err = filepath.Walk(resolvedPath, createWalkFn(filesFoundOnDisk))
+	if err != nil {
+		return nil, err
+	}
+
+	for path := range provisionedDashboardRefs {
+		if _, existsOnDisk := filesFoundOnDisk[path]; !existsOnDisk {
+			report.Missing++
+		}
+	}
+
+	paths := make([]string, 0, len(filesFoundOnDisk))
+	for path := range filesFoundOnDisk {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		resolvedFileInfo, err := resolveSymlink(filesFoundOnDisk[path], path)
+		if err != nil {
+			report.Invalid++
+			continue
+		}
+
+		jsonFile, err := fr.readDashboardFromFile(path, resolvedFileInfo.ModTime(), 0)
+		if err != nil {
+			report.Invalid++
+			continue
+		}
+
+		provisionedData, alreadyProvisioned := provisionedDashboardRefs[path]
+		switch {
+		case !alreadyProvisioned:
+			report.New++
+		case jsonFile.checkSum == provisionedData.CheckSum:
+			report.Unchanged++
+		default:
+			report.Changed++
+			if !opts.IncludeDiffs {
+				continue
+			}
+
+			diff, err := fr.diffDashboard(path, provisionedData.DashboardId, jsonFile)
+			if err != nil {
+				return nil, err
+			}
+			report.Diffs = append(report.Diffs, diff)
+		}
+	}
+
+	return report, nil
+}
+
+// diffDashboard returns the diff of the stored dashboard to its file
+func (fr *fileReader) diffDashboard(path string, dashboardId int64, jsonFile *dashboardJsonFile) (*DashboardDiff, error) {
+	query := &models.GetDashboardQuery{Id: dashboardId, OrgId: fr.Cfg.OrgId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	desired := jsonFile.dashboard.Dashboard
+	stored, err := normalizeForDiff(query.Result.Data, desired.Uid != "")
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := normalizeForDiff(desired.Data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DashboardDiff{Path: path, DashboardId: dashboardId, Title: desired.Title}
+
+	diff, err := dashdiffs.CalculateJSONDiff(stored, file, dashdiffs.DiffDelta)
+	if err == dashdiffs.ErrNilDiff {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Diff = diff.Delta
+	return result, nil
+}
+
+// normalizeForDiff returns a copy of the dashboard model without the id and version, which the store sets
+// on every save. The uid is removed too when the file does not set it, as the store generates one.
+func normalizeForDiff(data *simplejson.Json, keepUid bool) (*simplejson.Json, error) {
+	encoded, err := data.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := simplejson.NewJson(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized.Del("id")
+	normalized.Del("version")
+	if !keepUid {
+		normalized.Del("uid")
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,120 @@
+package dashboards
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/util"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardFileReaderReport(t *testing.T) {
+	Convey("Given provisioned dashboards", t, func() {
+		bus.ClearBusHandlers()
+		origNewDashboardProvisioningService := dashboards.NewProvisioningService
+		fakeService = mockDashboardProvisioningService()
+
+		path1, err := filepath.Abs(defaultDashboards + "/dashboard1.json")
+		So(err, ShouldBeNil)
+		path2, err := filepath.Abs(defaultDashboards + "/dashboard2.json")
+		So(err, ShouldBeNil)
+		// the file has been deleted since it was provisioned
+		path3, err := filepath.Abs(defaultDashboards + "/dashboard3.json")
+		So(err, ShouldBeNil)
+
+		content1, err := ioutil.ReadFile(path1)
+		So(err, ShouldBeNil)
+		checkSum1, err := util.Md5SumString(string(content1))
+		So(err, ShouldBeNil)
+
+		fakeService.provisioned = map[string][]*models.DashboardProvisioning{
+			"Default": {
+				{DashboardId: 1, Name: "Default", ExternalId: path1, CheckSum: checkSum1},
+				{DashboardId: 2, Name: "Default", ExternalId: path2, CheckSum: "outdated"},
+				{DashboardId: 3, Name: "Default", ExternalId: path3, CheckSum: "outdated"},
+			},
+		}
+
+		content2, err := ioutil.ReadFile(path2)
+		So(err, ShouldBeNil)
+		stored, err := simplejson.NewJson(content2)
+		So(err, ShouldBeNil)
+		stored.Set("id", 2)
+		stored.Set("uid", "generated")
+		stored.Set("version", 12)
+
+		var queries []*models.GetDashboardQuery
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			queries = append(queries, query)
+			query.Result = models.NewDashboardFromJson(stored)
+			return nil
+		})
+
+		cfg := &DashboardsAsConfig{
+			Name:    "Default",
+			Type:    "file",
+			OrgId:   1,
+			Options: map[string]interface{}{"path": defaultDashboards},
+		}
+		reader, err := NewDashboardFileReader(cfg, log.New("test-logger"))
+		So(err, ShouldBeNil)
+
+		Convey("Should count the changes without diffs by default", func() {
+			report, err := reader.report(ReportOptions{})
+			So(err, ShouldBeNil)
+
+			So(report, ShouldResemble, &ProvisionerReport{Name: "Default", Unchanged: 1, Changed: 1, Missing: 1})
+			So(queries, ShouldBeEmpty)
+			So(fakeService.inserted, ShouldBeEmpty)
+		})
+
+		Convey("Should report an empty diff when only store managed fields differ", func() {
+			report, err := reader.report(ReportOptions{IncludeDiffs: true})
+			So(err, ShouldBeNil)
+
+			So(report.Changed, ShouldEqual, 1)
+			So(len(report.Diffs), ShouldEqual, 1)
+			So(report.Diffs[0].Path, ShouldEqual, path2)
+			So(report.Diffs[0].DashboardId, ShouldEqual, 2)
+			So(report.Diffs[0].Title, ShouldEqual, "Grafana2")
+			So(report.Diffs[0].Diff, ShouldBeNil)
+			So(queries[0].Id, ShouldEqual, 2)
+			So(queries[0].OrgId, ShouldEqual, 1)
+		})
+
+		Convey("Should report the fields that drifted", func() {
+			stored.Set("refresh", "1m")
+			stored.Set("title", "Edited in Grafana")
+
+			report, err := reader.report(ReportOptions{IncludeDiffs: true})
+			So(err, ShouldBeNil)
+
+			diff, err := simplejson.NewJson(report.Diffs[0].Diff)
+			So(err, ShouldBeNil)
+			So(diff.MustMap(), ShouldContainKey, "refresh")
+			So(diff.MustMap(), ShouldContainKey, "title")
+			So(diff.MustMap(), ShouldNotContainKey, "id")
+			So(diff.MustMap(), ShouldNotContainKey, "uid")
+			So(diff.MustMap(), ShouldNotContainKey, "version")
+		})
+
+		Convey("Should count new dashboards", func() {
+			fakeService.provisioned = map[string][]*models.DashboardProvisioning{}
+
+			report, err := reader.report(ReportOptions{IncludeDiffs: true})
+			So(err, ShouldBeNil)
+
+			So(report, ShouldResemble, &ProvisionerReport{Name: "Default", New: 2})
+		})
+
+		Reset(func() {
+			dashboards.NewProvisioningService = origNewDashboardProvisioningService
+		})
+	})
+}
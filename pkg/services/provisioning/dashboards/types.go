@@ -20,6 +20,8 @@ type DashboardsAsConfig struct {
 	Options               map[string]interface{}
 	DisableDeletion       bool
 	UpdateIntervalSeconds int64
+	// AllowAdoption lets the provider take over the dashboards using the uids of its files that are not provisioned
+	AllowAdoption bool
 }
 
 type DashboardsAsConfigV0 struct {
@@ -32,6 +34,7 @@ type DashboardsAsConfigV0 struct {
 	Options               map[string]interface{} `json:"options" yaml:"options"`
 	DisableDeletion       bool                   `json:"disableDeletion" yaml:"disableDeletion"`
 	UpdateIntervalSeconds int64                  `json:"updateIntervalSeconds" yaml:"updateIntervalSeconds"`
+	AllowAdoption         bool                   `json:"allowAdoption" yaml:"allowAdoption"`
 }
 
 type ConfigVersion struct {
@@ -52,6 +55,7 @@ type DashboardProviderConfigs struct {
 	Options               values.JSONValue   `json:"options" yaml:"options"`
 	DisableDeletion       values.BoolValue   `json:"disableDeletion" yaml:"disableDeletion"`
 	UpdateIntervalSeconds values.Int64Value  `json:"updateIntervalSeconds" yaml:"updateIntervalSeconds"`
+	AllowAdoption         values.BoolValue   `json:"allowAdoption" yaml:"allowAdoption"`
 }
 
 func createDashboardJson(data *simplejson.Json, lastModified time.Time, cfg *DashboardsAsConfig, folderId int64) (*dashboards.SaveDashboardDTO, error) {
@@ -59,6 +63,9 @@ func createDashboardJson(data *simplejson.Json, lastModified time.Time, cfg *Das
 	dash.Dashboard = models.NewDashboardFromJson(data)
 	dash.UpdatedAt = lastModified
 	dash.Overwrite = true
+	// the file is the source of the uid of provisioned dashboards
+	dash.AllowUidChange = true
+	dash.AllowAdoption = cfg.AllowAdoption
 	dash.OrgId = cfg.OrgId
 	dash.Dashboard.OrgId = cfg.OrgId
 	dash.Dashboard.FolderId = folderId
@@ -84,6 +91,7 @@ func mapV0ToDashboardAsConfig(v0 []*DashboardsAsConfigV0) []*DashboardsAsConfig
 			Options:               v.Options,
 			DisableDeletion:       v.DisableDeletion,
 			UpdateIntervalSeconds: v.UpdateIntervalSeconds,
+			AllowAdoption:         v.AllowAdoption,
 		})
 	}
 
@@ -104,6 +112,7 @@ func (dc *DashboardAsConfigV1) mapToDashboardAsConfig() []*DashboardsAsConfig {
 			Options:               v.Options.Value(),
 			DisableDeletion:       v.DisableDeletion.Value(),
 			UpdateIntervalSeconds: v.UpdateIntervalSeconds.Value(),
+			AllowAdoption:         v.AllowAdoption.Value(),
 		})
 	}
 
@@ -19,6 +19,7 @@ type DashboardProvisioner interface {
 	Provision() error
 	PollChanges(ctx context.Context)
 	GetProvisionerResolvedPath(name string) string
+	Report(opts dashboards.ReportOptions) ([]*dashboards.ProvisionerReport, error)
 }
 
 type DashboardProvisionerFactory func(string) (DashboardProvisioner, error)
@@ -133,6 +134,14 @@ func (ps *provisioningServiceImpl) ProvisionDashboards() error {
 	return nil
 }
 
+// ReportDashboards compares the provisioned dashboards with their files
+func (ps *provisioningServiceImpl) ReportDashboards(opts dashboards.ReportOptions) ([]*dashboards.ProvisionerReport, error) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	return ps.dashboardProvisioner.Report(opts)
+}
+
 func (ps *provisioningServiceImpl) GetDashboardProvisionerResolvedPath(name string) string {
 	return ps.dashboardProvisioner.GetProvisionerResolvedPath(name)
 }
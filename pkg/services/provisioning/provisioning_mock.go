@@ -1,10 +1,13 @@
 package provisioning
 
+import "github.com/grafana/grafana/pkg/services/provisioning/dashboards"
+
 type Calls struct {
 	ProvisionDatasources                []interface{}
 	ProvisionNotifications              []interface{}
 	ProvisionDashboards                 []interface{}
 	GetDashboardProvisionerResolvedPath []interface{}
+	ReportDashboards                    []interface{}
 }
 
 type ProvisioningServiceMock struct {
@@ -13,6 +16,7 @@ type ProvisioningServiceMock struct {
 	ProvisionNotificationsFunc              func() error
 	ProvisionDashboardsFunc                 func() error
 	GetDashboardProvisionerResolvedPathFunc func(name string) string
+	ReportDashboardsFunc                    func(opts dashboards.ReportOptions) ([]*dashboards.ProvisionerReport, error)
 }
 
 func NewProvisioningServiceMock() *ProvisioningServiceMock {
@@ -52,3 +56,11 @@ func (mock *ProvisioningServiceMock) GetDashboardProvisionerResolvedPath(name st
 	}
 	return ""
 }
+
+func (mock *ProvisioningServiceMock) ReportDashboards(opts dashboards.ReportOptions) ([]*dashboards.ProvisionerReport, error) {
+	mock.Calls.ReportDashboards = append(mock.Calls.ReportDashboards, opts)
+	if mock.ReportDashboardsFunc != nil {
+		return mock.ReportDashboardsFunc(opts)
+	}
+	return nil, nil
+}
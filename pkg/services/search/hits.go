@@ -24,6 +24,7 @@ type Hit struct {
 	FolderUid   string   `json:"folderUid,omitempty"`
 	FolderTitle string   `json:"folderTitle,omitempty"`
 	FolderUrl   string   `json:"folderUrl,omitempty"`
+	Source      string   `json:"source,omitempty"`
 }
 
 type HitList []*Hit
@@ -24,6 +24,7 @@ type Query struct {
 	DashboardIds []int64
 	FolderIds    []int64
 	Permission   models.PermissionType
+	Source       string
 
 	Result HitList
 }
@@ -40,6 +41,7 @@ type FindPersistedDashboardsQuery struct {
 	Limit        int64
 	Page         int64
 	Permission   models.PermissionType
+	Source       string
 
 	Result HitList
 }
@@ -65,6 +67,7 @@ func (s *SearchService) searchHandler(query *Query) error {
 		Limit:        query.Limit,
 		Page:         query.Page,
 		Permission:   query.Permission,
+		Source:       query.Source,
 	}
 
 	if err := bus.Dispatch(&dashboardQuery); err != nil {
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/util"
 )
@@ -31,6 +32,12 @@ func init() {
 
 func DeleteAlertNotification(cmd *m.DeleteAlertNotificationCommand) error {
 	return inTransaction(func(sess *DBSession) error {
+		existing := m.AlertNotification{Id: cmd.Id, OrgId: cmd.OrgId}
+		exists, err := sess.Get(&existing)
+		if err != nil {
+			return err
+		}
+
 		sql := "DELETE FROM alert_notification WHERE alert_notification.org_id = ? AND alert_notification.id = ?"
 		if _, err := sess.Exec(sql, cmd.OrgId, cmd.Id); err != nil {
 			return err
@@ -40,6 +47,16 @@ func DeleteAlertNotification(cmd *m.DeleteAlertNotificationCommand) error {
 			return err
 		}
 
+		if exists {
+			sess.publishAfterCommit(&events.AlertNotificationDeleted{
+				Timestamp: time.Now(),
+				Id:        existing.Id,
+				Uid:       existing.Uid,
+				OrgId:     existing.OrgId,
+				Name:      existing.Name,
+			})
+		}
+
 		return nil
 	})
 }
@@ -271,6 +288,14 @@ func CreateAlertNotificationCommand(cmd *m.CreateAlertNotificationCommand) error
 			return err
 		}
 
+		sess.publishAfterCommit(&events.AlertNotificationCreated{
+			Timestamp: alertNotification.Created,
+			Id:        alertNotification.Id,
+			Uid:       alertNotification.Uid,
+			OrgId:     alertNotification.OrgId,
+			Name:      alertNotification.Name,
+		})
+
 		cmd.Result = alertNotification
 		return nil
 	})
@@ -299,6 +324,7 @@ func UpdateAlertNotification(cmd *m.UpdateAlertNotificationCommand) error {
 		if _, err = sess.ID(cmd.Id).Get(&current); err != nil {
 			return err
 		}
+		previousName := current.Name
 
 		// check if name exists
 		sameNameQuery := &m.GetAlertNotificationsQuery{OrgId: cmd.OrgId, Name: cmd.Name}
@@ -343,6 +369,15 @@ func UpdateAlertNotification(cmd *m.UpdateAlertNotificationCommand) error {
 			return fmt.Errorf("Could not update alert notification")
 		}
 
+		sess.publishAfterCommit(&events.AlertNotificationUpdated{
+			Timestamp:    current.Updated,
+			Id:           current.Id,
+			Uid:          current.Uid,
+			OrgId:        current.OrgId,
+			Name:         current.Name,
+			PreviousName: previousName,
+		})
+
 		cmd.Result = &current
 		return nil
 	})
@@ -8,6 +8,7 @@ import (
 	"github.com/grafana/grafana/pkg/infra/metrics"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/search"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/util"
 )
 
@@ -23,6 +24,8 @@ func init() {
 	bus.AddHandler("sql", GetDashboardsByPluginId)
 	bus.AddHandler("sql", GetDashboardPermissionsForUser)
 	bus.AddHandler("sql", GetDashboardsBySlug)
+	bus.AddHandler("sql", GetDashboardsByOrg)
+	bus.AddHandler("sql", GetOrphanedDashboards)
 	bus.AddHandler("sql", ValidateDashboardBeforeSave)
 	bus.AddHandler("sql", HasEditPermissionInFolders)
 	bus.AddHandler("sql", HasAdminPermissionInFolders)
@@ -123,6 +126,12 @@ func saveDashboard(sess *DBSession, cmd *models.SaveDashboardCommand) error {
 		Data:          dash.Data,
 	}
 
+	if meta := cmd.RequestMeta; meta != nil {
+		dashVersion.ClientIp = meta.ClientIp
+		dashVersion.UserAgent = meta.UserAgent
+		dashVersion.RequestId = meta.RequestId
+	}
+
 	// insert version entry
 	if affectedRows, err = sess.Insert(dashVersion); err != nil {
 		return err
@@ -146,6 +155,10 @@ func saveDashboard(sess *DBSession, cmd *models.SaveDashboardCommand) error {
 		}
 	}
 
+	if err := insertDashboardSyncOutbox(sess, dash, cmd.SyncOutbox); err != nil {
+		return err
+	}
+
 	cmd.Result = dash
 
 	return err
@@ -195,6 +208,7 @@ type DashboardSearchProjection struct {
 	FolderUid   string
 	FolderSlug  string
 	FolderTitle string
+	Source      string
 }
 
 func findDashboards(query *search.FindPersistedDashboardsQuery) ([]DashboardSearchProjection, error) {
@@ -218,6 +232,10 @@ func findDashboards(query *search.FindPersistedDashboardsQuery) ([]DashboardSear
 		sb.WithFolderIds(query.FolderIds)
 	}
 
+	if len(query.Source) > 0 {
+		sb.WithSource(query.Source)
+	}
+
 	var res []DashboardSearchProjection
 
 	sql, params := sb.ToSql()
@@ -268,6 +286,7 @@ func makeQueryResult(query *search.FindPersistedDashboardsQuery, res []Dashboard
 				FolderId:    item.FolderId,
 				FolderUid:   item.FolderUid,
 				FolderTitle: item.FolderTitle,
+				Source:      item.Source,
 				Tags:        []string{},
 			}
 
@@ -310,6 +329,24 @@ func DeleteDashboard(cmd *models.DeleteDashboardCommand) error {
 			return models.ErrDashboardNotFound
 		}
 
+		if err := checkDashboardNotProtected(sess, &dashboard); err != nil {
+			return err
+		}
+
+		if cmd.Version > 0 {
+			// the version is checked by the delete itself so a concurrent save cannot slip in between
+			res, err := sess.Exec("DELETE FROM dashboard WHERE id = ? AND version = ?", dashboard.Id, cmd.Version)
+			if err != nil {
+				return err
+			}
+
+			if affected, err := res.RowsAffected(); err != nil {
+				return err
+			} else if affected == 0 {
+				return models.ErrDashboardVersionMismatch
+			}
+		}
+
 		deletes := []string{
 			"DELETE FROM dashboard_tag WHERE dashboard_id = ? ",
 			"DELETE FROM star WHERE dashboard_id = ? ",
@@ -318,10 +355,28 @@ func DeleteDashboard(cmd *models.DeleteDashboardCommand) error {
 			"DELETE FROM dashboard_version WHERE dashboard_id = ?",
 			"DELETE FROM annotation WHERE dashboard_id = ?",
 			"DELETE FROM dashboard_provisioning WHERE dashboard_id = ?",
+			"DELETE FROM dashboard_git_sync WHERE dashboard_id = ?",
+			"DELETE FROM dashboard_git_sync_path WHERE dashboard_id = ?",
+			"DELETE FROM dashboard_view WHERE dashboard_id = ?",
+			"DELETE FROM folder_template WHERE folder_id = ?",
+			"DELETE FROM folder_template WHERE dashboard_id = ?",
+		}
+
+		if dashboard.IsFolder && cmd.OnlyIfEmpty {
+			// checked in the transaction so a dashboard moved into the folder meanwhile is not deleted with it
+			count, err := sess.Where("folder_id = ?", dashboard.Id).Count(&models.Dashboard{})
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return models.ErrFolderNotEmpty
+			}
 		}
 
 		if dashboard.IsFolder {
 			deletes = append(deletes, "DELETE FROM dashboard_provisioning WHERE dashboard_id in (select id from dashboard where folder_id = ?)")
+			deletes = append(deletes, "DELETE FROM dashboard_view WHERE dashboard_id in (select id from dashboard where folder_id = ?)")
+			deletes = append(deletes, "DELETE FROM folder_template WHERE dashboard_id in (select id from dashboard where folder_id = ?)")
 			deletes = append(deletes, "DELETE FROM dashboard WHERE folder_id = ?")
 
 			dashIds := []struct {
@@ -355,6 +410,28 @@ func DeleteDashboard(cmd *models.DeleteDashboardCommand) error {
 	})
 }
 
+// checkDashboardNotProtected returns ErrDashboardProtected for protected dashboards and folders holding one
+func checkDashboardNotProtected(sess *DBSession, dashboard *models.Dashboard) error {
+	if models.IsProtectedDashboardUid(dashboard.Uid) {
+		return models.ErrDashboardProtected
+	}
+
+	if !dashboard.IsFolder || len(setting.DashboardProtectedUids) == 0 {
+		return nil
+	}
+
+	count, err := sess.Where("org_id = ? AND folder_id = ?", dashboard.OrgId, dashboard.Id).In("uid", setting.DashboardProtectedUids).Count(&models.Dashboard{})
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return models.ErrDashboardProtected
+	}
+
+	return nil
+}
+
 func GetDashboards(query *models.GetDashboardsQuery) error {
 	if len(query.DashboardIds) == 0 {
 		return models.ErrCommandValidationFailed
@@ -367,6 +444,29 @@ func GetDashboards(query *models.GetDashboardsQuery) error {
 	return err
 }
 
+func GetDashboardsByOrg(query *models.GetDashboardsByOrgQuery) error {
+	var dashboards = make([]*models.Dashboard, 0)
+
+	err := x.Where("org_id = ?", query.OrgId).Desc("is_folder").Asc("id").Find(&dashboards)
+	query.Result = dashboards
+	return err
+}
+
+// GetOrphanedDashboards returns the dashboards of the organization referencing a folder that does not exist in it,
+// or a dashboard that is not a folder
+func GetOrphanedDashboards(query *models.GetOrphanedDashboardsQuery) error {
+	var dashboards = make([]*models.Dashboard, 0)
+
+	rawSQL := `SELECT dashboard.* FROM dashboard
+		LEFT OUTER JOIN dashboard AS folder ON folder.id = dashboard.folder_id AND folder.org_id = dashboard.org_id
+		WHERE dashboard.org_id = ? AND dashboard.folder_id > 0 AND (folder.id IS NULL OR folder.is_folder = ?)
+		ORDER BY dashboard.id`
+
+	err := x.SQL(rawSQL, query.OrgId, dialect.BooleanStr(false)).Find(&dashboards)
+	query.Result = dashboards
+	return err
+}
+
 // GetDashboardPermissionsForUser returns the maximum permission the specified user has for a dashboard(s)
 // The function takes in a list of dashboard ids and the user id and role
 func GetDashboardPermissionsForUser(query *models.GetDashboardPermissionsForUserQuery) error {
@@ -545,6 +645,16 @@ func getExistingDashboardByIdOrUidForUpdate(sess *DBSession, cmd *models.Validat
 		return models.ErrDashboardWithSameUIDExists
 	}
 
+	// a changed uid breaks the links to the dashboard and the name of its git file, it must be asked for
+	if dashWithIdExists && dash.Uid != existingById.Uid {
+		if models.IsProtectedDashboardUid(existingById.Uid) {
+			return models.ErrDashboardProtected
+		}
+		if !cmd.AllowUidChange {
+			return models.ErrDashboardUidChanged
+		}
+	}
+
 	existing := existingById
 
 	if !dashWithIdExists && dashWithUidExists {
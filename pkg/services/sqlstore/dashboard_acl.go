@@ -8,6 +8,7 @@ import (
 func init() {
 	bus.AddHandler("sql", UpdateDashboardAcl)
 	bus.AddHandler("sql", GetDashboardAclInfoList)
+	bus.AddHandler("sql", GetFolderAclList)
 }
 
 func UpdateDashboardAcl(cmd *m.UpdateDashboardAclCommand) error {
@@ -125,3 +126,46 @@ func GetDashboardAclInfoList(query *m.GetDashboardAclInfoListQuery) error {
 
 	return err
 }
+
+// GetFolderAclList returns the permissions set on a folder and on the dashboards in it, the folder first and
+// then the dashboards by title.
+func GetFolderAclList(query *m.GetFolderAclListQuery) error {
+	rawSQL := `
+		SELECT
+			da.id,
+			da.org_id,
+			da.dashboard_id,
+			da.user_id,
+			da.team_id,
+			da.permission,
+			da.role,
+			da.created,
+			da.updated,
+			u.login AS user_login,
+			u.email AS user_email,
+			ug.name AS team,
+			ug.email AS team_email,
+			d.title,
+			d.slug,
+			d.uid,
+			d.is_folder,
+			` + dialect.BooleanStr(false) + ` AS inherited
+		FROM dashboard_acl AS da
+			INNER JOIN dashboard AS d ON d.id = da.dashboard_id
+			LEFT JOIN ` + dialect.Quote("user") + ` AS u ON u.id = da.user_id
+			LEFT JOIN team ug on ug.id = da.team_id
+		WHERE d.org_id = ? AND (d.id = ? OR (d.folder_id = ? AND d.is_folder = ` + dialect.BooleanStr(false) + `))
+		ORDER BY d.is_folder DESC, d.title ASC, da.id ASC
+		`
+
+	query.Result = make([]*m.DashboardAclInfoDTO, 0)
+	if err := x.SQL(rawSQL, query.OrgId, query.FolderId, query.FolderId).Find(&query.Result); err != nil {
+		return err
+	}
+
+	for _, p := range query.Result {
+		p.PermissionName = p.Permission.String()
+	}
+
+	return nil
+}
@@ -218,6 +218,45 @@ func TestDashboardAclDataAccess(t *testing.T) {
 					So(q3.Result[0].TeamId, ShouldEqual, group1.Result.Id)
 				})
 			})
+
+			Convey("Given permissions on the folder and on its dashboard", func() {
+				err := testHelperUpdateDashboardAcl(savedFolder.Id, m.DashboardAcl{
+					OrgId:       1,
+					UserId:      currentUser.Id,
+					DashboardId: savedFolder.Id,
+					Permission:  m.PERMISSION_ADMIN,
+				})
+				So(err, ShouldBeNil)
+
+				err = testHelperUpdateDashboardAcl(childDash.Id, m.DashboardAcl{
+					OrgId:       1,
+					UserId:      currentUser.Id,
+					DashboardId: childDash.Id,
+					Permission:  m.PERMISSION_EDIT,
+				})
+				So(err, ShouldBeNil)
+
+				Convey("When reading the folder acl list should return the permissions of both", func() {
+					query := &m.GetFolderAclListQuery{FolderId: savedFolder.Id, OrgId: 1}
+					err := GetFolderAclList(query)
+					So(err, ShouldBeNil)
+
+					So(len(query.Result), ShouldEqual, 2)
+					So(query.Result[0].DashboardId, ShouldEqual, savedFolder.Id)
+					So(query.Result[0].IsFolder, ShouldBeTrue)
+					So(query.Result[0].UserLogin, ShouldEqual, "viewer")
+					So(query.Result[1].DashboardId, ShouldEqual, childDash.Id)
+					So(query.Result[1].Title, ShouldEqual, "2 test dash")
+					So(query.Result[1].Permission, ShouldEqual, m.PERMISSION_EDIT)
+				})
+
+				Convey("When reading the acl list of the General folder should not include other folders", func() {
+					query := &m.GetFolderAclListQuery{FolderId: 0, OrgId: 1}
+					err := GetFolderAclList(query)
+					So(err, ShouldBeNil)
+					So(query.Result, ShouldBeEmpty)
+				})
+			})
 		})
 
 		Convey("Given a root folder", func() {
@@ -0,0 +1,134 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+func init() {
+	bus.AddHandler("sql", SaveDashboardGitSync)
+	bus.AddHandler("sql", GetDashboardGitSync)
+	bus.AddHandler("sql", GetDashboardGitSyncs)
+	bus.AddHandler("sql", FindDashboardGitSyncPaths)
+}
+
+// SaveDashboardGitSync stores the last commit of a dashboard, replacing the previous one. The path of the
+// commit is added to the paths the dashboard has been synced to.
+func SaveDashboardGitSync(cmd *models.SaveDashboardGitSyncCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		existing := &models.DashboardGitSync{}
+		exist, err := sess.Where("dashboard_id = ?", cmd.DashboardId).Get(existing)
+		if err != nil {
+			return err
+		}
+
+		sync := &models.DashboardGitSync{
+			Id:          existing.Id,
+			DashboardId: cmd.DashboardId,
+			OrgId:       cmd.OrgId,
+			Provider:    cmd.Provider,
+			RepoId:      cmd.RepoId,
+			FilePath:    cmd.FilePath,
+			CommitSha:   cmd.CommitSha,
+			CommitMode:  cmd.CommitMode,
+			Branch:      cmd.Branch,
+			Updated:     time.Now(),
+
+			FallbackAction:    cmd.FallbackAction,
+			SourceFormat:      cmd.SourceFormat,
+			ContentHash:       cmd.ContentHash,
+			ConflictCommitSha: cmd.ConflictCommitSha,
+		}
+
+		if meta := cmd.RequestMeta; meta != nil {
+			sync.ClientIp = meta.ClientIp
+			sync.UserAgent = meta.UserAgent
+			sync.RequestId = meta.RequestId
+		}
+
+		if exist {
+			_, err = sess.ID(existing.Id).AllCols().Update(sync)
+		} else {
+			_, err = sess.Insert(sync)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := saveDashboardGitSyncPath(sess, sync); err != nil {
+			return err
+		}
+
+		cmd.Result = sync
+		return nil
+	})
+}
+
+func saveDashboardGitSyncPath(sess *DBSession, sync *models.DashboardGitSync) error {
+	hash, err := util.Md5SumString(sync.FilePath)
+	if err != nil {
+		return err
+	}
+
+	syncPath := &models.DashboardGitSyncPath{
+		DashboardId: sync.DashboardId,
+		OrgId:       sync.OrgId,
+		RepoId:      sync.RepoId,
+		FilePath:    sync.FilePath,
+		PathHash:    hash,
+		Updated:     sync.Updated,
+	}
+
+	existing := &models.DashboardGitSyncPath{}
+	exist, err := sess.Where("dashboard_id = ? AND repo_id = ? AND path_hash = ?", sync.DashboardId, sync.RepoId, hash).Get(existing)
+	if err != nil {
+		return err
+	}
+
+	if exist {
+		_, err = sess.ID(existing.Id).Cols("updated").Update(syncPath)
+	} else {
+		_, err = sess.Insert(syncPath)
+	}
+	return err
+}
+
+// GetDashboardGitSync returns the last commit of a dashboard, or a nil result if it has never been synced.
+func GetDashboardGitSync(query *models.GetDashboardGitSyncQuery) error {
+	result := &models.DashboardGitSync{}
+
+	exist, err := x.Where("dashboard_id = ?", query.DashboardId).Get(result)
+	if err != nil {
+		return err
+	}
+	if exist {
+		query.Result = result
+	}
+	return nil
+}
+
+// GetDashboardGitSyncs returns the last commits of all synced dashboards of an organization.
+func GetDashboardGitSyncs(query *models.GetDashboardGitSyncsQuery) error {
+	query.Result = make([]*models.DashboardGitSync, 0)
+	return x.Where("org_id = ?", query.OrgId).Asc("dashboard_id").Find(&query.Result)
+}
+
+// FindDashboardGitSyncPaths returns the dashboards synced to a path, using the index on the hash of the path.
+func FindDashboardGitSyncPaths(query *models.FindDashboardGitSyncPathsQuery) error {
+	hash, err := util.Md5SumString(query.FilePath)
+	if err != nil {
+		return err
+	}
+
+	sess := x.Where("org_id = ? AND path_hash = ? AND file_path = ?", query.OrgId, hash, query.FilePath)
+	if query.RepoId > 0 {
+		sess = sess.And("repo_id = ?", query.RepoId)
+	}
+
+	query.Result = make([]*models.DashboardGitSyncPath, 0)
+	return sess.Desc("updated").Find(&query.Result)
+}
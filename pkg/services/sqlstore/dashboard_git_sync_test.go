@@ -0,0 +1,195 @@
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardGitSyncDataAccess(t *testing.T) {
+	Convey("Testing dashboard git sync data access", t, func() {
+		InitTestDB(t)
+
+		dash := insertTestDashboard("synced dashboard", 1, 0, false)
+
+		Convey("Should return no result for a dashboard that was never synced", func() {
+			query := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+			err := GetDashboardGitSync(query)
+			So(err, ShouldBeNil)
+			So(query.Result, ShouldBeNil)
+		})
+
+		Convey("Given a synced dashboard", func() {
+			err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+				DashboardId: dash.Id,
+				OrgId:       1,
+				Provider:    "gitlab",
+				FilePath:    "dashboards/General/synced-dashboard.json",
+				CommitSha:   "abc",
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Saving a new commit should replace the previous one", func() {
+				err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+					DashboardId: dash.Id,
+					OrgId:       1,
+					Provider:    "gitlab",
+					FilePath:    "dashboards/Team/synced-dashboard.json",
+					CommitSha:   "def",
+				})
+				So(err, ShouldBeNil)
+
+				query := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+				err = GetDashboardGitSync(query)
+				So(err, ShouldBeNil)
+				So(query.Result.CommitSha, ShouldEqual, "def")
+				So(query.Result.FilePath, ShouldEqual, "dashboards/Team/synced-dashboard.json")
+				So(query.Result.Updated.IsZero(), ShouldBeFalse)
+			})
+
+			Convey("Should record where the commit was requested from", func() {
+				err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+					DashboardId: dash.Id,
+					OrgId:       1,
+					Provider:    "gitlab",
+					FilePath:    "dashboards/General/synced-dashboard.json",
+					CommitSha:   "def",
+					RequestMeta: &models.RequestMeta{ClientIp: "192.168.1.10", UserAgent: "curl/7.64.1", RequestId: "f3a9c2"},
+				})
+				So(err, ShouldBeNil)
+
+				query := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+				So(GetDashboardGitSync(query), ShouldBeNil)
+				So(query.Result.ClientIp, ShouldEqual, "192.168.1.10")
+				So(query.Result.UserAgent, ShouldEqual, "curl/7.64.1")
+				So(query.Result.RequestId, ShouldEqual, "f3a9c2")
+			})
+
+			Convey("Should record the fallback action of the commit", func() {
+				err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+					DashboardId:    dash.Id,
+					OrgId:          1,
+					Provider:       "gitlab",
+					FilePath:       "dashboards/General/synced-dashboard.json",
+					CommitSha:      "def",
+					FallbackAction: models.GitFallbackCreate,
+				})
+				So(err, ShouldBeNil)
+
+				query := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+				So(GetDashboardGitSync(query), ShouldBeNil)
+				So(query.Result.FallbackAction, ShouldEqual, models.GitFallbackCreate)
+			})
+
+			Convey("Should record the format of the source the dashboard was rendered from", func() {
+				err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+					DashboardId:  dash.Id,
+					OrgId:        1,
+					Provider:     "gitlab",
+					FilePath:     "dashboards/General/synced-dashboard.jsonnet",
+					SourceFormat: models.GitSourceFormatJsonnet,
+				})
+				So(err, ShouldBeNil)
+
+				query := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+				So(GetDashboardGitSync(query), ShouldBeNil)
+				So(query.Result.SourceFormat, ShouldEqual, models.GitSourceFormatJsonnet)
+			})
+
+			Convey("Should record the content hash and the conflicting commit of a skipped commit", func() {
+				err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+					DashboardId:       dash.Id,
+					OrgId:             1,
+					Provider:          "gitlab",
+					FilePath:          "dashboards/General/synced-dashboard.json",
+					CommitSha:         "abc",
+					ContentHash:       "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+					ConflictCommitSha: "e83c5163316f89bfbde7d9ab23ca2e25604af290",
+				})
+				So(err, ShouldBeNil)
+
+				query := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+				So(GetDashboardGitSync(query), ShouldBeNil)
+				So(query.Result.ContentHash, ShouldEqual, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+				So(query.Result.ConflictCommitSha, ShouldEqual, "e83c5163316f89bfbde7d9ab23ca2e25604af290")
+			})
+
+			Convey("Should list the synced dashboards of the organization", func() {
+				other := insertTestDashboard("other org dashboard", 2, 0, false)
+				err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+					DashboardId: other.Id,
+					OrgId:       2,
+					Provider:    "gitlab",
+					FilePath:    "dashboards/General/other-org-dashboard.json",
+					CommitSha:   "abc",
+				})
+				So(err, ShouldBeNil)
+
+				query := &models.GetDashboardGitSyncsQuery{OrgId: 1}
+				err = GetDashboardGitSyncs(query)
+				So(err, ShouldBeNil)
+				So(len(query.Result), ShouldEqual, 1)
+				So(query.Result[0].DashboardId, ShouldEqual, dash.Id)
+			})
+
+			Convey("Should find the dashboard by its current and previous paths", func() {
+				err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+					DashboardId: dash.Id,
+					OrgId:       1,
+					Provider:    "gitlab",
+					RepoId:      7,
+					FilePath:    "dashboards/Team/synced-dashboard.json",
+					CommitSha:   "def",
+				})
+				So(err, ShouldBeNil)
+
+				for _, filePath := range []string{"dashboards/General/synced-dashboard.json", "dashboards/Team/synced-dashboard.json"} {
+					query := &models.FindDashboardGitSyncPathsQuery{OrgId: 1, FilePath: filePath}
+					So(FindDashboardGitSyncPaths(query), ShouldBeNil)
+					So(len(query.Result), ShouldEqual, 1)
+					So(query.Result[0].DashboardId, ShouldEqual, dash.Id)
+				}
+
+				query := &models.FindDashboardGitSyncPathsQuery{OrgId: 1, RepoId: 7, FilePath: "dashboards/General/synced-dashboard.json"}
+				So(FindDashboardGitSyncPaths(query), ShouldBeNil)
+				So(query.Result, ShouldBeEmpty)
+
+				query = &models.FindDashboardGitSyncPathsQuery{OrgId: 2, FilePath: "dashboards/Team/synced-dashboard.json"}
+				So(FindDashboardGitSyncPaths(query), ShouldBeNil)
+				So(query.Result, ShouldBeEmpty)
+			})
+
+			Convey("Should keep a single path record per path", func() {
+				for _, sha := range []string{"def", "ghi"} {
+					err := SaveDashboardGitSync(&models.SaveDashboardGitSyncCommand{
+						DashboardId: dash.Id,
+						OrgId:       1,
+						Provider:    "gitlab",
+						FilePath:    "dashboards/General/synced-dashboard.json",
+						CommitSha:   sha,
+					})
+					So(err, ShouldBeNil)
+				}
+
+				query := &models.FindDashboardGitSyncPathsQuery{OrgId: 1, FilePath: "dashboards/General/synced-dashboard.json"}
+				So(FindDashboardGitSyncPaths(query), ShouldBeNil)
+				So(len(query.Result), ShouldEqual, 1)
+			})
+
+			Convey("Deleting the dashboard should delete its sync state", func() {
+				err := DeleteDashboard(&models.DeleteDashboardCommand{Id: dash.Id, OrgId: 1})
+				So(err, ShouldBeNil)
+
+				query := &models.GetDashboardGitSyncQuery{DashboardId: dash.Id}
+				err = GetDashboardGitSync(query)
+				So(err, ShouldBeNil)
+				So(query.Result, ShouldBeNil)
+
+				pathQuery := &models.FindDashboardGitSyncPathsQuery{OrgId: 1, FilePath: "dashboards/General/synced-dashboard.json"}
+				So(FindDashboardGitSyncPaths(pathQuery), ShouldBeNil)
+				So(pathQuery.Result, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", CreateDashboardJob)
+	bus.AddHandler("sql", UpdateDashboardJob)
+	bus.AddHandler("sql", GetDashboardJob)
+	bus.AddHandler("sql", GetDashboardJobsByState)
+	bus.AddHandler("sql", DeleteFinishedDashboardJobs)
+}
+
+func CreateDashboardJob(cmd *models.CreateDashboardJobCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		now := time.Now()
+		job := &models.DashboardJob{
+			OrgId:     cmd.OrgId,
+			Kind:      cmd.Kind,
+			Params:    cmd.Params,
+			State:     models.DashboardJobQueued,
+			CreatedBy: cmd.CreatedBy,
+			Created:   now,
+			Updated:   now,
+		}
+
+		if _, err := sess.Insert(job); err != nil {
+			return err
+		}
+
+		cmd.Result = job
+		return nil
+	})
+}
+
+func UpdateDashboardJob(cmd *models.UpdateDashboardJobCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		job := cmd.Job
+		job.Updated = time.Now()
+
+		affected, err := sess.ID(job.Id).AllCols().Update(job)
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return models.ErrDashboardJobNotFound
+		}
+		return nil
+	})
+}
+
+func GetDashboardJob(query *models.GetDashboardJobQuery) error {
+	job := &models.DashboardJob{}
+
+	exist, err := x.ID(query.Id).Get(job)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return models.ErrDashboardJobNotFound
+	}
+
+	query.Result = job
+	return nil
+}
+
+func GetDashboardJobsByState(query *models.GetDashboardJobsByStateQuery) error {
+	query.Result = make([]*models.DashboardJob, 0)
+	return x.In("state", query.States).Asc("id").Find(&query.Result)
+}
+
+func DeleteFinishedDashboardJobs(cmd *models.DeleteFinishedDashboardJobsCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		result, err := sess.Exec("DELETE FROM dashboard_job WHERE state IN (?, ?, ?) AND finished < ?",
+			models.DashboardJobSucceeded, models.DashboardJobFailed, models.DashboardJobCancelled, cmd.FinishedBefore)
+		if err != nil {
+			return err
+		}
+
+		cmd.DeletedRows, err = result.RowsAffected()
+		return err
+	})
+}
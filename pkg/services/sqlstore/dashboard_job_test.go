@@ -0,0 +1,79 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardJobDataAccess(t *testing.T) {
+	Convey("Testing dashboard job data access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should return not found for a missing job", func() {
+			err := GetDashboardJob(&models.GetDashboardJobQuery{Id: 1})
+			So(err, ShouldEqual, models.ErrDashboardJobNotFound)
+		})
+
+		Convey("Given a created job", func() {
+			cmd := &models.CreateDashboardJobCommand{OrgId: 1, Kind: "repo-layout-migration", Params: `{"orgId":1}`, CreatedBy: 2}
+			So(CreateDashboardJob(cmd), ShouldBeNil)
+			So(cmd.Result.Id, ShouldNotEqual, 0)
+
+			Convey("Should be queued", func() {
+				query := &models.GetDashboardJobQuery{Id: cmd.Result.Id}
+				So(GetDashboardJob(query), ShouldBeNil)
+				So(query.Result.State, ShouldEqual, models.DashboardJobQueued)
+				So(query.Result.Params, ShouldEqual, `{"orgId":1}`)
+				So(query.Result.CreatedBy, ShouldEqual, 2)
+			})
+
+			Convey("Updating should store its state", func() {
+				job := cmd.Result
+				job.State = models.DashboardJobRunning
+				job.Done = 3
+				job.Total = 10
+				So(UpdateDashboardJob(&models.UpdateDashboardJobCommand{Job: job}), ShouldBeNil)
+
+				query := &models.GetDashboardJobQuery{Id: job.Id}
+				So(GetDashboardJob(query), ShouldBeNil)
+				So(query.Result.State, ShouldEqual, models.DashboardJobRunning)
+				So(query.Result.Done, ShouldEqual, 3)
+				So(query.Result.Total, ShouldEqual, 10)
+
+				byState := &models.GetDashboardJobsByStateQuery{States: []models.DashboardJobState{models.DashboardJobRunning}}
+				So(GetDashboardJobsByState(byState), ShouldBeNil)
+				So(byState.Result, ShouldHaveLength, 1)
+				So(byState.Result[0].Id, ShouldEqual, job.Id)
+			})
+
+			Convey("Updating a missing job should fail", func() {
+				err := UpdateDashboardJob(&models.UpdateDashboardJobCommand{Job: &models.DashboardJob{Id: 100}})
+				So(err, ShouldEqual, models.ErrDashboardJobNotFound)
+			})
+
+			Convey("Should only delete the jobs that finished before the time", func() {
+				finished := time.Now().Add(-48 * time.Hour)
+				job := cmd.Result
+				job.State = models.DashboardJobSucceeded
+				job.Finished = finished
+				So(UpdateDashboardJob(&models.UpdateDashboardJobCommand{Job: job}), ShouldBeNil)
+
+				queued := &models.CreateDashboardJobCommand{OrgId: 1, Kind: "repo-layout-migration"}
+				So(CreateDashboardJob(queued), ShouldBeNil)
+
+				deleteCmd := &models.DeleteFinishedDashboardJobsCommand{FinishedBefore: finished.Add(-time.Hour)}
+				So(DeleteFinishedDashboardJobs(deleteCmd), ShouldBeNil)
+				So(deleteCmd.DeletedRows, ShouldEqual, 0)
+
+				deleteCmd = &models.DeleteFinishedDashboardJobsCommand{FinishedBefore: time.Now().Add(-24 * time.Hour)}
+				So(DeleteFinishedDashboardJobs(deleteCmd), ShouldBeNil)
+				So(deleteCmd.DeletedRows, ShouldEqual, 1)
+
+				So(GetDashboardJob(&models.GetDashboardJobQuery{Id: queued.Result.Id}), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetDashboardMaintenance)
+	bus.AddHandler("sql", SetDashboardMaintenance)
+}
+
+// GetDashboardMaintenance returns the maintenance mode of dashboards, the first row when instances setting it at
+// the same time inserted several
+func GetDashboardMaintenance(query *models.GetDashboardMaintenanceQuery) error {
+	maintenance := &models.DashboardMaintenance{}
+	exists, err := x.Table("dashboard_maintenance").OrderBy("id").Get(maintenance)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		query.Result = maintenance
+	}
+	return nil
+}
+
+// SetDashboardMaintenance updates the maintenance mode of dashboards, inserting its row the first time it is set
+func SetDashboardMaintenance(cmd *models.SetDashboardMaintenanceCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		maintenance := &models.DashboardMaintenance{
+			ReadOnly:  cmd.ReadOnly,
+			Message:   cmd.Message,
+			EndsAt:    cmd.EndsAt,
+			UpdatedBy: cmd.UpdatedBy,
+			Updated:   time.Now(),
+		}
+
+		rows, err := sess.Table("dashboard_maintenance").Where("1 = 1").
+			Cols("read_only", "message", "ends_at", "updated_by", "updated").Update(maintenance)
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			if _, err := sess.Insert(maintenance); err != nil {
+				return err
+			}
+		}
+
+		cmd.Result = maintenance
+		return nil
+	})
+}
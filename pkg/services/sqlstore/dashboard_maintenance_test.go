@@ -0,0 +1,45 @@
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardMaintenanceDataAccess(t *testing.T) {
+	Convey("Testing dashboard maintenance data access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should return no maintenance before it is set", func() {
+			query := &models.GetDashboardMaintenanceQuery{}
+			So(GetDashboardMaintenance(query), ShouldBeNil)
+			So(query.Result, ShouldBeNil)
+		})
+
+		Convey("Should keep a single maintenance updated by each set", func() {
+			cmd := &models.SetDashboardMaintenanceCommand{ReadOnly: true, Message: "Upgrading the database", EndsAt: 1568106000, UpdatedBy: 1}
+			So(SetDashboardMaintenance(cmd), ShouldBeNil)
+			So(cmd.Result.ReadOnly, ShouldBeTrue)
+
+			query := &models.GetDashboardMaintenanceQuery{}
+			So(GetDashboardMaintenance(query), ShouldBeNil)
+			So(query.Result.ReadOnly, ShouldBeTrue)
+			So(query.Result.Message, ShouldEqual, "Upgrading the database")
+			So(query.Result.EndsAt, ShouldEqual, 1568106000)
+			So(query.Result.UpdatedBy, ShouldEqual, 1)
+
+			So(SetDashboardMaintenance(&models.SetDashboardMaintenanceCommand{UpdatedBy: 2}), ShouldBeNil)
+
+			So(GetDashboardMaintenance(query), ShouldBeNil)
+			So(query.Result.ReadOnly, ShouldBeFalse)
+			So(query.Result.Message, ShouldEqual, "")
+			So(query.Result.EndsAt, ShouldEqual, 0)
+			So(query.Result.UpdatedBy, ShouldEqual, 2)
+
+			count, err := x.Table("dashboard_maintenance").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+	})
+}
@@ -9,6 +9,7 @@ func init() {
 	bus.AddHandler("sql", GetProvisionedDashboardDataQuery)
 	bus.AddHandler("sql", SaveProvisionedDashboard)
 	bus.AddHandler("sql", GetProvisionedDataByDashboardId)
+	bus.AddHandler("sql", GetProvisionedDataByDashboardIds)
 	bus.AddHandler("sql", UnprovisionDashboard)
 }
 
@@ -32,6 +33,24 @@ func GetProvisionedDataByDashboardId(cmd *models.GetProvisionedDashboardDataById
 	return nil
 }
 
+// GetProvisionedDataByDashboardIds looks up the provisioning data of many dashboards in a single query
+func GetProvisionedDataByDashboardIds(query *models.GetProvisionedDashboardDataByIdsQuery) error {
+	query.Result = make(map[int64]*models.DashboardProvisioning)
+	if len(query.DashboardIds) == 0 {
+		return nil
+	}
+
+	var provisioned []*models.DashboardProvisioning
+	if err := x.In("dashboard_id", query.DashboardIds).Find(&provisioned); err != nil {
+		return err
+	}
+
+	for _, data := range provisioned {
+		query.Result[data.DashboardId] = data
+	}
+	return nil
+}
+
 func SaveProvisionedDashboard(cmd *models.SaveProvisionedDashboardCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		err := saveDashboard(sess, cmd.DashboardCmd)
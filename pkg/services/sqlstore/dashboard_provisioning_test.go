@@ -81,6 +81,25 @@ func TestDashboardProvisioningTest(t *testing.T) {
 				So(query.Result, ShouldBeNil)
 			})
 
+			Convey("Can query for many dashboards at once", func() {
+				other := insertTestDashboard("other dashboard", 1, 0, false)
+
+				query := &models.GetProvisionedDashboardDataByIdsQuery{DashboardIds: []int64{dashId, other.Id, 3000}}
+				err := GetProvisionedDataByDashboardIds(query)
+				So(err, ShouldBeNil)
+
+				So(len(query.Result), ShouldEqual, 1)
+				So(query.Result[dashId].ExternalId, ShouldEqual, "/var/grafana.json")
+				So(query.Result[other.Id], ShouldBeNil)
+			})
+
+			Convey("Can query for no dashboards", func() {
+				query := &models.GetProvisionedDashboardDataByIdsQuery{}
+				err := GetProvisionedDataByDashboardIds(query)
+				So(err, ShouldBeNil)
+				So(query.Result, ShouldBeEmpty)
+			})
+
 			Convey("Deleting folder should delete provision meta data", func() {
 				deleteCmd := &models.DeleteDashboardCommand{
 					Id:    folderCmd.Result.Id,
@@ -0,0 +1,140 @@
+package sqlstore
+
+import (
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetDashboardSaveSnapshot)
+}
+
+// dashboardSaveSnapshotRow is a dashboard fetched for the snapshot of a save, with the id of its provisioning
+type dashboardSaveSnapshotRow struct {
+	models.Dashboard `xorm:"extends"`
+	ProvisioningId   int64
+}
+
+// GetDashboardSaveSnapshot fetches everything the save of a dashboard is checked against in one handler, so saves
+// do not dispatch a query per check. The dashboard, the dashboard using the uid and the folder are fetched with
+// one statement, with the columns the checks use and the id of the provisioning of the dashboard. The acls are
+// only fetched for users who are not org admins, and the teams of the user only when the acls grant permissions
+// to teams.
+func GetDashboardSaveSnapshot(query *models.GetDashboardSaveSnapshotQuery) error {
+	snapshot := &models.DashboardSaveSnapshot{}
+
+	conds := make([]string, 0)
+	params := make([]interface{}, 0)
+	if query.Uid != "" {
+		conds = append(conds, "(dashboard.org_id=? AND dashboard.uid=?)")
+		params = append(params, query.OrgId, query.Uid)
+	}
+	for _, id := range []int64{query.DashboardId, query.FolderId} {
+		if id > 0 {
+			conds = append(conds, "dashboard.id=?")
+			params = append(params, id)
+		}
+	}
+
+	var existing *dashboardSaveSnapshotRow
+	if len(conds) > 0 {
+		rawSQL := `SELECT
+			dashboard.id,
+			dashboard.uid,
+			dashboard.org_id,
+			dashboard.folder_id,
+			dashboard.is_folder,
+			dashboard.title,
+			dashboard_provisioning.id AS provisioning_id
+			FROM dashboard
+			LEFT JOIN dashboard_provisioning ON dashboard_provisioning.dashboard_id = dashboard.id
+			WHERE ` + strings.Join(conds, " OR ")
+
+		rows := make([]*dashboardSaveSnapshotRow, 0)
+		if err := x.SQL(rawSQL, params...).Find(&rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if row.OrgId != query.OrgId {
+				continue
+			}
+			if query.Uid != "" && row.Uid == query.Uid {
+				snapshot.ExistingByUid = &row.Dashboard
+				snapshot.ExistingByUidProvisioned = row.ProvisioningId > 0
+			}
+			if query.DashboardId > 0 && row.Id == query.DashboardId {
+				existing = row
+			}
+			if query.FolderId > 0 && row.Id == query.FolderId && row.IsFolder {
+				snapshot.Folder = &row.Dashboard
+			}
+		}
+	}
+
+	// the provisioning is only fetched for provisioned dashboards
+	if existing != nil && existing.ProvisioningId > 0 {
+		provisioning := &models.DashboardProvisioning{}
+		exists, err := x.Id(existing.ProvisioningId).Get(provisioning)
+		if err != nil {
+			return err
+		}
+		if exists {
+			snapshot.Provisioning = provisioning
+		}
+	}
+
+	if query.User.OrgRole != models.ROLE_ADMIN {
+		if err := getDashboardSaveAcls(query, existing, snapshot); err != nil {
+			return err
+		}
+	}
+
+	query.Result = snapshot
+	return nil
+}
+
+func getDashboardSaveAcls(query *models.GetDashboardSaveSnapshotQuery, existing *dashboardSaveSnapshotRow, snapshot *models.DashboardSaveSnapshot) error {
+	getAcl := func(dashboardId int64) ([]*models.DashboardAclInfoDTO, error) {
+		aclQuery := &models.GetDashboardAclInfoListQuery{OrgId: query.OrgId, DashboardId: dashboardId}
+		if err := GetDashboardAclInfoList(aclQuery); err != nil {
+			return nil, err
+		}
+		return aclQuery.Result, nil
+	}
+
+	var err error
+	if query.DashboardId > 0 {
+		if snapshot.Acl, err = getAcl(query.DashboardId); err != nil {
+			return err
+		}
+	}
+
+	// new dashboards are checked against the acl of their folder, the acl of the folder is not needed for the
+	// dashboards staying in their folder
+	if query.DashboardId == 0 || existing == nil || existing.FolderId != query.FolderId {
+		if snapshot.FolderAcl, err = getAcl(query.FolderId); err != nil {
+			return err
+		}
+	}
+	if query.DashboardId == 0 {
+		snapshot.Acl = snapshot.FolderAcl
+	}
+
+	for _, acl := range [][]*models.DashboardAclInfoDTO{snapshot.Acl, snapshot.FolderAcl} {
+		for _, item := range acl {
+			if item.TeamId > 0 {
+				teams := &models.GetTeamsByUserQuery{OrgId: query.OrgId, UserId: query.User.UserId}
+				if err := GetTeamsByUser(teams); err != nil {
+					return err
+				}
+				snapshot.Teams = teams.Result
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
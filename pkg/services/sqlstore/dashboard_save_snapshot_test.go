@@ -0,0 +1,289 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardSaveSnapshot(t *testing.T) {
+	Convey("Given folders and dashboards with acls", t, func() {
+		InitTestDB(t)
+
+		teamFolder := insertTestDashboard("Team folder", 1, 0, true)
+		userFolder := insertTestDashboard("User folder", 1, 0, true)
+		inTeamFolder := insertTestDashboard("In team folder", 1, teamFolder.Id, false)
+		inUserFolder := insertTestDashboard("In user folder", 1, userFolder.Id, false)
+		inGeneralFolder := insertTestDashboard("In general folder", 1, 0, false)
+
+		teamMember := createUser("member", "Viewer", false)
+		otherUser := createUser("other", "Viewer", false)
+		editor := createUser("editor", "Editor", false)
+
+		team := &models.CreateTeamCommand{Name: "team", OrgId: 1}
+		So(CreateTeam(team), ShouldBeNil)
+		So(AddTeamMember(&models.AddTeamMemberCommand{OrgId: 1, TeamId: team.Result.Id, UserId: teamMember.Id}), ShouldBeNil)
+
+		So(testHelperUpdateDashboardAcl(teamFolder.Id, models.DashboardAcl{
+			OrgId: 1, DashboardId: teamFolder.Id, TeamId: team.Result.Id, Permission: models.PERMISSION_EDIT,
+		}), ShouldBeNil)
+		So(testHelperUpdateDashboardAcl(userFolder.Id, models.DashboardAcl{
+			OrgId: 1, DashboardId: userFolder.Id, UserId: otherUser.Id, Permission: models.PERMISSION_VIEW,
+		}), ShouldBeNil)
+		So(testHelperUpdateDashboardAcl(inUserFolder.Id, models.DashboardAcl{
+			OrgId: 1, DashboardId: inUserFolder.Id, UserId: otherUser.Id, Permission: models.PERMISSION_EDIT,
+		}), ShouldBeNil)
+
+		So(SaveProvisionedDashboard(&models.SaveProvisionedDashboardCommand{
+			DashboardCmd: &models.SaveDashboardCommand{
+				OrgId:     1,
+				Overwrite: true,
+				Dashboard: simplejson.NewFromAny(map[string]interface{}{"id": nil, "title": "Provisioned"}),
+			},
+			DashboardProvisioning: &models.DashboardProvisioning{Name: "default", ExternalId: "/provisioned.json"},
+		}), ShouldBeNil)
+		provisioned := &models.GetDashboardQuery{OrgId: 1, Slug: "provisioned"}
+		So(GetDashboard(provisioned), ShouldBeNil)
+
+		users := map[string]*models.SignedInUser{
+			"admin":       {UserId: editor.Id, OrgId: 1, OrgRole: models.ROLE_ADMIN},
+			"editor":      {UserId: editor.Id, OrgId: 1, OrgRole: models.ROLE_EDITOR},
+			"viewer":      {UserId: editor.Id, OrgId: 1, OrgRole: models.ROLE_VIEWER},
+			"team member": {UserId: teamMember.Id, OrgId: 1, OrgRole: models.ROLE_VIEWER},
+			"other user":  {UserId: otherUser.Id, OrgId: 1, OrgRole: models.ROLE_VIEWER},
+		}
+
+		Convey("Should fetch the dashboard using the uid, the provisioning and the folder", func() {
+			query := &models.GetDashboardSaveSnapshotQuery{
+				OrgId:       1,
+				DashboardId: provisioned.Result.Id,
+				Uid:         inTeamFolder.Uid,
+				FolderId:    teamFolder.Id,
+				User:        users["admin"],
+			}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+
+			snapshot := query.Result
+			So(snapshot.ExistingByUid.Id, ShouldEqual, inTeamFolder.Id)
+			So(snapshot.Provisioning.ExternalId, ShouldEqual, "/provisioned.json")
+			So(snapshot.Folder.Id, ShouldEqual, teamFolder.Id)
+			So(snapshot.Acl, ShouldBeNil)
+			So(snapshot.FolderAcl, ShouldBeNil)
+			So(snapshot.Teams, ShouldBeNil)
+			So(snapshot.ExistingByUidProvisioned, ShouldBeFalse)
+		})
+
+		Convey("Should tell whether the dashboard using the uid is provisioned", func() {
+			query := &models.GetDashboardSaveSnapshotQuery{OrgId: 1, Uid: provisioned.Result.Uid, User: users["admin"]}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+			So(query.Result.ExistingByUid.Id, ShouldEqual, provisioned.Result.Id)
+			So(query.Result.ExistingByUidProvisioned, ShouldBeTrue)
+			So(query.Result.Provisioning, ShouldBeNil)
+		})
+
+		Convey("Should leave out what does not exist", func() {
+			query := &models.GetDashboardSaveSnapshotQuery{OrgId: 1, Uid: "unused", User: users["admin"]}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+			So(query.Result, ShouldResemble, &models.DashboardSaveSnapshot{})
+		})
+
+		Convey("Should only fetch the teams when the acls grant permissions to teams", func() {
+			query := &models.GetDashboardSaveSnapshotQuery{OrgId: 1, DashboardId: inTeamFolder.Id, FolderId: teamFolder.Id, User: users["team member"]}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+			So(query.Result.Teams, ShouldHaveLength, 1)
+			So(query.Result.Teams[0].Id, ShouldEqual, team.Result.Id)
+
+			query = &models.GetDashboardSaveSnapshotQuery{OrgId: 1, DashboardId: inUserFolder.Id, FolderId: userFolder.Id, User: users["team member"]}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+			So(query.Result.Teams, ShouldBeNil)
+		})
+
+		Convey("Should only fetch the acl of the folder of new and moved dashboards", func() {
+			query := &models.GetDashboardSaveSnapshotQuery{OrgId: 1, FolderId: teamFolder.Id, User: users["team member"]}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+			So(query.Result.FolderAcl, ShouldNotBeEmpty)
+			So(query.Result.Acl, ShouldResemble, query.Result.FolderAcl)
+
+			query = &models.GetDashboardSaveSnapshotQuery{OrgId: 1, DashboardId: inUserFolder.Id, FolderId: teamFolder.Id, User: users["team member"]}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+			So(query.Result.FolderAcl, ShouldNotBeEmpty)
+			So(query.Result.Acl, ShouldNotBeEmpty)
+
+			query = &models.GetDashboardSaveSnapshotQuery{OrgId: 1, DashboardId: inUserFolder.Id, FolderId: userFolder.Id, User: users["team member"]}
+			So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+			So(query.Result.FolderAcl, ShouldBeNil)
+			So(query.Result.Acl, ShouldNotBeEmpty)
+		})
+
+		Convey("Should check the permissions to save as the guardian querying the acls", func() {
+			saves := map[string]*models.Dashboard{
+				"new in team folder":       {OrgId: 1, FolderId: teamFolder.Id},
+				"new in user folder":       {OrgId: 1, FolderId: userFolder.Id},
+				"new in general folder":    {OrgId: 1},
+				"update in team folder":    {Id: inTeamFolder.Id, OrgId: 1, FolderId: teamFolder.Id},
+				"update in user folder":    {Id: inUserFolder.Id, OrgId: 1, FolderId: userFolder.Id},
+				"update in general folder": {Id: inGeneralFolder.Id, OrgId: 1},
+				"move to team folder":      {Id: inUserFolder.Id, OrgId: 1, FolderId: teamFolder.Id},
+				"move to general folder":   {Id: inTeamFolder.Id, OrgId: 1},
+			}
+
+			for userName, user := range users {
+				for saveName, dash := range saves {
+					query := &models.GetDashboardSaveSnapshotQuery{OrgId: 1, DashboardId: dash.Id, FolderId: dash.FolderId, User: user}
+					So(GetDashboardSaveSnapshot(query), ShouldBeNil)
+					snapshot := query.Result
+
+					dashId := dash.GetDashboardIdForSavePermissionCheck()
+					expected, err := guardian.New(dashId, 1, user).CanSave()
+					So(err, ShouldBeNil)
+					canSave, err := guardian.NewWithAcl(dashId, 1, user, snapshot.Acl, snapshot.Teams).CanSave()
+					So(err, ShouldBeNil)
+					So(fmt.Sprintf("%s, %s: %v", userName, saveName, canSave), ShouldEqual, fmt.Sprintf("%s, %s: %v", userName, saveName, expected))
+
+					expected, err = guardian.New(dash.FolderId, 1, user).CanSave()
+					So(err, ShouldBeNil)
+					canSave, err = guardian.NewWithAcl(dash.FolderId, 1, user, snapshot.FolderAcl, snapshot.Teams).CanSave()
+					So(err, ShouldBeNil)
+					So(fmt.Sprintf("%s, %s folder: %v", userName, saveName, canSave), ShouldEqual, fmt.Sprintf("%s, %s folder: %v", userName, saveName, expected))
+				}
+			}
+		})
+	})
+}
+
+// measureDispatches replaces the handlers with handlers counting their dispatches in count and adding the time
+// they take to elapsed
+func measureDispatches(count *int, elapsed *time.Duration, handlers ...interface{}) {
+	for _, handler := range handlers {
+		fn := reflect.ValueOf(handler)
+		bus.AddHandler("test", reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+			*count++
+			start := time.Now()
+			defer func() { *elapsed += time.Since(start) }()
+			return fn.Call(args)
+		}).Interface())
+	}
+}
+
+// setupMediumSaveFixture creates the medium fixture of the save benchmarks, 25 folders of 20 dashboards each
+// edited by a team of 4 users, and returns a dashboard and one of the users editing it. The user is a member of
+// 3 teams and an editor through its teams only.
+func setupMediumSaveFixture(b *testing.B) (*models.Dashboard, *models.SignedInUser) {
+	b.Helper()
+	InitTestDB(b)
+
+	save := func(title string, folderId int64, isFolder bool) *models.Dashboard {
+		cmd := &models.SaveDashboardCommand{
+			OrgId:     1,
+			FolderId:  folderId,
+			IsFolder:  isFolder,
+			Dashboard: simplejson.NewFromAny(map[string]interface{}{"id": nil, "title": title}),
+		}
+		if err := SaveDashboard(cmd); err != nil {
+			b.Fatalf("Failed to save %s: %v", title, err)
+		}
+		return cmd.Result
+	}
+
+	setting.AutoAssignOrg = true
+	setting.AutoAssignOrgId = 1
+
+	var userIds []int64
+	for i := 0; i < 100; i++ {
+		cmd := &models.CreateUserCommand{Login: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@test.com", i), DefaultOrgRole: string(models.ROLE_VIEWER)}
+		if err := CreateUser(context.Background(), cmd); err != nil {
+			b.Fatalf("Failed to create user: %v", err)
+		}
+		userIds = append(userIds, cmd.Result.Id)
+	}
+
+	var dash *models.Dashboard
+	for i := 0; i < 25; i++ {
+		team := &models.CreateTeamCommand{Name: fmt.Sprintf("team%d", i), OrgId: 1}
+		if err := CreateTeam(team); err != nil {
+			b.Fatalf("Failed to create team: %v", err)
+		}
+
+		members := append([]int64{}, userIds[i*4:i*4+4]...)
+		// the benchmarked user is in the first teams
+		if i > 0 && i < 3 {
+			members = append(members, userIds[0])
+		}
+		for _, userId := range members {
+			if err := AddTeamMember(&models.AddTeamMemberCommand{OrgId: 1, TeamId: team.Result.Id, UserId: userId}); err != nil {
+				b.Fatalf("Failed to add team member: %v", err)
+			}
+		}
+
+		folder := save(fmt.Sprintf("Folder %d", i), 0, true)
+		viewer := models.ROLE_VIEWER
+		now := time.Now()
+		if err := UpdateDashboardAcl(&models.UpdateDashboardAclCommand{DashboardId: folder.Id, Items: []*models.DashboardAcl{
+			{OrgId: 1, DashboardId: folder.Id, TeamId: team.Result.Id, Permission: models.PERMISSION_EDIT, Created: now, Updated: now},
+			{OrgId: 1, DashboardId: folder.Id, Role: &viewer, Permission: models.PERMISSION_VIEW, Created: now, Updated: now},
+		}}); err != nil {
+			b.Fatalf("Failed to update the acl: %v", err)
+		}
+
+		for j := 0; j < 20; j++ {
+			saved := save(fmt.Sprintf("Dashboard %d-%d", i, j), folder.Id, false)
+			if i == 0 && j == 0 {
+				dash = saved
+			}
+		}
+	}
+
+	return dash, &models.SignedInUser{UserId: userIds[0], OrgId: 1, OrgRole: models.ROLE_VIEWER}
+}
+
+// BenchmarkSaveDashboard saves a dashboard of the medium fixture as a team editor, reporting the queries the
+// save dispatches to check the dashboard and the time they take
+func BenchmarkSaveDashboard(b *testing.B) {
+	dash, user := setupMediumSaveFixture(b)
+
+	bus.AddHandler("test", func(cmd *models.ValidateDashboardAlertsCommand) error {
+		return nil
+	})
+	bus.AddHandler("test", func(cmd *models.UpdateDashboardAlertsCommand) error {
+		return nil
+	})
+
+	queries := 0
+	var elapsed time.Duration
+	measureDispatches(&queries, &elapsed,
+		GetDashboardSaveSnapshot,
+		GetDashboard,
+		GetProvisionedDataByDashboardId,
+		GetDashboardAclInfoList,
+		GetTeamsByUser,
+	)
+
+	service := dashboards.NewService()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		data := dash.Data.MustMap()
+		data["id"] = dash.Id
+		data["uid"] = dash.Uid
+		data["title"] = fmt.Sprintf("Dashboard %d", i)
+
+		cmd := models.SaveDashboardCommand{OrgId: 1, FolderId: dash.FolderId, Overwrite: true, Dashboard: simplejson.NewFromAny(data)}
+		_, err := service.SaveDashboard(&dashboards.SaveDashboardDTO{OrgId: 1, User: user, Overwrite: true, Dashboard: cmd.GetDashboardModel()})
+		if err != nil {
+			b.Fatalf("Failed to save: %v", err)
+		}
+	}
+
+	b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+	b.ReportMetric(float64(elapsed.Nanoseconds())/float64(b.N), "query-ns/op")
+}
@@ -2,6 +2,7 @@ package sqlstore
 
 import (
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/services/dashboards"
@@ -11,6 +12,7 @@ import (
 	"github.com/grafana/grafana/pkg/models"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/xerrors"
 )
 
 func TestIntegratedDashboardService(t *testing.T) {
@@ -144,7 +146,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for General Folder with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleSavePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, 0)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -167,7 +169,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for other folder with correct arguments and rsult in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleSavePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, otherSavedFolder.Id)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -190,7 +192,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for folder with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, savedFolder.Id)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -214,7 +216,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for folder with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, savedFolder.Id)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -238,7 +240,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for dashboard with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleSavePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, savedDashInGeneralFolder.Id)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -262,7 +264,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for dashboard with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleSavePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, savedDashInFolder.Id)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -286,7 +288,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for other folder with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, otherSavedFolder.Id)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -310,7 +312,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for General folder with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, 0)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -334,7 +336,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for other folder with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, otherSavedFolder.Id)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -358,7 +360,7 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 					Convey("It should create dashboard guardian for General folder with correct arguments and result in access denied error", func() {
 						So(err, ShouldNotBeNil)
-						So(err, ShouldEqual, models.ErrDashboardUpdateAccessDenied)
+						So(err, ShouldResemble, models.DashboardSaveRuleError{Rule: models.DashboardSaveRuleFolderMovePermission, Err: models.ErrDashboardUpdateAccessDenied})
 
 						So(sc.dashboardGuardianMock.DashId, ShouldEqual, 0)
 						So(sc.dashboardGuardianMock.OrgId, ShouldEqual, cmd.OrgId)
@@ -508,9 +510,9 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 						err := callSaveWithError(cmd)
 
-						Convey("It should result in folder not found error", func() {
-							So(err, ShouldNotBeNil)
-							So(err, ShouldEqual, models.ErrDashboardFolderNotFound)
+						Convey("It should result in folder not found error naming the folder", func() {
+							So(err, ShouldResemble, models.DashboardFolderNotFoundError{FolderId: 123412321})
+							So(xerrors.Is(err, models.ErrDashboardFolderNotFound), ShouldBeTrue)
 						})
 					})
 
@@ -527,9 +529,16 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 						err := callSaveWithError(cmd)
 
-						Convey("It should result in version mismatch error", func() {
+						Convey("It should result in version conflict error describing the stored dashboard", func() {
 							So(err, ShouldNotBeNil)
-							So(err, ShouldEqual, models.ErrDashboardVersionMismatch)
+							So(xerrors.Is(err, models.ErrDashboardVersionMismatch), ShouldBeTrue)
+
+							conflict, ok := err.(models.DashboardVersionConflictError)
+							So(ok, ShouldBeTrue)
+							So(conflict.CurrentVersion, ShouldEqual, savedDashInGeneralFolder.Version)
+							So(conflict.UpdatedAt, ShouldHappenWithin, time.Second, savedDashInGeneralFolder.Updated)
+							So(conflict.Changes, ShouldContain, "title changed")
+							So(conflict.ChangesTruncated, ShouldBeFalse)
 						})
 					})
 
@@ -572,9 +581,16 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 						err := callSaveWithError(cmd)
 
-						Convey("It should result in version mismatch error", func() {
+						Convey("It should result in version conflict error describing the stored dashboard", func() {
 							So(err, ShouldNotBeNil)
-							So(err, ShouldEqual, models.ErrDashboardVersionMismatch)
+							So(xerrors.Is(err, models.ErrDashboardVersionMismatch), ShouldBeTrue)
+
+							conflict, ok := err.(models.DashboardVersionConflictError)
+							So(ok, ShouldBeTrue)
+							So(conflict.CurrentVersion, ShouldEqual, savedDashInFolder.Version)
+							So(conflict.UpdatedAt, ShouldHappenWithin, time.Second, savedDashInFolder.Updated)
+							So(conflict.Changes, ShouldContain, "title changed")
+							So(conflict.ChangesTruncated, ShouldBeFalse)
 						})
 					})
 
@@ -726,6 +742,29 @@ func TestIntegratedDashboardService(t *testing.T) {
 							Overwrite: shouldOverwrite,
 						}
 
+						err := callSaveWithError(cmd)
+
+						Convey("It should result in uid changed error", func() {
+							So(err, ShouldEqual, models.ErrDashboardUidChanged)
+
+							query := models.GetDashboardQuery{OrgId: cmd.OrgId, Id: savedDashInFolder.Id}
+							So(bus.Dispatch(&query), ShouldBeNil)
+							So(query.Result.Uid, ShouldEqual, savedDashInFolder.Uid)
+						})
+					})
+
+					Convey("When updating uid for existing dashboard using id allowing the uid change", func() {
+						cmd := models.SaveDashboardCommand{
+							OrgId: 1,
+							Dashboard: simplejson.NewFromAny(map[string]interface{}{
+								"id":    savedDashInFolder.Id,
+								"uid":   "new-uid",
+								"title": savedDashInFolder.Title,
+							}),
+							Overwrite:      shouldOverwrite,
+							AllowUidChange: true,
+						}
+
 						res := callSaveWithResult(cmd)
 
 						Convey("It should update dashboard", func() {
@@ -866,9 +905,9 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 						err := callSaveWithError(cmd)
 
-						Convey("It should result in type mismatch error", func() {
+						Convey("It should result in uid collision error", func() {
 							So(err, ShouldNotBeNil)
-							So(err, ShouldEqual, models.ErrDashboardTypeMismatch)
+							So(err, ShouldEqual, models.ErrDashboardUidUsedByFolder)
 						})
 					})
 
@@ -885,9 +924,9 @@ func TestIntegratedDashboardService(t *testing.T) {
 
 						err := callSaveWithError(cmd)
 
-						Convey("It should result in type mismatch error", func() {
+						Convey("It should result in uid collision error", func() {
 							So(err, ShouldNotBeNil)
-							So(err, ShouldEqual, models.ErrDashboardTypeMismatch)
+							So(err, ShouldEqual, models.ErrFolderUidUsedByDashboard)
 						})
 					})
 
@@ -1035,5 +1074,7 @@ func toSaveDashboardDto(cmd models.SaveDashboardCommand) dashboards.SaveDashboar
 		OrgId:     cmd.OrgId,
 		User:      &models.SignedInUser{UserId: cmd.UserId},
 		Overwrite: cmd.Overwrite,
+
+		AllowUidChange: cmd.AllowUidChange,
 	}
 }
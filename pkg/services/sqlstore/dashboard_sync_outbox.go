@@ -0,0 +1,239 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// claimCandidates is how many of the oldest claimable items a claim considers
+const claimCandidates = 20
+
+func init() {
+	bus.AddHandler("sql", InsertDashboardSyncOutbox)
+	bus.AddHandler("sql", ClaimDashboardSyncOutboxItem)
+	bus.AddHandler("sql", CompleteDashboardSyncOutboxItem)
+	bus.AddHandler("sql", RequeueDashboardSyncOutbox)
+	bus.AddHandler("sql", PurgeDashboardSyncOutbox)
+	bus.AddHandler("sql", PruneDashboardSyncOutbox)
+	bus.AddHandler("sql", GetDashboardSyncOutbox)
+	bus.AddHandler("sql", GetDashboardSyncOutboxCounts)
+}
+
+// insertDashboardSyncOutbox stores the commits of a save in its transaction. Items without a dashboard commit the
+// saved dashboard, which only has an id once saved.
+func insertDashboardSyncOutbox(sess *DBSession, dash *models.Dashboard, items []*models.DashboardSyncOutboxItem) error {
+	now := time.Now()
+	for _, item := range items {
+		if item.Dashboard == "" {
+			data, err := dash.Data.Encode()
+			if err != nil {
+				return err
+			}
+			item.Dashboard = string(data)
+			item.DashboardId = dash.Id
+			item.FolderId = dash.FolderId
+		}
+
+		item.OrgId = dash.OrgId
+		item.Status = models.DashboardSyncOutboxPending
+		item.NextRetry = now
+		item.Version = 1
+		item.Created = now
+		item.Updated = now
+
+		if _, err := sess.Insert(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func InsertDashboardSyncOutbox(cmd *models.InsertDashboardSyncOutboxCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		return insertDashboardSyncOutbox(sess, cmd.Dashboard, cmd.Items)
+	})
+}
+
+// ClaimDashboardSyncOutboxItem claims an item with a conditional update of its version rather than SELECT FOR
+// UPDATE SKIP LOCKED, which not all the databases support: an item another instance claimed since it was read
+// is not updated and the next candidate is tried.
+func ClaimDashboardSyncOutboxItem(cmd *models.ClaimDashboardSyncOutboxItemCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		candidates := make([]*models.DashboardSyncOutboxItem, 0)
+		if cmd.IgnoreRetry {
+			sess.Where("status = ?", models.DashboardSyncOutboxPending)
+		} else {
+			sess.Where("status = ? AND next_retry <= ?", models.DashboardSyncOutboxPending, cmd.Now)
+		}
+		err := sess.Or("status = ? AND lease_until <= ?", models.DashboardSyncOutboxInflight, cmd.Now).
+			Asc("id").Limit(claimCandidates).Find(&candidates)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range candidates {
+			// the commits of a dashboard are made in order
+			earlier, err := sess.Where("org_id = ? AND dashboard_id = ? AND id < ?", item.OrgId, item.DashboardId, item.Id).
+				In("status", models.DashboardSyncOutboxPending, models.DashboardSyncOutboxInflight).
+				Count(&models.DashboardSyncOutboxItem{})
+			if err != nil {
+				return err
+			}
+			if earlier > 0 {
+				continue
+			}
+
+			version := item.Version
+			item.Status = models.DashboardSyncOutboxInflight
+			item.LeaseOwner = cmd.Owner
+			item.LeaseUntil = cmd.LeaseUntil
+			item.Attempts++
+			item.Version++
+			item.Updated = time.Now()
+
+			affected, err := sess.Where("id = ? AND version = ?", item.Id, version).AllCols().Update(item)
+			if err != nil {
+				return err
+			}
+			if affected == 1 {
+				cmd.Result = item
+				return nil
+			}
+		}
+
+		return nil
+	})
+}
+
+func CompleteDashboardSyncOutboxItem(cmd *models.CompleteDashboardSyncOutboxItemCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		item := &models.DashboardSyncOutboxItem{}
+		exists, err := sess.ID(cmd.Id).Get(item)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrDashboardSyncOutboxItemNotFound
+		}
+		if item.Version != cmd.Version || item.Status != models.DashboardSyncOutboxInflight {
+			return models.ErrDashboardSyncOutboxLeaseLost
+		}
+
+		item.Status = cmd.Status
+		item.Error = cmd.Error
+		item.LeaseOwner = ""
+		item.LeaseUntil = time.Time{}
+		item.Version++
+		item.Updated = time.Now()
+		if cmd.Status == models.DashboardSyncOutboxPending {
+			item.NextRetry = cmd.NextRetry
+		}
+
+		affected, err := sess.Where("id = ? AND version = ?", item.Id, cmd.Version).AllCols().Update(item)
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return models.ErrDashboardSyncOutboxLeaseLost
+		}
+		return nil
+	})
+}
+
+func RequeueDashboardSyncOutbox(cmd *models.RequeueDashboardSyncOutboxCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		items := make([]*models.DashboardSyncOutboxItem, 0)
+		if len(cmd.Ids) > 0 {
+			// the worker holding a live lease may have made the commit already, replaying it would commit twice
+			sess.In("id", cmd.Ids).Where("status = ? OR (status = ? AND lease_until <= ?)",
+				models.DashboardSyncOutboxFailed, models.DashboardSyncOutboxInflight, cmd.Now)
+		} else {
+			sess.Where("status = ?", models.DashboardSyncOutboxFailed)
+		}
+		if err := sess.Find(&items); err != nil {
+			return err
+		}
+
+		cmd.RequeuedRows = 0
+		for _, item := range items {
+			version := item.Version
+			item.Status = models.DashboardSyncOutboxPending
+			item.Attempts = 0
+			item.NextRetry = cmd.Now
+			item.LeaseOwner = ""
+			item.LeaseUntil = time.Time{}
+			item.Version++
+			item.Updated = time.Now()
+
+			affected, err := sess.Where("id = ? AND version = ?", item.Id, version).AllCols().Update(item)
+			if err != nil {
+				return err
+			}
+			cmd.RequeuedRows += affected
+		}
+		return nil
+	})
+}
+
+func PurgeDashboardSyncOutbox(cmd *models.PurgeDashboardSyncOutboxCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		var err error
+		if len(cmd.Ids) > 0 {
+			cmd.DeletedRows, err = sess.In("id", cmd.Ids).Where("status <> ?", models.DashboardSyncOutboxDone).
+				Delete(&models.DashboardSyncOutboxItem{})
+		} else {
+			cmd.DeletedRows, err = sess.Where("status = ?", models.DashboardSyncOutboxFailed).
+				Delete(&models.DashboardSyncOutboxItem{})
+		}
+		return err
+	})
+}
+
+func PruneDashboardSyncOutbox(cmd *models.PruneDashboardSyncOutboxCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		result, err := sess.Exec("DELETE FROM dashboard_sync_outbox WHERE status = ? AND updated < ?",
+			models.DashboardSyncOutboxDone, cmd.DoneBefore)
+		if err != nil {
+			return err
+		}
+
+		cmd.DeletedRows, err = result.RowsAffected()
+		return err
+	})
+}
+
+func GetDashboardSyncOutbox(query *models.GetDashboardSyncOutboxQuery) error {
+	sess := x.In("status", query.Statuses)
+	if query.OrgId != 0 {
+		sess.Where("org_id = ?", query.OrgId)
+	}
+
+	query.Result = make([]*models.DashboardSyncOutboxItem, 0)
+	return sess.Asc("id").Find(&query.Result)
+}
+
+func GetDashboardSyncOutboxCounts(query *models.GetDashboardSyncOutboxCountsQuery) error {
+	rawSql := `SELECT COUNT(*) as count, status FROM dashboard_sync_outbox`
+	params := make([]interface{}, 0)
+	if query.OrgId != 0 {
+		rawSql += ` WHERE org_id = ?`
+		params = append(params, query.OrgId)
+	}
+	rawSql += ` GROUP BY status`
+
+	rows := make([]*struct {
+		Count  int
+		Status models.DashboardSyncOutboxStatus
+	}, 0)
+	if err := x.SQL(rawSql, params...).Find(&rows); err != nil {
+		return err
+	}
+
+	query.Result = make(map[models.DashboardSyncOutboxStatus]int)
+	for _, row := range rows {
+		query.Result[row.Status] = row.Count
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardSyncOutboxDataAccess(t *testing.T) {
+	Convey("Testing dashboard sync outbox data access", t, func() {
+		InitTestDB(t)
+
+		saveWithCommits := func(title string, items ...*models.DashboardSyncOutboxItem) *models.SaveDashboardCommand {
+			cmd := &models.SaveDashboardCommand{
+				OrgId:      1,
+				Dashboard:  simplejson.NewFromAny(map[string]interface{}{"title": title}),
+				SyncOutbox: items,
+			}
+			So(SaveDashboard(cmd), ShouldBeNil)
+			return cmd
+		}
+
+		claim := func(owner string, now time.Time) *models.DashboardSyncOutboxItem {
+			cmd := &models.ClaimDashboardSyncOutboxItemCommand{Owner: owner, Now: now, LeaseUntil: now.Add(time.Minute)}
+			So(ClaimDashboardSyncOutboxItem(cmd), ShouldBeNil)
+			return cmd.Result
+		}
+
+		get := func(statuses ...models.DashboardSyncOutboxStatus) []*models.DashboardSyncOutboxItem {
+			query := &models.GetDashboardSyncOutboxQuery{Statuses: statuses}
+			So(GetDashboardSyncOutbox(query), ShouldBeNil)
+			return query.Result
+		}
+
+		Convey("Given a dashboard saved with a queued commit", func() {
+			saved := saveWithCommits("Service", &models.DashboardSyncOutboxItem{Action: "update", UserId: 2, AuthModule: "gitlab"})
+			now := time.Now().Add(time.Second)
+
+			Convey("Should store the commit of the saved dashboard as pending", func() {
+				items := get(models.DashboardSyncOutboxPending)
+				So(items, ShouldHaveLength, 1)
+				So(items[0].OrgId, ShouldEqual, 1)
+				So(items[0].DashboardId, ShouldEqual, saved.Result.Id)
+				So(items[0].Dashboard, ShouldContainSubstring, `"title":"Service"`)
+				So(items[0].UserId, ShouldEqual, 2)
+				So(items[0].Attempts, ShouldEqual, 0)
+
+				counts := &models.GetDashboardSyncOutboxCountsQuery{OrgId: 1}
+				So(GetDashboardSyncOutboxCounts(counts), ShouldBeNil)
+				So(counts.Result, ShouldResemble, map[models.DashboardSyncOutboxStatus]int{models.DashboardSyncOutboxPending: 1})
+			})
+
+			Convey("Should let a single instance claim the commit", func() {
+				item := claim("a", now)
+				So(item, ShouldNotBeNil)
+				So(item.Status, ShouldEqual, models.DashboardSyncOutboxInflight)
+				So(item.LeaseOwner, ShouldEqual, "a")
+				So(item.Attempts, ShouldEqual, 1)
+
+				So(claim("b", now), ShouldBeNil)
+
+				Convey("Should complete the commit of the current lease", func() {
+					complete := &models.CompleteDashboardSyncOutboxItemCommand{Id: item.Id, Version: item.Version, Status: models.DashboardSyncOutboxDone}
+					So(CompleteDashboardSyncOutboxItem(complete), ShouldBeNil)
+					So(get(models.DashboardSyncOutboxDone), ShouldHaveLength, 1)
+
+					err := CompleteDashboardSyncOutboxItem(complete)
+					So(err, ShouldEqual, models.ErrDashboardSyncOutboxLeaseLost)
+				})
+
+				Convey("Should claim the commit again once its lease expired", func() {
+					reclaimed := claim("b", now.Add(2*time.Minute))
+					So(reclaimed, ShouldNotBeNil)
+					So(reclaimed.LeaseOwner, ShouldEqual, "b")
+					So(reclaimed.Attempts, ShouldEqual, 2)
+
+					complete := &models.CompleteDashboardSyncOutboxItemCommand{Id: item.Id, Version: item.Version, Status: models.DashboardSyncOutboxDone}
+					So(CompleteDashboardSyncOutboxItem(complete), ShouldEqual, models.ErrDashboardSyncOutboxLeaseLost)
+				})
+
+				Convey("Should retry a failed attempt once due", func() {
+					retry := now.Add(time.Hour)
+					complete := &models.CompleteDashboardSyncOutboxItemCommand{
+						Id: item.Id, Version: item.Version, Status: models.DashboardSyncOutboxPending, Error: "timeout", NextRetry: retry,
+					}
+					So(CompleteDashboardSyncOutboxItem(complete), ShouldBeNil)
+
+					So(claim("a", now), ShouldBeNil)
+
+					ignoreRetry := &models.ClaimDashboardSyncOutboxItemCommand{Owner: "a", Now: now, LeaseUntil: now.Add(time.Minute), IgnoreRetry: true}
+					So(ClaimDashboardSyncOutboxItem(ignoreRetry), ShouldBeNil)
+					So(ignoreRetry.Result, ShouldNotBeNil)
+					So(ignoreRetry.Result.Error, ShouldEqual, "timeout")
+				})
+
+				Convey("Should only requeue the inflight commit once its lease expired", func() {
+					requeue := &models.RequeueDashboardSyncOutboxCommand{Ids: []int64{item.Id}, Now: now}
+					So(RequeueDashboardSyncOutbox(requeue), ShouldBeNil)
+					So(requeue.RequeuedRows, ShouldEqual, 0)
+
+					requeue = &models.RequeueDashboardSyncOutboxCommand{Ids: []int64{item.Id}, Now: now.Add(2 * time.Minute)}
+					So(RequeueDashboardSyncOutbox(requeue), ShouldBeNil)
+					So(requeue.RequeuedRows, ShouldEqual, 1)
+					So(get(models.DashboardSyncOutboxPending), ShouldHaveLength, 1)
+				})
+
+				Convey("Should requeue and purge the failed commits", func() {
+					complete := &models.CompleteDashboardSyncOutboxItemCommand{Id: item.Id, Version: item.Version, Status: models.DashboardSyncOutboxFailed, Error: "forbidden"}
+					So(CompleteDashboardSyncOutboxItem(complete), ShouldBeNil)
+					So(claim("a", now), ShouldBeNil)
+
+					requeue := &models.RequeueDashboardSyncOutboxCommand{Now: now}
+					So(RequeueDashboardSyncOutbox(requeue), ShouldBeNil)
+					So(requeue.RequeuedRows, ShouldEqual, 1)
+
+					requeued := claim("a", now)
+					So(requeued, ShouldNotBeNil)
+					So(requeued.Attempts, ShouldEqual, 1)
+
+					complete = &models.CompleteDashboardSyncOutboxItemCommand{Id: item.Id, Version: requeued.Version, Status: models.DashboardSyncOutboxFailed}
+					So(CompleteDashboardSyncOutboxItem(complete), ShouldBeNil)
+
+					purge := &models.PurgeDashboardSyncOutboxCommand{}
+					So(PurgeDashboardSyncOutbox(purge), ShouldBeNil)
+					So(purge.DeletedRows, ShouldEqual, 1)
+					So(get(models.DashboardSyncOutboxFailed), ShouldBeEmpty)
+				})
+			})
+
+			Convey("Should make the commits of a dashboard in order", func() {
+				dash := saved.Result
+				dash.Data.Set("id", dash.Id)
+				So(SaveDashboard(&models.SaveDashboardCommand{
+					OrgId:      1,
+					Dashboard:  dash.Data,
+					SyncOutbox: []*models.DashboardSyncOutboxItem{{Action: "update"}},
+				}), ShouldBeNil)
+				saveWithCommits("Other", &models.DashboardSyncOutboxItem{Action: "create"})
+
+				first := claim("a", now)
+				So(first.DashboardId, ShouldEqual, dash.Id)
+
+				// the second commit of the dashboard waits for the first one
+				other := claim("a", now)
+				So(other.DashboardId, ShouldNotEqual, dash.Id)
+				So(claim("a", now), ShouldBeNil)
+			})
+
+			Convey("Should only prune the commits made before the time", func() {
+				item := claim("a", now)
+				complete := &models.CompleteDashboardSyncOutboxItemCommand{Id: item.Id, Version: item.Version, Status: models.DashboardSyncOutboxDone}
+				So(CompleteDashboardSyncOutboxItem(complete), ShouldBeNil)
+
+				prune := &models.PruneDashboardSyncOutboxCommand{DoneBefore: time.Now().Add(-time.Hour)}
+				So(PruneDashboardSyncOutbox(prune), ShouldBeNil)
+				So(prune.DeletedRows, ShouldEqual, 0)
+
+				prune = &models.PruneDashboardSyncOutboxCommand{DoneBefore: time.Now().Add(time.Hour)}
+				So(PruneDashboardSyncOutbox(prune), ShouldBeNil)
+				So(prune.DeletedRows, ShouldEqual, 1)
+			})
+		})
+
+		Convey("Should not store the commits of a failed save", func() {
+			cmd := &models.SaveDashboardCommand{
+				OrgId:      1,
+				Dashboard:  simplejson.NewFromAny(map[string]interface{}{"id": 1000, "title": "Missing"}),
+				SyncOutbox: []*models.DashboardSyncOutboxItem{{Action: "update"}},
+			}
+			So(SaveDashboard(cmd), ShouldNotBeNil)
+			So(get(models.DashboardSyncOutboxPending), ShouldBeEmpty)
+		})
+	})
+}
@@ -99,6 +99,61 @@ func TestDashboardDataAccess(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 
+			Convey("Should only delete dashboard if the version matches", func() {
+				dash := insertTestDashboard("delete me", 1, 0, false, "delete this")
+
+				err := DeleteDashboard(&m.DeleteDashboardCommand{Id: dash.Id, OrgId: 1, Version: dash.Version + 1})
+				So(err, ShouldEqual, m.ErrDashboardVersionMismatch)
+
+				query := m.GetDashboardQuery{Id: dash.Id, OrgId: 1}
+				So(GetDashboard(&query), ShouldBeNil)
+
+				err = DeleteDashboard(&m.DeleteDashboardCommand{Id: dash.Id, OrgId: 1, Version: dash.Version})
+				So(err, ShouldBeNil)
+				So(GetDashboard(&query), ShouldEqual, m.ErrDashboardNotFound)
+			})
+
+			Convey("Given protected dashboards", func() {
+				origProtected := setting.DashboardProtectedUids
+				setting.DashboardProtectedUids = []string{savedDash.Uid}
+
+				Convey("Should not delete the dashboard", func() {
+					err := DeleteDashboard(&m.DeleteDashboardCommand{Id: savedDash.Id, OrgId: 1})
+					So(err, ShouldEqual, m.ErrDashboardProtected)
+
+					query := m.GetDashboardQuery{Id: savedDash.Id, OrgId: 1}
+					So(GetDashboard(&query), ShouldBeNil)
+				})
+
+				Convey("Should not delete the folder of the dashboard", func() {
+					err := DeleteDashboard(&m.DeleteDashboardCommand{Id: savedFolder.Id, OrgId: 1})
+					So(err, ShouldEqual, m.ErrDashboardProtected)
+				})
+
+				Convey("Should not change the uid of the dashboard", func() {
+					dash := m.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{
+						"id":      savedDash.Id,
+						"uid":     "new-uid",
+						"title":   savedDash.Title,
+						"version": savedDash.Version,
+					}))
+					dash.OrgId = 1
+					dash.FolderId = savedFolder.Id
+
+					err := ValidateDashboardBeforeSave(&m.ValidateDashboardBeforeSaveCommand{OrgId: 1, Dashboard: dash, AllowUidChange: true})
+					So(err, ShouldEqual, m.ErrDashboardProtected)
+				})
+
+				Convey("Should delete other dashboards", func() {
+					dash := insertTestDashboard("delete me", 1, 0, false)
+					So(DeleteDashboard(&m.DeleteDashboardCommand{Id: dash.Id, OrgId: 1}), ShouldBeNil)
+				})
+
+				Reset(func() {
+					setting.DashboardProtectedUids = origProtected
+				})
+			})
+
 			Convey("Should retry generation of uid once if it fails.", func() {
 				timesCalled := 0
 				generateNewUid = func() string {
@@ -233,6 +288,36 @@ func TestDashboardDataAccess(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 
+			Convey("Should be able to get all dashboards of an org, folders first", func() {
+				insertTestDashboard("test dash other org", 2, 0, false)
+
+				query := m.GetDashboardsByOrgQuery{OrgId: 1}
+
+				err := GetDashboardsByOrg(&query)
+				So(err, ShouldBeNil)
+
+				So(len(query.Result), ShouldEqual, 4)
+				So(query.Result[0].Id, ShouldEqual, savedFolder.Id)
+				So(query.Result[1].Id, ShouldEqual, savedDash.Id)
+			})
+
+			Convey("Should be able to get the dashboards whose folder was deleted", func() {
+				orphan := insertTestDashboard("test dash orphan", 1, 9999, false)
+				inDashboard := insertTestDashboard("test dash in dashboard", 1, savedDash.Id, false)
+				insertTestDashboard("test dash orphan other org", 2, 9999, false)
+
+				query := m.GetOrphanedDashboardsQuery{OrgId: 1}
+
+				err := GetOrphanedDashboards(&query)
+				So(err, ShouldBeNil)
+
+				So(len(query.Result), ShouldEqual, 2)
+				So(query.Result[0].Id, ShouldEqual, orphan.Id)
+				So(query.Result[0].FolderId, ShouldEqual, 9999)
+				So(query.Result[0].Data.Get("title").MustString(), ShouldEqual, "test dash orphan")
+				So(query.Result[1].Id, ShouldEqual, inDashboard.Id)
+			})
+
 			Convey("Should be able to get dashboard tags", func() {
 				query := m.GetDashboardTagsQuery{OrgId: 1}
 
@@ -259,6 +344,36 @@ func TestDashboardDataAccess(t *testing.T) {
 				So(hit.FolderTitle, ShouldEqual, "")
 			})
 
+			Convey("Should record and filter by dashboard source", func() {
+				cmd := m.SaveDashboardCommand{
+					OrgId:  1,
+					Source: m.DashboardSourceProvisioning,
+					Dashboard: simplejson.NewFromAny(map[string]interface{}{
+						"title": "provisioned dash",
+					}),
+				}
+				err := SaveDashboard(&cmd)
+				So(err, ShouldBeNil)
+
+				dashQuery := m.GetDashboardQuery{Id: cmd.Result.Id, OrgId: 1}
+				err = GetDashboard(&dashQuery)
+				So(err, ShouldBeNil)
+				So(dashQuery.Result.Source, ShouldEqual, m.DashboardSourceProvisioning)
+				So(savedDash.Source, ShouldEqual, m.DashboardSourceUnknown)
+
+				query := search.FindPersistedDashboardsQuery{
+					OrgId:        1,
+					SignedInUser: &m.SignedInUser{OrgId: 1, OrgRole: m.ROLE_EDITOR},
+					Source:       string(m.DashboardSourceProvisioning),
+				}
+
+				err = SearchDashboards(&query)
+				So(err, ShouldBeNil)
+				So(len(query.Result), ShouldEqual, 1)
+				So(query.Result[0].Title, ShouldEqual, "provisioned dash")
+				So(query.Result[0].Source, ShouldEqual, "provisioning")
+			})
+
 			Convey("Should be able to limit search", func() {
 				query := search.FindPersistedDashboardsQuery{
 					OrgId:        1,
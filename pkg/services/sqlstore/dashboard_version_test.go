@@ -64,6 +64,30 @@ func TestGetDashboardVersion(t *testing.T) {
 			So(err, ShouldNotBeNil)
 			So(err, ShouldEqual, m.ErrDashboardVersionNotFound)
 		})
+
+		Convey("Record where a version was saved from", func() {
+			savedDash := insertTestDashboard("test dash audit", 1, 0, false)
+
+			saveCmd := m.SaveDashboardCommand{
+				OrgId:     1,
+				Overwrite: true,
+				Dashboard: simplejson.NewFromAny(map[string]interface{}{"id": savedDash.Id, "title": "test dash audit"}),
+				RequestMeta: &m.RequestMeta{
+					ClientIp:  "192.168.1.10",
+					UserAgent: "curl/7.64.1",
+					RequestId: "f3a9c2",
+				},
+			}
+			So(SaveDashboard(&saveCmd), ShouldBeNil)
+
+			version := &m.DashboardVersion{}
+			has, err := x.Where("dashboard_id = ? AND version = ?", savedDash.Id, saveCmd.Result.Version).Get(version)
+			So(err, ShouldBeNil)
+			So(has, ShouldBeTrue)
+			So(version.ClientIp, ShouldEqual, "192.168.1.10")
+			So(version.UserAgent, ShouldEqual, "curl/7.64.1")
+			So(version.RequestId, ShouldEqual, "f3a9c2")
+		})
 	})
 }
 
@@ -0,0 +1,125 @@
+package sqlstore
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", RecordDashboardView)
+	bus.AddHandler("sql", GetStaleDashboards)
+}
+
+// RecordDashboardView sets when the dashboard was last viewed
+func RecordDashboardView(cmd *models.RecordDashboardViewCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		viewedAt := cmd.ViewedAt.Unix()
+		result, err := sess.Exec("UPDATE dashboard_view SET last_viewed_at = ? WHERE dashboard_id = ?", viewedAt, cmd.DashboardId)
+		if err != nil {
+			return err
+		}
+
+		if rows, err := result.RowsAffected(); err != nil || rows > 0 {
+			return err
+		}
+
+		_, err = sess.Insert(&models.DashboardView{OrgId: cmd.OrgId, DashboardId: cmd.DashboardId, LastViewedAt: viewedAt})
+		if err != nil && dialect.IsUniqueConstraintViolation(err) {
+			// viewed at the same time by another request, which recorded the view
+			return nil
+		}
+		return err
+	})
+}
+
+type staleDashboardProjection struct {
+	Id           int64
+	Uid          string
+	Title        string
+	Slug         string
+	FolderId     int64
+	FolderTitle  string
+	Version      int
+	Created      time.Time
+	LastViewedAt int64
+}
+
+// GetStaleDashboards returns the stale dashboards of the organization, the least recently viewed first.
+// Dashboards never viewed are stale once they were created before query.ViewedBefore. The templates of folders are
+// never stale, new dashboards use them without viewing them.
+func GetStaleDashboards(query *models.GetStaleDashboardsQuery) error {
+	var sql strings.Builder
+	params := make([]interface{}, 0)
+
+	sql.WriteString(`SELECT
+			dashboard.id,
+			dashboard.uid,
+			dashboard.title,
+			dashboard.slug,
+			dashboard.folder_id,
+			folder.title AS folder_title,
+			dashboard.version,
+			dashboard.created,
+			COALESCE(dashboard_view.last_viewed_at, 0) AS last_viewed_at
+		FROM dashboard
+		LEFT OUTER JOIN dashboard_view ON dashboard_view.dashboard_id = dashboard.id
+		LEFT OUTER JOIN dashboard AS folder ON folder.id = dashboard.folder_id
+		WHERE dashboard.org_id = ? AND dashboard.is_folder = ?
+		AND COALESCE(dashboard_view.last_viewed_at, 0) < ?
+		AND NOT EXISTS (SELECT 1 FROM folder_template WHERE folder_template.dashboard_id = dashboard.id)`)
+	params = append(params, query.OrgId, dialect.BooleanStr(false), query.ViewedBefore.Unix())
+
+	if query.ExcludeFolderId > 0 {
+		sql.WriteString(` AND dashboard.folder_id <> ?`)
+		params = append(params, query.ExcludeFolderId)
+	}
+
+	if len(query.ExcludeTags) > 0 {
+		sql.WriteString(` AND NOT EXISTS (SELECT 1 FROM dashboard_tag WHERE dashboard_tag.dashboard_id = dashboard.id AND dashboard_tag.term IN (?` +
+			strings.Repeat(",?", len(query.ExcludeTags)-1) + `))`)
+		for _, tag := range query.ExcludeTags {
+			params = append(params, tag)
+		}
+	}
+
+	var res []staleDashboardProjection
+	if err := x.SQL(sql.String(), params...).Find(&res); err != nil {
+		return err
+	}
+
+	query.Result = make([]*models.StaleDashboard, 0)
+	for _, item := range res {
+		lastViewed := time.Unix(item.LastViewedAt, 0)
+		if item.LastViewedAt == 0 {
+			// the created column is a datetime, so it is compared here rather than in the query
+			if !item.Created.Before(query.ViewedBefore) {
+				continue
+			}
+			lastViewed = item.Created
+		}
+
+		query.Result = append(query.Result, &models.StaleDashboard{
+			Id:          item.Id,
+			Uid:         item.Uid,
+			Title:       item.Title,
+			Slug:        item.Slug,
+			FolderId:    item.FolderId,
+			FolderTitle: item.FolderTitle,
+			Version:     item.Version,
+			LastViewed:  lastViewed,
+		})
+	}
+
+	sort.SliceStable(query.Result, func(i, j int) bool {
+		a, b := query.Result[i], query.Result[j]
+		if !a.LastViewed.Equal(b.LastViewed) {
+			return a.LastViewed.Before(b.LastViewed)
+		}
+		return a.Title < b.Title
+	})
+	return nil
+}
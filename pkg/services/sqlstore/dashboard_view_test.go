@@ -0,0 +1,85 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboardViewDataAccess(t *testing.T) {
+	Convey("Testing dashboard view data access", t, func() {
+		InitTestDB(t)
+
+		viewedAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.Local)
+		folder := insertTestDashboard("Ops", 1, 0, true)
+		viewed := insertTestDashboard("Viewed", 1, folder.Id, false)
+		kept := insertTestDashboard("Kept", 1, 0, false, "keep")
+		neverViewed := insertTestDashboard("Never viewed", 1, 0, false)
+		other := insertTestDashboard("Other org", 2, 0, false)
+
+		for _, dash := range []*models.Dashboard{viewed, kept, other} {
+			err := RecordDashboardView(&models.RecordDashboardViewCommand{OrgId: dash.OrgId, DashboardId: dash.Id, ViewedAt: viewedAt})
+			So(err, ShouldBeNil)
+		}
+
+		staleIds := func(query *models.GetStaleDashboardsQuery) []int64 {
+			So(GetStaleDashboards(query), ShouldBeNil)
+			ids := make([]int64, 0)
+			for _, dash := range query.Result {
+				ids = append(ids, dash.Id)
+			}
+			return ids
+		}
+
+		Convey("Should not return the dashboards viewed at the boundary", func() {
+			So(staleIds(&models.GetStaleDashboardsQuery{OrgId: 1, ViewedBefore: viewedAt}), ShouldBeEmpty)
+		})
+
+		Convey("Should return the dashboards viewed before the boundary, with their folder", func() {
+			query := &models.GetStaleDashboardsQuery{OrgId: 1, ViewedBefore: viewedAt.Add(time.Second)}
+			So(staleIds(query), ShouldResemble, []int64{kept.Id, viewed.Id})
+			So(query.Result[1].Uid, ShouldEqual, viewed.Uid)
+			So(query.Result[1].FolderId, ShouldEqual, folder.Id)
+			So(query.Result[1].FolderTitle, ShouldEqual, "Ops")
+			So(query.Result[1].LastViewed.Unix(), ShouldEqual, viewedAt.Unix())
+		})
+
+		Convey("Should return the dashboards never viewed once created before the boundary", func() {
+			So(staleIds(&models.GetStaleDashboardsQuery{OrgId: 1, ViewedBefore: time.Now().Add(time.Hour)}), ShouldResemble,
+				[]int64{kept.Id, viewed.Id, neverViewed.Id})
+		})
+
+		Convey("Should not return the dashboards viewed again", func() {
+			err := RecordDashboardView(&models.RecordDashboardViewCommand{OrgId: 1, DashboardId: viewed.Id, ViewedAt: viewedAt.Add(time.Hour)})
+			So(err, ShouldBeNil)
+
+			So(staleIds(&models.GetStaleDashboardsQuery{OrgId: 1, ViewedBefore: viewedAt.Add(time.Hour)}), ShouldResemble, []int64{kept.Id})
+		})
+
+		Convey("Should not return the dashboards with an excluded tag or in the excluded folder", func() {
+			query := &models.GetStaleDashboardsQuery{OrgId: 1, ViewedBefore: viewedAt.Add(time.Second), ExcludeTags: []string{"keep", "other"}}
+			So(staleIds(query), ShouldResemble, []int64{viewed.Id})
+
+			query = &models.GetStaleDashboardsQuery{OrgId: 1, ViewedBefore: viewedAt.Add(time.Second), ExcludeFolderId: folder.Id}
+			So(staleIds(query), ShouldResemble, []int64{kept.Id})
+		})
+
+		Convey("Should not return the templates of folders", func() {
+			err := SetFolderTemplate(&models.SetFolderTemplateCommand{OrgId: 1, FolderId: folder.Id, DashboardId: kept.Id})
+			So(err, ShouldBeNil)
+
+			So(staleIds(&models.GetStaleDashboardsQuery{OrgId: 1, ViewedBefore: viewedAt.Add(time.Second)}), ShouldResemble, []int64{viewed.Id})
+		})
+
+		Convey("Should forget the views of deleted dashboards", func() {
+			So(DeleteDashboard(&models.DeleteDashboardCommand{Id: folder.Id, OrgId: 1}), ShouldBeNil)
+
+			var count int64
+			_, err := x.SQL("SELECT COUNT(*) FROM dashboard_view WHERE dashboard_id = ?", viewed.Id).Get(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/securejsondata"
+	"github.com/grafana/grafana/pkg/events"
 	"github.com/grafana/grafana/pkg/infra/metrics"
 	m "github.com/grafana/grafana/pkg/models"
 )
@@ -70,24 +71,51 @@ func GetAllDataSources(query *m.GetAllDataSourcesQuery) error {
 
 func DeleteDataSourceById(cmd *m.DeleteDataSourceByIdCommand) error {
 	return inTransaction(func(sess *DBSession) error {
+		existing := m.DataSource{Id: cmd.Id, OrgId: cmd.OrgId}
+		if _, err := sess.Get(&existing); err != nil {
+			return err
+		}
+
 		var rawSql = "DELETE FROM data_source WHERE id=? and org_id=?"
 		result, err := sess.Exec(rawSql, cmd.Id, cmd.OrgId)
 		affected, _ := result.RowsAffected()
 		cmd.DeletedDatasourcesCount = affected
+
+		if affected > 0 {
+			publishDataSourceDeleted(sess, &existing)
+		}
 		return err
 	})
 }
 
 func DeleteDataSourceByName(cmd *m.DeleteDataSourceByNameCommand) error {
 	return inTransaction(func(sess *DBSession) error {
+		existing := m.DataSource{Name: cmd.Name, OrgId: cmd.OrgId}
+		if _, err := sess.Get(&existing); err != nil {
+			return err
+		}
+
 		var rawSql = "DELETE FROM data_source WHERE name=? and org_id=?"
 		result, err := sess.Exec(rawSql, cmd.Name, cmd.OrgId)
 		affected, _ := result.RowsAffected()
 		cmd.DeletedDatasourcesCount = affected
+
+		if affected > 0 {
+			publishDataSourceDeleted(sess, &existing)
+		}
 		return err
 	})
 }
 
+func publishDataSourceDeleted(sess *DBSession, ds *m.DataSource) {
+	sess.publishAfterCommit(&events.DataSourceDeleted{
+		Timestamp: time.Now(),
+		Id:        ds.Id,
+		OrgId:     ds.OrgId,
+		Name:      ds.Name,
+	})
+}
+
 func AddDataSource(cmd *m.AddDataSourceCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		existing := m.DataSource{OrgId: cmd.OrgId, Name: cmd.Name}
@@ -130,6 +158,13 @@ func AddDataSource(cmd *m.AddDataSourceCommand) error {
 			return err
 		}
 
+		sess.publishAfterCommit(&events.DataSourceCreated{
+			Timestamp: ds.Created,
+			Id:        ds.Id,
+			OrgId:     ds.OrgId,
+			Name:      ds.Name,
+		})
+
 		cmd.Result = ds
 		return nil
 	})
@@ -148,6 +183,11 @@ func updateIsDefaultFlag(ds *m.DataSource, sess *DBSession) error {
 
 func UpdateDataSource(cmd *m.UpdateDataSourceCommand) error {
 	return inTransaction(func(sess *DBSession) error {
+		previous := m.DataSource{Id: cmd.Id, OrgId: cmd.OrgId}
+		if _, err := sess.Cols("name").Get(&previous); err != nil {
+			return err
+		}
+
 		if cmd.JsonData == nil {
 			cmd.JsonData = simplejson.New()
 		}
@@ -205,6 +245,14 @@ func UpdateDataSource(cmd *m.UpdateDataSourceCommand) error {
 
 		err = updateIsDefaultFlag(ds, sess)
 
+		sess.publishAfterCommit(&events.DataSourceUpdated{
+			Timestamp:    ds.Updated,
+			Id:           ds.Id,
+			OrgId:        ds.OrgId,
+			Name:         ds.Name,
+			PreviousName: previous.Name,
+		})
+
 		cmd.Result = ds
 		return err
 	})
@@ -0,0 +1,48 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetFolderTemplate)
+	bus.AddHandler("sql", SetFolderTemplate)
+}
+
+func GetFolderTemplate(query *models.GetFolderTemplateQuery) error {
+	template := &models.FolderTemplate{}
+	exists, err := x.Where("org_id = ? AND folder_id = ?", query.OrgId, query.FolderId).Get(template)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		query.Result = template
+	}
+	return nil
+}
+
+// SetFolderTemplate replaces the template of the folder, or removes it when cmd.DashboardId is 0
+func SetFolderTemplate(cmd *models.SetFolderTemplateCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		if _, err := sess.Exec("DELETE FROM folder_template WHERE org_id = ? AND folder_id = ?", cmd.OrgId, cmd.FolderId); err != nil {
+			return err
+		}
+
+		if cmd.DashboardId == 0 {
+			return nil
+		}
+
+		_, err := sess.Insert(&models.FolderTemplate{
+			OrgId:       cmd.OrgId,
+			FolderId:    cmd.FolderId,
+			DashboardId: cmd.DashboardId,
+			UpdatedBy:   cmd.UpdatedBy,
+			Updated:     time.Now(),
+		})
+		return err
+	})
+}
@@ -0,0 +1,63 @@
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFolderTemplateDataAccess(t *testing.T) {
+	Convey("Testing folder template data access", t, func() {
+		InitTestDB(t)
+
+		folder := insertTestDashboard("Ops", 1, 0, true)
+		template := insertTestDashboard("Ops template", 1, folder.Id, false)
+		other := insertTestDashboard("Other template", 1, 0, false)
+
+		get := func(folderId int64) *models.FolderTemplate {
+			query := &models.GetFolderTemplateQuery{OrgId: 1, FolderId: folderId}
+			So(GetFolderTemplate(query), ShouldBeNil)
+			return query.Result
+		}
+
+		Convey("Should return no template for a folder without one", func() {
+			So(get(folder.Id), ShouldBeNil)
+		})
+
+		Convey("Given the template of a folder", func() {
+			err := SetFolderTemplate(&models.SetFolderTemplateCommand{OrgId: 1, FolderId: folder.Id, DashboardId: template.Id, UpdatedBy: 2})
+			So(err, ShouldBeNil)
+
+			Convey("Should return the template of the folder only in its organization", func() {
+				So(get(folder.Id).DashboardId, ShouldEqual, template.Id)
+				So(get(folder.Id).UpdatedBy, ShouldEqual, 2)
+
+				query := &models.GetFolderTemplateQuery{OrgId: 2, FolderId: folder.Id}
+				So(GetFolderTemplate(query), ShouldBeNil)
+				So(query.Result, ShouldBeNil)
+			})
+
+			Convey("Should replace the template of the folder", func() {
+				err := SetFolderTemplate(&models.SetFolderTemplateCommand{OrgId: 1, FolderId: folder.Id, DashboardId: other.Id})
+				So(err, ShouldBeNil)
+				So(get(folder.Id).DashboardId, ShouldEqual, other.Id)
+			})
+
+			Convey("Should remove the template of the folder", func() {
+				So(SetFolderTemplate(&models.SetFolderTemplateCommand{OrgId: 1, FolderId: folder.Id}), ShouldBeNil)
+				So(get(folder.Id), ShouldBeNil)
+			})
+
+			Convey("Should remove the template when the template dashboard is deleted", func() {
+				So(DeleteDashboard(&models.DeleteDashboardCommand{Id: template.Id, OrgId: 1}), ShouldBeNil)
+				So(get(folder.Id), ShouldBeNil)
+			})
+
+			Convey("Should remove the template when the folder is deleted", func() {
+				So(DeleteDashboard(&models.DeleteDashboardCommand{Id: folder.Id, OrgId: 1}), ShouldBeNil)
+				So(get(folder.Id), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetGitSyncAlertState)
+	bus.AddHandler("sql", SaveGitSyncAlertState)
+	bus.AddHandler("sql", DeleteGitSyncAlertState)
+}
+
+func GetGitSyncAlertState(query *models.GetGitSyncAlertStateQuery) error {
+	state := &models.GitSyncAlertState{}
+
+	exist, err := x.Where("org_id = ? AND repo = ?", query.OrgId, query.Repo).Get(state)
+	if err != nil {
+		return err
+	}
+	if exist {
+		query.Result = state
+	}
+	return nil
+}
+
+// SaveGitSyncAlertState stores the state of the repository, replacing the previous one
+func SaveGitSyncAlertState(cmd *models.SaveGitSyncAlertStateCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		state := cmd.State
+		state.Updated = time.Now()
+
+		existing := &models.GitSyncAlertState{}
+		exist, err := sess.Where("org_id = ? AND repo = ?", state.OrgId, state.Repo).Get(existing)
+		if err != nil {
+			return err
+		}
+
+		if exist {
+			state.Id = existing.Id
+			_, err = sess.ID(existing.Id).AllCols().Update(state)
+		} else {
+			_, err = sess.Insert(state)
+		}
+		return err
+	})
+}
+
+func DeleteGitSyncAlertState(cmd *models.DeleteGitSyncAlertStateCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("DELETE FROM git_sync_alert_state WHERE org_id = ? AND repo = ?", cmd.OrgId, cmd.Repo)
+		return err
+	})
+}
@@ -0,0 +1,69 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGitSyncAlertStateDataAccess(t *testing.T) {
+	Convey("Testing git sync alert state data access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should return no state for a repository that is not failing", func() {
+			query := &models.GetGitSyncAlertStateQuery{OrgId: 1, Repo: "ops"}
+			So(GetGitSyncAlertState(query), ShouldBeNil)
+			So(query.Result, ShouldBeNil)
+		})
+
+		Convey("Given a failing repository", func() {
+			firstFailure := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+			err := SaveGitSyncAlertState(&models.SaveGitSyncAlertStateCommand{State: &models.GitSyncAlertState{
+				OrgId:        1,
+				Repo:         "ops",
+				Failures:     1,
+				DashboardIds: []int64{3},
+				LastError:    "Failed to sync dashboard",
+				FirstFailure: firstFailure,
+			}})
+			So(err, ShouldBeNil)
+
+			Convey("Saving should replace the state", func() {
+				err := SaveGitSyncAlertState(&models.SaveGitSyncAlertStateCommand{State: &models.GitSyncAlertState{
+					OrgId:        1,
+					Repo:         "ops",
+					Failures:     2,
+					DashboardIds: []int64{3, 4},
+					FirstFailure: firstFailure,
+					LastNotified: firstFailure.Add(time.Minute),
+					Escalated:    true,
+				}})
+				So(err, ShouldBeNil)
+
+				query := &models.GetGitSyncAlertStateQuery{OrgId: 1, Repo: "ops"}
+				So(GetGitSyncAlertState(query), ShouldBeNil)
+				So(query.Result.Failures, ShouldEqual, 2)
+				So(query.Result.DashboardIds, ShouldResemble, []int64{3, 4})
+				So(query.Result.FirstFailure.Unix(), ShouldEqual, firstFailure.Unix())
+				So(query.Result.LastNotified.Unix(), ShouldEqual, firstFailure.Add(time.Minute).Unix())
+				So(query.Result.Escalated, ShouldBeTrue)
+			})
+
+			Convey("Should keep the states of other repositories apart", func() {
+				query := &models.GetGitSyncAlertStateQuery{OrgId: 2, Repo: "ops"}
+				So(GetGitSyncAlertState(query), ShouldBeNil)
+				So(query.Result, ShouldBeNil)
+			})
+
+			Convey("Deleting should clear the state", func() {
+				So(DeleteGitSyncAlertState(&models.DeleteGitSyncAlertStateCommand{OrgId: 1, Repo: "ops"}), ShouldBeNil)
+
+				query := &models.GetGitSyncAlertStateQuery{OrgId: 1, Repo: "ops"}
+				So(GetGitSyncAlertState(query), ShouldBeNil)
+				So(query.Result, ShouldBeNil)
+			})
+		})
+	})
+}
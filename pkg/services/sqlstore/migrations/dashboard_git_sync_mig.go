@@ -0,0 +1,54 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addDashboardGitSyncMigrations(mg *Migrator) {
+	dashboardGitSyncV1 := Table{
+		Name: "dashboard_git_sync",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "dashboard_id", Type: DB_BigInt, Nullable: false},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "repo_id", Type: DB_Int, Nullable: false, Default: "0"},
+			{Name: "provider", Type: DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "file_path", Type: DB_NVarchar, Length: 1024, Nullable: false},
+			{Name: "branch", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "commit_sha", Type: DB_NVarchar, Length: 64, Nullable: false},
+			{Name: "commit_mode", Type: DB_NVarchar, Length: 20, Nullable: true},
+			{Name: "fallback_action", Type: DB_NVarchar, Length: 20, Nullable: true},
+			{Name: "source_format", Type: DB_NVarchar, Length: 20, Nullable: true},
+			{Name: "content_hash", Type: DB_NVarchar, Length: 64, Nullable: true},
+			{Name: "conflict_commit_sha", Type: DB_NVarchar, Length: 64, Nullable: true},
+			{Name: "client_ip", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "user_agent", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "request_id", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"dashboard_id"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create dashboard_git_sync table", NewAddTableMigration(dashboardGitSyncV1))
+	mg.AddMigration("add unique index dashboard_git_sync.dashboard_id", NewAddIndexMigration(dashboardGitSyncV1, dashboardGitSyncV1.Indices[0]))
+
+	dashboardGitSyncPathV1 := Table{
+		Name: "dashboard_git_sync_path",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "dashboard_id", Type: DB_BigInt, Nullable: false},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "repo_id", Type: DB_Int, Nullable: false},
+			{Name: "file_path", Type: DB_NVarchar, Length: 1024, Nullable: false},
+			{Name: "path_hash", Type: DB_NVarchar, Length: 32, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "path_hash"}},
+			{Cols: []string{"dashboard_id"}},
+		},
+	}
+
+	mg.AddMigration("create dashboard_git_sync_path table", NewAddTableMigration(dashboardGitSyncPathV1))
+	addTableIndicesMigrations(mg, "v1", dashboardGitSyncPathV1)
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addDashboardJobMigrations(mg *Migrator) {
+	dashboardJobV1 := Table{
+		Name: "dashboard_job",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "kind", Type: DB_NVarchar, Length: 50, Nullable: false},
+			{Name: "params", Type: DB_Text, Nullable: true},
+			{Name: "state", Type: DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "done", Type: DB_Int, Nullable: false},
+			{Name: "total", Type: DB_Int, Nullable: false},
+			{Name: "result", Type: DB_MediumText, Nullable: true},
+			{Name: "error", Type: DB_Text, Nullable: true},
+			{Name: "created_by", Type: DB_BigInt, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+			{Name: "started", Type: DB_DateTime, Nullable: true},
+			{Name: "finished", Type: DB_DateTime, Nullable: true},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"state"}},
+			{Cols: []string{"finished"}},
+		},
+	}
+
+	mg.AddMigration("create dashboard_job table", NewAddTableMigration(dashboardJobV1))
+	addTableIndicesMigrations(mg, "v1", dashboardJobV1)
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addDashboardMaintenanceMigrations(mg *Migrator) {
+	dashboardMaintenanceV1 := Table{
+		Name: "dashboard_maintenance",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "read_only", Type: DB_Bool, Nullable: false},
+			{Name: "message", Type: DB_Text, Nullable: true},
+			{Name: "ends_at", Type: DB_BigInt, Nullable: false},
+			{Name: "updated_by", Type: DB_BigInt, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+	}
+
+	mg.AddMigration("create dashboard_maintenance table", NewAddTableMigration(dashboardMaintenanceV1))
+}
@@ -215,4 +215,12 @@ func addDashboardMigration(mg *Migrator) {
 	mg.AddMigration("Add check_sum column", NewAddColumnMigration(dashboardExtrasTableV2, &Column{
 		Name: "check_sum", Type: DB_NVarchar, Length: 32, Nullable: true,
 	}))
+
+	// add column to store where the last save of a dashboard came from
+	mg.AddMigration("Add column source in dashboard", NewAddColumnMigration(dashboardV2, &Column{
+		Name: "source", Type: DB_NVarchar, Length: 40, Nullable: true,
+	}))
+
+	mg.AddMigration("Update source column values in dashboard", NewRawSqlMigration(
+		"UPDATE dashboard SET source='unknown' WHERE source IS NULL;"))
 }
@@ -0,0 +1,43 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addDashboardSyncOutboxMigrations(mg *Migrator) {
+	dashboardSyncOutboxV1 := Table{
+		Name: "dashboard_sync_outbox",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "dashboard_id", Type: DB_BigInt, Nullable: false},
+			{Name: "action", Type: DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "dashboard", Type: DB_MediumText, Nullable: false},
+			{Name: "folder_id", Type: DB_BigInt, Nullable: false},
+			{Name: "repo", Type: DB_NVarchar, Length: 190, Nullable: true},
+			{Name: "message", Type: DB_Text, Nullable: true},
+			{Name: "source", Type: DB_NVarchar, Length: 50, Nullable: true},
+			{Name: "user_id", Type: DB_BigInt, Nullable: false},
+			{Name: "auth_module", Type: DB_NVarchar, Length: 190, Nullable: true},
+			{Name: "branch", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "repo_id", Type: DB_Int, Nullable: false},
+			{Name: "coauthors", Type: DB_Text, Nullable: true},
+			{Name: "request_id", Type: DB_NVarchar, Length: 190, Nullable: true},
+			{Name: "status", Type: DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "attempts", Type: DB_Int, Nullable: false},
+			{Name: "next_retry", Type: DB_DateTime, Nullable: false},
+			{Name: "lease_owner", Type: DB_NVarchar, Length: 190, Nullable: true},
+			{Name: "lease_until", Type: DB_DateTime, Nullable: true},
+			{Name: "version", Type: DB_BigInt, Nullable: false},
+			{Name: "error", Type: DB_Text, Nullable: true},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"status", "next_retry"}},
+			{Cols: []string{"org_id", "status"}},
+			{Cols: []string{"dashboard_id"}},
+		},
+	}
+
+	mg.AddMigration("create dashboard_sync_outbox table", NewAddTableMigration(dashboardSyncOutboxV1))
+	addTableIndicesMigrations(mg, "v1", dashboardSyncOutboxV1)
+}
@@ -56,4 +56,15 @@ FROM dashboard;`
 	// change column type of dashboard_version.data
 	mg.AddMigration("alter dashboard_version.data to mediumtext v1", NewRawSqlMigration("").
 		Mysql("ALTER TABLE dashboard_version MODIFY data MEDIUMTEXT;"))
+
+	// where versions are saved from, for audits
+	mg.AddMigration("add client_ip column to dashboard_version", NewAddColumnMigration(dashboardVersionV1, &Column{
+		Name: "client_ip", Type: DB_NVarchar, Length: 255, Nullable: true,
+	}))
+	mg.AddMigration("add user_agent column to dashboard_version", NewAddColumnMigration(dashboardVersionV1, &Column{
+		Name: "user_agent", Type: DB_NVarchar, Length: 255, Nullable: true,
+	}))
+	mg.AddMigration("add request_id column to dashboard_version", NewAddColumnMigration(dashboardVersionV1, &Column{
+		Name: "request_id", Type: DB_NVarchar, Length: 255, Nullable: true,
+	}))
 }
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"fmt"
+
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+func addDashboardViewMigrations(mg *Migrator) {
+	dashboardViewV1 := Table{
+		Name: "dashboard_view",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "dashboard_id", Type: DB_BigInt, Nullable: false},
+			{Name: "last_viewed_at", Type: DB_BigInt, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"dashboard_id"}, Type: UniqueIndex},
+			{Cols: []string{"org_id", "last_viewed_at"}},
+		},
+	}
+
+	mg.AddMigration("create dashboard_view table", NewAddTableMigration(dashboardViewV1))
+	addTableIndicesMigrations(mg, "v1", dashboardViewV1)
+
+	// views were not tracked before, so the existing dashboards start as viewed rather than all stale at once
+	rawSQL := "INSERT INTO dashboard_view (org_id, dashboard_id, last_viewed_at) SELECT org_id, id, %s FROM dashboard WHERE is_folder = %s"
+	mg.AddMigration("mark existing dashboards as viewed in dashboard_view table", NewRawSqlMigration("").
+		Sqlite(fmt.Sprintf(rawSQL, "CAST(strftime('%s', 'now') AS INTEGER)", "0")).
+		Mysql(fmt.Sprintf(rawSQL, "UNIX_TIMESTAMP()", "0")).
+		Postgres(fmt.Sprintf(rawSQL, "CAST(EXTRACT(EPOCH FROM now()) AS BIGINT)", "false")))
+}
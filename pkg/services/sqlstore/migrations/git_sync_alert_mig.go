@@ -0,0 +1,27 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addGitSyncAlertMigrations(mg *Migrator) {
+	gitSyncAlertV1 := Table{
+		Name: "git_sync_alert_state",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "repo", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "failures", Type: DB_BigInt, Nullable: false},
+			{Name: "dashboard_ids", Type: DB_Text, Nullable: true},
+			{Name: "last_error", Type: DB_Text, Nullable: true},
+			{Name: "first_failure", Type: DB_DateTime, Nullable: false},
+			{Name: "last_notified", Type: DB_DateTime, Nullable: true},
+			{Name: "escalated", Type: DB_Bool, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "repo"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create git_sync_alert_state table", NewAddTableMigration(gitSyncAlertV1))
+	addTableIndicesMigrations(mg, "v1", gitSyncAlertV1)
+}
@@ -34,6 +34,14 @@ func AddMigrations(mg *Migrator) {
 	addServerlockMigrations(mg)
 	addUserAuthTokenMigrations(mg)
 	addCacheMigration(mg)
+	addDashboardGitSyncMigrations(mg)
+	addOrgOAuthConfigMigrations(mg)
+	addGitSyncAlertMigrations(mg)
+	addDashboardJobMigrations(mg)
+	addDashboardViewMigrations(mg)
+	addDashboardMaintenanceMigrations(mg)
+	addDashboardSyncOutboxMigrations(mg)
+	addFolderTemplateMigrations(mg)
 }
 
 func addMigrationLogMigrations(mg *Migrator) {
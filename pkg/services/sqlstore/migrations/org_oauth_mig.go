@@ -0,0 +1,27 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addOrgOAuthConfigMigrations(mg *Migrator) {
+	orgOAuthConfigV1 := Table{
+		Name: "org_oauth_config",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "provider", Type: DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "client_id", Type: DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "auth_url", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "token_url", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "api_url", Type: DB_NVarchar, Length: 255, Nullable: true},
+			{Name: "secure_json_data", Type: DB_Text, Nullable: true},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+			{Name: "updated", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "provider"}, Type: UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create org_oauth_config table", NewAddTableMigration(orgOAuthConfigV1))
+	mg.AddMigration("add unique index org_oauth_config.org_id_provider", NewAddIndexMigration(orgOAuthConfigV1, orgOAuthConfigV1.Indices[0]))
+}
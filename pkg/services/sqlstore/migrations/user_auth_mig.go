@@ -1,6 +1,10 @@
 package migrations
 
-import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+import (
+	"fmt"
+
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
 
 func addUserAuthMigrations(mg *Migrator) {
 	userAuthV1 := Table{
@@ -42,4 +46,34 @@ func addUserAuthMigrations(mg *Migrator) {
 	mg.AddMigration("Add index to user_id column in user_auth", NewAddIndexMigration(userAuthV1, &Index{
 		Cols: []string{"user_id"},
 	}))
+
+	mg.AddMigration("Add external login to user_auth", NewAddColumnMigration(userAuthV1, &Column{
+		Name: "external_login", Type: DB_NVarchar, Length: 190, Nullable: true,
+	}))
+	mg.AddMigration("Add external email to user_auth", NewAddColumnMigration(userAuthV1, &Column{
+		Name: "external_email", Type: DB_NVarchar, Length: 190, Nullable: true,
+	}))
+	mg.AddMigration("Add external groups to user_auth", NewAddColumnMigration(userAuthV1, &Column{
+		Name: "external_groups", Type: DB_Text, Nullable: true,
+	}))
+	mg.AddMigration("Add last synced at to user_auth", NewAddColumnMigration(userAuthV1, &Column{
+		Name: "last_synced_at", Type: DB_DateTime, Nullable: true,
+	}))
+
+	// users logged in before had their login and email synced from the provider, their groups are unknown
+	// until they log in again
+	backfillSql := func(user string) string {
+		return fmt.Sprintf("UPDATE user_auth SET "+
+			"external_login = (SELECT login FROM %[1]s WHERE %[1]s.id = user_auth.user_id), "+
+			"external_email = (SELECT email FROM %[1]s WHERE %[1]s.id = user_auth.user_id) "+
+			"WHERE external_login IS NULL", user)
+	}
+	mg.AddMigration("Copy the login and email of users to user_auth", NewRawSqlMigration("").
+		Sqlite(backfillSql(`"user"`)).
+		Postgres(backfillSql(`"user"`)).
+		Mysql(backfillSql("`user`")))
+
+	// the grafananet provider was renamed grafana_com, its users kept their rows under the former module
+	mg.AddMigration("Rename the grafananet auth module to grafana_com", NewRawSqlMigration(
+		"UPDATE user_auth SET auth_module = 'oauth_grafana_com' WHERE auth_module = 'oauth_grafananet'"))
 }
@@ -202,6 +202,7 @@ func DeleteOrg(cmd *m.DeleteOrgCommand) error {
 			"DELETE FROM org_user WHERE org_id = ?",
 			"DELETE FROM org WHERE id = ?",
 			"DELETE FROM temp_user WHERE org_id = ?",
+			"DELETE FROM org_oauth_config WHERE org_id = ?",
 		}
 
 		for _, sql := range deletes {
@@ -0,0 +1,88 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/securejsondata"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetOrgOAuthConfig)
+	bus.AddHandler("sql", GetOrgOAuthConfigs)
+	bus.AddHandler("sql", SaveOrgOAuthConfig)
+	bus.AddHandler("sql", DeleteOrgOAuthConfig)
+}
+
+func GetOrgOAuthConfig(query *m.GetOrgOAuthConfigQuery) error {
+	config := m.OrgOAuthConfig{}
+	has, err := x.Where("org_id = ? AND provider = ?", query.OrgId, query.Provider).Get(&config)
+	if err != nil {
+		return err
+	}
+
+	if !has {
+		return m.ErrOrgOAuthConfigNotFound
+	}
+
+	query.Result = &config
+	return nil
+}
+
+func GetOrgOAuthConfigs(query *m.GetOrgOAuthConfigsQuery) error {
+	query.Result = make([]*m.OrgOAuthConfig, 0)
+	return x.Where("org_id = ?", query.OrgId).Asc("provider").Find(&query.Result)
+}
+
+func SaveOrgOAuthConfig(cmd *m.SaveOrgOAuthConfigCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		existing := m.OrgOAuthConfig{}
+		has, err := sess.Where("org_id = ? AND provider = ?", cmd.OrgId, cmd.Provider).Get(&existing)
+		if err != nil {
+			return err
+		}
+
+		config := &m.OrgOAuthConfig{
+			OrgId:          cmd.OrgId,
+			Provider:       cmd.Provider,
+			ClientId:       cmd.ClientId,
+			AuthUrl:        cmd.AuthUrl,
+			TokenUrl:       cmd.TokenUrl,
+			ApiUrl:         cmd.ApiUrl,
+			SecureJsonData: securejsondata.GetEncryptedJsonData(map[string]string{"clientSecret": cmd.ClientSecret}),
+			Created:        time.Now(),
+			Updated:        time.Now(),
+		}
+
+		if has {
+			config.Id = existing.Id
+			config.Created = existing.Created
+			_, err = sess.ID(existing.Id).AllCols().Update(config)
+		} else {
+			_, err = sess.Insert(config)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		cmd.Result = config
+		return nil
+	})
+}
+
+func DeleteOrgOAuthConfig(cmd *m.DeleteOrgOAuthConfigCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		result, err := sess.Exec("DELETE FROM org_oauth_config WHERE org_id = ? AND provider = ?", cmd.OrgId, cmd.Provider)
+		if err != nil {
+			return err
+		}
+
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return m.ErrOrgOAuthConfigNotFound
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"testing"
+
+	m "github.com/grafana/grafana/pkg/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOrgOAuthConfigDataAccess(t *testing.T) {
+	Convey("Testing org OAuth config data access", t, func() {
+		InitTestDB(t)
+
+		Convey("Should return not found for an org without config", func() {
+			query := &m.GetOrgOAuthConfigQuery{OrgId: 1, Provider: "gitlab"}
+			So(GetOrgOAuthConfig(query), ShouldEqual, m.ErrOrgOAuthConfigNotFound)
+		})
+
+		Convey("Given a saved config", func() {
+			err := SaveOrgOAuthConfig(&m.SaveOrgOAuthConfigCommand{
+				OrgId:        1,
+				Provider:     "gitlab",
+				ClientId:     "org-client",
+				ClientSecret: "org-secret",
+				AuthUrl:      "https://gitlab.org1.com/oauth/authorize",
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Should store the client secret encrypted", func() {
+				query := &m.GetOrgOAuthConfigQuery{OrgId: 1, Provider: "gitlab"}
+				So(GetOrgOAuthConfig(query), ShouldBeNil)
+				So(query.Result.ClientId, ShouldEqual, "org-client")
+				So(query.Result.AuthUrl, ShouldEqual, "https://gitlab.org1.com/oauth/authorize")
+				So(string(query.Result.SecureJsonData["clientSecret"]), ShouldNotEqual, "org-secret")
+				So(query.Result.DecryptedClientSecret(), ShouldEqual, "org-secret")
+			})
+
+			Convey("Saving again should replace it", func() {
+				err := SaveOrgOAuthConfig(&m.SaveOrgOAuthConfigCommand{
+					OrgId:        1,
+					Provider:     "gitlab",
+					ClientId:     "new-client",
+					ClientSecret: "new-secret",
+				})
+				So(err, ShouldBeNil)
+
+				query := &m.GetOrgOAuthConfigsQuery{OrgId: 1}
+				So(GetOrgOAuthConfigs(query), ShouldBeNil)
+				So(len(query.Result), ShouldEqual, 1)
+				So(query.Result[0].ClientId, ShouldEqual, "new-client")
+				So(query.Result[0].AuthUrl, ShouldEqual, "")
+			})
+
+			Convey("Should not be visible to other orgs", func() {
+				query := &m.GetOrgOAuthConfigQuery{OrgId: 2, Provider: "gitlab"}
+				So(GetOrgOAuthConfig(query), ShouldEqual, m.ErrOrgOAuthConfigNotFound)
+			})
+
+			Convey("Should delete it", func() {
+				So(DeleteOrgOAuthConfig(&m.DeleteOrgOAuthConfigCommand{OrgId: 1, Provider: "gitlab"}), ShouldBeNil)
+
+				query := &m.GetOrgOAuthConfigQuery{OrgId: 1, Provider: "gitlab"}
+				So(GetOrgOAuthConfig(query), ShouldEqual, m.ErrOrgOAuthConfigNotFound)
+				So(DeleteOrgOAuthConfig(&m.DeleteOrgOAuthConfigCommand{OrgId: 1, Provider: "gitlab"}), ShouldEqual, m.ErrOrgOAuthConfigNotFound)
+			})
+		})
+	})
+}
@@ -19,6 +19,7 @@ type SearchBuilder struct {
 	whereTypeFolder     bool
 	whereTypeDash       bool
 	whereFolderIds      []int64
+	whereSource         string
 	permission          m.PermissionType
 }
 
@@ -88,6 +89,11 @@ func (sb *SearchBuilder) WithFolderIds(folderIds []int64) *SearchBuilder {
 	return sb
 }
 
+func (sb *SearchBuilder) WithSource(source string) *SearchBuilder {
+	sb.whereSource = source
+	return sb
+}
+
 // ToSql builds the sql and returns it as a string, together with the params.
 func (sb *SearchBuilder) ToSql() (string, []interface{}) {
 	sb.params = make([]interface{}, 0)
@@ -123,6 +129,7 @@ func (sb *SearchBuilder) buildSelect() {
 			dashboard_tag.term,
 			dashboard.is_folder,
 			dashboard.folder_id,
+			dashboard.source,
 			folder.uid as folder_uid,
 			folder.slug as folder_slug,
 			folder.title as folder_title
@@ -202,4 +209,9 @@ func (sb *SearchBuilder) buildSearchWhereClause() {
 			sb.params = append(sb.params, id)
 		}
 	}
+
+	if len(sb.whereSource) > 0 {
+		sb.sql.WriteString(" AND dashboard.source = ?")
+		sb.params = append(sb.params, sb.whereSource)
+	}
 }
@@ -100,6 +100,10 @@ func (ss *SqlStore) Init() error {
 	// Register handlers
 	ss.addUserQueryAndCommandHandlers()
 
+	if err := renameLegacyAuthModules(); err != nil {
+		return fmt.Errorf("Failed to rename legacy auth modules: %v", err)
+	}
+
 	// ensure admin user
 	if ss.skipEnsureAdmin {
 		return nil
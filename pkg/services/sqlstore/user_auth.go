@@ -2,6 +2,7 @@ package sqlstore
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
@@ -12,6 +13,9 @@ import (
 
 var getTime = time.Now
 
+// legacyAuthModules maps the former auth modules of renamed providers to their current module
+var legacyAuthModules = map[string]string{"oauth_grafananet": "oauth_grafana_com"}
+
 func init() {
 	bus.AddHandler("sql", GetUserByAuthInfo)
 	bus.AddHandler("sql", GetExternalUserInfoByLogin)
@@ -19,6 +23,7 @@ func init() {
 	bus.AddHandler("sql", SetAuthInfo)
 	bus.AddHandler("sql", UpdateAuthInfo)
 	bus.AddHandler("sql", DeleteAuthInfo)
+	bus.AddHandler("sql", GetExternalIdentity)
 }
 
 func GetUserByAuthInfo(query *models.GetUserByAuthInfoQuery) error {
@@ -203,6 +208,10 @@ func SetAuthInfo(cmd *models.SetAuthInfoCommand) error {
 			authUser.OAuthExpiry = cmd.OAuthToken.Expiry
 		}
 
+		if err := setExternalIdentity(authUser, cmd.Identity); err != nil {
+			return err
+		}
+
 		_, err := sess.Insert(authUser)
 		return err
 	})
@@ -237,6 +246,10 @@ func UpdateAuthInfo(cmd *models.UpdateAuthInfoCommand) error {
 			authUser.OAuthExpiry = cmd.OAuthToken.Expiry
 		}
 
+		if err := setExternalIdentity(authUser, cmd.Identity); err != nil {
+			return err
+		}
+
 		cond := &models.UserAuth{
 			UserId:     cmd.UserId,
 			AuthModule: cmd.AuthModule,
@@ -247,6 +260,60 @@ func UpdateAuthInfo(cmd *models.UpdateAuthInfoCommand) error {
 	})
 }
 
+// setExternalIdentity records the identity of the user at the provider. Groups are always set, so a user removed
+// from all groups has no groups left.
+func setExternalIdentity(authUser *models.UserAuth, identity *models.ExternalUserInfo) error {
+	if identity == nil {
+		return nil
+	}
+
+	groups := identity.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	encoded, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+
+	authUser.ExternalLogin = identity.Login
+	authUser.ExternalEmail = identity.Email
+	authUser.ExternalGroups = string(encoded)
+	authUser.LastSyncedAt = getTime()
+	return nil
+}
+
+func GetExternalIdentity(query *models.GetExternalIdentityQuery) error {
+	userAuth := &models.UserAuth{
+		UserId:     query.UserId,
+		AuthModule: query.Provider,
+	}
+	has, err := x.Desc("created").Get(userAuth)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return models.ErrUserNotFound
+	}
+
+	groups := make([]string, 0)
+	if userAuth.ExternalGroups != "" {
+		if err := json.Unmarshal([]byte(userAuth.ExternalGroups), &groups); err != nil {
+			return err
+		}
+	}
+
+	query.Result = &models.ExternalIdentity{
+		Provider:     userAuth.AuthModule,
+		ExternalId:   userAuth.AuthId,
+		Login:        userAuth.ExternalLogin,
+		Email:        userAuth.ExternalEmail,
+		Groups:       groups,
+		LastSyncedAt: userAuth.LastSyncedAt,
+	}
+	return nil
+}
+
 func DeleteAuthInfo(cmd *models.DeleteAuthInfoCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		_, err := sess.Delete(cmd.UserAuth)
@@ -254,6 +321,23 @@ func DeleteAuthInfo(cmd *models.DeleteAuthInfoCommand) error {
 	})
 }
 
+// renameLegacyAuthModules moves the user_auth rows of renamed providers to their current module. The migration
+// renames the rows once, this also renames those written since by instances that were not upgraded yet.
+func renameLegacyAuthModules() error {
+	for legacy, current := range legacyAuthModules {
+		result, err := x.Exec("UPDATE user_auth SET auth_module = ? WHERE auth_module = ?", current, legacy)
+		if err != nil {
+			return err
+		}
+
+		if count, err := result.RowsAffected(); err == nil && count > 0 {
+			sqlog.Info("Renamed the legacy auth module of users", "from", legacy, "to", current, "count", count)
+		}
+	}
+
+	return nil
+}
+
 // decodeAndDecrypt will decode the string with the standard bas64 decoder
 // and then decrypt it with grafana's secretKey
 func decodeAndDecrypt(s string) (string, error) {
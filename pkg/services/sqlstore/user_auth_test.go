@@ -221,5 +221,90 @@ func TestUserAuth(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(getAuthQuery.Result.AuthModule, ShouldEqual, "test1")
 		})
+
+		Convey("Can record & retrieve the external identity of each linked provider", func() {
+			login := "loginuser0"
+			syncedAt := time.Date(2019, 8, 1, 10, 0, 0, 0, time.UTC)
+			getTime = func() time.Time { return syncedAt }
+
+			query := &m.GetUserByAuthInfoQuery{Login: login, AuthModule: "oauth_gitlab", AuthId: "42"}
+			err = GetUserByAuthInfo(query)
+			So(err, ShouldBeNil)
+			userId := query.Result.Id
+
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{
+				UserId:     userId,
+				AuthModule: "oauth_gitlab",
+				AuthId:     "42",
+				Identity:   &m.ExternalUserInfo{Login: "jdoe", Email: "jane@gitlab.example.com", Groups: []string{"ops", "ops/dashboards"}},
+			})
+			So(err, ShouldBeNil)
+
+			err = SetAuthInfo(&m.SetAuthInfoCommand{
+				UserId:     userId,
+				AuthModule: "ldap",
+				AuthId:     "cn=jdoe,dc=example,dc=com",
+				Identity:   &m.ExternalUserInfo{Login: "jane.doe", Email: "jane@example.com"},
+			})
+			So(err, ShouldBeNil)
+			getTime = time.Now
+
+			gitlab := &m.GetExternalIdentityQuery{UserId: userId, Provider: "oauth_gitlab"}
+			So(GetExternalIdentity(gitlab), ShouldBeNil)
+			So(gitlab.Result.ExternalId, ShouldEqual, "42")
+			So(gitlab.Result.Login, ShouldEqual, "jdoe")
+			So(gitlab.Result.Email, ShouldEqual, "jane@gitlab.example.com")
+			So(gitlab.Result.Groups, ShouldResemble, []string{"ops", "ops/dashboards"})
+			So(gitlab.Result.LastSyncedAt.Unix(), ShouldEqual, syncedAt.Unix())
+
+			ldap := &m.GetExternalIdentityQuery{UserId: userId, Provider: "ldap"}
+			So(GetExternalIdentity(ldap), ShouldBeNil)
+			So(ldap.Result.ExternalId, ShouldEqual, "cn=jdoe,dc=example,dc=com")
+			So(ldap.Result.Login, ShouldEqual, "jane.doe")
+			So(ldap.Result.Groups, ShouldBeEmpty)
+
+			// a login without groups clears them
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{
+				UserId:     userId,
+				AuthModule: "oauth_gitlab",
+				AuthId:     "42",
+				Identity:   &m.ExternalUserInfo{Login: "jdoe"},
+			})
+			So(err, ShouldBeNil)
+			So(GetExternalIdentity(gitlab), ShouldBeNil)
+			So(gitlab.Result.Groups, ShouldBeEmpty)
+			So(gitlab.Result.Email, ShouldEqual, "jane@gitlab.example.com")
+
+			err = GetExternalIdentity(&m.GetExternalIdentityQuery{UserId: userId, Provider: "oauth_github"})
+			So(err, ShouldEqual, m.ErrUserNotFound)
+		})
+
+		Convey("Users linked to the former grafananet provider keep their identity as grafana_com users", func() {
+			query := &m.GetUserByAuthInfoQuery{Login: "loginuser1", AuthModule: "oauth_grafananet", AuthId: "1001"}
+			So(GetUserByAuthInfo(query), ShouldBeNil)
+			userId := query.Result.Id
+
+			token := &oauth2.Token{AccessToken: "legacyaccess", RefreshToken: "legacyrefresh", TokenType: "Bearer"}
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{UserId: userId, AuthModule: "oauth_grafananet", AuthId: "1001", OAuthToken: token})
+			So(err, ShouldBeNil)
+
+			So(renameLegacyAuthModules(), ShouldBeNil)
+			So(renameLegacyAuthModules(), ShouldBeNil)
+
+			// the login no longer matches, the user is found by the renamed row
+			query = &m.GetUserByAuthInfoQuery{Login: "renamed", AuthModule: "oauth_grafana_com", AuthId: "1001"}
+			So(GetUserByAuthInfo(query), ShouldBeNil)
+			So(query.Result.Id, ShouldEqual, userId)
+
+			authQuery := &m.GetAuthInfoQuery{UserId: userId}
+			So(GetAuthInfo(authQuery), ShouldBeNil)
+			So(authQuery.Result.AuthModule, ShouldEqual, "oauth_grafana_com")
+			So(authQuery.Result.OAuthAccessToken, ShouldEqual, "legacyaccess")
+			So(authQuery.Result.OAuthRefreshToken, ShouldEqual, "legacyrefresh")
+
+			count, err := x.Table("user_auth").Where("user_id = ?", userId).Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
 	})
 }
@@ -0,0 +1,255 @@
+package staledashboards
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/serverlock"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func init() {
+	registry.RegisterService(&Reporter{})
+}
+
+var now = time.Now
+
+// orgsPageSize is the number of organizations reported on per query of the organizations
+const orgsPageSize = 1000
+
+// Reporter emails the admins of each folder the dashboards of the folder not viewed for stale_after, every
+// stale_report_interval. Each dashboard has a link archiving it, valid until the next report and as long as the
+// dashboard is not changed. Org admins are told about all the folders, folder admins about theirs. The report
+// runs on one instance of Grafana at a time.
+type Reporter struct {
+	log               log.Logger
+	ServerLockService *serverlock.ServerLockService `inject:""`
+}
+
+// reportFolder is a folder of stale dashboards in the email
+type reportFolder struct {
+	Title      string
+	Dashboards []*reportDashboard
+}
+
+type reportDashboard struct {
+	Title      string
+	Url        string
+	ArchiveUrl string
+	LastViewed string
+}
+
+func (r *Reporter) Init() error {
+	r.log = log.New("stale-dashboards")
+	return nil
+}
+
+func (r *Reporter) IsDisabled() bool {
+	return setting.DashboardStaleReportInterval <= 0
+}
+
+func (r *Reporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(setting.DashboardStaleReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := r.ServerLockService.LockAndExecute(ctx, "report stale dashboards", setting.DashboardStaleReportInterval, r.report)
+			if err != nil {
+				r.log.Error("Failed to lock and execute the stale dashboards report", "error", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// report sends the report of each organization. Failures are logged, they do not stop the other organizations.
+func (r *Reporter) report() {
+	for page := 0; ; page++ {
+		query := &models.SearchOrgsQuery{Limit: orgsPageSize, Page: page}
+		if err := bus.Dispatch(query); err != nil {
+			r.log.Error("Failed to get organizations", "error", err)
+			return
+		}
+
+		for _, org := range query.Result {
+			r.reportOrg(org.Id)
+		}
+
+		if len(query.Result) < orgsPageSize {
+			return
+		}
+	}
+}
+
+func (r *Reporter) reportOrg(orgId int64) {
+	stale, err := dashboards.NewService().GetStaleDashboards(orgId, setting.DashboardStaleAfter, setting.DashboardStaleExcludeTags)
+	if err != nil {
+		r.log.Error("Failed to get stale dashboards", "orgId", orgId, "error", err)
+		return
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	usersQuery := &models.GetOrgUsersQuery{OrgId: orgId}
+	if err := bus.Dispatch(usersQuery); err != nil {
+		r.log.Error("Failed to get org users", "orgId", orgId, "error", err)
+		return
+	}
+
+	expires := now().Add(setting.DashboardStaleReportInterval)
+	folderIds, folders := groupByFolder(orgId, stale, expires)
+
+	// the folders of each admin, in the order of the admins and of the folders
+	emails := make([]string, 0)
+	foldersByEmail := make(map[string][]*reportFolder)
+	for _, folderId := range folderIds {
+		for _, email := range r.folderAdminEmails(orgId, folderId, usersQuery.Result) {
+			if _, ok := foldersByEmail[email]; !ok {
+				emails = append(emails, email)
+			}
+			foldersByEmail[email] = append(foldersByEmail[email], folders[folderId])
+		}
+	}
+
+	if len(emails) == 0 {
+		r.log.Warn("No admin to notify about stale dashboards", "orgId", orgId, "dashboards", len(stale))
+		return
+	}
+
+	for _, email := range emails {
+		r.send(orgId, email, foldersByEmail[email])
+	}
+}
+
+func (r *Reporter) send(orgId int64, email string, folders []*reportFolder) {
+	count := 0
+	for _, folder := range folders {
+		count += len(folder.Dashboards)
+	}
+
+	cmd := &models.SendEmailCommand{
+		To:       []string{email},
+		Template: "stale_dashboards.html",
+		Subject:  fmt.Sprintf("%d dashboards not viewed for %s", count, staleAfterText()),
+		Data: map[string]interface{}{
+			"Folders":       folders,
+			"Count":         count,
+			"StaleAfter":    staleAfterText(),
+			"ArchiveFolder": setting.DashboardArchiveFolder,
+		},
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		r.log.Error("Failed to send stale dashboards email", "orgId", orgId, "error", err)
+	}
+}
+
+// groupByFolder returns the ids of the folders of the dashboards, in the order of the dashboards, and the
+// folders of the email
+func groupByFolder(orgId int64, stale []*models.StaleDashboard, expires time.Time) ([]int64, map[int64]*reportFolder) {
+	folderIds := make([]int64, 0)
+	folders := make(map[int64]*reportFolder)
+
+	for _, dash := range stale {
+		folder, ok := folders[dash.FolderId]
+		if !ok {
+			folder = &reportFolder{Title: dash.FolderTitle}
+			if dash.FolderId == 0 {
+				folder.Title = models.RootFolderName
+			}
+			folders[dash.FolderId] = folder
+			folderIds = append(folderIds, dash.FolderId)
+		}
+
+		token := dashboards.SignArchiveToken(orgId, dash.Id, dash.Version, expires)
+		folder.Dashboards = append(folder.Dashboards, &reportDashboard{
+			Title:      dash.Title,
+			Url:        models.GetFullDashboardUrl(dash.Uid, dash.Slug),
+			ArchiveUrl: fmt.Sprintf("%sdashboard-archive/%s?orgId=%d&token=%s", setting.AppUrl, dash.Uid, orgId, url.QueryEscape(token)),
+			LastViewed: dash.LastViewed.Format("2006-01-02"),
+		})
+	}
+
+	return folderIds, folders
+}
+
+// folderAdminEmails returns the emails of the org admins and of the users with the admin permission on the folder,
+// directly, through a team or through their role
+func (r *Reporter) folderAdminEmails(orgId int64, folderId int64, orgUsers []*models.OrgUserDTO) []string {
+	to := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(email string) {
+		if email != "" && !seen[email] {
+			seen[email] = true
+			to = append(to, email)
+		}
+	}
+
+	for _, user := range orgUsers {
+		if user.Role == string(models.ROLE_ADMIN) {
+			add(user.Email)
+		}
+	}
+
+	if folderId == 0 {
+		return to
+	}
+
+	aclQuery := &models.GetDashboardAclInfoListQuery{OrgId: orgId, DashboardId: folderId}
+	if err := bus.Dispatch(aclQuery); err != nil {
+		r.log.Error("Failed to get folder permissions", "orgId", orgId, "folderId", folderId, "error", err)
+		return to
+	}
+
+	for _, item := range aclQuery.Result {
+		if item.Permission != models.PERMISSION_ADMIN {
+			continue
+		}
+
+		switch {
+		case item.UserId > 0:
+			add(item.UserEmail)
+		case item.TeamId > 0:
+			membersQuery := &models.GetTeamMembersQuery{OrgId: orgId, TeamId: item.TeamId}
+			if err := bus.Dispatch(membersQuery); err != nil {
+				r.log.Error("Failed to get team members", "orgId", orgId, "teamId", item.TeamId, "error", err)
+				continue
+			}
+			for _, member := range membersQuery.Result {
+				add(member.Email)
+			}
+		case item.Role != nil:
+			for _, user := range orgUsers {
+				if user.Role == string(*item.Role) {
+					add(user.Email)
+				}
+			}
+		}
+	}
+
+	return to
+}
+
+// staleAfterText is stale_after in days for the emails
+func staleAfterText() string {
+	days := int(setting.DashboardStaleAfter.Hours() / 24)
+	switch {
+	case days < 1:
+		return setting.DashboardStaleAfter.String()
+	case days == 1:
+		return "1 day"
+	default:
+		return fmt.Sprintf("%d days", days)
+	}
+}
@@ -0,0 +1,131 @@
+package staledashboards
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReporter(t *testing.T) {
+	Convey("Given a reporter of stale dashboards", t, func() {
+		bus.ClearBusHandlers()
+
+		current := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+		origNow := now
+		now = func() time.Time { return current }
+
+		origAppUrl, origStaleAfter, origInterval := setting.AppUrl, setting.DashboardStaleAfter, setting.DashboardStaleReportInterval
+		setting.AppUrl = "http://grafana.example.com/"
+		setting.DashboardStaleAfter = 180 * 24 * time.Hour
+		setting.DashboardStaleReportInterval = 7 * 24 * time.Hour
+
+		origNewService := dashboards.NewService
+		service := &dashboards.FakeDashboardService{StaleDashboards: []*models.StaleDashboard{
+			{Id: 1, Uid: "cpu", Title: "CPU", Slug: "cpu", Version: 3, LastViewed: current.AddDate(-1, 0, 0)},
+			{Id: 2, Uid: "disk", Title: "Disk", Slug: "disk", FolderId: 10, FolderTitle: "Ops", LastViewed: current.AddDate(0, -7, 0)},
+		}}
+		dashboards.MockDashboardService(service)
+
+		bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+			query.Result = []*models.OrgDTO{{Id: 1, Name: "Main"}}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetOrgUsersQuery) error {
+			query.Result = []*models.OrgUserDTO{
+				{OrgId: 1, Email: "admin@example.com", Role: string(models.ROLE_ADMIN)},
+				{OrgId: 1, Email: "editor@example.com", Role: string(models.ROLE_EDITOR)},
+				{OrgId: 1, Email: "viewer@example.com", Role: string(models.ROLE_VIEWER)},
+			}
+			return nil
+		})
+
+		editorRole := models.ROLE_EDITOR
+		acl := []*models.DashboardAclInfoDTO{
+			{DashboardId: 10, UserId: 5, UserEmail: "owner@example.com", Permission: models.PERMISSION_ADMIN},
+			{DashboardId: 10, UserId: 6, UserEmail: "reader@example.com", Permission: models.PERMISSION_VIEW},
+		}
+		bus.AddHandler("test", func(query *models.GetDashboardAclInfoListQuery) error {
+			query.Result = acl
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetTeamMembersQuery) error {
+			query.Result = []*models.TeamMemberDTO{{UserId: 7, Email: "ops@example.com"}, {UserId: 5, Email: "owner@example.com"}}
+			return nil
+		})
+
+		sent := make(map[string]*models.SendEmailCommand)
+		bus.AddHandler("test", func(cmd *models.SendEmailCommand) error {
+			sent[strings.Join(cmd.To, ",")] = cmd
+			return nil
+		})
+
+		reporter := &Reporter{log: log.New("stale-dashboards")}
+		folderTitles := func(cmd *models.SendEmailCommand) []string {
+			titles := make([]string, 0)
+			for _, folder := range cmd.Data["Folders"].([]*reportFolder) {
+				titles = append(titles, folder.Title)
+			}
+			return titles
+		}
+
+		Convey("Should send org admins all the stale dashboards and folder admins the ones of their folders", func() {
+			reporter.report()
+
+			So(sent, ShouldHaveLength, 2)
+			So(sent["admin@example.com"].Template, ShouldEqual, "stale_dashboards.html")
+			So(sent["admin@example.com"].Subject, ShouldEqual, "2 dashboards not viewed for 180 days")
+			So(folderTitles(sent["admin@example.com"]), ShouldResemble, []string{"General", "Ops"})
+			So(folderTitles(sent["owner@example.com"]), ShouldResemble, []string{"Ops"})
+			So(sent["owner@example.com"].Data["Count"], ShouldEqual, 1)
+		})
+
+		Convey("Should send the folder to the admins through a team or a role", func() {
+			acl = append(acl,
+				&models.DashboardAclInfoDTO{DashboardId: 10, TeamId: 2, Permission: models.PERMISSION_ADMIN},
+				&models.DashboardAclInfoDTO{DashboardId: 10, Role: &editorRole, Permission: models.PERMISSION_ADMIN},
+			)
+			reporter.report()
+
+			So(sent, ShouldHaveLength, 4)
+			So(sent, ShouldContainKey, "ops@example.com")
+			So(sent, ShouldContainKey, "editor@example.com")
+			So(sent, ShouldNotContainKey, "viewer@example.com")
+		})
+
+		Convey("Should link the dashboards with archive links valid until the next report", func() {
+			reporter.report()
+
+			dash := sent["admin@example.com"].Data["Folders"].([]*reportFolder)[0].Dashboards[0]
+			So(dash.Url, ShouldEqual, "http://grafana.example.com/d/cpu/cpu")
+			So(dash.LastViewed, ShouldEqual, "2018-09-01")
+
+			link, err := url.Parse(dash.ArchiveUrl)
+			So(err, ShouldBeNil)
+			So(link.Path, ShouldEqual, "/dashboard-archive/cpu")
+			So(link.Query().Get("orgId"), ShouldEqual, "1")
+			So(link.Query().Get("token"), ShouldEqual, dashboards.SignArchiveToken(1, 1, 3, current.Add(7*24*time.Hour)))
+		})
+
+		Convey("Should not send anything without stale dashboards", func() {
+			service.StaleDashboards = []*models.StaleDashboard{}
+			reporter.report()
+
+			So(sent, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			now = origNow
+			setting.AppUrl, setting.DashboardStaleAfter, setting.DashboardStaleReportInterval = origAppUrl, origStaleAfter, origInterval
+			dashboards.NewService = origNewService
+			bus.ClearBusHandlers()
+		})
+	})
+}
@@ -46,6 +46,21 @@ var (
 	ERR_TEMPLATE_NAME = "error"
 )
 
+// FolderMoveNotificationCheck values tell how the notification channels of the alerts of a dashboard moved to
+// another folder are checked against the permissions of the user in the folder
+const (
+	FolderMoveNotificationCheckOff    = "off"
+	FolderMoveNotificationCheckWarn   = "warn"
+	FolderMoveNotificationCheckStrict = "strict"
+)
+
+// SyncFailurePolicy values tell how a failed dashboard commit affects the saves of batch operations
+const (
+	SyncFailurePolicyFail  = "fail"
+	SyncFailurePolicyWarn  = "warn"
+	SyncFailurePolicyQueue = "queue"
+)
+
 var (
 	// App settings.
 	Env              = DEV
@@ -113,6 +128,114 @@ var (
 	// Dashboard history
 	DashboardVersionsToKeep int
 
+	// Dashboard imports
+	DashboardDefaultImportFolder string
+
+	// Dashboard time settings
+	DashboardMinRefreshInterval     time.Duration
+	DashboardTimeSettingsValidation string
+
+	// Library panels referenced by dashboards, checked on save
+	DashboardLibraryPanelValidation string
+
+	// Maximum nesting of objects and arrays in dashboard json
+	DashboardMaxNestingDepth int
+
+	// Panel limits of dashboards
+	DashboardMaxPanels     int
+	DashboardMaxRows       int
+	DashboardMaxPanelDepth int
+
+	// Titles of only whitespace, rejected or replaced by Untitled dashboard
+	DashboardWhitespaceTitlePolicy string
+
+	// Large values in dashboards, e.g. embedded images
+	DashboardMaxValueSize     int
+	DashboardLargeValuePolicy string
+
+	// Template variable checks on save
+	DashboardValidateTemplating            bool
+	DashboardValidateTemplatingDatasources bool
+	// DashboardNormalizeTemplating removes the transient fields of the template variables committed to git
+	DashboardNormalizeTemplating bool
+	// DashboardSortTemplateVariables sorts the normalized template variables by name
+	DashboardSortTemplateVariables bool
+	// DashboardExportCacheSize is the number of exported dashboards kept in memory, 0 disables the cache
+	DashboardExportCacheSize int
+	// DashboardJobRetention is how long finished dashboard jobs are kept, 0 keeps them
+	DashboardJobRetention time.Duration
+	// DashboardPreviewMaxSize is the largest dashboard file in bytes previewed at a commit of the repository
+	DashboardPreviewMaxSize int
+
+	// Deleting folders left empty by deletes and moves
+	DashboardAutoPruneEmptyFolders bool
+	DashboardAutoPruneGracePeriod  time.Duration
+
+	// Emails to org admins when dashboard commits fail
+	DashboardSyncFailureAlertWindow   time.Duration
+	DashboardSyncFailureEscalateAfter time.Duration
+
+	// Daily budgets of the dashboard commits of each organization, 0 is unlimited
+	DashboardSyncDailyCommitBudget int
+	DashboardSyncDailyByteBudget   int64
+
+	// Token buckets of the dashboard saves of each user and each organization, in saves per minute and saves
+	// allowed in a burst, a rate of 0 is unlimited
+	DashboardSaveRatePerUser  int
+	DashboardSaveBurstPerUser int
+	DashboardSaveRatePerOrg   int
+	DashboardSaveBurstPerOrg  int
+
+	// DashboardBatchSyncFailurePolicy is fail, warn or queue, see the SyncFailurePolicy constants
+	DashboardBatchSyncFailurePolicy string
+
+	// Retries of the queued dashboard commits: the attempts before a commit fails, how long an instance making a
+	// commit holds it, the delay before the first retry, doubled by each attempt, and how long the made commits
+	// are kept, 0 keeps them
+	DashboardSyncQueueMaxAttempts int
+	DashboardSyncQueueLease       time.Duration
+	DashboardSyncQueueRetryDelay  time.Duration
+	DashboardSyncQueueRetention   time.Duration
+
+	// HMAC key of the dashboard bundles of organizations
+	DashboardBundleSigningKey string
+
+	// Two-phase deletes of dashboards
+	DashboardDeleteConfirmation    bool
+	DashboardDeleteConfirmationTTL time.Duration
+
+	// Stale dashboards, not viewed for DashboardStaleAfter. The report of the stale dashboards is sent every
+	// DashboardStaleReportInterval, 0 disables it, and archiving moves them to the DashboardArchiveFolder folder.
+	DashboardStaleAfter          time.Duration
+	DashboardStaleReportInterval time.Duration
+	DashboardStaleExcludeTags    []string
+	DashboardArchiveFolder       string
+
+	// Read-only maintenance of dashboards forced by the configuration, with the message of the operator and the
+	// estimated end, zero when unknown. The maintenance can also be turned on through the admin API.
+	DashboardReadOnly        bool
+	DashboardReadOnlyMessage string
+	DashboardReadOnlyUntil   time.Time
+
+	// Transformers of the dashboards of organizations, from the [dashboards.transformers.<name>] sections
+	DashboardTransformers []*DashboardTransformerSettings
+
+	// Refresh interval and time range policies of organizations, from the [dashboards.time_policy.<name>] sections
+	DashboardTimePolicies []*DashboardTimePolicySettings
+
+	// Uid prefixes kept for provisioned dashboards
+	DashboardReservedUidPrefixes      []string
+	DashboardRequireReservedUidPrefix bool
+
+	// Uids of the dashboards that cannot be deleted or have their uid changed, whatever the permissions
+	DashboardProtectedUids []string
+
+	// DashboardDisabledSaveStages are the optional stages of dashboard saves that are skipped, e.g. sync
+	DashboardDisabledSaveStages []string
+
+	// DashboardGitUrlImportAllowedHosts are the hosts dashboards can be imported from by url, none disables it
+	DashboardGitUrlImportAllowedHosts []string
+
 	// User settings
 	AllowUserSignUp         bool
 	AllowUserOrgCreate      bool
@@ -194,6 +317,13 @@ var (
 	AlertingNotificationTimeout time.Duration
 	AlertingMaxAttempts         int
 
+	AlertingExtractionConcurrency int
+	AlertingExtractionTimeout     time.Duration
+	// AlertingVerifyDatasourcePermissions rejects alerts querying data sources the user saving them cannot query
+	AlertingVerifyDatasourcePermissions bool
+	// AlertingFolderMoveNotificationCheck is off, warn or strict, see the FolderMoveNotificationCheck constants
+	AlertingFolderMoveNotificationCheck string
+
 	// Explore UI
 	ExploreEnabled bool
 
@@ -743,6 +873,57 @@ func (cfg *Cfg) Load(args *CommandLineArgs) error {
 	// read dashboard settings
 	dashboards := iniFile.Section("dashboards")
 	DashboardVersionsToKeep = dashboards.Key("versions_to_keep").MustInt(20)
+	DashboardDefaultImportFolder = strings.TrimSpace(dashboards.Key("default_import_folder").String())
+	DashboardMinRefreshInterval = dashboards.Key("min_refresh_interval").MustDuration(0)
+	DashboardTimeSettingsValidation = dashboards.Key("time_settings_validation").In("off", []string{"off", "warn", "reject"})
+	DashboardLibraryPanelValidation = dashboards.Key("library_panel_validation").In("off", []string{"off", "warn", "reject"})
+	DashboardMaxNestingDepth = dashboards.Key("max_nesting_depth").MustInt(100)
+	DashboardMaxPanels = dashboards.Key("max_panels").MustInt(0)
+	DashboardMaxRows = dashboards.Key("max_rows").MustInt(0)
+	DashboardMaxPanelDepth = dashboards.Key("max_panel_depth").MustInt(0)
+	DashboardWhitespaceTitlePolicy = dashboards.Key("whitespace_title_policy").In("reject", []string{"reject", "untitled"})
+	DashboardMaxValueSize = dashboards.Key("max_value_size").MustInt(262144)
+	DashboardLargeValuePolicy = dashboards.Key("large_value_policy").In("reject", []string{"reject", "extract"})
+	DashboardValidateTemplating = dashboards.Key("validate_templating").MustBool(false)
+	DashboardValidateTemplatingDatasources = dashboards.Key("validate_templating_datasources").MustBool(false)
+	DashboardNormalizeTemplating = dashboards.Key("normalize_templating").MustBool(false)
+	DashboardSortTemplateVariables = dashboards.Key("sort_template_variables").MustBool(false)
+	DashboardExportCacheSize = dashboards.Key("export_cache_size").MustInt(0)
+	DashboardJobRetention = dashboards.Key("job_retention").MustDuration(7 * 24 * time.Hour)
+	DashboardPreviewMaxSize = dashboards.Key("preview_max_size").MustInt(2097152)
+	DashboardAutoPruneEmptyFolders = dashboards.Key("auto_prune_empty_folders").MustBool(false)
+	DashboardAutoPruneGracePeriod = dashboards.Key("auto_prune_grace_period").MustDuration(24 * time.Hour)
+	DashboardSyncFailureAlertWindow = dashboards.Key("sync_failure_alert_window").MustDuration(time.Hour)
+	DashboardSyncFailureEscalateAfter = dashboards.Key("sync_failure_escalate_after").MustDuration(24 * time.Hour)
+	DashboardSyncDailyCommitBudget = dashboards.Key("sync_daily_commit_budget").MustInt(0)
+	DashboardSyncDailyByteBudget = dashboards.Key("sync_daily_byte_budget").MustInt64(0)
+	DashboardSaveRatePerUser = dashboards.Key("save_rate_per_user").MustInt(120)
+	DashboardSaveBurstPerUser = dashboards.Key("save_burst_per_user").MustInt(60)
+	DashboardSaveRatePerOrg = dashboards.Key("save_rate_per_org").MustInt(1200)
+	DashboardSaveBurstPerOrg = dashboards.Key("save_burst_per_org").MustInt(600)
+	DashboardBatchSyncFailurePolicy = dashboards.Key("batch_sync_failure_policy").In(SyncFailurePolicyFail,
+		[]string{SyncFailurePolicyFail, SyncFailurePolicyWarn, SyncFailurePolicyQueue})
+	DashboardSyncQueueMaxAttempts = dashboards.Key("sync_queue_max_attempts").MustInt(10)
+	DashboardSyncQueueLease = dashboards.Key("sync_queue_lease").MustDuration(5 * time.Minute)
+	DashboardSyncQueueRetryDelay = dashboards.Key("sync_queue_retry_delay").MustDuration(time.Minute)
+	DashboardSyncQueueRetention = dashboards.Key("sync_queue_retention").MustDuration(7 * 24 * time.Hour)
+	DashboardBundleSigningKey = dashboards.Key("bundle_signing_key").String()
+	DashboardDeleteConfirmation = dashboards.Key("delete_confirmation").MustBool(false)
+	DashboardDeleteConfirmationTTL = dashboards.Key("delete_confirmation_ttl").MustDuration(5 * time.Minute)
+	DashboardStaleAfter = dashboards.Key("stale_after").MustDuration(180 * 24 * time.Hour)
+	DashboardStaleReportInterval = dashboards.Key("stale_report_interval").MustDuration(0)
+	DashboardStaleExcludeTags = util.SplitString(dashboards.Key("stale_exclude_tags").String())
+	DashboardArchiveFolder = dashboards.Key("archive_folder").MustString("Archive")
+	DashboardReadOnly = dashboards.Key("read_only").MustBool(false)
+	DashboardReadOnlyMessage = dashboards.Key("read_only_message").String()
+	DashboardReadOnlyUntil = dashboards.Key("read_only_until").MustTimeFormat(time.RFC3339)
+	DashboardTransformers = readDashboardTransformers(iniFile)
+	DashboardTimePolicies = readDashboardTimePolicies(iniFile)
+	DashboardReservedUidPrefixes = util.SplitString(dashboards.Key("reserved_uid_prefixes").String())
+	DashboardProtectedUids = util.SplitString(dashboards.Key("protected_uids").String())
+	DashboardDisabledSaveStages = util.SplitString(dashboards.Key("disabled_save_stages").String())
+	DashboardGitUrlImportAllowedHosts = util.SplitString(dashboards.Key("git_url_import_allowed_hosts").String())
+	DashboardRequireReservedUidPrefix = dashboards.Key("provisioned_uid_prefix_required").MustBool(false)
 
 	//  read data source proxy white list
 	DataProxyWhiteList = make(map[string]bool)
@@ -934,6 +1115,12 @@ func (cfg *Cfg) Load(args *CommandLineArgs) error {
 	notificationTimeoutSeconds := alerting.Key("notification_timeout_seconds").MustInt64(30)
 	AlertingNotificationTimeout = time.Second * time.Duration(notificationTimeoutSeconds)
 	AlertingMaxAttempts = alerting.Key("max_attempts").MustInt(3)
+	AlertingExtractionConcurrency = alerting.Key("extraction_concurrency").MustInt(0)
+	extractionTimeoutSeconds := alerting.Key("extraction_timeout_seconds").MustInt64(30)
+	AlertingExtractionTimeout = time.Second * time.Duration(extractionTimeoutSeconds)
+	AlertingVerifyDatasourcePermissions = alerting.Key("verify_datasource_permissions").MustBool(false)
+	AlertingFolderMoveNotificationCheck = alerting.Key("folder_move_notification_check").In(FolderMoveNotificationCheckWarn,
+		[]string{FolderMoveNotificationCheckOff, FolderMoveNotificationCheckWarn, FolderMoveNotificationCheckStrict})
 
 	explore := iniFile.Section("explore")
 	ExploreEnabled = explore.Key("enabled").MustBool(true)
@@ -1021,6 +1208,59 @@ func valueAsString(section *ini.Section, keyName string, defaultValue string) (v
 	return section.Key(keyName).MustString(defaultValue), nil
 }
 
+// DashboardTransformerSettings configures the transformers changing the dashboards of an organization
+type DashboardTransformerSettings struct {
+	OrgId int64
+	// OnSave are the transformers run in order before a dashboard is saved
+	OnSave []string
+	// OnSync are the transformers run in order on the json committed to git, the saved dashboard is not changed
+	OnSync []string
+	// Options are the keys of the section, e.g. the mapping of the datasource remap
+	Options map[string]string
+}
+
+func readDashboardTransformers(iniFile *ini.File) []*DashboardTransformerSettings {
+	transformers := make([]*DashboardTransformerSettings, 0)
+
+	for _, sec := range iniFile.ChildSections("dashboards.transformers") {
+		transformers = append(transformers, &DashboardTransformerSettings{
+			OrgId:   sec.Key("org_id").MustInt64(0),
+			OnSave:  util.SplitString(sec.Key("on_save").String()),
+			OnSync:  util.SplitString(sec.Key("on_sync").String()),
+			Options: sec.KeysHash(),
+		})
+	}
+
+	return transformers
+}
+
+// DashboardTimePolicySettings configures the refresh interval and time range allowed in the dashboards of an
+// organization. Intervals are kept as written, e.g. 30s or 1d, to be set in the dashboards they are clamped to.
+type DashboardTimePolicySettings struct {
+	OrgId int64
+	// Mode is reject to fail the saves breaking the policy, or clamp to change the dashboards to follow it
+	Mode                    string
+	MinRefreshInterval      string
+	AllowedRefreshIntervals []string
+	MaxTimeRange            string
+}
+
+func readDashboardTimePolicies(iniFile *ini.File) []*DashboardTimePolicySettings {
+	policies := make([]*DashboardTimePolicySettings, 0)
+
+	for _, sec := range iniFile.ChildSections("dashboards.time_policy") {
+		policies = append(policies, &DashboardTimePolicySettings{
+			OrgId:                   sec.Key("org_id").MustInt64(0),
+			Mode:                    sec.Key("mode").In("clamp", []string{"clamp", "reject"}),
+			MinRefreshInterval:      strings.TrimSpace(sec.Key("min_refresh_interval").String()),
+			AllowedRefreshIntervals: util.SplitString(sec.Key("allowed_refresh_intervals").String()),
+			MaxTimeRange:            strings.TrimSpace(sec.Key("max_time_range").String()),
+		})
+	}
+
+	return policies
+}
+
 type RemoteCacheOptions struct {
 	Name    string
 	ConnStr string
@@ -17,6 +17,9 @@ type OAuthInfo struct {
 	TlsClientCa                  string
 	TlsSkipVerify                bool
 	SendClientCredentialsViaPost bool
+	GroupRoleMapping             map[string]string
+	DomainRoleMapping            map[string]string
+	ReturnUrlInState             bool
 }
 
 type OAuther struct {